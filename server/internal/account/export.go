@@ -0,0 +1,191 @@
+package account
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/user"
+	"github.com/google/uuid"
+)
+
+// The export archive holds every stored file under files/ plus a
+// metadata.json describing the account, tree, shares and activity.
+
+type exportFolder struct {
+	ID        uuid.UUID  `json:"id"`
+	ParentID  *uuid.UUID `json:"parent_id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type exportFile struct {
+	ID        uuid.UUID  `json:"id"`
+	FolderID  *uuid.UUID `json:"folder_id"`
+	Name      string     `json:"name"`
+	Path      string     `json:"path"`
+	SizeBytes int64      `json:"size_bytes"`
+	MimeType  string     `json:"mime_type,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type exportShare struct {
+	FileID     uuid.UUID `json:"file_id"`
+	SharedWith int32     `json:"shared_with"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type exportActivity struct {
+	FileID    *uuid.UUID      `json:"file_id"`
+	Action    string          `json:"action"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type exportMetadata struct {
+	ExportedAt time.Time         `json:"exported_at"`
+	Account    user.UserResponse `json:"account"`
+	Folders    []exportFolder    `json:"folders"`
+	Files      []exportFile      `json:"files"`
+	Shares     []exportShare     `json:"shares"`
+	Activity   []exportActivity  `json:"activity"`
+	Missing    []string          `json:"missing_files,omitempty"`
+}
+
+func nullUUID(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+// Export streams a zip of all the user's files and metadata into w.
+func (s *Service) Export(ctx context.Context, userID int32, w io.Writer) error {
+	account, err := s.userService.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("fetching user: %w", err)
+	}
+
+	uID := sql.NullInt32{Int32: userID, Valid: true}
+
+	folders, err := s.queries.ListUserFolders(ctx, uID)
+	if err != nil {
+		return fmt.Errorf("listing folders: %w", err)
+	}
+	files, err := s.queries.ListUserFiles(ctx, uID)
+	if err != nil {
+		return fmt.Errorf("listing files: %w", err)
+	}
+	shares, err := s.queries.ListSharesByOwner(ctx, uID)
+	if err != nil {
+		return fmt.Errorf("listing shares: %w", err)
+	}
+	activity, err := s.queries.ListUserActivity(ctx, uID)
+	if err != nil {
+		return fmt.Errorf("listing activity: %w", err)
+	}
+
+	meta := exportMetadata{
+		ExportedAt: time.Now().UTC(),
+		Account:    user.NewUserResponse(account),
+		Folders:    make([]exportFolder, 0, len(folders)),
+		Files:      make([]exportFile, 0, len(files)),
+		Shares:     make([]exportShare, 0, len(shares)),
+		Activity:   make([]exportActivity, 0, len(activity)),
+	}
+	for _, f := range folders {
+		meta.Folders = append(meta.Folders, exportFolder{
+			ID:        f.ID,
+			ParentID:  nullUUID(f.ParentID),
+			Name:      f.Name,
+			CreatedAt: f.CreatedAt.Time,
+			UpdatedAt: f.UpdatedAt.Time,
+		})
+	}
+	for _, sh := range shares {
+		meta.Shares = append(meta.Shares, exportShare{
+			FileID:     sh.FileID.UUID,
+			SharedWith: sh.SharedWith.Int32,
+			Permission: sh.Permission.String,
+			CreatedAt:  sh.CreatedAt.Time,
+		})
+	}
+	for _, a := range activity {
+		entry := exportActivity{
+			FileID:    nullUUID(a.FileID),
+			Action:    a.Action,
+			CreatedAt: a.CreatedAt,
+		}
+		if a.Details.Valid {
+			entry.Details = a.Details.RawMessage
+		}
+		meta.Activity = append(meta.Activity, entry)
+	}
+
+	zipWriter := zip.NewWriter(w)
+
+	for _, f := range files {
+		meta.Files = append(meta.Files, exportFile{
+			ID:        f.ID,
+			FolderID:  nullUUID(f.FolderID),
+			Name:      f.Name,
+			Path:      filepath.ToSlash(f.FilePath),
+			SizeBytes: f.SizeBytes,
+			MimeType:  f.MimeType.String,
+			CreatedAt: f.CreatedAt.Time,
+			UpdatedAt: f.UpdatedAt.Time,
+		})
+
+		if err := s.addFile(zipWriter, userID, f); err != nil {
+			// A missing blob shouldn't cost the user the rest of the export
+			meta.Missing = append(meta.Missing, filepath.ToSlash(f.FilePath))
+		}
+	}
+
+	entry, err := zipWriter.Create("metadata.json")
+	if err != nil {
+		return fmt.Errorf("creating metadata entry: %w", err)
+	}
+	enc := json.NewEncoder(entry)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(meta); err != nil {
+		return fmt.Errorf("writing metadata: %w", err)
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("finishing archive: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) addFile(zw *zip.Writer, userID int32, f database.File) error {
+	content, err := s.storage.ReadFile(userID, f.FilePath)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	header := &zip.FileHeader{
+		Name:   "files/" + filepath.ToSlash(f.FilePath),
+		Method: zip.Deflate,
+	}
+	if f.UpdatedAt.Valid {
+		header.Modified = f.UpdatedAt.Time
+	}
+
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, content)
+	return err
+}
@@ -0,0 +1,143 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/content"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+)
+
+// All handlers here act on the caller's own account and must be mounted
+// behind AuthMiddleware.
+
+type ServiceInterface interface {
+	RequestDeletion(ctx context.Context, userID int32, password string) (database.User, time.Time, error)
+	CancelDeletion(ctx context.Context, userID int32) error
+	Export(ctx context.Context, userID int32, w io.Writer) error
+}
+
+// DeletionNotifier tells the user when their account will be purged.
+type DeletionNotifier func(ctx context.Context, to string, scheduledAt time.Time) error
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type DeletionResponse struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+	ExportURL           string    `json:"export_url"`
+}
+
+func RequestDeletionHandler(service ServiceInterface, notify DeletionNotifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req DeleteAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if req.Password == "" {
+			util.RespondWithError(w, http.StatusBadRequest, "Password is required")
+			return
+		}
+
+		user, scheduledAt, err := service.RequestDeletion(r.Context(), userID, req.Password)
+		if err != nil {
+			if errors.Is(err, ErrInvalidPassword) {
+				util.RespondWithError(w, http.StatusUnauthorized, "Invalid password")
+				return
+			}
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// The deletion is already scheduled, so a lost email isn't fatal
+		if err := notify(r.Context(), user.Email, scheduledAt); err != nil {
+			log.Printf("notifying user %d of account deletion: %v", userID, err)
+		}
+
+		util.RespondWithJSON(w, http.StatusAccepted, DeletionResponse{
+			DeletionScheduledAt: scheduledAt,
+			ExportURL:           "/users/me/export",
+		})
+	}
+}
+
+func CancelDeletionHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		if err := service.CancelDeletion(r.Context(), userID); err != nil {
+			if errors.Is(err, ErrNoPendingDeletion) {
+				util.RespondWithError(w, http.StatusConflict, err.Error())
+				return
+			}
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{
+			"message": "Account deletion cancelled",
+		})
+	}
+}
+
+// attachmentWriter sets the download headers on the first write, so an error
+// raised before any data is produced can still be sent as JSON.
+type attachmentWriter struct {
+	w        http.ResponseWriter
+	filename string
+	started  bool
+}
+
+func (a *attachmentWriter) Write(p []byte) (int, error) {
+	if !a.started {
+		a.w.Header().Set("Content-Type", "application/zip")
+		a.w.Header().Set("Content-Disposition", content.Disposition(content.DispositionAttachment, a.filename))
+		content.SetSafetyHeaders(a.w.Header())
+		a.started = true
+	}
+	return a.w.Write(p)
+}
+
+func ExportHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		aw := &attachmentWriter{
+			w:        w,
+			filename: fmt.Sprintf("cloud-storage-export-%s.zip", time.Now().UTC().Format("2006-01-02")),
+		}
+		if err := service.Export(r.Context(), userID, aw); err != nil {
+			if !aw.started {
+				util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			// Part of the archive is already out; all we can do is log
+			log.Printf("exporting account %d: %v", userID, err)
+		}
+	}
+}
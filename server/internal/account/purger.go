@@ -0,0 +1,123 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+)
+
+const (
+	defaultPollInterval = time.Minute
+	defaultBatchSize    = 10
+	defaultLease        = 30 * time.Minute
+)
+
+type PurgeQueries interface {
+	ClaimDueAccountDeletions(ctx context.Context, arg database.ClaimDueAccountDeletionsParams) ([]int32, error)
+	DeleteUserRefreshTokens(ctx context.Context, userID int32) (int64, error)
+	DeleteUserShares(ctx context.Context, sharedWith sql.NullInt32) (int64, error)
+	DeleteUserActivity(ctx context.Context, userID sql.NullInt32) (int64, error)
+	PurgeUser(ctx context.Context, id int32) (int64, error)
+}
+
+// Purger removes accounts whose deletion grace period is over.
+type Purger struct {
+	queries      PurgeQueries
+	storage      storage.Storage
+	PollInterval time.Duration
+	BatchSize    int32
+	Lease        time.Duration
+}
+
+func NewPurger(q PurgeQueries, s storage.Storage) *Purger {
+	return &Purger{
+		queries:      q,
+		storage:      s,
+		PollInterval: defaultPollInterval,
+		BatchSize:    defaultBatchSize,
+		Lease:        defaultLease,
+	}
+}
+
+// Run polls until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.ProcessBatch(ctx); err != nil {
+			log.Printf("account purger: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessBatch purges one batch of due accounts and returns how many were
+// removed. Failed purges are retried once their lease expires.
+func (p *Purger) ProcessBatch(ctx context.Context) (int, error) {
+	ids, err := p.queries.ClaimDueAccountDeletions(ctx, database.ClaimDueAccountDeletionsParams{
+		LeaseSeconds: p.Lease.Seconds(),
+		BatchSize:    p.BatchSize,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("claiming accounts: %w", err)
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if err := p.Purge(ctx, id); err != nil {
+			log.Printf("account purger: user %d: %v", id, err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// Purge removes everything the user owns. Every step is idempotent and the
+// users row goes last, so a purge that fails halfway is simply run again.
+func (p *Purger) Purge(ctx context.Context, userID int32) error {
+	uID := sql.NullInt32{Int32: userID, Valid: true}
+
+	// 1. Stored files
+	if err := p.storage.DeleteUserData(userID); err != nil {
+		return fmt.Errorf("deleting storage: %w", err)
+	}
+
+	// 2. Shares to and from the user
+	if _, err := p.queries.DeleteUserShares(ctx, uID); err != nil {
+		return fmt.Errorf("deleting shares: %w", err)
+	}
+
+	// 3. Activity, which would otherwise outlive the user with a NULL user_id
+	if _, err := p.queries.DeleteUserActivity(ctx, uID); err != nil {
+		return fmt.Errorf("deleting activity: %w", err)
+	}
+
+	// 4. Sessions
+	if _, err := p.queries.DeleteUserRefreshTokens(ctx, userID); err != nil {
+		return fmt.Errorf("deleting refresh tokens: %w", err)
+	}
+
+	// 5. The user row; folders and files cascade
+	rows, err := p.queries.PurgeUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("deleting user: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("user not found or deletion cancelled")
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+)
+
+const DefaultGracePeriod = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidPassword   = errors.New("invalid password")
+	ErrNoPendingDeletion = errors.New("no account deletion to cancel")
+)
+
+type Queries interface {
+	ScheduleAccountDeletion(ctx context.Context, arg database.ScheduleAccountDeletionParams) (sql.NullTime, error)
+	CancelAccountDeletion(ctx context.Context, id int32) (int64, error)
+	ListUserFolders(ctx context.Context, userID sql.NullInt32) ([]database.Folder, error)
+	ListUserFiles(ctx context.Context, userID sql.NullInt32) ([]database.File, error)
+	ListSharesByOwner(ctx context.Context, userID sql.NullInt32) ([]database.FileShare, error)
+	ListUserActivity(ctx context.Context, userID sql.NullInt32) ([]database.FileActivity, error)
+}
+
+type UserService interface {
+	GetUserByID(ctx context.Context, id int32) (database.User, error)
+}
+
+type Service struct {
+	queries     Queries
+	userService UserService
+	storage     storage.Storage
+	gracePeriod time.Duration
+}
+
+func NewService(q Queries, us UserService, s storage.Storage, gracePeriod time.Duration) *Service {
+	return &Service{queries: q, userService: us, storage: s, gracePeriod: gracePeriod}
+}
+
+// GracePeriodFromEnv reads ACCOUNT_DELETION_GRACE as a Go duration, falling
+// back to DefaultGracePeriod.
+func GracePeriodFromEnv() time.Duration {
+	if v := os.Getenv("ACCOUNT_DELETION_GRACE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return DefaultGracePeriod
+}
+
+// RequestDeletion schedules the account for purging once the grace period is
+// over. Asking again while a deletion is pending keeps the original date.
+func (s *Service) RequestDeletion(ctx context.Context, userID int32, password string) (database.User, time.Time, error) {
+	user, err := s.userService.GetUserByID(ctx, userID)
+	if err != nil {
+		return database.User{}, time.Time{}, err
+	}
+
+	if err := util.CheckPassword(user.PasswordHash, password); err != nil {
+		return database.User{}, time.Time{}, ErrInvalidPassword
+	}
+
+	if user.DeletionScheduledAt.Valid {
+		return user, user.DeletionScheduledAt.Time, nil
+	}
+
+	scheduledAt, err := s.queries.ScheduleAccountDeletion(ctx, database.ScheduleAccountDeletionParams{
+		ID:           userID,
+		GraceSeconds: s.gracePeriod.Seconds(),
+	})
+	if err != nil {
+		return database.User{}, time.Time{}, fmt.Errorf("scheduling deletion: %w", err)
+	}
+
+	return user, scheduledAt.Time, nil
+}
+
+// CancelDeletion drops a pending deletion. Once the grace period has run out
+// the purge can no longer be stopped.
+func (s *Service) CancelDeletion(ctx context.Context, userID int32) error {
+	rowsAffected, err := s.queries.CancelAccountDeletion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoPendingDeletion
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/account"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) RequestDeletion(ctx context.Context, userID int32, password string) (database.User, time.Time, error) {
+	args := m.Called(ctx, userID, password)
+	return args.Get(0).(database.User), args.Get(1).(time.Time), args.Error(2)
+}
+
+func (m *MockService) CancelDeletion(ctx context.Context, userID int32) error {
+	return m.Called(ctx, userID).Error(0)
+}
+
+func (m *MockService) Export(ctx context.Context, userID int32, w io.Writer) error {
+	args := m.Called(ctx, userID, w)
+	if data, ok := args.Get(0).([]byte); ok {
+		w.Write(data)
+	}
+	return args.Error(1)
+}
+
+// asUser attaches an authenticated user ID the way AuthMiddleware would.
+func asUser(req *http.Request, userID int32) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), userID))
+}
+
+func TestRequestDeletionHandler_Success(t *testing.T) {
+	mockSvc := new(MockService)
+	due := time.Now().Add(7 * 24 * time.Hour)
+	var notified string
+	notify := func(ctx context.Context, to string, scheduledAt time.Time) error {
+		notified = to
+		return nil
+	}
+	handler := account.RequestDeletionHandler(mockSvc, notify)
+
+	mockSvc.On("RequestDeletion", mock.Anything, int32(4), "password123").Return(database.User{Email: "a@b.com"}, due, nil)
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/users/me/deletion", bytes.NewBufferString(`{"password":"password123"}`)), 4)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Contains(t, rec.Body.String(), "deletion_scheduled_at")
+	assert.Contains(t, rec.Body.String(), "/users/me/export")
+	assert.Equal(t, "a@b.com", notified)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestRequestDeletionHandler_WrongPassword(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := account.RequestDeletionHandler(mockSvc, nil)
+
+	mockSvc.On("RequestDeletion", mock.Anything, int32(4), "wrong").Return(database.User{}, time.Time{}, account.ErrInvalidPassword)
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/users/me/deletion", bytes.NewBufferString(`{"password":"wrong"}`)), 4)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestCancelDeletionHandler_NothingPending(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := account.CancelDeletionHandler(mockSvc)
+
+	mockSvc.On("CancelDeletion", mock.Anything, int32(4)).Return(account.ErrNoPendingDeletion)
+
+	req := asUser(httptest.NewRequest(http.MethodDelete, "/users/me/deletion", nil), 4)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestExportHandler_StreamsZip(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := account.ExportHandler(mockSvc)
+
+	mockSvc.On("Export", mock.Anything, int32(4), mock.Anything).Return([]byte("PK..."), nil)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/users/me/export", nil), 4)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), "attachment")
+	assert.Equal(t, "PK...", rec.Body.String())
+}
+
+func TestExportHandler_ErrorBeforeData(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := account.ExportHandler(mockSvc)
+
+	mockSvc.On("Export", mock.Anything, int32(4), mock.Anything).Return(nil, errors.New("db down"))
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/users/me/export", nil), 4)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+}
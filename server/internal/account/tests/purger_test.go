@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/account"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPurge_RemovesEverything(t *testing.T) {
+	mockQ := new(MockQueries)
+	mockStorage := new(MockStorage)
+	purger := account.NewPurger(mockQ, mockStorage)
+	ctx := context.Background()
+	uID := sql.NullInt32{Int32: 4, Valid: true}
+
+	mockStorage.On("DeleteUserData", int32(4)).Return(nil)
+	mockQ.On("DeleteUserShares", ctx, uID).Return(int64(2), nil)
+	mockQ.On("DeleteUserActivity", ctx, uID).Return(int64(10), nil)
+	mockQ.On("DeleteUserRefreshTokens", ctx, int32(4)).Return(int64(1), nil)
+	mockQ.On("PurgeUser", ctx, int32(4)).Return(int64(1), nil)
+
+	err := purger.Purge(ctx, 4)
+	assert.NoError(t, err)
+	mockQ.AssertExpectations(t)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestPurge_KeepsUserRowWhenStorageFails(t *testing.T) {
+	mockQ := new(MockQueries)
+	mockStorage := new(MockStorage)
+	purger := account.NewPurger(mockQ, mockStorage)
+	ctx := context.Background()
+
+	mockStorage.On("DeleteUserData", int32(4)).Return(errors.New("disk on fire"))
+
+	err := purger.Purge(ctx, 4)
+	assert.Error(t, err)
+	mockQ.AssertNotCalled(t, "PurgeUser", mock.Anything, mock.Anything)
+}
+
+func TestProcessBatch_ContinuesAfterFailure(t *testing.T) {
+	mockQ := new(MockQueries)
+	mockStorage := new(MockStorage)
+	purger := account.NewPurger(mockQ, mockStorage)
+	ctx := context.Background()
+
+	mockQ.On("ClaimDueAccountDeletions", ctx, mock.Anything).Return([]int32{1, 2}, nil)
+	mockStorage.On("DeleteUserData", int32(1)).Return(errors.New("disk on fire"))
+	mockStorage.On("DeleteUserData", int32(2)).Return(nil)
+	mockQ.On("DeleteUserShares", ctx, mock.Anything).Return(int64(0), nil)
+	mockQ.On("DeleteUserActivity", ctx, mock.Anything).Return(int64(0), nil)
+	mockQ.On("DeleteUserRefreshTokens", ctx, int32(2)).Return(int64(0), nil)
+	mockQ.On("PurgeUser", ctx, int32(2)).Return(int64(1), nil)
+
+	purged, err := purger.ProcessBatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+}
@@ -0,0 +1,253 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/account"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) ScheduleAccountDeletion(ctx context.Context, arg database.ScheduleAccountDeletionParams) (sql.NullTime, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(sql.NullTime), args.Error(1)
+}
+
+func (m *MockQueries) CancelAccountDeletion(ctx context.Context, id int32) (int64, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) ListUserFolders(ctx context.Context, userID sql.NullInt32) ([]database.Folder, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.Folder), args.Error(1)
+}
+
+func (m *MockQueries) ListUserFiles(ctx context.Context, userID sql.NullInt32) ([]database.File, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.File), args.Error(1)
+}
+
+func (m *MockQueries) ListSharesByOwner(ctx context.Context, userID sql.NullInt32) ([]database.FileShare, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.FileShare), args.Error(1)
+}
+
+func (m *MockQueries) ListUserActivity(ctx context.Context, userID sql.NullInt32) ([]database.FileActivity, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.FileActivity), args.Error(1)
+}
+
+func (m *MockQueries) ClaimDueAccountDeletions(ctx context.Context, arg database.ClaimDueAccountDeletionsParams) ([]int32, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]int32), args.Error(1)
+}
+
+func (m *MockQueries) DeleteUserRefreshTokens(ctx context.Context, userID int32) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) DeleteUserShares(ctx context.Context, sharedWith sql.NullInt32) (int64, error) {
+	args := m.Called(ctx, sharedWith)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) DeleteUserActivity(ctx context.Context, userID sql.NullInt32) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) PurgeUser(ctx context.Context, id int32) (int64, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockUserService struct {
+	mock.Mock
+}
+
+func (m *MockUserService) GetUserByID(ctx context.Context, id int32) (database.User, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.User), args.Error(1)
+}
+
+type MockStorage struct {
+	mock.Mock
+}
+
+func (m *MockStorage) SaveFile(userID int32, path string, content io.Reader) error {
+	return m.Called(userID, path, content).Error(0)
+}
+
+func (m *MockStorage) ReadFile(userID int32, path string) (io.ReadCloser, error) {
+	args := m.Called(userID, path)
+	if rc, ok := args.Get(0).(io.ReadCloser); ok {
+		return rc, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockStorage) DeleteFile(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) CreateDirectory(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) DeleteDirectory(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) MoveFile(userID int32, oldPath, newPath string) error {
+	return m.Called(userID, oldPath, newPath).Error(0)
+}
+
+func (m *MockStorage) CopyFile(userID int32, srcPath, dstPath string) error {
+	return m.Called(userID, srcPath, dstPath).Error(0)
+}
+
+func (m *MockStorage) MoveDirectory(userID int32, oldPath, newPath string) error {
+	return m.Called(userID, oldPath, newPath).Error(0)
+}
+
+func (m *MockStorage) ZipFolder(userID int32, folderPath string, w io.Writer) error {
+	return m.Called(userID, folderPath, w).Error(0)
+}
+
+func (m *MockStorage) ZipPaths(userID int32, paths []string, w io.Writer) error {
+	return m.Called(userID, paths, w).Error(0)
+}
+
+func (m *MockStorage) DeleteUserData(userID int32) error {
+	return m.Called(userID).Error(0)
+}
+
+func TestRequestDeletion_Schedules(t *testing.T) {
+	mockQ := new(MockQueries)
+	mockUsers := new(MockUserService)
+	svc := account.NewService(mockQ, mockUsers, new(MockStorage), 48*time.Hour)
+	ctx := context.Background()
+
+	hashed, _ := util.HashPassword("rightpass")
+	mockUsers.On("GetUserByID", ctx, int32(4)).Return(database.User{ID: 4, Email: "a@b.com", PasswordHash: hashed}, nil)
+
+	due := time.Now().Add(48 * time.Hour)
+	mockQ.On("ScheduleAccountDeletion", ctx, database.ScheduleAccountDeletionParams{
+		ID:           4,
+		GraceSeconds: (48 * time.Hour).Seconds(),
+	}).Return(sql.NullTime{Time: due, Valid: true}, nil)
+
+	u, scheduledAt, err := svc.RequestDeletion(ctx, 4, "rightpass")
+	assert.NoError(t, err)
+	assert.Equal(t, "a@b.com", u.Email)
+	assert.Equal(t, due, scheduledAt)
+	mockQ.AssertExpectations(t)
+}
+
+func TestRequestDeletion_WrongPassword(t *testing.T) {
+	mockQ := new(MockQueries)
+	mockUsers := new(MockUserService)
+	svc := account.NewService(mockQ, mockUsers, new(MockStorage), time.Hour)
+	ctx := context.Background()
+
+	hashed, _ := util.HashPassword("rightpass")
+	mockUsers.On("GetUserByID", ctx, int32(4)).Return(database.User{ID: 4, PasswordHash: hashed}, nil)
+
+	_, _, err := svc.RequestDeletion(ctx, 4, "wrongpass")
+	assert.ErrorIs(t, err, account.ErrInvalidPassword)
+	mockQ.AssertNotCalled(t, "ScheduleAccountDeletion", mock.Anything, mock.Anything)
+}
+
+func TestRequestDeletion_KeepsExistingDate(t *testing.T) {
+	mockQ := new(MockQueries)
+	mockUsers := new(MockUserService)
+	svc := account.NewService(mockQ, mockUsers, new(MockStorage), time.Hour)
+	ctx := context.Background()
+
+	hashed, _ := util.HashPassword("rightpass")
+	due := time.Now().Add(2 * time.Hour)
+	mockUsers.On("GetUserByID", ctx, int32(4)).Return(database.User{
+		ID:                  4,
+		PasswordHash:        hashed,
+		DeletionScheduledAt: sql.NullTime{Time: due, Valid: true},
+	}, nil)
+
+	_, scheduledAt, err := svc.RequestDeletion(ctx, 4, "rightpass")
+	assert.NoError(t, err)
+	assert.Equal(t, due, scheduledAt)
+	mockQ.AssertNotCalled(t, "ScheduleAccountDeletion", mock.Anything, mock.Anything)
+}
+
+func TestCancelDeletion_NothingPending(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := account.NewService(mockQ, new(MockUserService), new(MockStorage), time.Hour)
+	ctx := context.Background()
+
+	mockQ.On("CancelAccountDeletion", ctx, int32(4)).Return(int64(0), nil)
+
+	err := svc.CancelDeletion(ctx, 4)
+	assert.ErrorIs(t, err, account.ErrNoPendingDeletion)
+}
+
+func TestExport_WritesFilesAndMetadata(t *testing.T) {
+	mockQ := new(MockQueries)
+	mockUsers := new(MockUserService)
+	mockStorage := new(MockStorage)
+	svc := account.NewService(mockQ, mockUsers, mockStorage, time.Hour)
+	ctx := context.Background()
+	uID := sql.NullInt32{Int32: 4, Valid: true}
+
+	folderID := uuid.New()
+	present := database.File{ID: uuid.New(), FolderID: uuid.NullUUID{UUID: folderID, Valid: true}, Name: "a.txt", FilePath: "docs/a.txt", SizeBytes: 5}
+	missing := database.File{ID: uuid.New(), Name: "b.txt", FilePath: "b.txt", SizeBytes: 3}
+
+	mockUsers.On("GetUserByID", ctx, int32(4)).Return(database.User{ID: 4, Email: "a@b.com", PasswordHash: "secret-hash"}, nil)
+	mockQ.On("ListUserFolders", ctx, uID).Return([]database.Folder{{ID: folderID, Name: "docs"}}, nil)
+	mockQ.On("ListUserFiles", ctx, uID).Return([]database.File{present, missing}, nil)
+	mockQ.On("ListSharesByOwner", ctx, uID).Return([]database.FileShare{}, nil)
+	mockQ.On("ListUserActivity", ctx, uID).Return([]database.FileActivity{}, nil)
+	mockStorage.On("ReadFile", int32(4), "docs/a.txt").Return(io.NopCloser(bytes.NewBufferString("hello")), nil)
+	mockStorage.On("ReadFile", int32(4), "b.txt").Return(nil, errors.New("not found"))
+
+	var buf bytes.Buffer
+	err := svc.Export(ctx, 4, &buf)
+	assert.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+
+	entries := map[string]*zip.File{}
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+	assert.Contains(t, entries, "files/docs/a.txt")
+	assert.Contains(t, entries, "metadata.json")
+
+	rc, err := entries["metadata.json"].Open()
+	assert.NoError(t, err)
+	raw, _ := io.ReadAll(rc)
+	rc.Close()
+
+	var meta map[string]any
+	assert.NoError(t, json.Unmarshal(raw, &meta))
+	assert.Len(t, meta["files"], 2)
+	assert.Equal(t, []any{"b.txt"}, meta["missing_files"])
+	assert.NotContains(t, string(raw), "secret-hash")
+}
@@ -0,0 +1,229 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/bellezhang119/cloud-storage/internal/content"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+)
+
+// All handlers here must be mounted behind AuthMiddleware.
+
+type ServiceInterface interface {
+	List(ctx context.Context, fileID uuid.UUID, userID int32) ([]Entry, error)
+	OpenEntry(ctx context.Context, fileID uuid.UUID, userID int32, entryPath string) (Entry, io.ReadCloser, error)
+	StartExtract(ctx context.Context, fileID uuid.UUID, userID int32, dest *uuid.UUID) (database.Job, error)
+	Import(ctx context.Context, userID int32, parent uuid.NullUUID, format Format, policy string, body io.Reader) (ImportResult, error)
+}
+
+type ListResponse struct {
+	Entries []Entry `json:"entries"`
+}
+
+type ExtractRequest struct {
+	// Folder to extract into; null or omitted uses the archive's own folder
+	FolderID *uuid.UUID `json:"folder_id"`
+}
+
+type JobAccepted struct {
+	JobID     uuid.UUID `json:"job_id"`
+	StatusURL string    `json:"status_url"`
+}
+
+func respondWithServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrFolderNotFound), errors.Is(err, ErrEntryNotFound):
+		util.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrIsDirectory), errors.Is(err, ErrInvalidPolicy):
+		util.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrUnsupported):
+		util.RespondWithError(w, http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, ErrCorrupt), errors.Is(err, ErrUnsafePath), errors.Is(err, ErrTooManyEntries),
+		errors.Is(err, ErrTooLarge), errors.Is(err, ErrSuspiciousRatio):
+		util.RespondWithError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, quota.ErrExceeded):
+		util.RespondWithError(w, http.StatusInsufficientStorage, err.Error())
+	default:
+		util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func fileIDFromPath(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	fileID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid file ID")
+		return uuid.Nil, false
+	}
+	return fileID, true
+}
+
+// ListEntriesHandler serves GET /files/{id}/archive.
+func ListEntriesHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		fileID, ok := fileIDFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		entries, err := service.List(r.Context(), fileID, userID)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, ListResponse{Entries: entries})
+	}
+}
+
+// EntryHandler serves GET /files/{id}/archive/entry?path=, streaming one
+// file out of the archive. Its type is sniffed like an upload's, and
+// ?disposition=inline works as for downloads.
+func EntryHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		fileID, ok := fileIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		entryPath := r.URL.Query().Get("path")
+		if entryPath == "" {
+			util.RespondWithError(w, http.StatusBadRequest, "path is required")
+			return
+		}
+		disposition, ok := content.ParseDisposition(r.URL.Query().Get("disposition"))
+		if !ok {
+			util.RespondWithError(w, http.StatusBadRequest, "disposition must be inline or attachment")
+			return
+		}
+
+		entry, body, err := service.OpenEntry(r.Context(), fileID, userID, entryPath)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		defer body.Close()
+
+		name := path.Base(entry.Path)
+		mimeType, sniffed, err := content.Sniff(name, body)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+
+		content.SetHeaders(w.Header(), name, mimeType, entry.Size, disposition)
+		w.WriteHeader(http.StatusOK)
+
+		if _, err := io.Copy(w, sniffed); err != nil {
+			log.Printf("streaming archive entry: %v", err)
+		}
+	}
+}
+
+// ExtractHandler serves POST /files/{id}/archive/extract. Extraction always
+// runs in the background; the 202 response points at the job to poll.
+func ExtractHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		fileID, ok := fileIDFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		// The body is optional
+		var req ExtractRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		job, err := service.StartExtract(r.Context(), fileID, userID, req.FolderID)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusAccepted, JobAccepted{
+			JobID:     job.ID,
+			StatusURL: "/jobs/" + job.ID.String(),
+		})
+	}
+}
+
+// importFormat reads ?format=, falling back to the request's Content-Type.
+func importFormat(r *http.Request) (Format, bool) {
+	if v := r.URL.Query().Get("format"); v != "" {
+		return ParseFormat(v)
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/gzip") || strings.HasPrefix(contentType, "application/x-gzip") {
+		// A bare gzip stream is only importable as a tarball
+		return FormatTarGz, true
+	}
+	return DetectFormat("", contentType)
+}
+
+// ImportHandler serves POST /imports?parent_id=&on_conflict=&format=, with
+// the archive as the request body. The response lists what happened to each
+// entry; entries that failed don't fail the request.
+func ImportHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		q := r.URL.Query()
+		var parent uuid.NullUUID
+		if v := q.Get("parent_id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				util.RespondWithError(w, http.StatusBadRequest, "Invalid parent ID")
+				return
+			}
+			parent = uuid.NullUUID{UUID: id, Valid: true}
+		}
+
+		format, ok := importFormat(r)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnsupportedMediaType, "format must be zip, tar or tar.gz")
+			return
+		}
+
+		res, err := service.Import(r.Context(), userID, parent, format, q.Get("on_conflict"), r.Body)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, res)
+	}
+}
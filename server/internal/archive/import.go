@@ -0,0 +1,331 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bellezhang119/cloud-storage/internal/conflict"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/google/uuid"
+)
+
+// Import conflict policies for files. Folders are always merged, which is
+// what makes re-running an import safe.
+const (
+	Skip      = "skip"
+	Overwrite = conflict.Overwrite
+	Rename    = conflict.Rename
+)
+
+// Per-entry outcomes of an import.
+const (
+	StatusCreated     = "created"
+	StatusExists      = "exists" // a folder that was already there
+	StatusOverwritten = "overwritten"
+	StatusRenamed     = "renamed"
+	StatusSkipped     = "skipped"
+	StatusUnchanged   = "unchanged" // identical content already there
+	StatusFailed      = "failed"
+)
+
+var ErrInvalidPolicy = errors.New("on_conflict must be skip, overwrite or rename")
+
+// ParsePolicy validates an import conflict policy, defaulting to Skip.
+func ParsePolicy(s string) (string, error) {
+	switch s {
+	case "":
+		return Skip, nil
+	case Skip, Overwrite, Rename:
+		return s, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidPolicy, s)
+}
+
+type ImportEntry struct {
+	Path   string     `json:"path"`
+	IsDir  bool       `json:"is_dir"`
+	Status string     `json:"status"`
+	ID     *uuid.UUID `json:"id,omitempty"`
+	// Set when the entry was stored under a different name
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type ImportResult struct {
+	Entries []ImportEntry  `json:"entries"`
+	Counts  map[string]int `json:"counts"`
+}
+
+func (r *ImportResult) add(e ImportEntry) {
+	r.Entries = append(r.Entries, e)
+	r.Counts[e.Status]++
+}
+
+// Import recreates an uploaded archive's tree under parent (the root when
+// invalid). The upload is spooled and checked in full first, so an unsafe or
+// oversized archive is refused before anything is written. After that,
+// quota is enforced entry by entry and failures are reported per entry
+// rather than ending the import.
+//
+// Re-running an import is safe: folders are merged, and a file whose
+// content is already stored under its name is reported unchanged whatever
+// the policy, so a retry after a dropped connection neither duplicates nor
+// rewrites what made it the first time.
+func (s *Service) Import(ctx context.Context, userID int32, parent uuid.NullUUID, format Format, policy string, body io.Reader) (ImportResult, error) {
+	policy, err := ParsePolicy(policy)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	if parent.Valid {
+		if err := s.checkFolder(ctx, parent.UUID, userID); err != nil {
+			return ImportResult{}, err
+		}
+	}
+
+	spooled, err := spool(body, s.Limits.MaxBytes)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	spooledName := spooled.Name()
+	spooled.Close()
+	defer os.Remove(spooledName)
+
+	reopen := func() (*Reader, error) {
+		f, err := os.Open(spooledName)
+		if err != nil {
+			return nil, fmt.Errorf("reading upload: %w", err)
+		}
+		return NewReader(format, f, s.Limits)
+	}
+
+	// 1. Check the whole archive before writing anything
+	r, err := reopen()
+	if err != nil {
+		return ImportResult{}, err
+	}
+	for {
+		if _, err := r.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			r.Close()
+			return ImportResult{}, err
+		}
+	}
+	r.Close()
+
+	// 2. Recreate it
+	r, err = reopen()
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer r.Close()
+
+	imp := &importer{s: s, userID: userID, policy: policy, dirs: map[string]uuid.NullUUID{"": parent}}
+	res := ImportResult{Entries: []ImportEntry{}, Counts: map[string]int{}}
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		if e.IsDir {
+			res.add(imp.dir(ctx, e.Path))
+			continue
+		}
+		res.add(imp.file(ctx, r, e))
+	}
+}
+
+type importer struct {
+	s      *Service
+	userID int32
+	policy string
+	// Folder IDs by slash path, with "" the import's parent
+	dirs map[string]uuid.NullUUID
+}
+
+// ensureDir finds or creates each folder along p, reporting whether the
+// last one was created.
+func (imp *importer) ensureDir(ctx context.Context, p string) (uuid.NullUUID, bool, error) {
+	if id, ok := imp.dirs[p]; ok {
+		return id, false, nil
+	}
+	parentPath, name := path.Split(p)
+	parentID, _, err := imp.ensureDir(ctx, strings.TrimSuffix(parentPath, "/"))
+	if err != nil {
+		return uuid.NullUUID{}, false, err
+	}
+
+	existing, err := imp.s.queries.GetFolderByNameInParent(ctx, database.GetFolderByNameInParentParams{
+		UserID:   sql.NullInt32{Int32: imp.userID, Valid: true},
+		ParentID: parentID,
+		Name:     name,
+	})
+	switch {
+	case err == nil && existing.TrashedAt.Valid:
+		// Names stay taken in the trash, and importing into it would hide
+		// the files
+		return uuid.NullUUID{}, false, fmt.Errorf("folder %s is in the trash", p)
+	case err == nil:
+		id := uuid.NullUUID{UUID: existing.ID, Valid: true}
+		imp.dirs[p] = id
+		return id, false, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return uuid.NullUUID{}, false, fmt.Errorf("checking existing folder: %w", err)
+	}
+
+	created, err := imp.s.folders.CreateFolder(ctx, imp.userID, name, parentID)
+	if err != nil {
+		return uuid.NullUUID{}, false, fmt.Errorf("creating folder %s: %w", p, err)
+	}
+	id := uuid.NullUUID{UUID: created.ID, Valid: true}
+	imp.dirs[p] = id
+	return id, true, nil
+}
+
+func (imp *importer) dir(ctx context.Context, p string) ImportEntry {
+	id, created, err := imp.ensureDir(ctx, p)
+	if err != nil {
+		return ImportEntry{Path: p, IsDir: true, Status: StatusFailed, Error: err.Error()}
+	}
+	status := StatusExists
+	if created {
+		status = StatusCreated
+	}
+	return ImportEntry{Path: p, IsDir: true, Status: status, ID: &id.UUID}
+}
+
+func (imp *importer) file(ctx context.Context, r *Reader, e Entry) ImportEntry {
+	failed := func(err error) ImportEntry {
+		return ImportEntry{Path: e.Path, Status: StatusFailed, Error: err.Error()}
+	}
+
+	dir, name := path.Split(e.Path)
+	folderID, _, err := imp.ensureDir(ctx, strings.TrimSuffix(dir, "/"))
+	if err != nil {
+		return failed(err)
+	}
+
+	existing, taken, err := imp.existingFile(ctx, folderID, name)
+	if err != nil {
+		return failed(err)
+	}
+	if taken && imp.policy == Skip {
+		return ImportEntry{Path: e.Path, Status: StatusSkipped, ID: &existing.ID}
+	}
+
+	body, err := r.Open()
+	if err != nil {
+		return failed(err)
+	}
+
+	status := StatusCreated
+	var freed int64
+	if taken {
+		// Hold the content aside to compare it with what is stored
+		held, sum, err := holdAndHash(body)
+		if err != nil {
+			return failed(err)
+		}
+		defer os.Remove(held.Name())
+		defer held.Close()
+		body = held
+
+		if existing.Sha256.Valid && existing.Sha256.String == sum && existing.SizeBytes == e.Size {
+			return ImportEntry{Path: e.Path, Status: StatusUnchanged, ID: &existing.ID}
+		}
+
+		switch imp.policy {
+		case Overwrite:
+			status, freed = StatusOverwritten, existing.SizeBytes
+		case Rename:
+			// A retry finds its earlier copy among the renamed ones
+			var earlier *database.File
+			name, err = conflict.FreeName(name, true, func(candidate string) (bool, error) {
+				f, taken, err := imp.existingFile(ctx, folderID, candidate)
+				if taken && f.Sha256.Valid && f.Sha256.String == sum && f.SizeBytes == e.Size {
+					earlier = &f
+					return false, nil
+				}
+				return taken, err
+			})
+			if err != nil {
+				return failed(err)
+			}
+			if earlier != nil {
+				return ImportEntry{Path: e.Path, Status: StatusUnchanged, ID: &earlier.ID, Name: earlier.Name}
+			}
+			status = StatusRenamed
+		}
+	}
+
+	if err := quota.Check(ctx, imp.s.queries, imp.userID, e.Size-freed); err != nil {
+		return failed(err)
+	}
+
+	var target *uuid.UUID
+	if folderID.Valid {
+		target = &folderID.UUID
+	}
+	saved, err := imp.s.files.SaveFile(ctx, target, imp.userID, name, e.Size, body)
+	if err != nil {
+		return failed(err)
+	}
+
+	res := ImportEntry{Path: e.Path, Status: status, ID: &saved.ID}
+	if status == StatusRenamed {
+		res.Name = name
+	}
+	return res
+}
+
+func (imp *importer) existingFile(ctx context.Context, folderID uuid.NullUUID, name string) (database.File, bool, error) {
+	f, err := imp.s.queries.GetFileByNameInFolder(ctx, database.GetFileByNameInFolderParams{
+		UserID:   sql.NullInt32{Int32: imp.userID, Valid: true},
+		FolderID: folderID,
+		Name:     name,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.File{}, false, nil
+	}
+	if err != nil {
+		return database.File{}, false, fmt.Errorf("checking existing file: %w", err)
+	}
+	return f, true, nil
+}
+
+// holdAndHash copies r to a temporary file, rewound and ready to read, and
+// returns its SHA-256.
+func holdAndHash(r io.Reader) (*os.File, string, error) {
+	f, err := os.CreateTemp("", "import-*")
+	if err != nil {
+		return nil, "", fmt.Errorf("buffering entry: %w", err)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", fmt.Errorf("buffering entry: %w", err)
+	}
+	return f, hex.EncodeToString(h.Sum(nil)), nil
+}
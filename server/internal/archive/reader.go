@@ -0,0 +1,403 @@
+// Package archive looks inside stored .zip and .tar(.gz) files: listing
+// their entries, streaming one out and extracting them into folders.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+)
+
+type Format string
+
+const (
+	FormatZip   Format = "zip"
+	FormatTar   Format = "tar"
+	FormatTarGz Format = "tar.gz"
+)
+
+var (
+	ErrUnsupported     = errors.New("not a supported archive")
+	ErrCorrupt         = errors.New("archive is corrupt")
+	ErrUnsafePath      = errors.New("archive contains an unsafe path")
+	ErrTooManyEntries  = errors.New("archive has too many entries")
+	ErrTooLarge        = errors.New("archive expands to too much data")
+	ErrSuspiciousRatio = errors.New("archive compression ratio is suspiciously high")
+)
+
+// Limits guard against archives built to exhaust the server: millions of
+// tiny entries, or a few bytes that inflate to terabytes.
+type Limits struct {
+	MaxEntries int
+	// Total uncompressed size of all entries
+	MaxBytes int64
+	// Uncompressed bytes per archive byte, checked once RatioFloor bytes
+	// have been seen so small, very compressible files still pass
+	MaxRatio   int64
+	RatioFloor int64
+}
+
+var DefaultLimits = Limits{
+	MaxEntries: 10000,
+	MaxBytes:   10 << 30,
+	MaxRatio:   200,
+	RatioFloor: 1 << 20,
+}
+
+// Entry is one file or directory in an archive.
+type Entry struct {
+	Path    string    `json:"path"`
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size_bytes"`
+	ModTime time.Time `json:"modified_at"`
+}
+
+// DetectFormat picks a format from a file name, falling back to the MIME
+// type for names without a recognised extension.
+func DetectFormat(name, mimeType string) (Format, bool) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip, true
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz, true
+	case strings.HasSuffix(lower, ".tar"):
+		return FormatTar, true
+	}
+
+	switch strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0])) {
+	case "application/zip", "application/x-zip-compressed":
+		return FormatZip, true
+	case "application/x-tar":
+		return FormatTar, true
+	case "application/x-gtar", "application/x-compressed-tar":
+		return FormatTarGz, true
+	}
+	return "", false
+}
+
+// fallbackStem names the extraction folder when the archive's own name
+// doesn't leave a usable one.
+const fallbackStem = "archive"
+
+// Stem strips an archive extension: "photos.tar.gz" becomes "photos". A stem
+// that isn't a valid folder name, such as "." from "..zip", becomes
+// "archive".
+func Stem(name string) string {
+	stem := name
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+			stem = name[:len(name)-len(ext)]
+			break
+		}
+	}
+	if !storage.ValidName(stem) {
+		return fallbackStem
+	}
+	return stem
+}
+
+// CleanPath turns an entry name into a relative slash path that can't
+// escape the extraction root ("zip slip"). Backslashes count as separators
+// since Windows tools write them.
+func CleanPath(name string) (string, error) {
+	if !utf8.ValidString(name) || strings.ContainsRune(name, 0) {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	p := strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(p, "/") || (len(p) >= 2 && p[1] == ':') {
+		return "", fmt.Errorf("%w: %q is absolute", ErrUnsafePath, name)
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return "", fmt.Errorf("%w: %q leaves the archive", ErrUnsafePath, name)
+		}
+	}
+
+	p = path.Clean(p)
+	if p == "." {
+		return "", nil
+	}
+	return p, nil
+}
+
+// Reader walks an archive's entries in order. Only files and directories
+// are returned; links and devices are skipped.
+type Reader struct {
+	limits Limits
+	// Size of the archive itself, for the ratio check
+	size int64
+
+	next  func() (Entry, bool, error)
+	open  func() (io.Reader, error)
+	close func() error
+
+	entries int
+	bytes   int64
+	current Entry
+}
+
+// NewReader reads an archive from src, which it takes ownership of. Zip
+// needs random access, so anything but an *os.File is spooled to a
+// temporary file first.
+func NewReader(format Format, src io.ReadCloser, limits Limits) (*Reader, error) {
+	switch format {
+	case FormatZip:
+		return newZipReader(src, limits)
+	case FormatTar, FormatTarGz:
+		return newTarReader(format, src, limits)
+	}
+	src.Close()
+	return nil, ErrUnsupported
+}
+
+func newZipReader(src io.ReadCloser, limits Limits) (*Reader, error) {
+	f, ok := src.(*os.File)
+	closeAll := src.Close
+	if !ok {
+		spooled, err := spool(src, limits.MaxBytes)
+		src.Close()
+		if err != nil {
+			return nil, err
+		}
+		f = spooled
+		closeAll = func() error {
+			f.Close()
+			return os.Remove(f.Name())
+		}
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+	zr, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	r := &Reader{limits: limits, size: info.Size(), close: closeAll}
+	i := -1
+	r.next = func() (Entry, bool, error) {
+		for i+1 < len(zr.File) {
+			i++
+			zf := zr.File[i]
+			mode := zf.Mode()
+			if !mode.IsRegular() && !mode.IsDir() {
+				continue
+			}
+			if zf.UncompressedSize64 > uint64(limits.MaxBytes) {
+				return Entry{}, false, fmt.Errorf("%w: %s", ErrTooLarge, zf.Name)
+			}
+			size := int64(zf.UncompressedSize64)
+			if size > limits.RatioFloor && size > int64(zf.CompressedSize64)*limits.MaxRatio {
+				return Entry{}, false, fmt.Errorf("%w: %s", ErrSuspiciousRatio, zf.Name)
+			}
+			return Entry{Path: zf.Name, IsDir: mode.IsDir(), Size: size, ModTime: zf.Modified}, true, nil
+		}
+		return Entry{}, false, nil
+	}
+	r.open = func() (io.Reader, error) {
+		rc, err := zr.File[i].Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		// Nothing but the archive itself needs closing
+		return rc, nil
+	}
+	return r, nil
+}
+
+func newTarReader(format Format, src io.ReadCloser, limits Limits) (*Reader, error) {
+	var size int64
+	if f, ok := src.(*os.File); ok {
+		if info, err := f.Stat(); err == nil {
+			size = info.Size()
+		}
+	}
+	counted := &countingReader{r: src}
+
+	var stream io.Reader = counted
+	closeAll := src.Close
+	if format == FormatTarGz {
+		gz, err := gzip.NewReader(counted)
+		if err != nil {
+			src.Close()
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		stream = gz
+		closeAll = func() error {
+			gz.Close()
+			return src.Close()
+		}
+	}
+	tr := tar.NewReader(stream)
+
+	r := &Reader{limits: limits, size: size, close: closeAll}
+	r.next = func() (Entry, bool, error) {
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return Entry{}, false, nil
+			}
+			if err != nil {
+				return Entry{}, false, fmt.Errorf("%w: %v", ErrCorrupt, err)
+			}
+			if size == 0 {
+				// A stream: judge the ratio by what has been read so far
+				r.size = counted.n
+			}
+			switch hdr.Typeflag {
+			case tar.TypeReg, tar.TypeDir:
+			default:
+				continue
+			}
+			return Entry{Path: hdr.Name, IsDir: hdr.Typeflag == tar.TypeDir, Size: hdr.Size, ModTime: hdr.ModTime}, true, nil
+		}
+	}
+	r.open = func() (io.Reader, error) {
+		return tr, nil
+	}
+	return r, nil
+}
+
+// Next advances to the next entry, returning io.EOF after the last. Every
+// entry is checked against the limits, and its path cleaned, before it is
+// returned.
+func (r *Reader) Next() (Entry, error) {
+	for {
+		e, ok, err := r.next()
+		if err != nil {
+			return Entry{}, err
+		}
+		if !ok {
+			return Entry{}, io.EOF
+		}
+
+		r.entries++
+		if r.entries > r.limits.MaxEntries {
+			return Entry{}, fmt.Errorf("%w: more than %d", ErrTooManyEntries, r.limits.MaxEntries)
+		}
+
+		e.Path, err = CleanPath(e.Path)
+		if err != nil {
+			return Entry{}, err
+		}
+		if e.Path == "" {
+			if e.IsDir {
+				// "./", the archive root itself
+				continue
+			}
+			return Entry{}, fmt.Errorf("%w: file without a name", ErrUnsafePath)
+		}
+		if e.IsDir {
+			e.Size = 0
+		}
+
+		r.bytes += e.Size
+		if r.bytes > r.limits.MaxBytes {
+			return Entry{}, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, r.limits.MaxBytes)
+		}
+		if r.bytes > r.limits.RatioFloor && r.size > 0 && r.bytes > r.size*r.limits.MaxRatio {
+			return Entry{}, ErrSuspiciousRatio
+		}
+
+		r.current = e
+		return e, nil
+	}
+}
+
+// Open returns the content of the entry Next last returned. It yields
+// exactly the declared size; an entry holding more is reported as corrupt
+// rather than silently inflating further.
+func (r *Reader) Open() (io.Reader, error) {
+	if r.current.IsDir {
+		return strings.NewReader(""), nil
+	}
+	body, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return &exactReader{r: body, remaining: r.current.Size}, nil
+}
+
+func (r *Reader) Close() error {
+	return r.close()
+}
+
+// spool copies a stream to a temporary file, giving up beyond limit bytes.
+func spool(src io.Reader, limit int64) (*os.File, error) {
+	f, err := os.CreateTemp("", "archive-*")
+	if err != nil {
+		return nil, fmt.Errorf("spooling archive: %w", err)
+	}
+	n, err := io.Copy(f, io.LimitReader(src, limit+1))
+	if err == nil && n > limit {
+		err = fmt.Errorf("%w: more than %d bytes", ErrTooLarge, limit)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// exactReader fails if the content runs past its declared size.
+type exactReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.remaining <= 0 {
+		// Reading on lets zip verify the checksum and catches extra data
+		var probe [1]byte
+		n, err := e.r.Read(probe[:])
+		if n > 0 {
+			return 0, fmt.Errorf("%w: entry is larger than declared", ErrCorrupt)
+		}
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > e.remaining {
+		p = p[:e.remaining]
+	}
+	n, err := e.r.Read(p)
+	e.remaining -= int64(n)
+	switch {
+	case err == io.EOF && e.remaining > 0:
+		return n, fmt.Errorf("%w: entry is shorter than declared", ErrCorrupt)
+	case err == io.EOF:
+		err = nil
+	case err != nil:
+		err = fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return n, err
+}
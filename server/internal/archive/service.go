@@ -0,0 +1,401 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/bellezhang119/cloud-storage/internal/conflict"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/jobs"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+	"github.com/google/uuid"
+)
+
+// ExtractJobKind is the job queue kind for server-side extraction.
+const ExtractJobKind = "extract_archive"
+
+var (
+	ErrNotFound       = errors.New("file not found")
+	ErrFolderNotFound = errors.New("folder not found")
+	ErrEntryNotFound  = errors.New("no such entry in the archive")
+	ErrIsDirectory    = errors.New("entry is a directory")
+)
+
+type Queries interface {
+	GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error)
+	GetFileByNameInFolder(ctx context.Context, arg database.GetFileByNameInFolderParams) (database.File, error)
+	GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error)
+	GetFolderByNameInParent(ctx context.Context, arg database.GetFolderByNameInParentParams) (database.Folder, error)
+	GetStorageUsage(ctx context.Context, id int32) (database.GetStorageUsageRow, error)
+}
+
+// FolderService creates and (on failure) removes the extracted folders.
+type FolderService interface {
+	CreateFolder(ctx context.Context, userID int32, name string, parentID uuid.NullUUID) (database.Folder, error)
+	DeleteFolder(ctx context.Context, folderID uuid.UUID, userID int32) error
+}
+
+// FileSaver stores extracted files.
+type FileSaver interface {
+	SaveFile(ctx context.Context, folderID *uuid.UUID, userID int32, name string, sizeBytes int64, content io.Reader) (database.File, error)
+}
+
+type Enqueuer interface {
+	Enqueue(ctx context.Context, kind string, userID int32, payload any) (database.Job, error)
+}
+
+type ExtractPayload struct {
+	FileID uuid.UUID `json:"file_id"`
+	// Where the extracted folder goes; invalid means the root
+	FolderID uuid.NullUUID `json:"folder_id"`
+}
+
+type ExtractResult struct {
+	FolderID uuid.UUID `json:"folder_id"`
+	Folders  int       `json:"folders"`
+	Files    int       `json:"files"`
+	Bytes    int64     `json:"size_bytes"`
+}
+
+type Service struct {
+	queries Queries
+	folders FolderService
+	files   FileSaver
+	storage storage.Storage
+	queue   Enqueuer
+
+	Limits Limits
+}
+
+func NewService(q Queries, folders FolderService, files FileSaver, s storage.Storage, queue Enqueuer) *Service {
+	return &Service{queries: q, folders: folders, files: files, storage: s, queue: queue, Limits: DefaultLimits}
+}
+
+// archiveFile fetches one of the user's files and makes sure it is an
+// archive we can read.
+func (s *Service) archiveFile(ctx context.Context, fileID uuid.UUID, userID int32) (database.File, Format, error) {
+	f, err := s.queries.GetFileByID(ctx, fileID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.File{}, "", ErrNotFound
+		}
+		return database.File{}, "", fmt.Errorf("fetching file: %w", err)
+	}
+	if f.UserID.Int32 != userID || f.TrashedAt.Valid {
+		return database.File{}, "", ErrNotFound
+	}
+
+	format, ok := DetectFormat(f.Name, f.MimeType.String)
+	if !ok {
+		return database.File{}, "", ErrUnsupported
+	}
+	return f, format, nil
+}
+
+func (s *Service) open(ctx context.Context, fileID uuid.UUID, userID int32) (database.File, *Reader, error) {
+	f, format, err := s.archiveFile(ctx, fileID, userID)
+	if err != nil {
+		return database.File{}, nil, err
+	}
+
+	src, err := s.storage.ReadFile(userID, f.FilePath)
+	if err != nil {
+		return database.File{}, nil, fmt.Errorf("reading file: %w", err)
+	}
+	r, err := NewReader(format, src, s.Limits)
+	if err != nil {
+		return database.File{}, nil, err
+	}
+	return f, r, nil
+}
+
+// List returns the files and directories in an archive without extracting
+// anything.
+func (s *Service) List(ctx context.Context, fileID uuid.UUID, userID int32) ([]Entry, error) {
+	_, r, err := s.open(ctx, fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	entries := []Entry{}
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+type entryReader struct {
+	io.Reader
+	archive *Reader
+}
+
+func (e *entryReader) Close() error {
+	return e.archive.Close()
+}
+
+// OpenEntry streams a single file out of an archive. The caller must close
+// the returned reader.
+func (s *Service) OpenEntry(ctx context.Context, fileID uuid.UUID, userID int32, entryPath string) (Entry, io.ReadCloser, error) {
+	want, err := CleanPath(entryPath)
+	if err != nil {
+		return Entry{}, nil, err
+	}
+	if want == "" {
+		return Entry{}, nil, ErrEntryNotFound
+	}
+
+	_, r, err := s.open(ctx, fileID, userID)
+	if err != nil {
+		return Entry{}, nil, err
+	}
+
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			r.Close()
+			return Entry{}, nil, ErrEntryNotFound
+		}
+		if err != nil {
+			r.Close()
+			return Entry{}, nil, err
+		}
+		if e.Path != want {
+			continue
+		}
+		if e.IsDir {
+			r.Close()
+			return Entry{}, nil, ErrIsDirectory
+		}
+
+		body, err := r.Open()
+		if err != nil {
+			r.Close()
+			return Entry{}, nil, err
+		}
+		return e, &entryReader{Reader: body, archive: r}, nil
+	}
+}
+
+// StartExtract checks that an archive and destination exist and queues the
+// extraction. A nil dest extracts next to the archive.
+func (s *Service) StartExtract(ctx context.Context, fileID uuid.UUID, userID int32, dest *uuid.UUID) (database.Job, error) {
+	f, _, err := s.archiveFile(ctx, fileID, userID)
+	if err != nil {
+		return database.Job{}, err
+	}
+
+	folderID := f.FolderID
+	if dest != nil {
+		if err := s.checkFolder(ctx, *dest, userID); err != nil {
+			return database.Job{}, err
+		}
+		folderID = uuid.NullUUID{UUID: *dest, Valid: true}
+	}
+
+	return s.queue.Enqueue(ctx, ExtractJobKind, userID, ExtractPayload{FileID: fileID, FolderID: folderID})
+}
+
+func (s *Service) checkFolder(ctx context.Context, id uuid.UUID, userID int32) error {
+	folder, err := s.queries.GetFolderByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrFolderNotFound
+		}
+		return fmt.Errorf("fetching folder: %w", err)
+	}
+	if folder.UserID.Int32 != userID || folder.TrashedAt.Valid {
+		return ErrFolderNotFound
+	}
+	return nil
+}
+
+// HandleExtractJob is the jobs.HandlerFunc for ExtractJobKind.
+func (s *Service) HandleExtractJob(ctx context.Context, job database.Job) error {
+	var payload ExtractPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil || payload.FileID == uuid.Nil || !job.UserID.Valid {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %s", job.Payload))
+	}
+
+	res, err := s.Extract(ctx, payload.FileID, job.UserID.Int32, payload.FolderID)
+	if err != nil {
+		if isPermanent(err) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	return jobs.SetResult(ctx, res)
+}
+
+// isPermanent reports errors that retrying the same archive won't fix.
+func isPermanent(err error) bool {
+	for _, target := range []error{
+		ErrNotFound, ErrFolderNotFound, ErrUnsupported, ErrCorrupt, ErrUnsafePath,
+		ErrTooManyEntries, ErrTooLarge, ErrSuspiciousRatio, quota.ErrExceeded,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Extract unpacks an archive into a new folder named after it under dest,
+// e.g. "photos.zip" into "photos/" or "photos (2)/" if that is taken. The
+// whole archive is checked against the limits and the user's quota before
+// anything is written, and a failed extraction is removed again, so a retry
+// starts clean.
+func (s *Service) Extract(ctx context.Context, fileID uuid.UUID, userID int32, dest uuid.NullUUID) (ExtractResult, error) {
+	if dest.Valid {
+		if err := s.checkFolder(ctx, dest.UUID, userID); err != nil {
+			return ExtractResult{}, err
+		}
+	}
+
+	// 1. Check every entry and total up the size
+	f, r, err := s.open(ctx, fileID, userID)
+	if err != nil {
+		return ExtractResult{}, err
+	}
+	var total int64
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			r.Close()
+			return ExtractResult{}, err
+		}
+		total += e.Size
+	}
+	r.Close()
+
+	if err := quota.Check(ctx, s.queries, userID, total); err != nil {
+		return ExtractResult{}, err
+	}
+
+	// 2. The folder to extract into
+	name := Stem(f.Name)
+	taken, err := s.folderExists(ctx, userID, dest, name)
+	if err != nil {
+		return ExtractResult{}, err
+	}
+	if taken {
+		name, err = conflict.FreeName(name, false, func(candidate string) (bool, error) {
+			return s.folderExists(ctx, userID, dest, candidate)
+		})
+		if err != nil {
+			return ExtractResult{}, err
+		}
+	}
+	root, err := s.folders.CreateFolder(ctx, userID, name, dest)
+	if err != nil {
+		return ExtractResult{}, fmt.Errorf("creating folder: %w", err)
+	}
+
+	// 3. Write the entries
+	res, err := s.extractInto(ctx, fileID, userID, root.ID, total)
+	if err != nil {
+		if delErr := s.folders.DeleteFolder(context.WithoutCancel(ctx), root.ID, userID); delErr != nil {
+			err = fmt.Errorf("%w (and removing the partial extraction failed: %v)", err, delErr)
+		}
+		return ExtractResult{}, err
+	}
+	return res, nil
+}
+
+func (s *Service) folderExists(ctx context.Context, userID int32, parent uuid.NullUUID, name string) (bool, error) {
+	_, err := s.queries.GetFolderByNameInParent(ctx, database.GetFolderByNameInParentParams{
+		UserID:   sql.NullInt32{Int32: userID, Valid: true},
+		ParentID: parent,
+		Name:     name,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("checking existing folder: %w", err)
+	}
+	return true, nil
+}
+
+func (s *Service) extractInto(ctx context.Context, fileID uuid.UUID, userID int32, rootID uuid.UUID, total int64) (ExtractResult, error) {
+	_, r, err := s.open(ctx, fileID, userID)
+	if err != nil {
+		return ExtractResult{}, err
+	}
+	defer r.Close()
+
+	res := ExtractResult{FolderID: rootID}
+	dirs := map[string]uuid.UUID{"": rootID}
+
+	// ensureDir creates each missing folder along a slash path
+	var ensureDir func(p string) (uuid.UUID, error)
+	ensureDir = func(p string) (uuid.UUID, error) {
+		if id, ok := dirs[p]; ok {
+			return id, nil
+		}
+		parent, name := path.Split(p)
+		parentID, err := ensureDir(strings.TrimSuffix(parent, "/"))
+		if err != nil {
+			return uuid.Nil, err
+		}
+		created, err := s.folders.CreateFolder(ctx, userID, name, uuid.NullUUID{UUID: parentID, Valid: true})
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("creating folder %s: %w", p, err)
+		}
+		dirs[p] = created.ID
+		res.Folders++
+		return created.ID, nil
+	}
+
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ExtractResult{}, err
+		}
+
+		if e.IsDir {
+			if _, err := ensureDir(e.Path); err != nil {
+				return ExtractResult{}, err
+			}
+			continue
+		}
+
+		dir, name := path.Split(e.Path)
+		folderID, err := ensureDir(strings.TrimSuffix(dir, "/"))
+		if err != nil {
+			return ExtractResult{}, err
+		}
+		body, err := r.Open()
+		if err != nil {
+			return ExtractResult{}, err
+		}
+		if _, err := s.files.SaveFile(ctx, &folderID, userID, name, e.Size, body); err != nil {
+			return ExtractResult{}, fmt.Errorf("saving %s: %w", e.Path, err)
+		}
+
+		res.Files++
+		res.Bytes += e.Size
+		jobs.ReportProgress(ctx, res.Bytes, total)
+	}
+	return res, nil
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/archive"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func hashOf(s string) sql.NullString {
+	sum := sha256.Sum256([]byte(s))
+	return sql.NullString{String: hex.EncodeToString(sum[:]), Valid: true}
+}
+
+func fileLookup(folderID uuid.NullUUID, name string) database.GetFileByNameInFolderParams {
+	return database.GetFileByNameInFolderParams{UserID: uID, FolderID: folderID, Name: name}
+}
+
+func folderLookup(parentID uuid.NullUUID, name string) database.GetFolderByNameInParentParams {
+	return database.GetFolderByNameInParentParams{UserID: uID, ParentID: parentID, Name: name}
+}
+
+func plenty(f fixture) {
+	f.queries.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{UsedBytes: 0, StorageQuota: 1 << 20}, nil)
+}
+
+func TestImport_RecreatesTree(t *testing.T) {
+	f := newFixture()
+	plenty(f)
+	data := buildTarGz(t, testEntry{"proj/", ""}, testEntry{"proj/src/main.go", "package main"}, testEntry{"README", "hi"})
+	projID, srcID := uuid.New(), uuid.New()
+	root := uuid.NullUUID{}
+	proj := uuid.NullUUID{UUID: projID, Valid: true}
+	src := uuid.NullUUID{UUID: srcID, Valid: true}
+
+	// "proj" already exists and is merged into; "src" is new
+	f.queries.On("GetFolderByNameInParent", mock.Anything, folderLookup(root, "proj")).Return(database.Folder{ID: projID}, nil)
+	f.queries.On("GetFolderByNameInParent", mock.Anything, folderLookup(proj, "src")).Return(database.Folder{}, sql.ErrNoRows)
+	f.folders.On("CreateFolder", mock.Anything, int32(1), "src", proj).Return(database.Folder{ID: srcID}, nil)
+	f.queries.On("GetFileByNameInFolder", mock.Anything, fileLookup(src, "main.go")).Return(database.File{}, sql.ErrNoRows)
+	f.queries.On("GetFileByNameInFolder", mock.Anything, fileLookup(root, "README")).Return(database.File{}, sql.ErrNoRows)
+	f.files.On("SaveFile", mock.Anything, mock.Anything, int32(1), mock.Anything, mock.Anything).Return(database.File{ID: uuid.New()}, nil)
+
+	res, err := f.svc.Import(context.Background(), 1, root, archive.FormatTarGz, "", bytes.NewReader(data))
+
+	require.NoError(t, err)
+	require.Len(t, res.Entries, 3)
+	assert.Equal(t, archive.StatusExists, res.Entries[0].Status)
+	assert.Equal(t, archive.StatusCreated, res.Entries[1].Status)
+	assert.Equal(t, map[string]int{archive.StatusExists: 1, archive.StatusCreated: 2}, res.Counts)
+	assert.Equal(t, "package main", f.files.saved[srcID.String()+"/main.go"])
+}
+
+func TestImport_Skip(t *testing.T) {
+	f := newFixture()
+	existing := database.File{ID: uuid.New(), Name: "a.txt", SizeBytes: 3, Sha256: hashOf("old")}
+	f.queries.On("GetFileByNameInFolder", mock.Anything, fileLookup(uuid.NullUUID{}, "a.txt")).Return(existing, nil)
+
+	res, err := f.svc.Import(context.Background(), 1, uuid.NullUUID{}, archive.FormatZip, archive.Skip,
+		bytes.NewReader(buildZip(t, testEntry{"a.txt", "new"})))
+
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusSkipped, res.Entries[0].Status)
+	assert.Equal(t, existing.ID, *res.Entries[0].ID)
+	f.files.AssertNotCalled(t, "SaveFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestImport_Overwrite(t *testing.T) {
+	f := newFixture()
+	plenty(f)
+	existing := database.File{ID: uuid.New(), Name: "a.txt", SizeBytes: 3, Sha256: hashOf("old")}
+	f.queries.On("GetFileByNameInFolder", mock.Anything, fileLookup(uuid.NullUUID{}, "a.txt")).Return(existing, nil)
+	f.files.On("SaveFile", mock.Anything, (*uuid.UUID)(nil), int32(1), "a.txt", int64(3)).Return(database.File{ID: uuid.New()}, nil)
+
+	res, err := f.svc.Import(context.Background(), 1, uuid.NullUUID{}, archive.FormatZip, archive.Overwrite,
+		bytes.NewReader(buildZip(t, testEntry{"a.txt", "new"})))
+
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusOverwritten, res.Entries[0].Status)
+	f.files.AssertExpectations(t)
+}
+
+func TestImport_RetryIsUnchanged(t *testing.T) {
+	f := newFixture()
+	existing := database.File{ID: uuid.New(), Name: "a.txt", SizeBytes: 4, Sha256: hashOf("same")}
+	f.queries.On("GetFileByNameInFolder", mock.Anything, fileLookup(uuid.NullUUID{}, "a.txt")).Return(existing, nil)
+
+	res, err := f.svc.Import(context.Background(), 1, uuid.NullUUID{}, archive.FormatZip, archive.Overwrite,
+		bytes.NewReader(buildZip(t, testEntry{"a.txt", "same"})))
+
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusUnchanged, res.Entries[0].Status)
+	f.files.AssertNotCalled(t, "SaveFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestImport_Rename(t *testing.T) {
+	f := newFixture()
+	plenty(f)
+	f.queries.On("GetFileByNameInFolder", mock.Anything, fileLookup(uuid.NullUUID{}, "a.txt")).
+		Return(database.File{ID: uuid.New(), SizeBytes: 3, Sha256: hashOf("old")}, nil)
+	f.queries.On("GetFileByNameInFolder", mock.Anything, fileLookup(uuid.NullUUID{}, "a (2).txt")).
+		Return(database.File{}, sql.ErrNoRows)
+	f.files.On("SaveFile", mock.Anything, (*uuid.UUID)(nil), int32(1), "a (2).txt", int64(3)).Return(database.File{ID: uuid.New()}, nil)
+
+	res, err := f.svc.Import(context.Background(), 1, uuid.NullUUID{}, archive.FormatZip, archive.Rename,
+		bytes.NewReader(buildZip(t, testEntry{"a.txt", "new"})))
+
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusRenamed, res.Entries[0].Status)
+	assert.Equal(t, "a (2).txt", res.Entries[0].Name)
+}
+
+func TestImport_RenameRetryFindsEarlierCopy(t *testing.T) {
+	f := newFixture()
+	earlier := database.File{ID: uuid.New(), Name: "a (2).txt", SizeBytes: 3, Sha256: hashOf("new")}
+	f.queries.On("GetFileByNameInFolder", mock.Anything, fileLookup(uuid.NullUUID{}, "a.txt")).
+		Return(database.File{ID: uuid.New(), SizeBytes: 3, Sha256: hashOf("old")}, nil)
+	f.queries.On("GetFileByNameInFolder", mock.Anything, fileLookup(uuid.NullUUID{}, "a (2).txt")).Return(earlier, nil)
+
+	res, err := f.svc.Import(context.Background(), 1, uuid.NullUUID{}, archive.FormatZip, archive.Rename,
+		bytes.NewReader(buildZip(t, testEntry{"a.txt", "new"})))
+
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusUnchanged, res.Entries[0].Status)
+	assert.Equal(t, earlier.ID, *res.Entries[0].ID)
+	f.files.AssertNotCalled(t, "SaveFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestImport_QuotaFailsEntriesNotTheImport(t *testing.T) {
+	f := newFixture()
+	f.queries.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{UsedBytes: 95, StorageQuota: 100}, nil)
+	f.queries.On("GetFileByNameInFolder", mock.Anything, mock.Anything).Return(database.File{}, sql.ErrNoRows)
+	f.files.On("SaveFile", mock.Anything, (*uuid.UUID)(nil), int32(1), "small", int64(2)).Return(database.File{ID: uuid.New()}, nil)
+
+	res, err := f.svc.Import(context.Background(), 1, uuid.NullUUID{}, archive.FormatTar, "",
+		bytes.NewReader(buildTar(t, testEntry{"big", "0123456789"}, testEntry{"small", "ok"})))
+
+	require.NoError(t, err)
+	assert.Equal(t, archive.StatusFailed, res.Entries[0].Status)
+	assert.Contains(t, res.Entries[0].Error, "quota")
+	assert.Equal(t, archive.StatusCreated, res.Entries[1].Status)
+}
+
+func TestImport_UnsafeArchiveWritesNothing(t *testing.T) {
+	f := newFixture()
+
+	_, err := f.svc.Import(context.Background(), 1, uuid.NullUUID{}, archive.FormatZip, "",
+		bytes.NewReader(buildZip(t, testEntry{"a.txt", "x"}, testEntry{"../../b.txt", "x"})))
+
+	assert.ErrorIs(t, err, archive.ErrUnsafePath)
+	f.queries.AssertNotCalled(t, "GetFileByNameInFolder", mock.Anything, mock.Anything)
+	f.files.AssertNotCalled(t, "SaveFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestImport_InvalidPolicy(t *testing.T) {
+	f := newFixture()
+
+	_, err := f.svc.Import(context.Background(), 1, uuid.NullUUID{}, archive.FormatZip, "merge", bytes.NewReader(nil))
+
+	assert.ErrorIs(t, err, archive.ErrInvalidPolicy)
+}
+
+func TestImportHandler_UnknownFormat(t *testing.T) {
+	f := newFixture()
+
+	req := httptest.NewRequest(http.MethodPost, "/imports", bytes.NewReader([]byte("x")))
+	req.Header.Set("Content-Type", "text/plain")
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(1)))
+	rec := httptest.NewRecorder()
+	archive.ImportHandler(f.svc).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+}
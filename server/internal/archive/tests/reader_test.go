@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/archive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testEntry struct {
+	name string
+	body string
+}
+
+func buildZip(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(e.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func buildTar(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writeTar(t, &buf, entries)
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writeTar(t, gz, entries)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func writeTar(t *testing.T, w io.Writer, entries []testEntry) {
+	t.Helper()
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(e.name, "/") {
+			hdr.Typeflag, hdr.Size = tar.TypeDir, 0
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(e.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+}
+
+func readAll(t *testing.T, format archive.Format, data []byte, limits archive.Limits) ([]archive.Entry, map[string]string, error) {
+	t.Helper()
+	r, err := archive.NewReader(format, io.NopCloser(bytes.NewReader(data)), limits)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+
+	var entries []archive.Entry
+	bodies := map[string]string{}
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return entries, bodies, nil
+		}
+		if err != nil {
+			return entries, bodies, err
+		}
+		entries = append(entries, e)
+		if !e.IsDir {
+			body, err := r.Open()
+			require.NoError(t, err)
+			b, err := io.ReadAll(body)
+			if err != nil {
+				return entries, bodies, err
+			}
+			bodies[e.Path] = string(b)
+		}
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	for name, want := range map[string]string{
+		"a/b.txt":      "a/b.txt",
+		"./a//b.txt":   "a/b.txt",
+		`dir\file.txt`: "dir/file.txt",
+		"dir/":         "dir",
+		"./":           "",
+	} {
+		got, err := archive.CleanPath(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, want, got, name)
+	}
+
+	for _, name := range []string{"../evil", "a/../../evil", "/etc/passwd", `C:\Windows\evil`, `..\evil`, "a\x00b"} {
+		_, err := archive.CleanPath(name)
+		assert.ErrorIs(t, err, archive.ErrUnsafePath, name)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	for name, want := range map[string]archive.Format{
+		"a.zip": archive.FormatZip, "a.ZIP": archive.FormatZip,
+		"a.tar": archive.FormatTar, "a.tar.gz": archive.FormatTarGz, "a.tgz": archive.FormatTarGz,
+	} {
+		got, ok := archive.DetectFormat(name, "")
+		assert.True(t, ok, name)
+		assert.Equal(t, want, got, name)
+	}
+
+	got, ok := archive.DetectFormat("download", "application/zip")
+	assert.True(t, ok)
+	assert.Equal(t, archive.FormatZip, got)
+
+	_, ok = archive.DetectFormat("a.gz", "application/gzip")
+	assert.False(t, ok)
+}
+
+func TestStem(t *testing.T) {
+	assert.Equal(t, "photos", archive.Stem("photos.tar.gz"))
+	assert.Equal(t, "photos", archive.Stem("photos.ZIP"))
+	assert.Equal(t, "notes.txt", archive.Stem("notes.txt"))
+	assert.Equal(t, ".zip", archive.Stem(".zip"))
+	assert.Equal(t, "archive", archive.Stem("..zip"))
+	assert.Equal(t, "archive", archive.Stem("...tar.gz"))
+}
+
+func TestReader_Zip(t *testing.T) {
+	data := buildZip(t, testEntry{"docs/", ""}, testEntry{"docs/a.txt", "alpha"}, testEntry{"b.txt", "beta"})
+
+	entries, bodies, err := readAll(t, archive.FormatZip, data, archive.DefaultLimits)
+
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "docs", entries[0].Path)
+	assert.True(t, entries[0].IsDir)
+	assert.Equal(t, map[string]string{"docs/a.txt": "alpha", "b.txt": "beta"}, bodies)
+}
+
+func TestReader_TarGz(t *testing.T) {
+	data := buildTarGz(t, testEntry{"./", ""}, testEntry{"./src/", ""}, testEntry{"./src/main.go", "package main"})
+
+	entries, bodies, err := readAll(t, archive.FormatTarGz, data, archive.DefaultLimits)
+
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "src", entries[0].Path)
+	assert.Equal(t, map[string]string{"src/main.go": "package main"}, bodies)
+}
+
+func TestReader_RejectsZipSlip(t *testing.T) {
+	data := buildZip(t, testEntry{"ok.txt", "x"}, testEntry{"../../etc/cron.d/evil", "x"})
+
+	_, _, err := readAll(t, archive.FormatZip, data, archive.DefaultLimits)
+
+	assert.ErrorIs(t, err, archive.ErrUnsafePath)
+}
+
+func TestReader_EntryLimit(t *testing.T) {
+	data := buildTarGz(t, testEntry{"a", "1"}, testEntry{"b", "2"}, testEntry{"c", "3"})
+	limits := archive.DefaultLimits
+	limits.MaxEntries = 2
+
+	_, _, err := readAll(t, archive.FormatTarGz, data, limits)
+
+	assert.ErrorIs(t, err, archive.ErrTooManyEntries)
+}
+
+func TestReader_SizeLimit(t *testing.T) {
+	data := buildZip(t, testEntry{"a", strings.Repeat("x", 100)})
+	limits := archive.DefaultLimits
+	limits.MaxBytes = 50
+
+	_, _, err := readAll(t, archive.FormatZip, data, limits)
+
+	assert.ErrorIs(t, err, archive.ErrTooLarge)
+}
+
+func TestReader_CompressionRatio(t *testing.T) {
+	// A megabyte of zeros deflates to about a kilobyte
+	bomb := testEntry{"zeros", strings.Repeat("\x00", 1<<20)}
+	limits := archive.DefaultLimits
+	limits.MaxRatio = 100
+	limits.RatioFloor = 1 << 10
+
+	_, _, err := readAll(t, archive.FormatZip, buildZip(t, bomb), limits)
+	assert.ErrorIs(t, err, archive.ErrSuspiciousRatio)
+
+	_, _, err = readAll(t, archive.FormatTarGz, buildTarGz(t, bomb), limits)
+	assert.ErrorIs(t, err, archive.ErrSuspiciousRatio)
+
+	// At the default floor an archive this small isn't judged by ratio at all
+	_, _, err = readAll(t, archive.FormatZip, buildZip(t, bomb), archive.DefaultLimits)
+	assert.NoError(t, err)
+}
+
+func TestReader_Corrupt(t *testing.T) {
+	_, err := archive.NewReader(archive.FormatZip, io.NopCloser(strings.NewReader("not a zip")), archive.DefaultLimits)
+	assert.ErrorIs(t, err, archive.ErrCorrupt)
+
+	_, err = archive.NewReader(archive.FormatTarGz, io.NopCloser(strings.NewReader("not gzip")), archive.DefaultLimits)
+	assert.ErrorIs(t, err, archive.ErrCorrupt)
+}
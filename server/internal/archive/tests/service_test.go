@@ -0,0 +1,387 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/archive"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockQueries) GetFileByNameInFolder(ctx context.Context, arg database.GetFileByNameInFolderParams) (database.File, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockQueries) GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func (m *MockQueries) GetFolderByNameInParent(ctx context.Context, arg database.GetFolderByNameInParentParams) (database.Folder, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func (m *MockQueries) GetStorageUsage(ctx context.Context, id int32) (database.GetStorageUsageRow, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.GetStorageUsageRow), args.Error(1)
+}
+
+type MockFolderService struct {
+	mock.Mock
+}
+
+func (m *MockFolderService) CreateFolder(ctx context.Context, userID int32, name string, parentID uuid.NullUUID) (database.Folder, error) {
+	args := m.Called(ctx, userID, name, parentID)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func (m *MockFolderService) DeleteFolder(ctx context.Context, folderID uuid.UUID, userID int32) error {
+	return m.Called(ctx, folderID, userID).Error(0)
+}
+
+type MockFileSaver struct {
+	mock.Mock
+	saved map[string]string
+}
+
+func (m *MockFileSaver) SaveFile(ctx context.Context, folderID *uuid.UUID, userID int32, name string, sizeBytes int64, content io.Reader) (database.File, error) {
+	args := m.Called(ctx, folderID, userID, name, sizeBytes)
+	if m.saved == nil {
+		m.saved = map[string]string{}
+	}
+	body, err := io.ReadAll(content)
+	if err != nil {
+		return database.File{}, err
+	}
+	key := "root/" + name
+	if folderID != nil {
+		key = folderID.String() + "/" + name
+	}
+	m.saved[key] = string(body)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+type MockQueue struct {
+	mock.Mock
+}
+
+func (m *MockQueue) Enqueue(ctx context.Context, kind string, userID int32, payload any) (database.Job, error) {
+	args := m.Called(ctx, kind, userID, payload)
+	return args.Get(0).(database.Job), args.Error(1)
+}
+
+type MockStorage struct {
+	mock.Mock
+}
+
+func (m *MockStorage) SaveFile(userID int32, path string, content io.Reader) error {
+	return m.Called(userID, path, content).Error(0)
+}
+
+func (m *MockStorage) ReadFile(userID int32, path string) (io.ReadCloser, error) {
+	args := m.Called(userID, path)
+	reader, _ := args.Get(0).(io.ReadCloser)
+	return reader, args.Error(1)
+}
+
+func (m *MockStorage) DeleteFile(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) CreateDirectory(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) DeleteDirectory(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) MoveFile(userID int32, oldPath, newPath string) error {
+	return m.Called(userID, oldPath, newPath).Error(0)
+}
+
+func (m *MockStorage) CopyFile(userID int32, srcPath, dstPath string) error {
+	return m.Called(userID, srcPath, dstPath).Error(0)
+}
+
+func (m *MockStorage) MoveDirectory(userID int32, oldPath, newPath string) error {
+	return m.Called(userID, oldPath, newPath).Error(0)
+}
+
+func (m *MockStorage) ZipFolder(userID int32, folderPath string, w io.Writer) error {
+	return m.Called(userID, folderPath, w).Error(0)
+}
+
+func (m *MockStorage) ZipPaths(userID int32, paths []string, w io.Writer) error {
+	return m.Called(userID, paths, w).Error(0)
+}
+
+func (m *MockStorage) DeleteUserData(userID int32) error {
+	return m.Called(userID).Error(0)
+}
+
+var uID = sql.NullInt32{Int32: 1, Valid: true}
+
+type fixture struct {
+	queries *MockQueries
+	folders *MockFolderService
+	files   *MockFileSaver
+	storage *MockStorage
+	queue   *MockQueue
+	svc     *archive.Service
+}
+
+func newFixture() fixture {
+	f := fixture{
+		queries: new(MockQueries),
+		folders: new(MockFolderService),
+		files:   new(MockFileSaver),
+		storage: new(MockStorage),
+		queue:   new(MockQueue),
+	}
+	f.svc = archive.NewService(f.queries, f.folders, f.files, f.storage, f.queue)
+	return f
+}
+
+// withArchive stores data as bundle.zip, readable the given number of times.
+func (f fixture) withArchive(data []byte, reads int) database.File {
+	file := database.File{ID: uuid.New(), UserID: uID, Name: "bundle.zip", FilePath: "bundle.zip", SizeBytes: int64(len(data))}
+	f.queries.On("GetFileByID", mock.Anything, file.ID).Return(file, nil)
+	for i := 0; i < reads; i++ {
+		f.storage.On("ReadFile", int32(1), "bundle.zip").Return(io.NopCloser(bytes.NewReader(data)), nil).Once()
+	}
+	return file
+}
+
+func TestList(t *testing.T) {
+	f := newFixture()
+	file := f.withArchive(buildZip(t, testEntry{"a.txt", "alpha"}, testEntry{"dir/b.txt", "beta"}), 1)
+
+	entries, err := f.svc.List(context.Background(), file.ID, 1)
+
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "dir/b.txt", entries[1].Path)
+	assert.Equal(t, int64(4), entries[1].Size)
+}
+
+func TestList_OtherUsersFile(t *testing.T) {
+	f := newFixture()
+	id := uuid.New()
+	f.queries.On("GetFileByID", mock.Anything, id).
+		Return(database.File{ID: id, UserID: sql.NullInt32{Int32: 2, Valid: true}, Name: "x.zip"}, nil)
+
+	_, err := f.svc.List(context.Background(), id, 1)
+
+	assert.ErrorIs(t, err, archive.ErrNotFound)
+	f.storage.AssertNotCalled(t, "ReadFile", mock.Anything, mock.Anything)
+}
+
+func TestList_NotAnArchive(t *testing.T) {
+	f := newFixture()
+	id := uuid.New()
+	f.queries.On("GetFileByID", mock.Anything, id).
+		Return(database.File{ID: id, UserID: uID, Name: "notes.txt", MimeType: sql.NullString{String: "text/plain", Valid: true}}, nil)
+
+	_, err := f.svc.List(context.Background(), id, 1)
+
+	assert.ErrorIs(t, err, archive.ErrUnsupported)
+}
+
+func TestOpenEntry(t *testing.T) {
+	f := newFixture()
+	file := f.withArchive(buildZip(t, testEntry{"a.txt", "alpha"}, testEntry{"dir/b.txt", "beta"}), 1)
+
+	entry, body, err := f.svc.OpenEntry(context.Background(), file.ID, 1, "./dir/b.txt")
+	require.NoError(t, err)
+	defer body.Close()
+	got, err := io.ReadAll(body)
+
+	require.NoError(t, err)
+	assert.Equal(t, "dir/b.txt", entry.Path)
+	assert.Equal(t, "beta", string(got))
+}
+
+func TestOpenEntry_Missing(t *testing.T) {
+	f := newFixture()
+	file := f.withArchive(buildZip(t, testEntry{"a.txt", "alpha"}), 1)
+
+	_, _, err := f.svc.OpenEntry(context.Background(), file.ID, 1, "b.txt")
+
+	assert.ErrorIs(t, err, archive.ErrEntryNotFound)
+}
+
+func TestExtract(t *testing.T) {
+	f := newFixture()
+	file := f.withArchive(buildZip(t, testEntry{"a.txt", "alpha"}, testEntry{"dir/sub/b.txt", "beta"}, testEntry{"empty/", ""}), 2)
+	rootID, dirID, subID, emptyID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	f.queries.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{UsedBytes: 0, StorageQuota: 1000}, nil)
+	f.queries.On("GetFolderByNameInParent", mock.Anything, database.GetFolderByNameInParentParams{UserID: uID, Name: "bundle"}).
+		Return(database.Folder{ID: uuid.New()}, nil)
+	f.queries.On("GetFolderByNameInParent", mock.Anything, database.GetFolderByNameInParentParams{UserID: uID, Name: "bundle (2)"}).
+		Return(database.Folder{}, sql.ErrNoRows)
+	f.folders.On("CreateFolder", mock.Anything, int32(1), "bundle (2)", uuid.NullUUID{}).Return(database.Folder{ID: rootID}, nil)
+	f.folders.On("CreateFolder", mock.Anything, int32(1), "dir", uuid.NullUUID{UUID: rootID, Valid: true}).Return(database.Folder{ID: dirID}, nil)
+	f.folders.On("CreateFolder", mock.Anything, int32(1), "sub", uuid.NullUUID{UUID: dirID, Valid: true}).Return(database.Folder{ID: subID}, nil)
+	f.folders.On("CreateFolder", mock.Anything, int32(1), "empty", uuid.NullUUID{UUID: rootID, Valid: true}).Return(database.Folder{ID: emptyID}, nil)
+	f.files.On("SaveFile", mock.Anything, mock.Anything, int32(1), mock.Anything, mock.Anything).Return(database.File{}, nil)
+
+	res, err := f.svc.Extract(context.Background(), file.ID, 1, uuid.NullUUID{})
+
+	require.NoError(t, err)
+	assert.Equal(t, archive.ExtractResult{FolderID: rootID, Folders: 3, Files: 2, Bytes: 9}, res)
+	assert.Equal(t, map[string]string{
+		rootID.String() + "/a.txt": "alpha",
+		subID.String() + "/b.txt":  "beta",
+	}, f.files.saved)
+	f.folders.AssertExpectations(t)
+}
+
+func TestExtract_DotStemFallsBackToArchive(t *testing.T) {
+	f := newFixture()
+	data := buildZip(t, testEntry{"a.txt", "alpha"})
+	file := database.File{ID: uuid.New(), UserID: uID, Name: "..zip", FilePath: "..zip", SizeBytes: int64(len(data))}
+	f.queries.On("GetFileByID", mock.Anything, file.ID).Return(file, nil)
+	for i := 0; i < 2; i++ {
+		f.storage.On("ReadFile", int32(1), "..zip").Return(io.NopCloser(bytes.NewReader(data)), nil).Once()
+	}
+	rootID := uuid.New()
+
+	f.queries.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{UsedBytes: 0, StorageQuota: 1000}, nil)
+	f.queries.On("GetFolderByNameInParent", mock.Anything, database.GetFolderByNameInParentParams{UserID: uID, Name: "archive"}).
+		Return(database.Folder{}, sql.ErrNoRows)
+	f.folders.On("CreateFolder", mock.Anything, int32(1), "archive", uuid.NullUUID{}).Return(database.Folder{ID: rootID}, nil)
+	f.files.On("SaveFile", mock.Anything, mock.Anything, int32(1), "a.txt", mock.Anything).Return(database.File{}, nil)
+
+	res, err := f.svc.Extract(context.Background(), file.ID, 1, uuid.NullUUID{})
+
+	require.NoError(t, err)
+	assert.Equal(t, rootID, res.FolderID)
+	f.folders.AssertNotCalled(t, "CreateFolder", mock.Anything, int32(1), ".", mock.Anything)
+	f.folders.AssertExpectations(t)
+}
+
+func TestExtract_OverQuota(t *testing.T) {
+	f := newFixture()
+	file := f.withArchive(buildZip(t, testEntry{"a.txt", "alpha"}), 1)
+	f.queries.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{UsedBytes: 998, StorageQuota: 1000}, nil)
+
+	_, err := f.svc.Extract(context.Background(), file.ID, 1, uuid.NullUUID{})
+
+	assert.ErrorIs(t, err, quota.ErrExceeded)
+	f.folders.AssertNotCalled(t, "CreateFolder", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestExtract_UnsafeArchiveWritesNothing(t *testing.T) {
+	f := newFixture()
+	file := f.withArchive(buildZip(t, testEntry{"a.txt", "alpha"}, testEntry{"../evil.sh", "rm -rf"}), 1)
+
+	_, err := f.svc.Extract(context.Background(), file.ID, 1, uuid.NullUUID{})
+
+	assert.ErrorIs(t, err, archive.ErrUnsafePath)
+	f.folders.AssertNotCalled(t, "CreateFolder", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	f.files.AssertNotCalled(t, "SaveFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestExtract_RemovesPartialResultOnFailure(t *testing.T) {
+	f := newFixture()
+	file := f.withArchive(buildZip(t, testEntry{"a.txt", "alpha"}, testEntry{"b.txt", "beta"}), 2)
+	rootID := uuid.New()
+
+	f.queries.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{UsedBytes: 0, StorageQuota: 1000}, nil)
+	f.queries.On("GetFolderByNameInParent", mock.Anything, mock.Anything).Return(database.Folder{}, sql.ErrNoRows)
+	f.folders.On("CreateFolder", mock.Anything, int32(1), "bundle", uuid.NullUUID{}).Return(database.Folder{ID: rootID}, nil)
+	f.files.On("SaveFile", mock.Anything, mock.Anything, int32(1), "a.txt", mock.Anything).Return(database.File{}, nil)
+	f.files.On("SaveFile", mock.Anything, mock.Anything, int32(1), "b.txt", mock.Anything).Return(database.File{}, errors.New("disk full"))
+	f.folders.On("DeleteFolder", mock.Anything, rootID, int32(1)).Return(nil)
+
+	_, err := f.svc.Extract(context.Background(), file.ID, 1, uuid.NullUUID{})
+
+	assert.ErrorContains(t, err, "disk full")
+	f.folders.AssertCalled(t, "DeleteFolder", mock.Anything, rootID, int32(1))
+}
+
+func TestStartExtract_DefaultsToArchiveFolder(t *testing.T) {
+	f := newFixture()
+	parent := uuid.New()
+	id := uuid.New()
+	f.queries.On("GetFileByID", mock.Anything, id).
+		Return(database.File{ID: id, UserID: uID, Name: "x.tar.gz", FolderID: uuid.NullUUID{UUID: parent, Valid: true}}, nil)
+	f.queue.On("Enqueue", mock.Anything, archive.ExtractJobKind, int32(1),
+		archive.ExtractPayload{FileID: id, FolderID: uuid.NullUUID{UUID: parent, Valid: true}}).
+		Return(database.Job{ID: uuid.New()}, nil)
+
+	_, err := f.svc.StartExtract(context.Background(), id, 1, nil)
+
+	assert.NoError(t, err)
+	f.queue.AssertExpectations(t)
+}
+
+func TestStartExtract_ForeignFolder(t *testing.T) {
+	f := newFixture()
+	id, dest := uuid.New(), uuid.New()
+	f.queries.On("GetFileByID", mock.Anything, id).Return(database.File{ID: id, UserID: uID, Name: "x.zip"}, nil)
+	f.queries.On("GetFolderByID", mock.Anything, dest).
+		Return(database.Folder{ID: dest, UserID: sql.NullInt32{Int32: 2, Valid: true}}, nil)
+
+	_, err := f.svc.StartExtract(context.Background(), id, 1, &dest)
+
+	assert.ErrorIs(t, err, archive.ErrFolderNotFound)
+	f.queue.AssertNotCalled(t, "Enqueue", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleExtractJob_InvalidArchiveIsPermanent(t *testing.T) {
+	f := newFixture()
+	file := f.withArchive([]byte("garbage"), 1)
+	payload, _ := json.Marshal(archive.ExtractPayload{FileID: file.ID})
+
+	err := f.svc.HandleExtractJob(context.Background(), database.Job{UserID: uID, Payload: payload})
+
+	assert.ErrorIs(t, err, archive.ErrCorrupt)
+}
+
+func TestEntryHandler_SetsSafeHeaders(t *testing.T) {
+	f := newFixture()
+	file := f.withArchive(buildZip(t, testEntry{"site/index.html", "<html><script>alert(1)</script></html>"}), 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/"+file.ID.String()+"/archive/entry?path=site/index.html&disposition=inline", nil)
+	req.SetPathValue("id", file.ID.String())
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(1)))
+	rec := httptest.NewRecorder()
+	archive.EntryHandler(f.svc).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html"))
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment;"))
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+}
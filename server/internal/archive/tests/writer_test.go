@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/archive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var mtime = time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+func treeFile(p, body, sum string) archive.TreeEntry {
+	return archive.TreeEntry{
+		Path:    p,
+		Size:    int64(len(body)),
+		ModTime: mtime,
+		SHA256:  sum,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(body)), nil
+		},
+	}
+}
+
+func sampleTree() []archive.TreeEntry {
+	return []archive.TreeEntry{
+		{Path: "reports", IsDir: true, ModTime: mtime},
+		{Path: "reports/empty", IsDir: true, ModTime: mtime},
+		treeFile("reports/a.txt", "hello", "recorded-sum"),
+		// No recorded checksum, so it is hashed on the way out
+		treeFile("reports/b.txt", "world", ""),
+	}
+}
+
+func TestWrite_RoundTrip(t *testing.T) {
+	for _, format := range []archive.Format{archive.FormatZip, archive.FormatTar, archive.FormatTarGz} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, archive.Write(&buf, archive.WriteOptions{Format: format, Level: archive.DefaultLevel}, sampleTree()))
+
+			entries, bodies, err := readAll(t, format, buf.Bytes(), archive.DefaultLimits)
+			require.NoError(t, err)
+
+			var paths []string
+			for _, e := range entries {
+				paths = append(paths, e.Path)
+				if e.Path != archive.ManifestName {
+					assert.True(t, e.ModTime.Equal(mtime), "%s modified at %s", e.Path, e.ModTime)
+				}
+			}
+			assert.Equal(t, []string{"reports", "reports/empty", "reports/a.txt", "reports/b.txt", archive.ManifestName}, paths)
+			assert.Equal(t, "hello", bodies["reports/a.txt"])
+			assert.Equal(t, "world", bodies["reports/b.txt"])
+
+			var manifest archive.Manifest
+			require.NoError(t, json.Unmarshal([]byte(bodies[archive.ManifestName]), &manifest))
+			require.Len(t, manifest.Entries, 4)
+			assert.True(t, manifest.Entries[1].IsDir)
+			assert.Equal(t, "recorded-sum", manifest.Entries[2].SHA256)
+			sum := sha256.Sum256([]byte("world"))
+			assert.Equal(t, hex.EncodeToString(sum[:]), manifest.Entries[3].SHA256)
+		})
+	}
+}
+
+func TestWrite_ZipLevels(t *testing.T) {
+	methods := func(level int) []uint16 {
+		var buf bytes.Buffer
+		require.NoError(t, archive.Write(&buf, archive.WriteOptions{Format: archive.FormatZip, Level: level}, sampleTree()))
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		var out []uint16
+		for _, f := range zr.File {
+			if !strings.HasSuffix(f.Name, "/") {
+				out = append(out, f.Method)
+			}
+		}
+		return out
+	}
+
+	assert.Equal(t, []uint16{zip.Store, zip.Store, zip.Store}, methods(0))
+	assert.Equal(t, []uint16{zip.Deflate, zip.Deflate, zip.Deflate}, methods(9))
+}
+
+func TestWrite_InvalidLevel(t *testing.T) {
+	err := archive.Write(io.Discard, archive.WriteOptions{Format: archive.FormatTarGz, Level: 12}, sampleTree())
+
+	assert.ErrorIs(t, err, archive.ErrInvalidLevel)
+}
+
+func TestWrite_SizeMismatch(t *testing.T) {
+	short := treeFile("reports/a.txt", "hello", "")
+	short.Size = 10
+
+	err := archive.Write(io.Discard, archive.WriteOptions{Format: archive.FormatTar}, []archive.TreeEntry{short})
+
+	assert.Error(t, err)
+}
+
+func TestWrite_OpenFails(t *testing.T) {
+	broken := treeFile("reports/a.txt", "hello", "")
+	broken.Open = func() (io.ReadCloser, error) { return nil, errors.New("gone") }
+
+	err := archive.Write(io.Discard, archive.WriteOptions{Format: archive.FormatZip}, []archive.TreeEntry{broken})
+
+	assert.ErrorContains(t, err, "reports/a.txt")
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := archive.ParseLevel("")
+	assert.NoError(t, err)
+	assert.Equal(t, archive.DefaultLevel, level)
+
+	level, err = archive.ParseLevel("0")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, level)
+
+	for _, bad := range []string{"10", "-1", "fast"} {
+		_, err := archive.ParseLevel(bad)
+		assert.ErrorIs(t, err, archive.ErrInvalidLevel, bad)
+	}
+}
@@ -0,0 +1,284 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ManifestName sits at the top of every archive we build, beside the
+// folder itself, so it can't collide with anything inside.
+const ManifestName = "manifest.json"
+
+// Compression levels, as for compress/flate.
+const (
+	DefaultLevel = flate.DefaultCompression
+	MinLevel     = flate.NoCompression
+	MaxLevel     = flate.BestCompression
+)
+
+var ErrInvalidLevel = errors.New("compression level must be between 0 and 9")
+
+// TreeEntry is one item of a folder being archived, described by its
+// database record rather than by what happens to be on disk.
+type TreeEntry struct {
+	// Slash path inside the archive; directories have no trailing slash
+	Path     string
+	IsDir    bool
+	Size     int64
+	ModTime  time.Time
+	SHA256   string
+	MimeType string
+	// Opens a file's content
+	Open func() (io.ReadCloser, error)
+}
+
+// ModTime picks the best timestamp a row has for an entry.
+func ModTime(updated, created sql.NullTime) time.Time {
+	if updated.Valid {
+		return updated.Time
+	}
+	if created.Valid {
+		return created.Time
+	}
+	return time.Unix(0, 0).UTC()
+}
+
+type WriteOptions struct {
+	Format Format
+	Level  int
+}
+
+type Manifest struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	Entries     []ManifestEntry `json:"entries"`
+}
+
+type ManifestEntry struct {
+	Path     string    `json:"path"`
+	IsDir    bool      `json:"is_dir"`
+	Size     int64     `json:"size_bytes"`
+	ModTime  time.Time `json:"modified_at"`
+	SHA256   string    `json:"sha256,omitempty"`
+	MimeType string    `json:"mime_type,omitempty"`
+}
+
+// ParseFormat reads a format name as used in ?format= parameters.
+func ParseFormat(s string) (Format, bool) {
+	switch strings.ToLower(s) {
+	case "zip":
+		return FormatZip, true
+	case "tar":
+		return FormatTar, true
+	case "tar.gz", "tgz":
+		return FormatTarGz, true
+	}
+	return "", false
+}
+
+// ParseLevel reads a ?level= parameter, defaulting to DefaultLevel.
+func ParseLevel(s string) (int, error) {
+	if s == "" {
+		return DefaultLevel, nil
+	}
+	level, err := strconv.Atoi(s)
+	if err != nil || level < MinLevel || level > MaxLevel {
+		return 0, ErrInvalidLevel
+	}
+	return level, nil
+}
+
+// ContentType is the MIME type of an archive in the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatTar:
+		return "application/x-tar"
+	case FormatTarGz:
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// Extension is the file extension for the format, dot included.
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// sink is what Write needs from each archive format.
+type sink interface {
+	dir(e TreeEntry) error
+	file(e TreeEntry, content io.Reader) error
+	close() error
+}
+
+// Write streams entries to w as an archive, keeping empty directories and
+// modification times, followed by a manifest. Checksums come from the
+// entries; a file without one is hashed as it is written.
+func Write(w io.Writer, opts WriteOptions, entries []TreeEntry) error {
+	if opts.Level != DefaultLevel && (opts.Level < MinLevel || opts.Level > MaxLevel) {
+		return ErrInvalidLevel
+	}
+
+	var out sink
+	switch opts.Format {
+	case FormatZip:
+		out = newZipSink(w, opts.Level)
+	case FormatTar:
+		out = &tarSink{tw: tar.NewWriter(w)}
+	case FormatTarGz:
+		gz, err := gzip.NewWriterLevel(w, opts.Level)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidLevel, err)
+		}
+		out = &tarSink{tw: tar.NewWriter(gz), gz: gz}
+	default:
+		return ErrUnsupported
+	}
+
+	manifest := Manifest{GeneratedAt: time.Now().UTC(), Entries: make([]ManifestEntry, 0, len(entries))}
+	for _, e := range entries {
+		me := ManifestEntry{Path: e.Path, IsDir: e.IsDir, Size: e.Size, ModTime: e.ModTime.UTC(), SHA256: e.SHA256, MimeType: e.MimeType}
+		if e.IsDir {
+			if err := out.dir(e); err != nil {
+				return fmt.Errorf("adding %s: %w", e.Path, err)
+			}
+			manifest.Entries = append(manifest.Entries, me)
+			continue
+		}
+
+		sum, err := writeFile(out, e)
+		if err != nil {
+			return fmt.Errorf("adding %s: %w", e.Path, err)
+		}
+		if me.SHA256 == "" {
+			me.SHA256 = sum
+		}
+		manifest.Entries = append(manifest.Entries, me)
+	}
+
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	if err := out.file(TreeEntry{Path: ManifestName, Size: int64(len(raw)), ModTime: manifest.GeneratedAt}, strings.NewReader(string(raw))); err != nil {
+		return fmt.Errorf("adding manifest: %w", err)
+	}
+
+	if err := out.close(); err != nil {
+		return fmt.Errorf("finishing archive: %w", err)
+	}
+	return nil
+}
+
+// writeFile adds one file, hashing it when it has no recorded checksum.
+func writeFile(out sink, e TreeEntry) (string, error) {
+	rc, err := e.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	if e.SHA256 != "" {
+		return e.SHA256, out.file(e, rc)
+	}
+	h := sha256.New()
+	if err := out.file(e, io.TeeReader(rc, h)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type zipSink struct {
+	zw     *zip.Writer
+	method uint16
+}
+
+func newZipSink(w io.Writer, level int) *zipSink {
+	zw := zip.NewWriter(w)
+	method := zip.Deflate
+	if level == flate.NoCompression {
+		method = zip.Store
+	} else {
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+	}
+	return &zipSink{zw: zw, method: method}
+}
+
+func (z *zipSink) dir(e TreeEntry) error {
+	_, err := z.zw.CreateHeader(&zip.FileHeader{Name: e.Path + "/", Modified: e.ModTime, Method: zip.Store})
+	return err
+}
+
+func (z *zipSink) file(e TreeEntry, content io.Reader) error {
+	w, err := z.zw.CreateHeader(&zip.FileHeader{Name: e.Path, Modified: e.ModTime, Method: z.method})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, content)
+	return err
+}
+
+func (z *zipSink) close() error {
+	return z.zw.Close()
+}
+
+type tarSink struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (t *tarSink) dir(e TreeEntry) error {
+	return t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     e.Path + "/",
+		Mode:     0o755,
+		ModTime:  e.ModTime,
+		Format:   tar.FormatPAX,
+	})
+}
+
+func (t *tarSink) file(e TreeEntry, content io.Reader) error {
+	if err := t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     e.Path,
+		Mode:     0o644,
+		Size:     e.Size,
+		ModTime:  e.ModTime,
+		Format:   tar.FormatPAX,
+	}); err != nil {
+		return err
+	}
+	// The header promised Size bytes; anything else is an error, not a
+	// silently truncated or padded file
+	n, err := io.Copy(t.tw, content)
+	if err != nil {
+		return err
+	}
+	if n != e.Size {
+		return fmt.Errorf("expected %d bytes, found %d", e.Size, n)
+	}
+	return nil
+}
+
+func (t *tarSink) close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	if t.gz != nil {
+		return t.gz.Close()
+	}
+	return nil
+}
@@ -2,13 +2,19 @@ package auth
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"html/template"
+	"math"
 	"net/http"
-	"os"
+	"strconv"
+	"time"
 
 	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
 	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
 )
 
 type ServiceInterface interface {
@@ -19,6 +25,14 @@ type ServiceInterface interface {
 	AuthenticateUser(ctx context.Context, email, password string) (database.User, error)
 	GenerateJWTTokens(ctx context.Context, user database.User) (string, string, error)
 	RefreshJWTTokens(ctx context.Context, oldRefreshToken string) (string, string, error)
+	RequestEmailChange(ctx context.Context, userID int32, password, newEmail string) (EmailChange, error)
+	ConfirmEmailChange(ctx context.Context, token string) error
+	CancelEmailChange(ctx context.Context, token string) error
+	RequestPasswordReset(ctx context.Context, email string) (database.User, string, error)
+	ResetPassword(ctx context.Context, token, password string) error
+	CreatePersonalToken(ctx context.Context, userID int32, name string, expiresAt *time.Time) (database.PersonalToken, string, error)
+	ListPersonalTokens(ctx context.Context, userID int32) ([]database.PersonalToken, error)
+	RevokePersonalToken(ctx context.Context, userID int32, id uuid.UUID) error
 }
 
 type RegisterRequest struct {
@@ -39,9 +53,55 @@ type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-type EmailSender func(to, subject, body string) error
+type CreatePersonalTokenRequest struct {
+	Name string `json:"name"`
+	// Optional; the token never expires when omitted
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type PersonalTokenResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	// Only set in the response that creates the token
+	Token string `json:"token,omitempty"`
+}
+
+func NewPersonalTokenResponse(t database.PersonalToken) PersonalTokenResponse {
+	res := PersonalTokenResponse{ID: t.ID, Name: t.Name, CreatedAt: t.CreatedAt}
+	if t.LastUsedAt.Valid {
+		res.LastUsedAt = &t.LastUsedAt.Time
+	}
+	if t.ExpiresAt.Valid {
+		res.ExpiresAt = &t.ExpiresAt.Time
+	}
+	return res
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
 
-func RegisterHandler(service ServiceInterface, sendEmail EmailSender) http.HandlerFunc {
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email"`
+	Password string `json:"password"`
+}
+
+// VerificationSender delivers a verification link for token to the address.
+// email.Mailer.SendVerification queues it in the outbox.
+type VerificationSender func(ctx context.Context, to, token string) error
+
+// PasswordResetSender delivers a password reset link for token to the
+// address.
+type PasswordResetSender func(ctx context.Context, to, token string) error
+
+// EmailChangeSender mails the confirm link to the new address and the cancel
+// link to the old one.
+type EmailChangeSender func(ctx context.Context, oldEmail, newEmail, confirmToken, cancelToken string) error
+
+func RegisterHandler(service ServiceInterface, sendVerification VerificationSender) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req RegisterRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -60,12 +120,7 @@ func RegisterHandler(service ServiceInterface, sendEmail EmailSender) http.Handl
 			return
 		}
 
-		portString := os.Getenv("PORT")
-		verificationLink := fmt.Sprintf("http://localhost%s/auth/verify?token=%s", portString, user.VerificationToken.String)
-		subject := "Verify your email address at Cloud-Storage"
-		body := fmt.Sprintf("Click the link to verify your email:\n\n%s", verificationLink)
-		err = sendEmail(user.Email, subject, body)
-
+		err = sendVerification(r.Context(), user.Email, user.VerificationToken.String)
 		if err != nil {
 			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -96,7 +151,7 @@ func VerifyEmailHandler(service ServiceInterface) http.HandlerFunc {
 	}
 }
 
-func SendVerificationEmailHandler(service ServiceInterface, sendEmail EmailSender) http.HandlerFunc {
+func SendVerificationEmailHandler(service ServiceInterface, sendVerification VerificationSender) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req SendVerificationEmailRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -123,12 +178,7 @@ func SendVerificationEmailHandler(service ServiceInterface, sendEmail EmailSende
 			return
 		}
 
-		portString := os.Getenv("PORT")
-		verificationLink := fmt.Sprintf("http://localhost%s/auth/verify?token=%s", portString, verificationToken)
-		subject := "Verify your email address at Cloud-Storage"
-		body := fmt.Sprintf("Click the link to verify your email:\n\n%s", verificationLink)
-		err = sendEmail(user.Email, subject, body)
-
+		err = sendVerification(r.Context(), user.Email, verificationToken)
 		if err != nil {
 			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -155,6 +205,13 @@ func LoginHandler(service ServiceInterface) http.HandlerFunc {
 
 		user, err := service.AuthenticateUser(r.Context(), req.Email, req.Password)
 		if err != nil {
+			var locked *LockedError
+			if errors.As(err, &locked) {
+				seconds := int(math.Ceil(time.Until(locked.Until).Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+				util.RespondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts, please try again later")
+				return
+			}
 			util.RespondWithError(w, http.StatusUnauthorized, "Invalid email or password")
 			return
 		}
@@ -192,3 +249,273 @@ func RefreshTokenHandler(service ServiceInterface) http.HandlerFunc {
 		})
 	}
 }
+
+// RequestEmailChangeHandler must be mounted behind AuthMiddleware.
+func RequestEmailChangeHandler(service ServiceInterface, sendEmailChange EmailChangeSender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req ChangeEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if req.NewEmail == "" || req.Password == "" {
+			util.RespondWithError(w, http.StatusBadRequest, "New email and password are required")
+			return
+		}
+
+		change, err := service.RequestEmailChange(r.Context(), userID, req.Password, req.NewEmail)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrInvalidPassword):
+				util.RespondWithError(w, http.StatusUnauthorized, "Invalid password")
+			case errors.Is(err, ErrEmailInUse):
+				util.RespondWithError(w, http.StatusConflict, err.Error())
+			default:
+				util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			}
+			return
+		}
+
+		err = sendEmailChange(r.Context(), change.OldEmail, change.NewEmail, change.ConfirmToken, change.CancelToken)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusAccepted, map[string]string{
+			"message": "Check your new email address to confirm the change",
+		})
+	}
+}
+
+// tokenPage is what the links in email change and password reset messages
+// open. Mail scanners and link previews fetch links on their own, so the
+// page only asks, and the change happens when its form is posted back.
+var tokenPage = template.Must(template.New("token").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Prompt}}</title></head>
+<body>
+<form method="post">
+<p>{{.Prompt}}</p>
+<input type="hidden" name="token" value="{{.Token}}">
+{{if .Password}}<p><input type="password" name="password" autocomplete="new-password" required></p>
+{{end}}<button type="submit">{{.Button}}</button>
+</form>
+</body>
+</html>
+`))
+
+func serveTokenPage(w http.ResponseWriter, r *http.Request, prompt, button string, password bool) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		util.RespondWithError(w, http.StatusBadRequest, "Missing token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// The token is in the URL; keep it out of other sites' logs
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	tokenPage.Execute(w, map[string]any{"Prompt": prompt, "Button": button, "Token": token, "Password": password})
+}
+
+// EmailChangePageHandler serves the page behind a confirm or cancel link,
+// whose form posts the token to the same path.
+func EmailChangePageHandler(prompt, button string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveTokenPage(w, r, prompt, button, false)
+	}
+}
+
+func ConfirmEmailChangeHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.FormValue("token")
+		if token == "" {
+			util.RespondWithError(w, http.StatusBadRequest, "Missing token")
+			return
+		}
+
+		if err := service.ConfirmEmailChange(r.Context(), token); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{
+			"message": "Email changed, please log in again",
+		})
+	}
+}
+
+func CancelEmailChangeHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.FormValue("token")
+		if token == "" {
+			util.RespondWithError(w, http.StatusBadRequest, "Missing token")
+			return
+		}
+
+		if err := service.CancelEmailChange(r.Context(), token); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{
+			"message": "Email change cancelled",
+		})
+	}
+}
+
+// RequestPasswordResetHandler mails a reset link. It answers the same way
+// whether or not the address has an account, so it can't be used to find
+// out which addresses do.
+func RequestPasswordResetHandler(service ServiceInterface, sendReset PasswordResetSender) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req PasswordResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		user, token, err := service.RequestPasswordReset(r.Context(), req.Email)
+		switch {
+		case err == nil:
+			if err := sendReset(r.Context(), user.Email, token); err != nil {
+				util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		case !errors.Is(err, sql.ErrNoRows):
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{
+			"message": "If the address has an account, a reset link has been sent to it",
+		})
+	}
+}
+
+// PasswordResetPageHandler serves the page behind a reset link, which asks
+// for the new password and posts it with the token to the same path.
+func PasswordResetPageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveTokenPage(w, r, "Choose a new password", "Set password", true)
+	}
+}
+
+func ResetPasswordHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, password := r.FormValue("token"), r.FormValue("password")
+		if token == "" || password == "" {
+			util.RespondWithError(w, http.StatusBadRequest, "Missing token or password")
+			return
+		}
+
+		err := service.ResetPassword(r.Context(), token, password)
+		switch {
+		case errors.Is(err, ErrInvalidResetToken):
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		case err != nil:
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to reset password")
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{
+			"message": "Password changed, please log in again",
+		})
+	}
+}
+
+// CreatePersonalTokenHandler issues a token for clients limited to Basic
+// auth. The token is in this response only.
+func CreatePersonalTokenHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req CreatePersonalTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			util.RespondWithError(w, http.StatusBadRequest, "expires_at must be in the future")
+			return
+		}
+
+		row, token, err := service.CreatePersonalToken(r.Context(), userID, req.Name, req.ExpiresAt)
+		switch {
+		case errors.Is(err, ErrTokenNameEmpty):
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, ErrTokenLimit):
+			util.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to create token")
+			return
+		}
+
+		res := NewPersonalTokenResponse(row)
+		res.Token = token
+		util.RespondWithJSON(w, http.StatusCreated, res)
+	}
+}
+
+func ListPersonalTokensHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		tokens, err := service.ListPersonalTokens(r.Context(), userID)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to list tokens")
+			return
+		}
+
+		res := make([]PersonalTokenResponse, 0, len(tokens))
+		for _, t := range tokens {
+			res = append(res, NewPersonalTokenResponse(t))
+		}
+		util.RespondWithJSON(w, http.StatusOK, res)
+	}
+}
+
+func RevokePersonalTokenHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid token ID")
+			return
+		}
+
+		if err := service.RevokePersonalToken(r.Context(), userID, id); err != nil {
+			if errors.Is(err, ErrTokenNotFound) {
+				util.RespondWithError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to revoke token")
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Token revoked"})
+	}
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+)
+
+// PasswordResetTTL is how long a password reset link stays usable.
+const PasswordResetTTL = time.Hour
+
+var ErrInvalidResetToken = errors.New("invalid or expired token")
+
+// RequestPasswordReset issues a reset token for the account with the email,
+// replacing any earlier one, and returns the user to mail it to. Unknown
+// addresses give sql.ErrNoRows.
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) (database.User, string, error) {
+	user, err := s.userService.GetUserByEmail(ctx, email)
+	if err != nil {
+		return database.User{}, "", err
+	}
+
+	if _, err := s.queries.DeleteUserPasswordResets(ctx, user.ID); err != nil {
+		return database.User{}, "", fmt.Errorf("clearing earlier resets: %w", err)
+	}
+
+	token, err := util.GenerateVerificationToken()
+	if err != nil {
+		return database.User{}, "", err
+	}
+	err = s.queries.CreatePasswordReset(ctx, database.CreatePasswordResetParams{
+		TokenHash: util.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(PasswordResetTTL),
+	})
+	if err != nil {
+		return database.User{}, "", fmt.Errorf("storing reset: %w", err)
+	}
+	return user, token, nil
+}
+
+// ResetPassword sets a new password with a reset token, which works once.
+// Existing sessions are revoked and any lockout is lifted.
+func (s *Service) ResetPassword(ctx context.Context, token, password string) error {
+	reset, err := s.queries.RedeemPasswordReset(ctx, util.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if reset.ExpiresAt.Before(time.Now()) {
+		return ErrInvalidResetToken
+	}
+
+	if err := s.userService.UpdateUserPassword(ctx, reset.UserID, password); err != nil {
+		return fmt.Errorf("updating password: %w", err)
+	}
+	if _, err := s.queries.RevokeUserRefreshTokens(ctx, reset.UserID); err != nil {
+		return fmt.Errorf("revoking sessions: %w", err)
+	}
+	if _, err := s.queries.ResetFailedLogins(ctx, reset.UserID); err != nil {
+		return fmt.Errorf("clearing failed logins: %w", err)
+	}
+	return nil
+}
@@ -4,14 +4,48 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/bellezhang119/cloud-storage/internal/database"
 	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
 )
 
 var expireTime time.Duration = 30
 
+const (
+	lockoutThreshold = 5
+	baseLockout      = time.Minute
+	maxLockout       = 24 * time.Hour
+)
+
+// LockedError is returned by AuthenticateUser while an account is locked out
+// after too many failed logins.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return "account is temporarily locked"
+}
+
+var (
+	ErrInvalidPassword = errors.New("invalid password")
+	ErrEmailInUse      = errors.New("email is already in use")
+)
+
+// EmailChange carries the plain tokens of a pending email change so they can
+// be mailed out. Only their hashes are stored.
+type EmailChange struct {
+	OldEmail     string
+	NewEmail     string
+	ConfirmToken string
+	CancelToken  string
+}
+
 type Queries interface {
 	CreateUser(ctx context.Context, params database.CreateUserParams) (database.User, error)
 	GetUserByVerificationToken(ctx context.Context, token sql.NullString) (database.User, error)
@@ -20,11 +54,29 @@ type Queries interface {
 	InsertRefreshToken(ctx context.Context, arg database.InsertRefreshTokenParams) (database.RefreshToken, error)
 	GetRefreshToken(ctx context.Context, tokenHash string) (database.GetRefreshTokenRow, error)
 	RevokeRefreshToken(ctx context.Context, tokenHash string) (int64, error)
+	IncrementFailedLogins(ctx context.Context, id int32) (int32, error)
+	LockUserUntil(ctx context.Context, arg database.LockUserUntilParams) (int64, error)
+	ResetFailedLogins(ctx context.Context, id int32) (int64, error)
+	SetPendingEmailChange(ctx context.Context, arg database.SetPendingEmailChangeParams) (int64, error)
+	GetUserByEmailChangeToken(ctx context.Context, tokenHash sql.NullString) (database.User, error)
+	GetUserByEmailChangeCancelToken(ctx context.Context, cancelHash sql.NullString) (database.User, error)
+	ApplyEmailChange(ctx context.Context, id int32) (int64, error)
+	ClearEmailChange(ctx context.Context, id int32) (int64, error)
+	RevokeUserRefreshTokens(ctx context.Context, userID int32) (int64, error)
+	CreatePersonalToken(ctx context.Context, arg database.CreatePersonalTokenParams) (database.PersonalToken, error)
+	ListPersonalTokens(ctx context.Context, userID int32) ([]database.PersonalToken, error)
+	GetPersonalTokenByHash(ctx context.Context, tokenHash string) (database.PersonalToken, error)
+	TouchPersonalToken(ctx context.Context, id uuid.UUID) (int64, error)
+	DeletePersonalToken(ctx context.Context, arg database.DeletePersonalTokenParams) (int64, error)
+	CreatePasswordReset(ctx context.Context, arg database.CreatePasswordResetParams) error
+	RedeemPasswordReset(ctx context.Context, tokenHash string) (database.RedeemPasswordResetRow, error)
+	DeleteUserPasswordResets(ctx context.Context, userID int32) (int64, error)
 }
 
 type UserGetter interface {
 	GetUserByID(ctx context.Context, id int32) (database.User, error)
 	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	UpdateUserPassword(ctx context.Context, userID int32, newPassword string) error
 }
 
 type Service struct {
@@ -132,20 +184,77 @@ func (s *Service) AuthenticateUser(ctx context.Context, email, password string)
 		return database.User{}, err
 	}
 
+	if user.LockedUntil.Valid && user.LockedUntil.Time.After(time.Now()) {
+		return database.User{}, &LockedError{Until: user.LockedUntil.Time}
+	}
+
 	if err := util.CheckPassword(user.PasswordHash, password); err != nil {
+		if lockErr := s.recordFailedLogin(ctx, user.ID); lockErr != nil {
+			return database.User{}, lockErr
+		}
 		return database.User{}, err
 	}
 
+	if user.IsDisabled {
+		return database.User{}, errors.New("account is disabled")
+	}
+
+	if user.FailedLoginAttempts > 0 {
+		if _, err := s.queries.ResetFailedLogins(ctx, user.ID); err != nil {
+			log.Printf("resetting failed logins for user %d: %v", user.ID, err)
+		}
+	}
+
 	return user, nil
 }
 
+// recordFailedLogin bumps the failure counter and, once it passes the
+// threshold, locks the account for a period that doubles with every further
+// failure. It returns a *LockedError when this attempt triggered a lock.
+func (s *Service) recordFailedLogin(ctx context.Context, userID int32) error {
+	attempts, err := s.queries.IncrementFailedLogins(ctx, userID)
+	if err != nil {
+		log.Printf("recording failed login for user %d: %v", userID, err)
+		return nil
+	}
+
+	d := lockoutDuration(attempts)
+	if d == 0 {
+		return nil
+	}
+
+	until := time.Now().Add(d)
+	if _, err := s.queries.LockUserUntil(ctx, database.LockUserUntilParams{
+		ID:          userID,
+		LockedUntil: sql.NullTime{Time: until, Valid: true},
+	}); err != nil {
+		log.Printf("locking user %d: %v", userID, err)
+		return nil
+	}
+
+	return &LockedError{Until: until}
+}
+
+func lockoutDuration(attempts int32) time.Duration {
+	if attempts < lockoutThreshold {
+		return 0
+	}
+
+	// 1m, 2m, 4m, ... capped at a day
+	shift := attempts - lockoutThreshold
+	if shift > 20 {
+		return maxLockout
+	}
+	return min(baseLockout<<shift, maxLockout)
+}
+
 func (s *Service) GenerateJWTTokens(
 	ctx context.Context,
 	user database.User,
 ) (accessToken string, refreshToken string, err error) {
 	expiry := time.Now().Add(expireTime * 24 * time.Hour)
 
-	accessToken, refreshToken, err = util.GenerateJWTTokens(user.ID, user.Email, expiry)
+	accessToken, refreshToken, err = util.GenerateJWTTokens(user.ID, user.Email, user.TokenVersion, expiry)
 	if err != nil {
 		return "", "", err
 	}
@@ -184,9 +293,12 @@ func (s *Service) RefreshJWTTokens(ctx context.Context, oldRefreshToken string)
 	if err != nil {
 		return "", "", err
 	}
+	if user.IsDisabled {
+		return "", "", errors.New("account is disabled")
+	}
 
 	expiry := time.Unix(int64(claims["exp"].(float64)), 0)
-	accessToken, refreshToken, err = util.GenerateJWTTokens(user.ID, user.Email, expiry)
+	accessToken, refreshToken, err = util.GenerateJWTTokens(user.ID, user.Email, user.TokenVersion, expiry)
 	if err != nil {
 		return "", "", err
 	}
@@ -212,3 +324,141 @@ func (s *Service) RefreshJWTTokens(ctx context.Context, oldRefreshToken string)
 
 	return accessToken, refreshToken, nil
 }
+
+// CheckSession is the middleware.SessionChecker: an access token stops
+// working once its user is disabled or their sessions have been revoked,
+// which bumps the token version past the one it carries.
+func (s *Service) CheckSession(ctx context.Context, userID int32, version int32) error {
+	user, err := s.userService.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.IsDisabled {
+		return errors.New("account is disabled")
+	}
+	if user.TokenVersion != version {
+		return errors.New("session has been revoked")
+	}
+	return nil
+}
+
+// RequestEmailChange checks the password and stores a pending change to
+// newEmail. The address on the account only changes once ConfirmEmailChange
+// is called with the returned confirm token.
+func (s *Service) RequestEmailChange(ctx context.Context, userID int32, password, newEmail string) (EmailChange, error) {
+	newEmail = strings.TrimSpace(newEmail)
+	if newEmail == "" {
+		return EmailChange{}, errors.New("new email is required")
+	}
+
+	user, err := s.userService.GetUserByID(ctx, userID)
+	if err != nil {
+		return EmailChange{}, err
+	}
+
+	if err := util.CheckPassword(user.PasswordHash, password); err != nil {
+		return EmailChange{}, ErrInvalidPassword
+	}
+
+	if strings.EqualFold(user.Email, newEmail) {
+		return EmailChange{}, errors.New("new email must differ from the current one")
+	}
+
+	_, err = s.userService.GetUserByEmail(ctx, newEmail)
+	if err == nil {
+		return EmailChange{}, ErrEmailInUse
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return EmailChange{}, err
+	}
+
+	confirmToken, err := util.GenerateVerificationToken()
+	if err != nil {
+		return EmailChange{}, err
+	}
+	cancelToken, err := util.GenerateVerificationToken()
+	if err != nil {
+		return EmailChange{}, err
+	}
+
+	rowsAffected, err := s.queries.SetPendingEmailChange(ctx, database.SetPendingEmailChangeParams{
+		ID:                    userID,
+		PendingEmail:          sql.NullString{String: newEmail, Valid: true},
+		EmailChangeTokenHash:  sql.NullString{String: util.HashToken(confirmToken), Valid: true},
+		EmailChangeCancelHash: sql.NullString{String: util.HashToken(cancelToken), Valid: true},
+		EmailChangeExpiry:     sql.NullTime{Time: time.Now().Add(24 * time.Hour), Valid: true},
+	})
+	if err != nil {
+		return EmailChange{}, err
+	}
+	if rowsAffected == 0 {
+		return EmailChange{}, errors.New("failed to store email change: no rows updated")
+	}
+
+	return EmailChange{
+		OldEmail:     user.Email,
+		NewEmail:     newEmail,
+		ConfirmToken: confirmToken,
+		CancelToken:  cancelToken,
+	}, nil
+}
+
+// ConfirmEmailChange swaps in the pending address and revokes every session,
+// since the old tokens were issued for the previous address. Revoking bumps
+// the token version, so access tokens stop working along with refresh
+// tokens.
+func (s *Service) ConfirmEmailChange(ctx context.Context, token string) error {
+	user, err := s.queries.GetUserByEmailChangeToken(ctx, sql.NullString{
+		String: util.HashToken(token),
+		Valid:  true,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("invalid or expired token")
+		}
+		return err
+	}
+
+	if !user.EmailChangeExpiry.Valid || user.EmailChangeExpiry.Time.Before(time.Now()) {
+		return errors.New("token has expired")
+	}
+
+	rowsAffected, err := s.queries.ApplyEmailChange(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("applying email change: %w", err)
+	}
+	if rowsAffected == 0 {
+		return errors.New("failed to change email: no rows updated")
+	}
+
+	if _, err := s.queries.RevokeUserRefreshTokens(ctx, user.ID); err != nil {
+		return fmt.Errorf("revoking sessions: %w", err)
+	}
+
+	return nil
+}
+
+// CancelEmailChange drops a pending change using the token sent to the old
+// address.
+func (s *Service) CancelEmailChange(ctx context.Context, token string) error {
+	user, err := s.queries.GetUserByEmailChangeCancelToken(ctx, sql.NullString{
+		String: util.HashToken(token),
+		Valid:  true,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("invalid token or no pending email change")
+		}
+		return err
+	}
+
+	rowsAffected, err := s.queries.ClearEmailChange(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errors.New("failed to cancel email change: no rows updated")
+	}
+
+	return nil
+}
@@ -7,9 +7,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/bellezhang119/cloud-storage/internal/auth"
 	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -54,9 +57,50 @@ func (m *MockService) RefreshJWTTokens(ctx context.Context, oldRefreshToken stri
 	return args.String(0), args.String(1), args.Error(2)
 }
 
+func (m *MockService) RequestEmailChange(ctx context.Context, userID int32, password, newEmail string) (auth.EmailChange, error) {
+	args := m.Called(ctx, userID, password, newEmail)
+	return args.Get(0).(auth.EmailChange), args.Error(1)
+}
+
+func (m *MockService) ConfirmEmailChange(ctx context.Context, token string) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockService) CancelEmailChange(ctx context.Context, token string) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockService) RequestPasswordReset(ctx context.Context, email string) (database.User, string, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(database.User), args.String(1), args.Error(2)
+}
+
+func (m *MockService) ResetPassword(ctx context.Context, token, password string) error {
+	args := m.Called(ctx, token, password)
+	return args.Error(0)
+}
+
+func (m *MockService) CreatePersonalToken(ctx context.Context, userID int32, name string, expiresAt *time.Time) (database.PersonalToken, string, error) {
+	args := m.Called(ctx, userID, name, expiresAt)
+	return args.Get(0).(database.PersonalToken), args.String(1), args.Error(2)
+}
+
+func (m *MockService) ListPersonalTokens(ctx context.Context, userID int32) ([]database.PersonalToken, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.PersonalToken), args.Error(1)
+}
+
+func (m *MockService) RevokePersonalToken(ctx context.Context, userID int32, id uuid.UUID) error {
+	return m.Called(ctx, userID, id).Error(0)
+}
+
 func TestRegisterHandler_Success(t *testing.T) {
 	mockSvc := new(MockService)
-	mockEmailSender := func(to, subject, body string) error {
+	var sentTo, sentToken string
+	mockEmailSender := func(ctx context.Context, to, token string) error {
+		sentTo, sentToken = to, token
 		return nil
 	}
 
@@ -79,12 +123,14 @@ func TestRegisterHandler_Success(t *testing.T) {
 
 	assert.Equal(t, http.StatusCreated, rec.Code)
 	assert.Contains(t, rec.Body.String(), "User created")
+	assert.Equal(t, "test@example.com", sentTo)
+	assert.Equal(t, "token123", sentToken)
 	mockSvc.AssertExpectations(t)
 }
 
 func TestRegisterHandler_InvalidRequest(t *testing.T) {
 	mockSvc := new(MockService)
-	mockEmailSender := func(to, subject, body string) error {
+	mockEmailSender := func(ctx context.Context, to, token string) error {
 		return nil
 	}
 	handler := auth.RegisterHandler(mockSvc, mockEmailSender)
@@ -131,7 +177,7 @@ func TestVerifyEmailHandler_MissingToken(t *testing.T) {
 // Test SendVerificationEmailHandler success:
 func TestSendVerificationEmailHandler_Success(t *testing.T) {
 	mockSvc := new(MockService)
-	mockEmailSender := func(to, subject, body string) error {
+	mockEmailSender := func(ctx context.Context, to, token string) error {
 		return nil
 	}
 	handler := auth.SendVerificationEmailHandler(mockSvc, mockEmailSender)
@@ -177,6 +223,24 @@ func TestLoginHandler_Success(t *testing.T) {
 	mockSvc.AssertExpectations(t)
 }
 
+func TestLoginHandler_Locked(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := auth.LoginHandler(mockSvc)
+
+	lockErr := &auth.LockedError{Until: time.Now().Add(2 * time.Minute)}
+	mockSvc.On("AuthenticateUser", mock.Anything, "test@example.com", "password123").Return(database.User{}, lockErr)
+
+	reqBody := `{"email":"test@example.com","password":"password123"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(reqBody))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	mockSvc.AssertNotCalled(t, "GenerateJWTTokens", mock.Anything, mock.Anything)
+}
+
 // Test RefreshTokenHandler success:
 func TestRefreshTokenHandler_Success(t *testing.T) {
 	mockSvc := new(MockService)
@@ -195,3 +259,153 @@ func TestRefreshTokenHandler_Success(t *testing.T) {
 	assert.Contains(t, rec.Body.String(), "refresh_token")
 	mockSvc.AssertExpectations(t)
 }
+
+func TestRequestEmailChangeHandler_Success(t *testing.T) {
+	mockSvc := new(MockService)
+	var sentOld, sentNew, sentConfirm, sentCancel string
+	sender := func(ctx context.Context, oldEmail, newEmail, confirmToken, cancelToken string) error {
+		sentOld, sentNew, sentConfirm, sentCancel = oldEmail, newEmail, confirmToken, cancelToken
+		return nil
+	}
+	handler := auth.RequestEmailChangeHandler(mockSvc, sender)
+
+	change := auth.EmailChange{
+		OldEmail:     "old@example.com",
+		NewEmail:     "new@example.com",
+		ConfirmToken: "confirm123",
+		CancelToken:  "cancel123",
+	}
+	mockSvc.On("RequestEmailChange", mock.Anything, int32(7), "password123", "new@example.com").Return(change, nil)
+
+	reqBody := `{"new_email":"new@example.com","password":"password123"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth/email-change", bytes.NewBufferString(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(7)))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "old@example.com", sentOld)
+	assert.Equal(t, "new@example.com", sentNew)
+	assert.Equal(t, "confirm123", sentConfirm)
+	assert.Equal(t, "cancel123", sentCancel)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestRequestEmailChangeHandler_WrongPassword(t *testing.T) {
+	mockSvc := new(MockService)
+	sender := func(ctx context.Context, oldEmail, newEmail, confirmToken, cancelToken string) error {
+		t.Fatal("no email should be sent")
+		return nil
+	}
+	handler := auth.RequestEmailChangeHandler(mockSvc, sender)
+
+	mockSvc.On("RequestEmailChange", mock.Anything, int32(7), "wrong", "new@example.com").
+		Return(auth.EmailChange{}, auth.ErrInvalidPassword)
+
+	reqBody := `{"new_email":"new@example.com","password":"wrong"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth/email-change", bytes.NewBufferString(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(7)))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestRequestEmailChangeHandler_Unauthenticated(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := auth.RequestEmailChangeHandler(mockSvc, nil)
+
+	reqBody := `{"new_email":"new@example.com","password":"password123"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth/email-change", bytes.NewBufferString(reqBody))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestConfirmEmailChangeHandler_Success(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := auth.ConfirmEmailChangeHandler(mockSvc)
+
+	mockSvc.On("ConfirmEmailChange", mock.Anything, "confirm123").Return(nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/email-change/confirm", bytes.NewBufferString("token=confirm123"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Email changed")
+	mockSvc.AssertExpectations(t)
+}
+
+func TestEmailChangePageHandler_OnlyAsks(t *testing.T) {
+	handler := auth.EmailChangePageHandler("Confirm?", "Confirm")
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/email-change/confirm?token=a%22b", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `<form method="post">`)
+	assert.Contains(t, rec.Body.String(), `value="a&#34;b"`)
+}
+
+func TestCancelEmailChangeHandler_MissingToken(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := auth.CancelEmailChangeHandler(mockSvc)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/email-change/cancel", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestRequestPasswordResetHandler_SameAnswerForUnknownAddress(t *testing.T) {
+	mockSvc := new(MockService)
+	var sentTo []string
+	send := func(ctx context.Context, to, token string) error {
+		sentTo = append(sentTo, to)
+		return nil
+	}
+	handler := auth.RequestPasswordResetHandler(mockSvc, send)
+
+	mockSvc.On("RequestPasswordReset", mock.Anything, "a@example.com").Return(database.User{Email: "a@example.com"}, "token", nil)
+	mockSvc.On("RequestPasswordReset", mock.Anything, "nobody@example.com").Return(database.User{}, "", sql.ErrNoRows)
+
+	var bodies []string
+	for _, addr := range []string{"a@example.com", "nobody@example.com"} {
+		req := httptest.NewRequest(http.MethodPost, "/auth/password-reset", bytes.NewBufferString(`{"email":"`+addr+`"}`))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		bodies = append(bodies, rec.Body.String())
+	}
+	assert.Equal(t, bodies[0], bodies[1])
+	assert.Equal(t, []string{"a@example.com"}, sentTo)
+}
+
+func TestResetPasswordHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := auth.ResetPasswordHandler(mockSvc)
+
+	mockSvc.On("ResetPassword", mock.Anything, "good", "newpassword").Return(nil)
+	mockSvc.On("ResetPassword", mock.Anything, "bad", "newpassword").Return(auth.ErrInvalidResetToken)
+
+	for token, code := range map[string]int{"good": http.StatusOK, "bad": http.StatusBadRequest} {
+		req := httptest.NewRequest(http.MethodPost, "/auth/reset-password", bytes.NewBufferString("token="+token+"&password=newpassword"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, code, rec.Code, token)
+	}
+}
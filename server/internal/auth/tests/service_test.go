@@ -9,6 +9,7 @@ import (
 	"github.com/bellezhang119/cloud-storage/internal/auth"
 	"github.com/bellezhang119/cloud-storage/internal/database"
 	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -52,6 +53,91 @@ func (m *MockAuthQueries) RevokeRefreshToken(ctx context.Context, hash string) (
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *MockAuthQueries) IncrementFailedLogins(ctx context.Context, id int32) (int32, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(int32), args.Error(1)
+}
+
+func (m *MockAuthQueries) LockUserUntil(ctx context.Context, params database.LockUserUntilParams) (int64, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAuthQueries) ResetFailedLogins(ctx context.Context, id int32) (int64, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAuthQueries) SetPendingEmailChange(ctx context.Context, params database.SetPendingEmailChangeParams) (int64, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAuthQueries) GetUserByEmailChangeToken(ctx context.Context, tokenHash sql.NullString) (database.User, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(database.User), args.Error(1)
+}
+
+func (m *MockAuthQueries) GetUserByEmailChangeCancelToken(ctx context.Context, cancelHash sql.NullString) (database.User, error) {
+	args := m.Called(ctx, cancelHash)
+	return args.Get(0).(database.User), args.Error(1)
+}
+
+func (m *MockAuthQueries) ApplyEmailChange(ctx context.Context, id int32) (int64, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAuthQueries) ClearEmailChange(ctx context.Context, id int32) (int64, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAuthQueries) RevokeUserRefreshTokens(ctx context.Context, userID int32) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAuthQueries) CreatePersonalToken(ctx context.Context, arg database.CreatePersonalTokenParams) (database.PersonalToken, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.PersonalToken), args.Error(1)
+}
+
+func (m *MockAuthQueries) ListPersonalTokens(ctx context.Context, userID int32) ([]database.PersonalToken, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.PersonalToken), args.Error(1)
+}
+
+func (m *MockAuthQueries) GetPersonalTokenByHash(ctx context.Context, tokenHash string) (database.PersonalToken, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(database.PersonalToken), args.Error(1)
+}
+
+func (m *MockAuthQueries) TouchPersonalToken(ctx context.Context, id uuid.UUID) (int64, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAuthQueries) CreatePasswordReset(ctx context.Context, arg database.CreatePasswordResetParams) error {
+	args := m.Called(ctx, arg)
+	return args.Error(0)
+}
+
+func (m *MockAuthQueries) RedeemPasswordReset(ctx context.Context, tokenHash string) (database.RedeemPasswordResetRow, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(database.RedeemPasswordResetRow), args.Error(1)
+}
+
+func (m *MockAuthQueries) DeleteUserPasswordResets(ctx context.Context, userID int32) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAuthQueries) DeletePersonalToken(ctx context.Context, arg database.DeletePersonalTokenParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 type MockUserService struct {
 	mock.Mock
 }
@@ -66,6 +152,11 @@ func (m *MockUserService) GetUserByEmail(ctx context.Context, email string) (dat
 	return args.Get(0).(database.User), args.Error(1)
 }
 
+func (m *MockUserService) UpdateUserPassword(ctx context.Context, userID int32, newPassword string) error {
+	args := m.Called(ctx, userID, newPassword)
+	return args.Error(0)
+}
+
 func TestVerifyUserByToken_Success(t *testing.T) {
 	mockQ := new(MockAuthQueries)
 	mockUserSvc := new(MockUserService)
@@ -141,10 +232,106 @@ func TestAuthenticateUser_InvalidPassword(t *testing.T) {
 		PasswordHash: hashed,
 		Email:        email,
 	}, nil)
+	mockQ.On("IncrementFailedLogins", ctx, int32(0)).Return(int32(1), nil)
 
 	_, err := svc.AuthenticateUser(ctx, email, "wrongpass")
 	assert.Error(t, err)
 	mockUserSvc.AssertExpectations(t)
+	mockQ.AssertExpectations(t)
+}
+
+func TestAuthenticateUser_LocksAfterThreshold(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	email := "user@example.com"
+
+	hashed, _ := util.HashPassword("rightpass")
+	mockUserSvc.On("GetUserByEmail", ctx, email).Return(database.User{
+		ID:                  7,
+		PasswordHash:        hashed,
+		Email:               email,
+		FailedLoginAttempts: 4,
+	}, nil)
+	mockQ.On("IncrementFailedLogins", ctx, int32(7)).Return(int32(5), nil)
+	mockQ.On("LockUserUntil", ctx, mock.MatchedBy(func(p database.LockUserUntilParams) bool {
+		return p.ID == 7 && p.LockedUntil.Valid && p.LockedUntil.Time.After(time.Now())
+	})).Return(int64(1), nil)
+
+	_, err := svc.AuthenticateUser(ctx, email, "wrongpass")
+
+	var locked *auth.LockedError
+	assert.ErrorAs(t, err, &locked)
+	mockQ.AssertExpectations(t)
+}
+
+func TestAuthenticateUser_LockedAccountRejectsCorrectPassword(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	email := "user@example.com"
+
+	hashed, _ := util.HashPassword("rightpass")
+	mockUserSvc.On("GetUserByEmail", ctx, email).Return(database.User{
+		ID:           7,
+		PasswordHash: hashed,
+		Email:        email,
+		LockedUntil:  sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+	}, nil)
+
+	_, err := svc.AuthenticateUser(ctx, email, "rightpass")
+
+	var locked *auth.LockedError
+	assert.ErrorAs(t, err, &locked)
+	mockQ.AssertNotCalled(t, "IncrementFailedLogins", mock.Anything, mock.Anything)
+}
+
+func TestAuthenticateUser_SuccessResetsFailures(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	email := "user@example.com"
+
+	hashed, _ := util.HashPassword("rightpass")
+	mockUserSvc.On("GetUserByEmail", ctx, email).Return(database.User{
+		ID:                  7,
+		PasswordHash:        hashed,
+		Email:               email,
+		FailedLoginAttempts: 3,
+		LockedUntil:         sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+	}, nil)
+	mockQ.On("ResetFailedLogins", ctx, int32(7)).Return(int64(1), nil)
+
+	user, err := svc.AuthenticateUser(ctx, email, "rightpass")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(7), user.ID)
+	mockQ.AssertExpectations(t)
+}
+
+func TestAuthenticateUser_Disabled(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	email := "user@example.com"
+
+	hashed, _ := util.HashPassword("rightpass")
+	mockUserSvc.On("GetUserByEmail", ctx, email).Return(database.User{
+		PasswordHash: hashed,
+		Email:        email,
+		IsDisabled:   true,
+	}, nil)
+
+	_, err := svc.AuthenticateUser(ctx, email, "rightpass")
+	assert.Error(t, err)
+	mockUserSvc.AssertExpectations(t)
 }
 
 func TestGenerateJWTTokens_Success(t *testing.T) {
@@ -172,7 +359,7 @@ func TestRefreshJWTTokens_Success(t *testing.T) {
 	ctx := context.Background()
 	user := database.User{ID: 1, Email: "user@example.com"}
 
-	_, oldToken, err := util.GenerateJWTTokens(user.ID, user.Email, time.Now().Add(1*time.Hour))
+	_, oldToken, err := util.GenerateJWTTokens(user.ID, user.Email, user.TokenVersion, time.Now().Add(1*time.Hour))
 	assert.NoError(t, err)
 
 	hashedOld := util.HashToken(oldToken)
@@ -197,3 +384,201 @@ func TestRefreshJWTTokens_Success(t *testing.T) {
 	mockQ.AssertExpectations(t)
 	mockUserSvc.AssertExpectations(t)
 }
+
+func TestRequestEmailChange_Success(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	hashed, _ := util.HashPassword("rightpass")
+	mockUserSvc.On("GetUserByID", ctx, int32(3)).Return(database.User{
+		ID:           3,
+		Email:        "old@example.com",
+		PasswordHash: hashed,
+	}, nil)
+	mockUserSvc.On("GetUserByEmail", ctx, "new@example.com").Return(database.User{}, sql.ErrNoRows)
+
+	var stored database.SetPendingEmailChangeParams
+	mockQ.On("SetPendingEmailChange", ctx, mock.Anything).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(database.SetPendingEmailChangeParams) }).
+		Return(int64(1), nil)
+
+	change, err := svc.RequestEmailChange(ctx, 3, "rightpass", " new@example.com ")
+	assert.NoError(t, err)
+	assert.Equal(t, "old@example.com", change.OldEmail)
+	assert.Equal(t, "new@example.com", change.NewEmail)
+	assert.NotEqual(t, change.ConfirmToken, change.CancelToken)
+
+	// Only hashes of the tokens are persisted.
+	assert.Equal(t, "new@example.com", stored.PendingEmail.String)
+	assert.Equal(t, util.HashToken(change.ConfirmToken), stored.EmailChangeTokenHash.String)
+	assert.Equal(t, util.HashToken(change.CancelToken), stored.EmailChangeCancelHash.String)
+	assert.True(t, stored.EmailChangeExpiry.Time.After(time.Now()))
+	mockQ.AssertExpectations(t)
+	mockUserSvc.AssertExpectations(t)
+}
+
+func TestRequestEmailChange_WrongPassword(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	hashed, _ := util.HashPassword("rightpass")
+	mockUserSvc.On("GetUserByID", ctx, int32(3)).Return(database.User{
+		ID:           3,
+		Email:        "old@example.com",
+		PasswordHash: hashed,
+	}, nil)
+
+	_, err := svc.RequestEmailChange(ctx, 3, "wrongpass", "new@example.com")
+	assert.ErrorIs(t, err, auth.ErrInvalidPassword)
+	mockQ.AssertNotCalled(t, "SetPendingEmailChange", mock.Anything, mock.Anything)
+}
+
+func TestRequestEmailChange_EmailTaken(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	hashed, _ := util.HashPassword("rightpass")
+	mockUserSvc.On("GetUserByID", ctx, int32(3)).Return(database.User{
+		ID:           3,
+		Email:        "old@example.com",
+		PasswordHash: hashed,
+	}, nil)
+	mockUserSvc.On("GetUserByEmail", ctx, "taken@example.com").Return(database.User{ID: 9}, nil)
+
+	_, err := svc.RequestEmailChange(ctx, 3, "rightpass", "taken@example.com")
+	assert.ErrorIs(t, err, auth.ErrEmailInUse)
+	mockQ.AssertNotCalled(t, "SetPendingEmailChange", mock.Anything, mock.Anything)
+}
+
+func TestConfirmEmailChange_RevokesSessions(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	token := "confirmtoken"
+	user := database.User{
+		ID:                5,
+		EmailChangeExpiry: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+	}
+
+	mockQ.On("GetUserByEmailChangeToken", ctx, sql.NullString{String: util.HashToken(token), Valid: true}).Return(user, nil)
+	mockQ.On("ApplyEmailChange", ctx, int32(5)).Return(int64(1), nil)
+	mockQ.On("RevokeUserRefreshTokens", ctx, int32(5)).Return(int64(2), nil)
+
+	err := svc.ConfirmEmailChange(ctx, token)
+	assert.NoError(t, err)
+	mockQ.AssertExpectations(t)
+}
+
+func TestConfirmEmailChange_OldAccessTokenRefused(t *testing.T) {
+	before := database.User{ID: 5, Email: "old@example.com"}
+	oldAccess, _, err := util.GenerateJWTTokens(before.ID, before.Email, before.TokenVersion, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	// RevokeUserRefreshTokens bumped the version when the change was confirmed
+	after := database.User{ID: 5, Email: "new@example.com", TokenVersion: before.TokenVersion + 1}
+	mockUserSvc := new(MockUserService)
+	mockUserSvc.On("GetUserByID", mock.Anything, int32(5)).Return(after, nil)
+	svc := auth.NewService(new(MockAuthQueries), mockUserSvc)
+
+	claims, err := util.VerifyAccessToken(oldAccess)
+	assert.NoError(t, err)
+	assert.Error(t, svc.CheckSession(context.Background(), 5, int32(claims["ver"].(float64))))
+}
+
+func TestConfirmEmailChange_Expired(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	token := "confirmtoken"
+	user := database.User{
+		ID:                5,
+		EmailChangeExpiry: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+	}
+
+	mockQ.On("GetUserByEmailChangeToken", ctx, sql.NullString{String: util.HashToken(token), Valid: true}).Return(user, nil)
+
+	err := svc.ConfirmEmailChange(ctx, token)
+	assert.EqualError(t, err, "token has expired")
+	mockQ.AssertNotCalled(t, "ApplyEmailChange", mock.Anything, mock.Anything)
+}
+
+func TestCancelEmailChange_Success(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	token := "canceltoken"
+
+	mockQ.On("GetUserByEmailChangeCancelToken", ctx, sql.NullString{String: util.HashToken(token), Valid: true}).Return(database.User{ID: 5}, nil)
+	mockQ.On("ClearEmailChange", ctx, int32(5)).Return(int64(1), nil)
+
+	err := svc.CancelEmailChange(ctx, token)
+	assert.NoError(t, err)
+	mockQ.AssertExpectations(t)
+}
+
+func TestRequestPasswordReset_ReplacesEarlierTokens(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	mockUserSvc.On("GetUserByEmail", ctx, "a@example.com").Return(database.User{ID: 5, Email: "a@example.com"}, nil)
+	mockQ.On("DeleteUserPasswordResets", ctx, int32(5)).Return(int64(1), nil)
+	var stored database.CreatePasswordResetParams
+	mockQ.On("CreatePasswordReset", ctx, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(database.CreatePasswordResetParams)
+	}).Return(nil)
+
+	user, token, err := svc.RequestPasswordReset(ctx, "a@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), user.ID)
+	assert.Equal(t, util.HashToken(token), stored.TokenHash)
+	assert.Equal(t, int32(5), stored.UserID)
+	mockQ.AssertExpectations(t)
+}
+
+func TestResetPassword_RevokesSessions(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	mockQ.On("RedeemPasswordReset", ctx, util.HashToken("resettoken")).
+		Return(database.RedeemPasswordResetRow{UserID: 5, ExpiresAt: time.Now().Add(time.Minute)}, nil)
+	mockUserSvc.On("UpdateUserPassword", ctx, int32(5), "newpassword").Return(nil)
+	mockQ.On("RevokeUserRefreshTokens", ctx, int32(5)).Return(int64(2), nil)
+	mockQ.On("ResetFailedLogins", ctx, int32(5)).Return(int64(1), nil)
+
+	err := svc.ResetPassword(ctx, "resettoken", "newpassword")
+	assert.NoError(t, err)
+	mockQ.AssertExpectations(t)
+	mockUserSvc.AssertExpectations(t)
+}
+
+func TestResetPassword_ExpiredOrUsed(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUserSvc := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUserSvc)
+
+	ctx := context.Background()
+	mockQ.On("RedeemPasswordReset", ctx, util.HashToken("stale")).
+		Return(database.RedeemPasswordResetRow{UserID: 5, ExpiresAt: time.Now().Add(-time.Minute)}, nil)
+	mockQ.On("RedeemPasswordReset", ctx, util.HashToken("used")).
+		Return(database.RedeemPasswordResetRow{}, sql.ErrNoRows)
+
+	assert.ErrorIs(t, svc.ResetPassword(ctx, "stale", "newpassword"), auth.ErrInvalidResetToken)
+	assert.ErrorIs(t, svc.ResetPassword(ctx, "used", "newpassword"), auth.ErrInvalidResetToken)
+	mockUserSvc.AssertNotCalled(t, "UpdateUserPassword", mock.Anything, mock.Anything, mock.Anything)
+}
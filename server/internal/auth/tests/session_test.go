@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/auth"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// serveWithToken runs a request carrying an access token issued while the
+// user looked like issuedAs, against the user as they are now.
+func serveWithToken(t *testing.T, issuedAs, now database.User, useRefresh bool) int {
+	t.Helper()
+	mockUserSvc := new(MockUserService)
+	mockUserSvc.On("GetUserByID", mock.Anything, now.ID).Return(now, nil)
+	svc := auth.NewService(new(MockAuthQueries), mockUserSvc)
+
+	access, refresh, err := util.GenerateJWTTokens(issuedAs.ID, issuedAs.Email, issuedAs.TokenVersion, time.Now().Add(30*24*time.Hour))
+	require.NoError(t, err)
+	token := access
+	if useRefresh {
+		token = refresh
+	}
+
+	handler := middleware.AuthMiddleware(util.VerifyAccessToken, svc.CheckSession)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/files", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestCheckSession_ActiveUser(t *testing.T) {
+	u := database.User{ID: 1, Email: "user@example.com", TokenVersion: 3}
+
+	assert.Equal(t, http.StatusOK, serveWithToken(t, u, u, false))
+}
+
+func TestCheckSession_DisabledUsersTokenRefused(t *testing.T) {
+	u := database.User{ID: 1, Email: "user@example.com"}
+	disabled := u
+	disabled.IsDisabled = true
+
+	assert.Equal(t, http.StatusUnauthorized, serveWithToken(t, u, disabled, false))
+}
+
+func TestCheckSession_RevokedSessionRefused(t *testing.T) {
+	u := database.User{ID: 1, Email: "user@example.com"}
+	loggedOut := u
+	loggedOut.TokenVersion = 1
+
+	assert.Equal(t, http.StatusUnauthorized, serveWithToken(t, u, loggedOut, false))
+}
+
+func TestCheckSession_RefreshTokenIsNotAnAccessToken(t *testing.T) {
+	u := database.User{ID: 1, Email: "user@example.com"}
+
+	assert.Equal(t, http.StatusUnauthorized, serveWithToken(t, u, u, true))
+}
+
+func TestCheckSession_UnknownUser(t *testing.T) {
+	mockUserSvc := new(MockUserService)
+	mockUserSvc.On("GetUserByID", mock.Anything, int32(7)).Return(database.User{}, sql.ErrNoRows)
+	svc := auth.NewService(new(MockAuthQueries), mockUserSvc)
+
+	assert.Error(t, svc.CheckSession(context.Background(), 7, 0))
+}
@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/auth"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreatePersonalToken_StoresOnlyHash(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	svc := auth.NewService(mockQ, new(MockUserService))
+	ctx := context.Background()
+
+	var stored database.CreatePersonalTokenParams
+	mockQ.On("ListPersonalTokens", ctx, int32(1)).Return([]database.PersonalToken{}, nil)
+	mockQ.On("CreatePersonalToken", ctx, mock.Anything).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(database.CreatePersonalTokenParams) }).
+		Return(database.PersonalToken{ID: uuid.New(), UserID: 1, Name: "laptop"}, nil)
+
+	row, token, err := svc.CreatePersonalToken(ctx, 1, " laptop ", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "laptop", row.Name)
+	assert.True(t, strings.HasPrefix(token, auth.PersonalTokenPrefix))
+	assert.Equal(t, "laptop", stored.Name)
+	assert.Equal(t, util.HashToken(token), stored.TokenHash)
+	assert.NotContains(t, stored.TokenHash, token)
+}
+
+func TestCreatePersonalToken_Limit(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	svc := auth.NewService(mockQ, new(MockUserService))
+	ctx := context.Background()
+
+	mockQ.On("ListPersonalTokens", ctx, int32(1)).Return(make([]database.PersonalToken, auth.MaxPersonalTokens), nil)
+
+	_, _, err := svc.CreatePersonalToken(ctx, 1, "one more", nil)
+
+	assert.ErrorIs(t, err, auth.ErrTokenLimit)
+	mockQ.AssertNotCalled(t, "CreatePersonalToken", mock.Anything, mock.Anything)
+}
+
+func TestAuthenticateBasic_PersonalToken(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUsers := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUsers)
+	ctx := context.Background()
+	token := auth.PersonalTokenPrefix + "secret"
+	tokenID := uuid.New()
+
+	mockUsers.On("GetUserByEmail", ctx, "a@example.com").Return(database.User{ID: 1, Email: "a@example.com"}, nil)
+	mockQ.On("GetPersonalTokenByHash", ctx, util.HashToken(token)).Return(database.PersonalToken{ID: tokenID, UserID: 1}, nil)
+	mockQ.On("TouchPersonalToken", ctx, tokenID).Return(int64(1), nil)
+
+	user, err := svc.AuthenticateBasic(ctx, "a@example.com", token)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), user.ID)
+	mockQ.AssertNotCalled(t, "IncrementFailedLogins", mock.Anything, mock.Anything)
+}
+
+func TestAuthenticateBasic_TokenOfAnotherUser(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUsers := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUsers)
+	ctx := context.Background()
+	token := auth.PersonalTokenPrefix + "secret"
+
+	mockUsers.On("GetUserByEmail", ctx, "a@example.com").Return(database.User{ID: 1}, nil)
+	mockQ.On("GetPersonalTokenByHash", ctx, util.HashToken(token)).Return(database.PersonalToken{ID: uuid.New(), UserID: 2}, nil)
+
+	_, err := svc.AuthenticateBasic(ctx, "a@example.com", token)
+
+	assert.ErrorIs(t, err, auth.ErrBadCredentials)
+}
+
+func TestAuthenticateBasic_ExpiredToken(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUsers := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUsers)
+	ctx := context.Background()
+	token := auth.PersonalTokenPrefix + "secret"
+
+	mockUsers.On("GetUserByEmail", ctx, "a@example.com").Return(database.User{ID: 1}, nil)
+	mockQ.On("GetPersonalTokenByHash", ctx, util.HashToken(token)).Return(database.PersonalToken{
+		ID: uuid.New(), UserID: 1, ExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	}, nil)
+
+	_, err := svc.AuthenticateBasic(ctx, "a@example.com", token)
+
+	assert.ErrorIs(t, err, auth.ErrBadCredentials)
+}
+
+func TestAuthenticateBasic_Password(t *testing.T) {
+	mockQ := new(MockAuthQueries)
+	mockUsers := new(MockUserService)
+	svc := auth.NewService(mockQ, mockUsers)
+	ctx := context.Background()
+	hash, _ := util.HashPassword("hunter22")
+
+	mockUsers.On("GetUserByEmail", ctx, "a@example.com").Return(database.User{ID: 1, PasswordHash: hash}, nil)
+
+	user, err := svc.AuthenticateBasic(ctx, "a@example.com", "hunter22")
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), user.ID)
+	mockQ.AssertNotCalled(t, "GetPersonalTokenByHash", mock.Anything, mock.Anything)
+}
+
+func TestCreatePersonalTokenHandler_ReturnsTokenOnce(t *testing.T) {
+	mockSvc := new(MockService)
+	row := database.PersonalToken{ID: uuid.New(), Name: "laptop", CreatedAt: time.Now()}
+	mockSvc.On("CreatePersonalToken", mock.Anything, int32(1), "laptop", (*time.Time)(nil)).Return(row, "cspt_abc", nil)
+	mockSvc.On("ListPersonalTokens", mock.Anything, int32(1)).Return([]database.PersonalToken{row}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/users/me/tokens", bytes.NewBufferString(`{"name":"laptop"}`))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(1)))
+	rec := httptest.NewRecorder()
+	auth.CreatePersonalTokenHandler(mockSvc).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"token":"cspt_abc"`)
+
+	req = httptest.NewRequest(http.MethodGet, "/users/me/tokens", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(1)))
+	rec = httptest.NewRecorder()
+	auth.ListPersonalTokensHandler(mockSvc).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"laptop"`)
+	assert.NotContains(t, rec.Body.String(), "cspt_abc")
+}
+
+func TestRevokePersonalTokenHandler_NotFound(t *testing.T) {
+	mockSvc := new(MockService)
+	id := uuid.New()
+	mockSvc.On("RevokePersonalToken", mock.Anything, int32(1), id).Return(auth.ErrTokenNotFound)
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/me/tokens/"+id.String(), nil)
+	req.SetPathValue("id", id.String())
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(1)))
+	rec := httptest.NewRecorder()
+	auth.RevokePersonalTokenHandler(mockSvc).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
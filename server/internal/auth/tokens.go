@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+)
+
+// PersonalTokenPrefix marks personal tokens, so a Basic auth password can be
+// told apart from one without a database lookup.
+const PersonalTokenPrefix = "cspt_"
+
+// MaxPersonalTokens bounds how many tokens one user may hold.
+const MaxPersonalTokens = 50
+
+var (
+	ErrTokenNotFound  = errors.New("token not found")
+	ErrTokenLimit     = errors.New("too many personal tokens")
+	ErrTokenNameEmpty = errors.New("token name is required")
+	ErrBadCredentials = errors.New("invalid credentials")
+)
+
+// CreatePersonalToken issues a new token, returning its record and the token
+// itself, which is not stored and can't be shown again.
+func (s *Service) CreatePersonalToken(ctx context.Context, userID int32, name string, expiresAt *time.Time) (database.PersonalToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return database.PersonalToken{}, "", ErrTokenNameEmpty
+	}
+
+	existing, err := s.queries.ListPersonalTokens(ctx, userID)
+	if err != nil {
+		return database.PersonalToken{}, "", fmt.Errorf("listing tokens: %w", err)
+	}
+	if len(existing) >= MaxPersonalTokens {
+		return database.PersonalToken{}, "", ErrTokenLimit
+	}
+
+	secret, err := util.GenerateVerificationToken()
+	if err != nil {
+		return database.PersonalToken{}, "", err
+	}
+	token := PersonalTokenPrefix + secret
+
+	var expiry sql.NullTime
+	if expiresAt != nil {
+		expiry = sql.NullTime{Time: *expiresAt, Valid: true}
+	}
+	row, err := s.queries.CreatePersonalToken(ctx, database.CreatePersonalTokenParams{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: util.HashToken(token),
+		ExpiresAt: expiry,
+	})
+	if err != nil {
+		return database.PersonalToken{}, "", fmt.Errorf("creating token: %w", err)
+	}
+	return row, token, nil
+}
+
+func (s *Service) ListPersonalTokens(ctx context.Context, userID int32) ([]database.PersonalToken, error) {
+	return s.queries.ListPersonalTokens(ctx, userID)
+}
+
+func (s *Service) RevokePersonalToken(ctx context.Context, userID int32, id uuid.UUID) error {
+	rows, err := s.queries.DeletePersonalToken(ctx, database.DeletePersonalTokenParams{ID: id, UserID: userID})
+	if err != nil {
+		return fmt.Errorf("deleting token: %w", err)
+	}
+	if rows == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// AuthenticateBasic checks the credentials of clients that can only send a
+// user name and password. The password may be the account password, which
+// counts towards the lockout like a normal login, or a personal token.
+func (s *Service) AuthenticateBasic(ctx context.Context, email, password string) (database.User, error) {
+	if !strings.HasPrefix(password, PersonalTokenPrefix) {
+		return s.AuthenticateUser(ctx, email, password)
+	}
+
+	user, err := s.userService.GetUserByEmail(ctx, email)
+	if err != nil {
+		return database.User{}, ErrBadCredentials
+	}
+	token, err := s.queries.GetPersonalTokenByHash(ctx, util.HashToken(password))
+	if err != nil || token.UserID != user.ID {
+		return database.User{}, ErrBadCredentials
+	}
+	if token.ExpiresAt.Valid && token.ExpiresAt.Time.Before(time.Now()) {
+		return database.User{}, ErrBadCredentials
+	}
+	if user.IsDisabled {
+		return database.User{}, errors.New("account is disabled")
+	}
+
+	if _, err := s.queries.TouchPersonalToken(ctx, token.ID); err != nil {
+		log.Printf("recording use of token %s: %v", token.ID, err)
+	}
+	return user, nil
+}
@@ -0,0 +1,167 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/conflict"
+	"github.com/bellezhang119/cloud-storage/internal/content"
+	"github.com/bellezhang119/cloud-storage/internal/file"
+	"github.com/bellezhang119/cloud-storage/internal/folder"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/bellezhang119/cloud-storage/internal/tag"
+	"github.com/bellezhang119/cloud-storage/internal/trash"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+)
+
+// All handlers here must be mounted behind AuthMiddleware.
+
+type ServiceInterface interface {
+	Run(ctx context.Context, userID int32, req Request) ([]Outcome, error)
+	Download(ctx context.Context, userID int32, files, folders []uuid.UUID, w io.Writer) error
+}
+
+// ItemResult reports one item of a batch with the status a single request
+// for it would have got.
+type ItemResult struct {
+	Kind   string     `json:"kind"`
+	ID     uuid.UUID  `json:"id"`
+	Status int        `json:"status"`
+	Error  string     `json:"error,omitempty"`
+	NewID  *uuid.UUID `json:"new_id,omitempty"`
+	JobID  *uuid.UUID `json:"job_id,omitempty"`
+}
+
+type BatchResponse struct {
+	Results   []ItemResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+}
+
+type DownloadRequest struct {
+	Files   []uuid.UUID `json:"files"`
+	Folders []uuid.UUID `json:"folders"`
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, file.ErrNotFound),
+		errors.Is(err, folder.ErrNotFound), errors.Is(err, trash.ErrNotFound),
+		errors.Is(err, tag.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, conflict.ErrExists), errors.Is(err, trash.ErrAlreadyTrashed),
+		errors.Is(err, trash.ErrNotTrashed), errors.Is(err, trash.ErrParentTrashed):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidAction), errors.Is(err, ErrEmptySelection),
+		errors.Is(err, ErrTooManyItems), errors.Is(err, folder.ErrInvalidDestination),
+		errors.Is(err, conflict.ErrInvalidStrategy), errors.Is(err, tag.ErrInvalidTag):
+		return http.StatusBadRequest
+	case errors.Is(err, quota.ErrExceeded):
+		return http.StatusInsufficientStorage
+	}
+	return http.StatusInternalServerError
+}
+
+// BatchHandler applies one action to many items. The response is 200 when
+// every item succeeded and 207 when some failed; either way each item has
+// its own status.
+func BatchHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		outcomes, err := service.Run(r.Context(), userID, req)
+		if err != nil {
+			util.RespondWithError(w, errorStatus(err), err.Error())
+			return
+		}
+
+		res := BatchResponse{Results: make([]ItemResult, 0, len(outcomes))}
+		for _, o := range outcomes {
+			item := ItemResult{Kind: o.Kind, ID: o.ID, Status: http.StatusOK, NewID: o.NewID, JobID: o.JobID}
+			switch {
+			case o.Err != nil:
+				item.Status = errorStatus(o.Err)
+				item.Error = o.Err.Error()
+				res.Failed++
+			case o.JobID != nil:
+				item.Status = http.StatusAccepted
+				res.Succeeded++
+			default:
+				res.Succeeded++
+			}
+			res.Results = append(res.Results, item)
+		}
+
+		status := http.StatusOK
+		if res.Failed > 0 {
+			status = http.StatusMultiStatus
+		}
+		util.RespondWithJSON(w, status, res)
+	}
+}
+
+// zipWriter sets the download headers on the first write, so an error
+// raised before any data is produced can still be sent as JSON.
+type zipWriter struct {
+	w        http.ResponseWriter
+	filename string
+	started  bool
+}
+
+func (z *zipWriter) Write(p []byte) (int, error) {
+	if !z.started {
+		z.w.Header().Set("Content-Type", "application/zip")
+		z.w.Header().Set("Content-Disposition", content.Disposition(content.DispositionAttachment, z.filename))
+		content.SetSafetyHeaders(z.w.Header())
+		z.started = true
+	}
+	return z.w.Write(p)
+}
+
+// DownloadHandler streams the selected files and folders as one zip.
+func DownloadHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req DownloadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		zw := &zipWriter{
+			w:        w,
+			filename: fmt.Sprintf("download-%s.zip", time.Now().UTC().Format("2006-01-02")),
+		}
+		if err := service.Download(r.Context(), userID, req.Files, req.Folders, zw); err != nil {
+			if !zw.started {
+				util.RespondWithError(w, errorStatus(err), err.Error())
+				return
+			}
+			// Part of the archive is already out; all we can do is log
+			log.Printf("batch download for user %d: %v", userID, err)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package batch
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bellezhang119/cloud-storage/internal/archive"
+	"github.com/bellezhang119/cloud-storage/internal/conflict"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/tag"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	ActionMove    = "move"
+	ActionDelete  = "delete"
+	ActionTrash   = "trash"
+	ActionRestore = "restore"
+	ActionCopy    = "copy"
+	ActionTag     = "tag"
+	ActionUntag   = "untag"
+)
+
+const (
+	KindFile   = "file"
+	KindFolder = "folder"
+)
+
+// MaxItems caps how many files and folders one batch can name.
+const MaxItems = 1000
+
+var (
+	ErrNotFound       = errors.New("item not found")
+	ErrInvalidAction  = errors.New("invalid action")
+	ErrEmptySelection = errors.New("no files or folders selected")
+	ErrTooManyItems   = fmt.Errorf("at most %d items can be selected", MaxItems)
+)
+
+type FileService interface {
+	GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error)
+	MoveFile(ctx context.Context, file database.File, destFolderID *uuid.UUID, userID int32) error
+	DeleteFile(ctx context.Context, fileID uuid.UUID, userID int32) error
+	CopyFile(ctx context.Context, fileID uuid.UUID, destFolderID *uuid.UUID, userID int32, onConflict string) (database.File, error)
+}
+
+type FolderService interface {
+	GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error)
+	ArchiveFolder(ctx context.Context, folderID uuid.UUID, userID int32) (database.Folder, []archive.TreeEntry, error)
+	MoveFolder(ctx context.Context, folderID uuid.UUID, newParentID uuid.NullUUID, userID int32) error
+	DeleteFolder(ctx context.Context, folderID uuid.UUID, userID int32) error
+	StartCopyFolder(ctx context.Context, folderID uuid.UUID, dest uuid.NullUUID, userID int32, onConflict string) (*database.Folder, *database.Job, error)
+}
+
+type TrashService interface {
+	TrashFile(ctx context.Context, userID int32, id uuid.UUID) error
+	RestoreFile(ctx context.Context, userID int32, id uuid.UUID) error
+	TrashFolder(ctx context.Context, userID int32, id uuid.UUID) error
+	RestoreFolder(ctx context.Context, userID int32, id uuid.UUID) error
+}
+
+type TagService interface {
+	Apply(ctx context.Context, userID int32, names []string, sel tag.Selection) (int64, error)
+	Remove(ctx context.Context, userID int32, names []string, sel tag.Selection) (int64, error)
+}
+
+type FileReader interface {
+	ReadFile(userID int32, path string) (io.ReadCloser, error)
+}
+
+// Request is one action applied to every selected item.
+type Request struct {
+	Action  string      `json:"action"`
+	Files   []uuid.UUID `json:"files"`
+	Folders []uuid.UUID `json:"folders"`
+	// Where move and copy put things; null or omitted is the root
+	DestinationID *uuid.UUID `json:"destination_id"`
+	// Name clash handling for copy, as for single copies
+	OnConflict string `json:"on_conflict"`
+	// Tag names for tag and untag
+	Tags []string `json:"tags"`
+}
+
+// Outcome is what happened to one item. Err is nil on success.
+type Outcome struct {
+	Kind string
+	ID   uuid.UUID
+	Err  error
+	// Set by copy: the new item, or the job copying a large folder
+	NewID *uuid.UUID
+	JobID *uuid.UUID
+}
+
+// Service applies one action to many items. Items are handled one by one and
+// a failure only affects its own item; files go first, so deleting a folder
+// along with some of its files works.
+type Service struct {
+	files   FileService
+	folders FolderService
+	trash   TrashService
+	tags    TagService
+	storage FileReader
+}
+
+func NewService(files FileService, folders FolderService, trash TrashService, tags TagService, storage FileReader) *Service {
+	return &Service{files: files, folders: folders, trash: trash, tags: tags, storage: storage}
+}
+
+// dedupe drops repeated ids, keeping the first.
+func dedupe(ids []uuid.UUID) []uuid.UUID {
+	seen := map[uuid.UUID]bool{}
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func checkSelection(files, folders []uuid.UUID) error {
+	n := len(files) + len(folders)
+	if n == 0 {
+		return ErrEmptySelection
+	}
+	if n > MaxItems {
+		return ErrTooManyItems
+	}
+	return nil
+}
+
+// Run validates the request as a whole and then applies it item by item. An
+// error is only returned when nothing was attempted.
+func (s *Service) Run(ctx context.Context, userID int32, req Request) ([]Outcome, error) {
+	files, folders := dedupe(req.Files), dedupe(req.Folders)
+	if err := checkSelection(files, folders); err != nil {
+		return nil, err
+	}
+
+	switch req.Action {
+	case ActionCopy:
+		if _, err := conflict.Parse(req.OnConflict); err != nil {
+			return nil, err
+		}
+	case ActionTag, ActionUntag:
+		if len(req.Tags) == 0 {
+			return nil, fmt.Errorf("%w: no tags given", tag.ErrInvalidTag)
+		}
+		for _, name := range req.Tags {
+			if _, err := tag.NormalizeName(name); err != nil {
+				return nil, err
+			}
+		}
+	case ActionMove, ActionDelete, ActionTrash, ActionRestore:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAction, req.Action)
+	}
+
+	outcomes := make([]Outcome, 0, len(files)+len(folders))
+	for _, id := range files {
+		out := Outcome{Kind: KindFile, ID: id}
+		out.Err = s.runFile(ctx, userID, req, &out)
+		outcomes = append(outcomes, out)
+	}
+	for _, id := range folders {
+		out := Outcome{Kind: KindFolder, ID: id}
+		out.Err = s.runFolder(ctx, userID, req, &out)
+		outcomes = append(outcomes, out)
+	}
+	return outcomes, nil
+}
+
+func (s *Service) ownedFile(ctx context.Context, userID int32, id uuid.UUID) (database.File, error) {
+	f, err := s.files.GetFileByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.File{}, ErrNotFound
+		}
+		return database.File{}, fmt.Errorf("fetching file: %w", err)
+	}
+	if f.UserID.Int32 != userID {
+		return database.File{}, ErrNotFound
+	}
+	return f, nil
+}
+
+func (s *Service) ownedFolder(ctx context.Context, userID int32, id uuid.UUID) (database.Folder, error) {
+	f, err := s.folders.GetFolderByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Folder{}, ErrNotFound
+		}
+		return database.Folder{}, fmt.Errorf("fetching folder: %w", err)
+	}
+	if f.UserID.Int32 != userID {
+		return database.Folder{}, ErrNotFound
+	}
+	return f, nil
+}
+
+// uniqueViolation turns a clash on a (parent, name) constraint into
+// conflict.ErrExists.
+func uniqueViolation(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return fmt.Errorf("%w: %v", conflict.ErrExists, err)
+	}
+	return err
+}
+
+func (s *Service) runFile(ctx context.Context, userID int32, req Request, out *Outcome) error {
+	f, err := s.ownedFile(ctx, userID, out.ID)
+	if err != nil {
+		return err
+	}
+
+	switch req.Action {
+	case ActionMove:
+		return uniqueViolation(s.files.MoveFile(ctx, f, req.DestinationID, userID))
+	case ActionDelete:
+		return s.files.DeleteFile(ctx, f.ID, userID)
+	case ActionTrash:
+		return s.trash.TrashFile(ctx, userID, f.ID)
+	case ActionRestore:
+		return s.trash.RestoreFile(ctx, userID, f.ID)
+	case ActionCopy:
+		copied, err := s.files.CopyFile(ctx, f.ID, req.DestinationID, userID, req.OnConflict)
+		if err != nil {
+			return err
+		}
+		out.NewID = &copied.ID
+		return nil
+	case ActionTag:
+		_, err := s.tags.Apply(ctx, userID, req.Tags, tag.Selection{Files: []uuid.UUID{f.ID}})
+		return err
+	case ActionUntag:
+		_, err := s.tags.Remove(ctx, userID, req.Tags, tag.Selection{Files: []uuid.UUID{f.ID}})
+		return err
+	}
+	return ErrInvalidAction
+}
+
+func (s *Service) runFolder(ctx context.Context, userID int32, req Request, out *Outcome) error {
+	f, err := s.ownedFolder(ctx, userID, out.ID)
+	if err != nil {
+		return err
+	}
+
+	var dest uuid.NullUUID
+	if req.DestinationID != nil {
+		dest = uuid.NullUUID{UUID: *req.DestinationID, Valid: true}
+	}
+
+	switch req.Action {
+	case ActionMove:
+		return uniqueViolation(s.folders.MoveFolder(ctx, f.ID, dest, userID))
+	case ActionDelete:
+		return s.folders.DeleteFolder(ctx, f.ID, userID)
+	case ActionTrash:
+		return s.trash.TrashFolder(ctx, userID, f.ID)
+	case ActionRestore:
+		return s.trash.RestoreFolder(ctx, userID, f.ID)
+	case ActionCopy:
+		copied, job, err := s.folders.StartCopyFolder(ctx, f.ID, dest, userID, req.OnConflict)
+		if err != nil {
+			return err
+		}
+		if job != nil {
+			out.JobID = &job.ID
+		} else {
+			out.NewID = &copied.ID
+		}
+		return nil
+	case ActionTag:
+		_, err := s.tags.Apply(ctx, userID, req.Tags, tag.Selection{Folders: []uuid.UUID{f.ID}})
+		return err
+	case ActionUntag:
+		_, err := s.tags.Remove(ctx, userID, req.Tags, tag.Selection{Folders: []uuid.UUID{f.ID}})
+		return err
+	}
+	return ErrInvalidAction
+}
+
+// Download streams the selected files and folders into one zip. Every item
+// is checked before anything is written, so a bad id fails the request
+// instead of truncating the archive. As with folder downloads the contents
+// come from the database, so trashed items stay out; each item sits at the
+// top under its own name, and when two share a name the later one becomes
+// "name (2)".
+func (s *Service) Download(ctx context.Context, userID int32, files, folders []uuid.UUID, w io.Writer) error {
+	files, folders = dedupe(files), dedupe(folders)
+	if err := checkSelection(files, folders); err != nil {
+		return err
+	}
+
+	// The manifest is at the top too
+	used := map[string]bool{archive.ManifestName: true}
+	topName := func(name string, isFile bool) string {
+		free := name
+		for n := 2; used[free]; n++ {
+			free = conflict.Candidate(name, n, isFile)
+		}
+		used[free] = true
+		return free
+	}
+
+	var entries []archive.TreeEntry
+	for _, id := range files {
+		f, err := s.ownedFile(ctx, userID, id)
+		if err == nil && f.TrashedAt.Valid {
+			err = ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("file %s: %w", id, err)
+		}
+		filePath := f.FilePath
+		entries = append(entries, archive.TreeEntry{
+			Path:     topName(f.Name, true),
+			Size:     f.SizeBytes,
+			ModTime:  archive.ModTime(f.UpdatedAt, f.CreatedAt),
+			SHA256:   f.Sha256.String,
+			MimeType: f.MimeType.String,
+			Open: func() (io.ReadCloser, error) {
+				return s.storage.ReadFile(userID, filePath)
+			},
+		})
+	}
+	for _, id := range folders {
+		src, tree, err := s.folders.ArchiveFolder(ctx, id, userID)
+		if err == nil && src.TrashedAt.Valid {
+			err = ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("folder %s: %w", id, err)
+		}
+		// Entries start with the folder's name, which may have to change
+		name := topName(src.Name, false)
+		for _, e := range tree {
+			e.Path = name + strings.TrimPrefix(e.Path, src.Name)
+			entries = append(entries, e)
+		}
+	}
+
+	opts := archive.WriteOptions{Format: archive.FormatZip, Level: archive.DefaultLevel}
+	if err := archive.Write(w, opts, entries); err != nil {
+		return fmt.Errorf("zipping selection: %w", err)
+	}
+	return nil
+}
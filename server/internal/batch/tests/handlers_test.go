@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/batch"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/trash"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) Run(ctx context.Context, userID int32, req batch.Request) ([]batch.Outcome, error) {
+	args := m.Called(ctx, userID, req)
+	outcomes, _ := args.Get(0).([]batch.Outcome)
+	return outcomes, args.Error(1)
+}
+
+func (m *MockService) Download(ctx context.Context, userID int32, files, folders []uuid.UUID, w io.Writer) error {
+	args := m.Called(ctx, userID, files, folders, w)
+	if fn, ok := args.Get(1).(func(io.Writer)); ok {
+		fn(w)
+	}
+	return args.Error(0)
+}
+
+func asUser(req *http.Request, userID int32) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), userID))
+}
+
+func TestBatchHandler_PartialFailure(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := batch.BatchHandler(mockSvc)
+	okID, badID := uuid.New(), uuid.New()
+
+	mockSvc.On("Run", mock.Anything, int32(1), mock.MatchedBy(func(req batch.Request) bool {
+		return req.Action == batch.ActionTrash
+	})).Return([]batch.Outcome{
+		{Kind: batch.KindFile, ID: okID},
+		{Kind: batch.KindFile, ID: badID, Err: trash.ErrAlreadyTrashed},
+	}, nil)
+
+	body := `{"action":"trash","files":["` + okID.String() + `","` + badID.String() + `"]}`
+	req := asUser(httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)), 1)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusMultiStatus, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"succeeded":1`)
+	assert.Contains(t, rec.Body.String(), `"failed":1`)
+	assert.Contains(t, rec.Body.String(), `"status":409`)
+}
+
+func TestBatchHandler_InvalidAction(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := batch.BatchHandler(mockSvc)
+
+	mockSvc.On("Run", mock.Anything, int32(1), mock.Anything).Return(nil, batch.ErrInvalidAction)
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(`{"action":"explode"}`)), 1)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestDownloadHandler_ErrorBeforeStreaming(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := batch.DownloadHandler(mockSvc)
+	id := uuid.New()
+
+	mockSvc.On("Download", mock.Anything, int32(1), []uuid.UUID{id}, []uuid.UUID(nil), mock.Anything).
+		Return(batch.ErrNotFound, nil)
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/batch/download", strings.NewReader(`{"files":["`+id.String()+`"]}`)), 1)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+}
+
+func TestDownloadHandler_StreamsZip(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := batch.DownloadHandler(mockSvc)
+	id := uuid.New()
+
+	mockSvc.On("Download", mock.Anything, int32(1), []uuid.UUID(nil), []uuid.UUID{id}, mock.Anything).
+		Return(nil, func(w io.Writer) { _, _ = w.Write([]byte("PK")) })
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/batch/download", strings.NewReader(`{"folders":["`+id.String()+`"]}`)), 1)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), "attachment")
+	assert.Equal(t, "PK", rec.Body.String())
+}
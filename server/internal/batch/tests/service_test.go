@@ -0,0 +1,279 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/archive"
+	"github.com/bellezhang119/cloud-storage/internal/batch"
+	"github.com/bellezhang119/cloud-storage/internal/conflict"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/tag"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockFileService struct {
+	mock.Mock
+}
+
+func (m *MockFileService) GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockFileService) MoveFile(ctx context.Context, file database.File, destFolderID *uuid.UUID, userID int32) error {
+	return m.Called(ctx, file, destFolderID, userID).Error(0)
+}
+
+func (m *MockFileService) DeleteFile(ctx context.Context, fileID uuid.UUID, userID int32) error {
+	return m.Called(ctx, fileID, userID).Error(0)
+}
+
+func (m *MockFileService) CopyFile(ctx context.Context, fileID uuid.UUID, destFolderID *uuid.UUID, userID int32, onConflict string) (database.File, error) {
+	args := m.Called(ctx, fileID, destFolderID, userID, onConflict)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+type MockFolderService struct {
+	mock.Mock
+}
+
+func (m *MockFolderService) GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func (m *MockFolderService) ArchiveFolder(ctx context.Context, folderID uuid.UUID, userID int32) (database.Folder, []archive.TreeEntry, error) {
+	args := m.Called(ctx, folderID, userID)
+	entries, _ := args.Get(1).([]archive.TreeEntry)
+	return args.Get(0).(database.Folder), entries, args.Error(2)
+}
+
+func (m *MockFolderService) MoveFolder(ctx context.Context, folderID uuid.UUID, newParentID uuid.NullUUID, userID int32) error {
+	return m.Called(ctx, folderID, newParentID, userID).Error(0)
+}
+
+func (m *MockFolderService) DeleteFolder(ctx context.Context, folderID uuid.UUID, userID int32) error {
+	return m.Called(ctx, folderID, userID).Error(0)
+}
+
+func (m *MockFolderService) StartCopyFolder(ctx context.Context, folderID uuid.UUID, dest uuid.NullUUID, userID int32, onConflict string) (*database.Folder, *database.Job, error) {
+	args := m.Called(ctx, folderID, dest, userID, onConflict)
+	folder, _ := args.Get(0).(*database.Folder)
+	job, _ := args.Get(1).(*database.Job)
+	return folder, job, args.Error(2)
+}
+
+type MockTrashService struct {
+	mock.Mock
+}
+
+func (m *MockTrashService) TrashFile(ctx context.Context, userID int32, id uuid.UUID) error {
+	return m.Called(ctx, userID, id).Error(0)
+}
+
+func (m *MockTrashService) RestoreFile(ctx context.Context, userID int32, id uuid.UUID) error {
+	return m.Called(ctx, userID, id).Error(0)
+}
+
+func (m *MockTrashService) TrashFolder(ctx context.Context, userID int32, id uuid.UUID) error {
+	return m.Called(ctx, userID, id).Error(0)
+}
+
+func (m *MockTrashService) RestoreFolder(ctx context.Context, userID int32, id uuid.UUID) error {
+	return m.Called(ctx, userID, id).Error(0)
+}
+
+type MockTagService struct {
+	mock.Mock
+}
+
+func (m *MockTagService) Apply(ctx context.Context, userID int32, names []string, sel tag.Selection) (int64, error) {
+	args := m.Called(ctx, userID, names, sel)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockTagService) Remove(ctx context.Context, userID int32, names []string, sel tag.Selection) (int64, error) {
+	args := m.Called(ctx, userID, names, sel)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockStorage struct {
+	mock.Mock
+}
+
+func (m *MockStorage) ReadFile(userID int32, path string) (io.ReadCloser, error) {
+	args := m.Called(userID, path)
+	rc, _ := args.Get(0).(io.ReadCloser)
+	return rc, args.Error(1)
+}
+
+type mocks struct {
+	files   *MockFileService
+	folders *MockFolderService
+	trash   *MockTrashService
+	tags    *MockTagService
+	storage *MockStorage
+}
+
+func newService() (*batch.Service, mocks) {
+	m := mocks{
+		files:   new(MockFileService),
+		folders: new(MockFolderService),
+		trash:   new(MockTrashService),
+		tags:    new(MockTagService),
+		storage: new(MockStorage),
+	}
+	return batch.NewService(m.files, m.folders, m.trash, m.tags, m.storage), m
+}
+
+func owned(userID int32) sql.NullInt32 {
+	return sql.NullInt32{Int32: userID, Valid: true}
+}
+
+func TestRun_DeleteReportsEachItem(t *testing.T) {
+	svc, m := newService()
+	fileID, folderID, otherID := uuid.New(), uuid.New(), uuid.New()
+
+	m.files.On("GetFileByID", mock.Anything, fileID).Return(database.File{ID: fileID, UserID: owned(1)}, nil)
+	m.files.On("DeleteFile", mock.Anything, fileID, int32(1)).Return(nil)
+	m.folders.On("GetFolderByID", mock.Anything, folderID).Return(database.Folder{ID: folderID, UserID: owned(2)}, nil)
+	m.folders.On("GetFolderByID", mock.Anything, otherID).Return(database.Folder{}, sql.ErrNoRows)
+
+	outcomes, err := svc.Run(context.Background(), 1, batch.Request{
+		Action:  batch.ActionDelete,
+		Files:   []uuid.UUID{fileID, fileID},
+		Folders: []uuid.UUID{folderID, otherID},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, outcomes, 3)
+	assert.NoError(t, outcomes[0].Err)
+	assert.ErrorIs(t, outcomes[1].Err, batch.ErrNotFound)
+	assert.ErrorIs(t, outcomes[2].Err, batch.ErrNotFound)
+	m.files.AssertNumberOfCalls(t, "DeleteFile", 1)
+	m.folders.AssertNotCalled(t, "DeleteFolder", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRun_CopyFolderReturnsJobForLargeTrees(t *testing.T) {
+	svc, m := newService()
+	folderID, destID := uuid.New(), uuid.New()
+	job := &database.Job{ID: uuid.New()}
+
+	m.folders.On("GetFolderByID", mock.Anything, folderID).Return(database.Folder{ID: folderID, UserID: owned(1)}, nil)
+	m.folders.On("StartCopyFolder", mock.Anything, folderID, uuid.NullUUID{UUID: destID, Valid: true}, int32(1), "fail").
+		Return(nil, job, nil)
+
+	outcomes, err := svc.Run(context.Background(), 1, batch.Request{
+		Action:        batch.ActionCopy,
+		Folders:       []uuid.UUID{folderID},
+		DestinationID: &destID,
+		OnConflict:    "fail",
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, outcomes, 1)
+	assert.Equal(t, &job.ID, outcomes[0].JobID)
+	assert.Nil(t, outcomes[0].NewID)
+}
+
+func TestRun_TagGoesItemByItem(t *testing.T) {
+	svc, m := newService()
+	fileID := uuid.New()
+
+	m.files.On("GetFileByID", mock.Anything, fileID).Return(database.File{ID: fileID, UserID: owned(1)}, nil)
+	m.tags.On("Apply", mock.Anything, int32(1), []string{"work"}, tag.Selection{Files: []uuid.UUID{fileID}}).
+		Return(int64(1), nil)
+
+	outcomes, err := svc.Run(context.Background(), 1, batch.Request{
+		Action: batch.ActionTag,
+		Files:  []uuid.UUID{fileID},
+		Tags:   []string{"work"},
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, outcomes[0].Err)
+	m.tags.AssertExpectations(t)
+}
+
+func TestRun_RejectsBadRequests(t *testing.T) {
+	svc, _ := newService()
+	ids := []uuid.UUID{uuid.New()}
+
+	_, err := svc.Run(context.Background(), 1, batch.Request{Action: "explode", Files: ids})
+	assert.ErrorIs(t, err, batch.ErrInvalidAction)
+
+	_, err = svc.Run(context.Background(), 1, batch.Request{Action: batch.ActionDelete})
+	assert.ErrorIs(t, err, batch.ErrEmptySelection)
+
+	_, err = svc.Run(context.Background(), 1, batch.Request{Action: batch.ActionCopy, Files: ids, OnConflict: "merge"})
+	assert.ErrorIs(t, err, conflict.ErrInvalidStrategy)
+
+	_, err = svc.Run(context.Background(), 1, batch.Request{Action: batch.ActionTag, Files: ids})
+	assert.ErrorIs(t, err, tag.ErrInvalidTag)
+}
+
+// zipNames lists the entries of a zip, in order.
+func zipNames(t *testing.T, raw []byte) []string {
+	zr, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	require.NoError(t, err)
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestDownload_ZipsSelectionFromRecords(t *testing.T) {
+	svc, m := newService()
+	fileID, folderID := uuid.New(), uuid.New()
+	var buf bytes.Buffer
+
+	m.files.On("GetFileByID", mock.Anything, fileID).Return(database.File{ID: fileID, UserID: owned(1), Name: "photos", FilePath: "docs/photos"}, nil)
+	m.folders.On("ArchiveFolder", mock.Anything, folderID, int32(1)).Return(database.Folder{ID: folderID, Name: "photos"}, []archive.TreeEntry{
+		{Path: "photos", IsDir: true},
+		{Path: "photos/a.jpg", Size: 1, Open: func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader("a")), nil }},
+	}, nil)
+	m.storage.On("ReadFile", int32(1), "docs/photos").Return(io.NopCloser(strings.NewReader("file")), nil)
+
+	err := svc.Download(context.Background(), 1, []uuid.UUID{fileID}, []uuid.UUID{folderID}, &buf)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"photos", "photos (2)/", "photos (2)/a.jpg", archive.ManifestName}, zipNames(t, buf.Bytes()))
+	m.storage.AssertExpectations(t)
+}
+
+func TestDownload_TrashedItemFailsBeforeZipping(t *testing.T) {
+	svc, m := newService()
+	fileID := uuid.New()
+	var buf bytes.Buffer
+
+	m.files.On("GetFileByID", mock.Anything, fileID).Return(database.File{ID: fileID, UserID: owned(1), TrashedAt: sql.NullTime{Valid: true}}, nil)
+
+	err := svc.Download(context.Background(), 1, []uuid.UUID{fileID}, nil, &buf)
+
+	assert.ErrorIs(t, err, batch.ErrNotFound)
+	assert.Zero(t, buf.Len())
+}
+
+func TestDownload_ForeignItemFailsBeforeZipping(t *testing.T) {
+	svc, m := newService()
+	fileID := uuid.New()
+	var buf bytes.Buffer
+
+	m.files.On("GetFileByID", mock.Anything, fileID).Return(database.File{ID: fileID, UserID: owned(2)}, nil)
+
+	err := svc.Download(context.Background(), 1, []uuid.UUID{fileID}, nil, &buf)
+
+	assert.ErrorIs(t, err, batch.ErrNotFound)
+	assert.Zero(t, buf.Len())
+	m.storage.AssertNotCalled(t, "ReadFile", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,88 @@
+package changes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+)
+
+const (
+	defaultPageSize = 500
+	maxPageSize     = 2000
+)
+
+type ServiceInterface interface {
+	Changes(ctx context.Context, userID int32, after string, limit int32) (Delta, error)
+	Latest(ctx context.Context, userID int32) (string, error)
+}
+
+// ResetResponse tells a client its cursor can't be continued from. It
+// carries a fresh cursor to use once the client has listed the tree again.
+type ResetResponse struct {
+	Error         string `json:"error"`
+	ResetRequired bool   `json:"reset_required"`
+	Cursor        string `json:"cursor"`
+}
+
+func ChangesHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		q := r.URL.Query()
+		limit := int32(defaultPageSize)
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil || n <= 0 {
+				util.RespondWithError(w, http.StatusBadRequest, "Invalid limit")
+				return
+			}
+			limit = int32(min(n, maxPageSize))
+		}
+
+		delta, err := service.Changes(r.Context(), userID, q.Get("cursor"), limit)
+		switch {
+		case errors.Is(err, ErrInvalidCursor):
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, ErrResetRequired):
+			latest, err2 := service.Latest(r.Context(), userID)
+			if err2 != nil {
+				util.RespondWithError(w, http.StatusInternalServerError, "Failed to list changes")
+				return
+			}
+			util.RespondWithJSON(w, http.StatusGone, ResetResponse{Error: err.Error(), ResetRequired: true, Cursor: latest})
+			return
+		case err != nil:
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to list changes")
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, delta)
+	}
+}
+
+func LatestCursorHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		latest, err := service.Latest(r.Context(), userID)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to fetch cursor")
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{"cursor": latest})
+	}
+}
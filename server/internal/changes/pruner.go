@@ -0,0 +1,43 @@
+package changes
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const defaultPruneInterval = time.Hour
+
+type PruneQueries interface {
+	PruneChangeJournal(ctx context.Context, createdAt time.Time) (int64, error)
+}
+
+// Pruner drops journal entries older than the retention period. Cursors
+// from before the oldest remaining entry then get ErrResetRequired.
+type Pruner struct {
+	queries   PruneQueries
+	retention time.Duration
+	Interval  time.Duration
+}
+
+func NewPruner(q PruneQueries, retention time.Duration) *Pruner {
+	return &Pruner{queries: q, retention: retention, Interval: defaultPruneInterval}
+}
+
+// Run polls until ctx is cancelled.
+func (p *Pruner) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.queries.PruneChangeJournal(ctx, time.Now().Add(-p.retention)); err != nil {
+			log.Printf("pruning change journal: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package changes serves each user's change journal, so sync clients can
+// catch up with what changed since they last looked instead of rescanning
+// the tree. The journal itself is written by database triggers in the same
+// transaction as every change to files, folders and shares.
+package changes
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+// What happened to an item. Overwriting a file replaces it, so it shows up
+// as the delete of the old file and the create of a new one.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionMove   = "move"
+	ActionRename = "rename"
+	ActionDelete = "delete"
+	ActionShare  = "share"
+)
+
+// DefaultRetention is how long entries are kept. Clients that stay away
+// longer have to list the tree again.
+const DefaultRetention = 30 * 24 * time.Hour
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrResetRequired means the changes since the cursor are no longer all
+	// in the journal.
+	ErrResetRequired = errors.New("cursor is too old; list the tree again and continue from the latest cursor")
+)
+
+func RetentionFromEnv() time.Duration {
+	if v := os.Getenv("CHANGE_JOURNAL_RETENTION"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return DefaultRetention
+}
+
+type Queries interface {
+	ListChangesSince(ctx context.Context, arg database.ListChangesSinceParams) ([]database.ChangeJournal, error)
+	GetChangeJournalHead(ctx context.Context, userID int32) (database.ChangeJournalHead, error)
+}
+
+type Change struct {
+	Kind      string     `json:"kind"`
+	ID        uuid.UUID  `json:"id"`
+	Action    string     `json:"action"`
+	ParentID  *uuid.UUID `json:"parent_id"`
+	Name      string     `json:"name"`
+	ChangedAt time.Time  `json:"changed_at"`
+	// Where to continue from to get the changes after this one
+	Cursor string `json:"cursor,omitempty"`
+}
+
+func NewChange(e database.ChangeJournal) Change {
+	c := Change{Kind: e.ItemType, ID: e.ItemID, Action: e.Action, Name: e.Name, ChangedAt: e.CreatedAt}
+	if e.ParentID.Valid {
+		c.ParentID = &e.ParentID.UUID
+	}
+	return c
+}
+
+type Delta struct {
+	Changes []Change `json:"changes"`
+	// Where to continue from; returned even when there are no changes
+	Cursor  string `json:"cursor"`
+	HasMore bool   `json:"has_more"`
+}
+
+// cursor is a position in one user's journal. Tying it to the user turns a
+// cursor used with the wrong account into an error rather than a reset.
+type cursor struct {
+	UserID int32 `json:"u"`
+	Seq    int64 `json:"s"`
+}
+
+func encodeCursor(c cursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string, userID int32) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.UserID != userID || c.Seq < 0 {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+type Service struct {
+	queries Queries
+}
+
+func NewService(q Queries) *Service {
+	return &Service{queries: q}
+}
+
+// head returns the user's journal head; users with no changes yet have an
+// empty one.
+func (s *Service) head(ctx context.Context, userID int32) (database.ChangeJournalHead, error) {
+	h, err := s.queries.GetChangeJournalHead(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.ChangeJournalHead{UserID: userID}, nil
+	}
+	if err != nil {
+		return database.ChangeJournalHead{}, fmt.Errorf("fetching journal head: %w", err)
+	}
+	return h, nil
+}
+
+// Latest returns a cursor at the end of the journal, for clients that have
+// just listed the whole tree.
+func (s *Service) Latest(ctx context.Context, userID int32) (string, error) {
+	h, err := s.head(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return encodeCursor(cursor{UserID: userID, Seq: h.Seq}), nil
+}
+
+// Changes returns up to limit changes after the cursor, oldest first. An
+// empty cursor starts at the beginning of the journal.
+func (s *Service) Changes(ctx context.Context, userID int32, after string, limit int32) (Delta, error) {
+	c := cursor{UserID: userID}
+	if after != "" {
+		var err error
+		if c, err = decodeCursor(after, userID); err != nil {
+			return Delta{}, err
+		}
+	}
+
+	rows, err := s.queries.ListChangesSince(ctx, database.ListChangesSinceParams{
+		UserID: userID,
+		Seq:    c.Seq,
+		Limit:  limit + 1, // one extra row tells us whether there is more
+	})
+	if err != nil {
+		return Delta{}, fmt.Errorf("listing changes: %w", err)
+	}
+
+	// Read after the rows, so pruning that raced with the listing is seen
+	h, err := s.head(ctx, userID)
+	if err != nil {
+		return Delta{}, err
+	}
+	if c.Seq < h.PrunedThrough || c.Seq > h.Seq {
+		return Delta{}, ErrResetRequired
+	}
+
+	d := Delta{Changes: make([]Change, 0, min(len(rows), int(limit)))}
+	if len(rows) > int(limit) {
+		rows = rows[:limit]
+		d.HasMore = true
+	}
+	for _, row := range rows {
+		c.Seq = row.Seq
+		change := NewChange(row)
+		change.Cursor = encodeCursor(c)
+		d.Changes = append(d.Changes, change)
+	}
+	d.Cursor = encodeCursor(c)
+	return d, nil
+}
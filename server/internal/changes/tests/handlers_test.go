@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/changes"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) Changes(ctx context.Context, userID int32, after string, limit int32) (changes.Delta, error) {
+	args := m.Called(ctx, userID, after, limit)
+	return args.Get(0).(changes.Delta), args.Error(1)
+}
+
+func (m *MockService) Latest(ctx context.Context, userID int32) (string, error) {
+	args := m.Called(ctx, userID)
+	return args.String(0), args.Error(1)
+}
+
+func get(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(1)))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestChangesHandler(t *testing.T) {
+	m := new(MockService)
+	m.On("Changes", mock.Anything, int32(1), "abc", int32(2000)).Return(changes.Delta{Changes: []changes.Change{}, Cursor: "def", HasMore: true}, nil)
+
+	rec := get(changes.ChangesHandler(m), "/changes?cursor=abc&limit=100000")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"changes": [], "cursor": "def", "has_more": true}`, rec.Body.String())
+}
+
+func TestChangesHandler_ResetRequired(t *testing.T) {
+	m := new(MockService)
+	m.On("Changes", mock.Anything, int32(1), "old", int32(500)).Return(changes.Delta{}, changes.ErrResetRequired)
+	m.On("Latest", mock.Anything, int32(1)).Return("fresh", nil)
+
+	rec := get(changes.ChangesHandler(m), "/changes?cursor=old")
+
+	require.Equal(t, http.StatusGone, rec.Code)
+	var res changes.ResetResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.True(t, res.ResetRequired)
+	assert.Equal(t, "fresh", res.Cursor)
+}
+
+func TestChangesHandler_BadInput(t *testing.T) {
+	m := new(MockService)
+	m.On("Changes", mock.Anything, int32(1), "junk", int32(500)).Return(changes.Delta{}, changes.ErrInvalidCursor)
+
+	assert.Equal(t, http.StatusBadRequest, get(changes.ChangesHandler(m), "/changes?limit=0").Code)
+	assert.Equal(t, http.StatusBadRequest, get(changes.ChangesHandler(m), "/changes?cursor=junk").Code)
+}
+
+func TestLatestCursorHandler(t *testing.T) {
+	m := new(MockService)
+	m.On("Latest", mock.Anything, int32(1)).Return("head", nil)
+
+	rec := get(changes.LatestCursorHandler(m), "/changes/latest")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"cursor": "head"}`, rec.Body.String())
+}
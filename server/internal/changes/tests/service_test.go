@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/changes"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) ListChangesSince(ctx context.Context, arg database.ListChangesSinceParams) ([]database.ChangeJournal, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ChangeJournal), args.Error(1)
+}
+
+func (m *MockQueries) GetChangeJournalHead(ctx context.Context, userID int32) (database.ChangeJournalHead, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(database.ChangeJournalHead), args.Error(1)
+}
+
+func entries(from, to int64) []database.ChangeJournal {
+	var out []database.ChangeJournal
+	for seq := from; seq <= to; seq++ {
+		out = append(out, database.ChangeJournal{
+			UserID:    1,
+			Seq:       seq,
+			ItemType:  "file",
+			ItemID:    uuid.New(),
+			Action:    changes.ActionCreate,
+			Name:      "f.txt",
+			CreatedAt: time.Unix(seq, 0),
+		})
+	}
+	return out
+}
+
+func TestChanges_PagesThroughJournal(t *testing.T) {
+	q := new(MockQueries)
+	q.On("GetChangeJournalHead", mock.Anything, int32(1)).Return(database.ChangeJournalHead{UserID: 1, Seq: 3}, nil)
+	q.On("ListChangesSince", mock.Anything, database.ListChangesSinceParams{UserID: 1, Seq: 0, Limit: 3}).Return(entries(1, 3), nil)
+	q.On("ListChangesSince", mock.Anything, database.ListChangesSinceParams{UserID: 1, Seq: 2, Limit: 3}).Return(entries(3, 3), nil)
+	q.On("ListChangesSince", mock.Anything, database.ListChangesSinceParams{UserID: 1, Seq: 1, Limit: 11}).Return(entries(2, 3), nil)
+	service := changes.NewService(q)
+
+	first, err := service.Changes(context.Background(), 1, "", 2)
+	require.NoError(t, err)
+	assert.Len(t, first.Changes, 2)
+	assert.True(t, first.HasMore)
+
+	second, err := service.Changes(context.Background(), 1, first.Cursor, 2)
+	require.NoError(t, err)
+	assert.Len(t, second.Changes, 1)
+	assert.False(t, second.HasMore)
+
+	latest, err := service.Latest(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, latest, second.Cursor, "the last page ends at the head")
+	assert.Equal(t, first.Cursor, first.Changes[1].Cursor, "a page ends at its last change")
+
+	// Each change's cursor continues right after it
+	rest, err := service.Changes(context.Background(), 1, first.Changes[0].Cursor, 10)
+	assert.NoError(t, err)
+	assert.Len(t, rest.Changes, 2)
+	assert.Equal(t, first.Changes[1].Cursor, rest.Changes[0].Cursor)
+}
+
+func TestChanges_EmptyJournal(t *testing.T) {
+	q := new(MockQueries)
+	q.On("GetChangeJournalHead", mock.Anything, int32(1)).Return(database.ChangeJournalHead{}, sql.ErrNoRows)
+	q.On("ListChangesSince", mock.Anything, mock.Anything).Return([]database.ChangeJournal{}, nil)
+	service := changes.NewService(q)
+
+	delta, err := service.Changes(context.Background(), 1, "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, delta.Changes)
+	assert.NotNil(t, delta.Changes)
+
+	// The cursor from an empty journal picks up the first change
+	again, err := service.Changes(context.Background(), 1, delta.Cursor, 10)
+	require.NoError(t, err)
+	assert.Equal(t, delta.Cursor, again.Cursor)
+}
+
+func TestChanges_ResetRequired(t *testing.T) {
+	q := new(MockQueries)
+	q.On("GetChangeJournalHead", mock.Anything, int32(1)).Return(database.ChangeJournalHead{UserID: 1, Seq: 3}, nil).Once()
+	q.On("ListChangesSince", mock.Anything, mock.Anything).Return(entries(1, 3), nil)
+	service := changes.NewService(q)
+	delta, err := service.Changes(context.Background(), 1, "", 1)
+	require.NoError(t, err)
+
+	// Entries up to 2 have since been pruned
+	q.On("GetChangeJournalHead", mock.Anything, int32(1)).Return(database.ChangeJournalHead{UserID: 1, Seq: 9, PrunedThrough: 2}, nil)
+	_, err = service.Changes(context.Background(), 1, delta.Cursor, 10)
+	assert.ErrorIs(t, err, changes.ErrResetRequired)
+	_, err = service.Changes(context.Background(), 1, "", 10)
+	assert.ErrorIs(t, err, changes.ErrResetRequired, "starting from the beginning needs the whole journal")
+}
+
+func TestChanges_InvalidCursor(t *testing.T) {
+	q := new(MockQueries)
+	q.On("GetChangeJournalHead", mock.Anything, int32(2)).Return(database.ChangeJournalHead{UserID: 2, Seq: 5}, nil)
+	service := changes.NewService(q)
+	otherUsers, err := service.Latest(context.Background(), 2)
+	require.NoError(t, err)
+
+	_, err = service.Changes(context.Background(), 1, otherUsers, 10)
+	assert.ErrorIs(t, err, changes.ErrInvalidCursor)
+	_, err = service.Changes(context.Background(), 1, "not a cursor", 10)
+	assert.ErrorIs(t, err, changes.ErrInvalidCursor)
+	q.AssertNotCalled(t, "ListChangesSince", mock.Anything, mock.Anything)
+}
+
+func TestNewChange(t *testing.T) {
+	parent := uuid.New()
+	c := changes.NewChange(database.ChangeJournal{
+		ItemType: "folder",
+		Action:   changes.ActionMove,
+		ParentID: uuid.NullUUID{UUID: parent, Valid: true},
+		Name:     "docs",
+	})
+
+	assert.Equal(t, "folder", c.Kind)
+	assert.Equal(t, &parent, c.ParentID)
+}
@@ -0,0 +1,67 @@
+package conflict
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Strategies for when a file or folder of the same name already exists at
+// the destination.
+const (
+	Rename    = "rename"    // pick a free "name (2)", "name (3)", ...
+	Overwrite = "overwrite" // replace the existing item
+	Fail      = "fail"      // give up with ErrExists
+)
+
+// maxCandidates bounds the search for a free name.
+const maxCandidates = 10000
+
+var (
+	ErrExists          = errors.New("an item with that name already exists")
+	ErrInvalidStrategy = errors.New("invalid conflict strategy")
+)
+
+// Parse validates a strategy, defaulting to Rename when empty.
+func Parse(s string) (string, error) {
+	switch s {
+	case "":
+		return Rename, nil
+	case Rename, Overwrite, Fail:
+		return s, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidStrategy, s)
+}
+
+// Candidate returns the n-th alternative for name, keeping the extension of
+// files: "report.pdf" becomes "report (2).pdf". n below 2 returns name.
+func Candidate(name string, n int, isFile bool) string {
+	if n < 2 {
+		return name
+	}
+	ext := ""
+	if isFile {
+		ext = filepath.Ext(name)
+		// Dotfiles like ".env" have no extension to keep
+		if ext == name {
+			ext = ""
+		}
+	}
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+}
+
+// FreeName returns the first candidate for name that exists reports as free.
+func FreeName(name string, isFile bool, exists func(name string) (bool, error)) (string, error) {
+	for n := 2; n < maxCandidates; n++ {
+		candidate := Candidate(name, n, isFile)
+		taken, err := exists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no free name for %q", ErrExists, name)
+}
@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/conflict"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	s, err := conflict.Parse("")
+	assert.NoError(t, err)
+	assert.Equal(t, conflict.Rename, s)
+
+	s, err = conflict.Parse("overwrite")
+	assert.NoError(t, err)
+	assert.Equal(t, conflict.Overwrite, s)
+
+	_, err = conflict.Parse("merge")
+	assert.ErrorIs(t, err, conflict.ErrInvalidStrategy)
+}
+
+func TestCandidate(t *testing.T) {
+	assert.Equal(t, "report.pdf", conflict.Candidate("report.pdf", 1, true))
+	assert.Equal(t, "report (2).pdf", conflict.Candidate("report.pdf", 2, true))
+	assert.Equal(t, "archive.tar (3).gz", conflict.Candidate("archive.tar.gz", 3, true))
+	assert.Equal(t, ".env (2)", conflict.Candidate(".env", 2, true))
+	assert.Equal(t, "v1.2 (2)", conflict.Candidate("v1.2", 2, false))
+}
+
+func TestFreeName(t *testing.T) {
+	taken := map[string]bool{"a (2).txt": true, "a (3).txt": true}
+
+	name, err := conflict.FreeName("a.txt", true, func(n string) (bool, error) {
+		return taken[n], nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "a (4).txt", name)
+}
+
+func TestFreeName_LookupError(t *testing.T) {
+	boom := errors.New("boom")
+
+	_, err := conflict.FreeName("a.txt", true, func(string) (bool, error) {
+		return false, boom
+	})
+
+	assert.ErrorIs(t, err, boom)
+}
@@ -0,0 +1,201 @@
+// Package content decides what stored files are and how they may be served:
+// MIME types come from the bytes rather than the uploader, and downloads
+// carry headers that keep uploaded HTML from running in our origin.
+package content
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	OctetStream = "application/octet-stream"
+
+	// http.DetectContentType never looks further than this
+	sniffLen = 512
+
+	DispositionInline     = "inline"
+	DispositionAttachment = "attachment"
+
+	// Nothing in a served file may script or load from elsewhere. Images
+	// and media are allowed so inline previews still render.
+	contentSecurityPolicy = "sandbox; default-src 'none'; img-src 'self'; media-src 'self'; style-src 'unsafe-inline'"
+)
+
+// inlineTypes can be shown in the browser without any risk of script. PDF
+// is left out: Chrome's viewer refuses to render sandboxed documents.
+var inlineTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/avif": true,
+	"image/bmp":  true,
+	"text/plain": true,
+	"audio/mpeg": true,
+	"audio/ogg":  true,
+	"audio/wav":  true,
+	"audio/webm": true,
+	"audio/aac":  true,
+	"audio/flac": true,
+	"video/mp4":  true,
+	"video/webm": true,
+	"video/ogg":  true,
+}
+
+// Sniff reads the start of r to determine its type and returns a reader
+// that yields the whole stream, sniffed bytes included.
+func Sniff(name string, r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, fmt.Errorf("reading content: %w", err)
+	}
+	head = head[:n]
+	return Detect(name, head), io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// Detect types content from its first bytes. The file name's extension may
+// refine a vague answer, such as a .docx for a zip or a .csv for plain
+// text, but never contradict the bytes: a binary stays binary and text
+// stays text whatever it is called.
+func Detect(name string, head []byte) string {
+	byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+
+	if len(head) == 0 {
+		if byExt != "" {
+			return byExt
+		}
+		return OctetStream
+	}
+
+	sniffed := http.DetectContentType(head)
+	if byExt == "" {
+		return sniffed
+	}
+
+	switch base(sniffed) {
+	case "text/plain":
+		if isText(byExt) {
+			return byExt
+		}
+	case "application/zip":
+		if base(byExt) != "application/zip" && strings.HasPrefix(byExt, "application/") {
+			return byExt
+		}
+	case OctetStream:
+		if !isText(byExt) {
+			return byExt
+		}
+	}
+	return sniffed
+}
+
+func base(mimeType string) string {
+	t, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(mimeType))
+	}
+	return t
+}
+
+func isText(mimeType string) bool {
+	t := base(mimeType)
+	return strings.HasPrefix(t, "text/") ||
+		strings.HasSuffix(t, "+xml") || strings.HasSuffix(t, "+json") ||
+		t == "application/json" || t == "application/xml" || t == "application/javascript"
+}
+
+// InlineSafe reports whether a type may be displayed in the browser.
+func InlineSafe(mimeType string) bool {
+	return inlineTypes[base(mimeType)]
+}
+
+// Disposition builds a Content-Disposition header per RFC 6266: a quoted
+// ASCII fallback for old clients and an RFC 5987 UTF-8 filename* for the
+// rest.
+func Disposition(kind, filename string) string {
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, kind, asciiFallback(filename), encodeExtValue(filename))
+}
+
+// asciiFallback keeps printable ASCII and replaces anything that would
+// need escaping, quotes and backslashes included.
+func asciiFallback(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r >= 0x7f || r == '"' || r == '\\' {
+			b.WriteByte('_')
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "download"
+	}
+	return b.String()
+}
+
+// encodeExtValue percent-encodes everything but RFC 5987 attr-chars.
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+// ParseDisposition reads a ?disposition= value; empty means attachment.
+func ParseDisposition(v string) (string, bool) {
+	switch v {
+	case "", DispositionAttachment:
+		return DispositionAttachment, true
+	case DispositionInline:
+		return DispositionInline, true
+	}
+	return "", false
+}
+
+// SetHeaders prepares a response for a stored file. An inline request for a
+// type that isn't InlineSafe is downgraded to an attachment.
+func SetHeaders(h http.Header, name, mimeType string, size int64, disposition string) {
+	if mimeType == "" {
+		mimeType = OctetStream
+	}
+	if disposition != DispositionInline || !InlineSafe(mimeType) {
+		disposition = DispositionAttachment
+	}
+
+	h.Set("Content-Type", mimeType)
+	h.Set("Content-Disposition", Disposition(disposition, name))
+	h.Set("Content-Length", strconv.FormatInt(size, 10))
+	SetSafetyHeaders(h)
+}
+
+// SetSafetyHeaders stops browsers from second-guessing Content-Type and
+// sandboxes anything they render.
+func SetSafetyHeaders(h http.Header) {
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", contentSecurityPolicy)
+}
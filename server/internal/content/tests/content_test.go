@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/content"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestDetect_TrustsBytesOverName(t *testing.T) {
+	// HTML named like an image is still HTML
+	assert.Equal(t, "text/html; charset=utf-8", content.Detect("cat.png", []byte("<html><script>alert(1)</script>")))
+	// and an image named like HTML is still an image
+	assert.Equal(t, "image/png", content.Detect("page.html", pngHeader))
+}
+
+func TestDetect_ExtensionRefinesVagueTypes(t *testing.T) {
+	// Not every system's mime.types knows Office formats
+	require.NoError(t, mime.AddExtensionType(".docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"))
+
+	assert.Equal(t, "application/json", content.Detect("data.json", []byte(`{"a": 1}`)))
+	assert.Equal(t, "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		content.Detect("report.docx", []byte("PK\x03\x04rest-of-zip")))
+	assert.Equal(t, "application/zip", content.Detect("archive.zip", []byte("PK\x03\x04rest-of-zip")))
+	// Binary data can't be made text by its name
+	assert.Equal(t, "application/octet-stream", content.Detect("notes.txt", []byte{0x00, 0x01, 0x02, 0xfe}))
+}
+
+func TestDetect_Empty(t *testing.T) {
+	assert.Equal(t, "text/plain; charset=utf-8", content.Detect("empty.txt", nil))
+	assert.Equal(t, content.OctetStream, content.Detect("empty", nil))
+}
+
+func TestSniff_ReplaysContent(t *testing.T) {
+	body := strings.Repeat("hello ", 200)
+
+	mimeType, r, err := content.Sniff("hello.txt", strings.NewReader(body))
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	assert.Equal(t, "text/plain; charset=utf-8", mimeType)
+	assert.Equal(t, body, string(got))
+}
+
+func TestInlineSafe(t *testing.T) {
+	assert.True(t, content.InlineSafe("image/png"))
+	assert.True(t, content.InlineSafe("text/plain; charset=utf-8"))
+	assert.True(t, content.InlineSafe("video/mp4"))
+	assert.False(t, content.InlineSafe("text/html; charset=utf-8"))
+	assert.False(t, content.InlineSafe("image/svg+xml"))
+	assert.False(t, content.InlineSafe("application/pdf"))
+	assert.False(t, content.InlineSafe(""))
+}
+
+func TestDisposition_EncodesNames(t *testing.T) {
+	assert.Equal(t, `attachment; filename="report.pdf"; filename*=UTF-8''report.pdf`,
+		content.Disposition(content.DispositionAttachment, "report.pdf"))
+	assert.Equal(t, `inline; filename="r_sum_.txt"; filename*=UTF-8''r%C3%A9sum%C3%A9.txt`,
+		content.Disposition(content.DispositionInline, "résumé.txt"))
+	// Quotes and line breaks can't escape the header value
+	assert.Equal(t, `attachment; filename="a_b_.txt"; filename*=UTF-8''a%22b%0D.txt`,
+		content.Disposition(content.DispositionAttachment, "a\"b\r.txt"))
+	assert.Equal(t, `attachment; filename="my file.txt"; filename*=UTF-8''my%20file.txt`,
+		content.Disposition(content.DispositionAttachment, "my file.txt"))
+}
+
+func TestSetHeaders_DowngradesUnsafeInline(t *testing.T) {
+	h := http.Header{}
+	content.SetHeaders(h, "x.html", "text/html; charset=utf-8", 5, content.DispositionInline)
+
+	assert.True(t, strings.HasPrefix(h.Get("Content-Disposition"), "attachment;"))
+	assert.Equal(t, "nosniff", h.Get("X-Content-Type-Options"))
+	assert.Contains(t, h.Get("Content-Security-Policy"), "sandbox")
+	assert.Equal(t, "5", h.Get("Content-Length"))
+}
+
+func TestSetHeaders_DefaultsType(t *testing.T) {
+	h := http.Header{}
+	content.SetHeaders(h, "blob", "", 0, content.DispositionAttachment)
+
+	assert.Equal(t, content.OctetStream, h.Get("Content-Type"))
+}
@@ -13,6 +13,21 @@ import (
 	"github.com/sqlc-dev/pqtype"
 )
 
+const deleteUserActivity = `-- name: DeleteUserActivity :execrows
+DELETE FROM file_activity
+WHERE file_activity.user_id = $1
+   OR file_id IN (SELECT f.id FROM files f WHERE f.user_id = $1)
+`
+
+// Activity by the user anywhere, plus activity on the user's own files.
+func (q *Queries) DeleteUserActivity(ctx context.Context, userID sql.NullInt32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserActivity, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const listFileActivity = `-- name: ListFileActivity :many
 SELECT id, file_id, user_id, action, details, created_at FROM file_activity
 WHERE file_id = $1
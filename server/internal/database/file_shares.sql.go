@@ -12,6 +12,21 @@ import (
 	"github.com/google/uuid"
 )
 
+const deleteUserShares = `-- name: DeleteUserShares :execrows
+DELETE FROM file_shares
+WHERE shared_with = $1
+   OR file_id IN (SELECT f.id FROM files f WHERE f.user_id = $1)
+`
+
+// Shares granted to the user and shares on the user's own files.
+func (q *Queries) DeleteUserShares(ctx context.Context, sharedWith sql.NullInt32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserShares, sharedWith)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getFileShares = `-- name: GetFileShares :many
 SELECT id, file_id, shared_with, permission, created_at FROM file_shares WHERE file_id = $1
 `
@@ -45,6 +60,42 @@ func (q *Queries) GetFileShares(ctx context.Context, fileID uuid.NullUUID) ([]Fi
 	return items, nil
 }
 
+const listSharesByOwner = `-- name: ListSharesByOwner :many
+SELECT fs.id, fs.file_id, fs.shared_with, fs.permission, fs.created_at FROM file_shares fs
+INNER JOIN files f ON f.id = fs.file_id
+WHERE f.user_id = $1
+ORDER BY fs.created_at
+`
+
+func (q *Queries) ListSharesByOwner(ctx context.Context, userID sql.NullInt32) ([]FileShare, error) {
+	rows, err := q.db.QueryContext(ctx, listSharesByOwner, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FileShare
+	for rows.Next() {
+		var i FileShare
+		if err := rows.Scan(
+			&i.ID,
+			&i.FileID,
+			&i.SharedWith,
+			&i.Permission,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const removeFileShare = `-- name: RemoveFileShare :execrows
 DELETE FROM file_shares
 WHERE file_id = $1 AND shared_with = $2
@@ -13,9 +13,9 @@ import (
 )
 
 const createFile = `-- name: CreateFile :one
-INSERT INTO files (folder_id, user_id, name, file_path, size_bytes, mime_type)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, folder_id, user_id, name, file_path, size_bytes, mime_type, created_at, updated_at
+INSERT INTO files (folder_id, user_id, name, file_path, size_bytes, mime_type, sha256)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, folder_id, user_id, name, file_path, size_bytes, mime_type, created_at, updated_at, content_text, search_vector, text_extracted_at, trashed_at, sha256, thumbnail_state
 `
 
 type CreateFileParams struct {
@@ -25,6 +25,7 @@ type CreateFileParams struct {
 	FilePath  string
 	SizeBytes int64
 	MimeType  sql.NullString
+	Sha256    sql.NullString
 }
 
 func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, error) {
@@ -35,6 +36,7 @@ func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, e
 		arg.FilePath,
 		arg.SizeBytes,
 		arg.MimeType,
+		arg.Sha256,
 	)
 	var i File
 	err := row.Scan(
@@ -47,6 +49,12 @@ func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, e
 		&i.MimeType,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ContentText,
+		&i.SearchVector,
+		&i.TextExtractedAt,
+		&i.TrashedAt,
+		&i.Sha256,
+		&i.ThumbnailState,
 	)
 	return i, err
 }
@@ -70,7 +78,7 @@ func (q *Queries) DeleteFile(ctx context.Context, arg DeleteFileParams) (int64,
 }
 
 const getFileByID = `-- name: GetFileByID :one
-SELECT id, folder_id, user_id, name, file_path, size_bytes, mime_type, created_at, updated_at FROM files WHERE id = $1
+SELECT id, folder_id, user_id, name, file_path, size_bytes, mime_type, created_at, updated_at, content_text, search_vector, text_extracted_at, trashed_at, sha256, thumbnail_state FROM files WHERE id = $1
 `
 
 func (q *Queries) GetFileByID(ctx context.Context, id uuid.UUID) (File, error) {
@@ -86,22 +94,31 @@ func (q *Queries) GetFileByID(ctx context.Context, id uuid.UUID) (File, error) {
 		&i.MimeType,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ContentText,
+		&i.SearchVector,
+		&i.TextExtractedAt,
+		&i.TrashedAt,
+		&i.Sha256,
+		&i.ThumbnailState,
 	)
 	return i, err
 }
 
 const getFileByNameInFolder = `-- name: GetFileByNameInFolder :one
-SELECT id, folder_id, user_id, name, file_path, size_bytes, mime_type, created_at, updated_at FROM files
-WHERE folder_id = $1 AND name = $2
+SELECT id, folder_id, user_id, name, file_path, size_bytes, mime_type, created_at, updated_at, content_text, search_vector, text_extracted_at, trashed_at, sha256, thumbnail_state FROM files
+WHERE user_id = $1 AND folder_id IS NOT DISTINCT FROM $2 AND name = $3
 `
 
 type GetFileByNameInFolderParams struct {
+	UserID   sql.NullInt32
 	FolderID uuid.NullUUID
 	Name     string
 }
 
+// folder_id is NULL for files at the user's root, hence IS NOT DISTINCT FROM;
+// user_id keeps one user's root apart from another's.
 func (q *Queries) GetFileByNameInFolder(ctx context.Context, arg GetFileByNameInFolderParams) (File, error) {
-	row := q.db.QueryRowContext(ctx, getFileByNameInFolder, arg.FolderID, arg.Name)
+	row := q.db.QueryRowContext(ctx, getFileByNameInFolder, arg.UserID, arg.FolderID, arg.Name)
 	var i File
 	err := row.Scan(
 		&i.ID,
@@ -113,14 +130,21 @@ func (q *Queries) GetFileByNameInFolder(ctx context.Context, arg GetFileByNameIn
 		&i.MimeType,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ContentText,
+		&i.SearchVector,
+		&i.TextExtractedAt,
+		&i.TrashedAt,
+		&i.Sha256,
+		&i.ThumbnailState,
 	)
 	return i, err
 }
 
 const listFilesInFolder = `-- name: ListFilesInFolder :many
-SELECT id, folder_id, user_id, name, file_path, size_bytes, mime_type, created_at, updated_at
+SELECT id, folder_id, user_id, name, file_path, size_bytes, mime_type, created_at, updated_at, content_text, search_vector, text_extracted_at, trashed_at, sha256, thumbnail_state
 FROM files
-WHERE (folder_id = $1 OR ($1 IS NULL AND folder_id IS NULL)) AND user_id = $2
+WHERE folder_id IS NOT DISTINCT FROM $1 AND user_id = $2
+  AND trashed_at IS NULL
 ORDER BY name
 `
 
@@ -148,6 +172,12 @@ func (q *Queries) ListFilesInFolder(ctx context.Context, arg ListFilesInFolderPa
 			&i.MimeType,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.ContentText,
+			&i.SearchVector,
+			&i.TextExtractedAt,
+			&i.TrashedAt,
+			&i.Sha256,
+			&i.ThumbnailState,
 		); err != nil {
 			return nil, err
 		}
@@ -163,18 +193,6 @@ func (q *Queries) ListFilesInFolder(ctx context.Context, arg ListFilesInFolderPa
 }
 
 const listFilesRecursive = `-- name: ListFilesRecursive :many
-WITH RECURSIVE subfolders AS (
-    SELECT folders.id AS sf_folder_id
-    FROM folders
-    WHERE folders.id = $1 AND folders.user_id = $2
-
-    UNION ALL
-
-    SELECT f.id AS sf_folder_id
-    FROM folders f
-    INNER JOIN subfolders s ON f.parent_id = s.sf_folder_id
-    WHERE f.user_id = $2
-)
 SELECT 
     f.id AS file_id,
     f.folder_id AS folder_id,
@@ -184,10 +202,12 @@ SELECT
     f.size_bytes AS size_bytes,
     f.mime_type AS mime_type,
     f.created_at AS created_at,
-    f.updated_at AS updated_at
-FROM files f
-INNER JOIN subfolders sf ON f.folder_id = sf.sf_folder_id
-WHERE f.user_id = $2
+    f.updated_at AS updated_at,
+    f.trashed_at AS trashed_at,
+    f.sha256 AS sha256
+FROM folder_closure c
+INNER JOIN files f ON f.folder_id = c.descendant_id
+WHERE c.ancestor_id = $1 AND f.user_id = $2
 ORDER BY f.name
 `
 
@@ -206,6 +226,8 @@ type ListFilesRecursiveRow struct {
 	MimeType  sql.NullString
 	CreatedAt sql.NullTime
 	UpdatedAt sql.NullTime
+	TrashedAt sql.NullTime
+	Sha256    sql.NullString
 }
 
 func (q *Queries) ListFilesRecursive(ctx context.Context, arg ListFilesRecursiveParams) ([]ListFilesRecursiveRow, error) {
@@ -227,6 +249,8 @@ func (q *Queries) ListFilesRecursive(ctx context.Context, arg ListFilesRecursive
 			&i.MimeType,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.TrashedAt,
+			&i.Sha256,
 		); err != nil {
 			return nil, err
 		}
@@ -241,6 +265,156 @@ func (q *Queries) ListFilesRecursive(ctx context.Context, arg ListFilesRecursive
 	return items, nil
 }
 
+const listUserFiles = `-- name: ListUserFiles :many
+SELECT id, folder_id, user_id, name, file_path, size_bytes, mime_type, created_at, updated_at, content_text, search_vector, text_extracted_at, trashed_at, sha256, thumbnail_state FROM files
+WHERE user_id = $1
+ORDER BY file_path
+`
+
+func (q *Queries) ListUserFiles(ctx context.Context, userID sql.NullInt32) ([]File, error) {
+	rows, err := q.db.QueryContext(ctx, listUserFiles, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []File
+	for rows.Next() {
+		var i File
+		if err := rows.Scan(
+			&i.ID,
+			&i.FolderID,
+			&i.UserID,
+			&i.Name,
+			&i.FilePath,
+			&i.SizeBytes,
+			&i.MimeType,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ContentText,
+			&i.SearchVector,
+			&i.TextExtractedAt,
+			&i.TrashedAt,
+			&i.Sha256,
+			&i.ThumbnailState,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const replaceFileContent = `-- name: ReplaceFileContent :one
+UPDATE files
+SET size_bytes = $3,
+    mime_type = $4,
+    sha256 = $5,
+    content_text = NULL,
+    text_extracted_at = NULL,
+    thumbnail_state = NULL,
+    trashed_at = NULL,
+    updated_at = now()
+WHERE id = $1 AND user_id = $2
+RETURNING id, folder_id, user_id, name, file_path, size_bytes, mime_type, created_at, updated_at, content_text, search_vector, text_extracted_at, trashed_at, sha256, thumbnail_state
+`
+
+type ReplaceFileContentParams struct {
+	ID        uuid.UUID
+	UserID    sql.NullInt32
+	SizeBytes int64
+	MimeType  sql.NullString
+	Sha256    sql.NullString
+}
+
+// The file keeps its ID, and with it tags, properties and shares.
+// Everything derived from the old content is reset for the hooks to redo,
+// and an upload over a trashed file brings it back.
+func (q *Queries) ReplaceFileContent(ctx context.Context, arg ReplaceFileContentParams) (File, error) {
+	row := q.db.QueryRowContext(ctx, replaceFileContent,
+		arg.ID,
+		arg.UserID,
+		arg.SizeBytes,
+		arg.MimeType,
+		arg.Sha256,
+	)
+	var i File
+	err := row.Scan(
+		&i.ID,
+		&i.FolderID,
+		&i.UserID,
+		&i.Name,
+		&i.FilePath,
+		&i.SizeBytes,
+		&i.MimeType,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ContentText,
+		&i.SearchVector,
+		&i.TextExtractedAt,
+		&i.TrashedAt,
+		&i.Sha256,
+		&i.ThumbnailState,
+	)
+	return i, err
+}
+
+const setFileContentText = `-- name: SetFileContentText :execrows
+UPDATE files
+SET content_text = $2,
+    text_extracted_at = now()
+WHERE id = $1
+`
+
+type SetFileContentTextParams struct {
+	ID          uuid.UUID
+	ContentText sql.NullString
+}
+
+func (q *Queries) SetFileContentText(ctx context.Context, arg SetFileContentTextParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setFileContentText, arg.ID, arg.ContentText)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateFileLocation = `-- name: UpdateFileLocation :execrows
+UPDATE files
+SET folder_id = $2,
+    name = $3,
+    file_path = $4,
+    updated_at = now()
+WHERE id = $1 AND user_id = $5
+`
+
+type UpdateFileLocationParams struct {
+	ID       uuid.UUID
+	FolderID uuid.NullUUID
+	Name     string
+	FilePath string
+	UserID   sql.NullInt32
+}
+
+func (q *Queries) UpdateFileLocation(ctx context.Context, arg UpdateFileLocationParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateFileLocation,
+		arg.ID,
+		arg.FolderID,
+		arg.Name,
+		arg.FilePath,
+		arg.UserID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateFileMetadata = `-- name: UpdateFileMetadata :execrows
 UPDATE files
 SET name = $2, updated_at = now()
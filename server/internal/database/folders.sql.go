@@ -15,7 +15,7 @@ import (
 const createFolder = `-- name: CreateFolder :one
 INSERT INTO folders (user_id, name, parent_id)
 VALUES ($1, $2, $3)
-RETURNING id, user_id, name, parent_id, created_at, updated_at
+RETURNING id, user_id, name, parent_id, created_at, updated_at, search_vector, trashed_at
 `
 
 type CreateFolderParams struct {
@@ -34,6 +34,8 @@ func (q *Queries) CreateFolder(ctx context.Context, arg CreateFolderParams) (Fol
 		&i.ParentID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.SearchVector,
+		&i.TrashedAt,
 	)
 	return i, err
 }
@@ -57,7 +59,7 @@ func (q *Queries) DeleteFolder(ctx context.Context, arg DeleteFolderParams) (int
 }
 
 const getFolderByID = `-- name: GetFolderByID :one
-SELECT id, user_id, name, parent_id, created_at, updated_at FROM folders WHERE id = $1
+SELECT id, user_id, name, parent_id, created_at, updated_at, search_vector, trashed_at FROM folders WHERE id = $1
 `
 
 func (q *Queries) GetFolderByID(ctx context.Context, id uuid.UUID) (Folder, error) {
@@ -70,15 +72,85 @@ func (q *Queries) GetFolderByID(ctx context.Context, id uuid.UUID) (Folder, erro
 		&i.ParentID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.SearchVector,
+		&i.TrashedAt,
 	)
 	return i, err
 }
 
+const getFolderByNameInParent = `-- name: GetFolderByNameInParent :one
+SELECT id, user_id, name, parent_id, created_at, updated_at, search_vector, trashed_at FROM folders
+WHERE user_id = $1
+  AND parent_id IS NOT DISTINCT FROM $2
+  AND name = $3
+`
+
+type GetFolderByNameInParentParams struct {
+	UserID   sql.NullInt32
+	ParentID uuid.NullUUID
+	Name     string
+}
+
+// parent_id is NULL for folders at the user's root, hence IS NOT DISTINCT FROM.
+func (q *Queries) GetFolderByNameInParent(ctx context.Context, arg GetFolderByNameInParentParams) (Folder, error) {
+	row := q.db.QueryRowContext(ctx, getFolderByNameInParent, arg.UserID, arg.ParentID, arg.Name)
+	var i Folder
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.ParentID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.SearchVector,
+		&i.TrashedAt,
+	)
+	return i, err
+}
+
+const getFolderPath = `-- name: GetFolderPath :one
+SELECT string_agg(f.name, '/' ORDER BY c.depth DESC)::text AS path
+FROM folder_closure c
+INNER JOIN folders f ON f.id = c.ancestor_id
+WHERE c.descendant_id = $1
+HAVING count(*) > 0
+`
+
+// The folder's path from the user's root, e.g. "projects/2024". No row when
+// the folder doesn't exist.
+func (q *Queries) GetFolderPath(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRowContext(ctx, getFolderPath, id)
+	var path string
+	err := row.Scan(&path)
+	return path, err
+}
+
+const isFolderInSubtree = `-- name: IsFolderInSubtree :one
+SELECT EXISTS (
+    SELECT 1 FROM folder_closure
+    WHERE ancestor_id = $1 AND descendant_id = $2
+) AS in_subtree
+`
+
+type IsFolderInSubtreeParams struct {
+	RootID      uuid.UUID
+	CandidateID uuid.UUID
+}
+
+// Whether candidate is root itself or anywhere below it.
+func (q *Queries) IsFolderInSubtree(ctx context.Context, arg IsFolderInSubtreeParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isFolderInSubtree, arg.RootID, arg.CandidateID)
+	var in_subtree bool
+	err := row.Scan(&in_subtree)
+	return in_subtree, err
+}
+
 const listFoldersByParent = `-- name: ListFoldersByParent :many
-SELECT id, user_id, name, parent_id, created_at, updated_at
+SELECT id, user_id, name, parent_id, created_at, updated_at, search_vector, trashed_at
 FROM folders
-WHERE parent_id = $1
+WHERE parent_id IS NOT DISTINCT FROM $1
   AND user_id = $2
+  AND trashed_at IS NULL
 ORDER BY name
 `
 
@@ -87,6 +159,7 @@ type ListFoldersByParentParams struct {
 	UserID   sql.NullInt32
 }
 
+// parent_id is NULL for folders at the user's root, hence IS NOT DISTINCT FROM.
 func (q *Queries) ListFoldersByParent(ctx context.Context, arg ListFoldersByParentParams) ([]Folder, error) {
 	rows, err := q.db.QueryContext(ctx, listFoldersByParent, arg.ParentID, arg.UserID)
 	if err != nil {
@@ -103,6 +176,8 @@ func (q *Queries) ListFoldersByParent(ctx context.Context, arg ListFoldersByPare
 			&i.ParentID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.SearchVector,
+			&i.TrashedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -118,20 +193,11 @@ func (q *Queries) ListFoldersByParent(ctx context.Context, arg ListFoldersByPare
 }
 
 const listFoldersRecursive = `-- name: ListFoldersRecursive :many
-WITH RECURSIVE subfolders AS (
-    SELECT f0.id, f0.user_id, f0.name, f0.parent_id, f0.created_at, f0.updated_at
-    FROM folders f0
-    WHERE f0.id = $1 AND f0.user_id = $2
-
-    UNION ALL
-
-    SELECT f.id, f.user_id, f.name, f.parent_id, f.created_at, f.updated_at
-    FROM folders f
-    INNER JOIN subfolders s ON f.parent_id = s.id
-    WHERE f.user_id = $2
-)
-SELECT id, user_id, name, parent_id, created_at, updated_at
-FROM subfolders
+SELECT f.id, f.user_id, f.name, f.parent_id, f.created_at, f.updated_at, f.trashed_at
+FROM folder_closure c
+INNER JOIN folders f ON f.id = c.descendant_id
+WHERE c.ancestor_id = $1 AND f.user_id = $2
+ORDER BY c.depth, f.name
 `
 
 type ListFoldersRecursiveParams struct {
@@ -146,8 +212,10 @@ type ListFoldersRecursiveRow struct {
 	ParentID  uuid.NullUUID
 	CreatedAt sql.NullTime
 	UpdatedAt sql.NullTime
+	TrashedAt sql.NullTime
 }
 
+// The folder itself and everything below it, shallowest first.
 func (q *Queries) ListFoldersRecursive(ctx context.Context, arg ListFoldersRecursiveParams) ([]ListFoldersRecursiveRow, error) {
 	rows, err := q.db.QueryContext(ctx, listFoldersRecursive, arg.ID, arg.UserID)
 	if err != nil {
@@ -164,6 +232,45 @@ func (q *Queries) ListFoldersRecursive(ctx context.Context, arg ListFoldersRecur
 			&i.ParentID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.TrashedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserFolders = `-- name: ListUserFolders :many
+SELECT id, user_id, name, parent_id, created_at, updated_at, search_vector, trashed_at FROM folders
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListUserFolders(ctx context.Context, userID sql.NullInt32) ([]Folder, error) {
+	rows, err := q.db.QueryContext(ctx, listUserFolders, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Folder
+	for rows.Next() {
+		var i Folder
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.ParentID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.SearchVector,
+			&i.TrashedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -6,22 +6,61 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/sqlc-dev/pqtype"
 )
 
-type File struct {
-	ID        uuid.UUID
-	FolderID  uuid.NullUUID
-	UserID    sql.NullInt32
+type ChangeJournal struct {
+	UserID    int32
+	Seq       int64
+	ItemType  string
+	ItemID    uuid.UUID
+	Action    string
+	ParentID  uuid.NullUUID
 	Name      string
-	FilePath  string
-	SizeBytes int64
-	MimeType  sql.NullString
-	CreatedAt sql.NullTime
-	UpdatedAt sql.NullTime
+	CreatedAt time.Time
+}
+
+type ChangeJournalHead struct {
+	UserID        int32
+	Seq           int64
+	PrunedThrough int64
+}
+
+type EmailOutbox struct {
+	ID            uuid.UUID
+	Template      string
+	ToAddress     string
+	Subject       string
+	TextBody      string
+	HtmlBody      string
+	Status        string
+	Attempts      int32
+	NextAttemptAt time.Time
+	LastError     sql.NullString
+	CreatedAt     time.Time
+	SentAt        sql.NullTime
+}
+
+type File struct {
+	ID              uuid.UUID
+	FolderID        uuid.NullUUID
+	UserID          sql.NullInt32
+	Name            string
+	FilePath        string
+	SizeBytes       int64
+	MimeType        sql.NullString
+	CreatedAt       sql.NullTime
+	UpdatedAt       sql.NullTime
+	ContentText     sql.NullString
+	SearchVector    interface{}
+	TextExtractedAt sql.NullTime
+	TrashedAt       sql.NullTime
+	Sha256          sql.NullString
+	ThumbnailState  sql.NullString
 }
 
 type FileActivity struct {
@@ -33,6 +72,13 @@ type FileActivity struct {
 	CreatedAt time.Time
 }
 
+type FileProperty struct {
+	FileID    uuid.UUID
+	Key       string
+	Value     string
+	UpdatedAt time.Time
+}
+
 type FileShare struct {
 	ID         uuid.UUID
 	FileID     uuid.NullUUID
@@ -41,13 +87,92 @@ type FileShare struct {
 	CreatedAt  sql.NullTime
 }
 
+type FileTag struct {
+	FileID    uuid.UUID
+	TagID     uuid.UUID
+	CreatedAt time.Time
+}
+
 type Folder struct {
-	ID        uuid.UUID
-	UserID    sql.NullInt32
-	Name      string
-	ParentID  uuid.NullUUID
-	CreatedAt sql.NullTime
-	UpdatedAt sql.NullTime
+	ID           uuid.UUID
+	UserID       sql.NullInt32
+	Name         string
+	ParentID     uuid.NullUUID
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	SearchVector interface{}
+	TrashedAt    sql.NullTime
+}
+
+type FolderClosure struct {
+	AncestorID   uuid.UUID
+	DescendantID uuid.UUID
+	Depth        int32
+}
+
+type FolderProperty struct {
+	FolderID  uuid.UUID
+	Key       string
+	Value     string
+	UpdatedAt time.Time
+}
+
+type FolderStat struct {
+	FolderID     uuid.UUID
+	SizeBytes    int64
+	FileCount    int64
+	FolderCount  int64
+	LastModified sql.NullTime
+	ComputedAt   time.Time
+}
+
+type FolderTag struct {
+	FolderID  uuid.UUID
+	TagID     uuid.UUID
+	CreatedAt time.Time
+}
+
+type Job struct {
+	ID            uuid.UUID
+	Kind          string
+	UserID        sql.NullInt32
+	Payload       json.RawMessage
+	Status        string
+	Attempts      int32
+	MaxAttempts   int32
+	RunAt         time.Time
+	LockedUntil   sql.NullTime
+	LastError     sql.NullString
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	FinishedAt    sql.NullTime
+	ProgressDone  int64
+	ProgressTotal int64
+	Result        pqtype.NullRawMessage
+}
+
+type PasswordReset struct {
+	TokenHash string
+	UserID    int32
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type PersonalToken struct {
+	ID         uuid.UUID
+	UserID     int32
+	Name       string
+	TokenHash  string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+	ExpiresAt  sql.NullTime
+}
+
+type RateLimitBucket struct {
+	BucketKey string
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt time.Time
 }
 
 type RefreshToken struct {
@@ -58,6 +183,69 @@ type RefreshToken struct {
 	Revoked   bool
 }
 
+type S3AccessKey struct {
+	ID          uuid.UUID
+	UserID      int32
+	AccessKeyID string
+	SecretKey   string
+	CreatedAt   time.Time
+	LastUsedAt  sql.NullTime
+}
+
+type S3MultipartPart struct {
+	UploadID   uuid.UUID
+	PartNumber int32
+	Etag       string
+	SizeBytes  int64
+	CreatedAt  time.Time
+}
+
+type S3MultipartUpload struct {
+	ID        uuid.UUID
+	UserID    int32
+	ObjectKey string
+	CreatedAt time.Time
+}
+
+type SshKey struct {
+	ID          uuid.UUID
+	UserID      int32
+	Name        string
+	PublicKey   string
+	Fingerprint string
+	CreatedAt   time.Time
+	LastUsedAt  sql.NullTime
+}
+
+type StorageRelocation struct {
+	ID      int64
+	UserID  int32
+	OldPath string
+	NewPath string
+	IsDir   bool
+}
+
+type StreamTicket struct {
+	TicketHash string
+	UserID     int32
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+}
+
+type Tag struct {
+	ID        uuid.UUID
+	UserID    int32
+	Name      string
+	CreatedAt time.Time
+}
+
+type UsageSnapshot struct {
+	UserID    int32
+	Day       time.Time
+	UsedBytes int64
+	FileCount int64
+}
+
 type User struct {
 	ID                      int32
 	Email                   string
@@ -68,4 +256,17 @@ type User struct {
 	UsedStorage             int64
 	CreatedAt               time.Time
 	UpdatedAt               time.Time
+	Role                    string
+	StorageQuota            int64
+	IsDisabled              bool
+	FailedLoginAttempts     int32
+	LockedUntil             sql.NullTime
+	PendingEmail            sql.NullString
+	EmailChangeTokenHash    sql.NullString
+	EmailChangeCancelHash   sql.NullString
+	EmailChangeExpiry       sql.NullTime
+	DeletionRequestedAt     sql.NullTime
+	DeletionScheduledAt     sql.NullTime
+	DeletionLockedUntil     sql.NullTime
+	TokenVersion            int32
 }
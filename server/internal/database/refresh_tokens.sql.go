@@ -23,6 +23,19 @@ func (q *Queries) DeleteExpiredRefreshTokens(ctx context.Context) (int64, error)
 	return result.RowsAffected()
 }
 
+const deleteUserRefreshTokens = `-- name: DeleteUserRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserRefreshTokens(ctx context.Context, userID int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserRefreshTokens, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getRefreshToken = `-- name: GetRefreshToken :one
 SELECT token_hash, user_id, expires_at, revoked FROM refresh_tokens WHERE token_hash = $1
 `
@@ -84,3 +97,23 @@ func (q *Queries) RevokeRefreshToken(ctx context.Context, tokenHash string) (int
 	}
 	return result.RowsAffected()
 }
+
+const revokeUserRefreshTokens = `-- name: RevokeUserRefreshTokens :execrows
+WITH bumped AS (
+    UPDATE users
+    SET token_version = token_version + 1
+    WHERE id = $1
+)
+UPDATE refresh_tokens
+SET revoked = TRUE
+WHERE user_id = $1 AND revoked = FALSE
+`
+
+// Bumping the token version retires the user's access tokens as well.
+func (q *Queries) RevokeUserRefreshTokens(ctx context.Context, userID int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeUserRefreshTokens, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -10,6 +10,106 @@ import (
 	"database/sql"
 )
 
+const applyEmailChange = `-- name: ApplyEmailChange :execrows
+UPDATE users
+SET email = pending_email,
+    is_verified = TRUE,
+    pending_email = NULL,
+    email_change_token_hash = NULL,
+    email_change_cancel_hash = NULL,
+    email_change_expiry = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND pending_email IS NOT NULL
+`
+
+func (q *Queries) ApplyEmailChange(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, applyEmailChange, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const cancelAccountDeletion = `-- name: CancelAccountDeletion :execrows
+UPDATE users
+SET deletion_requested_at = NULL,
+    deletion_scheduled_at = NULL,
+    deletion_locked_until = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND deletion_scheduled_at > now()
+`
+
+// Only possible while the grace period is still running.
+func (q *Queries) CancelAccountDeletion(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelAccountDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const claimDueAccountDeletions = `-- name: ClaimDueAccountDeletions :many
+UPDATE users
+SET deletion_locked_until = now() + make_interval(secs => $1::float8)
+WHERE id IN (
+    SELECT id FROM users
+    WHERE deletion_scheduled_at <= now()
+      AND (deletion_locked_until IS NULL OR deletion_locked_until <= now())
+    ORDER BY deletion_scheduled_at
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id
+`
+
+type ClaimDueAccountDeletionsParams struct {
+	LeaseSeconds float64
+	BatchSize    int32
+}
+
+// Leases accounts whose grace period is over, so a crashed purge is retried
+// once the lease runs out.
+func (q *Queries) ClaimDueAccountDeletions(ctx context.Context, arg ClaimDueAccountDeletionsParams) ([]int32, error) {
+	rows, err := q.db.QueryContext(ctx, claimDueAccountDeletions, arg.LeaseSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const clearEmailChange = `-- name: ClearEmailChange :execrows
+UPDATE users
+SET pending_email = NULL,
+    email_change_token_hash = NULL,
+    email_change_cancel_hash = NULL,
+    email_change_expiry = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+func (q *Queries) ClearEmailChange(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, clearEmailChange, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
     email,
@@ -22,7 +122,7 @@ INSERT INTO users (
 ) VALUES (
     $1, $2, $3, $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
 )
-RETURNING id, email, password_hash, is_verified, verification_token, verification_token_expiry, used_storage, created_at, updated_at
+RETURNING id, email, password_hash, is_verified, verification_token, verification_token_expiry, used_storage, created_at, updated_at, role, storage_quota, is_disabled, failed_login_attempts, locked_until, pending_email, email_change_token_hash, email_change_cancel_hash, email_change_expiry, deletion_requested_at, deletion_scheduled_at, deletion_locked_until, token_version
 `
 
 type CreateUserParams struct {
@@ -52,6 +152,19 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UsedStorage,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Role,
+		&i.StorageQuota,
+		&i.IsDisabled,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.PendingEmail,
+		&i.EmailChangeTokenHash,
+		&i.EmailChangeCancelHash,
+		&i.EmailChangeExpiry,
+		&i.DeletionRequestedAt,
+		&i.DeletionScheduledAt,
+		&i.DeletionLockedUntil,
+		&i.TokenVersion,
 	)
 	return i, err
 }
@@ -69,8 +182,30 @@ func (q *Queries) DeleteUser(ctx context.Context, id int32) (int64, error) {
 	return result.RowsAffected()
 }
 
+const getStorageUsage = `-- name: GetStorageUsage :one
+SELECT
+    u.storage_quota,
+    COALESCE((SELECT SUM(f.size_bytes) FROM files f WHERE f.user_id = u.id), 0)::bigint AS used_bytes
+FROM users u
+WHERE u.id = $1
+`
+
+type GetStorageUsageRow struct {
+	StorageQuota int64
+	UsedBytes    int64
+}
+
+// Usage is summed from files rather than read from used_storage, which
+// nothing keeps up to date.
+func (q *Queries) GetStorageUsage(ctx context.Context, id int32) (GetStorageUsageRow, error) {
+	row := q.db.QueryRowContext(ctx, getStorageUsage, id)
+	var i GetStorageUsageRow
+	err := row.Scan(&i.StorageQuota, &i.UsedBytes)
+	return i, err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, password_hash, is_verified, verification_token, verification_token_expiry, used_storage, created_at, updated_at FROM users WHERE email = $1
+SELECT id, email, password_hash, is_verified, verification_token, verification_token_expiry, used_storage, created_at, updated_at, role, storage_quota, is_disabled, failed_login_attempts, locked_until, pending_email, email_change_token_hash, email_change_cancel_hash, email_change_expiry, deletion_requested_at, deletion_scheduled_at, deletion_locked_until, token_version FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -86,12 +221,93 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UsedStorage,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Role,
+		&i.StorageQuota,
+		&i.IsDisabled,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.PendingEmail,
+		&i.EmailChangeTokenHash,
+		&i.EmailChangeCancelHash,
+		&i.EmailChangeExpiry,
+		&i.DeletionRequestedAt,
+		&i.DeletionScheduledAt,
+		&i.DeletionLockedUntil,
+		&i.TokenVersion,
+	)
+	return i, err
+}
+
+const getUserByEmailChangeCancelToken = `-- name: GetUserByEmailChangeCancelToken :one
+SELECT id, email, password_hash, is_verified, verification_token, verification_token_expiry, used_storage, created_at, updated_at, role, storage_quota, is_disabled, failed_login_attempts, locked_until, pending_email, email_change_token_hash, email_change_cancel_hash, email_change_expiry, deletion_requested_at, deletion_scheduled_at, deletion_locked_until, token_version FROM users WHERE email_change_cancel_hash = $1
+`
+
+func (q *Queries) GetUserByEmailChangeCancelToken(ctx context.Context, emailChangeCancelHash sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmailChangeCancelToken, emailChangeCancelHash)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.IsVerified,
+		&i.VerificationToken,
+		&i.VerificationTokenExpiry,
+		&i.UsedStorage,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.StorageQuota,
+		&i.IsDisabled,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.PendingEmail,
+		&i.EmailChangeTokenHash,
+		&i.EmailChangeCancelHash,
+		&i.EmailChangeExpiry,
+		&i.DeletionRequestedAt,
+		&i.DeletionScheduledAt,
+		&i.DeletionLockedUntil,
+		&i.TokenVersion,
+	)
+	return i, err
+}
+
+const getUserByEmailChangeToken = `-- name: GetUserByEmailChangeToken :one
+SELECT id, email, password_hash, is_verified, verification_token, verification_token_expiry, used_storage, created_at, updated_at, role, storage_quota, is_disabled, failed_login_attempts, locked_until, pending_email, email_change_token_hash, email_change_cancel_hash, email_change_expiry, deletion_requested_at, deletion_scheduled_at, deletion_locked_until, token_version FROM users WHERE email_change_token_hash = $1
+`
+
+func (q *Queries) GetUserByEmailChangeToken(ctx context.Context, emailChangeTokenHash sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmailChangeToken, emailChangeTokenHash)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.IsVerified,
+		&i.VerificationToken,
+		&i.VerificationTokenExpiry,
+		&i.UsedStorage,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Role,
+		&i.StorageQuota,
+		&i.IsDisabled,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.PendingEmail,
+		&i.EmailChangeTokenHash,
+		&i.EmailChangeCancelHash,
+		&i.EmailChangeExpiry,
+		&i.DeletionRequestedAt,
+		&i.DeletionScheduledAt,
+		&i.DeletionLockedUntil,
+		&i.TokenVersion,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, password_hash, is_verified, verification_token, verification_token_expiry, used_storage, created_at, updated_at FROM users WHERE id = $1
+SELECT id, email, password_hash, is_verified, verification_token, verification_token_expiry, used_storage, created_at, updated_at, role, storage_quota, is_disabled, failed_login_attempts, locked_until, pending_email, email_change_token_hash, email_change_cancel_hash, email_change_expiry, deletion_requested_at, deletion_scheduled_at, deletion_locked_until, token_version FROM users WHERE id = $1
 `
 
 func (q *Queries) GetUserByID(ctx context.Context, id int32) (User, error) {
@@ -107,12 +323,25 @@ func (q *Queries) GetUserByID(ctx context.Context, id int32) (User, error) {
 		&i.UsedStorage,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Role,
+		&i.StorageQuota,
+		&i.IsDisabled,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.PendingEmail,
+		&i.EmailChangeTokenHash,
+		&i.EmailChangeCancelHash,
+		&i.EmailChangeExpiry,
+		&i.DeletionRequestedAt,
+		&i.DeletionScheduledAt,
+		&i.DeletionLockedUntil,
+		&i.TokenVersion,
 	)
 	return i, err
 }
 
 const getUserByVerificationToken = `-- name: GetUserByVerificationToken :one
-SELECT id, email, password_hash, is_verified, verification_token, verification_token_expiry, used_storage, created_at, updated_at FROM users WHERE verification_token = $1
+SELECT id, email, password_hash, is_verified, verification_token, verification_token_expiry, used_storage, created_at, updated_at, role, storage_quota, is_disabled, failed_login_attempts, locked_until, pending_email, email_change_token_hash, email_change_cancel_hash, email_change_expiry, deletion_requested_at, deletion_scheduled_at, deletion_locked_until, token_version FROM users WHERE verification_token = $1
 `
 
 func (q *Queries) GetUserByVerificationToken(ctx context.Context, verificationToken sql.NullString) (User, error) {
@@ -128,10 +357,113 @@ func (q *Queries) GetUserByVerificationToken(ctx context.Context, verificationTo
 		&i.UsedStorage,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Role,
+		&i.StorageQuota,
+		&i.IsDisabled,
+		&i.FailedLoginAttempts,
+		&i.LockedUntil,
+		&i.PendingEmail,
+		&i.EmailChangeTokenHash,
+		&i.EmailChangeCancelHash,
+		&i.EmailChangeExpiry,
+		&i.DeletionRequestedAt,
+		&i.DeletionScheduledAt,
+		&i.DeletionLockedUntil,
+		&i.TokenVersion,
 	)
 	return i, err
 }
 
+const incrementFailedLogins = `-- name: IncrementFailedLogins :one
+UPDATE users
+SET failed_login_attempts = failed_login_attempts + 1
+WHERE id = $1
+RETURNING failed_login_attempts
+`
+
+func (q *Queries) IncrementFailedLogins(ctx context.Context, id int32) (int32, error) {
+	row := q.db.QueryRowContext(ctx, incrementFailedLogins, id)
+	var failed_login_attempts int32
+	err := row.Scan(&failed_login_attempts)
+	return failed_login_attempts, err
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, email, password_hash, is_verified, verification_token, verification_token_expiry, used_storage, created_at, updated_at, role, storage_quota, is_disabled, failed_login_attempts, locked_until, pending_email, email_change_token_hash, email_change_cancel_hash, email_change_expiry, deletion_requested_at, deletion_scheduled_at, deletion_locked_until, token_version FROM users
+ORDER BY id
+LIMIT $1 OFFSET $2
+`
+
+type ListUsersParams struct {
+	Limit  int32
+	Offset int32
+}
+
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.PasswordHash,
+			&i.IsVerified,
+			&i.VerificationToken,
+			&i.VerificationTokenExpiry,
+			&i.UsedStorage,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Role,
+			&i.StorageQuota,
+			&i.IsDisabled,
+			&i.FailedLoginAttempts,
+			&i.LockedUntil,
+			&i.PendingEmail,
+			&i.EmailChangeTokenHash,
+			&i.EmailChangeCancelHash,
+			&i.EmailChangeExpiry,
+			&i.DeletionRequestedAt,
+			&i.DeletionScheduledAt,
+			&i.DeletionLockedUntil,
+			&i.TokenVersion,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockUserUntil = `-- name: LockUserUntil :execrows
+UPDATE users
+SET locked_until = $2
+WHERE id = $1
+`
+
+type LockUserUntilParams struct {
+	ID          int32
+	LockedUntil sql.NullTime
+}
+
+func (q *Queries) LockUserUntil(ctx context.Context, arg LockUserUntilParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, lockUserUntil, arg.ID, arg.LockedUntil)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const markUserAsVerified = `-- name: MarkUserAsVerified :execrows
 UPDATE users
 SET is_verified = TRUE,
@@ -149,6 +481,207 @@ func (q *Queries) MarkUserAsVerified(ctx context.Context, id int32) (int64, erro
 	return result.RowsAffected()
 }
 
+const purgeUser = `-- name: PurgeUser :execrows
+DELETE FROM users
+WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+`
+
+func (q *Queries) PurgeUser(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const resetFailedLogins = `-- name: ResetFailedLogins :execrows
+UPDATE users
+SET failed_login_attempts = 0,
+    locked_until = NULL
+WHERE id = $1
+`
+
+func (q *Queries) ResetFailedLogins(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, resetFailedLogins, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const scheduleAccountDeletion = `-- name: ScheduleAccountDeletion :one
+UPDATE users
+SET deletion_requested_at = now(),
+    deletion_scheduled_at = now() + make_interval(secs => $1::float8),
+    deletion_locked_until = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $2
+RETURNING deletion_scheduled_at
+`
+
+type ScheduleAccountDeletionParams struct {
+	GraceSeconds float64
+	ID           int32
+}
+
+func (q *Queries) ScheduleAccountDeletion(ctx context.Context, arg ScheduleAccountDeletionParams) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, scheduleAccountDeletion, arg.GraceSeconds, arg.ID)
+	var deletion_scheduled_at sql.NullTime
+	err := row.Scan(&deletion_scheduled_at)
+	return deletion_scheduled_at, err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, email, password_hash, is_verified, verification_token, verification_token_expiry, used_storage, created_at, updated_at, role, storage_quota, is_disabled, failed_login_attempts, locked_until, pending_email, email_change_token_hash, email_change_cancel_hash, email_change_expiry, deletion_requested_at, deletion_scheduled_at, deletion_locked_until, token_version FROM users
+WHERE email ILIKE '%' || replace(replace(replace($1::text, '\', '\\'), '%', '\%'), '_', '\_') || '%' ESCAPE '\'
+ORDER BY id
+LIMIT $3 OFFSET $2
+`
+
+type SearchUsersParams struct {
+	Query  string
+	Offset int32
+	Limit  int32
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers, arg.Query, arg.Offset, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.PasswordHash,
+			&i.IsVerified,
+			&i.VerificationToken,
+			&i.VerificationTokenExpiry,
+			&i.UsedStorage,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Role,
+			&i.StorageQuota,
+			&i.IsDisabled,
+			&i.FailedLoginAttempts,
+			&i.LockedUntil,
+			&i.PendingEmail,
+			&i.EmailChangeTokenHash,
+			&i.EmailChangeCancelHash,
+			&i.EmailChangeExpiry,
+			&i.DeletionRequestedAt,
+			&i.DeletionScheduledAt,
+			&i.DeletionLockedUntil,
+			&i.TokenVersion,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setPendingEmailChange = `-- name: SetPendingEmailChange :execrows
+UPDATE users
+SET pending_email = $2,
+    email_change_token_hash = $3,
+    email_change_cancel_hash = $4,
+    email_change_expiry = $5,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type SetPendingEmailChangeParams struct {
+	ID                    int32
+	PendingEmail          sql.NullString
+	EmailChangeTokenHash  sql.NullString
+	EmailChangeCancelHash sql.NullString
+	EmailChangeExpiry     sql.NullTime
+}
+
+func (q *Queries) SetPendingEmailChange(ctx context.Context, arg SetPendingEmailChangeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setPendingEmailChange,
+		arg.ID,
+		arg.PendingEmail,
+		arg.EmailChangeTokenHash,
+		arg.EmailChangeCancelHash,
+		arg.EmailChangeExpiry,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserDisabled = `-- name: SetUserDisabled :execrows
+UPDATE users
+SET is_disabled = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type SetUserDisabledParams struct {
+	ID         int32
+	IsDisabled bool
+}
+
+func (q *Queries) SetUserDisabled(ctx context.Context, arg SetUserDisabledParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserDisabled, arg.ID, arg.IsDisabled)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserRole = `-- name: SetUserRole :execrows
+UPDATE users
+SET role = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type SetUserRoleParams struct {
+	ID   int32
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserRole, arg.ID, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserStorageQuota = `-- name: SetUserStorageQuota :execrows
+UPDATE users
+SET storage_quota = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type SetUserStorageQuotaParams struct {
+	ID           int32
+	StorageQuota int64
+}
+
+func (q *Queries) SetUserStorageQuota(ctx context.Context, arg SetUserStorageQuotaParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserStorageQuota, arg.ID, arg.StorageQuota)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateUsedStorage = `-- name: UpdateUsedStorage :execrows
 UPDATE users
 SET used_storage = $2,
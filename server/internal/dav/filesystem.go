@@ -0,0 +1,419 @@
+package dav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"golang.org/x/net/webdav"
+)
+
+var (
+	errIsDir     = errors.New("is a folder")
+	errNotDir    = errors.New("not a folder")
+	errReadOnly  = errors.New("opened for reading")
+	errWriteOnly = errors.New("opened for writing")
+)
+
+// fileSystem maps webdav.FileSystem onto one user's tree. The webdav package
+// tells errors apart with os.IsNotExist and friends, which don't unwrap, so
+// they are reported as *os.PathError.
+type fileSystem struct {
+	s      *Service
+	userID int32
+}
+
+func pathError(op, name string, err error) error {
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// resolve looks name up, reporting a missing or malformed path as
+// os.ErrNotExist.
+func (fs *fileSystem) resolve(ctx context.Context, op, name string) (paths.Entry, error) {
+	e, err := fs.s.paths.Resolve(ctx, fs.userID, name)
+	if errors.Is(err, paths.ErrNotFound) || errors.Is(err, paths.ErrInvalidPath) {
+		return paths.Entry{}, pathError(op, name, os.ErrNotExist)
+	}
+	if err != nil {
+		return paths.Entry{}, pathError(op, name, err)
+	}
+	return e, nil
+}
+
+// parent resolves the folder name would be created in. A missing parent is
+// os.ErrNotExist, which webdav answers with 409 Conflict as RFC 4918 asks.
+func (fs *fileSystem) parent(ctx context.Context, op, name string) (paths.Entry, string, error) {
+	clean := path.Clean("/" + name)
+	if clean == "/" {
+		return paths.Entry{}, "", pathError(op, name, os.ErrPermission)
+	}
+	dir, base := path.Split(clean)
+	parent, err := fs.resolve(ctx, op, dir)
+	if err != nil {
+		return paths.Entry{}, "", err
+	}
+	if parent.Kind != paths.KindFolder {
+		return paths.Entry{}, "", pathError(op, name, os.ErrNotExist)
+	}
+	return parent, base, nil
+}
+
+func (fs *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if _, err := fs.resolve(ctx, "mkdir", name); err == nil {
+		return pathError("mkdir", name, os.ErrExist)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	parent, base, err := fs.parent(ctx, "mkdir", name)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.s.folders.CreateFolder(ctx, fs.userID, base, paths.NullID(parent.ID)); err != nil {
+		return pathError("mkdir", name, err)
+	}
+	return nil
+}
+
+func (fs *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		e, err := fs.resolve(ctx, "open", name)
+		if err != nil {
+			return nil, err
+		}
+		if e.Kind == paths.KindFolder {
+			return &dirFile{fs: fs, ctx: ctx, entry: e}, nil
+		}
+		return &readFile{fs: fs, ctx: ctx, entry: e}, nil
+	}
+
+	// Writes replace the whole file; there is no way to patch stored content
+	if flag&os.O_APPEND != 0 {
+		return nil, pathError("open", name, os.ErrInvalid)
+	}
+	e, err := fs.resolve(ctx, "open", name)
+	switch {
+	case err == nil && e.Kind == paths.KindFolder:
+		return nil, pathError("open", name, errIsDir)
+	case err == nil && flag&os.O_EXCL != 0:
+		return nil, pathError("open", name, os.ErrExist)
+	case err != nil && !os.IsNotExist(err):
+		return nil, err
+	case err != nil && flag&os.O_CREATE == 0:
+		return nil, err
+	}
+	if _, _, err := fs.parent(ctx, "open", name); err != nil {
+		return nil, err
+	}
+	return &writeFile{fs: fs, ctx: ctx, name: path.Clean("/" + name)}, nil
+}
+
+func (fs *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	e, err := fs.resolve(ctx, "remove", name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case e.ID == nil:
+		return pathError("remove", name, os.ErrPermission)
+	case e.Kind == paths.KindFolder:
+		err = fs.s.folders.DeleteFolder(ctx, *e.ID, fs.userID)
+	default:
+		err = fs.s.files.DeleteFile(ctx, *e.ID, fs.userID)
+	}
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	return nil
+}
+
+// Rename leaves the ordering of the move and the rename to paths.Rename.
+func (fs *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	src, err := fs.resolve(ctx, "rename", oldName)
+	if err != nil {
+		return err
+	}
+	if src.ID == nil {
+		return pathError("rename", oldName, os.ErrPermission)
+	}
+	dest, base, err := fs.parent(ctx, "rename", newName)
+	if err != nil {
+		return err
+	}
+	if err := paths.Rename(ctx, fs.s.paths, fs.s.files, fs.s.folders, fs.userID, src, dest, base); err != nil {
+		return pathError("rename", oldName, err)
+	}
+	return nil
+}
+
+func (fs *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	e, err := fs.resolve(ctx, "stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{e}, nil
+}
+
+// fileInfo describes an entry from the database. It supplies the stored
+// content type, so listings don't open every file to sniff it.
+type fileInfo struct {
+	entry paths.Entry
+}
+
+func (fi fileInfo) Name() string {
+	if fi.entry.Name == "" {
+		return "/"
+	}
+	return fi.entry.Name
+}
+
+func (fi fileInfo) Size() int64 {
+	if fi.entry.SizeBytes == nil {
+		return 0
+	}
+	return *fi.entry.SizeBytes
+}
+
+func (fi fileInfo) Mode() os.FileMode {
+	if fi.IsDir() {
+		return os.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+func (fi fileInfo) ModTime() time.Time {
+	switch {
+	case fi.entry.UpdatedAt != nil:
+		return *fi.entry.UpdatedAt
+	case fi.entry.CreatedAt != nil:
+		return *fi.entry.CreatedAt
+	}
+	return time.Time{}
+}
+
+func (fi fileInfo) IsDir() bool      { return fi.entry.Kind == paths.KindFolder }
+func (fi fileInfo) Sys() interface{} { return nil }
+
+func (fi fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.entry.MimeType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.entry.MimeType, nil
+}
+
+// dirFile is an open folder.
+type dirFile struct {
+	fs       *fileSystem
+	ctx      context.Context
+	entry    paths.Entry
+	children []os.FileInfo
+	listed   bool
+}
+
+func (d *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.listed {
+		_, entries, err := d.fs.s.paths.List(d.ctx, d.fs.userID, d.entry.Path)
+		if err != nil {
+			return nil, pathError("readdir", d.entry.Path, err)
+		}
+		for _, e := range entries {
+			d.children = append(d.children, fileInfo{e})
+		}
+		d.listed = true
+	}
+
+	if count <= 0 {
+		out := d.children
+		d.children = nil
+		return out, nil
+	}
+	if len(d.children) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.children))
+	out := d.children[:n]
+	d.children = d.children[n:]
+	return out, nil
+}
+
+func (d *dirFile) Stat() (os.FileInfo, error)                   { return fileInfo{d.entry}, nil }
+func (d *dirFile) Read(p []byte) (int, error)                   { return 0, pathError("read", d.entry.Path, errIsDir) }
+func (d *dirFile) Write(p []byte) (int, error)                  { return 0, pathError("write", d.entry.Path, errIsDir) }
+func (d *dirFile) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+func (d *dirFile) Close() error                                 { return nil }
+
+// readFile is a file opened for reading. The content is only opened on the
+// first read, since PROPFIND and COPY open files just to stat them.
+type readFile struct {
+	fs    *fileSystem
+	ctx   context.Context
+	entry paths.Entry
+
+	body    io.ReadSeeker
+	closers []func() error
+}
+
+func (f *readFile) open() (io.ReadSeeker, error) {
+	if f.body != nil {
+		return f.body, nil
+	}
+	_, rc, err := f.fs.s.files.GetFileForDownload(f.ctx, *f.entry.ID, f.fs.userID)
+	if err != nil {
+		return nil, pathError("open", f.entry.Path, err)
+	}
+	f.closers = append(f.closers, rc.Close)
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		f.body = rs
+		return rs, nil
+	}
+
+	// Range requests need to seek; spool storage that can't
+	tmp, err := os.CreateTemp("", "dav-*")
+	if err != nil {
+		return nil, fmt.Errorf("buffering file: %w", err)
+	}
+	f.closers = append(f.closers, func() error { tmp.Close(); return os.Remove(tmp.Name()) })
+	if _, err := io.Copy(tmp, rc); err != nil {
+		return nil, fmt.Errorf("buffering file: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("buffering file: %w", err)
+	}
+	f.body = tmp
+	return tmp, nil
+}
+
+func (f *readFile) Read(p []byte) (int, error) {
+	body, err := f.open()
+	if err != nil {
+		return 0, err
+	}
+	return body.Read(p)
+}
+
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+	body, err := f.open()
+	if err != nil {
+		return 0, err
+	}
+	return body.Seek(offset, whence)
+}
+
+func (f *readFile) Close() error {
+	var first error
+	for i := len(f.closers) - 1; i >= 0; i-- {
+		if err := f.closers[i](); err != nil && first == nil {
+			first = err
+		}
+	}
+	f.closers = nil
+	return first
+}
+
+func (f *readFile) Stat() (os.FileInfo, error) { return fileInfo{f.entry}, nil }
+func (f *readFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, pathError("readdir", f.entry.Path, errNotDir)
+}
+func (f *readFile) Write(p []byte) (int, error) {
+	return 0, pathError("write", f.entry.Path, errReadOnly)
+}
+
+// writeFile collects a new file's content and stores it on Close, when its
+// size is known. Until then nothing in the tree changes. Writes stop once the
+// content outgrows the room left in the quota, so an upload that won't fit
+// is never buffered in full.
+type writeFile struct {
+	fs   *fileSystem
+	ctx  context.Context
+	name string
+
+	tmp    *os.File
+	size   int64
+	room   int64
+	failed bool
+	closed bool
+}
+
+func (f *writeFile) Write(p []byte) (int, error) {
+	if f.failed {
+		return 0, pathError("write", f.name, os.ErrClosed)
+	}
+	if f.tmp == nil {
+		room, err := paths.UploadRoom(f.ctx, f.fs.s.paths, f.fs.s.queries, f.fs.userID, f.name)
+		if err != nil {
+			f.failed = true
+			return 0, pathError("write", f.name, err)
+		}
+		tmp, err := os.CreateTemp("", "dav-*")
+		if err != nil {
+			f.failed = true
+			return 0, fmt.Errorf("buffering upload: %w", err)
+		}
+		f.tmp, f.room = tmp, room
+	}
+	if f.size+int64(len(p)) > f.room {
+		f.failed = true
+		if tripped, ok := f.ctx.Value(overQuotaKey{}).(*bool); ok {
+			*tripped = true
+		}
+		return 0, pathError("write", f.name, fmt.Errorf("%w: upload needs more than the %d bytes left", quota.ErrExceeded, f.room))
+	}
+	n, err := f.tmp.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		f.failed = true
+	}
+	return n, err
+}
+
+func (f *writeFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	if f.tmp != nil {
+		defer os.Remove(f.tmp.Name())
+		defer f.tmp.Close()
+	}
+	if f.failed {
+		// The write already reported why; store nothing
+		return nil
+	}
+
+	var body io.Reader = strings.NewReader("")
+	if f.tmp != nil {
+		if _, err := f.tmp.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("buffering upload: %w", err)
+		}
+		body = f.tmp
+	}
+
+	if err := f.fs.s.CheckUpload(f.ctx, f.fs.userID, f.name, f.size); err != nil {
+		return pathError("write", f.name, err)
+	}
+	if _, err := f.fs.s.paths.Upload(f.ctx, f.fs.userID, f.name, f.size, body); err != nil {
+		return pathError("write", f.name, err)
+	}
+	return nil
+}
+
+func (f *writeFile) Stat() (os.FileInfo, error) {
+	now := time.Now()
+	return fileInfo{paths.Entry{Kind: paths.KindFile, Name: path.Base(f.name), Path: f.name, SizeBytes: &f.size, UpdatedAt: &now}}, nil
+}
+
+func (f *writeFile) Read(p []byte) (int, error) { return 0, pathError("read", f.name, errWriteOnly) }
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, pathError("seek", f.name, errWriteOnly)
+}
+func (f *writeFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, pathError("readdir", f.name, errNotDir)
+}
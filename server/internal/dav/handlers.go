@@ -0,0 +1,113 @@
+package dav
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bellezhang119/cloud-storage/internal/content"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"golang.org/x/net/webdav"
+)
+
+type ServiceInterface interface {
+	FileSystem(userID int32) webdav.FileSystem
+	LockSystem(userID int32) webdav.LockSystem
+	CheckUpload(ctx context.Context, userID int32, p string, sizeBytes int64) error
+}
+
+// Handler serves every WebDAV method under Prefix. It must be mounted behind
+// BasicAuthMiddleware, since WebDAV clients can't fetch or refresh a JWT.
+func Handler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			// Refuse what won't fit before reading the body. Uploads without
+			// a length are cut off as soon as they outgrow the quota; webdav
+			// reports the failed write as 405, which is turned into a 507.
+			tripped := new(bool)
+			r = r.WithContext(context.WithValue(r.Context(), overQuotaKey{}, tripped))
+			w = &overQuotaWriter{ResponseWriter: w, tripped: tripped}
+			if r.ContentLength > 0 {
+				p := strings.TrimPrefix(r.URL.Path, Prefix)
+				if err := service.CheckUpload(r.Context(), userID, p, r.ContentLength); err != nil {
+					if errors.Is(err, quota.ErrExceeded) {
+						http.Error(w, err.Error(), http.StatusInsufficientStorage)
+						return
+					}
+					log.Printf("webdav quota check for user %d: %v", userID, err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+			}
+		case "MOVE":
+			// webdav answers a failed rename with 403, but a destination
+			// without a parent is a 409 Conflict under RFC 4918
+			if u, err := url.Parse(r.Header.Get("Destination")); err == nil && strings.HasPrefix(u.Path, Prefix+"/") {
+				dir := path.Dir(strings.TrimSuffix(strings.TrimPrefix(u.Path, Prefix), "/"))
+				if fi, err := service.FileSystem(userID).Stat(r.Context(), dir); (err != nil && os.IsNotExist(err)) || (err == nil && !fi.IsDir()) {
+					http.Error(w, "Destination has no parent collection", http.StatusConflict)
+					return
+				}
+			}
+		case http.MethodGet, http.MethodHead:
+			// Stored content is served with the same protections as a
+			// download, whatever the client makes of it
+			content.SetSafetyHeaders(w.Header())
+		}
+
+		h := &webdav.Handler{
+			Prefix:     Prefix,
+			FileSystem: service.FileSystem(userID),
+			LockSystem: service.LockSystem(userID),
+			Logger: func(r *http.Request, err error) {
+				if err != nil && !os.IsNotExist(err) && !os.IsExist(err) {
+					log.Printf("webdav %s %s for user %d: %v", r.Method, r.URL.Path, userID, err)
+				}
+			},
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// overQuotaKey marks a PUT's context with a flag that writeFile sets when the
+// upload runs out of quota.
+type overQuotaKey struct{}
+
+// overQuotaWriter answers 507 Insufficient Storage in place of the error
+// webdav would write once the flag is set.
+type overQuotaWriter struct {
+	http.ResponseWriter
+	tripped  *bool
+	replaced bool
+}
+
+func (w *overQuotaWriter) WriteHeader(code int) {
+	if *w.tripped && code >= http.StatusBadRequest {
+		w.replaced = true
+		http.Error(w.ResponseWriter, quota.ErrExceeded.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *overQuotaWriter) Write(p []byte) (int, error) {
+	if w.replaced {
+		// Drop webdav's own error text
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
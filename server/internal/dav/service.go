@@ -0,0 +1,80 @@
+// Package dav serves the user's tree over WebDAV (RFC 4918 classes 1 and 2)
+// so it can be mounted by file managers and editors. Every operation goes
+// through the file and folder services, keeping the database the source of
+// truth just as it is for the REST API.
+package dav
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+)
+
+// Prefix is where the WebDAV tree is mounted.
+const Prefix = "/dav"
+
+type PathService interface {
+	Resolve(ctx context.Context, userID int32, p string) (paths.Entry, error)
+	List(ctx context.Context, userID int32, p string) (paths.Entry, []paths.Entry, error)
+	Upload(ctx context.Context, userID int32, p string, sizeBytes int64, content io.Reader) (paths.Entry, error)
+}
+
+type FileService interface {
+	GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error)
+	GetFileForDownload(ctx context.Context, fileID uuid.UUID, userID int32) (database.File, io.ReadCloser, error)
+	DeleteFile(ctx context.Context, fileID uuid.UUID, userID int32) error
+	MoveFile(ctx context.Context, file database.File, destFolderID *uuid.UUID, userID int32) error
+	RenameFile(ctx context.Context, file database.File, newName string, userID int32) error
+}
+
+type FolderService interface {
+	CreateFolder(ctx context.Context, userID int32, name string, parentID uuid.NullUUID) (database.Folder, error)
+	DeleteFolder(ctx context.Context, folderID uuid.UUID, userID int32) error
+	MoveFolder(ctx context.Context, folderID uuid.UUID, newParentID uuid.NullUUID, userID int32) error
+	RenameFolder(ctx context.Context, folderID uuid.UUID, newName string, userID int32) error
+}
+
+type Service struct {
+	queries quota.Queries
+	paths   PathService
+	files   FileService
+	folders FolderService
+
+	mu    sync.Mutex
+	locks map[int32]webdav.LockSystem
+}
+
+func NewService(q quota.Queries, p PathService, files FileService, folders FolderService) *Service {
+	return &Service{queries: q, paths: p, files: files, folders: folders, locks: map[int32]webdav.LockSystem{}}
+}
+
+// FileSystem is the user's tree as a webdav.FileSystem.
+func (s *Service) FileSystem(userID int32) webdav.FileSystem {
+	return &fileSystem{s: s, userID: userID}
+}
+
+// LockSystem returns the user's locks. Lock names are paths, so each user
+// gets a lock system of their own. Locks live in memory: they are advisory
+// and short-lived, and clients renew or retake them after a restart.
+func (s *Service) LockSystem(userID int32) webdav.LockSystem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ls, ok := s.locks[userID]
+	if !ok {
+		ls = webdav.NewMemLS()
+		s.locks[userID] = ls
+	}
+	return ls
+}
+
+// CheckUpload fails with quota.ErrExceeded when storing sizeBytes at p would
+// take the user past their quota, allowing for the file it replaces.
+func (s *Service) CheckUpload(ctx context.Context, userID int32, p string, sizeBytes int64) error {
+	return paths.CheckUpload(ctx, s.paths, s.queries, userID, p, sizeBytes)
+}
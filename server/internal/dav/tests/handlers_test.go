@@ -0,0 +1,242 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/dav"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/paths/pathstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The suite follows the litmus groups (basic, copymove, props, locks),
+// driving the handler over a real in-memory tree so each step sees what the
+// previous one left behind.
+
+type client struct {
+	t       *testing.T
+	handler http.Handler
+}
+
+func newClient(t *testing.T, tree *pathstest.MemTree) *client {
+	service := dav.NewService(tree, tree, tree, tree)
+	return &client{t: t, handler: dav.Handler(service)}
+}
+
+func (c *client) do(method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, dav.Prefix+target, r)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(1)))
+	rec := httptest.NewRecorder()
+	c.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_Unauthorized(t *testing.T) {
+	handler := dav.Handler(dav.NewService(pathstest.NewMemTree(0), nil, nil, nil))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("PROPFIND", "/dav/", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestLitmus_Options(t *testing.T) {
+	c := newClient(t, pathstest.NewMemTree(1<<20))
+
+	rec := c.do(http.MethodOptions, "/", "", nil)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1, 2", rec.Header().Get("DAV"))
+	assert.Contains(t, rec.Header().Get("Allow"), "PROPFIND")
+}
+
+func TestLitmus_Mkcol(t *testing.T) {
+	tree := pathstest.NewMemTree(1 << 20)
+	c := newClient(t, tree)
+
+	assert.Equal(t, http.StatusCreated, c.do("MKCOL", "/docs", "", nil).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, c.do("MKCOL", "/docs", "", nil).Code, "mkcol over a collection")
+	assert.Equal(t, http.StatusConflict, c.do("MKCOL", "/missing/child", "", nil).Code, "mkcol without a parent")
+	assert.Equal(t, http.StatusUnsupportedMediaType, c.do("MKCOL", "/body", "<x/>", nil).Code, "mkcol with a body")
+
+	_, _, err := tree.List(context.Background(), 1, "/docs")
+	assert.NoError(t, err)
+}
+
+func TestLitmus_PutGetDelete(t *testing.T) {
+	tree := pathstest.NewMemTree(1 << 20)
+	c := newClient(t, tree)
+	require.Equal(t, http.StatusCreated, c.do("MKCOL", "/docs", "", nil).Code)
+
+	rec := c.do(http.MethodPut, "/docs/notes.txt", "first draft", nil)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("ETag"))
+
+	rec = c.do(http.MethodGet, "/docs/notes.txt", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "first draft", rec.Body.String())
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+
+	rec = c.do(http.MethodGet, "/docs/notes.txt", "", map[string]string{"Range": "bytes=6-10"})
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "draft", rec.Body.String())
+
+	// Overwriting replaces the content in place
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPut, "/docs/notes.txt", "second draft", nil).Code)
+	body, _ := tree.Lookup("/docs/notes.txt")
+	assert.Equal(t, "second draft", body)
+
+	assert.Equal(t, http.StatusConflict, c.do(http.MethodPut, "/nowhere/notes.txt", "x", nil).Code, "put without a parent")
+
+	assert.Equal(t, http.StatusNoContent, c.do(http.MethodDelete, "/docs", "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, c.do(http.MethodGet, "/docs/notes.txt", "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, c.do(http.MethodDelete, "/docs", "", nil).Code)
+}
+
+func TestLitmus_PutEmpty(t *testing.T) {
+	tree := pathstest.NewMemTree(1 << 20)
+	c := newClient(t, tree)
+
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPut, "/empty.txt", "", nil).Code)
+
+	body, ok := tree.Lookup("/empty.txt")
+	assert.True(t, ok)
+	assert.Empty(t, body)
+}
+
+func TestLitmus_CopyMove(t *testing.T) {
+	tree := pathstest.NewMemTree(1 << 20)
+	c := newClient(t, tree)
+	require.Equal(t, http.StatusCreated, c.do("MKCOL", "/src", "", nil).Code)
+	require.Equal(t, http.StatusCreated, c.do("MKCOL", "/src/sub", "", nil).Code)
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPut, "/src/sub/a.txt", "alpha", nil).Code)
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPut, "/b.txt", "beta", nil).Code)
+
+	// Copy a file, then refuse to copy over it without Overwrite
+	assert.Equal(t, http.StatusCreated, c.do("COPY", "/b.txt", "", map[string]string{"Destination": "/dav/copy.txt"}).Code)
+	assert.Equal(t, http.StatusPreconditionFailed,
+		c.do("COPY", "/src/sub/a.txt", "", map[string]string{"Destination": "/dav/copy.txt", "Overwrite": "F"}).Code)
+	body, _ := tree.Lookup("/copy.txt")
+	assert.Equal(t, "beta", body)
+
+	// Copying a collection takes its whole tree
+	assert.Equal(t, http.StatusCreated, c.do("COPY", "/src", "", map[string]string{"Destination": "/dav/dup"}).Code)
+	body, _ = tree.Lookup("/dup/sub/a.txt")
+	assert.Equal(t, "alpha", body)
+
+	// Move with a rename, replacing what's at the destination
+	assert.Equal(t, http.StatusNoContent,
+		c.do("MOVE", "/src/sub/a.txt", "", map[string]string{"Destination": "/dav/copy.txt", "Overwrite": "T"}).Code)
+	body, _ = tree.Lookup("/copy.txt")
+	assert.Equal(t, "alpha", body)
+	_, ok := tree.Lookup("/src/sub/a.txt")
+	assert.False(t, ok)
+
+	// Moving a collection into another
+	assert.Equal(t, http.StatusCreated, c.do("MOVE", "/dup", "", map[string]string{"Destination": "/dav/src/moved"}).Code)
+	body, _ = tree.Lookup("/src/moved/sub/a.txt")
+	assert.Equal(t, "alpha", body)
+
+	assert.Equal(t, http.StatusConflict,
+		c.do("MOVE", "/b.txt", "", map[string]string{"Destination": "/dav/nowhere/b.txt"}).Code, "move without a parent")
+	assert.Equal(t, http.StatusForbidden,
+		c.do("COPY", "/b.txt", "", map[string]string{"Destination": "/dav/b.txt"}).Code, "copy onto itself")
+}
+
+func TestLitmus_Propfind(t *testing.T) {
+	c := newClient(t, pathstest.NewMemTree(1<<20))
+	require.Equal(t, http.StatusCreated, c.do("MKCOL", "/docs", "", nil).Code)
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPut, "/docs/notes.txt", "hello", nil).Code)
+
+	rec := c.do("PROPFIND", "/docs", "", map[string]string{"Depth": "1"})
+
+	assert.Equal(t, http.StatusMultiStatus, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "<D:href>/dav/docs/</D:href>")
+	assert.Contains(t, body, "<D:href>/dav/docs/notes.txt</D:href>")
+	assert.Contains(t, body, "<D:getcontentlength>5</D:getcontentlength>")
+	assert.Contains(t, body, "<D:getcontenttype>text/plain; charset=utf-8</D:getcontenttype>")
+	assert.Contains(t, body, "<D:collection")
+
+	rec = c.do("PROPFIND", "/docs", "", map[string]string{"Depth": "0"})
+	assert.NotContains(t, rec.Body.String(), "notes.txt")
+
+	assert.Equal(t, http.StatusNotFound, c.do("PROPFIND", "/nope", "", nil).Code)
+}
+
+func TestLitmus_Locks(t *testing.T) {
+	tree := pathstest.NewMemTree(1 << 20)
+	c := newClient(t, tree)
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPut, "/locked.txt", "v1", nil).Code)
+
+	lockBody := `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner>litmus</D:owner></D:lockinfo>`
+	rec := c.do("LOCK", "/locked.txt", lockBody, map[string]string{"Timeout": "Second-60"})
+	require.Equal(t, http.StatusOK, rec.Code)
+	token := rec.Header().Get("Lock-Token")
+	require.NotEmpty(t, token)
+
+	// A second lock and an unconditional write are both refused
+	assert.Equal(t, http.StatusLocked, c.do("LOCK", "/locked.txt", lockBody, nil).Code)
+	assert.Equal(t, http.StatusLocked, c.do(http.MethodPut, "/locked.txt", "v2", nil).Code)
+	assert.Equal(t, http.StatusLocked, c.do(http.MethodDelete, "/locked.txt", "", nil).Code)
+
+	// The lock holder may write
+	assert.Equal(t, http.StatusCreated,
+		c.do(http.MethodPut, "/locked.txt", "v2", map[string]string{"If": "(" + token + ")"}).Code)
+	body, _ := tree.Lookup("/locked.txt")
+	assert.Equal(t, "v2", body)
+
+	assert.Equal(t, http.StatusNoContent, c.do("UNLOCK", "/locked.txt", "", map[string]string{"Lock-Token": token}).Code)
+	assert.Equal(t, http.StatusCreated, c.do(http.MethodPut, "/locked.txt", "v3", nil).Code)
+}
+
+func TestLitmus_LocksArePerUser(t *testing.T) {
+	service := dav.NewService(pathstest.NewMemTree(1<<20), nil, nil, nil)
+
+	assert.Same(t, service.LockSystem(1), service.LockSystem(1))
+	assert.NotSame(t, service.LockSystem(1), service.LockSystem(2))
+}
+
+func TestPut_OverQuota(t *testing.T) {
+	tree := pathstest.NewMemTree(10)
+	c := newClient(t, tree)
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPut, "/a.txt", "12345678", nil).Code)
+
+	assert.Equal(t, http.StatusInsufficientStorage, c.do(http.MethodPut, "/b.txt", "12345", nil).Code)
+	_, ok := tree.Lookup("/b.txt")
+	assert.False(t, ok)
+
+	// Replacing a file only counts the difference
+	assert.Equal(t, http.StatusCreated, c.do(http.MethodPut, "/a.txt", "1234567890", nil).Code)
+}
+
+func TestPut_OverQuotaWithoutLength(t *testing.T) {
+	tree := pathstest.NewMemTree(10)
+	c := newClient(t, tree)
+
+	// A chunked upload announces no length, so it can only be stopped on
+	// the way in
+	req := httptest.NewRequest(http.MethodPut, dav.Prefix+"/big.bin", io.NopCloser(strings.NewReader(strings.Repeat("x", 1<<20))))
+	req.ContentLength = -1
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(1)))
+	rec := httptest.NewRecorder()
+	c.handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInsufficientStorage, rec.Code)
+	_, ok := tree.Lookup("/big.bin")
+	assert.False(t, ok)
+}
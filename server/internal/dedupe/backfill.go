@@ -0,0 +1,107 @@
+package dedupe
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/jobs"
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+	"github.com/google/uuid"
+)
+
+// BackfillJobKind hashes files stored before hashes were taken at upload.
+// The migration that added the column queues the first run.
+const BackfillJobKind = "hash_backfill"
+
+const defaultBackfillBatch = 200
+
+// BackfillPayload is the resume point: files are walked in id order.
+type BackfillPayload struct {
+	After uuid.UUID `json:"after"`
+}
+
+type BackfillQueries interface {
+	ListFilesMissingHash(ctx context.Context, arg database.ListFilesMissingHashParams) ([]database.ListFilesMissingHashRow, error)
+	SetFileContentHash(ctx context.Context, arg database.SetFileContentHashParams) (int64, error)
+}
+
+type Enqueuer interface {
+	Enqueue(ctx context.Context, kind string, userID int32, payload any) (database.Job, error)
+}
+
+// Backfiller hashes one batch per job and queues the next, so no single job
+// outlives its lease however many files there are.
+type Backfiller struct {
+	queries   BackfillQueries
+	storage   storage.Storage
+	queue     Enqueuer
+	BatchSize int32
+}
+
+func NewBackfiller(q BackfillQueries, s storage.Storage, queue Enqueuer) *Backfiller {
+	return &Backfiller{queries: q, storage: s, queue: queue, BatchSize: defaultBackfillBatch}
+}
+
+// Handle is the jobs.HandlerFunc for BackfillJobKind. A retried run simply
+// finds fewer unhashed files after its cursor.
+func (b *Backfiller) Handle(ctx context.Context, job database.Job) error {
+	var payload BackfillPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %s", job.Payload))
+	}
+
+	rows, err := b.queries.ListFilesMissingHash(ctx, database.ListFilesMissingHashParams{
+		After:     payload.After,
+		BatchSize: b.BatchSize,
+	})
+	if err != nil {
+		return fmt.Errorf("listing unhashed files: %w", err)
+	}
+
+	for _, row := range rows {
+		sum, size, err := b.hash(row.UserID.Int32, row.FilePath)
+		if err != nil {
+			// A missing blob won't appear on retry; move on and leave it NULL
+			log.Printf("hash backfill: file %s: %v", row.ID, err)
+			continue
+		}
+		if _, err := b.queries.SetFileContentHash(ctx, database.SetFileContentHashParams{
+			ID:        row.ID,
+			Sha256:    sql.NullString{String: sum, Valid: true},
+			SizeBytes: size,
+		}); err != nil {
+			return fmt.Errorf("storing hash of %s: %w", row.ID, err)
+		}
+	}
+
+	if len(rows) < int(b.BatchSize) {
+		return nil
+	}
+	next := BackfillPayload{After: rows[len(rows)-1].ID}
+	if _, err := b.queue.Enqueue(ctx, BackfillJobKind, 0, next); err != nil {
+		return fmt.Errorf("queueing next batch: %w", err)
+	}
+	return nil
+}
+
+func (b *Backfiller) hash(userID int32, path string) (string, int64, error) {
+	content, err := b.storage.ReadFile(userID, path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer content.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, content)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,102 @@
+package dedupe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+)
+
+// All handlers here must be mounted behind AuthMiddleware.
+
+type ServiceInterface interface {
+	Groups(ctx context.Context, userID int32, limit, offset int32) (Page, error)
+	Resolve(ctx context.Context, userID int32, keepID uuid.UUID, remove []uuid.UUID) (Resolution, error)
+}
+
+type ResolveRequest struct {
+	KeepID uuid.UUID `json:"keep_id"`
+	// Copies to delete; empty deletes every copy but the kept one
+	RemoveIDs []uuid.UUID `json:"remove_ids"`
+}
+
+// ListDuplicatesHandler serves GET /duplicates?limit=&offset=.
+func ListDuplicatesHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		q := r.URL.Query()
+		limit := int32(DefaultPageSize)
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil || n <= 0 {
+				util.RespondWithError(w, http.StatusBadRequest, "Invalid limit")
+				return
+			}
+			limit = int32(min(n, MaxPageSize))
+		}
+		var offset int32
+		if v := q.Get("offset"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil || n < 0 {
+				util.RespondWithError(w, http.StatusBadRequest, "Invalid offset")
+				return
+			}
+			offset = int32(n)
+		}
+
+		page, err := service.Groups(r.Context(), userID, limit, offset)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, page)
+	}
+}
+
+// ResolveDuplicatesHandler serves POST /duplicates/resolve. Copies that could
+// not be deleted are listed under "failed" rather than failing the request.
+func ResolveDuplicatesHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req ResolveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if req.KeepID == uuid.Nil {
+			util.RespondWithError(w, http.StatusBadRequest, "keep_id is required")
+			return
+		}
+
+		res, err := service.Resolve(r.Context(), userID, req.KeepID, req.RemoveIDs)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrNotFound):
+				util.RespondWithError(w, http.StatusNotFound, err.Error())
+			case errors.Is(err, ErrNotHashed), errors.Is(err, ErrNotDuplicate):
+				util.RespondWithError(w, http.StatusConflict, err.Error())
+			default:
+				util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, res)
+	}
+}
@@ -0,0 +1,204 @@
+package dedupe
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+var (
+	ErrNotFound     = errors.New("file not found")
+	ErrNotHashed    = errors.New("file has not been hashed yet")
+	ErrNotDuplicate = errors.New("file is not a copy of the kept file")
+)
+
+type Queries interface {
+	GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error)
+	ListDuplicateGroups(ctx context.Context, arg database.ListDuplicateGroupsParams) ([]database.ListDuplicateGroupsRow, error)
+	ListFilesByHashes(ctx context.Context, arg database.ListFilesByHashesParams) ([]database.ListFilesByHashesRow, error)
+}
+
+// FileDeleter removes a file's row and stored content.
+type FileDeleter interface {
+	DeleteFile(ctx context.Context, fileID uuid.UUID, userID int32) error
+}
+
+type File struct {
+	ID        uuid.UUID  `json:"id"`
+	FolderID  *uuid.UUID `json:"folder_id"`
+	Name      string     `json:"name"`
+	Path      string     `json:"path"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Group is a set of files with identical content, oldest first.
+type Group struct {
+	SHA256           string `json:"sha256"`
+	SizeBytes        int64  `json:"size_bytes"`
+	Copies           int64  `json:"copies"`
+	ReclaimableBytes int64  `json:"reclaimable_bytes"`
+	Files            []File `json:"files"`
+}
+
+type Page struct {
+	Groups                []Group `json:"groups"`
+	TotalGroups           int64   `json:"total_groups"`
+	TotalReclaimableBytes int64   `json:"total_reclaimable_bytes"`
+}
+
+type Failure struct {
+	ID    uuid.UUID `json:"id"`
+	Error string    `json:"error"`
+}
+
+type Resolution struct {
+	Kept           uuid.UUID   `json:"kept"`
+	Removed        []uuid.UUID `json:"removed"`
+	ReclaimedBytes int64       `json:"reclaimed_bytes"`
+	Failed         []Failure   `json:"failed"`
+}
+
+type Service struct {
+	queries Queries
+	files   FileDeleter
+}
+
+func NewService(q Queries, files FileDeleter) *Service {
+	return &Service{queries: q, files: files}
+}
+
+// Groups lists the user's duplicate groups, largest savings first. Trashed
+// files are left out of both the groups and the totals.
+func (s *Service) Groups(ctx context.Context, userID int32, limit, offset int32) (Page, error) {
+	uID := sql.NullInt32{Int32: userID, Valid: true}
+
+	rows, err := s.queries.ListDuplicateGroups(ctx, database.ListDuplicateGroupsParams{
+		UserID: uID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		return Page{}, fmt.Errorf("listing duplicate groups: %w", err)
+	}
+
+	page := Page{Groups: make([]Group, 0, len(rows))}
+	if len(rows) == 0 {
+		return page, nil
+	}
+	page.TotalGroups = rows[0].TotalGroups
+	page.TotalReclaimableBytes = rows[0].TotalReclaimableBytes
+
+	hashes := make([]string, 0, len(rows))
+	for _, row := range rows {
+		hashes = append(hashes, row.Sha256)
+	}
+	files, err := s.queries.ListFilesByHashes(ctx, database.ListFilesByHashesParams{UserID: uID, Hashes: hashes})
+	if err != nil {
+		return Page{}, fmt.Errorf("listing duplicate files: %w", err)
+	}
+	byHash := map[string][]File{}
+	for _, f := range files {
+		byHash[f.Sha256] = append(byHash[f.Sha256], newFile(f))
+	}
+
+	for _, row := range rows {
+		page.Groups = append(page.Groups, Group{
+			SHA256:           row.Sha256,
+			SizeBytes:        row.SizeBytes,
+			Copies:           row.Copies,
+			ReclaimableBytes: row.ReclaimableBytes,
+			Files:            byHash[row.Sha256],
+		})
+	}
+	return page, nil
+}
+
+// Resolve keeps keepID and deletes the other copies of its content. With
+// remove empty every other copy goes; otherwise only the listed ones, each
+// of which must be a copy. Deletion carries on past a failed copy and
+// reports it in the result.
+func (s *Service) Resolve(ctx context.Context, userID int32, keepID uuid.UUID, remove []uuid.UUID) (Resolution, error) {
+	keep, err := s.queries.GetFileByID(ctx, keepID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Resolution{}, ErrNotFound
+		}
+		return Resolution{}, fmt.Errorf("fetching file: %w", err)
+	}
+	if keep.UserID.Int32 != userID || keep.TrashedAt.Valid {
+		return Resolution{}, ErrNotFound
+	}
+	if !keep.Sha256.Valid {
+		return Resolution{}, ErrNotHashed
+	}
+
+	copies, err := s.queries.ListFilesByHashes(ctx, database.ListFilesByHashesParams{
+		UserID: sql.NullInt32{Int32: userID, Valid: true},
+		Hashes: []string{keep.Sha256.String},
+	})
+	if err != nil {
+		return Resolution{}, fmt.Errorf("listing copies: %w", err)
+	}
+	group := map[uuid.UUID]int64{}
+	for _, c := range copies {
+		if c.ID != keep.ID && c.SizeBytes == keep.SizeBytes {
+			group[c.ID] = c.SizeBytes
+		}
+	}
+
+	var targets []uuid.UUID
+	if len(remove) == 0 {
+		for _, c := range copies {
+			if _, ok := group[c.ID]; ok {
+				targets = append(targets, c.ID)
+			}
+		}
+	} else {
+		seen := map[uuid.UUID]bool{}
+		for _, id := range remove {
+			if _, ok := group[id]; !ok {
+				return Resolution{}, fmt.Errorf("%w: %s", ErrNotDuplicate, id)
+			}
+			if !seen[id] {
+				seen[id] = true
+				targets = append(targets, id)
+			}
+		}
+	}
+
+	res := Resolution{Kept: keep.ID, Removed: []uuid.UUID{}, Failed: []Failure{}}
+	for _, id := range targets {
+		if err := s.files.DeleteFile(ctx, id, userID); err != nil {
+			res.Failed = append(res.Failed, Failure{ID: id, Error: err.Error()})
+			continue
+		}
+		res.Removed = append(res.Removed, id)
+		res.ReclaimedBytes += group[id]
+	}
+	return res, nil
+}
+
+func newFile(f database.ListFilesByHashesRow) File {
+	res := File{
+		ID:        f.ID,
+		Name:      f.Name,
+		Path:      f.FilePath,
+		CreatedAt: f.CreatedAt.Time,
+		UpdatedAt: f.UpdatedAt.Time,
+	}
+	if f.FolderID.Valid {
+		res.FolderID = &f.FolderID.UUID
+	}
+	return res
+}
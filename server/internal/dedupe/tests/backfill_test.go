@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/dedupe"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockBackfillQueries struct {
+	mock.Mock
+}
+
+func (m *MockBackfillQueries) ListFilesMissingHash(ctx context.Context, arg database.ListFilesMissingHashParams) ([]database.ListFilesMissingHashRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ListFilesMissingHashRow), args.Error(1)
+}
+
+func (m *MockBackfillQueries) SetFileContentHash(ctx context.Context, arg database.SetFileContentHashParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockQueue struct {
+	mock.Mock
+}
+
+func (m *MockQueue) Enqueue(ctx context.Context, kind string, userID int32, payload any) (database.Job, error) {
+	args := m.Called(ctx, kind, userID, payload)
+	return args.Get(0).(database.Job), args.Error(1)
+}
+
+type MockStorage struct {
+	mock.Mock
+}
+
+func (m *MockStorage) SaveFile(userID int32, path string, content io.Reader) error {
+	return m.Called(userID, path, content).Error(0)
+}
+
+func (m *MockStorage) ReadFile(userID int32, path string) (io.ReadCloser, error) {
+	args := m.Called(userID, path)
+	reader, _ := args.Get(0).(io.ReadCloser)
+	return reader, args.Error(1)
+}
+
+func (m *MockStorage) DeleteFile(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) CreateDirectory(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) DeleteDirectory(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) MoveFile(userID int32, oldPath, newPath string) error {
+	return m.Called(userID, oldPath, newPath).Error(0)
+}
+
+func (m *MockStorage) CopyFile(userID int32, srcPath, dstPath string) error {
+	return m.Called(userID, srcPath, dstPath).Error(0)
+}
+
+func (m *MockStorage) MoveDirectory(userID int32, oldPath, newPath string) error {
+	return m.Called(userID, oldPath, newPath).Error(0)
+}
+
+func (m *MockStorage) ZipFolder(userID int32, folderPath string, w io.Writer) error {
+	return m.Called(userID, folderPath, w).Error(0)
+}
+
+func (m *MockStorage) ZipPaths(userID int32, paths []string, w io.Writer) error {
+	return m.Called(userID, paths, w).Error(0)
+}
+
+func (m *MockStorage) DeleteUserData(userID int32) error {
+	return m.Called(userID).Error(0)
+}
+
+func hashOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestBackfill_HashesBatchAndQueuesNext(t *testing.T) {
+	mockQueries := new(MockBackfillQueries)
+	mockStorage := new(MockStorage)
+	mockQueue := new(MockQueue)
+	b := dedupe.NewBackfiller(mockQueries, mockStorage, mockQueue)
+	b.BatchSize = 2
+	first, second := uuid.New(), uuid.New()
+	uID := sql.NullInt32{Int32: 1, Valid: true}
+
+	mockQueries.On("ListFilesMissingHash", mock.Anything, database.ListFilesMissingHashParams{After: uuid.Nil, BatchSize: 2}).
+		Return([]database.ListFilesMissingHashRow{
+			{ID: first, UserID: uID, FilePath: "a.txt"},
+			{ID: second, UserID: uID, FilePath: "gone.txt"},
+		}, nil)
+	mockStorage.On("ReadFile", int32(1), "a.txt").Return(io.NopCloser(strings.NewReader("hello")), nil)
+	mockStorage.On("ReadFile", int32(1), "gone.txt").Return(nil, errors.New("no such file"))
+	mockQueries.On("SetFileContentHash", mock.Anything, database.SetFileContentHashParams{
+		ID:        first,
+		Sha256:    sql.NullString{String: hashOf("hello"), Valid: true},
+		SizeBytes: 5,
+	}).Return(int64(1), nil)
+	mockQueue.On("Enqueue", mock.Anything, dedupe.BackfillJobKind, int32(0), dedupe.BackfillPayload{After: second}).
+		Return(database.Job{}, nil)
+
+	err := b.Handle(context.Background(), database.Job{Payload: json.RawMessage(`{}`)})
+
+	assert.NoError(t, err)
+	mockQueries.AssertExpectations(t)
+	mockQueue.AssertExpectations(t)
+}
+
+func TestBackfill_LastBatchStopsTheChain(t *testing.T) {
+	mockQueries := new(MockBackfillQueries)
+	mockQueue := new(MockQueue)
+	b := dedupe.NewBackfiller(mockQueries, new(MockStorage), mockQueue)
+	after := uuid.New()
+
+	mockQueries.On("ListFilesMissingHash", mock.Anything, database.ListFilesMissingHashParams{After: after, BatchSize: b.BatchSize}).
+		Return([]database.ListFilesMissingHashRow{}, nil)
+
+	payload, _ := json.Marshal(dedupe.BackfillPayload{After: after})
+	err := b.Handle(context.Background(), database.Job{Payload: payload})
+
+	assert.NoError(t, err)
+	mockQueue.AssertNotCalled(t, "Enqueue", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/dedupe"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockQueries) ListDuplicateGroups(ctx context.Context, arg database.ListDuplicateGroupsParams) ([]database.ListDuplicateGroupsRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ListDuplicateGroupsRow), args.Error(1)
+}
+
+func (m *MockQueries) ListFilesByHashes(ctx context.Context, arg database.ListFilesByHashesParams) ([]database.ListFilesByHashesRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ListFilesByHashesRow), args.Error(1)
+}
+
+type MockFiles struct {
+	mock.Mock
+}
+
+func (m *MockFiles) DeleteFile(ctx context.Context, fileID uuid.UUID, userID int32) error {
+	return m.Called(ctx, fileID, userID).Error(0)
+}
+
+var uID = sql.NullInt32{Int32: 1, Valid: true}
+
+func TestGroups(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := dedupe.NewService(mockQueries, new(MockFiles))
+	a, b := uuid.New(), uuid.New()
+	h := hashOf("report")
+
+	mockQueries.On("ListDuplicateGroups", mock.Anything, database.ListDuplicateGroupsParams{UserID: uID, Limit: 10, Offset: 0}).
+		Return([]database.ListDuplicateGroupsRow{{Sha256: h, SizeBytes: 6, Copies: 2, ReclaimableBytes: 6, TotalGroups: 1, TotalReclaimableBytes: 6}}, nil)
+	mockQueries.On("ListFilesByHashes", mock.Anything, database.ListFilesByHashesParams{UserID: uID, Hashes: []string{h}}).
+		Return([]database.ListFilesByHashesRow{
+			{ID: a, Name: "report.pdf", FilePath: "report.pdf", SizeBytes: 6, Sha256: h},
+			{ID: b, Name: "report.pdf", FilePath: "old/report.pdf", SizeBytes: 6, Sha256: h},
+		}, nil)
+
+	page, err := svc.Groups(context.Background(), 1, 10, 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), page.TotalReclaimableBytes)
+	assert.Len(t, page.Groups, 1)
+	assert.Len(t, page.Groups[0].Files, 2)
+	assert.Equal(t, "old/report.pdf", page.Groups[0].Files[1].Path)
+}
+
+func TestResolve_RemovesEveryOtherCopy(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockFiles := new(MockFiles)
+	svc := dedupe.NewService(mockQueries, mockFiles)
+	keep, b, c := uuid.New(), uuid.New(), uuid.New()
+	h := hashOf("photo")
+
+	mockQueries.On("GetFileByID", mock.Anything, keep).
+		Return(database.File{ID: keep, UserID: uID, SizeBytes: 100, Sha256: sql.NullString{String: h, Valid: true}}, nil)
+	mockQueries.On("ListFilesByHashes", mock.Anything, database.ListFilesByHashesParams{UserID: uID, Hashes: []string{h}}).
+		Return([]database.ListFilesByHashesRow{
+			{ID: keep, SizeBytes: 100, Sha256: h},
+			{ID: b, SizeBytes: 100, Sha256: h},
+			{ID: c, SizeBytes: 100, Sha256: h},
+		}, nil)
+	mockFiles.On("DeleteFile", mock.Anything, b, int32(1)).Return(nil)
+	mockFiles.On("DeleteFile", mock.Anything, c, int32(1)).Return(errors.New("disk error"))
+
+	res, err := svc.Resolve(context.Background(), 1, keep, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{b}, res.Removed)
+	assert.Equal(t, int64(100), res.ReclaimedBytes)
+	assert.Len(t, res.Failed, 1)
+	assert.Equal(t, c, res.Failed[0].ID)
+	mockFiles.AssertNotCalled(t, "DeleteFile", mock.Anything, keep, mock.Anything)
+}
+
+func TestResolve_RejectsFileOutsideGroup(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockFiles := new(MockFiles)
+	svc := dedupe.NewService(mockQueries, mockFiles)
+	keep, stranger := uuid.New(), uuid.New()
+	h := hashOf("photo")
+
+	mockQueries.On("GetFileByID", mock.Anything, keep).
+		Return(database.File{ID: keep, UserID: uID, SizeBytes: 100, Sha256: sql.NullString{String: h, Valid: true}}, nil)
+	mockQueries.On("ListFilesByHashes", mock.Anything, mock.Anything).
+		Return([]database.ListFilesByHashesRow{{ID: keep, SizeBytes: 100, Sha256: h}}, nil)
+
+	_, err := svc.Resolve(context.Background(), 1, keep, []uuid.UUID{stranger})
+
+	assert.ErrorIs(t, err, dedupe.ErrNotDuplicate)
+	mockFiles.AssertNotCalled(t, "DeleteFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestResolve_NotHashedYet(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := dedupe.NewService(mockQueries, new(MockFiles))
+	keep := uuid.New()
+
+	mockQueries.On("GetFileByID", mock.Anything, keep).Return(database.File{ID: keep, UserID: uID}, nil)
+
+	_, err := svc.Resolve(context.Background(), 1, keep, nil)
+
+	assert.ErrorIs(t, err, dedupe.ErrNotHashed)
+}
+
+func TestResolve_OtherUsersFile(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := dedupe.NewService(mockQueries, new(MockFiles))
+	keep := uuid.New()
+
+	mockQueries.On("GetFileByID", mock.Anything, keep).
+		Return(database.File{ID: keep, UserID: sql.NullInt32{Int32: 2, Valid: true}}, nil)
+
+	_, err := svc.Resolve(context.Background(), 1, keep, nil)
+
+	assert.ErrorIs(t, err, dedupe.ErrNotFound)
+}
@@ -0,0 +1,117 @@
+package email
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type Enqueuer interface {
+	Enqueue(ctx context.Context, msg Message) error
+}
+
+// Mailer renders the application's emails and queues them for delivery.
+// Links are built from the public base URL so they work behind a proxy.
+type Mailer struct {
+	renderer *Renderer
+	outbox   Enqueuer
+	baseURL  string
+}
+
+func NewMailer(outbox Enqueuer, baseURL string) (*Mailer, error) {
+	renderer, err := NewRenderer()
+	if err != nil {
+		return nil, err
+	}
+	return &Mailer{
+		renderer: renderer,
+		outbox:   outbox,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+	}, nil
+}
+
+// BaseURLFromEnv returns PUBLIC_BASE_URL, or a localhost URL on PORT when it
+// isn't set.
+func BaseURLFromEnv() string {
+	if base := os.Getenv("PUBLIC_BASE_URL"); base != "" {
+		return base
+	}
+	return "http://localhost" + os.Getenv("PORT")
+}
+
+// Link builds an absolute URL for a path on the public site.
+func (m *Mailer) Link(path string, query url.Values) string {
+	link := m.baseURL + "/" + strings.TrimLeft(path, "/")
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
+
+func (m *Mailer) send(ctx context.Context, template, to string, data any) error {
+	msg, err := m.renderer.Render(template, to, data)
+	if err != nil {
+		return err
+	}
+	return m.outbox.Enqueue(ctx, msg)
+}
+
+func (m *Mailer) SendVerification(ctx context.Context, to, token string) error {
+	return m.send(ctx, TemplateVerification, to, VerificationData{
+		Link: m.Link("/auth/verify", url.Values{"token": {token}}),
+	})
+}
+
+func (m *Mailer) SendPasswordReset(ctx context.Context, to, token string) error {
+	return m.send(ctx, TemplatePasswordReset, to, PasswordResetData{
+		Link: m.Link("/auth/reset-password", url.Values{"token": {token}}),
+	})
+}
+
+func (m *Mailer) SendShareNotification(ctx context.Context, to, sharedBy, itemName, permission, path string) error {
+	return m.send(ctx, TemplateShareNotification, to, ShareNotificationData{
+		SharedBy:   sharedBy,
+		ItemName:   itemName,
+		Permission: permission,
+		Link:       m.Link(path, nil),
+	})
+}
+
+func (m *Mailer) SendQuotaWarning(ctx context.Context, to string, usedBytes, quotaBytes int64) error {
+	percent := 100
+	if quotaBytes > 0 {
+		percent = int(usedBytes * 100 / quotaBytes)
+	}
+	return m.send(ctx, TemplateQuotaWarning, to, QuotaWarningData{
+		UsedBytes:  usedBytes,
+		QuotaBytes: quotaBytes,
+		Percent:    percent,
+		Link:       m.Link("/", nil),
+	})
+}
+
+// SendEmailChange asks the new address to confirm the change and tells the
+// old address how to cancel it.
+func (m *Mailer) SendEmailChange(ctx context.Context, oldEmail, newEmail, confirmToken, cancelToken string) error {
+	if err := m.send(ctx, TemplateEmailChange, newEmail, EmailChangeData{
+		Link: m.Link("/auth/email-change/confirm", url.Values{"token": {confirmToken}}),
+	}); err != nil {
+		return err
+	}
+
+	return m.send(ctx, TemplateEmailChangeNotice, oldEmail, EmailChangeNoticeData{
+		NewEmail:   newEmail,
+		CancelLink: m.Link("/auth/email-change/cancel", url.Values{"token": {cancelToken}}),
+	})
+}
+
+// SendAccountDeletionScheduled confirms a self-service deletion request and
+// says when the grace period ends.
+func (m *Mailer) SendAccountDeletionScheduled(ctx context.Context, to string, scheduledAt time.Time) error {
+	return m.send(ctx, TemplateAccountDeletion, to, AccountDeletionData{
+		ScheduledAt: scheduledAt.UTC(),
+		Link:        m.Link("/", nil),
+	})
+}
@@ -0,0 +1,145 @@
+package email
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/jobs"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPollInterval = 5 * time.Second
+	defaultBatchSize    = 20
+	defaultMaxAttempts  = 8
+	defaultLease        = 5 * time.Minute
+)
+
+type Queries interface {
+	EnqueueEmail(ctx context.Context, arg database.EnqueueEmailParams) (database.EmailOutbox, error)
+	ClaimDueEmails(ctx context.Context, arg database.ClaimDueEmailsParams) ([]database.EmailOutbox, error)
+	MarkEmailSent(ctx context.Context, id uuid.UUID) (int64, error)
+	RescheduleEmail(ctx context.Context, arg database.RescheduleEmailParams) (int64, error)
+	MarkEmailFailed(ctx context.Context, arg database.MarkEmailFailedParams) (int64, error)
+}
+
+// Outbox queues messages in the email_outbox table. Queuing is a single
+// insert, so request handlers never wait on the mail server.
+type Outbox struct {
+	queries Queries
+}
+
+func NewOutbox(q Queries) *Outbox {
+	return &Outbox{queries: q}
+}
+
+func (o *Outbox) Enqueue(ctx context.Context, msg Message) error {
+	_, err := o.queries.EnqueueEmail(ctx, database.EnqueueEmailParams{
+		Template:  msg.Template,
+		ToAddress: msg.To,
+		Subject:   msg.Subject,
+		TextBody:  msg.TextBody,
+		HtmlBody:  msg.HTMLBody,
+	})
+	if err != nil {
+		return fmt.Errorf("queueing %s email: %w", msg.Template, err)
+	}
+	return nil
+}
+
+// Worker drains the outbox, retrying failed sends with exponential backoff
+// until MaxAttempts is reached.
+type Worker struct {
+	queries      Queries
+	sender       Sender
+	PollInterval time.Duration
+	BatchSize    int32
+	MaxAttempts  int32
+	Lease        time.Duration
+}
+
+func NewWorker(q Queries, s Sender) *Worker {
+	return &Worker{
+		queries:      q,
+		sender:       s,
+		PollInterval: defaultPollInterval,
+		BatchSize:    defaultBatchSize,
+		MaxAttempts:  defaultMaxAttempts,
+		Lease:        defaultLease,
+	}
+}
+
+// Run polls until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.ProcessBatch(ctx); err != nil {
+			log.Printf("email outbox: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessBatch sends one batch of due messages and returns how many were sent.
+func (w *Worker) ProcessBatch(ctx context.Context) (int, error) {
+	emails, err := w.queries.ClaimDueEmails(ctx, database.ClaimDueEmailsParams{
+		LeaseSeconds: w.Lease.Seconds(),
+		BatchSize:    w.BatchSize,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("claiming emails: %w", err)
+	}
+
+	sent := 0
+	for _, e := range emails {
+		msg := Message{
+			Template: e.Template,
+			To:       e.ToAddress,
+			Subject:  e.Subject,
+			TextBody: e.TextBody,
+			HTMLBody: e.HtmlBody,
+		}
+
+		sendErr := w.sender.Send(ctx, msg)
+		if sendErr == nil {
+			if _, err := w.queries.MarkEmailSent(ctx, e.ID); err != nil {
+				log.Printf("email outbox: marking %s sent: %v", e.ID, err)
+			}
+			sent++
+			continue
+		}
+
+		lastErr := sql.NullString{String: sendErr.Error(), Valid: true}
+		if e.Attempts >= w.MaxAttempts {
+			log.Printf("email outbox: giving up on %s to %s after %d attempts: %v", e.Template, e.ToAddress, e.Attempts, sendErr)
+			if _, err := w.queries.MarkEmailFailed(ctx, database.MarkEmailFailedParams{
+				ID:        e.ID,
+				LastError: lastErr,
+			}); err != nil {
+				log.Printf("email outbox: marking %s failed: %v", e.ID, err)
+			}
+			continue
+		}
+
+		if _, err := w.queries.RescheduleEmail(ctx, database.RescheduleEmailParams{
+			ID:           e.ID,
+			DelaySeconds: jobs.Backoff(e.Attempts).Seconds(),
+			LastError:    lastErr,
+		}); err != nil {
+			log.Printf("email outbox: rescheduling %s: %v", e.ID, err)
+		}
+	}
+
+	return sent, nil
+}
@@ -0,0 +1,159 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type SMTPSender struct {
+	Host     string
+	Port     string
+	From     string
+	Password string
+}
+
+// NewSMTPSenderFromEnv reads the same SMTP_* variables as util.SendEmail.
+func NewSMTPSenderFromEnv() (*SMTPSender, error) {
+	s := &SMTPSender{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		From:     os.Getenv("SMTP_FROM"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+	if s.Host == "" || s.Port == "" || s.From == "" || s.Password == "" {
+		return nil, fmt.Errorf("missing SMTP configuration in environment variables")
+	}
+	return s, nil
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	raw, err := buildMIME(s.From, msg)
+	if err != nil {
+		return err
+	}
+
+	auth := smtp.PlainAuth("", s.From, s.Password, s.Host)
+	return smtp.SendMail(s.Host+":"+s.Port, auth, s.From, []string{msg.To}, raw)
+}
+
+// LogSender only logs who each message was for, so a server without mail
+// configured still starts; nothing is delivered.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("email: not sending %s to %s, no mail server is configured", msg.Template, headerValue(msg.To))
+	return nil
+}
+
+// FileSender writes each message as an .eml file instead of sending it, for
+// local development without a mail server.
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+func NewFileSender(dir, from string) *FileSender {
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	return &FileSender{Dir: dir, From: from}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._@-]+`)
+
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	raw, err := buildMIME(s.From, msg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("creating email dump directory %s: %w", s.Dir, err)
+	}
+
+	name := fmt.Sprintf("%s-%s-%s.eml",
+		time.Now().UTC().Format("20060102T150405.000"),
+		msg.Template,
+		unsafeFileChars.ReplaceAllString(msg.To, "_"),
+	)
+	full := filepath.Join(s.Dir, name)
+	if err := os.WriteFile(full, raw, 0644); err != nil {
+		return fmt.Errorf("writing email to %s: %w", full, err)
+	}
+	return nil
+}
+
+// buildMIME renders a multipart/alternative message with text and HTML parts.
+func buildMIME(from string, msg Message) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.TextBody},
+		{"text/html; charset=utf-8", msg.HTMLBody},
+	}
+	for _, p := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating MIME part: %w", err)
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write([]byte(p.content)); err != nil {
+			return nil, fmt.Errorf("writing MIME part: %w", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("writing MIME part: %w", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("closing MIME body: %w", err)
+	}
+
+	var raw bytes.Buffer
+	fmt.Fprintf(&raw, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&raw, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&raw, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&raw, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&raw, "Message-ID: <%s@cloud-storage>\r\n", messageID())
+	fmt.Fprintf(&raw, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&raw, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+	raw.Write(body.Bytes())
+
+	return raw.Bytes(), nil
+}
+
+// headerValue drops line breaks, which would let a value end its header
+// and add others of its own.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+func messageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
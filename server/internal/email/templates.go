@@ -0,0 +1,157 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+const (
+	TemplateVerification      = "verification"
+	TemplatePasswordReset     = "password_reset"
+	TemplateShareNotification = "share_notification"
+	TemplateQuotaWarning      = "quota_warning"
+	TemplateEmailChange       = "email_change_confirm"
+	TemplateEmailChangeNotice = "email_change_notice"
+	TemplateAccountDeletion   = "account_deletion"
+)
+
+var templateNames = []string{
+	TemplateVerification,
+	TemplatePasswordReset,
+	TemplateShareNotification,
+	TemplateQuotaWarning,
+	TemplateEmailChange,
+	TemplateEmailChangeNotice,
+	TemplateAccountDeletion,
+}
+
+type VerificationData struct {
+	Link string
+}
+
+type PasswordResetData struct {
+	Link string
+}
+
+type ShareNotificationData struct {
+	SharedBy   string
+	ItemName   string
+	Permission string
+	Link       string
+}
+
+type QuotaWarningData struct {
+	UsedBytes  int64
+	QuotaBytes int64
+	Percent    int
+	Link       string
+}
+
+type EmailChangeData struct {
+	Link string
+}
+
+type EmailChangeNoticeData struct {
+	NewEmail   string
+	CancelLink string
+}
+
+type AccountDeletionData struct {
+	ScheduledAt time.Time
+	Link        string
+}
+
+// Message is a fully rendered email ready to be queued or sent.
+type Message struct {
+	Template string
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+// Renderer turns template data into a Message. Each template has a text
+// version, which also defines the subject, and an HTML version wrapped in
+// the shared layout.
+type Renderer struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+var templateFuncs = map[string]any{
+	"humanBytes": humanBytes,
+}
+
+func NewRenderer() (*Renderer, error) {
+	r := &Renderer{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+
+	for _, name := range templateNames {
+		t, err := texttemplate.New(name+".txt.tmpl").
+			Funcs(templateFuncs).
+			ParseFS(templateFS, "templates/"+name+".txt.tmpl")
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s text template: %w", name, err)
+		}
+		r.text[name] = t
+
+		h, err := htmltemplate.New("layout.html.tmpl").
+			Funcs(templateFuncs).
+			ParseFS(templateFS, "templates/layout.html.tmpl", "templates/"+name+".html.tmpl")
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s html template: %w", name, err)
+		}
+		r.html[name] = h
+	}
+
+	return r, nil
+}
+
+func (r *Renderer) Render(name, to string, data any) (Message, error) {
+	textTmpl, ok := r.text[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("rendering %s subject: %w", name, err)
+	}
+	if err := textTmpl.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("rendering %s text body: %w", name, err)
+	}
+	if err := r.html[name].ExecuteTemplate(&html, "layout", data); err != nil {
+		return Message{}, fmt.Errorf("rendering %s html body: %w", name, err)
+	}
+
+	return Message{
+		Template: name,
+		To:       to,
+		Subject:  strings.TrimSpace(subject.String()),
+		TextBody: text.String(),
+		HTMLBody: html.String(),
+	}, nil
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/email"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingOutbox struct {
+	messages []email.Message
+}
+
+func (o *recordingOutbox) Enqueue(ctx context.Context, msg email.Message) error {
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+func TestMailer_SendVerificationUsesBaseURL(t *testing.T) {
+	outbox := &recordingOutbox{}
+	mailer, err := email.NewMailer(outbox, "https://files.example.com/")
+	assert.NoError(t, err)
+
+	err = mailer.SendVerification(context.Background(), "a@b.com", "tok en")
+	assert.NoError(t, err)
+
+	assert.Len(t, outbox.messages, 1)
+	msg := outbox.messages[0]
+	assert.Equal(t, email.TemplateVerification, msg.Template)
+	assert.Equal(t, "a@b.com", msg.To)
+	assert.Contains(t, msg.TextBody, "https://files.example.com/auth/verify?token=tok+en")
+}
+
+func TestMailer_SendEmailChangeNotifiesBothAddresses(t *testing.T) {
+	outbox := &recordingOutbox{}
+	mailer, err := email.NewMailer(outbox, "https://files.example.com")
+	assert.NoError(t, err)
+
+	err = mailer.SendEmailChange(context.Background(), "old@b.com", "new@b.com", "conf", "canc")
+	assert.NoError(t, err)
+
+	assert.Len(t, outbox.messages, 2)
+	assert.Equal(t, "new@b.com", outbox.messages[0].To)
+	assert.Contains(t, outbox.messages[0].TextBody, "/auth/email-change/confirm?token=conf")
+	assert.Equal(t, "old@b.com", outbox.messages[1].To)
+	assert.Contains(t, outbox.messages[1].TextBody, "/auth/email-change/cancel?token=canc")
+	assert.Contains(t, outbox.messages[1].TextBody, "new@b.com")
+}
+
+func TestMailer_QuotaWarningPercent(t *testing.T) {
+	outbox := &recordingOutbox{}
+	mailer, err := email.NewMailer(outbox, "https://files.example.com")
+	assert.NoError(t, err)
+
+	err = mailer.SendQuotaWarning(context.Background(), "a@b.com", 95, 100)
+	assert.NoError(t, err)
+	assert.Contains(t, outbox.messages[0].Subject, "95%")
+}
+
+func TestBaseURLFromEnv(t *testing.T) {
+	t.Setenv("PUBLIC_BASE_URL", "")
+	t.Setenv("PORT", ":8080")
+	assert.Equal(t, "http://localhost:8080", email.BaseURLFromEnv())
+
+	t.Setenv("PUBLIC_BASE_URL", "https://files.example.com")
+	assert.Equal(t, "https://files.example.com", email.BaseURLFromEnv())
+}
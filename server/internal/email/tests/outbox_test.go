@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/email"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) EnqueueEmail(ctx context.Context, arg database.EnqueueEmailParams) (database.EmailOutbox, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.EmailOutbox), args.Error(1)
+}
+
+func (m *MockQueries) ClaimDueEmails(ctx context.Context, arg database.ClaimDueEmailsParams) ([]database.EmailOutbox, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.EmailOutbox), args.Error(1)
+}
+
+func (m *MockQueries) MarkEmailSent(ctx context.Context, id uuid.UUID) (int64, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) RescheduleEmail(ctx context.Context, arg database.RescheduleEmailParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) MarkEmailFailed(ctx context.Context, arg database.MarkEmailFailedParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type stubSender struct {
+	err  error
+	sent []email.Message
+}
+
+func (s *stubSender) Send(ctx context.Context, msg email.Message) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func TestOutbox_Enqueue(t *testing.T) {
+	mockQ := new(MockQueries)
+	outbox := email.NewOutbox(mockQ)
+	ctx := context.Background()
+
+	mockQ.On("EnqueueEmail", ctx, database.EnqueueEmailParams{
+		Template:  email.TemplateVerification,
+		ToAddress: "a@b.com",
+		Subject:   "s",
+		TextBody:  "t",
+		HtmlBody:  "h",
+	}).Return(database.EmailOutbox{}, nil)
+
+	err := outbox.Enqueue(ctx, email.Message{Template: email.TemplateVerification, To: "a@b.com", Subject: "s", TextBody: "t", HTMLBody: "h"})
+	assert.NoError(t, err)
+	mockQ.AssertExpectations(t)
+}
+
+func TestWorker_SendsAndMarksSent(t *testing.T) {
+	mockQ := new(MockQueries)
+	sender := &stubSender{}
+	worker := email.NewWorker(mockQ, sender)
+	ctx := context.Background()
+
+	id := uuid.New()
+	mockQ.On("ClaimDueEmails", ctx, mock.Anything).Return([]database.EmailOutbox{
+		{ID: id, Template: email.TemplateVerification, ToAddress: "a@b.com", Subject: "s", Attempts: 1},
+	}, nil)
+	mockQ.On("MarkEmailSent", ctx, id).Return(int64(1), nil)
+
+	sent, err := worker.ProcessBatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, "a@b.com", sender.sent[0].To)
+	mockQ.AssertExpectations(t)
+}
+
+func TestWorker_ReschedulesOnFailure(t *testing.T) {
+	mockQ := new(MockQueries)
+	worker := email.NewWorker(mockQ, &stubSender{err: errors.New("connection refused")})
+	ctx := context.Background()
+
+	id := uuid.New()
+	mockQ.On("ClaimDueEmails", ctx, mock.Anything).Return([]database.EmailOutbox{
+		{ID: id, ToAddress: "a@b.com", Attempts: 2},
+	}, nil)
+	mockQ.On("RescheduleEmail", ctx, mock.MatchedBy(func(p database.RescheduleEmailParams) bool {
+		return p.ID == id && p.DelaySeconds == 60 && p.LastError.String == "connection refused"
+	})).Return(int64(1), nil)
+
+	sent, err := worker.ProcessBatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	mockQ.AssertExpectations(t)
+}
+
+func TestWorker_GivesUpAfterMaxAttempts(t *testing.T) {
+	mockQ := new(MockQueries)
+	worker := email.NewWorker(mockQ, &stubSender{err: errors.New("mailbox unavailable")})
+	worker.MaxAttempts = 3
+	ctx := context.Background()
+
+	id := uuid.New()
+	mockQ.On("ClaimDueEmails", ctx, mock.Anything).Return([]database.EmailOutbox{
+		{ID: id, ToAddress: "a@b.com", Attempts: 3},
+	}, nil)
+	mockQ.On("MarkEmailFailed", ctx, mock.MatchedBy(func(p database.MarkEmailFailedParams) bool {
+		return p.ID == id && p.LastError.Valid
+	})).Return(int64(1), nil)
+
+	_, err := worker.ProcessBatch(ctx)
+	assert.NoError(t, err)
+	mockQ.AssertExpectations(t)
+	mockQ.AssertNotCalled(t, "RescheduleEmail", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/email"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSender_WritesEML(t *testing.T) {
+	dir := t.TempDir()
+	sender := email.NewFileSender(dir, "from@example.com")
+
+	err := sender.Send(context.Background(), email.Message{
+		Template: email.TemplateVerification,
+		To:       "to@example.com",
+		Subject:  "Héllo",
+		TextBody: "plain body",
+		HTMLBody: "<p>html body</p>",
+	})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	raw, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	content := string(raw)
+
+	assert.Contains(t, content, "From: from@example.com\r\n")
+	assert.Contains(t, content, "To: to@example.com\r\n")
+	assert.Contains(t, content, "Subject: =?utf-8?q?H=C3=A9llo?=\r\n")
+	assert.Contains(t, content, "multipart/alternative")
+	assert.Contains(t, content, "plain body")
+	assert.Contains(t, content, "<p>html body</p>")
+}
+
+func TestFileSender_StripsLineBreaksFromHeaders(t *testing.T) {
+	dir := t.TempDir()
+	sender := email.NewFileSender(dir, "from@example.com")
+
+	err := sender.Send(context.Background(), email.Message{
+		Template: email.TemplateVerification,
+		To:       "to@example.com\r\nBcc: victim@example.com",
+		Subject:  "Hello",
+	})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	raw, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+
+	assert.Contains(t, string(raw), "To: to@example.comBcc: victim@example.com\r\n")
+	assert.NotContains(t, string(raw), "\r\nBcc:")
+}
+
+func TestNewSMTPSenderFromEnv_Missing(t *testing.T) {
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("SMTP_PORT", "")
+	t.Setenv("SMTP_FROM", "")
+	t.Setenv("SMTP_PASSWORD", "")
+
+	_, err := email.NewSMTPSenderFromEnv()
+	assert.Error(t, err)
+}
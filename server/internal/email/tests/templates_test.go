@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/email"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender_Verification(t *testing.T) {
+	r, err := email.NewRenderer()
+	assert.NoError(t, err)
+
+	msg, err := r.Render(email.TemplateVerification, "a@b.com", email.VerificationData{
+		Link: "https://files.example.com/auth/verify?token=abc",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "a@b.com", msg.To)
+	assert.Equal(t, "Verify your email address at Cloud-Storage", msg.Subject)
+	assert.Contains(t, msg.TextBody, "https://files.example.com/auth/verify?token=abc")
+	assert.Contains(t, msg.HTMLBody, `href="https://files.example.com/auth/verify?token=abc"`)
+	assert.Contains(t, msg.HTMLBody, "<!DOCTYPE html>")
+}
+
+func TestRender_EscapesHTML(t *testing.T) {
+	r, err := email.NewRenderer()
+	assert.NoError(t, err)
+
+	msg, err := r.Render(email.TemplateShareNotification, "a@b.com", email.ShareNotificationData{
+		SharedBy:   "mallory@example.com",
+		ItemName:   "<script>alert(1)</script>",
+		Permission: "read",
+		Link:       "https://files.example.com/files/1",
+	})
+	assert.NoError(t, err)
+
+	assert.NotContains(t, msg.HTMLBody, "<script>")
+	assert.Contains(t, msg.HTMLBody, "&lt;script&gt;")
+}
+
+func TestRender_QuotaWarningFormatsBytes(t *testing.T) {
+	r, err := email.NewRenderer()
+	assert.NoError(t, err)
+
+	msg, err := r.Render(email.TemplateQuotaWarning, "a@b.com", email.QuotaWarningData{
+		UsedBytes:  9 << 30,
+		QuotaBytes: 10 << 30,
+		Percent:    90,
+		Link:       "https://files.example.com/",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "You've used 90% of your Cloud-Storage space", msg.Subject)
+	assert.Contains(t, msg.TextBody, "9.0 GiB of your 10.0 GiB")
+}
+
+func TestRender_AllTemplates(t *testing.T) {
+	r, err := email.NewRenderer()
+	assert.NoError(t, err)
+
+	cases := map[string]any{
+		email.TemplateVerification:      email.VerificationData{Link: "x"},
+		email.TemplatePasswordReset:     email.PasswordResetData{Link: "x"},
+		email.TemplateShareNotification: email.ShareNotificationData{SharedBy: "x", ItemName: "y", Permission: "read", Link: "z"},
+		email.TemplateQuotaWarning:      email.QuotaWarningData{UsedBytes: 1, QuotaBytes: 2, Percent: 50, Link: "x"},
+		email.TemplateEmailChange:       email.EmailChangeData{Link: "x"},
+		email.TemplateEmailChangeNotice: email.EmailChangeNoticeData{NewEmail: "x", CancelLink: "y"},
+		email.TemplateAccountDeletion:   email.AccountDeletionData{ScheduledAt: time.Now(), Link: "x"},
+	}
+	for name, data := range cases {
+		msg, err := r.Render(name, "a@b.com", data)
+		assert.NoError(t, err, name)
+		assert.NotEmpty(t, msg.Subject, name)
+		assert.NotEmpty(t, msg.TextBody, name)
+		assert.NotEmpty(t, msg.HTMLBody, name)
+	}
+}
+
+func TestRender_UnknownTemplate(t *testing.T) {
+	r, err := email.NewRenderer()
+	assert.NoError(t, err)
+
+	_, err = r.Render("nope", "a@b.com", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,187 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/changes"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"golang.org/x/net/websocket"
+)
+
+// How long one write may block before the client is dropped
+const writeTimeout = 10 * time.Second
+
+// How long EventSource waits before reconnecting, in milliseconds
+const retryMillis = 3000
+
+type ServiceInterface interface {
+	Stream(ctx context.Context, userID int32, after string, sink Sink) error
+}
+
+// startError maps an error from a stream that never started to a status.
+func startError(err error) (int, string) {
+	switch {
+	case errors.Is(err, changes.ErrInvalidCursor):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, ErrTooManyStreams):
+		return http.StatusTooManyRequests, err.Error()
+	default:
+		return http.StatusInternalServerError, "Failed to stream changes"
+	}
+}
+
+type sseSink struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	started bool
+}
+
+func (s *sseSink) write(format string, args ...any) error {
+	if err := s.rc.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if !s.started {
+		h := s.w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("X-Accel-Buffering", "no")
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+		if _, err := fmt.Fprintf(s.w, "retry: %d\n\n", retryMillis); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.w, format, args...); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *sseSink) Send(ev Event) error {
+	var data any = map[string]string{"cursor": ev.Cursor}
+	if ev.Change != nil {
+		data = ev.Change
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return s.write("id: %s\nevent: %s\ndata: %s\n\n", ev.Cursor, ev.Type, payload)
+}
+
+func (s *sseSink) Ping() error {
+	return s.write(": ping\n\n")
+}
+
+// EventsHandler streams changes as Server-Sent Events. Every event's ID is
+// a cursor, so EventSource resumes on its own through Last-Event-ID.
+func EventsHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		after := r.Header.Get("Last-Event-ID")
+		if after == "" {
+			after = r.URL.Query().Get("cursor")
+		}
+
+		sink := &sseSink{w: w, rc: http.NewResponseController(w)}
+		err := service.Stream(r.Context(), userID, after, sink)
+		if err == nil {
+			return
+		}
+		if !sink.started {
+			status, msg := startError(err)
+			util.RespondWithError(w, status, msg)
+			return
+		}
+		if r.Context().Err() == nil {
+			log.Printf("event stream for user %d: %v", userID, err)
+		}
+	}
+}
+
+type wsSink struct {
+	conn *websocket.Conn
+}
+
+func (s *wsSink) Send(ev Event) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	return websocket.JSON.Send(s.conn, ev)
+}
+
+func (s *wsSink) Ping() error {
+	return s.Send(Event{Type: TypePing})
+}
+
+// WebSocketHandler streams changes as JSON messages over a WebSocket.
+// Clients resume by passing the last cursor they saw in the cursor query
+// parameter. Errors that stop a stream from starting arrive as an error
+// message before the connection closes.
+func WebSocketHandler(service ServiceInterface) http.Handler {
+	return websocket.Server{Handler: func(conn *websocket.Conn) {
+		defer conn.Close()
+		r := conn.Request()
+
+		sink := &wsSink{conn: conn}
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			sink.Send(Event{Type: TypeError, Error: "Unauthorized"})
+			return
+		}
+
+		// Clients only send control frames; reading them also tells us when
+		// the connection is gone
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			io.Copy(io.Discard, conn)
+			cancel()
+		}()
+
+		if err := service.Stream(ctx, userID, r.URL.Query().Get("cursor"), sink); err != nil && ctx.Err() == nil {
+			_, msg := startError(err)
+			sink.Send(Event{Type: TypeError, Error: msg})
+		}
+	}}
+}
+
+type TicketIssuer interface {
+	Issue(ctx context.Context, userID int32) (string, error)
+}
+
+// TicketHandler issues a one-time ticket for opening a stream where no
+// Authorization header can be sent, as ?ticket= on either endpoint.
+func TicketHandler(tickets TicketIssuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		ticket, err := tickets.Issue(r.Context(), userID)
+		if err != nil {
+			log.Printf("issuing stream ticket for user %d: %v", userID, err)
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to issue ticket")
+			return
+		}
+		util.RespondWithJSON(w, http.StatusCreated, map[string]any{
+			"ticket":     ticket,
+			"expires_in": int(TicketTTL / time.Second),
+		})
+	}
+}
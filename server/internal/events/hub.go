@@ -0,0 +1,92 @@
+package events
+
+import (
+	"errors"
+	"sync"
+)
+
+// DefaultMaxStreams caps how many streams one user can hold open at once.
+const DefaultMaxStreams = 20
+
+var ErrTooManyStreams = errors.New("too many open event streams")
+
+// Hub wakes the streams of users whose journal has new entries. A wake-up
+// carries no data: the stream reads what changed from the journal itself,
+// so wake-ups for a stream that is busy writing fold into one and the hub
+// never waits on a slow client.
+type Hub struct {
+	mu         sync.Mutex
+	streams    map[int32]map[*Subscription]struct{}
+	MaxStreams int
+}
+
+func NewHub() *Hub {
+	return &Hub{streams: make(map[int32]map[*Subscription]struct{}), MaxStreams: DefaultMaxStreams}
+}
+
+type Subscription struct {
+	userID int32
+	wake   chan struct{}
+}
+
+// Wake receives whenever the user may have new changes.
+func (s *Subscription) Wake() <-chan struct{} {
+	return s.wake
+}
+
+func (h *Hub) Subscribe(userID int32) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs := h.streams[userID]
+	if len(subs) >= h.MaxStreams {
+		return nil, ErrTooManyStreams
+	}
+	if subs == nil {
+		subs = make(map[*Subscription]struct{})
+		h.streams[userID] = subs
+	}
+	s := &Subscription{userID: userID, wake: make(chan struct{}, 1)}
+	subs[s] = struct{}{}
+	return s, nil
+}
+
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.streams[s.userID], s)
+	if len(h.streams[s.userID]) == 0 {
+		delete(h.streams, s.userID)
+	}
+}
+
+// Notify wakes every stream of the user.
+func (h *Hub) Notify(userID int32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.streams[userID] {
+		s.signal()
+	}
+}
+
+// NotifyAll wakes every stream, for when notifications may have been lost.
+func (h *Hub) NotifyAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, subs := range h.streams {
+		for s := range subs {
+			s.signal()
+		}
+	}
+}
+
+func (s *Subscription) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+		// Already pending; the stream will see this change too
+	}
+}
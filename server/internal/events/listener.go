@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Channel is where the journal triggers announce new entries, with the ID
+// of the user they belong to.
+const Channel = "change_journal"
+
+const defaultPingInterval = 90 * time.Second
+
+// Bounds on the wait between connection attempts
+const (
+	minReconnect = 10 * time.Second
+	maxReconnect = time.Minute
+)
+
+// Listener passes journal notifications from Postgres to the hub. Every
+// server instance runs one, so a change made through any instance reaches
+// streams on all of them.
+type Listener struct {
+	dsn          string
+	hub          *Hub
+	PingInterval time.Duration
+}
+
+func NewListener(dsn string, hub *Hub) *Listener {
+	return &Listener{dsn: dsn, hub: hub, PingInterval: defaultPingInterval}
+}
+
+// Run listens until ctx is cancelled, reconnecting as needed.
+func (l *Listener) Run(ctx context.Context) {
+	pl := pq.NewListener(l.dsn, minReconnect, maxReconnect, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("change notifications: %v", err)
+		}
+	})
+	defer pl.Close()
+
+	if !l.listen(ctx, pl) {
+		return
+	}
+
+	ticker := time.NewTicker(l.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-pl.Notify:
+			if n == nil {
+				// Reconnected; anything sent meanwhile is gone
+				l.hub.NotifyAll()
+				continue
+			}
+			userID, err := strconv.ParseInt(n.Extra, 10, 32)
+			if err != nil {
+				log.Printf("change notification %q: %v", n.Extra, err)
+				continue
+			}
+			l.hub.Notify(int32(userID))
+		case <-ticker.C:
+			go pl.Ping()
+		}
+	}
+}
+
+// listen subscribes to Channel, retrying with backoff until it works.
+// pq.Listener keeps a subscription across reconnects, but one the server
+// turned down is never retried, which would leave streams without wake-ups.
+// It reports false if ctx was cancelled first.
+func (l *Listener) listen(ctx context.Context, pl *pq.Listener) bool {
+	delay := minReconnect
+	for {
+		// Listen waits for a connection, so it mustn't hold up shutdown
+		done := make(chan error, 1)
+		go func() { done <- pl.Listen(Channel) }()
+
+		var err error
+		select {
+		case <-ctx.Done():
+			return false
+		case err = <-done:
+		}
+		if err == nil || errors.Is(err, pq.ErrChannelAlreadyOpen) {
+			return true
+		}
+
+		log.Printf("listening for change notifications, retrying in %s: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnect)
+	}
+}
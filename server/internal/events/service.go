@@ -0,0 +1,135 @@
+// Package events pushes each user's changes to connected clients as they
+// happen, over Server-Sent Events or a WebSocket. Events come from the
+// change journal, so an event's ID is a journal cursor: a client that
+// reconnects with it picks up exactly where it left off, and one that falls
+// too far behind is told to list the tree again.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/changes"
+)
+
+// Event types
+const (
+	TypeChange = "change"
+	// Sent once the stream has caught up with the journal
+	TypeReady = "ready"
+	// The journal no longer goes back to the client's cursor
+	TypeReset = "reset"
+	TypePing  = "ping"
+	TypeError = "error"
+)
+
+const (
+	defaultHeartbeat = 25 * time.Second
+	pageSize         = 200
+)
+
+type ChangeSource interface {
+	Changes(ctx context.Context, userID int32, after string, limit int32) (changes.Delta, error)
+	Latest(ctx context.Context, userID int32) (string, error)
+}
+
+type Event struct {
+	Type string `json:"type"`
+	// Where to resume from after this event
+	Cursor string          `json:"cursor,omitempty"`
+	Change *changes.Change `json:"change,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Sink writes events to one client. Writes that block for too long fail,
+// which ends the stream rather than letting a slow client pile up events.
+type Sink interface {
+	Send(ev Event) error
+	Ping() error
+}
+
+type Service struct {
+	source    ChangeSource
+	hub       *Hub
+	Heartbeat time.Duration
+}
+
+func NewService(source ChangeSource, hub *Hub) *Service {
+	return &Service{source: source, hub: hub, Heartbeat: defaultHeartbeat}
+}
+
+// Stream sends the user's changes after the cursor to sink until ctx is
+// cancelled or a write fails. An empty cursor starts with changes made from
+// now on. Errors returned before anything was sent, such as
+// changes.ErrInvalidCursor or ErrTooManyStreams, mean the stream never
+// started.
+func (s *Service) Stream(ctx context.Context, userID int32, after string, sink Sink) error {
+	// Subscribe before reading, so changes made while catching up wake us
+	sub, err := s.hub.Subscribe(userID)
+	if err != nil {
+		return err
+	}
+	defer s.hub.Unsubscribe(sub)
+
+	cursor := after
+	if cursor == "" {
+		if cursor, err = s.source.Latest(ctx, userID); err != nil {
+			return fmt.Errorf("fetching cursor: %w", err)
+		}
+	}
+	if cursor, err = s.catchUp(ctx, userID, cursor, sink); err != nil {
+		return err
+	}
+	if err := sink.Send(Event{Type: TypeReady, Cursor: cursor}); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.Heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sub.Wake():
+			if cursor, err = s.catchUp(ctx, userID, cursor, sink); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := sink.Ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// catchUp sends every change after the cursor and returns the new cursor.
+func (s *Service) catchUp(ctx context.Context, userID int32, cursor string, sink Sink) (string, error) {
+	for {
+		delta, err := s.source.Changes(ctx, userID, cursor, pageSize)
+		if errors.Is(err, changes.ErrResetRequired) {
+			latest, err := s.source.Latest(ctx, userID)
+			if err != nil {
+				return cursor, fmt.Errorf("fetching cursor: %w", err)
+			}
+			return latest, sink.Send(Event{Type: TypeReset, Cursor: latest})
+		}
+		if err != nil {
+			return cursor, err
+		}
+
+		for i := range delta.Changes {
+			c := &delta.Changes[i]
+			if err := sink.Send(Event{Type: TypeChange, Cursor: c.Cursor, Change: c}); err != nil {
+				return cursor, err
+			}
+			cursor = c.Cursor
+		}
+		cursor = delta.Cursor
+		if !delta.HasMore {
+			return cursor, nil
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/changes"
+	"github.com/bellezhang119/cloud-storage/internal/events"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+type MockSource struct {
+	mock.Mock
+}
+
+func (m *MockSource) Changes(ctx context.Context, userID int32, after string, limit int32) (changes.Delta, error) {
+	args := m.Called(ctx, userID, after, limit)
+	return args.Get(0).(changes.Delta), args.Error(1)
+}
+
+func (m *MockSource) Latest(ctx context.Context, userID int32) (string, error) {
+	args := m.Called(ctx, userID)
+	return args.String(0), args.Error(1)
+}
+
+func change(name, cursor string) changes.Change {
+	return changes.Change{Kind: "file", ID: uuid.New(), Action: changes.ActionCreate, Name: name, Cursor: cursor}
+}
+
+func delta(cursor string, cs ...changes.Change) changes.Delta {
+	return changes.Delta{Changes: append([]changes.Change{}, cs...), Cursor: cursor}
+}
+
+// serve runs handler as user 1, the way the stream middleware would.
+func serve(t *testing.T, handler http.Handler) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), middleware.GetUserIDKey(), int32(1))
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+type sseEvent struct {
+	id, event, data string
+}
+
+// readEvents collects SSE events and comments from the body as they come.
+func readEvents(t *testing.T, res *http.Response) <-chan sseEvent {
+	out := make(chan sseEvent, 16)
+	go func() {
+		defer close(out)
+		scanner := bufio.NewScanner(res.Body)
+		var ev sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if ev != (sseEvent{}) {
+					out <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, ":"):
+				out <- sseEvent{event: "comment", data: strings.TrimSpace(line[1:])}
+			case strings.HasPrefix(line, "id: "):
+				ev.id = line[len("id: "):]
+			case strings.HasPrefix(line, "event: "):
+				ev.event = line[len("event: "):]
+			case strings.HasPrefix(line, "data: "):
+				ev.data = line[len("data: "):]
+			}
+		}
+	}()
+	return out
+}
+
+func next(t *testing.T, evs <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-evs:
+		require.True(t, ok, "stream ended")
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return sseEvent{}
+	}
+}
+
+func openSSE(t *testing.T, url string, header http.Header) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestEventsHandler_ResumesFromLastEventIDAndPushes(t *testing.T) {
+	source := new(MockSource)
+	source.On("Changes", mock.Anything, int32(1), "c0", int32(200)).Return(delta("c2", change("a", "c1"), change("b", "c2")), nil).Once()
+	source.On("Changes", mock.Anything, int32(1), "c2", int32(200)).Return(delta("c3", change("c", "c3")), nil).Once()
+	hub := events.NewHub()
+	srv := serve(t, events.EventsHandler(events.NewService(source, hub)))
+
+	res := openSSE(t, srv.URL, http.Header{"Last-Event-Id": {"c0"}})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	evs := readEvents(t, res)
+
+	first := next(t, evs)
+	assert.Equal(t, "c1", first.id)
+	assert.Equal(t, events.TypeChange, first.event)
+	assert.Contains(t, first.data, `"name":"a"`)
+	assert.Equal(t, "c2", next(t, evs).id)
+	ready := next(t, evs)
+	assert.Equal(t, events.TypeReady, ready.event)
+	assert.Equal(t, "c2", ready.id)
+
+	hub.Notify(1)
+	pushed := next(t, evs)
+	assert.Equal(t, "c3", pushed.id)
+	assert.Contains(t, pushed.data, `"name":"c"`)
+}
+
+func TestEventsHandler_StartsAtLatestWithoutCursor(t *testing.T) {
+	source := new(MockSource)
+	source.On("Latest", mock.Anything, int32(1)).Return("head", nil)
+	source.On("Changes", mock.Anything, int32(1), "head", int32(200)).Return(delta("head"), nil)
+	srv := serve(t, events.EventsHandler(events.NewService(source, events.NewHub())))
+
+	evs := readEvents(t, openSSE(t, srv.URL, nil))
+
+	ready := next(t, evs)
+	assert.Equal(t, events.TypeReady, ready.event)
+	assert.Equal(t, "head", ready.id)
+}
+
+func TestEventsHandler_ResetWhenCursorIsTooOld(t *testing.T) {
+	source := new(MockSource)
+	source.On("Changes", mock.Anything, int32(1), "old", int32(200)).Return(changes.Delta{}, changes.ErrResetRequired)
+	source.On("Latest", mock.Anything, int32(1)).Return("head", nil)
+	srv := serve(t, events.EventsHandler(events.NewService(source, events.NewHub())))
+
+	evs := readEvents(t, openSSE(t, srv.URL+"?cursor=old", nil))
+
+	reset := next(t, evs)
+	assert.Equal(t, events.TypeReset, reset.event)
+	assert.Equal(t, "head", reset.id)
+	assert.JSONEq(t, `{"cursor":"head"}`, reset.data)
+	assert.Equal(t, events.TypeReady, next(t, evs).event)
+}
+
+func TestEventsHandler_Heartbeat(t *testing.T) {
+	source := new(MockSource)
+	source.On("Changes", mock.Anything, int32(1), "c0", int32(200)).Return(delta("c0"), nil)
+	service := events.NewService(source, events.NewHub())
+	service.Heartbeat = 10 * time.Millisecond
+	srv := serve(t, events.EventsHandler(service))
+
+	evs := readEvents(t, openSSE(t, srv.URL+"?cursor=c0", nil))
+
+	assert.Equal(t, events.TypeReady, next(t, evs).event)
+	ping := next(t, evs)
+	assert.Equal(t, "comment", ping.event)
+	assert.Equal(t, "ping", ping.data)
+}
+
+func TestEventsHandler_RejectsBeforeStreaming(t *testing.T) {
+	source := new(MockSource)
+	source.On("Changes", mock.Anything, int32(1), "junk", int32(200)).Return(changes.Delta{}, changes.ErrInvalidCursor)
+	hub := events.NewHub()
+	hub.MaxStreams = 1
+	srv := serve(t, events.EventsHandler(events.NewService(source, hub)))
+
+	res := openSSE(t, srv.URL+"?cursor=junk", nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	_, err := hub.Subscribe(1)
+	require.NoError(t, err)
+	res = openSSE(t, srv.URL+"?cursor=junk", nil)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+}
+
+func TestEventsHandler_Unauthorized(t *testing.T) {
+	rec := httptest.NewRecorder()
+	events.EventsHandler(events.NewService(new(MockSource), events.NewHub())).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	source := new(MockSource)
+	source.On("Changes", mock.Anything, int32(1), "c0", int32(200)).Return(delta("c1", change("a", "c1")), nil).Once()
+	source.On("Changes", mock.Anything, int32(1), "c1", int32(200)).Return(delta("c2", change("b", "c2")), nil).Once()
+	hub := events.NewHub()
+	srv := serve(t, events.WebSocketHandler(events.NewService(source, hub)))
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/events/ws?cursor=c0"
+	conn, err := websocket.Dial(url, "", srv.URL)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var ev events.Event
+	require.NoError(t, websocket.JSON.Receive(conn, &ev))
+	assert.Equal(t, events.TypeChange, ev.Type)
+	assert.Equal(t, "c1", ev.Cursor)
+	assert.Equal(t, "a", ev.Change.Name)
+
+	var ready events.Event
+	require.NoError(t, websocket.JSON.Receive(conn, &ready))
+	assert.Equal(t, events.Event{Type: events.TypeReady, Cursor: "c1"}, ready)
+
+	hub.Notify(1)
+	var pushed events.Event
+	require.NoError(t, websocket.JSON.Receive(conn, &pushed))
+	assert.Equal(t, "c2", pushed.Cursor)
+	assert.Equal(t, "b", pushed.Change.Name)
+}
+
+func TestWebSocketHandler_ErrorMessage(t *testing.T) {
+	source := new(MockSource)
+	source.On("Changes", mock.Anything, int32(1), "junk", int32(200)).Return(changes.Delta{}, changes.ErrInvalidCursor)
+	srv := serve(t, events.WebSocketHandler(events.NewService(source, events.NewHub())))
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/?cursor=junk", "", srv.URL)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var ev events.Event
+	require.NoError(t, websocket.JSON.Receive(conn, &ev))
+	assert.Equal(t, events.Event{Type: events.TypeError, Error: changes.ErrInvalidCursor.Error()}, ev)
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pending(s *events.Subscription) int {
+	n := 0
+	for {
+		select {
+		case <-s.Wake():
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+func TestHub_WakeUpsCoalesce(t *testing.T) {
+	hub := events.NewHub()
+	a, err := hub.Subscribe(1)
+	require.NoError(t, err)
+	other, err := hub.Subscribe(2)
+	require.NoError(t, err)
+
+	hub.Notify(1)
+	hub.Notify(1)
+	hub.Notify(1)
+
+	assert.Equal(t, 1, pending(a), "a busy stream is woken once")
+	assert.Equal(t, 0, pending(other))
+
+	hub.NotifyAll()
+	assert.Equal(t, 1, pending(a))
+	assert.Equal(t, 1, pending(other))
+}
+
+func TestHub_LimitsStreamsPerUser(t *testing.T) {
+	hub := events.NewHub()
+	hub.MaxStreams = 2
+
+	first, err := hub.Subscribe(1)
+	require.NoError(t, err)
+	_, err = hub.Subscribe(1)
+	require.NoError(t, err)
+	_, err = hub.Subscribe(1)
+	assert.ErrorIs(t, err, events.ErrTooManyStreams)
+
+	_, err = hub.Subscribe(2)
+	assert.NoError(t, err, "the limit is per user")
+
+	hub.Unsubscribe(first)
+	_, err = hub.Subscribe(1)
+	assert.NoError(t, err)
+
+	hub.Notify(1)
+	assert.Equal(t, 0, pending(first), "unsubscribed streams aren't woken")
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/events"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockTicketQueries struct {
+	mock.Mock
+}
+
+func (m *MockTicketQueries) CreateStreamTicket(ctx context.Context, arg database.CreateStreamTicketParams) error {
+	args := m.Called(ctx, arg)
+	return args.Error(0)
+}
+
+func (m *MockTicketQueries) RedeemStreamTicket(ctx context.Context, ticketHash string) (database.RedeemStreamTicketRow, error) {
+	args := m.Called(ctx, ticketHash)
+	return args.Get(0).(database.RedeemStreamTicketRow), args.Error(1)
+}
+
+func (m *MockTicketQueries) DeleteExpiredStreamTickets(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func TestTickets_IssueStoresOnlyAHash(t *testing.T) {
+	q := new(MockTicketQueries)
+	q.On("DeleteExpiredStreamTickets", mock.Anything).Return(int64(0), nil)
+	var stored database.CreateStreamTicketParams
+	q.On("CreateStreamTicket", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(database.CreateStreamTicketParams)
+	}).Return(nil)
+
+	ticket, err := events.NewTickets(q).Issue(context.Background(), 4)
+	require.NoError(t, err)
+	assert.NotEmpty(t, ticket)
+	assert.Equal(t, util.HashToken(ticket), stored.TicketHash)
+	assert.Equal(t, int32(4), stored.UserID)
+	assert.WithinDuration(t, time.Now().Add(events.TicketTTL), stored.ExpiresAt, 5*time.Second)
+}
+
+func TestTickets_Redeem(t *testing.T) {
+	q := new(MockTicketQueries)
+	q.On("RedeemStreamTicket", mock.Anything, util.HashToken("good")).
+		Return(database.RedeemStreamTicketRow{UserID: 4, Email: "a@example.com", ExpiresAt: time.Now().Add(time.Minute)}, nil)
+	q.On("RedeemStreamTicket", mock.Anything, util.HashToken("stale")).
+		Return(database.RedeemStreamTicketRow{UserID: 4, Email: "a@example.com", ExpiresAt: time.Now().Add(-time.Second)}, nil)
+	q.On("RedeemStreamTicket", mock.Anything, util.HashToken("used")).
+		Return(database.RedeemStreamTicketRow{}, sql.ErrNoRows)
+	tickets := events.NewTickets(q)
+
+	userID, email, err := tickets.Redeem(context.Background(), "good")
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), userID)
+	assert.Equal(t, "a@example.com", email)
+
+	_, _, err = tickets.Redeem(context.Background(), "stale")
+	assert.ErrorIs(t, err, events.ErrInvalidTicket)
+	_, _, err = tickets.Redeem(context.Background(), "used")
+	assert.ErrorIs(t, err, events.ErrInvalidTicket)
+}
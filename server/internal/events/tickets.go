@@ -0,0 +1,73 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+)
+
+// TicketTTL is how long a ticket may wait before it is used.
+const TicketTTL = 30 * time.Second
+
+var ErrInvalidTicket = errors.New("invalid or expired ticket")
+
+type TicketQueries interface {
+	CreateStreamTicket(ctx context.Context, arg database.CreateStreamTicketParams) error
+	RedeemStreamTicket(ctx context.Context, ticketHash string) (database.RedeemStreamTicketRow, error)
+	DeleteExpiredStreamTickets(ctx context.Context) (int64, error)
+}
+
+// Tickets lets browsers open streams without putting their access token in
+// the URL, where it would end up in logs and history. A signed-in client
+// asks for a ticket and opens the stream with it; a ticket is short-lived
+// and works once, so a leaked one is worthless.
+type Tickets struct {
+	queries TicketQueries
+}
+
+func NewTickets(q TicketQueries) *Tickets {
+	return &Tickets{queries: q}
+}
+
+// Issue returns a new ticket for the user.
+func (t *Tickets) Issue(ctx context.Context, userID int32) (string, error) {
+	// Tickets that were never used pile up otherwise
+	if _, err := t.queries.DeleteExpiredStreamTickets(ctx); err != nil {
+		log.Printf("deleting expired stream tickets: %v", err)
+	}
+
+	ticket, err := util.GenerateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+	err = t.queries.CreateStreamTicket(ctx, database.CreateStreamTicketParams{
+		TicketHash: util.HashToken(ticket),
+		UserID:     userID,
+		ExpiresAt:  time.Now().Add(TicketTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating ticket: %w", err)
+	}
+	return ticket, nil
+}
+
+// Redeem uses up a ticket, returning the ID and email of its user.
+func (t *Tickets) Redeem(ctx context.Context, ticket string) (int32, string, error) {
+	row, err := t.queries.RedeemStreamTicket(ctx, util.HashToken(ticket))
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", ErrInvalidTicket
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("redeeming ticket: %w", err)
+	}
+	if row.ExpiresAt.Before(time.Now()) {
+		return 0, "", ErrInvalidTicket
+	}
+	return row.UserID, row.Email, nil
+}
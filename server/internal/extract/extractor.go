@@ -0,0 +1,132 @@
+package extract
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxTextBytes caps how much normalized text is stored per file.
+const MaxTextBytes = 1 << 20
+
+// Extractor turns a file's raw bytes into plain text.
+type Extractor interface {
+	Extract(data []byte) (string, error)
+}
+
+// ExtractorFunc adapts a plain function to Extractor.
+type ExtractorFunc func(data []byte) (string, error)
+
+func (f ExtractorFunc) Extract(data []byte) (string, error) {
+	return f(data)
+}
+
+type entry struct {
+	extractor Extractor
+	maxBytes  int64
+}
+
+// Registry maps MIME types and file extensions to extractors. MIME types win;
+// extensions cover uploads sent as application/octet-stream.
+type Registry struct {
+	byMIME map[string]entry
+	byExt  map[string]entry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		byMIME: map[string]entry{},
+		byExt:  map[string]entry{},
+	}
+}
+
+// Register adds an extractor for the given MIME types and extensions
+// (with leading dot). Files larger than maxBytes are skipped.
+func (r *Registry) Register(e Extractor, maxBytes int64, mimeTypes []string, extensions []string) {
+	for _, m := range mimeTypes {
+		r.byMIME[strings.ToLower(m)] = entry{extractor: e, maxBytes: maxBytes}
+	}
+	for _, ext := range extensions {
+		r.byExt[strings.ToLower(ext)] = entry{extractor: e, maxBytes: maxBytes}
+	}
+}
+
+// Lookup finds the extractor for a file and its size cap.
+func (r *Registry) Lookup(mimeType, name string) (Extractor, int64, bool) {
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		if e, ok := r.byMIME[strings.ToLower(mediaType)]; ok {
+			return e.extractor, e.maxBytes, true
+		}
+	}
+	if e, ok := r.byExt[strings.ToLower(filepath.Ext(name))]; ok {
+		return e.extractor, e.maxBytes, true
+	}
+	return nil, 0, false
+}
+
+// Normalize makes extracted text safe and compact to store: valid UTF-8, no
+// control characters, single spaces, at most one blank line in a row, and no
+// more than MaxTextBytes.
+func Normalize(s string) string {
+	s = strings.ToValidUTF8(s, " ")
+
+	var b strings.Builder
+	b.Grow(min(len(s), MaxTextBytes))
+
+	pendingSpace, newlines := false, 0
+	for _, r := range s {
+		switch {
+		case r == '\n':
+			newlines++
+			pendingSpace = false
+			continue
+		case unicode.IsSpace(r) || unicode.IsControl(r):
+			pendingSpace = true
+			continue
+		}
+
+		if b.Len() > 0 {
+			if newlines > 0 {
+				b.WriteString(strings.Repeat("\n", min(newlines, 2)))
+			} else if pendingSpace {
+				b.WriteByte(' ')
+			}
+		}
+		pendingSpace, newlines = false, 0
+
+		if b.Len()+utf8.RuneLen(r) > MaxTextBytes {
+			break
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// DefaultRegistry knows the built-in formats.
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(ExtractorFunc(extractPlain), 10<<20,
+		[]string{"text/plain"}, []string{".txt", ".log"})
+	r.Register(ExtractorFunc(extractMarkdown), 10<<20,
+		[]string{"text/markdown", "text/x-markdown"}, []string{".md", ".markdown"})
+	r.Register(ExtractorFunc(extractCSV), 20<<20,
+		[]string{"text/csv"}, []string{".csv"})
+	r.Register(ExtractorFunc(extractJSON), 20<<20,
+		[]string{"application/json"}, []string{".json"})
+	r.Register(ExtractorFunc(extractHTML), 10<<20,
+		[]string{"text/html", "application/xhtml+xml"}, []string{".html", ".htm", ".xhtml"})
+	r.Register(ExtractorFunc(extractDOCX), 50<<20,
+		[]string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"}, []string{".docx"})
+	r.Register(ExtractorFunc(extractXLSX), 50<<20,
+		[]string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}, []string{".xlsx"})
+	r.Register(ExtractorFunc(extractODF), 50<<20,
+		[]string{
+			"application/vnd.oasis.opendocument.text",
+			"application/vnd.oasis.opendocument.spreadsheet",
+			"application/vnd.oasis.opendocument.presentation",
+		}, []string{".odt", ".ods", ".odp"})
+	return r
+}
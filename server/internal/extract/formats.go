@@ -0,0 +1,240 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Office documents are zips, and these bound what one may make us do, so a
+// zip bomb can't exhaust memory or time: how much a single part and all
+// parts together may inflate to, and how many entries the archive may have.
+const (
+	maxZipEntryBytes = 64 << 20
+	maxZipTotalBytes = 128 << 20
+	maxZipEntries    = 10000
+)
+
+func extractPlain(data []byte) (string, error) {
+	return string(data), nil
+}
+
+var (
+	mdLink     = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	mdMarkup   = regexp.MustCompile("(?m)^\\s{0,3}(#{1,6}|>|[-*+]|\\d+\\.)\\s+")
+	mdEmphasis = regexp.MustCompile("[*_`~]{1,3}")
+)
+
+// extractMarkdown keeps the words and drops the syntax around them.
+func extractMarkdown(data []byte) (string, error) {
+	s := mdLink.ReplaceAllString(string(data), "$1")
+	s = mdMarkup.ReplaceAllString(s, "")
+	s = mdEmphasis.ReplaceAllString(s, "")
+	return s, nil
+}
+
+func extractCSV(data []byte) (string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	var b strings.Builder
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Not really CSV; the raw text is still worth indexing
+			return string(data), nil
+		}
+		b.WriteString(strings.Join(record, " "))
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// extractJSON indexes object keys and string values.
+func extractJSON(data []byte) (string, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", fmt.Errorf("parsing json: %w", err)
+	}
+
+	var b strings.Builder
+	var walk func(v any)
+	walk = func(v any) {
+		switch t := v.(type) {
+		case map[string]any:
+			keys := make([]string, 0, len(t))
+			for k := range t {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				b.WriteString(k)
+				b.WriteByte(' ')
+				walk(t[k])
+			}
+		case []any:
+			for _, item := range t {
+				walk(item)
+			}
+		case string:
+			b.WriteString(t)
+			b.WriteByte('\n')
+		}
+	}
+	walk(v)
+	return b.String(), nil
+}
+
+var (
+	htmlHidden = regexp.MustCompile(`(?is)<(script|style|noscript|template)\b.*?</(script|style|noscript|template)\s*>`)
+	htmlBlock  = regexp.MustCompile(`(?i)</?(p|div|br|li|tr|h[1-6]|section|article|header|footer|table|ul|ol)\b[^>]*>`)
+	htmlTag    = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlCommnt = regexp.MustCompile(`(?s)<!--.*?-->`)
+)
+
+func extractHTML(data []byte) (string, error) {
+	s := htmlCommnt.ReplaceAllString(string(data), " ")
+	s = htmlHidden.ReplaceAllString(s, " ")
+	s = htmlBlock.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, " ")
+	return html.UnescapeString(s), nil
+}
+
+// xmlText collects the character data of an XML document. If keep is set,
+// only text inside matching elements is kept. A newline is written after
+// every element matched by breakAfter.
+func xmlText(r io.Reader, keep, breakAfter func(xml.Name) bool) (string, error) {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+
+	var b strings.Builder
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return b.String(), fmt.Errorf("parsing xml: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if keep != nil && keep(t.Name) {
+				depth++
+			}
+		case xml.EndElement:
+			if keep != nil && keep(t.Name) {
+				depth--
+			}
+			if breakAfter != nil && breakAfter(t.Name) {
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if keep == nil || depth > 0 {
+				b.Write(t)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+func openZip(data []byte) (*zip.Reader, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("opening archive: %w", err)
+	}
+	return zr, nil
+}
+
+// zipPartText runs xmlText over every archive entry accepted by match. Once
+// maxZipTotalBytes have been inflated the remaining parts are skipped; the
+// text is cut to MaxTextBytes anyway.
+func zipPartText(data []byte, match func(name string) bool, keep, breakAfter func(xml.Name) bool) (string, error) {
+	zr, err := openZip(data)
+	if err != nil {
+		return "", err
+	}
+	if len(zr.File) > maxZipEntries {
+		return "", fmt.Errorf("archive has more than %d entries", maxZipEntries)
+	}
+
+	var parts []string
+	found := false
+	budget := int64(maxZipTotalBytes)
+	for _, f := range zr.File {
+		if !match(f.Name) {
+			continue
+		}
+		found = true
+		if budget <= 0 {
+			break
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("opening %s: %w", f.Name, err)
+		}
+		limit := min(int64(maxZipEntryBytes), budget)
+		lr := &io.LimitedReader{R: rc, N: limit}
+		text, err := xmlText(lr, keep, breakAfter)
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		budget -= limit - lr.N
+		parts = append(parts, text)
+	}
+
+	if !found {
+		return "", errors.New("document has no text parts")
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+func local(names ...string) func(xml.Name) bool {
+	return func(n xml.Name) bool {
+		for _, name := range names {
+			if n.Local == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func extractDOCX(data []byte) (string, error) {
+	return zipPartText(data, func(name string) bool {
+		return name == "word/document.xml" ||
+			strings.HasPrefix(name, "word/header") ||
+			strings.HasPrefix(name, "word/footer") ||
+			name == "word/footnotes.xml"
+	}, local("t"), local("p", "tab", "br"))
+}
+
+func extractXLSX(data []byte) (string, error) {
+	// Cell text lives in the shared string table; inline strings sit in the
+	// sheets themselves.
+	return zipPartText(data, func(name string) bool {
+		return name == "xl/sharedStrings.xml" || strings.HasPrefix(name, "xl/worksheets/sheet")
+	}, local("t"), local("si", "is", "row"))
+}
+
+func extractODF(data []byte) (string, error) {
+	return zipPartText(data, func(name string) bool {
+		return name == "content.xml"
+	}, local("p", "h", "span", "a", "s"), local("p", "h", "table-cell"))
+}
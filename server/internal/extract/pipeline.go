@@ -0,0 +1,109 @@
+package extract
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/jobs"
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+	"github.com/google/uuid"
+)
+
+// JobKind is the job queue kind for text extraction.
+const JobKind = "extract_text"
+
+type Payload struct {
+	FileID uuid.UUID `json:"file_id"`
+}
+
+type Queries interface {
+	GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error)
+	SetFileContentText(ctx context.Context, arg database.SetFileContentTextParams) (int64, error)
+}
+
+type Enqueuer interface {
+	Enqueue(ctx context.Context, kind string, userID int32, payload any) (database.Job, error)
+}
+
+// Pipeline schedules extraction after upload and runs it from the job queue.
+type Pipeline struct {
+	queries  Queries
+	storage  storage.Storage
+	registry *Registry
+	queue    Enqueuer
+}
+
+func NewPipeline(q Queries, s storage.Storage, r *Registry, queue Enqueuer) *Pipeline {
+	return &Pipeline{queries: q, storage: s, registry: r, queue: queue}
+}
+
+// Schedule queues extraction for a freshly saved file. Types nobody can
+// extract and files over their type's cap are skipped.
+func (p *Pipeline) Schedule(ctx context.Context, f database.File) error {
+	_, maxBytes, ok := p.registry.Lookup(f.MimeType.String, f.Name)
+	if !ok || f.SizeBytes > maxBytes {
+		return nil
+	}
+
+	if _, err := p.queue.Enqueue(ctx, JobKind, f.UserID.Int32, Payload{FileID: f.ID}); err != nil {
+		return fmt.Errorf("scheduling extraction for %s: %w", f.ID, err)
+	}
+	return nil
+}
+
+// Handle is the jobs.HandlerFunc for JobKind.
+func (p *Pipeline) Handle(ctx context.Context, job database.Job) error {
+	var payload Payload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil || payload.FileID == uuid.Nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %s", job.Payload))
+	}
+
+	f, err := p.queries.GetFileByID(ctx, payload.FileID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted before we got to it
+			return nil
+		}
+		return fmt.Errorf("fetching file: %w", err)
+	}
+
+	extractor, maxBytes, ok := p.registry.Lookup(f.MimeType.String, f.Name)
+	if !ok || f.SizeBytes > maxBytes {
+		return nil
+	}
+
+	content, err := p.storage.ReadFile(f.UserID.Int32, f.FilePath)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+	defer content.Close()
+
+	data, err := io.ReadAll(io.LimitReader(content, maxBytes+1))
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		// The blob grew past the cap after the row was written
+		return nil
+	}
+
+	text, err := extractor.Extract(data)
+	if err != nil {
+		// Corrupt documents won't get better on retry
+		return jobs.Permanent(fmt.Errorf("extracting text: %w", err))
+	}
+	text = Normalize(text)
+
+	if _, err := p.queries.SetFileContentText(ctx, database.SetFileContentTextParams{
+		ID:          f.ID,
+		ContentText: sql.NullString{String: text, Valid: text != ""},
+	}); err != nil {
+		return fmt.Errorf("storing text: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/extract"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func zipOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func extractWith(t *testing.T, mimeType, name string, data []byte) string {
+	t.Helper()
+	e, _, ok := extract.DefaultRegistry().Lookup(mimeType, name)
+	require.True(t, ok)
+	text, err := e.Extract(data)
+	require.NoError(t, err)
+	return extract.Normalize(text)
+}
+
+func TestLookup_ByMIMEThenExtension(t *testing.T) {
+	r := extract.DefaultRegistry()
+
+	_, maxBytes, ok := r.Lookup("text/plain; charset=utf-8", "notes")
+	assert.True(t, ok)
+	assert.Equal(t, int64(10<<20), maxBytes)
+
+	_, _, ok = r.Lookup("application/octet-stream", "report.DOCX")
+	assert.True(t, ok)
+
+	_, _, ok = r.Lookup("image/png", "photo.png")
+	assert.False(t, ok)
+}
+
+func TestNormalize(t *testing.T) {
+	in := "  hello\t\tworld \x00\n\n\n\nnext   line\xff"
+	assert.Equal(t, "hello world\n\nnext line", extract.Normalize(in))
+}
+
+func TestNormalize_CapsLength(t *testing.T) {
+	out := extract.Normalize(strings.Repeat("a", extract.MaxTextBytes+100))
+	assert.Len(t, out, extract.MaxTextBytes)
+}
+
+func TestExtract_Markdown(t *testing.T) {
+	text := extractWith(t, "text/markdown", "a.md", []byte("# Title\n\nSome **bold** and a [link](http://x.y).\n- item"))
+	assert.Equal(t, "Title\n\nSome bold and a link.\nitem", text)
+}
+
+func TestExtract_CSV(t *testing.T) {
+	text := extractWith(t, "text/csv", "a.csv", []byte("name,city\nAda,\"London, UK\"\n"))
+	assert.Equal(t, "name city\nAda London, UK", text)
+}
+
+func TestExtract_JSON(t *testing.T) {
+	text := extractWith(t, "application/json", "a.json", []byte(`{"title":"Report","tags":["q3","draft"],"pages":4}`))
+	assert.Contains(t, text, "Report")
+	assert.Contains(t, text, "draft")
+	assert.Contains(t, text, "pages")
+	assert.NotContains(t, text, "4")
+}
+
+func TestExtract_HTML(t *testing.T) {
+	page := `<html><head><style>p{color:red}</style><script>alert(1)</script></head>
+<body><h1>Hello &amp; welcome</h1><p>First <b>para</b></p><!-- hidden --></body></html>`
+	text := extractWith(t, "text/html", "a.html", []byte(page))
+	assert.Equal(t, "Hello & welcome\n\nFirst para", text)
+}
+
+func TestExtract_DOCX(t *testing.T) {
+	doc := zipOf(t, map[string]string{
+		"word/document.xml": `<?xml version="1.0"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>Quarterly</w:t></w:r><w:r><w:t xml:space="preserve"> report</w:t></w:r></w:p>
+<w:p><w:r><w:t>Second paragraph</w:t></w:r></w:p>
+</w:body></w:document>`,
+		"word/styles.xml": `<w:styles xmlns:w="x"><w:t>not content</w:t></w:styles>`,
+	})
+	text := extractWith(t, "", "a.docx", doc)
+	assert.Equal(t, "Quarterly report\nSecond paragraph", text)
+}
+
+func TestExtract_XLSX(t *testing.T) {
+	book := zipOf(t, map[string]string{
+		"xl/sharedStrings.xml":     `<sst><si><t>Revenue</t></si><si><t>Costs</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row><c t="inlineStr"><is><t>Inline</t></is></c><c><v>42</v></c></row></sheetData></worksheet>`,
+	})
+	text := extractWith(t, "", "a.xlsx", book)
+	assert.Contains(t, text, "Revenue")
+	assert.Contains(t, text, "Costs")
+	assert.Contains(t, text, "Inline")
+	assert.NotContains(t, text, "42")
+}
+
+func TestExtract_ODT(t *testing.T) {
+	doc := zipOf(t, map[string]string{
+		"content.xml": `<office:document-content xmlns:office="o" xmlns:text="t"><office:body><office:text>
+<text:h>Heading</text:h><text:p>Body <text:span>text</text:span></text:p>
+</office:text></office:body></office:document-content>`,
+	})
+	text := extractWith(t, "application/vnd.oasis.opendocument.text", "a.odt", doc)
+	assert.Equal(t, "Heading\nBody text", text)
+}
+
+func TestExtract_CorruptDOCX(t *testing.T) {
+	e, _, _ := extract.DefaultRegistry().Lookup("", "a.docx")
+	_, err := e.Extract([]byte("not a zip"))
+	assert.Error(t, err)
+}
+
+func TestExtract_DOCXWithTooManyEntries(t *testing.T) {
+	files := map[string]string{"word/document.xml": `<w:document xmlns:w="x"><w:t>text</w:t></w:document>`}
+	for i := 0; i <= 10000; i++ {
+		files[fmt.Sprintf("word/media/%d.bin", i)] = ""
+	}
+	e, _, _ := extract.DefaultRegistry().Lookup("", "a.docx")
+	_, err := e.Extract(zipOf(t, files))
+	assert.ErrorContains(t, err, "entries")
+}
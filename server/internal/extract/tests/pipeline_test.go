@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/extract"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockQueries) SetFileContentText(ctx context.Context, arg database.SetFileContentTextParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockQueue struct {
+	mock.Mock
+}
+
+func (m *MockQueue) Enqueue(ctx context.Context, kind string, userID int32, payload any) (database.Job, error) {
+	args := m.Called(ctx, kind, userID, payload)
+	return args.Get(0).(database.Job), args.Error(1)
+}
+
+type MockStorage struct {
+	mock.Mock
+}
+
+func (m *MockStorage) SaveFile(userID int32, path string, content io.Reader) error {
+	return m.Called(userID, path, content).Error(0)
+}
+
+func (m *MockStorage) ReadFile(userID int32, path string) (io.ReadCloser, error) {
+	args := m.Called(userID, path)
+	if rc, ok := args.Get(0).(io.ReadCloser); ok {
+		return rc, args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockStorage) DeleteFile(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) CreateDirectory(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) DeleteDirectory(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) MoveFile(userID int32, oldPath, newPath string) error {
+	return m.Called(userID, oldPath, newPath).Error(0)
+}
+
+func (m *MockStorage) CopyFile(userID int32, srcPath, dstPath string) error {
+	return m.Called(userID, srcPath, dstPath).Error(0)
+}
+
+func (m *MockStorage) MoveDirectory(userID int32, oldPath, newPath string) error {
+	return m.Called(userID, oldPath, newPath).Error(0)
+}
+
+func (m *MockStorage) ZipFolder(userID int32, folderPath string, w io.Writer) error {
+	return m.Called(userID, folderPath, w).Error(0)
+}
+
+func (m *MockStorage) ZipPaths(userID int32, paths []string, w io.Writer) error {
+	return m.Called(userID, paths, w).Error(0)
+}
+
+func (m *MockStorage) DeleteUserData(userID int32) error {
+	return m.Called(userID).Error(0)
+}
+
+func newFile(name, mimeType string, size int64) database.File {
+	return database.File{
+		ID:        uuid.New(),
+		UserID:    sql.NullInt32{Int32: 7, Valid: true},
+		Name:      name,
+		FilePath:  "docs/" + name,
+		SizeBytes: size,
+		MimeType:  sql.NullString{String: mimeType, Valid: mimeType != ""},
+	}
+}
+
+func jobFor(f database.File) database.Job {
+	payload, _ := json.Marshal(extract.Payload{FileID: f.ID})
+	return database.Job{ID: uuid.New(), Kind: extract.JobKind, Payload: payload}
+}
+
+func TestSchedule_EnqueuesSupportedTypes(t *testing.T) {
+	mockQueue := new(MockQueue)
+	p := extract.NewPipeline(new(MockQueries), new(MockStorage), extract.DefaultRegistry(), mockQueue)
+	ctx := context.Background()
+	f := newFile("notes.txt", "text/plain", 100)
+
+	mockQueue.On("Enqueue", ctx, extract.JobKind, int32(7), extract.Payload{FileID: f.ID}).Return(database.Job{}, nil)
+
+	assert.NoError(t, p.Schedule(ctx, f))
+	mockQueue.AssertExpectations(t)
+}
+
+func TestSchedule_SkipsUnsupportedAndOversized(t *testing.T) {
+	mockQueue := new(MockQueue)
+	p := extract.NewPipeline(new(MockQueries), new(MockStorage), extract.DefaultRegistry(), mockQueue)
+	ctx := context.Background()
+
+	assert.NoError(t, p.Schedule(ctx, newFile("photo.png", "image/png", 100)))
+	assert.NoError(t, p.Schedule(ctx, newFile("huge.txt", "text/plain", 11<<20)))
+	mockQueue.AssertNotCalled(t, "Enqueue", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandle_StoresNormalizedText(t *testing.T) {
+	mockQ := new(MockQueries)
+	mockStorage := new(MockStorage)
+	p := extract.NewPipeline(mockQ, mockStorage, extract.DefaultRegistry(), new(MockQueue))
+	ctx := context.Background()
+	f := newFile("notes.md", "", 20)
+
+	mockQ.On("GetFileByID", ctx, f.ID).Return(f, nil)
+	mockStorage.On("ReadFile", int32(7), "docs/notes.md").Return(io.NopCloser(strings.NewReader("# Hello   **world**")), nil)
+	mockQ.On("SetFileContentText", ctx, database.SetFileContentTextParams{
+		ID:          f.ID,
+		ContentText: sql.NullString{String: "Hello world", Valid: true},
+	}).Return(int64(1), nil)
+
+	assert.NoError(t, p.Handle(ctx, jobFor(f)))
+	mockQ.AssertExpectations(t)
+}
+
+func TestHandle_DeletedFileIsDone(t *testing.T) {
+	mockQ := new(MockQueries)
+	p := extract.NewPipeline(mockQ, new(MockStorage), extract.DefaultRegistry(), new(MockQueue))
+	ctx := context.Background()
+	f := newFile("notes.txt", "text/plain", 20)
+
+	mockQ.On("GetFileByID", ctx, f.ID).Return(database.File{}, sql.ErrNoRows)
+
+	assert.NoError(t, p.Handle(ctx, jobFor(f)))
+	mockQ.AssertNotCalled(t, "SetFileContentText", mock.Anything, mock.Anything)
+}
+
+func TestHandle_StorageErrorIsRetried(t *testing.T) {
+	mockQ := new(MockQueries)
+	mockStorage := new(MockStorage)
+	p := extract.NewPipeline(mockQ, mockStorage, extract.DefaultRegistry(), new(MockQueue))
+	ctx := context.Background()
+	f := newFile("notes.txt", "text/plain", 20)
+
+	mockQ.On("GetFileByID", ctx, f.ID).Return(f, nil)
+	mockStorage.On("ReadFile", int32(7), "docs/notes.txt").Return(nil, errors.New("disk unavailable"))
+
+	err := p.Handle(ctx, jobFor(f))
+	assert.Error(t, err)
+	mockQ.AssertNotCalled(t, "SetFileContentText", mock.Anything, mock.Anything)
+}
+
+func TestHandle_InvalidPayload(t *testing.T) {
+	p := extract.NewPipeline(new(MockQueries), new(MockStorage), extract.DefaultRegistry(), new(MockQueue))
+
+	err := p.Handle(context.Background(), database.Job{Payload: json.RawMessage(`{}`)})
+	assert.Error(t, err)
+}
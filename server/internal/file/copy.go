@@ -0,0 +1,164 @@
+package file
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bellezhang119/cloud-storage/internal/conflict"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/bellezhang119/cloud-storage/internal/tag"
+	"github.com/google/uuid"
+)
+
+// CopyFile duplicates a file into destFolderID (nil for the root). When the
+// name is taken, onConflict decides between a "name (2)" copy, replacing the
+// existing file, or failing with conflict.ErrExists. Tags and properties are
+// copied along with the content.
+func (s *Service) CopyFile(ctx context.Context, fileID uuid.UUID, destFolderID *uuid.UUID, userID int32, onConflict string) (database.File, error) {
+	strategy, err := conflict.Parse(onConflict)
+	if err != nil {
+		return database.File{}, err
+	}
+
+	uID := sql.NullInt32{Int32: userID, Valid: true}
+
+	// 1. Source must be the caller's
+	src, err := s.queries.GetFileByID(ctx, fileID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.File{}, ErrNotFound
+		}
+		return database.File{}, fmt.Errorf("fetching file: %w", err)
+	}
+	if src.UserID.Int32 != userID {
+		return database.File{}, ErrNotFound
+	}
+
+	// 2. So must the destination
+	var folderPath string
+	var fID uuid.NullUUID
+	if destFolderID != nil {
+		dest, err := s.folderService.GetFolderByID(ctx, *destFolderID)
+		if err != nil || dest.UserID.Int32 != userID {
+			return database.File{}, fmt.Errorf("destination folder: %w", ErrNotFound)
+		}
+		folderPath, err = s.buildFolderPath(ctx, dest)
+		if err != nil {
+			return database.File{}, err
+		}
+		fID = uuid.NullUUID{UUID: *destFolderID, Valid: true}
+	}
+
+	// 3. Resolve a name clash
+	exists := func(name string) (database.File, bool, error) {
+		f, err := s.queries.GetFileByNameInFolder(ctx, database.GetFileByNameInFolderParams{UserID: uID, FolderID: fID, Name: name})
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.File{}, false, nil
+		}
+		if err != nil {
+			return database.File{}, false, fmt.Errorf("checking existing file: %w", err)
+		}
+		return f, true, nil
+	}
+
+	name := src.Name
+	existing, taken, err := exists(name)
+	if err != nil {
+		return database.File{}, err
+	}
+
+	if taken {
+		switch strategy {
+		case conflict.Fail:
+			return database.File{}, fmt.Errorf("%w: %s", conflict.ErrExists, name)
+		case conflict.Overwrite:
+			if existing.ID == src.ID {
+				return database.File{}, fmt.Errorf("%w: cannot overwrite a file with itself", conflict.ErrExists)
+			}
+		case conflict.Rename:
+			name, err = conflict.FreeName(name, true, func(candidate string) (bool, error) {
+				_, taken, err := exists(candidate)
+				return taken, err
+			})
+			if err != nil {
+				return database.File{}, err
+			}
+			taken = false
+		}
+	}
+
+	// 4. Quota. An overwrite only frees the existing file once the copy is
+	// complete, so for a moment both need room.
+	if err := quota.Check(ctx, s.queries, userID, src.SizeBytes); err != nil {
+		return database.File{}, err
+	}
+
+	// 5. Create DB record, then copy the content. An overwrite is copied in
+	// under a free name and takes the existing file's place at the end, so a
+	// failed copy leaves the existing file alone.
+	copyName := name
+	if taken {
+		copyName, err = conflict.FreeName(name, true, func(candidate string) (bool, error) {
+			_, taken, err := exists(candidate)
+			return taken, err
+		})
+		if err != nil {
+			return database.File{}, err
+		}
+	}
+
+	filePath := copyName
+	if folderPath != "" {
+		filePath = filepath.Join(folderPath, copyName)
+	}
+
+	copied, err := s.queries.CreateFile(ctx, database.CreateFileParams{
+		FolderID:  fID,
+		UserID:    uID,
+		Name:      copyName,
+		FilePath:  filePath,
+		SizeBytes: src.SizeBytes,
+		MimeType:  src.MimeType,
+		Sha256:    src.Sha256,
+	})
+	if err != nil {
+		return database.File{}, fmt.Errorf("creating file record: %w", err)
+	}
+
+	if err := s.storage.CopyFile(userID, src.FilePath, filePath); err != nil {
+		// rollback DB if storage fails
+		_, _ = s.queries.DeleteFile(ctx, database.DeleteFileParams{ID: copied.ID, UserID: uID})
+		return database.File{}, fmt.Errorf("copying file: %w", err)
+	}
+
+	// 6. Tags and properties
+	if s.metadata != nil {
+		if err := s.metadata.CopyMetadata(ctx, tag.KindFile, src.ID, copied.ID); err != nil {
+			_ = s.DeleteFile(ctx, copied.ID, userID)
+			return database.File{}, fmt.Errorf("copying metadata: %w", err)
+		}
+	}
+
+	// 7. Swap the finished copy in for the file it replaces
+	if taken {
+		if err := s.DeleteFile(ctx, existing.ID, userID); err != nil {
+			_ = s.DeleteFile(ctx, copied.ID, userID)
+			return database.File{}, fmt.Errorf("replacing existing file: %w", err)
+		}
+		if err := s.RenameFile(ctx, copied, name, userID); err != nil {
+			return database.File{}, fmt.Errorf("renaming copy to %s: %w", name, err)
+		}
+		copied.Name = name
+		copied.FilePath = filepath.Join(filepath.Dir(copied.FilePath), name)
+	}
+
+	for _, hook := range s.saveHooks {
+		hook(ctx, copied)
+	}
+
+	return copied, nil
+}
@@ -0,0 +1,43 @@
+package file
+
+import (
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+// FileResponse is the public view of a file's metadata.
+type FileResponse struct {
+	ID        uuid.UUID  `json:"id"`
+	FolderID  *uuid.UUID `json:"folder_id"`
+	Name      string     `json:"name"`
+	Path      string     `json:"path"`
+	SizeBytes int64      `json:"size_bytes"`
+	MimeType  string     `json:"mime_type,omitempty"`
+	SHA256    string     `json:"sha256,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Tags      []string   `json:"tags"`
+}
+
+func NewFileResponse(f database.File, tags []string) FileResponse {
+	res := FileResponse{
+		ID:        f.ID,
+		Name:      f.Name,
+		Path:      f.FilePath,
+		SizeBytes: f.SizeBytes,
+		MimeType:  f.MimeType.String,
+		SHA256:    f.Sha256.String,
+		CreatedAt: f.CreatedAt.Time,
+		UpdatedAt: f.UpdatedAt.Time,
+		Tags:      tags,
+	}
+	if f.FolderID.Valid {
+		res.FolderID = &f.FolderID.UUID
+	}
+	if res.Tags == nil {
+		res.Tags = []string{}
+	}
+	return res
+}
@@ -3,12 +3,17 @@ package file
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
+	"log"
 	"net/http"
-	"strconv"
 
+	"github.com/bellezhang119/cloud-storage/internal/conflict"
+	"github.com/bellezhang119/cloud-storage/internal/content"
 	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/bellezhang119/cloud-storage/internal/storage"
 	"github.com/bellezhang119/cloud-storage/internal/util"
 	"github.com/google/uuid"
 )
@@ -20,13 +25,12 @@ type ServiceInterface interface {
 		userID int32,
 		name string,
 		sizeBytes int64,
-		mimeType string,
 		content io.Reader,
 	) (database.File, error)
 	GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error)
-	GetFileByNameInFolder(ctx context.Context, folderID uuid.UUID, name string) (database.File, error)
+	GetFileByNameInFolder(ctx context.Context, folderID *uuid.UUID, userID int32, name string) (database.File, error)
 	ListFilesInFolder(ctx context.Context, folderID *uuid.UUID, userID int32) ([]database.File, error)
-	ListFilesRecursive(ctx context.Context, folderID uuid.UUID, userID int32)
+	ListFilesRecursive(ctx context.Context, folderID uuid.UUID, userID int32) ([]database.ListFilesRecursiveRow, error)
 	GetFileForDownload(ctx context.Context, fileID uuid.UUID, userID int32) (database.File, io.ReadCloser, error)
 	DeleteFile(ctx context.Context, fileID uuid.UUID, userID int32) error
 	UpdateFileMetadata(
@@ -36,21 +40,41 @@ type ServiceInterface interface {
 		userID int32,
 	) error
 	UpdateFilePath(ctx context.Context, fileID uuid.UUID, path string, userID int32) error
-	MoveFile(
-		ctx context.Context,
-		fileID uuid.UUID,
-		oldPath, newPath string,
-		userID int32,
-	) error
+	MoveFile(ctx context.Context, file database.File, destFolderID *uuid.UUID, userID int32) error
 	RenameFile(ctx context.Context, file database.File, newName string, userID int32) error
+	ListFileTags(ctx context.Context, fileIDs []uuid.UUID) (map[uuid.UUID][]string, error)
+	CopyFile(ctx context.Context, fileID uuid.UUID, destFolderID *uuid.UUID, userID int32, onConflict string) (database.File, error)
+}
+
+type CopyFileRequest struct {
+	// Destination folder; null or omitted copies to the root
+	FolderID   *uuid.UUID `json:"folder_id"`
+	OnConflict string     `json:"on_conflict"`
+}
+
+// All handlers here must be mounted behind AuthMiddleware.
+
+// fileIDFromRequest reads the file ID from the path, or from the file_id
+// query parameter on the legacy routes that predate path IDs.
+func fileIDFromRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	raw := r.PathValue("id")
+	if raw == "" {
+		raw = r.URL.Query().Get("file_id")
+	}
+	fileID, err := uuid.Parse(raw)
+	if err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid file ID")
+		return uuid.Nil, false
+	}
+	return fileID, true
 }
 
 // UploadFileHandler handles uploading a file
 func UploadFileHandler(service ServiceInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
-		if err != nil {
-			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
@@ -70,10 +94,22 @@ func UploadFileHandler(service ServiceInterface) http.HandlerFunc {
 			util.RespondWithError(w, http.StatusBadRequest, "File name is required")
 			return
 		}
+		if !storage.ValidName(name) {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid file name")
+			return
+		}
 
-		mimeType := r.Header.Get("Content-Type")
-		fileMeta, err := service.SaveFile(r.Context(), folderID, int32(userID), name, r.ContentLength, mimeType, r.Body)
+		// Content-Type is ignored; SaveFile sniffs the real type
+		fileMeta, err := service.SaveFile(r.Context(), folderID, userID, name, r.ContentLength, r.Body)
 		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				util.RespondWithError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			if errors.Is(err, quota.ErrExceeded) {
+				util.RespondWithError(w, http.StatusInsufficientStorage, err.Error())
+				return
+			}
 			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -82,37 +118,39 @@ func UploadFileHandler(service ServiceInterface) http.HandlerFunc {
 	}
 }
 
-// DownloadFileHandler handles downloading a file
+// DownloadFileHandler handles downloading a file. With ?disposition=inline,
+// types that are safe to render are shown in the browser instead.
 func DownloadFileHandler(service ServiceInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
-		if err != nil {
-			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		fileIDStr := r.URL.Query().Get("file_id")
-		fileID, err := uuid.Parse(fileIDStr)
-		if err != nil {
-			util.RespondWithError(w, http.StatusBadRequest, "Invalid file ID")
+		fileID, ok := fileIDFromRequest(w, r)
+		if !ok {
 			return
 		}
 
-		fileMeta, reader, err := service.GetFileForDownload(r.Context(), fileID, int32(userID))
+		disposition, ok := content.ParseDisposition(r.URL.Query().Get("disposition"))
+		if !ok {
+			util.RespondWithError(w, http.StatusBadRequest, "disposition must be inline or attachment")
+			return
+		}
+
+		fileMeta, reader, err := service.GetFileForDownload(r.Context(), fileID, userID)
 		if err != nil {
 			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 		defer reader.Close()
 
-		w.Header().Set("Content-Disposition", `attachment; filename="`+fileMeta.Name+`"`)
-		w.Header().Set("Content-Type", fileMeta.MimeType.String)
-		w.Header().Set("Content-Length", strconv.FormatInt(fileMeta.SizeBytes, 10))
+		content.SetHeaders(w.Header(), fileMeta.Name, fileMeta.MimeType.String, fileMeta.SizeBytes, disposition)
 		w.WriteHeader(http.StatusOK)
 
 		if _, err := io.Copy(w, reader); err != nil {
-			// Log streaming error
-			fmt.Printf("Error streaming file: %v\n", err)
+			log.Printf("streaming file %s: %v", fileMeta.ID, err)
 		}
 	}
 }
@@ -120,20 +158,18 @@ func DownloadFileHandler(service ServiceInterface) http.HandlerFunc {
 // DeleteFileHandler handles deleting a file
 func DeleteFileHandler(service ServiceInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
-		if err != nil {
-			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		fileIDStr := r.URL.Query().Get("file_id")
-		fileID, err := uuid.Parse(fileIDStr)
-		if err != nil {
-			util.RespondWithError(w, http.StatusBadRequest, "Invalid file ID")
+		fileID, ok := fileIDFromRequest(w, r)
+		if !ok {
 			return
 		}
 
-		if err := service.DeleteFile(r.Context(), fileID, int32(userID)); err != nil {
+		if err := service.DeleteFile(r.Context(), fileID, userID); err != nil {
 			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -145,16 +181,14 @@ func DeleteFileHandler(service ServiceInterface) http.HandlerFunc {
 // RenameFileHandler handles renaming a file
 func RenameFileHandler(service ServiceInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
-		if err != nil {
-			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
-		fileIDStr := r.URL.Query().Get("file_id")
-		fileID, err := uuid.Parse(fileIDStr)
-		if err != nil {
-			util.RespondWithError(w, http.StatusBadRequest, "Invalid file ID")
+		fileID, ok := fileIDFromRequest(w, r)
+		if !ok {
 			return
 		}
 
@@ -169,6 +203,10 @@ func RenameFileHandler(service ServiceInterface) http.HandlerFunc {
 			util.RespondWithError(w, http.StatusBadRequest, "New file name is required")
 			return
 		}
+		if !storage.ValidName(req.NewName) {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid file name")
+			return
+		}
 
 		// Fetch file first
 		fileMeta, err := service.GetFileByID(r.Context(), fileID)
@@ -178,7 +216,7 @@ func RenameFileHandler(service ServiceInterface) http.HandlerFunc {
 		}
 
 		// Rename file
-		if err := service.RenameFile(r.Context(), fileMeta, req.NewName, int32(userID)); err != nil {
+		if err := service.RenameFile(r.Context(), fileMeta, req.NewName, userID); err != nil {
 			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -190,9 +228,9 @@ func RenameFileHandler(service ServiceInterface) http.HandlerFunc {
 // ListFilesInFolderHandler handles listing files in a folder
 func ListFilesInFolderHandler(service ServiceInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
-		if err != nil {
-			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 
@@ -207,12 +245,74 @@ func ListFilesInFolderHandler(service ServiceInterface) http.HandlerFunc {
 			folderID = &id
 		}
 
-		files, err := service.ListFilesInFolder(r.Context(), folderID, int32(userID))
+		files, err := service.ListFilesInFolder(r.Context(), folderID, userID)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		ids := make([]uuid.UUID, 0, len(files))
+		for _, f := range files {
+			ids = append(ids, f.ID)
+		}
+		tags, err := service.ListFileTags(r.Context(), ids)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		res := make([]FileResponse, 0, len(files))
+		for _, f := range files {
+			res = append(res, NewFileResponse(f, tags[f.ID]))
+		}
+		util.RespondWithJSON(w, http.StatusOK, res)
+	}
+}
+
+// CopyFileHandler duplicates a file, defaulting to a "name (2)" copy when the
+// destination already has a file of that name.
+func CopyFileHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		fileID, ok := fileIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+
+		var req CopyFileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		copied, err := service.CopyFile(r.Context(), fileID, req.FolderID, userID, req.OnConflict)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrNotFound):
+				util.RespondWithError(w, http.StatusNotFound, err.Error())
+			case errors.Is(err, conflict.ErrExists):
+				util.RespondWithError(w, http.StatusConflict, err.Error())
+			case errors.Is(err, conflict.ErrInvalidStrategy):
+				util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			case errors.Is(err, quota.ErrExceeded):
+				util.RespondWithError(w, http.StatusInsufficientStorage, err.Error())
+			default:
+				util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		tags, err := service.ListFileTags(r.Context(), []uuid.UUID{copied.ID})
 		if err != nil {
 			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 
-		util.RespondWithJSON(w, http.StatusOK, files)
+		util.RespondWithJSON(w, http.StatusCreated, NewFileResponse(copied, tags[copied.ID]))
 	}
 }
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/file"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) CreateFile(ctx context.Context, arg database.CreateFileParams) (database.File, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockQueries) GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockQueries) GetFileByNameInFolder(ctx context.Context, arg database.GetFileByNameInFolderParams) (database.File, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockQueries) ListFilesInFolder(ctx context.Context, arg database.ListFilesInFolderParams) ([]database.File, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.File), args.Error(1)
+}
+
+func (m *MockQueries) DeleteFile(ctx context.Context, arg database.DeleteFileParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) ListFilesRecursive(ctx context.Context, arg database.ListFilesRecursiveParams) ([]database.ListFilesRecursiveRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ListFilesRecursiveRow), args.Error(1)
+}
+
+func (m *MockQueries) UpdateFileMetadata(ctx context.Context, arg database.UpdateFileMetadataParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) UpdateFilePath(ctx context.Context, arg database.UpdateFilePathParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) UpdateFileLocation(ctx context.Context, arg database.UpdateFileLocationParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) ListTagsForItems(ctx context.Context, arg database.ListTagsForItemsParams) ([]database.ListTagsForItemsRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ListTagsForItemsRow), args.Error(1)
+}
+
+func (m *MockQueries) GetStorageUsage(ctx context.Context, id int32) (database.GetStorageUsageRow, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.GetStorageUsageRow), args.Error(1)
+}
+
+func (m *MockQueries) SetFileContentHash(ctx context.Context, arg database.SetFileContentHashParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) ReplaceFileContent(ctx context.Context, arg database.ReplaceFileContentParams) (database.File, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+type MockFolderService struct {
+	mock.Mock
+}
+
+func (m *MockFolderService) CreateFolder(ctx context.Context, userID int32, name string, parentID uuid.NullUUID) (database.Folder, error) {
+	args := m.Called(ctx, userID, name, parentID)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func (m *MockFolderService) GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func (m *MockFolderService) ListFoldersByParent(ctx context.Context, userID int32, parentID uuid.NullUUID) ([]database.Folder, error) {
+	args := m.Called(ctx, userID, parentID)
+	return args.Get(0).([]database.Folder), args.Error(1)
+}
+
+func (m *MockFolderService) FolderPath(ctx context.Context, folderID uuid.UUID) (string, error) {
+	args := m.Called(ctx, folderID)
+	return args.String(0), args.Error(1)
+}
+
+var uID = sql.NullInt32{Int32: 1, Valid: true}
+
+func uploadRequest(body string, contentLength int64) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/files?name=big.txt", strings.NewReader(body))
+	req.ContentLength = contentLength
+	return req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(1)))
+}
+
+func TestUploadFileHandler_OverQuota(t *testing.T) {
+	q := new(MockQueries)
+	q.On("GetFileByNameInFolder", mock.Anything, mock.Anything).Return(database.File{}, sql.ErrNoRows)
+	q.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{UsedBytes: 90, StorageQuota: 100}, nil)
+	svc := file.NewService(q, nil, storage.NewLocalStorage(t.TempDir()))
+
+	rec := httptest.NewRecorder()
+	file.UploadFileHandler(svc).ServeHTTP(rec, uploadRequest(strings.Repeat("x", 50), 50))
+
+	assert.Equal(t, http.StatusInsufficientStorage, rec.Code)
+	q.AssertNotCalled(t, "CreateFile", mock.Anything, mock.Anything)
+}
+
+func TestSaveFile_UndeclaredSizeCutOffAtQuota(t *testing.T) {
+	q := new(MockQueries)
+	q.On("GetFileByNameInFolder", mock.Anything, mock.Anything).Return(database.File{}, sql.ErrNoRows)
+	q.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{UsedBytes: 90, StorageQuota: 100}, nil)
+	q.On("CreateFile", mock.Anything, mock.Anything).Return(database.File{ID: uuid.New(), UserID: uID}, nil)
+	q.On("DeleteFile", mock.Anything, mock.Anything).Return(int64(1), nil)
+	dir := t.TempDir()
+	svc := file.NewService(q, nil, storage.NewLocalStorage(dir))
+
+	_, err := svc.SaveFile(context.Background(), nil, 1, "big.txt", -1, strings.NewReader(strings.Repeat("x", 50)))
+
+	require.ErrorIs(t, err, quota.ErrExceeded)
+	q.AssertCalled(t, "DeleteFile", mock.Anything, mock.Anything)
+	_, err = storage.NewLocalStorage(dir).ReadFile(1, "big.txt")
+	assert.Error(t, err, "nothing is left on disk")
+}
+
+func TestSaveFile_ReplacementAllowsForOldSize(t *testing.T) {
+	q := new(MockQueries)
+	existing := database.File{ID: uuid.New(), UserID: uID, Name: "big.txt", FilePath: "big.txt", SizeBytes: 40}
+	q.On("GetFileByNameInFolder", mock.Anything, mock.Anything).Return(existing, nil)
+	q.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{UsedBytes: 90, StorageQuota: 100}, nil)
+	q.On("ReplaceFileContent", mock.Anything, mock.Anything).Return(existing, nil)
+	svc := file.NewService(q, nil, storage.NewLocalStorage(t.TempDir()))
+
+	_, err := svc.SaveFile(context.Background(), nil, 1, "big.txt", 50, strings.NewReader(strings.Repeat("x", 50)))
+
+	assert.NoError(t, err)
+}
+
+func TestSaveFile_FolderPathFailureWritesNothing(t *testing.T) {
+	q := new(MockQueries)
+	folders := new(MockFolderService)
+	folderID := uuid.New()
+	folders.On("GetFolderByID", mock.Anything, folderID).Return(database.Folder{ID: folderID, UserID: uID, Name: "docs"}, nil)
+	folders.On("FolderPath", mock.Anything, folderID).Return("", errors.New("connection reset"))
+	dir := t.TempDir()
+	svc := file.NewService(q, folders, storage.NewLocalStorage(dir))
+
+	_, err := svc.SaveFile(context.Background(), &folderID, 1, "a.txt", 1, strings.NewReader("x"))
+
+	assert.ErrorContains(t, err, "connection reset")
+	q.AssertNotCalled(t, "CreateFile", mock.Anything, mock.Anything)
+	_, err = storage.NewLocalStorage(dir).ReadFile(1, "docs/a.txt")
+	assert.Error(t, err, "nothing lands in a same-named top-level folder")
+}
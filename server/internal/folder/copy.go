@@ -0,0 +1,360 @@
+package folder
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bellezhang119/cloud-storage/internal/conflict"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/jobs"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/bellezhang119/cloud-storage/internal/tag"
+	"github.com/google/uuid"
+)
+
+// CopyJobKind is the job queue kind for background folder copies.
+const CopyJobKind = "copy_folder"
+
+// Copies bigger than either limit are handed to the job queue.
+const (
+	AsyncCopyFiles = 200
+	AsyncCopyBytes = 512 << 20
+)
+
+var (
+	ErrNotFound           = errors.New("folder not found")
+	ErrInvalidDestination = errors.New("a folder cannot be moved or copied into itself")
+)
+
+type CopyPayload struct {
+	FolderID   uuid.UUID     `json:"folder_id"`
+	ParentID   uuid.NullUUID `json:"parent_id"`
+	OnConflict string        `json:"on_conflict"`
+}
+
+type CopyResult struct {
+	FolderID uuid.UUID `json:"folder_id"`
+}
+
+// copyPlan is everything CopyFolder needs, worked out before anything is
+// written.
+type copyPlan struct {
+	src      database.Folder
+	dest     uuid.NullUUID
+	name     string
+	replace  *database.Folder
+	folders  []database.ListFoldersRecursiveRow
+	files    []database.ListFilesRecursiveRow
+	bytes    int64
+	strategy string
+}
+
+func (s *Service) ownedFolder(ctx context.Context, id uuid.UUID, userID int32) (database.Folder, error) {
+	f, err := s.queries.GetFolderByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Folder{}, ErrNotFound
+		}
+		return database.Folder{}, fmt.Errorf("fetching folder: %w", err)
+	}
+	if f.UserID.Int32 != userID {
+		return database.Folder{}, ErrNotFound
+	}
+	return f, nil
+}
+
+func (s *Service) planCopy(ctx context.Context, folderID uuid.UUID, dest uuid.NullUUID, userID int32, onConflict string) (copyPlan, error) {
+	strategy, err := conflict.Parse(onConflict)
+	if err != nil {
+		return copyPlan{}, err
+	}
+	uID := sql.NullInt32{Int32: userID, Valid: true}
+
+	src, err := s.ownedFolder(ctx, folderID, userID)
+	if err != nil {
+		return copyPlan{}, err
+	}
+	if dest.Valid {
+		if _, err := s.ownedFolder(ctx, dest.UUID, userID); err != nil {
+			return copyPlan{}, fmt.Errorf("destination: %w", err)
+		}
+	}
+
+	folders, err := s.queries.ListFoldersRecursive(ctx, database.ListFoldersRecursiveParams{ID: folderID, UserID: uID})
+	if err != nil {
+		return copyPlan{}, fmt.Errorf("listing subfolders: %w", err)
+	}
+	for _, f := range folders {
+		if dest.Valid && f.ID == dest.UUID {
+			return copyPlan{}, ErrInvalidDestination
+		}
+	}
+
+	files, err := s.fileService.ListFilesRecursive(ctx, folderID, userID)
+	if err != nil {
+		return copyPlan{}, fmt.Errorf("listing files: %w", err)
+	}
+	folders, files = withoutTrashed(src, folders, files)
+
+	plan := copyPlan{src: src, dest: dest, name: src.Name, folders: folders, files: files, strategy: strategy}
+	for _, f := range files {
+		plan.bytes += f.SizeBytes
+	}
+
+	existing, taken, err := s.folderNamed(ctx, userID, dest, plan.name)
+	if err != nil {
+		return copyPlan{}, err
+	}
+
+	if taken {
+		switch strategy {
+		case conflict.Fail:
+			return copyPlan{}, fmt.Errorf("%w: %s", conflict.ErrExists, plan.name)
+		case conflict.Overwrite:
+			if existing.ID == src.ID {
+				return copyPlan{}, fmt.Errorf("%w: cannot overwrite a folder with itself", conflict.ErrExists)
+			}
+			// Replacing a folder that holds the source would delete the
+			// source along with it
+			inside, err := s.queries.IsFolderInSubtree(ctx, database.IsFolderInSubtreeParams{
+				RootID:      existing.ID,
+				CandidateID: src.ID,
+			})
+			if err != nil {
+				return copyPlan{}, fmt.Errorf("checking folder to replace: %w", err)
+			}
+			if inside {
+				return copyPlan{}, fmt.Errorf("%w: cannot overwrite a folder that contains the source", ErrInvalidDestination)
+			}
+			plan.replace = &existing
+		case conflict.Rename:
+			plan.name, err = s.freeFolderName(ctx, userID, dest, plan.name)
+			if err != nil {
+				return copyPlan{}, err
+			}
+		}
+	}
+
+	// An overwrite only deletes the existing folder once the copy is
+	// complete, so the copy needs room of its own
+	if err := quota.Check(ctx, s.queries, userID, plan.bytes); err != nil {
+		return copyPlan{}, err
+	}
+
+	return plan, nil
+}
+
+// folderNamed looks up the folder called name directly under parent.
+func (s *Service) folderNamed(ctx context.Context, userID int32, parent uuid.NullUUID, name string) (database.Folder, bool, error) {
+	f, err := s.queries.GetFolderByNameInParent(ctx, database.GetFolderByNameInParentParams{
+		UserID:   sql.NullInt32{Int32: userID, Valid: true},
+		ParentID: parent,
+		Name:     name,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Folder{}, false, nil
+	}
+	if err != nil {
+		return database.Folder{}, false, fmt.Errorf("checking existing folder: %w", err)
+	}
+	return f, true, nil
+}
+
+func (s *Service) freeFolderName(ctx context.Context, userID int32, parent uuid.NullUUID, name string) (string, error) {
+	return conflict.FreeName(name, false, func(candidate string) (bool, error) {
+		_, taken, err := s.folderNamed(ctx, userID, parent, candidate)
+		return taken, err
+	})
+}
+
+// withoutTrashed drops the parts of the tree that were trashed on their own.
+// When src itself is in the trash, what was trashed along with it still
+// counts as its contents.
+func withoutTrashed(src database.Folder, folders []database.ListFoldersRecursiveRow, files []database.ListFilesRecursiveRow) ([]database.ListFoldersRecursiveRow, []database.ListFilesRecursiveRow) {
+	kept := func(t sql.NullTime) bool {
+		return !t.Valid || (src.TrashedAt.Valid && t.Time.Equal(src.TrashedAt.Time))
+	}
+
+	keptFolders := map[uuid.UUID]bool{}
+	var outFolders []database.ListFoldersRecursiveRow
+	for _, f := range folders {
+		if f.ID == src.ID || kept(f.TrashedAt) {
+			keptFolders[f.ID] = true
+			outFolders = append(outFolders, f)
+		}
+	}
+
+	var outFiles []database.ListFilesRecursiveRow
+	for _, f := range files {
+		if keptFolders[f.FolderID.UUID] && kept(f.TrashedAt) {
+			outFiles = append(outFiles, f)
+		}
+	}
+	return outFolders, outFiles
+}
+
+// CopyFolder recursively duplicates a folder under dest (invalid for the
+// root), with the same conflict strategies as file copies. Tags and
+// properties come along. A copy that fails halfway is removed again.
+func (s *Service) CopyFolder(ctx context.Context, folderID uuid.UUID, dest uuid.NullUUID, userID int32, onConflict string) (database.Folder, error) {
+	plan, err := s.planCopy(ctx, folderID, dest, userID, onConflict)
+	if err != nil {
+		return database.Folder{}, err
+	}
+	return s.copy(ctx, plan, userID)
+}
+
+// StartCopyFolder validates a copy and then either runs it straight away or,
+// for large trees, queues it. Exactly one of the returned folder and job is
+// set.
+func (s *Service) StartCopyFolder(ctx context.Context, folderID uuid.UUID, dest uuid.NullUUID, userID int32, onConflict string) (*database.Folder, *database.Job, error) {
+	plan, err := s.planCopy(ctx, folderID, dest, userID, onConflict)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.queue != nil && (len(plan.files) > AsyncCopyFiles || plan.bytes > AsyncCopyBytes) {
+		job, err := s.queue.Enqueue(ctx, CopyJobKind, userID, CopyPayload{
+			FolderID:   folderID,
+			ParentID:   dest,
+			OnConflict: plan.strategy,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, &job, nil
+	}
+
+	copied, err := s.copy(ctx, plan, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &copied, nil, nil
+}
+
+// HandleCopyJob is the jobs.HandlerFunc for CopyJobKind.
+func (s *Service) HandleCopyJob(ctx context.Context, job database.Job) error {
+	var payload CopyPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil || payload.FolderID == uuid.Nil || !job.UserID.Valid {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %s", job.Payload))
+	}
+
+	copied, err := s.CopyFolder(ctx, payload.FolderID, payload.ParentID, job.UserID.Int32, payload.OnConflict)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidDestination) ||
+			errors.Is(err, conflict.ErrExists) || errors.Is(err, quota.ErrExceeded) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	return jobs.SetResult(ctx, CopyResult{FolderID: copied.ID})
+}
+
+func (s *Service) copy(ctx context.Context, plan copyPlan, userID int32) (database.Folder, error) {
+	// An overwrite is built under a free name next to the folder it replaces
+	// and only swapped in once complete, so a failed copy loses nothing
+	name := plan.name
+	if plan.replace != nil {
+		var err error
+		if name, err = s.freeFolderName(ctx, userID, plan.dest, plan.name); err != nil {
+			return database.Folder{}, err
+		}
+	}
+
+	root, err := s.CreateFolder(ctx, userID, name, plan.dest)
+	if err != nil {
+		return database.Folder{}, err
+	}
+
+	if err := s.copyContents(ctx, plan, root, userID); err != nil {
+		if cleanupErr := s.DeleteFolder(ctx, root.ID, userID); cleanupErr != nil {
+			return database.Folder{}, fmt.Errorf("copy failed (%v), cleanup also failed: %v", err, cleanupErr)
+		}
+		return database.Folder{}, err
+	}
+
+	if plan.replace != nil {
+		if err := s.DeleteFolder(ctx, plan.replace.ID, userID); err != nil {
+			if cleanupErr := s.DeleteFolder(ctx, root.ID, userID); cleanupErr != nil {
+				return database.Folder{}, fmt.Errorf("replacing existing folder failed (%v), cleanup also failed: %v", err, cleanupErr)
+			}
+			return database.Folder{}, fmt.Errorf("replacing existing folder: %w", err)
+		}
+		if err := s.RenameFolder(ctx, root.ID, plan.name, userID); err != nil {
+			return database.Folder{}, fmt.Errorf("renaming copy to %s: %w", plan.name, err)
+		}
+		root.Name = plan.name
+	}
+
+	return root, nil
+}
+
+func (s *Service) copyContents(ctx context.Context, plan copyPlan, root database.Folder, userID int32) error {
+	total := int64(len(plan.folders) + len(plan.files))
+	var done int64
+
+	// Map each source folder to its copy, parents before children
+	children := map[uuid.UUID][]database.ListFoldersRecursiveRow{}
+	for _, f := range plan.folders {
+		if f.ParentID.Valid && f.ID != plan.src.ID {
+			children[f.ParentID.UUID] = append(children[f.ParentID.UUID], f)
+		}
+	}
+
+	copies := map[uuid.UUID]uuid.UUID{plan.src.ID: root.ID}
+	if err := s.copyMetadata(ctx, plan.src.ID, root.ID); err != nil {
+		return err
+	}
+	done++
+
+	queue := []uuid.UUID{plan.src.ID}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+
+		for _, child := range children[parent] {
+			created, err := s.CreateFolder(ctx, userID, child.Name, uuid.NullUUID{UUID: copies[parent], Valid: true})
+			if err != nil {
+				return fmt.Errorf("copying folder %s: %w", child.Name, err)
+			}
+			if err := s.copyMetadata(ctx, child.ID, created.ID); err != nil {
+				return err
+			}
+			copies[child.ID] = created.ID
+			queue = append(queue, child.ID)
+
+			done++
+			jobs.ReportProgress(ctx, done, total)
+		}
+	}
+
+	for _, f := range plan.files {
+		destID, ok := copies[f.FolderID.UUID]
+		if !ok {
+			return fmt.Errorf("copying file %s: folder %s was not copied", f.Name, f.FolderID.UUID)
+		}
+		// The tree is brand new, so a clash means something raced us
+		if _, err := s.fileService.CopyFile(ctx, f.FileID, &destID, userID, conflict.Fail); err != nil {
+			return fmt.Errorf("copying file %s: %w", f.Name, err)
+		}
+
+		done++
+		jobs.ReportProgress(ctx, done, total)
+	}
+
+	return nil
+}
+
+func (s *Service) copyMetadata(ctx context.Context, srcID, dstID uuid.UUID) error {
+	if s.metadata == nil {
+		return nil
+	}
+	if err := s.metadata.CopyMetadata(ctx, tag.KindFolder, srcID, dstID); err != nil {
+		return fmt.Errorf("copying metadata: %w", err)
+	}
+	return nil
+}
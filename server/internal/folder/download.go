@@ -0,0 +1,82 @@
+package folder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/bellezhang119/cloud-storage/internal/archive"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+// ArchiveFolder lays out a folder for archive.Write, with entries starting
+// at the folder's own name. Unlike storage.ZipFolder the tree comes from the
+// database, so empty folders and modification times survive and the
+// manifest can carry the checksums recorded at upload.
+func (s *Service) ArchiveFolder(ctx context.Context, folderID uuid.UUID, userID int32) (database.Folder, []archive.TreeEntry, error) {
+	src, err := s.ownedFolder(ctx, folderID, userID)
+	if err != nil {
+		return database.Folder{}, nil, err
+	}
+
+	entries, err := s.archiveEntries(ctx, src, userID)
+	if err != nil {
+		return database.Folder{}, nil, err
+	}
+	return src, entries, nil
+}
+
+// archiveEntries lays out a folder's tree for archive.Write, parents before
+// children.
+func (s *Service) archiveEntries(ctx context.Context, src database.Folder, userID int32) ([]archive.TreeEntry, error) {
+	folders, err := s.queries.ListFoldersRecursive(ctx, database.ListFoldersRecursiveParams{
+		ID:     src.ID,
+		UserID: sql.NullInt32{Int32: userID, Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing subfolders: %w", err)
+	}
+	files, err := s.fileService.ListFilesRecursive(ctx, src.ID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing files: %w", err)
+	}
+	folders, files = withoutTrashed(src, folders, files)
+
+	// Folders come shallowest first, so a parent's path is always known
+	paths := map[uuid.UUID]string{src.ID: src.Name}
+	entries := []archive.TreeEntry{{Path: src.Name, IsDir: true, ModTime: archive.ModTime(src.UpdatedAt, src.CreatedAt)}}
+	for _, f := range folders {
+		if f.ID == src.ID {
+			continue
+		}
+		parent, ok := paths[f.ParentID.UUID]
+		if !ok {
+			return nil, fmt.Errorf("folder %s is outside the tree", f.ID)
+		}
+		p := path.Join(parent, f.Name)
+		paths[f.ID] = p
+		entries = append(entries, archive.TreeEntry{Path: p, IsDir: true, ModTime: archive.ModTime(f.UpdatedAt, f.CreatedAt)})
+	}
+
+	for _, f := range files {
+		parent, ok := paths[f.FolderID.UUID]
+		if !ok {
+			return nil, fmt.Errorf("file %s is outside the tree", f.FileID)
+		}
+		filePath := f.FilePath
+		entries = append(entries, archive.TreeEntry{
+			Path:     path.Join(parent, f.Name),
+			Size:     f.SizeBytes,
+			ModTime:  archive.ModTime(f.UpdatedAt, f.CreatedAt),
+			SHA256:   f.Sha256.String,
+			MimeType: f.MimeType.String,
+			Open: func() (io.ReadCloser, error) {
+				return s.storage.ReadFile(userID, filePath)
+			},
+		})
+	}
+	return entries, nil
+}
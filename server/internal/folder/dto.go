@@ -0,0 +1,30 @@
+package folder
+
+import (
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+// FolderResponse is the public view of a folder.
+type FolderResponse struct {
+	ID        uuid.UUID  `json:"id"`
+	ParentID  *uuid.UUID `json:"parent_id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func NewFolderResponse(f database.Folder) FolderResponse {
+	res := FolderResponse{
+		ID:        f.ID,
+		Name:      f.Name,
+		CreatedAt: f.CreatedAt.Time,
+		UpdatedAt: f.UpdatedAt.Time,
+	}
+	if f.ParentID.Valid {
+		res.ParentID = &f.ParentID.UUID
+	}
+	return res
+}
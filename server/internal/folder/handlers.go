@@ -0,0 +1,197 @@
+package folder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/bellezhang119/cloud-storage/internal/archive"
+	"github.com/bellezhang119/cloud-storage/internal/conflict"
+	"github.com/bellezhang119/cloud-storage/internal/content"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+)
+
+// All handlers here must be mounted behind AuthMiddleware.
+
+type ServiceInterface interface {
+	ListFoldersByParent(ctx context.Context, userID int32, parentID uuid.NullUUID) ([]database.Folder, error)
+	StartCopyFolder(ctx context.Context, folderID uuid.UUID, dest uuid.NullUUID, userID int32, onConflict string) (*database.Folder, *database.Job, error)
+	ArchiveFolder(ctx context.Context, folderID uuid.UUID, userID int32) (database.Folder, []archive.TreeEntry, error)
+}
+
+type CopyFolderRequest struct {
+	// Destination parent; null or omitted copies to the root
+	ParentID   *uuid.UUID `json:"parent_id"`
+	OnConflict string     `json:"on_conflict"`
+}
+
+type JobAccepted struct {
+	JobID     uuid.UUID `json:"job_id"`
+	StatusURL string    `json:"status_url"`
+}
+
+func respondWithServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		util.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, conflict.ErrExists):
+		util.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrInvalidDestination), errors.Is(err, conflict.ErrInvalidStrategy):
+		util.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, quota.ErrExceeded):
+		util.RespondWithError(w, http.StatusInsufficientStorage, err.Error())
+	default:
+		util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// CopyFolderHandler copies small trees inline (201 with the new folder) and
+// queues large ones (202 with a job to poll).
+func CopyFolderHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		folderID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid folder ID")
+			return
+		}
+
+		var req CopyFolderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		var dest uuid.NullUUID
+		if req.ParentID != nil {
+			dest = uuid.NullUUID{UUID: *req.ParentID, Valid: true}
+		}
+
+		copied, job, err := service.StartCopyFolder(r.Context(), folderID, dest, userID, req.OnConflict)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+
+		if job != nil {
+			util.RespondWithJSON(w, http.StatusAccepted, JobAccepted{
+				JobID:     job.ID,
+				StatusURL: "/jobs/" + job.ID.String(),
+			})
+			return
+		}
+		util.RespondWithJSON(w, http.StatusCreated, NewFolderResponse(*copied))
+	}
+}
+
+// ListFoldersHandler lists the children of ?parent_id=, or the root folders
+// when it is omitted.
+func ListFoldersHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var parentID uuid.NullUUID
+		if v := r.URL.Query().Get("parent_id"); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				util.RespondWithError(w, http.StatusBadRequest, "Invalid parent ID")
+				return
+			}
+			parentID = uuid.NullUUID{UUID: id, Valid: true}
+		}
+
+		folders, err := service.ListFoldersByParent(r.Context(), userID, parentID)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		res := make([]FolderResponse, 0, len(folders))
+		for _, f := range folders {
+			res = append(res, NewFolderResponse(f))
+		}
+		util.RespondWithJSON(w, http.StatusOK, res)
+	}
+}
+
+// archiveWriter sets the download headers on the first write, so an error
+// raised before any data is produced can still be sent as JSON.
+type archiveWriter struct {
+	w        http.ResponseWriter
+	format   archive.Format
+	filename string
+	started  bool
+}
+
+func (a *archiveWriter) Write(p []byte) (int, error) {
+	if !a.started {
+		a.w.Header().Set("Content-Type", a.format.ContentType())
+		a.w.Header().Set("Content-Disposition", content.Disposition(content.DispositionAttachment, a.filename))
+		content.SetSafetyHeaders(a.w.Header())
+		a.started = true
+	}
+	return a.w.Write(p)
+}
+
+// DownloadFolderHandler serves GET /folders/{id}/download?format=&level=,
+// streaming the folder as a zip (the default), tar or tar.gz with a
+// manifest.json beside it. level is the 0-9 compression level for zip and
+// tar.gz.
+func DownloadFolderHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		folderID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid folder ID")
+			return
+		}
+
+		opts := archive.WriteOptions{Format: archive.FormatZip}
+		if v := r.URL.Query().Get("format"); v != "" {
+			if opts.Format, ok = archive.ParseFormat(v); !ok {
+				util.RespondWithError(w, http.StatusBadRequest, "format must be zip, tar or tar.gz")
+				return
+			}
+		}
+		if opts.Level, err = archive.ParseLevel(r.URL.Query().Get("level")); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		src, entries, err := service.ArchiveFolder(r.Context(), folderID, userID)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+
+		aw := &archiveWriter{w: w, format: opts.Format, filename: src.Name + opts.Format.Extension()}
+		if err := archive.Write(aw, opts, entries); err != nil {
+			if !aw.started {
+				util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			// Part of the archive is already out; all we can do is log
+			log.Printf("folder download for user %d: %v", userID, err)
+		}
+	}
+}
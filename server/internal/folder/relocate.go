@@ -0,0 +1,93 @@
+package folder
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+)
+
+// RelocateJobKind gives the duplicates renamed by the root uniqueness
+// migration data of their own. The migration queues the first run.
+const RelocateJobKind = "storage_relocate"
+
+const defaultRelocateBatch = 200
+
+type RelocateQueries interface {
+	ListStorageRelocations(ctx context.Context, limit int32) ([]database.StorageRelocation, error)
+	DeleteStorageRelocation(ctx context.Context, id int64) error
+	IsFilePathInUse(ctx context.Context, arg database.IsFilePathInUseParams) (bool, error)
+}
+
+// Relocator works through one batch per job and queues the next while rows
+// remain, like the hash backfill.
+type Relocator struct {
+	queries   RelocateQueries
+	storage   storage.Storage
+	queue     Enqueuer
+	BatchSize int32
+}
+
+func NewRelocator(q RelocateQueries, s storage.Storage, queue Enqueuer) *Relocator {
+	return &Relocator{queries: q, storage: s, queue: queue, BatchSize: defaultRelocateBatch}
+}
+
+// Handle is the jobs.HandlerFunc for RelocateJobKind. Each row is deleted
+// once done, so a retried run picks up where the last one stopped.
+func (r *Relocator) Handle(ctx context.Context, _ database.Job) error {
+	rows, err := r.queries.ListStorageRelocations(ctx, r.BatchSize)
+	if err != nil {
+		return fmt.Errorf("listing relocations: %w", err)
+	}
+
+	for _, row := range rows {
+		if err := r.relocate(ctx, row); err != nil {
+			return fmt.Errorf("relocating %s: %w", row.OldPath, err)
+		}
+		if err := r.queries.DeleteStorageRelocation(ctx, row.ID); err != nil {
+			return fmt.Errorf("clearing relocation %d: %w", row.ID, err)
+		}
+	}
+
+	if len(rows) < int(r.BatchSize) {
+		return nil
+	}
+	if _, err := r.queue.Enqueue(ctx, RelocateJobKind, 0, struct{}{}); err != nil {
+		return fmt.Errorf("queueing next batch: %w", err)
+	}
+	return nil
+}
+
+// relocate copies rather than moves, since the entry that kept its name may
+// still be reading from the old path. The old copy goes once nothing does.
+func (r *Relocator) relocate(ctx context.Context, row database.StorageRelocation) error {
+	if row.IsDir {
+		return r.storage.CreateDirectory(row.UserID, row.NewPath)
+	}
+
+	if err := r.storage.CopyFile(row.UserID, row.OldPath, row.NewPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// Nothing to copy now won't be there on retry either
+			log.Printf("storage relocation: %s: %v", row.OldPath, err)
+			return nil
+		}
+		return err
+	}
+
+	inUse, err := r.queries.IsFilePathInUse(ctx, database.IsFilePathInUseParams{
+		UserID:   sql.NullInt32{Int32: row.UserID, Valid: true},
+		FilePath: row.OldPath,
+	})
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return nil
+	}
+	return r.storage.DeleteFile(row.UserID, row.OldPath)
+}
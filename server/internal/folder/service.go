@@ -3,6 +3,7 @@ package folder
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -12,6 +13,10 @@ import (
 	"github.com/google/uuid"
 )
 
+// ErrInvalidName is returned for folder names that aren't a single path
+// element, such as "." or "a/b".
+var ErrInvalidName = errors.New("invalid folder name")
+
 type Queries interface {
 	CreateFolder(ctx context.Context, arg database.CreateFolderParams) (database.Folder, error)
 	GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error)
@@ -20,24 +25,65 @@ type Queries interface {
 	ListFoldersRecursive(ctx context.Context, arg database.ListFoldersRecursiveParams) ([]database.ListFoldersRecursiveRow, error)
 	UpdateFolderMetadata(ctx context.Context, arg database.UpdateFolderMetadataParams) (int64, error)
 	UpdateFolderParent(ctx context.Context, arg database.UpdateFolderParentParams) (int64, error)
+	GetFolderByNameInParent(ctx context.Context, arg database.GetFolderByNameInParentParams) (database.Folder, error)
+	GetStorageUsage(ctx context.Context, id int32) (database.GetStorageUsageRow, error)
+	GetFolderPath(ctx context.Context, id uuid.UUID) (string, error)
+	IsFolderInSubtree(ctx context.Context, arg database.IsFolderInSubtreeParams) (bool, error)
 }
 
 type FileService interface {
 	ListFilesRecursive(ctx context.Context, folderID uuid.UUID, userID int32) ([]database.ListFilesRecursiveRow, error)
 	UpdateFilePath(ctx context.Context, fileID uuid.UUID, path string, userID int32) error
+	CopyFile(ctx context.Context, fileID uuid.UUID, destFolderID *uuid.UUID, userID int32, onConflict string) (database.File, error)
+}
+
+// MetadataCopier carries tags and properties over to a copy.
+type MetadataCopier interface {
+	CopyMetadata(ctx context.Context, kind string, srcID, dstID uuid.UUID) error
 }
 
+// Enqueuer hands work to the background job queue.
+type Enqueuer interface {
+	Enqueue(ctx context.Context, kind string, userID int32, payload any) (database.Job, error)
+}
+
+// FileDeleteHook runs for each file removed along with a deleted folder.
+type FileDeleteHook func(ctx context.Context, userID int32, fileID uuid.UUID)
+
 type Service struct {
-	queries     Queries
-	fileService FileService
-	storage     storage.Storage
+	queries         Queries
+	fileService     FileService
+	storage         storage.Storage
+	metadata        MetadataCopier
+	queue           Enqueuer
+	fileDeleteHooks []FileDeleteHook
 }
 
 func NewService(q Queries, fs FileService, s storage.Storage) *Service {
 	return &Service{queries: q, fileService: fs, storage: s}
 }
 
+func (s *Service) SetMetadataCopier(m MetadataCopier) {
+	s.metadata = m
+}
+
+// SetJobQueue enables running large copies in the background. Without a
+// queue every copy runs inline.
+func (s *Service) SetJobQueue(q Enqueuer) {
+	s.queue = q
+}
+
+// OnDeleteFile registers a hook for the files a folder deletion takes with
+// it, which the database removes by cascade without the file service.
+func (s *Service) OnDeleteFile(h FileDeleteHook) {
+	s.fileDeleteHooks = append(s.fileDeleteHooks, h)
+}
+
 func (s *Service) CreateFolder(ctx context.Context, userID int32, name string, parentID uuid.NullUUID) (database.Folder, error) {
+	if !storage.ValidName(name) {
+		return database.Folder{}, ErrInvalidName
+	}
+
 	// 1. Create DB record first
 	folder, err := s.queries.CreateFolder(ctx, database.CreateFolderParams{
 		UserID:   sql.NullInt32{Int32: userID, Valid: true},
@@ -108,27 +154,39 @@ func (s *Service) GetZippedFolderForDownload(ctx context.Context, folderID uuid.
 	return folderMeta, nil
 }
 
+// FolderPath returns the folder's storage path relative to the user's root.
+func (s *Service) FolderPath(ctx context.Context, folderID uuid.UUID) (string, error) {
+	return s.buildFolderPath(ctx, folderID)
+}
+
+// buildFolderPath resolves the whole chain of ancestors in one query.
 func (s *Service) buildFolderPath(ctx context.Context, folderID uuid.UUID) (string, error) {
-	folder, err := s.queries.GetFolderByID(ctx, folderID)
+	path, err := s.queries.GetFolderPath(ctx, folderID)
 	if err != nil {
-		return "", fmt.Errorf("fetching folder: %w", err)
+		return "", fmt.Errorf("fetching folder path: %w", err)
 	}
-
-	if folder.ParentID.Valid {
-		parentPath, err := s.buildFolderPath(ctx, folder.ParentID.UUID)
-		if err != nil {
-			return "", err
-		}
-		return filepath.Join(parentPath, folder.Name), nil
-	}
-
-	return folder.Name, nil
+	return filepath.FromSlash(path), nil
 }
 
 func (s *Service) DeleteFolder(ctx context.Context, folderID uuid.UUID, userID int32) error {
 	uID := sql.NullInt32{Int32: userID, Valid: true}
 
-	// 1. Delete folder row from DB first (cascades handle child folders/files)
+	// 1. Resolve the on-disk path while the row still exists
+	path, err := s.buildFolderPath(ctx, folderID)
+	if err != nil {
+		return fmt.Errorf("building folder path: %w", err)
+	}
+
+	// The cascade below won't say which files went with the folder
+	var files []database.ListFilesRecursiveRow
+	if len(s.fileDeleteHooks) > 0 {
+		files, err = s.fileService.ListFilesRecursive(ctx, folderID, userID)
+		if err != nil {
+			return fmt.Errorf("listing folder files: %w", err)
+		}
+	}
+
+	// 2. Delete folder row from DB (cascades handle child folders/files)
 	rows, err := s.queries.DeleteFolder(ctx, database.DeleteFolderParams{
 		ID:     folderID,
 		UserID: uID,
@@ -140,13 +198,13 @@ func (s *Service) DeleteFolder(ctx context.Context, folderID uuid.UUID, userID i
 		return fmt.Errorf("folder not found or already deleted")
 	}
 
-	// 2. Delete folder contents from storage
-	path, err := s.buildFolderPath(ctx, folderID)
-	if err != nil {
-		// storage may not exist, just log
-		return fmt.Errorf("building folder path after DB deletion: %w", err)
+	for _, f := range files {
+		for _, hook := range s.fileDeleteHooks {
+			hook(ctx, userID, f.FileID)
+		}
 	}
 
+	// 3. Delete folder contents from storage
 	if err := s.storage.DeleteDirectory(userID, path); err != nil {
 		// folder row already deleted, cannot rollback DB
 		return fmt.Errorf("folder deleted in DB but failed to delete from storage: %w", err)
@@ -270,10 +328,26 @@ func (s *Service) RenameFolder(ctx context.Context, folderID uuid.UUID, newName
 func (s *Service) MoveFolder(ctx context.Context, folderID uuid.UUID, newParentID uuid.NullUUID, userID int32) error {
 	uID := sql.NullInt32{Int32: userID, Valid: true}
 
-	// 1. Fetch current folder info
-	folder, err := s.queries.GetFolderByID(ctx, folderID)
+	// 1. Fetch current folder info; both ends must be the caller's, and the
+	// destination can't be inside the folder being moved
+	folder, err := s.ownedFolder(ctx, folderID, userID)
 	if err != nil {
-		return fmt.Errorf("fetching folder: %w", err)
+		return err
+	}
+	if newParentID.Valid {
+		if _, err := s.ownedFolder(ctx, newParentID.UUID, userID); err != nil {
+			return fmt.Errorf("destination: %w", err)
+		}
+		inside, err := s.queries.IsFolderInSubtree(ctx, database.IsFolderInSubtreeParams{
+			RootID:      folderID,
+			CandidateID: newParentID.UUID,
+		})
+		if err != nil {
+			return fmt.Errorf("checking destination: %w", err)
+		}
+		if inside {
+			return ErrInvalidDestination
+		}
 	}
 
 	oldPath, err := s.buildFolderPath(ctx, folderID)
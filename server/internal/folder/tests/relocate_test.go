@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/folder"
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockRelocateQueries struct {
+	mock.Mock
+}
+
+func (m *MockRelocateQueries) ListStorageRelocations(ctx context.Context, limit int32) ([]database.StorageRelocation, error) {
+	args := m.Called(ctx, limit)
+	return args.Get(0).([]database.StorageRelocation), args.Error(1)
+}
+
+func (m *MockRelocateQueries) DeleteStorageRelocation(ctx context.Context, id int64) error {
+	return m.Called(ctx, id).Error(0)
+}
+
+func (m *MockRelocateQueries) IsFilePathInUse(ctx context.Context, arg database.IsFilePathInUseParams) (bool, error) {
+	args := m.Called(ctx, arg)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockQueue struct {
+	mock.Mock
+}
+
+func (m *MockQueue) Enqueue(ctx context.Context, kind string, userID int32, payload any) (database.Job, error) {
+	args := m.Called(ctx, kind, userID, payload)
+	return args.Get(0).(database.Job), args.Error(1)
+}
+
+func readAll(t *testing.T, s storage.Storage, path string) string {
+	t.Helper()
+	r, err := s.ReadFile(1, path)
+	require.NoError(t, err)
+	defer r.Close()
+	body, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestRelocator_DeletingDuplicateKeepsOriginal(t *testing.T) {
+	s := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, s.SaveFile(1, "x.txt", strings.NewReader("kept")))
+	require.NoError(t, s.SaveFile(1, "dir/only-in-dup.txt", strings.NewReader("moved")))
+
+	q := new(MockRelocateQueries)
+	q.On("ListStorageRelocations", mock.Anything, int32(200)).Return([]database.StorageRelocation{
+		{ID: 1, UserID: 1, OldPath: "dir", NewPath: "dir (2)", IsDir: true},
+		{ID: 2, UserID: 1, OldPath: "x.txt", NewPath: "x (2).txt"},
+		{ID: 3, UserID: 1, OldPath: "dir/only-in-dup.txt", NewPath: "dir (2)/only-in-dup.txt"},
+	}, nil)
+	q.On("DeleteStorageRelocation", mock.Anything, mock.Anything).Return(nil)
+	q.On("IsFilePathInUse", mock.Anything, database.IsFilePathInUseParams{UserID: sql.NullInt32{Int32: 1, Valid: true}, FilePath: "x.txt"}).
+		Return(true, nil)
+	q.On("IsFilePathInUse", mock.Anything, database.IsFilePathInUseParams{UserID: sql.NullInt32{Int32: 1, Valid: true}, FilePath: "dir/only-in-dup.txt"}).
+		Return(false, nil)
+
+	err := folder.NewRelocator(q, s, new(MockQueue)).Handle(context.Background(), database.Job{})
+	require.NoError(t, err)
+	q.AssertNumberOfCalls(t, "DeleteStorageRelocation", 3)
+
+	// The duplicate is deleted the way the file service would
+	require.NoError(t, s.DeleteFile(1, "x (2).txt"))
+	assert.Equal(t, "kept", readAll(t, s, "x.txt"))
+
+	assert.Equal(t, "moved", readAll(t, s, "dir (2)/only-in-dup.txt"))
+	_, err = s.ReadFile(1, "dir/only-in-dup.txt")
+	assert.Error(t, err, "an old path nothing refers to is cleaned up")
+}
+
+func TestRelocator_MissingSourceIsSkipped(t *testing.T) {
+	s := storage.NewLocalStorage(t.TempDir())
+	q := new(MockRelocateQueries)
+	q.On("ListStorageRelocations", mock.Anything, int32(200)).Return([]database.StorageRelocation{
+		{ID: 1, UserID: 1, OldPath: "gone.txt", NewPath: "gone (2).txt"},
+	}, nil)
+	q.On("DeleteStorageRelocation", mock.Anything, int64(1)).Return(nil)
+
+	err := folder.NewRelocator(q, s, new(MockQueue)).Handle(context.Background(), database.Job{})
+
+	require.NoError(t, err)
+	q.AssertCalled(t, "DeleteStorageRelocation", mock.Anything, int64(1))
+}
@@ -0,0 +1,337 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/folder"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) CreateFolder(ctx context.Context, arg database.CreateFolderParams) (database.Folder, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func (m *MockQueries) GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func (m *MockQueries) ListFoldersByParent(ctx context.Context, arg database.ListFoldersByParentParams) ([]database.Folder, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.Folder), args.Error(1)
+}
+
+func (m *MockQueries) DeleteFolder(ctx context.Context, arg database.DeleteFolderParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) ListFoldersRecursive(ctx context.Context, arg database.ListFoldersRecursiveParams) ([]database.ListFoldersRecursiveRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ListFoldersRecursiveRow), args.Error(1)
+}
+
+func (m *MockQueries) UpdateFolderMetadata(ctx context.Context, arg database.UpdateFolderMetadataParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) UpdateFolderParent(ctx context.Context, arg database.UpdateFolderParentParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) GetFolderByNameInParent(ctx context.Context, arg database.GetFolderByNameInParentParams) (database.Folder, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func (m *MockQueries) GetStorageUsage(ctx context.Context, id int32) (database.GetStorageUsageRow, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.GetStorageUsageRow), args.Error(1)
+}
+
+func (m *MockQueries) GetFolderPath(ctx context.Context, id uuid.UUID) (string, error) {
+	args := m.Called(ctx, id)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockQueries) IsFolderInSubtree(ctx context.Context, arg database.IsFolderInSubtreeParams) (bool, error) {
+	args := m.Called(ctx, arg)
+	return args.Bool(0), args.Error(1)
+}
+
+type MockFileService struct {
+	mock.Mock
+}
+
+func (m *MockFileService) ListFilesRecursive(ctx context.Context, folderID uuid.UUID, userID int32) ([]database.ListFilesRecursiveRow, error) {
+	args := m.Called(ctx, folderID, userID)
+	return args.Get(0).([]database.ListFilesRecursiveRow), args.Error(1)
+}
+
+func (m *MockFileService) UpdateFilePath(ctx context.Context, fileID uuid.UUID, path string, userID int32) error {
+	return m.Called(ctx, fileID, path, userID).Error(0)
+}
+
+func (m *MockFileService) CopyFile(ctx context.Context, fileID uuid.UUID, destFolderID *uuid.UUID, userID int32, onConflict string) (database.File, error) {
+	args := m.Called(ctx, fileID, destFolderID, userID, onConflict)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+type MockStorage struct {
+	mock.Mock
+}
+
+func (m *MockStorage) SaveFile(userID int32, path string, content io.Reader) error {
+	return m.Called(userID, path, content).Error(0)
+}
+
+func (m *MockStorage) ReadFile(userID int32, path string) (io.ReadCloser, error) {
+	args := m.Called(userID, path)
+	reader, _ := args.Get(0).(io.ReadCloser)
+	return reader, args.Error(1)
+}
+
+func (m *MockStorage) DeleteFile(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) CreateDirectory(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) DeleteDirectory(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) MoveFile(userID int32, oldPath, newPath string) error {
+	return m.Called(userID, oldPath, newPath).Error(0)
+}
+
+func (m *MockStorage) CopyFile(userID int32, srcPath, dstPath string) error {
+	return m.Called(userID, srcPath, dstPath).Error(0)
+}
+
+func (m *MockStorage) MoveDirectory(userID int32, oldPath, newPath string) error {
+	return m.Called(userID, oldPath, newPath).Error(0)
+}
+
+func (m *MockStorage) ZipFolder(userID int32, folderPath string, w io.Writer) error {
+	return m.Called(userID, folderPath, w).Error(0)
+}
+
+func (m *MockStorage) ZipPaths(userID int32, paths []string, w io.Writer) error {
+	return m.Called(userID, paths, w).Error(0)
+}
+
+func (m *MockStorage) DeleteUserData(userID int32) error {
+	return m.Called(userID).Error(0)
+}
+
+var uID = sql.NullInt32{Int32: 1, Valid: true}
+
+func TestCreateFolder_InvalidName(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockStorage := new(MockStorage)
+	svc := folder.NewService(mockQueries, new(MockFileService), mockStorage)
+
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`} {
+		_, err := svc.CreateFolder(context.Background(), 1, name, uuid.NullUUID{})
+		assert.ErrorIs(t, err, folder.ErrInvalidName, name)
+	}
+	mockQueries.AssertNotCalled(t, "CreateFolder", mock.Anything, mock.Anything)
+	mockStorage.AssertNotCalled(t, "CreateDirectory", mock.Anything, mock.Anything)
+}
+
+func TestMoveFolder_IntoOwnSubtree(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockStorage := new(MockStorage)
+	svc := folder.NewService(mockQueries, new(MockFileService), mockStorage)
+	id, childID := uuid.New(), uuid.New()
+
+	mockQueries.On("GetFolderByID", mock.Anything, id).Return(database.Folder{ID: id, UserID: uID, Name: "a"}, nil)
+	mockQueries.On("GetFolderByID", mock.Anything, childID).Return(database.Folder{ID: childID, UserID: uID, Name: "b"}, nil)
+	mockQueries.On("IsFolderInSubtree", mock.Anything, database.IsFolderInSubtreeParams{RootID: id, CandidateID: childID}).
+		Return(true, nil)
+
+	err := svc.MoveFolder(context.Background(), id, uuid.NullUUID{UUID: childID, Valid: true}, 1)
+
+	assert.ErrorIs(t, err, folder.ErrInvalidDestination)
+	mockQueries.AssertNotCalled(t, "UpdateFolderParent", mock.Anything, mock.Anything)
+	mockStorage.AssertNotCalled(t, "MoveDirectory", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMoveFolder_UpdatesFilePaths(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockFiles := new(MockFileService)
+	mockStorage := new(MockStorage)
+	svc := folder.NewService(mockQueries, mockFiles, mockStorage)
+	id, destID, fileID := uuid.New(), uuid.New(), uuid.New()
+	dest := uuid.NullUUID{UUID: destID, Valid: true}
+
+	mockQueries.On("GetFolderByID", mock.Anything, id).Return(database.Folder{ID: id, UserID: uID, Name: "reports"}, nil)
+	mockQueries.On("GetFolderByID", mock.Anything, destID).Return(database.Folder{ID: destID, UserID: uID, Name: "archive"}, nil)
+	mockQueries.On("IsFolderInSubtree", mock.Anything, database.IsFolderInSubtreeParams{RootID: id, CandidateID: destID}).
+		Return(false, nil)
+	mockQueries.On("GetFolderPath", mock.Anything, id).Return("reports", nil).Once()
+	mockQueries.On("UpdateFolderParent", mock.Anything, database.UpdateFolderParentParams{ID: id, ParentID: dest, UserID: uID}).
+		Return(int64(1), nil)
+	mockQueries.On("GetFolderPath", mock.Anything, destID).Return("2024/archive", nil)
+	mockStorage.On("MoveDirectory", int32(1), "reports", "2024/archive/reports").Return(nil)
+	mockFiles.On("ListFilesRecursive", mock.Anything, id, int32(1)).
+		Return([]database.ListFilesRecursiveRow{{FileID: fileID, FilePath: "reports/q1/a.pdf"}}, nil)
+	mockFiles.On("UpdateFilePath", mock.Anything, fileID, "2024/archive/reports/q1/a.pdf", int32(1)).Return(nil)
+
+	err := svc.MoveFolder(context.Background(), id, dest, 1)
+
+	assert.NoError(t, err)
+	mockStorage.AssertExpectations(t)
+	mockFiles.AssertExpectations(t)
+}
+
+func TestCopyFolder_OverwriteRefusesAncestorOfSource(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockFiles := new(MockFileService)
+	mockStorage := new(MockStorage)
+	svc := folder.NewService(mockQueries, mockFiles, mockStorage)
+	// Copying /A/A to the root, where /A is in the way
+	outerID, innerID := uuid.New(), uuid.New()
+	inner := database.Folder{ID: innerID, UserID: uID, Name: "A", ParentID: uuid.NullUUID{UUID: outerID, Valid: true}}
+
+	mockQueries.On("GetFolderByID", mock.Anything, innerID).Return(inner, nil)
+	mockQueries.On("ListFoldersRecursive", mock.Anything, database.ListFoldersRecursiveParams{ID: innerID, UserID: uID}).
+		Return([]database.ListFoldersRecursiveRow{{ID: innerID, UserID: uID, Name: "A", ParentID: inner.ParentID}}, nil)
+	mockFiles.On("ListFilesRecursive", mock.Anything, innerID, int32(1)).Return([]database.ListFilesRecursiveRow{}, nil)
+	mockQueries.On("GetFolderByNameInParent", mock.Anything, database.GetFolderByNameInParentParams{UserID: uID, Name: "A"}).
+		Return(database.Folder{ID: outerID, UserID: uID, Name: "A"}, nil)
+	mockQueries.On("IsFolderInSubtree", mock.Anything, database.IsFolderInSubtreeParams{RootID: outerID, CandidateID: innerID}).
+		Return(true, nil)
+
+	_, err := svc.CopyFolder(context.Background(), innerID, uuid.NullUUID{}, 1, "overwrite")
+
+	assert.ErrorIs(t, err, folder.ErrInvalidDestination)
+	mockQueries.AssertNotCalled(t, "DeleteFolder", mock.Anything, mock.Anything)
+	mockQueries.AssertNotCalled(t, "CreateFolder", mock.Anything, mock.Anything)
+}
+
+func TestFolderPath_SingleQuery(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := folder.NewService(mockQueries, new(MockFileService), new(MockStorage))
+	id := uuid.New()
+
+	mockQueries.On("GetFolderPath", mock.Anything, id).Return("projects/2024/q1", nil)
+
+	path, err := svc.FolderPath(context.Background(), id)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "projects/2024/q1", path)
+	mockQueries.AssertNumberOfCalls(t, "GetFolderPath", 1)
+	mockQueries.AssertNotCalled(t, "GetFolderByID", mock.Anything, mock.Anything)
+}
+
+func TestListFoldersByParent_Root(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := folder.NewService(mockQueries, new(MockFileService), new(MockStorage))
+	root := []database.Folder{{ID: uuid.New(), UserID: uID, Name: "projects"}}
+
+	mockQueries.On("ListFoldersByParent", mock.Anything, database.ListFoldersByParentParams{ParentID: uuid.NullUUID{}, UserID: uID}).
+		Return(root, nil)
+
+	folders, err := svc.ListFoldersByParent(context.Background(), 1, uuid.NullUUID{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, root, folders)
+}
+
+func TestDeleteFolder_RunsFileDeleteHooks(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockFiles := new(MockFileService)
+	mockStorage := new(MockStorage)
+	svc := folder.NewService(mockQueries, mockFiles, mockStorage)
+	id, fileID := uuid.New(), uuid.New()
+
+	var deleted []uuid.UUID
+	svc.OnDeleteFile(func(ctx context.Context, userID int32, fileID uuid.UUID) {
+		deleted = append(deleted, fileID)
+	})
+
+	mockQueries.On("GetFolderPath", mock.Anything, id).Return("photos", nil)
+	mockFiles.On("ListFilesRecursive", mock.Anything, id, int32(1)).
+		Return([]database.ListFilesRecursiveRow{{FileID: fileID, FilePath: "photos/a.jpg"}}, nil)
+	mockQueries.On("DeleteFolder", mock.Anything, database.DeleteFolderParams{ID: id, UserID: uID}).Return(int64(1), nil)
+	mockStorage.On("DeleteDirectory", int32(1), "photos").Return(nil)
+
+	err := svc.DeleteFolder(context.Background(), id, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{fileID}, deleted)
+}
+
+func TestArchiveFolder_TreeFromDatabase(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockFiles := new(MockFileService)
+	mockStorage := new(MockStorage)
+	svc := folder.NewService(mockQueries, mockFiles, mockStorage)
+	id, emptyID, trashedID, fileID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	updated := sql.NullTime{Time: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Valid: true}
+	trashed := sql.NullTime{Time: time.Now(), Valid: true}
+
+	mockQueries.On("GetFolderByID", mock.Anything, id).Return(database.Folder{ID: id, UserID: uID, Name: "reports"}, nil)
+	mockQueries.On("ListFoldersRecursive", mock.Anything, database.ListFoldersRecursiveParams{ID: id, UserID: uID}).
+		Return([]database.ListFoldersRecursiveRow{
+			{ID: id, Name: "reports"},
+			{ID: emptyID, Name: "empty", ParentID: uuid.NullUUID{UUID: id, Valid: true}, UpdatedAt: updated},
+			{ID: trashedID, Name: "old", ParentID: uuid.NullUUID{UUID: id, Valid: true}, TrashedAt: trashed},
+		}, nil)
+	mockFiles.On("ListFilesRecursive", mock.Anything, id, int32(1)).
+		Return([]database.ListFilesRecursiveRow{{
+			FileID: fileID, FolderID: uuid.NullUUID{UUID: id, Valid: true}, Name: "a.txt", FilePath: "reports/a.txt",
+			SizeBytes: 5, UpdatedAt: updated, Sha256: sql.NullString{String: "abc", Valid: true},
+		}}, nil)
+	mockStorage.On("ReadFile", int32(1), "reports/a.txt").Return(io.NopCloser(strings.NewReader("hello")), nil)
+
+	src, entries, err := svc.ArchiveFolder(context.Background(), id, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, id, src.ID)
+	var paths []string
+	for _, e := range entries {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{"reports", "reports/empty", "reports/a.txt"}, paths)
+	assert.True(t, entries[1].IsDir)
+	assert.Equal(t, updated.Time, entries[2].ModTime)
+	assert.Equal(t, "abc", entries[2].SHA256)
+
+	body, err := entries[2].Open()
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestArchiveFolder_NotOwner(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := folder.NewService(mockQueries, new(MockFileService), new(MockStorage))
+	id := uuid.New()
+
+	mockQueries.On("GetFolderByID", mock.Anything, id).
+		Return(database.Folder{ID: id, UserID: sql.NullInt32{Int32: 2, Valid: true}, Name: "reports"}, nil)
+
+	_, _, err := svc.ArchiveFolder(context.Background(), id, 1)
+
+	assert.ErrorIs(t, err, folder.ErrNotFound)
+}
@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+)
+
+type QueueInterface interface {
+	GetUserJob(ctx context.Context, id uuid.UUID, userID int32) (database.Job, error)
+}
+
+type Progress struct {
+	Done  int64 `json:"done"`
+	Total int64 `json:"total"`
+}
+
+type JobResponse struct {
+	ID         uuid.UUID       `json:"id"`
+	Kind       string          `json:"kind"`
+	Status     string          `json:"status"`
+	Attempts   int32           `json:"attempts"`
+	Progress   Progress        `json:"progress"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	LastError  string          `json:"last_error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+func NewJobResponse(j database.Job) JobResponse {
+	res := JobResponse{
+		ID:        j.ID,
+		Kind:      j.Kind,
+		Status:    j.Status,
+		Attempts:  j.Attempts,
+		Progress:  Progress{Done: j.ProgressDone, Total: j.ProgressTotal},
+		LastError: j.LastError.String,
+		CreatedAt: j.CreatedAt,
+		UpdatedAt: j.UpdatedAt,
+	}
+	if j.Result.Valid {
+		res.Result = j.Result.RawMessage
+	}
+	if j.FinishedAt.Valid {
+		res.FinishedAt = &j.FinishedAt.Time
+	}
+	return res
+}
+
+// GetJobHandler lets a user poll one of their own jobs. Must be mounted
+// behind AuthMiddleware.
+func GetJobHandler(queue QueueInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid job ID")
+			return
+		}
+
+		job, err := queue.GetUserJob(r.Context(), id, userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				util.RespondWithError(w, http.StatusNotFound, "Job not found")
+				return
+			}
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, NewJobResponse(job))
+	}
+}
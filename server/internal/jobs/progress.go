@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+	"github.com/sqlc-dev/pqtype"
+)
+
+// progressInterval throttles progress writes so a job touching thousands of
+// items doesn't issue thousands of updates.
+const progressInterval = time.Second
+
+type reporterKey struct{}
+
+type reporter struct {
+	queries Queries
+	jobID   uuid.UUID
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func withReporter(ctx context.Context, q Queries, jobID uuid.UUID) context.Context {
+	return context.WithValue(ctx, reporterKey{}, &reporter{queries: q, jobID: jobID})
+}
+
+// ReportProgress records how far the running job has got. It is a no-op
+// outside a job, so code shared with synchronous callers can always call it.
+func ReportProgress(ctx context.Context, done, total int64) {
+	r, ok := ctx.Value(reporterKey{}).(*reporter)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if done < total && time.Since(r.last) < progressInterval {
+		return
+	}
+	r.last = time.Now()
+
+	if err := r.queries.UpdateJobProgress(ctx, database.UpdateJobProgressParams{
+		ID:            r.jobID,
+		ProgressDone:  done,
+		ProgressTotal: total,
+	}); err != nil {
+		log.Printf("jobs: recording progress for %s: %v", r.jobID, err)
+	}
+}
+
+// SetResult stores what the running job produced, e.g. the id of a new item,
+// for clients polling the job.
+func SetResult(ctx context.Context, v any) error {
+	r, ok := ctx.Value(reporterKey{}).(*reporter)
+	if !ok {
+		return nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding job result: %w", err)
+	}
+	if err := r.queries.SetJobResult(ctx, database.SetJobResultParams{
+		ID:     r.jobID,
+		Result: pqtype.NullRawMessage{RawMessage: raw, Valid: true},
+	}); err != nil {
+		return fmt.Errorf("storing job result: %w", err)
+	}
+	return nil
+}
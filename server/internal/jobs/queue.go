@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+const defaultMaxAttempts = 5
+
+type Queries interface {
+	EnqueueJob(ctx context.Context, arg database.EnqueueJobParams) (database.Job, error)
+	GetJob(ctx context.Context, id uuid.UUID) (database.Job, error)
+	ClaimDueJobs(ctx context.Context, arg database.ClaimDueJobsParams) ([]database.Job, error)
+	CompleteJob(ctx context.Context, id uuid.UUID) (int64, error)
+	RetryJob(ctx context.Context, arg database.RetryJobParams) (int64, error)
+	FailJob(ctx context.Context, arg database.FailJobParams) (int64, error)
+	GetUserJob(ctx context.Context, arg database.GetUserJobParams) (database.Job, error)
+	UpdateJobProgress(ctx context.Context, arg database.UpdateJobProgressParams) error
+	SetJobResult(ctx context.Context, arg database.SetJobResultParams) error
+}
+
+// Queue persists jobs for a Worker to pick up.
+type Queue struct {
+	queries Queries
+}
+
+func NewQueue(q Queries) *Queue {
+	return &Queue{queries: q}
+}
+
+// Enqueue stores a job of the given kind. payload is marshalled to JSON and
+// handed back to the handler unchanged. A zero userID means a system job.
+func (q *Queue) Enqueue(ctx context.Context, kind string, userID int32, payload any) (database.Job, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return database.Job{}, fmt.Errorf("encoding %s payload: %w", kind, err)
+	}
+
+	job, err := q.queries.EnqueueJob(ctx, database.EnqueueJobParams{
+		Kind:        kind,
+		UserID:      sql.NullInt32{Int32: userID, Valid: userID != 0},
+		Payload:     raw,
+		MaxAttempts: defaultMaxAttempts,
+	})
+	if err != nil {
+		return database.Job{}, fmt.Errorf("enqueueing %s job: %w", kind, err)
+	}
+	return job, nil
+}
+
+func (q *Queue) GetJob(ctx context.Context, id uuid.UUID) (database.Job, error) {
+	return q.queries.GetJob(ctx, id)
+}
+
+// GetUserJob fetches a job only if it was enqueued for the given user.
+func (q *Queue) GetUserJob(ctx context.Context, id uuid.UUID, userID int32) (database.Job, error) {
+	return q.queries.GetUserJob(ctx, database.GetUserJobParams{
+		ID:     id,
+		UserID: sql.NullInt32{Int32: userID, Valid: true},
+	})
+}
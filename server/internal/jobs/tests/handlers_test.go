@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/jobs"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueue struct {
+	mock.Mock
+}
+
+func (m *MockQueue) GetUserJob(ctx context.Context, id uuid.UUID, userID int32) (database.Job, error) {
+	args := m.Called(ctx, id, userID)
+	return args.Get(0).(database.Job), args.Error(1)
+}
+
+func getJob(queue jobs.QueueInterface, id string, userID int32) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.Handle("GET /jobs/{id}", jobs.GetJobHandler(queue))
+
+	req := httptest.NewRequest(http.MethodGet, "/jobs/"+id, nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), userID))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGetJobHandler_Success(t *testing.T) {
+	mockQueue := new(MockQueue)
+	id := uuid.New()
+	mockQueue.On("GetUserJob", mock.Anything, id, int32(1)).Return(database.Job{
+		ID:            id,
+		Kind:          "copy_folder",
+		Status:        "running",
+		ProgressDone:  3,
+		ProgressTotal: 10,
+	}, nil)
+
+	rec := getJob(mockQueue, id.String(), 1)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"progress":{"done":3,"total":10}`)
+	mockQueue.AssertExpectations(t)
+}
+
+func TestGetJobHandler_NotFound(t *testing.T) {
+	mockQueue := new(MockQueue)
+	id := uuid.New()
+	mockQueue.On("GetUserJob", mock.Anything, id, int32(1)).Return(database.Job{}, sql.ErrNoRows)
+
+	rec := getJob(mockQueue, id.String(), 1)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestGetJobHandler_InvalidID(t *testing.T) {
+	rec := getJob(new(MockQueue), "not-a-uuid", 1)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/jobs"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) EnqueueJob(ctx context.Context, arg database.EnqueueJobParams) (database.Job, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.Job), args.Error(1)
+}
+
+func (m *MockQueries) GetJob(ctx context.Context, id uuid.UUID) (database.Job, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.Job), args.Error(1)
+}
+
+func (m *MockQueries) ClaimDueJobs(ctx context.Context, arg database.ClaimDueJobsParams) ([]database.Job, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.Job), args.Error(1)
+}
+
+func (m *MockQueries) CompleteJob(ctx context.Context, id uuid.UUID) (int64, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) RetryJob(ctx context.Context, arg database.RetryJobParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) FailJob(ctx context.Context, arg database.FailJobParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) GetUserJob(ctx context.Context, arg database.GetUserJobParams) (database.Job, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.Job), args.Error(1)
+}
+
+func (m *MockQueries) UpdateJobProgress(ctx context.Context, arg database.UpdateJobProgressParams) error {
+	return m.Called(ctx, arg).Error(0)
+}
+
+func (m *MockQueries) SetJobResult(ctx context.Context, arg database.SetJobResultParams) error {
+	return m.Called(ctx, arg).Error(0)
+}
+
+func TestEnqueue_MarshalsPayload(t *testing.T) {
+	mockQ := new(MockQueries)
+	queue := jobs.NewQueue(mockQ)
+	ctx := context.Background()
+
+	mockQ.On("EnqueueJob", ctx, mock.MatchedBy(func(arg database.EnqueueJobParams) bool {
+		return arg.Kind == "test" && arg.UserID.Int32 == 3 && arg.UserID.Valid &&
+			string(arg.Payload) == `{"n":1}` && arg.MaxAttempts == 5
+	})).Return(database.Job{Kind: "test"}, nil)
+
+	_, err := queue.Enqueue(ctx, "test", 3, map[string]int{"n": 1})
+	assert.NoError(t, err)
+	mockQ.AssertExpectations(t)
+}
+
+func TestProcessBatch_CompletesJob(t *testing.T) {
+	mockQ := new(MockQueries)
+	worker := jobs.NewWorker(mockQ)
+	ctx := context.Background()
+	job := database.Job{ID: uuid.New(), Kind: "test", Attempts: 1, MaxAttempts: 5}
+
+	worker.Handle("test", func(ctx context.Context, j database.Job) error { return nil })
+	mockQ.On("ClaimDueJobs", ctx, mock.MatchedBy(func(arg database.ClaimDueJobsParams) bool {
+		return len(arg.Kinds) == 1 && arg.Kinds[0] == "test"
+	})).Return([]database.Job{job}, nil)
+	mockQ.On("CompleteJob", ctx, job.ID).Return(int64(1), nil)
+
+	done, err := worker.ProcessBatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, done)
+	mockQ.AssertExpectations(t)
+}
+
+func TestProcessBatch_RetriesWithBackoff(t *testing.T) {
+	mockQ := new(MockQueries)
+	worker := jobs.NewWorker(mockQ)
+	ctx := context.Background()
+	job := database.Job{ID: uuid.New(), Kind: "test", Attempts: 2, MaxAttempts: 5}
+
+	worker.Handle("test", func(ctx context.Context, j database.Job) error { return errors.New("temporary") })
+	mockQ.On("ClaimDueJobs", ctx, mock.Anything).Return([]database.Job{job}, nil)
+	mockQ.On("RetryJob", ctx, mock.MatchedBy(func(arg database.RetryJobParams) bool {
+		return arg.ID == job.ID && arg.DelaySeconds == 60 && arg.LastError.String == "temporary"
+	})).Return(int64(1), nil)
+
+	done, err := worker.ProcessBatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, done)
+	mockQ.AssertExpectations(t)
+	mockQ.AssertNotCalled(t, "FailJob", mock.Anything, mock.Anything)
+}
+
+func TestProcessBatch_PermanentErrorFails(t *testing.T) {
+	mockQ := new(MockQueries)
+	worker := jobs.NewWorker(mockQ)
+	ctx := context.Background()
+	job := database.Job{ID: uuid.New(), Kind: "test", Attempts: 1, MaxAttempts: 5}
+
+	worker.Handle("test", func(ctx context.Context, j database.Job) error {
+		return jobs.Permanent(errors.New("bad payload"))
+	})
+	mockQ.On("ClaimDueJobs", ctx, mock.Anything).Return([]database.Job{job}, nil)
+	mockQ.On("FailJob", ctx, mock.MatchedBy(func(arg database.FailJobParams) bool {
+		return arg.ID == job.ID && arg.LastError.String == "bad payload"
+	})).Return(int64(1), nil)
+
+	_, err := worker.ProcessBatch(ctx)
+	assert.NoError(t, err)
+	mockQ.AssertExpectations(t)
+	mockQ.AssertNotCalled(t, "RetryJob", mock.Anything, mock.Anything)
+}
+
+func TestProcessBatch_FailsAfterMaxAttempts(t *testing.T) {
+	mockQ := new(MockQueries)
+	worker := jobs.NewWorker(mockQ)
+	ctx := context.Background()
+	job := database.Job{ID: uuid.New(), Kind: "test", Attempts: 5, MaxAttempts: 5}
+
+	worker.Handle("test", func(ctx context.Context, j database.Job) error { return errors.New("still broken") })
+	mockQ.On("ClaimDueJobs", ctx, mock.Anything).Return([]database.Job{job}, nil)
+	mockQ.On("FailJob", ctx, mock.Anything).Return(int64(1), nil)
+
+	_, err := worker.ProcessBatch(ctx)
+	assert.NoError(t, err)
+	mockQ.AssertExpectations(t)
+}
+
+func TestProcessBatch_NoHandlersClaimsNothing(t *testing.T) {
+	mockQ := new(MockQueries)
+	worker := jobs.NewWorker(mockQ)
+
+	done, err := worker.ProcessBatch(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, done)
+	mockQ.AssertNotCalled(t, "ClaimDueJobs", mock.Anything, mock.Anything)
+}
+
+func TestProcessBatch_HandlerReportsProgressAndResult(t *testing.T) {
+	mockQ := new(MockQueries)
+	worker := jobs.NewWorker(mockQ)
+	ctx := context.Background()
+	job := database.Job{ID: uuid.New(), Kind: "test", Attempts: 1, MaxAttempts: 5}
+
+	worker.Handle("test", func(ctx context.Context, j database.Job) error {
+		jobs.ReportProgress(ctx, 1, 3)
+		jobs.ReportProgress(ctx, 2, 3) // throttled
+		jobs.ReportProgress(ctx, 3, 3) // the final update always goes out
+		return jobs.SetResult(ctx, map[string]string{"ok": "yes"})
+	})
+	mockQ.On("ClaimDueJobs", mock.Anything, mock.Anything).Return([]database.Job{job}, nil)
+	mockQ.On("UpdateJobProgress", mock.Anything, database.UpdateJobProgressParams{ID: job.ID, ProgressDone: 1, ProgressTotal: 3}).Return(nil)
+	mockQ.On("UpdateJobProgress", mock.Anything, database.UpdateJobProgressParams{ID: job.ID, ProgressDone: 3, ProgressTotal: 3}).Return(nil)
+	mockQ.On("SetJobResult", mock.Anything, mock.MatchedBy(func(arg database.SetJobResultParams) bool {
+		return arg.ID == job.ID && string(arg.Result.RawMessage) == `{"ok":"yes"}`
+	})).Return(nil)
+	mockQ.On("CompleteJob", mock.Anything, job.ID).Return(int64(1), nil)
+
+	done, err := worker.ProcessBatch(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, done)
+	mockQ.AssertExpectations(t)
+	mockQ.AssertNumberOfCalls(t, "UpdateJobProgress", 2)
+}
+
+func TestReportProgress_NoopOutsideJob(t *testing.T) {
+	jobs.ReportProgress(context.Background(), 1, 2)
+	assert.NoError(t, jobs.SetResult(context.Background(), "ignored"))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, jobs.Backoff(1))
+	assert.Equal(t, time.Minute, jobs.Backoff(2))
+	assert.Equal(t, 4*time.Minute, jobs.Backoff(4))
+	assert.Equal(t, time.Hour, jobs.Backoff(20))
+}
@@ -0,0 +1,151 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+)
+
+const (
+	defaultPollInterval = 2 * time.Second
+	defaultBatchSize    = 10
+	defaultLease        = 10 * time.Minute
+	baseBackoff         = 30 * time.Second
+	maxBackoff          = time.Hour
+)
+
+// HandlerFunc runs one job. Returning an error retries the job with backoff
+// unless the error is wrapped with Permanent.
+type HandlerFunc func(ctx context.Context, job database.Job) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying, e.g. a malformed payload.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type Worker struct {
+	queries      Queries
+	handlers     map[string]HandlerFunc
+	PollInterval time.Duration
+	BatchSize    int32
+	Lease        time.Duration
+}
+
+func NewWorker(q Queries) *Worker {
+	return &Worker{
+		queries:      q,
+		handlers:     map[string]HandlerFunc{},
+		PollInterval: defaultPollInterval,
+		BatchSize:    defaultBatchSize,
+		Lease:        defaultLease,
+	}
+}
+
+// Handle registers the handler for a job kind. Only registered kinds are
+// claimed, so several workers can split the kinds between them.
+func (w *Worker) Handle(kind string, h HandlerFunc) {
+	w.handlers[kind] = h
+}
+
+// Run polls until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.ProcessBatch(ctx); err != nil {
+			log.Printf("jobs: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessBatch runs one batch of due jobs and returns how many succeeded.
+func (w *Worker) ProcessBatch(ctx context.Context) (int, error) {
+	if len(w.handlers) == 0 {
+		return 0, nil
+	}
+
+	kinds := make([]string, 0, len(w.handlers))
+	for kind := range w.handlers {
+		kinds = append(kinds, kind)
+	}
+
+	jobs, err := w.queries.ClaimDueJobs(ctx, database.ClaimDueJobsParams{
+		Kinds:        kinds,
+		LeaseSeconds: w.Lease.Seconds(),
+		BatchSize:    w.BatchSize,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("claiming jobs: %w", err)
+	}
+
+	done := 0
+	for _, job := range jobs {
+		if w.run(ctx, job) {
+			done++
+		}
+	}
+	return done, nil
+}
+
+func (w *Worker) run(ctx context.Context, job database.Job) bool {
+	runErr := w.handlers[job.Kind](withReporter(ctx, w.queries, job.ID), job)
+	if runErr == nil {
+		if _, err := w.queries.CompleteJob(ctx, job.ID); err != nil {
+			log.Printf("jobs: marking %s done: %v", job.ID, err)
+		}
+		return true
+	}
+
+	lastErr := sql.NullString{String: runErr.Error(), Valid: true}
+	var permanent *permanentError
+	if errors.As(runErr, &permanent) || job.Attempts >= job.MaxAttempts {
+		log.Printf("jobs: %s %s failed after %d attempts: %v", job.Kind, job.ID, job.Attempts, runErr)
+		if _, err := w.queries.FailJob(ctx, database.FailJobParams{
+			ID:        job.ID,
+			LastError: lastErr,
+		}); err != nil {
+			log.Printf("jobs: marking %s failed: %v", job.ID, err)
+		}
+		return false
+	}
+
+	if _, err := w.queries.RetryJob(ctx, database.RetryJobParams{
+		ID:           job.ID,
+		DelaySeconds: Backoff(job.Attempts).Seconds(),
+		LastError:    lastErr,
+	}); err != nil {
+		log.Printf("jobs: rescheduling %s: %v", job.ID, err)
+	}
+	return false
+}
+
+// Backoff returns the delay before retrying after the given attempt:
+// 30s, 1m, 2m, ... capped at an hour.
+func Backoff(attempt int32) time.Duration {
+	if attempt < 1 {
+		return baseBackoff
+	}
+	if attempt > 12 {
+		return maxBackoff
+	}
+	return min(baseBackoff<<(attempt-1), maxBackoff)
+}
@@ -15,6 +15,11 @@ const userEmailKey contextKey = "user_email"
 
 type TokenVerifier func(tokenStr string) (jwt.MapClaims, error)
 
+// SessionChecker fails when an access token issued to userID under the given
+// token version should no longer be honoured, such as after the account was
+// disabled or its sessions revoked.
+type SessionChecker func(ctx context.Context, userID int32, version int32) error
+
 func GetUserIDKey() interface{} {
 	return userIDKey
 }
@@ -23,7 +28,7 @@ func GetUserEmailKey() interface{} {
 	return userEmailKey
 }
 
-func AuthMiddleware(verify TokenVerifier) func(http.Handler) http.Handler {
+func AuthMiddleware(verify TokenVerifier, check SessionChecker) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -52,6 +57,16 @@ func AuthMiddleware(verify TokenVerifier) func(http.Handler) http.Handler {
 				return
 			}
 
+			version, ok := claims["ver"].(float64)
+			if !ok {
+				http.Error(w, "Invalid token payload", http.StatusUnauthorized)
+				return
+			}
+			if err := check(r.Context(), int32(userID), int32(version)); err != nil {
+				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+
 			ctx := context.WithValue(r.Context(), userIDKey, int32(userID))
 			ctx = context.WithValue(ctx, userEmailKey, email)
 
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// BasicVerifier checks a user name and password, returning who they belong to.
+type BasicVerifier func(ctx context.Context, username, password string) (userID int32, email string, err error)
+
+// BasicAuthMiddleware is AuthMiddleware for clients that can't hold a JWT,
+// such as WebDAV mounts. It sets the same context values, so handlers can't
+// tell the two apart.
+func BasicAuthMiddleware(realm string, verify BasicVerifier) func(http.Handler) http.Handler {
+	challenge := "Basic realm=" + strconv.Quote(realm) + `, charset="UTF-8"`
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := r.BasicAuth()
+			if !ok {
+				w.Header().Set("WWW-Authenticate", challenge)
+				http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
+				return
+			}
+
+			userID, email, err := verify(r.Context(), username, password)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", challenge)
+				http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userIDKey, userID)
+			ctx = context.WithValue(ctx, userEmailKey, email)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+)
+
+type RoleResolver func(ctx context.Context, userID int32) (string, error)
+
+// RequireRole must run after AuthMiddleware. The role is looked up on every
+// request rather than read from the token so demotions take effect at once.
+func RequireRole(resolve RoleResolver, roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value(userIDKey).(int32)
+			if !ok {
+				http.Error(w, "Missing authenticated user", http.StatusUnauthorized)
+				return
+			}
+
+			role, err := resolve(r.Context(), userID)
+			if err != nil || !slices.Contains(roles, role) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// TicketRedeemer uses up a one-time stream ticket, returning the ID and
+// email of the user it was issued to.
+type TicketRedeemer func(ctx context.Context, ticket string) (int32, string, error)
+
+// StreamAuthMiddleware is AuthMiddleware for event streams. Browsers can't
+// set headers on EventSource or WebSocket connections, so those open the
+// stream with a one-time ticket in the ticket query parameter instead. The
+// access token itself is never taken from the URL.
+func StreamAuthMiddleware(verify TokenVerifier, check SessionChecker, redeem TicketRedeemer) func(http.Handler) http.Handler {
+	auth := AuthMiddleware(verify, check)
+	return func(next http.Handler) http.Handler {
+		h := auth(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ticket := r.URL.Query().Get("ticket")
+			if r.Header.Get("Authorization") != "" || ticket == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			userID, email, err := redeem(r.Context(), ticket)
+			if err != nil {
+				http.Error(w, "Invalid or expired ticket", http.StatusUnauthorized)
+				return
+			}
+			ctx := context.WithValue(r.Context(), userIDKey, userID)
+			ctx = context.WithValue(ctx, userEmailKey, email)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
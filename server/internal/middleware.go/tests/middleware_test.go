@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,15 +12,21 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// anySession accepts every session
+func anySession(context.Context, int32, int32) error {
+	return nil
+}
+
 func TestAuthMiddleware_Success(t *testing.T) {
 	mockVerifier := func(tokenStr string) (jwt.MapClaims, error) {
 		return jwt.MapClaims{
 			"user_id": float64(123), // JWT stores numbers as float64
 			"email":   "test@example.com",
+			"ver":     float64(0),
 		}, nil
 	}
 
-	mdlware := middleware.AuthMiddleware(mockVerifier)
+	mdlware := middleware.AuthMiddleware(mockVerifier, anySession)
 
 	// Dummy handler to verify context values
 	handler := mdlware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -43,7 +51,7 @@ func TestAuthMiddleware_Success(t *testing.T) {
 func TestAuthMiddleware_MissingAuthorizationHeader(t *testing.T) {
 	mdlware := middleware.AuthMiddleware(func(string) (jwt.MapClaims, error) {
 		return nil, nil // Won't be called
-	})
+	}, anySession)
 
 	handler := mdlware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		t.Fatal("Handler should not be called")
@@ -61,7 +69,7 @@ func TestAuthMiddleware_MissingAuthorizationHeader(t *testing.T) {
 func TestAuthMiddleware_InvalidToken(t *testing.T) {
 	mdlware := middleware.AuthMiddleware(func(token string) (jwt.MapClaims, error) {
 		return nil, jwt.ErrTokenMalformed
-	})
+	}, anySession)
 
 	handler := mdlware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		t.Fatal("Handler should not be called")
@@ -83,7 +91,7 @@ func TestAuthMiddleware_InvalidPayload(t *testing.T) {
 			"user_id": "not-a-number",
 			"email":   123,
 		}, nil
-	})
+	}, anySession)
 
 	handler := mdlware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		t.Fatal("Handler should not be called")
@@ -98,3 +106,178 @@ func TestAuthMiddleware_InvalidPayload(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 	assert.Contains(t, rec.Body.String(), "Invalid token payload")
 }
+
+func TestAuthMiddleware_RevokedSession(t *testing.T) {
+	verify := func(string) (jwt.MapClaims, error) {
+		return jwt.MapClaims{"user_id": float64(123), "email": "test@example.com", "ver": float64(2)}, nil
+	}
+	check := func(ctx context.Context, userID int32, version int32) error {
+		assert.Equal(t, int32(123), userID)
+		assert.Equal(t, int32(2), version)
+		return errors.New("account is disabled")
+	}
+
+	handler := middleware.AuthMiddleware(verify, check)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Handler should not be called")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer sometoken")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestRequireRole_Allowed(t *testing.T) {
+	resolve := func(ctx context.Context, userID int32) (string, error) {
+		assert.Equal(t, int32(123), userID)
+		return "admin", nil
+	}
+
+	handler := middleware.RequireRole(resolve, "admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(123)))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestRequireRole_WrongRole(t *testing.T) {
+	resolve := func(ctx context.Context, userID int32) (string, error) {
+		return "user", nil
+	}
+
+	handler := middleware.RequireRole(resolve, "admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Handler should not be called")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(123)))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestRequireRole_ResolverError(t *testing.T) {
+	resolve := func(ctx context.Context, userID int32) (string, error) {
+		return "", errors.New("account is disabled")
+	}
+
+	handler := middleware.RequireRole(resolve, "admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Handler should not be called")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(123)))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestRequireRole_Unauthenticated(t *testing.T) {
+	handler := middleware.RequireRole(func(context.Context, int32) (string, error) {
+		return "admin", nil
+	}, "admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Handler should not be called")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestBasicAuthMiddleware_Success(t *testing.T) {
+	verify := func(ctx context.Context, username, password string) (int32, string, error) {
+		if username == "test@example.com" && password == "secret" {
+			return 7, username, nil
+		}
+		return 0, "", errors.New("bad credentials")
+	}
+
+	handler := middleware.BasicAuthMiddleware("files", verify)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, int32(7), r.Context().Value(middleware.GetUserIDKey()))
+		assert.Equal(t, "test@example.com", r.Context().Value(middleware.GetUserEmailKey()))
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("test@example.com", "secret")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestBasicAuthMiddleware_Challenge(t *testing.T) {
+	verify := func(ctx context.Context, username, password string) (int32, string, error) {
+		return 0, "", errors.New("bad credentials")
+	}
+	handler := middleware.BasicAuthMiddleware("files", verify)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not run")
+	}))
+
+	for _, withCredentials := range []bool{false, true} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if withCredentials {
+			req.SetBasicAuth("test@example.com", "wrong")
+		}
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, `Basic realm="files", charset="UTF-8"`, rec.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestStreamAuthMiddleware_Ticket(t *testing.T) {
+	verify := func(tokenStr string) (jwt.MapClaims, error) {
+		if tokenStr != "streamtoken" {
+			return nil, errors.New("invalid token")
+		}
+		return jwt.MapClaims{"user_id": float64(9), "email": "test@example.com", "ver": float64(0)}, nil
+	}
+	redeem := func(ctx context.Context, ticket string) (int32, string, error) {
+		if ticket != "ticket" {
+			return 0, "", errors.New("invalid ticket")
+		}
+		return 9, "test@example.com", nil
+	}
+	handler := middleware.StreamAuthMiddleware(verify, anySession, redeem)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, int32(9), r.Context().Value(middleware.GetUserIDKey()))
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(target string, header string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/events?ticket=ticket", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve("/events?ticket=other", ""))
+	// The header still works, and wins over a ticket
+	assert.Equal(t, http.StatusOK, serve("/events?ticket=other", "Bearer streamtoken"))
+	// Access tokens are never read from the URL
+	assert.Equal(t, http.StatusUnauthorized, serve("/events?access_token=streamtoken", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve("/events", ""))
+}
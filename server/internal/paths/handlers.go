@@ -0,0 +1,168 @@
+package paths
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/bellezhang119/cloud-storage/internal/content"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+)
+
+// All handlers here take the path in the "path" query parameter and must be
+// mounted behind AuthMiddleware.
+
+type ServiceInterface interface {
+	Resolve(ctx context.Context, userID int32, p string) (Entry, error)
+	List(ctx context.Context, userID int32, p string) (Entry, []Entry, error)
+	Upload(ctx context.Context, userID int32, p string, sizeBytes int64, content io.Reader) (Entry, error)
+	Download(ctx context.Context, userID int32, p string) (database.File, io.ReadCloser, error)
+}
+
+type ResolveResponse struct {
+	Kind string     `json:"kind"`
+	ID   *uuid.UUID `json:"id"`
+	Path string     `json:"path"`
+}
+
+type ListResponse struct {
+	Folder Entry   `json:"folder"`
+	Items  []Entry `json:"items"`
+}
+
+func respondWithServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		util.RespondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrInvalidPath):
+		util.RespondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrNotAFolder), errors.Is(err, ErrNotAFile):
+		util.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, quota.ErrExceeded):
+		util.RespondWithError(w, http.StatusInsufficientStorage, err.Error())
+	default:
+		util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// ResolveHandler maps a path to the ID of what it names.
+func ResolveHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		entry, err := service.Resolve(r.Context(), userID, r.URL.Query().Get("path"))
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, ResolveResponse{Kind: entry.Kind, ID: entry.ID, Path: entry.Path})
+	}
+}
+
+// StatHandler returns the metadata of a file or folder by path.
+func StatHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		entry, err := service.Resolve(r.Context(), userID, r.URL.Query().Get("path"))
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, entry)
+	}
+}
+
+// ListHandler lists a folder by path; an empty path is the root.
+func ListHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		folder, items, err := service.List(r.Context(), userID, r.URL.Query().Get("path"))
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, ListResponse{Folder: folder, Items: items})
+	}
+}
+
+// UploadHandler stores the raw request body at the path, creating missing
+// folders on the way.
+func UploadHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		// The size is recorded before the content is stored
+		if r.ContentLength < 0 {
+			util.RespondWithError(w, http.StatusLengthRequired, "Content-Length is required")
+			return
+		}
+
+		// Content-Type is ignored; the stored type is sniffed from the body
+		entry, err := service.Upload(r.Context(), userID, r.URL.Query().Get("path"), r.ContentLength, r.Body)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusCreated, entry)
+	}
+}
+
+// DownloadHandler streams the file at the path, inline for safe types when
+// asked with ?disposition=inline.
+func DownloadHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		disposition, ok := content.ParseDisposition(r.URL.Query().Get("disposition"))
+		if !ok {
+			util.RespondWithError(w, http.StatusBadRequest, "disposition must be inline or attachment")
+			return
+		}
+
+		fileMeta, reader, err := service.Download(r.Context(), userID, r.URL.Query().Get("path"))
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		defer reader.Close()
+
+		content.SetHeaders(w.Header(), fileMeta.Name, fileMeta.MimeType.String, fileMeta.SizeBytes, disposition)
+		w.WriteHeader(http.StatusOK)
+
+		if _, err := io.Copy(w, reader); err != nil {
+			log.Printf("streaming file %s: %v", fileMeta.ID, err)
+		}
+	}
+}
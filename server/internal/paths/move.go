@@ -0,0 +1,89 @@
+package paths
+
+import (
+	"context"
+	"path"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+// Resolver looks paths up; Service is one.
+type Resolver interface {
+	Resolve(ctx context.Context, userID int32, p string) (Entry, error)
+}
+
+// FileMover and FolderMover are the file and folder service operations
+// Rename is built from.
+type FileMover interface {
+	GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error)
+	MoveFile(ctx context.Context, file database.File, destFolderID *uuid.UUID, userID int32) error
+	RenameFile(ctx context.Context, file database.File, newName string, userID int32) error
+}
+
+type FolderMover interface {
+	MoveFolder(ctx context.Context, folderID uuid.UUID, newParentID uuid.NullUUID, userID int32) error
+	RenameFolder(ctx context.Context, folderID uuid.UUID, newName string, userID int32) error
+}
+
+// NullID turns an entry's optional ID into a parent ID, the root being NULL.
+func NullID(id *uuid.UUID) uuid.NullUUID {
+	if id == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: *id, Valid: true}
+}
+
+// Rename moves src into the folder dest under the name base, moving and
+// renaming in whichever order avoids clashing with a sibling that shares the
+// old name. It is what file-system style front ends (WebDAV, SFTP) build
+// their rename on.
+func Rename(ctx context.Context, r Resolver, files FileMover, folders FolderMover, userID int32, src, dest Entry, base string) error {
+	moving := NullID(src.ParentID) != NullID(dest.ID)
+	renaming := src.Name != base
+	renameFirst := false
+	if moving && renaming {
+		_, err := r.Resolve(ctx, userID, path.Join(dest.Path, src.Name))
+		renameFirst = err == nil
+	}
+
+	var move, rename func() error
+	if src.Kind == KindFolder {
+		move = func() error { return folders.MoveFolder(ctx, *src.ID, NullID(dest.ID), userID) }
+		rename = func() error { return folders.RenameFolder(ctx, *src.ID, base, userID) }
+	} else {
+		// Each step changes the stored path, so the record is read afresh
+		move = func() error {
+			f, err := files.GetFileByID(ctx, *src.ID)
+			if err != nil {
+				return err
+			}
+			return files.MoveFile(ctx, f, dest.ID, userID)
+		}
+		rename = func() error {
+			f, err := files.GetFileByID(ctx, *src.ID)
+			if err != nil {
+				return err
+			}
+			return files.RenameFile(ctx, f, base, userID)
+		}
+	}
+
+	steps := []func() error{}
+	if moving {
+		steps = append(steps, move)
+	}
+	if renaming {
+		if renameFirst {
+			steps = append([]func() error{rename}, steps...)
+		} else {
+			steps = append(steps, rename)
+		}
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
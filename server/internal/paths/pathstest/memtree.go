@@ -0,0 +1,268 @@
+// Package pathstest provides an in-memory tree for testing the front ends
+// built on the path, file and folder services.
+package pathstest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+	"github.com/google/uuid"
+)
+
+// MemTree is an in-memory stand-in for the path, file and folder services
+// and the quota query, so suites can run whole WebDAV or SFTP conversations
+// against a tree that behaves like the real one.
+type MemTree struct {
+	mu    sync.Mutex
+	nodes map[uuid.UUID]*node
+	quota int64
+}
+
+type node struct {
+	id       uuid.UUID
+	parentID uuid.NullUUID
+	name     string
+	isDir    bool
+	body     string
+	mime     string
+	updated  time.Time
+}
+
+var errNameTaken = errors.New("name already exists")
+
+// NewMemTree returns an empty tree whose owner may store quota bytes.
+func NewMemTree(quota int64) *MemTree {
+	return &MemTree{nodes: map[uuid.UUID]*node{}, quota: quota}
+}
+
+func (t *MemTree) child(parent uuid.NullUUID, name string) *node {
+	for _, n := range t.nodes {
+		if n.parentID == parent && n.name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+func (t *MemTree) pathOf(n *node) string {
+	segments := []string{n.name}
+	for p := n.parentID; p.Valid; p = t.nodes[p.UUID].parentID {
+		segments = append([]string{t.nodes[p.UUID].name}, segments...)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func (t *MemTree) entry(n *node) paths.Entry {
+	id := n.id
+	e := paths.Entry{ID: &id, Name: n.name, Path: t.pathOf(n), UpdatedAt: &n.updated}
+	if n.parentID.Valid {
+		parent := n.parentID.UUID
+		e.ParentID = &parent
+	}
+	if n.isDir {
+		e.Kind = paths.KindFolder
+		return e
+	}
+	size := int64(len(n.body))
+	e.Kind, e.SizeBytes, e.MimeType = paths.KindFile, &size, n.mime
+	return e
+}
+
+func (t *MemTree) lookup(p string) (*node, bool, error) {
+	segments, err := paths.Split(p)
+	if err != nil {
+		return nil, false, err
+	}
+	var parent uuid.NullUUID
+	var n *node
+	for _, s := range segments {
+		if n != nil && !n.isDir {
+			return nil, false, paths.ErrNotFound
+		}
+		if n = t.child(parent, s); n == nil {
+			return nil, false, paths.ErrNotFound
+		}
+		parent = uuid.NullUUID{UUID: n.id, Valid: true}
+	}
+	return n, n == nil, nil
+}
+
+// Lookup returns the body stored at p, for checking what a request left behind.
+func (t *MemTree) Lookup(p string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, isRoot, err := t.lookup(p)
+	if err != nil || isRoot || n.isDir {
+		return "", false
+	}
+	return n.body, true
+}
+
+func (t *MemTree) Resolve(ctx context.Context, userID int32, p string) (paths.Entry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, isRoot, err := t.lookup(p)
+	if err != nil {
+		return paths.Entry{}, err
+	}
+	if isRoot {
+		return paths.Entry{Kind: paths.KindFolder, Path: "/"}, nil
+	}
+	return t.entry(n), nil
+}
+
+func (t *MemTree) List(ctx context.Context, userID int32, p string) (paths.Entry, []paths.Entry, error) {
+	dir, err := t.Resolve(ctx, userID, p)
+	if err != nil {
+		return paths.Entry{}, nil, err
+	}
+	if dir.Kind != paths.KindFolder {
+		return paths.Entry{}, nil, paths.ErrNotAFolder
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var entries []paths.Entry
+	for _, n := range t.nodes {
+		if n.parentID == paths.NullID(dir.ID) {
+			entries = append(entries, t.entry(n))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return dir, entries, nil
+}
+
+func (t *MemTree) Upload(ctx context.Context, userID int32, p string, sizeBytes int64, content io.Reader) (paths.Entry, error) {
+	body, err := io.ReadAll(content)
+	if err != nil {
+		return paths.Entry{}, err
+	}
+	dir, name := path.Split(path.Clean(p))
+	parent, err := t.Resolve(ctx, userID, dir)
+	if err != nil {
+		return paths.Entry{}, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.child(paths.NullID(parent.ID), name)
+	if n == nil {
+		n = &node{id: uuid.New(), parentID: paths.NullID(parent.ID), name: name}
+		t.nodes[n.id] = n
+	}
+	if n.isDir {
+		return paths.Entry{}, paths.ErrNotAFile
+	}
+	n.body, n.mime, n.updated = string(body), "text/plain; charset=utf-8", time.Now()
+	return t.entry(n), nil
+}
+
+func (t *MemTree) file(n *node) database.File {
+	return database.File{ID: n.id, FolderID: n.parentID, Name: n.name, SizeBytes: int64(len(n.body))}
+}
+
+func (t *MemTree) GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, ok := t.nodes[id]
+	if !ok || n.isDir {
+		return database.File{}, sql.ErrNoRows
+	}
+	return t.file(n), nil
+}
+
+func (t *MemTree) GetFileForDownload(ctx context.Context, fileID uuid.UUID, userID int32) (database.File, io.ReadCloser, error) {
+	f, err := t.GetFileByID(ctx, fileID)
+	if err != nil {
+		return database.File{}, nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return f, io.NopCloser(strings.NewReader(t.nodes[fileID].body)), nil
+}
+
+// remove drops a node and everything under it.
+func (t *MemTree) remove(id uuid.UUID) {
+	for _, n := range t.nodes {
+		if n.parentID == (uuid.NullUUID{UUID: id, Valid: true}) {
+			t.remove(n.id)
+		}
+	}
+	delete(t.nodes, id)
+}
+
+func (t *MemTree) DeleteFile(ctx context.Context, fileID uuid.UUID, userID int32) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remove(fileID)
+	return nil
+}
+
+func (t *MemTree) place(id uuid.UUID, parent uuid.NullUUID, name string) error {
+	if other := t.child(parent, name); other != nil && other.id != id {
+		return errNameTaken
+	}
+	t.nodes[id].parentID, t.nodes[id].name = parent, name
+	return nil
+}
+
+func (t *MemTree) MoveFile(ctx context.Context, file database.File, destFolderID *uuid.UUID, userID int32) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.place(file.ID, paths.NullID(destFolderID), file.Name)
+}
+
+func (t *MemTree) RenameFile(ctx context.Context, file database.File, newName string, userID int32) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.place(file.ID, file.FolderID, newName)
+}
+
+func (t *MemTree) CreateFolder(ctx context.Context, userID int32, name string, parentID uuid.NullUUID) (database.Folder, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.child(parentID, name) != nil {
+		return database.Folder{}, errNameTaken
+	}
+	n := &node{id: uuid.New(), parentID: parentID, name: name, isDir: true, updated: time.Now()}
+	t.nodes[n.id] = n
+	return database.Folder{ID: n.id, Name: name, ParentID: parentID}, nil
+}
+
+func (t *MemTree) DeleteFolder(ctx context.Context, folderID uuid.UUID, userID int32) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remove(folderID)
+	return nil
+}
+
+func (t *MemTree) MoveFolder(ctx context.Context, folderID uuid.UUID, newParentID uuid.NullUUID, userID int32) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.place(folderID, newParentID, t.nodes[folderID].name)
+}
+
+func (t *MemTree) RenameFolder(ctx context.Context, folderID uuid.UUID, newName string, userID int32) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.place(folderID, t.nodes[folderID].parentID, newName)
+}
+
+func (t *MemTree) GetStorageUsage(ctx context.Context, id int32) (database.GetStorageUsageRow, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var used int64
+	for _, n := range t.nodes {
+		used += int64(len(n.body))
+	}
+	return database.GetStorageUsageRow{StorageQuota: t.quota, UsedBytes: used}, nil
+}
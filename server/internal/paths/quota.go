@@ -0,0 +1,45 @@
+package paths
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+)
+
+// replacedSize is the size of the file an upload to p would replace, if any.
+func replacedSize(ctx context.Context, r Resolver, userID int32, p string) (int64, error) {
+	existing, err := r.Resolve(ctx, userID, p)
+	switch {
+	case err == nil && existing.SizeBytes != nil:
+		return *existing.SizeBytes, nil
+	case err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrInvalidPath):
+		return 0, err
+	}
+	return 0, nil
+}
+
+// CheckUpload fails with quota.ErrExceeded when storing sizeBytes at p would
+// take the user past their quota, allowing for the file it replaces.
+func CheckUpload(ctx context.Context, r Resolver, q quota.Queries, userID int32, p string, sizeBytes int64) error {
+	freed, err := replacedSize(ctx, r, userID, p)
+	if err != nil {
+		return err
+	}
+	return quota.Check(ctx, q, userID, sizeBytes-freed)
+}
+
+// UploadRoom is how many bytes may be stored at p: what is left of the quota
+// plus the file being replaced. Front ends that can't know an upload's size
+// up front stop reading once it passes this.
+func UploadRoom(ctx context.Context, r Resolver, q quota.Queries, userID int32, p string) (int64, error) {
+	room, err := quota.Room(ctx, q, userID)
+	if err != nil {
+		return 0, err
+	}
+	freed, err := replacedSize(ctx, r, userID, p)
+	if err != nil {
+		return 0, err
+	}
+	return room + freed, nil
+}
@@ -0,0 +1,296 @@
+package paths
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/google/uuid"
+)
+
+const (
+	KindFile   = "file"
+	KindFolder = "folder"
+)
+
+// MaxDepth bounds how many segments a path may have.
+const MaxDepth = 256
+
+var (
+	ErrNotFound    = errors.New("path not found")
+	ErrInvalidPath = errors.New("invalid path")
+	ErrNotAFolder  = errors.New("path is a file, not a folder")
+	ErrNotAFile    = errors.New("path is a folder, not a file")
+)
+
+type Queries interface {
+	ResolvePath(ctx context.Context, arg database.ResolvePathParams) ([]database.ResolvePathRow, error)
+	GetStorageUsage(ctx context.Context, id int32) (database.GetStorageUsageRow, error)
+}
+
+type FolderService interface {
+	CreateFolder(ctx context.Context, userID int32, name string, parentID uuid.NullUUID) (database.Folder, error)
+	ListFoldersByParent(ctx context.Context, userID int32, parentID uuid.NullUUID) ([]database.Folder, error)
+}
+
+type FileService interface {
+	SaveFile(ctx context.Context, folderID *uuid.UUID, userID int32, name string, sizeBytes int64, content io.Reader) (database.File, error)
+	ListFilesInFolder(ctx context.Context, folderID *uuid.UUID, userID int32) ([]database.File, error)
+	GetFileForDownload(ctx context.Context, fileID uuid.UUID, userID int32) (database.File, io.ReadCloser, error)
+}
+
+// Entry is a file or folder addressed by path. The root is a folder without
+// an ID.
+type Entry struct {
+	Kind      string     `json:"kind"`
+	ID        *uuid.UUID `json:"id"`
+	ParentID  *uuid.UUID `json:"parent_id"`
+	Name      string     `json:"name"`
+	Path      string     `json:"path"`
+	SizeBytes *int64     `json:"size_bytes,omitempty"`
+	MimeType  string     `json:"mime_type,omitempty"`
+	SHA256    string     `json:"sha256,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+var root = Entry{Kind: KindFolder, Name: "", Path: "/"}
+
+// Split cleans a slash-separated path and returns its segments; the root is
+// no segments at all. A leading slash is optional.
+func Split(p string) ([]string, error) {
+	cleaned := path.Clean("/" + p)
+	if cleaned == "/" {
+		return nil, nil
+	}
+	segments := strings.Split(cleaned[1:], "/")
+	if len(segments) > MaxDepth {
+		return nil, fmt.Errorf("%w: more than %d levels", ErrInvalidPath, MaxDepth)
+	}
+	return segments, nil
+}
+
+func join(segments []string) string {
+	return "/" + strings.Join(segments, "/")
+}
+
+func optionalID(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+func optionalTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func rowEntry(row database.ResolvePathRow, p string) Entry {
+	e := Entry{
+		Kind:      row.Kind,
+		ID:        &row.ID,
+		ParentID:  optionalID(row.ParentID),
+		Name:      row.Name,
+		Path:      p,
+		MimeType:  row.MimeType.String,
+		CreatedAt: optionalTime(row.CreatedAt),
+		UpdatedAt: optionalTime(row.UpdatedAt),
+	}
+	if row.SizeBytes.Valid {
+		e.SizeBytes = &row.SizeBytes.Int64
+	}
+	return e
+}
+
+func folderEntry(f database.Folder, p string) Entry {
+	return Entry{
+		Kind:      KindFolder,
+		ID:        &f.ID,
+		ParentID:  optionalID(f.ParentID),
+		Name:      f.Name,
+		Path:      p,
+		CreatedAt: optionalTime(f.CreatedAt),
+		UpdatedAt: optionalTime(f.UpdatedAt),
+	}
+}
+
+func fileEntry(f database.File, p string) Entry {
+	return Entry{
+		Kind:      KindFile,
+		ID:        &f.ID,
+		ParentID:  optionalID(f.FolderID),
+		Name:      f.Name,
+		Path:      p,
+		SizeBytes: &f.SizeBytes,
+		MimeType:  f.MimeType.String,
+		SHA256:    f.Sha256.String,
+		CreatedAt: optionalTime(f.CreatedAt),
+		UpdatedAt: optionalTime(f.UpdatedAt),
+	}
+}
+
+// Service addresses the user's tree by path rather than by ID.
+type Service struct {
+	queries       Queries
+	folderService FolderService
+	fileService   FileService
+}
+
+func NewService(q Queries, folders FolderService, files FileService) *Service {
+	return &Service{queries: q, folderService: folders, fileService: files}
+}
+
+// walk resolves as much of segments as exists. folders[i] is the folder at
+// depth i+1; target is the item the whole path names, if any. When a folder
+// and a file share the final name, the folder wins.
+func (s *Service) walk(ctx context.Context, userID int32, segments []string) ([]database.ResolvePathRow, *database.ResolvePathRow, error) {
+	rows, err := s.queries.ResolvePath(ctx, database.ResolvePathParams{
+		UserID:   sql.NullInt32{Int32: userID, Valid: true},
+		Segments: segments,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving path: %w", err)
+	}
+
+	var folders []database.ResolvePathRow
+	var target *database.ResolvePathRow
+	for i, row := range rows {
+		if row.Kind == KindFolder && int(row.Depth) == len(folders)+1 {
+			folders = append(folders, row)
+		}
+		if int(row.Depth) == len(segments) && target == nil {
+			target = &rows[i]
+		}
+	}
+	return folders, target, nil
+}
+
+// Resolve returns the file or folder at p.
+func (s *Service) Resolve(ctx context.Context, userID int32, p string) (Entry, error) {
+	segments, err := Split(p)
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(segments) == 0 {
+		return root, nil
+	}
+
+	_, target, err := s.walk(ctx, userID, segments)
+	if err != nil {
+		return Entry{}, err
+	}
+	if target == nil {
+		return Entry{}, fmt.Errorf("%w: %s", ErrNotFound, join(segments))
+	}
+	return rowEntry(*target, join(segments)), nil
+}
+
+// List returns the folder at p and what is directly inside it, folders first.
+func (s *Service) List(ctx context.Context, userID int32, p string) (Entry, []Entry, error) {
+	dir, err := s.Resolve(ctx, userID, p)
+	if err != nil {
+		return Entry{}, nil, err
+	}
+	if dir.Kind != KindFolder {
+		return Entry{}, nil, ErrNotAFolder
+	}
+
+	var parentID uuid.NullUUID
+	if dir.ID != nil {
+		parentID = uuid.NullUUID{UUID: *dir.ID, Valid: true}
+	}
+	childPath := func(name string) string {
+		return path.Join(dir.Path, name)
+	}
+
+	folders, err := s.folderService.ListFoldersByParent(ctx, userID, parentID)
+	if err != nil {
+		return Entry{}, nil, fmt.Errorf("listing folders: %w", err)
+	}
+	files, err := s.fileService.ListFilesInFolder(ctx, dir.ID, userID)
+	if err != nil {
+		return Entry{}, nil, fmt.Errorf("listing files: %w", err)
+	}
+
+	entries := make([]Entry, 0, len(folders)+len(files))
+	for _, f := range folders {
+		entries = append(entries, folderEntry(f, childPath(f.Name)))
+	}
+	for _, f := range files {
+		entries = append(entries, fileEntry(f, childPath(f.Name)))
+	}
+	return dir, entries, nil
+}
+
+// Upload stores content at p, creating any missing folders on the way like
+// mkdir -p. An existing file at p is replaced, as with SaveFile.
+func (s *Service) Upload(ctx context.Context, userID int32, p string, sizeBytes int64, content io.Reader) (Entry, error) {
+	segments, err := Split(p)
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(segments) == 0 {
+		return Entry{}, fmt.Errorf("%w: a file name is required", ErrInvalidPath)
+	}
+
+	folders, target, err := s.walk(ctx, userID, segments)
+	if err != nil {
+		return Entry{}, err
+	}
+	if target != nil && target.Kind == KindFolder {
+		return Entry{}, ErrNotAFile
+	}
+
+	// SaveFile enforces the quota too, but checking first leaves no new
+	// folders behind when the file won't fit
+	var freed int64
+	if target != nil {
+		freed = target.SizeBytes.Int64
+	}
+	if err := quota.Check(ctx, s.queries, userID, sizeBytes-freed); err != nil {
+		return Entry{}, err
+	}
+
+	// Create whatever part of the directory chain is missing. With no folder
+	// at the full depth, every matched folder is part of the chain.
+	dirDepth := len(segments) - 1
+	var parent uuid.NullUUID
+	if len(folders) > 0 {
+		parent = uuid.NullUUID{UUID: folders[len(folders)-1].ID, Valid: true}
+	}
+	for depth := len(folders) + 1; depth <= dirDepth; depth++ {
+		created, err := s.folderService.CreateFolder(ctx, userID, segments[depth-1], parent)
+		if err != nil {
+			return Entry{}, fmt.Errorf("creating folder %s: %w", join(segments[:depth]), err)
+		}
+		parent = uuid.NullUUID{UUID: created.ID, Valid: true}
+	}
+
+	saved, err := s.fileService.SaveFile(ctx, optionalID(parent), userID, segments[dirDepth], sizeBytes, content)
+	if err != nil {
+		return Entry{}, err
+	}
+	return fileEntry(saved, join(segments)), nil
+}
+
+// Download opens the file at p.
+func (s *Service) Download(ctx context.Context, userID int32, p string) (database.File, io.ReadCloser, error) {
+	entry, err := s.Resolve(ctx, userID, p)
+	if err != nil {
+		return database.File{}, nil, err
+	}
+	if entry.Kind != KindFile {
+		return database.File{}, nil, ErrNotAFile
+	}
+	return s.fileService.GetFileForDownload(ctx, *entry.ID, userID)
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) Resolve(ctx context.Context, userID int32, p string) (paths.Entry, error) {
+	args := m.Called(ctx, userID, p)
+	return args.Get(0).(paths.Entry), args.Error(1)
+}
+
+func (m *MockService) List(ctx context.Context, userID int32, p string) (paths.Entry, []paths.Entry, error) {
+	args := m.Called(ctx, userID, p)
+	return args.Get(0).(paths.Entry), args.Get(1).([]paths.Entry), args.Error(2)
+}
+
+func (m *MockService) Upload(ctx context.Context, userID int32, p string, sizeBytes int64, content io.Reader) (paths.Entry, error) {
+	args := m.Called(ctx, userID, p, sizeBytes, content)
+	return args.Get(0).(paths.Entry), args.Error(1)
+}
+
+func (m *MockService) Download(ctx context.Context, userID int32, p string) (database.File, io.ReadCloser, error) {
+	args := m.Called(ctx, userID, p)
+	reader, _ := args.Get(1).(io.ReadCloser)
+	return args.Get(0).(database.File), reader, args.Error(2)
+}
+
+func asUser(req *http.Request, userID int32) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), userID))
+}
+
+func TestStatHandler_NotFound(t *testing.T) {
+	mockSvc := new(MockService)
+	mockSvc.On("Resolve", mock.Anything, int32(1), "/nope").Return(paths.Entry{}, paths.ErrNotFound)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/paths/stat?path=/nope", nil), 1)
+	rec := httptest.NewRecorder()
+	paths.StatHandler(mockSvc).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestDownloadHandler_Streams(t *testing.T) {
+	mockSvc := new(MockService)
+	mockSvc.On("Download", mock.Anything, int32(1), "/a.txt").
+		Return(database.File{Name: "a.txt", SizeBytes: 2}, io.NopCloser(strings.NewReader("hi")), nil)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/paths/download?path=/a.txt", nil), 1)
+	rec := httptest.NewRecorder()
+	paths.DownloadHandler(mockSvc).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "hi", rec.Body.String())
+	assert.Equal(t, `attachment; filename="a.txt"; filename*=UTF-8''a.txt`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+}
+
+func TestDownloadHandler_InlineOnlyForSafeTypes(t *testing.T) {
+	mockSvc := new(MockService)
+	mockSvc.On("Download", mock.Anything, int32(1), "/a.png").
+		Return(database.File{Name: "a.png", SizeBytes: 2, MimeType: sql.NullString{String: "image/png", Valid: true}}, io.NopCloser(strings.NewReader("hi")), nil)
+	mockSvc.On("Download", mock.Anything, int32(1), "/a.html").
+		Return(database.File{Name: "a.html", SizeBytes: 2, MimeType: sql.NullString{String: "text/html; charset=utf-8", Valid: true}}, io.NopCloser(strings.NewReader("hi")), nil)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/paths/download?path=/a.png&disposition=inline", nil), 1)
+	rec := httptest.NewRecorder()
+	paths.DownloadHandler(mockSvc).ServeHTTP(rec, req)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Disposition"), "inline;"))
+
+	req = asUser(httptest.NewRequest(http.MethodGet, "/paths/download?path=/a.html&disposition=inline", nil), 1)
+	rec = httptest.NewRecorder()
+	paths.DownloadHandler(mockSvc).ServeHTTP(rec, req)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment;"))
+	assert.Contains(t, rec.Header().Get("Content-Security-Policy"), "sandbox")
+}
+
+func TestDownloadHandler_InvalidDisposition(t *testing.T) {
+	mockSvc := new(MockService)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/paths/download?path=/a.txt&disposition=open", nil), 1)
+	rec := httptest.NewRecorder()
+	paths.DownloadHandler(mockSvc).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockSvc.AssertNotCalled(t, "Download", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUploadHandler_RequiresLength(t *testing.T) {
+	mockSvc := new(MockService)
+
+	req := asUser(httptest.NewRequest(http.MethodPut, "/paths/upload?path=/a.txt", strings.NewReader("hi")), 1)
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	paths.UploadHandler(mockSvc).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusLengthRequired, rec.Code)
+	mockSvc.AssertNotCalled(t, "Upload", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUploadHandler_OverQuota(t *testing.T) {
+	mockSvc := new(MockService)
+	mockSvc.On("Upload", mock.Anything, int32(1), "/a.txt", int64(2), mock.Anything).
+		Return(paths.Entry{}, fmt.Errorf("%w: 2 more needed", quota.ErrExceeded))
+
+	req := asUser(httptest.NewRequest(http.MethodPut, "/paths/upload?path=/a.txt", strings.NewReader("hi")), 1)
+	rec := httptest.NewRecorder()
+	paths.UploadHandler(mockSvc).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInsufficientStorage, rec.Code)
+}
@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+	"github.com/bellezhang119/cloud-storage/internal/paths/pathstest"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func upload(t *testing.T, tree *pathstest.MemTree, p, body string) {
+	t.Helper()
+	_, err := tree.Upload(context.Background(), 1, p, int64(len(body)), strings.NewReader(body))
+	require.NoError(t, err)
+}
+
+func TestRename_RenamesFirstWhenTheOldNameIsTaken(t *testing.T) {
+	ctx := context.Background()
+	tree := pathstest.NewMemTree(1 << 20)
+	_, err := tree.CreateFolder(ctx, 1, "dest", paths.NullID(nil))
+	require.NoError(t, err)
+	upload(t, tree, "/a.txt", "moved")
+	upload(t, tree, "/dest/a.txt", "stays")
+
+	src, err := tree.Resolve(ctx, 1, "/a.txt")
+	require.NoError(t, err)
+	dest, err := tree.Resolve(ctx, 1, "/dest")
+	require.NoError(t, err)
+
+	require.NoError(t, paths.Rename(ctx, tree, tree, tree, 1, src, dest, "b.txt"))
+	body, ok := tree.Lookup("/dest/b.txt")
+	assert.True(t, ok)
+	assert.Equal(t, "moved", body)
+	body, _ = tree.Lookup("/dest/a.txt")
+	assert.Equal(t, "stays", body)
+	_, ok = tree.Lookup("/a.txt")
+	assert.False(t, ok)
+}
+
+func TestCheckUpload_AllowsForTheReplacedFile(t *testing.T) {
+	ctx := context.Background()
+	tree := pathstest.NewMemTree(10)
+	upload(t, tree, "/a.txt", "12345678")
+
+	assert.NoError(t, paths.CheckUpload(ctx, tree, tree, 1, "/a.txt", 10))
+	assert.True(t, errors.Is(paths.CheckUpload(ctx, tree, tree, 1, "/b.txt", 3), quota.ErrExceeded))
+
+	room, err := paths.UploadRoom(ctx, tree, tree, 1, "/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), room)
+}
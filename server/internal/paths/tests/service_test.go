@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) ResolvePath(ctx context.Context, arg database.ResolvePathParams) ([]database.ResolvePathRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ResolvePathRow), args.Error(1)
+}
+
+func (m *MockQueries) GetStorageUsage(ctx context.Context, id int32) (database.GetStorageUsageRow, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.GetStorageUsageRow), args.Error(1)
+}
+
+type MockFolderService struct {
+	mock.Mock
+}
+
+func (m *MockFolderService) CreateFolder(ctx context.Context, userID int32, name string, parentID uuid.NullUUID) (database.Folder, error) {
+	args := m.Called(ctx, userID, name, parentID)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func (m *MockFolderService) ListFoldersByParent(ctx context.Context, userID int32, parentID uuid.NullUUID) ([]database.Folder, error) {
+	args := m.Called(ctx, userID, parentID)
+	return args.Get(0).([]database.Folder), args.Error(1)
+}
+
+type MockFileService struct {
+	mock.Mock
+}
+
+func (m *MockFileService) SaveFile(ctx context.Context, folderID *uuid.UUID, userID int32, name string, sizeBytes int64, content io.Reader) (database.File, error) {
+	args := m.Called(ctx, folderID, userID, name, sizeBytes, content)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockFileService) ListFilesInFolder(ctx context.Context, folderID *uuid.UUID, userID int32) ([]database.File, error) {
+	args := m.Called(ctx, folderID, userID)
+	return args.Get(0).([]database.File), args.Error(1)
+}
+
+func (m *MockFileService) GetFileForDownload(ctx context.Context, fileID uuid.UUID, userID int32) (database.File, io.ReadCloser, error) {
+	args := m.Called(ctx, fileID, userID)
+	reader, _ := args.Get(1).(io.ReadCloser)
+	return args.Get(0).(database.File), reader, args.Error(2)
+}
+
+var uID = sql.NullInt32{Int32: 1, Valid: true}
+
+func resolveParams(segments ...string) database.ResolvePathParams {
+	return database.ResolvePathParams{UserID: uID, Segments: segments}
+}
+
+func folderRow(id uuid.UUID, name string, depth int32) database.ResolvePathRow {
+	return database.ResolvePathRow{Kind: paths.KindFolder, ID: id, Name: name, Depth: depth}
+}
+
+func TestSplit(t *testing.T) {
+	segments, err := paths.Split("/projects//2024/./report.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"projects", "2024", "report.pdf"}, segments)
+
+	segments, err = paths.Split("projects/../docs")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docs"}, segments)
+
+	segments, err = paths.Split("/")
+	assert.NoError(t, err)
+	assert.Empty(t, segments)
+
+	_, err = paths.Split(strings.Repeat("/a", paths.MaxDepth+1))
+	assert.ErrorIs(t, err, paths.ErrInvalidPath)
+}
+
+func TestResolve_File(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := paths.NewService(mockQueries, new(MockFolderService), new(MockFileService))
+	folderID, fileID := uuid.New(), uuid.New()
+
+	mockQueries.On("ResolvePath", mock.Anything, resolveParams("docs", "a.txt")).Return([]database.ResolvePathRow{
+		folderRow(folderID, "docs", 1),
+		{Kind: paths.KindFile, ID: fileID, Name: "a.txt", ParentID: uuid.NullUUID{UUID: folderID, Valid: true},
+			SizeBytes: sql.NullInt64{Int64: 3, Valid: true}, Depth: 2},
+	}, nil)
+
+	entry, err := svc.Resolve(context.Background(), 1, "/docs/a.txt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, paths.KindFile, entry.Kind)
+	assert.Equal(t, fileID, *entry.ID)
+	assert.Equal(t, folderID, *entry.ParentID)
+	assert.Equal(t, "/docs/a.txt", entry.Path)
+	assert.Equal(t, int64(3), *entry.SizeBytes)
+}
+
+func TestResolve_PartialMatchIsNotFound(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := paths.NewService(mockQueries, new(MockFolderService), new(MockFileService))
+
+	mockQueries.On("ResolvePath", mock.Anything, resolveParams("docs", "missing")).
+		Return([]database.ResolvePathRow{folderRow(uuid.New(), "docs", 1)}, nil)
+
+	_, err := svc.Resolve(context.Background(), 1, "docs/missing")
+
+	assert.ErrorIs(t, err, paths.ErrNotFound)
+}
+
+func TestResolve_RootNeedsNoQuery(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := paths.NewService(mockQueries, new(MockFolderService), new(MockFileService))
+
+	entry, err := svc.Resolve(context.Background(), 1, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, paths.KindFolder, entry.Kind)
+	assert.Nil(t, entry.ID)
+	assert.Equal(t, "/", entry.Path)
+	mockQueries.AssertNotCalled(t, "ResolvePath", mock.Anything, mock.Anything)
+}
+
+func TestUpload_CreatesMissingFolders(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockFolders := new(MockFolderService)
+	mockFiles := new(MockFileService)
+	svc := paths.NewService(mockQueries, mockFolders, mockFiles)
+	projectsID, yearID, monthID := uuid.New(), uuid.New(), uuid.New()
+	content := strings.NewReader("hello")
+
+	mockQueries.On("ResolvePath", mock.Anything, resolveParams("projects", "2024", "05", "report.pdf")).
+		Return([]database.ResolvePathRow{folderRow(projectsID, "projects", 1)}, nil)
+	mockQueries.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{UsedBytes: 0, StorageQuota: 1000}, nil)
+	mockFolders.On("CreateFolder", mock.Anything, int32(1), "2024", uuid.NullUUID{UUID: projectsID, Valid: true}).
+		Return(database.Folder{ID: yearID}, nil)
+	mockFolders.On("CreateFolder", mock.Anything, int32(1), "05", uuid.NullUUID{UUID: yearID, Valid: true}).
+		Return(database.Folder{ID: monthID}, nil)
+	mockFiles.On("SaveFile", mock.Anything, &monthID, int32(1), "report.pdf", int64(5), content).
+		Return(database.File{ID: uuid.New(), Name: "report.pdf", SizeBytes: 5}, nil)
+
+	entry, err := svc.Upload(context.Background(), 1, "/projects/2024/05/report.pdf", 5, content)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/projects/2024/05/report.pdf", entry.Path)
+	mockFolders.AssertExpectations(t)
+	mockFiles.AssertExpectations(t)
+}
+
+func TestUpload_AtRoot(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockFiles := new(MockFileService)
+	svc := paths.NewService(mockQueries, new(MockFolderService), mockFiles)
+	content := strings.NewReader("x")
+
+	mockQueries.On("ResolvePath", mock.Anything, resolveParams("notes.txt")).Return([]database.ResolvePathRow{}, nil)
+	mockQueries.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{UsedBytes: 0, StorageQuota: 1000}, nil)
+	mockFiles.On("SaveFile", mock.Anything, (*uuid.UUID)(nil), int32(1), "notes.txt", int64(1), content).
+		Return(database.File{ID: uuid.New(), Name: "notes.txt"}, nil)
+
+	_, err := svc.Upload(context.Background(), 1, "notes.txt", 1, content)
+
+	assert.NoError(t, err)
+	mockFiles.AssertExpectations(t)
+}
+
+func TestUpload_OverQuotaCreatesNothing(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockFolders := new(MockFolderService)
+	mockFiles := new(MockFileService)
+	svc := paths.NewService(mockQueries, mockFolders, mockFiles)
+
+	mockQueries.On("ResolvePath", mock.Anything, resolveParams("new", "big.bin")).Return([]database.ResolvePathRow{}, nil)
+	mockQueries.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{UsedBytes: 990, StorageQuota: 1000}, nil)
+
+	_, err := svc.Upload(context.Background(), 1, "/new/big.bin", 50, strings.NewReader("x"))
+
+	assert.ErrorIs(t, err, quota.ErrExceeded)
+	mockFolders.AssertNotCalled(t, "CreateFolder", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockFiles.AssertNotCalled(t, "SaveFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpload_OntoFolder(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockFiles := new(MockFileService)
+	svc := paths.NewService(mockQueries, new(MockFolderService), mockFiles)
+
+	mockQueries.On("ResolvePath", mock.Anything, resolveParams("docs")).
+		Return([]database.ResolvePathRow{folderRow(uuid.New(), "docs", 1)}, nil)
+
+	_, err := svc.Upload(context.Background(), 1, "/docs", 1, strings.NewReader("x"))
+
+	assert.ErrorIs(t, err, paths.ErrNotAFile)
+	mockFiles.AssertNotCalled(t, "SaveFile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestList_Folder(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockFolders := new(MockFolderService)
+	mockFiles := new(MockFileService)
+	svc := paths.NewService(mockQueries, mockFolders, mockFiles)
+	docsID := uuid.New()
+
+	mockQueries.On("ResolvePath", mock.Anything, resolveParams("docs")).
+		Return([]database.ResolvePathRow{folderRow(docsID, "docs", 1)}, nil)
+	mockFolders.On("ListFoldersByParent", mock.Anything, int32(1), uuid.NullUUID{UUID: docsID, Valid: true}).
+		Return([]database.Folder{{ID: uuid.New(), Name: "drafts"}}, nil)
+	mockFiles.On("ListFilesInFolder", mock.Anything, &docsID, int32(1)).
+		Return([]database.File{{ID: uuid.New(), Name: "a.txt"}}, nil)
+
+	dir, items, err := svc.List(context.Background(), 1, "/docs")
+
+	assert.NoError(t, err)
+	assert.Equal(t, docsID, *dir.ID)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "/docs/drafts", items[0].Path)
+	assert.Equal(t, "/docs/a.txt", items[1].Path)
+}
@@ -0,0 +1,69 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+)
+
+var ErrExceeded = errors.New("storage quota exceeded")
+
+type Queries interface {
+	GetStorageUsage(ctx context.Context, id int32) (database.GetStorageUsageRow, error)
+}
+
+// Check fails with ErrExceeded if adding the given number of bytes would take
+// the user past their quota. A negative amount (e.g. an overwrite with a
+// smaller file) always passes.
+func Check(ctx context.Context, q Queries, userID int32, additional int64) error {
+	if additional <= 0 {
+		return nil
+	}
+
+	usage, err := q.GetStorageUsage(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("fetching storage usage: %w", err)
+	}
+	if usage.UsedBytes+additional > usage.StorageQuota {
+		return fmt.Errorf("%w: %d of %d bytes used, %d more needed",
+			ErrExceeded, usage.UsedBytes, usage.StorageQuota, additional)
+	}
+	return nil
+}
+
+// Room is how many more bytes the user can store before reaching their
+// quota; never negative.
+func Room(ctx context.Context, q Queries, userID int32) (int64, error) {
+	usage, err := q.GetStorageUsage(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("fetching storage usage: %w", err)
+	}
+	return max(usage.StorageQuota-usage.UsedBytes, 0), nil
+}
+
+// LimitReader reads from r but fails with ErrExceeded once more than n bytes
+// have come through, for uploads whose declared size can't be trusted.
+func LimitReader(r io.Reader, n int64) io.Reader {
+	return &limitedReader{r: r, left: n}
+}
+
+type limitedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// Ask for one byte past the limit, so a body of exactly n bytes passes
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		return n, fmt.Errorf("%w: upload is larger than the room left", ErrExceeded)
+	}
+	return n, err
+}
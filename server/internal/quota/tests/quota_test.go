@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) GetStorageUsage(ctx context.Context, id int32) (database.GetStorageUsageRow, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.GetStorageUsageRow), args.Error(1)
+}
+
+func TestCheck_WithinQuota(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockQueries.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{StorageQuota: 100, UsedBytes: 60}, nil)
+
+	assert.NoError(t, quota.Check(context.Background(), mockQueries, 1, 40))
+	mockQueries.AssertExpectations(t)
+}
+
+func TestCheck_Exceeded(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockQueries.On("GetStorageUsage", mock.Anything, int32(1)).
+		Return(database.GetStorageUsageRow{StorageQuota: 100, UsedBytes: 60}, nil)
+
+	err := quota.Check(context.Background(), mockQueries, 1, 41)
+
+	assert.ErrorIs(t, err, quota.ErrExceeded)
+}
+
+func TestCheck_NothingAddedSkipsLookup(t *testing.T) {
+	mockQueries := new(MockQueries)
+
+	assert.NoError(t, quota.Check(context.Background(), mockQueries, 1, -10))
+	mockQueries.AssertNotCalled(t, "GetStorageUsage", mock.Anything, mock.Anything)
+}
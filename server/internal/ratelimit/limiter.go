@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is a token bucket that holds up to Limit tokens and refills them
+// evenly over Period, so "10/1m" allows bursts of 10 and a steady 10 a minute.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+func (p Policy) refillRate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// Result describes the outcome of a single Allow call.
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+// ParsePolicy reads a policy in "<limit>/<period>" form, e.g. "5/1m" or "100/1h".
+func ParsePolicy(name, spec string) (Policy, error) {
+	limitStr, periodStr, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("invalid rate limit %q: expected <limit>/<period>", spec)
+	}
+
+	limit, err := strconv.Atoi(strings.TrimSpace(limitStr))
+	if err != nil || limit <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q: limit must be a positive integer", spec)
+	}
+
+	period, err := time.ParseDuration(strings.TrimSpace(periodStr))
+	if err != nil || period <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q: period must be a positive duration", spec)
+	}
+
+	return Policy{Name: name, Limit: limit, Period: period}, nil
+}
+
+// PolicyFromEnv returns the policy configured in envVar, falling back to def
+// when the variable is unset or malformed.
+func PolicyFromEnv(envVar string, def Policy) Policy {
+	spec := os.Getenv(envVar)
+	if spec == "" {
+		return def
+	}
+
+	p, err := ParsePolicy(def.Name, spec)
+	if err != nil {
+		return def
+	}
+	return p
+}
+
+// retryAfter is how long until a bucket holding tokens has one whole token.
+func retryAfter(tokens float64, policy Policy) time.Duration {
+	missing := 1 - tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / policy.refillRate() * float64(time.Second))
+}
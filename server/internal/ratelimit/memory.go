@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const sweepEvery = 1024
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// MemoryLimiter keeps buckets in process memory. It is only correct for a
+// single server instance; use PostgresLimiter when running several.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+	now     func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// SetClock replaces the time source; used by tests.
+func (l *MemoryLimiter) SetClock(now func() time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = now
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	bucketKey := policy.Name + ":" + key
+
+	b, ok := l.buckets[bucketKey]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Limit), updated: now, period: policy.Period}
+		l.buckets[bucketKey] = b
+	} else {
+		elapsed := now.Sub(b.updated).Seconds()
+		b.tokens = math.Min(float64(policy.Limit), b.tokens+elapsed*policy.refillRate())
+		b.updated = now
+	}
+
+	l.calls++
+	if l.calls%sweepEvery == 0 {
+		l.sweep(now)
+	}
+
+	if b.tokens < 1 {
+		return Result{Allowed: false, RetryAfter: retryAfter(b.tokens, policy)}, nil
+	}
+
+	b.tokens--
+	return Result{Allowed: true, Remaining: int(b.tokens)}, nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for k, b := range l.buckets {
+		if now.Sub(b.updated) > b.period {
+			delete(l.buckets, k)
+		}
+	}
+}
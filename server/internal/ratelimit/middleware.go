@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+)
+
+const maxPeekBody = 1 << 20
+
+// KeyFunc extracts the value a bucket is keyed on. Returning false skips the
+// rule for this request, e.g. when the body carries no email.
+type KeyFunc func(r *http.Request) (string, bool)
+
+type Rule struct {
+	Policy Policy
+	Key    KeyFunc
+}
+
+// Middleware checks every rule in order and rejects the request with 429 and a
+// Retry-After header as soon as one bucket is empty. Limiter errors fail open
+// so a database hiccup doesn't lock everyone out.
+func Middleware(limiter Limiter, rules ...Rule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, rule := range rules {
+				key, ok := rule.Key(r)
+				if !ok {
+					continue
+				}
+
+				res, err := limiter.Allow(r.Context(), key, rule.Policy)
+				if err != nil {
+					log.Printf("rate limiter error for %s: %v", rule.Policy.Name, err)
+					continue
+				}
+
+				if !res.Allowed {
+					seconds := int(math.Ceil(res.RetryAfter.Seconds()))
+					w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+					util.RespondWithError(w, http.StatusTooManyRequests, "Too many requests, please try again later")
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ProxyHopsFromEnv reads how many proxies in front of the server append to
+// X-Forwarded-For. TRUST_PROXY=true means one; a number means that many.
+func ProxyHopsFromEnv() int {
+	v := os.Getenv("TRUST_PROXY")
+	if v == "true" {
+		return 1
+	}
+	if n, err := strconv.Atoi(v); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// ByIP keys on the client address. With trustedHops proxies in front, the
+// client is the entry that many places from the right of X-Forwarded-For:
+// each proxy appends the address it saw, so everything further left came
+// from the client and can be anything.
+func ByIP(trustedHops int) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		if trustedHops > 0 {
+			var hops []string
+			for _, fwd := range r.Header.Values("X-Forwarded-For") {
+				for _, ip := range strings.Split(fwd, ",") {
+					hops = append(hops, strings.TrimSpace(ip))
+				}
+			}
+			if len(hops) >= trustedHops {
+				if ip := hops[len(hops)-trustedHops]; ip != "" {
+					return "ip:" + ip, true
+				}
+			}
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return "ip:" + host, true
+	}
+}
+
+// ByUserID keys on the authenticated user and must run after AuthMiddleware.
+func ByUserID() KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			return "", false
+		}
+		return "user:" + strconv.Itoa(int(userID)), true
+	}
+}
+
+// ByJSONField keys on a string field of a JSON request body, such as the
+// email on login. The body is restored so the handler can still decode it.
+func ByJSONField(field string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		if r.Body == nil {
+			return "", false
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBody))
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return "", false
+		}
+
+		var payload map[string]any
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return "", false
+		}
+
+		value, ok := payload[field].(string)
+		value = strings.ToLower(strings.TrimSpace(value))
+		if !ok || value == "" {
+			return "", false
+		}
+		return field + ":" + value, true
+	}
+}
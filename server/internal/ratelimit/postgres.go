@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+)
+
+type Queries interface {
+	TakeRateLimitToken(ctx context.Context, arg database.TakeRateLimitTokenParams) (database.TakeRateLimitTokenRow, error)
+	DeleteStaleRateLimitBuckets(ctx context.Context, maxIdleSeconds float64) (int64, error)
+}
+
+// PostgresLimiter stores buckets in the rate_limit_buckets table so every
+// server instance shares the same limits. Each Allow is a single upsert.
+type PostgresLimiter struct {
+	queries Queries
+}
+
+func NewPostgresLimiter(q Queries) *PostgresLimiter {
+	return &PostgresLimiter{queries: q}
+}
+
+func (l *PostgresLimiter) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	row, err := l.queries.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		BucketKey:  policy.Name + ":" + key,
+		Capacity:   float64(policy.Limit),
+		RefillRate: policy.refillRate(),
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	if !row.Allowed {
+		return Result{Allowed: false, RetryAfter: retryAfter(row.Tokens, policy)}, nil
+	}
+	return Result{Allowed: true, Remaining: int(row.Tokens)}, nil
+}
+
+// PruneStale deletes buckets untouched for longer than maxIdle.
+func (l *PostgresLimiter) PruneStale(ctx context.Context, maxIdle time.Duration) (int64, error) {
+	return l.queries.DeleteStaleRateLimitBuckets(ctx, maxIdle.Seconds())
+}
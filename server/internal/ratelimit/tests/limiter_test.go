@@ -0,0 +1,32 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ratelimit.ParsePolicy("login", "5/1m")
+	assert.NoError(t, err)
+	assert.Equal(t, ratelimit.Policy{Name: "login", Limit: 5, Period: time.Minute}, p)
+}
+
+func TestParsePolicy_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "5", "x/1m", "0/1m", "5/abc", "5/-1m"} {
+		_, err := ratelimit.ParsePolicy("login", spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	def := ratelimit.Policy{Name: "login", Limit: 5, Period: time.Minute}
+
+	t.Setenv("TEST_RATE_LIMIT", "100/1h")
+	assert.Equal(t, ratelimit.Policy{Name: "login", Limit: 100, Period: time.Hour}, ratelimit.PolicyFromEnv("TEST_RATE_LIMIT", def))
+
+	t.Setenv("TEST_RATE_LIMIT", "garbage")
+	assert.Equal(t, def, ratelimit.PolicyFromEnv("TEST_RATE_LIMIT", def))
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLimiter_AllowsBurstThenDenies(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter()
+	now := time.Unix(1_700_000_000, 0)
+	limiter.SetClock(func() time.Time { return now })
+
+	policy := ratelimit.Policy{Name: "test", Limit: 3, Period: time.Minute}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		res, err := limiter.Allow(ctx, "ip:1.2.3.4", policy)
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 2-i, res.Remaining)
+	}
+
+	res, err := limiter.Allow(ctx, "ip:1.2.3.4", policy)
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 20*time.Second, res.RetryAfter)
+}
+
+func TestMemoryLimiter_Refills(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter()
+	now := time.Unix(1_700_000_000, 0)
+	limiter.SetClock(func() time.Time { return now })
+
+	policy := ratelimit.Policy{Name: "test", Limit: 2, Period: time.Minute}
+	ctx := context.Background()
+
+	limiter.Allow(ctx, "k", policy)
+	limiter.Allow(ctx, "k", policy)
+	res, _ := limiter.Allow(ctx, "k", policy)
+	assert.False(t, res.Allowed)
+
+	now = now.Add(30 * time.Second)
+	res, _ = limiter.Allow(ctx, "k", policy)
+	assert.True(t, res.Allowed)
+}
+
+func TestMemoryLimiter_KeysAndPoliciesAreIndependent(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter()
+	ctx := context.Background()
+
+	login := ratelimit.Policy{Name: "login", Limit: 1, Period: time.Hour}
+	register := ratelimit.Policy{Name: "register", Limit: 1, Period: time.Hour}
+
+	res, _ := limiter.Allow(ctx, "a", login)
+	assert.True(t, res.Allowed)
+	res, _ = limiter.Allow(ctx, "b", login)
+	assert.True(t, res.Allowed)
+	res, _ = limiter.Allow(ctx, "a", register)
+	assert.True(t, res.Allowed)
+	res, _ = limiter.Allow(ctx, "a", login)
+	assert.False(t, res.Allowed)
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, policy ratelimit.Policy) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("db down")
+}
+
+func TestMiddleware_RejectsWithRetryAfter(t *testing.T) {
+	limiter := ratelimit.NewMemoryLimiter()
+	policy := ratelimit.Policy{Name: "login", Limit: 1, Period: time.Minute}
+
+	handler := ratelimit.Middleware(limiter, ratelimit.Rule{Policy: policy, Key: ratelimit.ByIP(0)})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	req.RemoteAddr = "10.0.0.1:5555"
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+}
+
+func TestMiddleware_FailsOpen(t *testing.T) {
+	policy := ratelimit.Policy{Name: "login", Limit: 1, Period: time.Minute}
+
+	handler := ratelimit.Middleware(failingLimiter{}, ratelimit.Rule{Policy: policy, Key: ratelimit.ByIP(0)})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestByJSONField_RestoresBody(t *testing.T) {
+	body := `{"email":" Foo@Example.com ","password":"x"}`
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+
+	key, ok := ratelimit.ByJSONField("email")(req)
+	assert.True(t, ok)
+	assert.Equal(t, "email:foo@example.com", key)
+
+	rest, _ := io.ReadAll(req.Body)
+	assert.Equal(t, body, string(rest))
+}
+
+func TestByJSONField_Missing(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"password":"x"}`))
+
+	_, ok := ratelimit.ByJSONField("email")(req)
+	assert.False(t, ok)
+}
+
+func TestByIP_TrustProxy(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.2:5555"
+	// The client sent the first entry; our proxy appended the second
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+
+	key, _ := ratelimit.ByIP(1)(req)
+	assert.Equal(t, "ip:203.0.113.7", key, "the entry our proxy added wins over the client's")
+
+	key, _ = ratelimit.ByIP(2)(req)
+	assert.Equal(t, "ip:198.51.100.1", key)
+
+	key, _ = ratelimit.ByIP(0)(req)
+	assert.Equal(t, "ip:10.0.0.2", key)
+
+	key, _ = ratelimit.ByIP(3)(req)
+	assert.Equal(t, "ip:10.0.0.2", key, "too few entries falls back to the peer")
+}
+
+func TestByIP_MultipleHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Add("X-Forwarded-For", "198.51.100.1")
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+
+	key, _ := ratelimit.ByIP(1)(req)
+	assert.Equal(t, "ip:203.0.113.7", key)
+}
+
+func TestProxyHopsFromEnv(t *testing.T) {
+	t.Setenv("TRUST_PROXY", "true")
+	assert.Equal(t, 1, ratelimit.ProxyHopsFromEnv())
+	t.Setenv("TRUST_PROXY", "2")
+	assert.Equal(t, 2, ratelimit.ProxyHopsFromEnv())
+	t.Setenv("TRUST_PROXY", "")
+	assert.Equal(t, 0, ratelimit.ProxyHopsFromEnv())
+}
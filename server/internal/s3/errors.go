@@ -0,0 +1,40 @@
+package s3
+
+import (
+	"net/http"
+)
+
+// Error is an S3 error response. Services return these (wrapped when there
+// is detail to add) and the handler writes them with their code and status,
+// which is what S3 clients act on.
+type Error struct {
+	Code    string
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+var (
+	ErrAccessDenied         = &Error{"AccessDenied", http.StatusForbidden, "Access Denied"}
+	ErrInvalidAccessKeyID   = &Error{"InvalidAccessKeyId", http.StatusForbidden, "The access key ID does not exist"}
+	ErrSignatureMismatch    = &Error{"SignatureDoesNotMatch", http.StatusForbidden, "The request signature does not match"}
+	ErrRequestTimeTooSkewed = &Error{"RequestTimeTooSkewed", http.StatusForbidden, "The request time is too far from the server time"}
+	ErrExpiredRequest       = &Error{"AccessDenied", http.StatusForbidden, "Request has expired"}
+	ErrMalformedAuth        = &Error{"AuthorizationHeaderMalformed", http.StatusBadRequest, "The authorization header is malformed"}
+	ErrContentSHA256        = &Error{"XAmzContentSHA256Mismatch", http.StatusBadRequest, "The payload does not match its declared SHA-256"}
+	ErrNoSuchBucket         = &Error{"NoSuchBucket", http.StatusNotFound, "The specified bucket does not exist"}
+	ErrNoSuchKey            = &Error{"NoSuchKey", http.StatusNotFound, "The specified key does not exist"}
+	ErrNoSuchUpload         = &Error{"NoSuchUpload", http.StatusNotFound, "The specified multipart upload does not exist"}
+	ErrBucketExists         = &Error{"BucketAlreadyOwnedByYou", http.StatusConflict, "Each user has exactly one bucket"}
+	ErrInvalidArgument      = &Error{"InvalidArgument", http.StatusBadRequest, "Invalid argument"}
+	ErrInvalidRequest       = &Error{"InvalidRequest", http.StatusBadRequest, "Invalid request"}
+	ErrInvalidKey           = &Error{"InvalidArgument", http.StatusBadRequest, "The key can't be stored as a path"}
+	ErrMalformedXML         = &Error{"MalformedXML", http.StatusBadRequest, "The XML is not well-formed or does not match the schema"}
+	ErrInvalidPart          = &Error{"InvalidPart", http.StatusBadRequest, "A part could not be found or its ETag does not match"}
+	ErrInvalidPartOrder     = &Error{"InvalidPartOrder", http.StatusBadRequest, "Parts must be listed in ascending order"}
+	ErrQuotaExceeded        = &Error{"QuotaExceeded", http.StatusForbidden, "Storage quota exceeded"}
+	ErrEntityTooLarge       = &Error{"EntityTooLarge", http.StatusBadRequest, "Your proposed upload exceeds the maximum allowed size"}
+	ErrNotImplemented       = &Error{"NotImplemented", http.StatusNotImplemented, "This operation is not supported"}
+	ErrInternal             = &Error{"InternalError", http.StatusInternalServerError, "We encountered an internal error. Please try again."}
+)
@@ -0,0 +1,794 @@
+package s3
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/content"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+)
+
+// maxXMLBody bounds the XML documents clients send, such as the part list
+// that completes an upload.
+const maxXMLBody = 1 << 20
+
+// maxDeleteKeys is the most keys one DeleteObjects request may name.
+const maxDeleteKeys = 1000
+
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+type ServiceInterface interface {
+	Authenticate(r *http.Request) (int32, io.Reader, error)
+	Owner(ctx context.Context, userID int32) (database.User, error)
+	ListObjects(ctx context.Context, userID int32, params ListParams) (ListResult, error)
+	GetObject(ctx context.Context, userID int32, key string) (Object, io.ReadCloser, error)
+	HeadObject(ctx context.Context, userID int32, key string) (Object, error)
+	CheckUpload(ctx context.Context, userID int32, key string, sizeBytes int64) error
+	PutObject(ctx context.Context, userID int32, key string, body io.Reader) (Object, error)
+	CopyObject(ctx context.Context, userID int32, srcKey, dstKey string) (Object, error)
+	DeleteObject(ctx context.Context, userID int32, key string) error
+	CreateMultipartUpload(ctx context.Context, userID int32, key string) (database.S3MultipartUpload, error)
+	UploadPart(ctx context.Context, userID int32, uploadID, key string, number int32, body io.Reader) (database.S3MultipartPart, error)
+	ListParts(ctx context.Context, userID int32, uploadID, key string) ([]database.S3MultipartPart, error)
+	ListMultipartUploads(ctx context.Context, userID int32) ([]database.S3MultipartUpload, error)
+	CompleteMultipartUpload(ctx context.Context, userID int32, uploadID, key string, parts []CompletedPart) (Object, error)
+	AbortMultipartUpload(ctx context.Context, userID int32, uploadID, key string) error
+}
+
+// Subresources the gateway has no equivalent for.
+var unsupported = []string{"acl", "policy", "cors", "lifecycle", "tagging", "website", "replication",
+	"encryption", "logging", "notification", "object-lock", "retention", "legal-hold", "torrent", "attributes", "select"}
+
+// call is one authenticated request.
+type call struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	s      ServiceInterface
+	userID int32
+	body   io.Reader
+	key    string
+}
+
+// Handler serves the S3 API under Prefix. Requests authenticate themselves
+// with SigV4, so it is not mounted behind AuthMiddleware.
+func Handler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-amz-request-id", requestID())
+
+		userID, body, err := service.Authenticate(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, Prefix), "/"), "/")
+		c := &call{w: w, r: r, s: service, userID: userID, body: body, key: key}
+		for _, name := range unsupported {
+			if r.URL.Query().Has(name) {
+				writeError(w, r, ErrNotImplemented)
+				return
+			}
+		}
+
+		switch {
+		case bucket == "":
+			err = c.service()
+		case bucket != Bucket:
+			err = ErrNoSuchBucket
+			if r.Method == http.MethodPut && key == "" {
+				err = fmt.Errorf("%w: each user has the one bucket %q", ErrInvalidRequest, Bucket)
+			}
+		case key == "":
+			err = c.bucket()
+		default:
+			err = c.object()
+		}
+		if err != nil {
+			writeError(w, r, err)
+		}
+	}
+}
+
+func (c *call) service() error {
+	if c.r.Method != http.MethodGet {
+		return ErrNotImplemented
+	}
+	user, err := c.s.Owner(c.r.Context(), c.userID)
+	if err != nil {
+		return err
+	}
+	writeXML(c.w, http.StatusOK, listAllMyBucketsResult{
+		Owner:   owner(user),
+		Buckets: []bucketXML{{Name: Bucket, CreationDate: user.CreatedAt.UTC().Format(timeFormat)}},
+	})
+	return nil
+}
+
+func (c *call) bucket() error {
+	q := c.r.URL.Query()
+	switch c.r.Method {
+	case http.MethodHead:
+		c.w.WriteHeader(http.StatusOK)
+		return nil
+	case http.MethodPut:
+		return ErrBucketExists
+	case http.MethodPost:
+		if q.Has("delete") {
+			return c.deleteObjects()
+		}
+	case http.MethodGet:
+		switch {
+		case q.Has("location"):
+			writeXML(c.w, http.StatusOK, locationConstraint{})
+			return nil
+		case q.Has("versioning"):
+			writeXML(c.w, http.StatusOK, versioningConfiguration{})
+			return nil
+		case q.Has("uploads"):
+			return c.listUploads()
+		case q.Get("list-type") == "2":
+			return c.listObjects(true)
+		default:
+			return c.listObjects(false)
+		}
+	}
+	return ErrNotImplemented
+}
+
+func (c *call) object() error {
+	q := c.r.URL.Query()
+	switch c.r.Method {
+	case http.MethodGet:
+		if q.Has("uploadId") {
+			return c.listParts()
+		}
+		return c.getObject()
+	case http.MethodHead:
+		return c.headObject()
+	case http.MethodPut:
+		switch {
+		case q.Has("partNumber") && q.Has("uploadId"):
+			if c.r.Header.Get("X-Amz-Copy-Source") != "" {
+				return ErrNotImplemented
+			}
+			return c.uploadPart()
+		case c.r.Header.Get("X-Amz-Copy-Source") != "":
+			return c.copyObject()
+		default:
+			return c.putObject()
+		}
+	case http.MethodPost:
+		switch {
+		case q.Has("uploads"):
+			return c.createUpload()
+		case q.Has("uploadId"):
+			return c.completeUpload()
+		}
+	case http.MethodDelete:
+		if q.Has("uploadId") {
+			if err := c.s.AbortMultipartUpload(c.r.Context(), c.userID, q.Get("uploadId"), c.key); err != nil {
+				return err
+			}
+		} else if err := c.s.DeleteObject(c.r.Context(), c.userID, c.key); err != nil {
+			return err
+		}
+		c.w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return ErrNotImplemented
+}
+
+func (c *call) listObjects(v2 bool) error {
+	q := c.r.URL.Query()
+	params := ListParams{Prefix: q.Get("prefix"), Delimiter: q.Get("delimiter"), MaxKeys: MaxListKeys}
+	if v := q.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%w: invalid max-keys", ErrInvalidArgument)
+		}
+		params.MaxKeys = min(n, MaxListKeys)
+	}
+	encoding := q.Get("encoding-type")
+	if encoding != "" && encoding != "url" {
+		return fmt.Errorf("%w: invalid encoding-type", ErrInvalidArgument)
+	}
+	enc := func(s string) string {
+		if encoding == "url" {
+			return url.QueryEscape(s)
+		}
+		return s
+	}
+
+	token := q.Get("continuation-token")
+	switch {
+	case !v2:
+		params.After = q.Get("marker")
+	case token != "":
+		after, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return fmt.Errorf("%w: invalid continuation-token", ErrInvalidArgument)
+		}
+		params.After = string(after)
+	default:
+		params.After = q.Get("start-after")
+	}
+
+	result, err := c.s.ListObjects(c.r.Context(), c.userID, params)
+	if err != nil {
+		return err
+	}
+
+	var contents []objectXML
+	for _, obj := range result.Objects {
+		contents = append(contents, objectXML{
+			Key:          enc(obj.Key),
+			LastModified: obj.LastModified.UTC().Format(timeFormat),
+			ETag:         obj.ETag,
+			Size:         obj.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	var prefixes []commonPrefixXML
+	for _, p := range result.CommonPrefixes {
+		prefixes = append(prefixes, commonPrefixXML{Prefix: enc(p)})
+	}
+
+	if !v2 {
+		res := listBucketResultV1{
+			Name: Bucket, Prefix: enc(params.Prefix), Marker: enc(params.After), Delimiter: enc(params.Delimiter),
+			MaxKeys: params.MaxKeys, EncodingType: encoding, IsTruncated: result.IsTruncated,
+			Contents: contents, CommonPrefixes: prefixes,
+		}
+		if result.IsTruncated {
+			res.NextMarker = enc(result.Next)
+		}
+		writeXML(c.w, http.StatusOK, res)
+		return nil
+	}
+
+	res := listBucketResultV2{
+		Name: Bucket, Prefix: enc(params.Prefix), Delimiter: enc(params.Delimiter), MaxKeys: params.MaxKeys,
+		EncodingType: encoding, KeyCount: len(contents) + len(prefixes), IsTruncated: result.IsTruncated,
+		ContinuationToken: token, StartAfter: enc(q.Get("start-after")),
+		Contents: contents, CommonPrefixes: prefixes,
+	}
+	if result.IsTruncated {
+		res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(result.Next))
+	}
+	writeXML(c.w, http.StatusOK, res)
+	return nil
+}
+
+func setObjectHeaders(h http.Header, obj Object) {
+	h.Set("ETag", obj.ETag)
+	h.Set("Last-Modified", obj.LastModified.UTC().Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	if obj.ContentType != "" {
+		h.Set("Content-Type", obj.ContentType)
+	}
+}
+
+func (c *call) getObject() error {
+	obj, rc, err := c.s.GetObject(c.r.Context(), c.userID, c.key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// Range requests need to seek; spool storage that can't
+	rs, ok := rc.(io.ReadSeeker)
+	if !ok {
+		tmp, _, err := spool(rc)
+		if err != nil {
+			return err
+		}
+		defer removeSpool(tmp)
+		rs = tmp
+	}
+
+	setObjectHeaders(c.w.Header(), obj)
+	content.SetSafetyHeaders(c.w.Header())
+	http.ServeContent(c.w, c.r, "", obj.LastModified, rs)
+	return nil
+}
+
+func (c *call) headObject() error {
+	obj, err := c.s.HeadObject(c.r.Context(), c.userID, c.key)
+	if err != nil {
+		return err
+	}
+	setObjectHeaders(c.w.Header(), obj)
+	c.w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	c.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// declaredSize is the payload size the client announced, if it did.
+func (c *call) declaredSize() int64 {
+	if v := c.r.Header.Get("X-Amz-Decoded-Content-Length"); v != "" {
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return c.r.ContentLength
+}
+
+func (c *call) putObject() error {
+	// Refuse what won't fit before reading the body
+	if n := c.declaredSize(); n > 0 {
+		if err := c.s.CheckUpload(c.r.Context(), c.userID, c.key, n); err != nil {
+			return err
+		}
+	}
+	obj, err := c.s.PutObject(c.r.Context(), c.userID, c.key, c.body)
+	if err != nil {
+		return err
+	}
+	c.w.Header().Set("ETag", obj.ETag)
+	c.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (c *call) copyObject() error {
+	source := c.r.Header.Get("X-Amz-Copy-Source")
+	source, _, _ = strings.Cut(source, "?")
+	source, err := url.PathUnescape(strings.TrimPrefix(source, "/"))
+	if err != nil {
+		return fmt.Errorf("%w: invalid x-amz-copy-source", ErrInvalidArgument)
+	}
+	bucket, srcKey, _ := strings.Cut(source, "/")
+	if bucket != Bucket {
+		return ErrNoSuchBucket
+	}
+
+	obj, err := c.s.CopyObject(c.r.Context(), c.userID, srcKey, c.key)
+	if err != nil {
+		return err
+	}
+	writeXML(c.w, http.StatusOK, copyObjectResult{LastModified: obj.LastModified.UTC().Format(timeFormat), ETag: obj.ETag})
+	return nil
+}
+
+func (c *call) deleteObjects() error {
+	var req deleteRequest
+	if err := c.readXML(&req); err != nil {
+		return err
+	}
+	if len(req.Objects) > maxDeleteKeys {
+		return fmt.Errorf("%w: at most %d keys per request", ErrMalformedXML, maxDeleteKeys)
+	}
+
+	var res deleteResult
+	for _, obj := range req.Objects {
+		if err := c.s.DeleteObject(c.r.Context(), c.userID, obj.Key); err != nil {
+			e := asError(err)
+			if e == ErrInternal {
+				log.Printf("s3 delete %q for user %d: %v", obj.Key, c.userID, err)
+			}
+			res.Errors = append(res.Errors, deleteError{Key: obj.Key, Code: e.Code, Message: e.Message})
+			continue
+		}
+		if !req.Quiet {
+			res.Deleted = append(res.Deleted, deletedXML{Key: obj.Key})
+		}
+	}
+	writeXML(c.w, http.StatusOK, res)
+	return nil
+}
+
+func (c *call) createUpload() error {
+	u, err := c.s.CreateMultipartUpload(c.r.Context(), c.userID, c.key)
+	if err != nil {
+		return err
+	}
+	writeXML(c.w, http.StatusOK, initiateMultipartUploadResult{Bucket: Bucket, Key: c.key, UploadID: u.ID.String()})
+	return nil
+}
+
+func (c *call) uploadPart() error {
+	q := c.r.URL.Query()
+	number, err := strconv.ParseInt(q.Get("partNumber"), 10, 32)
+	if err != nil {
+		return fmt.Errorf("%w: invalid partNumber", ErrInvalidArgument)
+	}
+	part, err := c.s.UploadPart(c.r.Context(), c.userID, q.Get("uploadId"), c.key, int32(number), c.body)
+	if err != nil {
+		return err
+	}
+	c.w.Header().Set("ETag", part.Etag)
+	c.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (c *call) completeUpload() error {
+	var req completeMultipartUpload
+	if err := c.readXML(&req); err != nil {
+		return err
+	}
+	parts := make([]CompletedPart, 0, len(req.Parts))
+	for _, p := range req.Parts {
+		parts = append(parts, CompletedPart{PartNumber: p.PartNumber, ETag: p.ETag})
+	}
+
+	obj, err := c.s.CompleteMultipartUpload(c.r.Context(), c.userID, c.r.URL.Query().Get("uploadId"), c.key, parts)
+	if err != nil {
+		return err
+	}
+	writeXML(c.w, http.StatusOK, completeMultipartUploadResult{
+		Location: Prefix + "/" + Bucket + "/" + c.key,
+		Bucket:   Bucket,
+		Key:      c.key,
+		ETag:     obj.ETag,
+	})
+	return nil
+}
+
+func (c *call) listParts() error {
+	uploadID := c.r.URL.Query().Get("uploadId")
+	parts, err := c.s.ListParts(c.r.Context(), c.userID, uploadID, c.key)
+	if err != nil {
+		return err
+	}
+	res := listPartsResult{Bucket: Bucket, Key: c.key, UploadID: uploadID, MaxParts: MaxPartNumber}
+	for _, p := range parts {
+		res.Parts = append(res.Parts, partXML{
+			PartNumber:   p.PartNumber,
+			LastModified: p.CreatedAt.UTC().Format(timeFormat),
+			ETag:         p.Etag,
+			Size:         p.SizeBytes,
+		})
+	}
+	writeXML(c.w, http.StatusOK, res)
+	return nil
+}
+
+func (c *call) listUploads() error {
+	uploads, err := c.s.ListMultipartUploads(c.r.Context(), c.userID)
+	if err != nil {
+		return err
+	}
+	res := listMultipartUploadsResult{Bucket: Bucket}
+	for _, u := range uploads {
+		res.Uploads = append(res.Uploads, uploadXML{Key: u.ObjectKey, UploadID: u.ID.String(), Initiated: u.CreatedAt.UTC().Format(timeFormat)})
+	}
+	writeXML(c.w, http.StatusOK, res)
+	return nil
+}
+
+// readXML decodes the request body, reading it to the end so its payload
+// signature is checked before anything is acted on.
+func (c *call) readXML(v interface{}) error {
+	data, err := io.ReadAll(io.LimitReader(c.body, maxXMLBody+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxXMLBody {
+		return fmt.Errorf("%w: body too large", ErrMalformedXML)
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return ErrMalformedXML
+	}
+	return nil
+}
+
+func owner(u database.User) ownerXML {
+	return ownerXML{ID: strconv.Itoa(int(u.ID)), DisplayName: u.Email}
+}
+
+func requestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		log.Printf("encoding s3 response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+// asError finds the S3 error behind err; anything else is an internal error.
+func asError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNoSuchKey
+	}
+	return ErrInternal
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	e := asError(err)
+	message := err.Error()
+	if e == ErrInternal {
+		log.Printf("s3 %s %s: %v", r.Method, r.URL.Path, err)
+		message = e.Message
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(e.Status)
+		return
+	}
+	writeXML(w, e.Status, errorXML{
+		Code:      e.Code,
+		Message:   message,
+		Resource:  r.URL.Path,
+		RequestID: w.Header().Get("x-amz-request-id"),
+	})
+}
+
+type KeyServiceInterface interface {
+	CreateAccessKey(ctx context.Context, userID int32) (database.S3AccessKey, error)
+	ListAccessKeys(ctx context.Context, userID int32) ([]database.S3AccessKey, error)
+	DeleteAccessKey(ctx context.Context, userID int32, id uuid.UUID) error
+}
+
+type AccessKeyResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	AccessKeyID string     `json:"access_key_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	// Only set in the response that creates the key
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	Bucket          string `json:"bucket"`
+	Endpoint        string `json:"endpoint"`
+}
+
+func NewAccessKeyResponse(k database.S3AccessKey) AccessKeyResponse {
+	res := AccessKeyResponse{ID: k.ID, AccessKeyID: k.AccessKeyID, CreatedAt: k.CreatedAt, Bucket: Bucket, Endpoint: Prefix}
+	if k.LastUsedAt.Valid {
+		res.LastUsedAt = &k.LastUsedAt.Time
+	}
+	return res
+}
+
+func CreateAccessKeyHandler(service KeyServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		key, err := service.CreateAccessKey(r.Context(), userID)
+		if err != nil {
+			if errors.Is(err, ErrKeyLimit) {
+				util.RespondWithError(w, http.StatusConflict, err.Error())
+				return
+			}
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to create access key")
+			return
+		}
+
+		res := NewAccessKeyResponse(key)
+		res.SecretAccessKey = key.SecretKey
+		util.RespondWithJSON(w, http.StatusCreated, res)
+	}
+}
+
+func ListAccessKeysHandler(service KeyServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		keys, err := service.ListAccessKeys(r.Context(), userID)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to list access keys")
+			return
+		}
+
+		res := make([]AccessKeyResponse, 0, len(keys))
+		for _, k := range keys {
+			res = append(res, NewAccessKeyResponse(k))
+		}
+		util.RespondWithJSON(w, http.StatusOK, res)
+	}
+}
+
+func DeleteAccessKeyHandler(service KeyServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid access key ID")
+			return
+		}
+
+		if err := service.DeleteAccessKey(r.Context(), userID, id); err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				util.RespondWithError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to delete access key")
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Access key deleted"})
+	}
+}
+
+type errorXML struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+type ownerXML struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type bucketXML struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name    `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Owner   ownerXML    `xml:"Owner"`
+	Buckets []bucketXML `xml:"Buckets>Bucket"`
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint"`
+}
+
+type versioningConfiguration struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ VersioningConfiguration"`
+}
+
+type objectXML struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefixXML struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResultV1 struct {
+	XMLName        xml.Name          `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name           string            `xml:"Name"`
+	Prefix         string            `xml:"Prefix"`
+	Marker         string            `xml:"Marker"`
+	NextMarker     string            `xml:"NextMarker,omitempty"`
+	Delimiter      string            `xml:"Delimiter,omitempty"`
+	MaxKeys        int               `xml:"MaxKeys"`
+	EncodingType   string            `xml:"EncodingType,omitempty"`
+	IsTruncated    bool              `xml:"IsTruncated"`
+	Contents       []objectXML       `xml:"Contents"`
+	CommonPrefixes []commonPrefixXML `xml:"CommonPrefixes"`
+}
+
+type listBucketResultV2 struct {
+	XMLName               xml.Name          `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string            `xml:"Name"`
+	Prefix                string            `xml:"Prefix"`
+	Delimiter             string            `xml:"Delimiter,omitempty"`
+	MaxKeys               int               `xml:"MaxKeys"`
+	EncodingType          string            `xml:"EncodingType,omitempty"`
+	KeyCount              int               `xml:"KeyCount"`
+	IsTruncated           bool              `xml:"IsTruncated"`
+	ContinuationToken     string            `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string            `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string            `xml:"StartAfter,omitempty"`
+	Contents              []objectXML       `xml:"Contents"`
+	CommonPrefixes        []commonPrefixXML `xml:"CommonPrefixes"`
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
+type deleteRequest struct {
+	Quiet   bool `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deletedXML struct {
+	Key string `xml:"Key"`
+}
+
+type deleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name      `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+	Deleted []deletedXML  `xml:"Deleted"`
+	Errors  []deleteError `xml:"Error"`
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int32  `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+type partXML struct {
+	PartNumber   int32  `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+}
+
+type listPartsResult struct {
+	XMLName     xml.Name  `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListPartsResult"`
+	Bucket      string    `xml:"Bucket"`
+	Key         string    `xml:"Key"`
+	UploadID    string    `xml:"UploadId"`
+	MaxParts    int       `xml:"MaxParts"`
+	IsTruncated bool      `xml:"IsTruncated"`
+	Parts       []partXML `xml:"Part"`
+}
+
+type uploadXML struct {
+	Key       string `xml:"Key"`
+	UploadID  string `xml:"UploadId"`
+	Initiated string `xml:"Initiated"`
+}
+
+type listMultipartUploadsResult struct {
+	XMLName     xml.Name    `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListMultipartUploadsResult"`
+	Bucket      string      `xml:"Bucket"`
+	IsTruncated bool        `xml:"IsTruncated"`
+	Uploads     []uploadXML `xml:"Upload"`
+}
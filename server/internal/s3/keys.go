@@ -0,0 +1,76 @@
+package s3
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+// MaxAccessKeys bounds how many access keys one user may hold.
+const MaxAccessKeys = 10
+
+// accessKeyPrefix starts every access key ID, the way AWS IDs start "AKIA".
+const accessKeyPrefix = "CSAK"
+
+var (
+	ErrKeyNotFound = errors.New("access key not found")
+	ErrKeyLimit    = errors.New("too many access keys")
+)
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+	return b, nil
+}
+
+// CreateAccessKey issues a new access key ID and secret.
+func (s *Service) CreateAccessKey(ctx context.Context, userID int32) (database.S3AccessKey, error) {
+	existing, err := s.queries.ListS3AccessKeys(ctx, userID)
+	if err != nil {
+		return database.S3AccessKey{}, fmt.Errorf("listing access keys: %w", err)
+	}
+	if len(existing) >= MaxAccessKeys {
+		return database.S3AccessKey{}, ErrKeyLimit
+	}
+
+	id, err := randomBytes(10)
+	if err != nil {
+		return database.S3AccessKey{}, err
+	}
+	secret, err := randomBytes(30)
+	if err != nil {
+		return database.S3AccessKey{}, err
+	}
+	key, err := s.queries.CreateS3AccessKey(ctx, database.CreateS3AccessKeyParams{
+		UserID:      userID,
+		AccessKeyID: accessKeyPrefix + base32.StdEncoding.EncodeToString(id),
+		SecretKey:   base64.StdEncoding.EncodeToString(secret),
+	})
+	if err != nil {
+		return database.S3AccessKey{}, fmt.Errorf("creating access key: %w", err)
+	}
+	return key, nil
+}
+
+func (s *Service) ListAccessKeys(ctx context.Context, userID int32) ([]database.S3AccessKey, error) {
+	return s.queries.ListS3AccessKeys(ctx, userID)
+}
+
+func (s *Service) DeleteAccessKey(ctx context.Context, userID int32, id uuid.UUID) error {
+	rows, err := s.queries.DeleteS3AccessKey(ctx, database.DeleteS3AccessKeyParams{ID: id, UserID: userID})
+	if err != nil {
+		return fmt.Errorf("deleting access key: %w", err)
+	}
+	if rows == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
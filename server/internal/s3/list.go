@@ -0,0 +1,168 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+)
+
+// MaxListKeys is the most keys one listing returns, as in S3.
+const MaxListKeys = 1000
+
+type ListParams struct {
+	Prefix    string
+	Delimiter string
+	// After lists only keys that sort after it: the start-after key or the
+	// decoded continuation token
+	After   string
+	MaxKeys int
+}
+
+type ListResult struct {
+	Objects        []Object
+	CommonPrefixes []string
+	IsTruncated    bool
+	// Next is the last key or prefix returned, to continue after
+	Next string
+}
+
+var errListFull = errors.New("listing is full")
+
+// ListObjects lists keys in order, as S3 does, by walking the tree with
+// each folder's children sorted as their keys would be. Folders become
+// common prefixes when the delimiter is "/", without being walked.
+func (s *Service) ListObjects(ctx context.Context, userID int32, params ListParams) (ListResult, error) {
+	var result ListResult
+	if params.MaxKeys <= 0 {
+		return result, nil
+	}
+	params.MaxKeys = min(params.MaxKeys, MaxListKeys)
+
+	// Start at the deepest folder the prefix names
+	dirKey := params.Prefix[:strings.LastIndex(params.Prefix, "/")+1]
+	dirPath := "/" + strings.TrimSuffix(dirKey, "/")
+	if dirKey != "" {
+		if _, _, err := objectPath(dirKey); err != nil {
+			return result, nil
+		}
+	}
+
+	l := &lister{s: s, ctx: ctx, userID: userID, params: params, result: &result}
+	err := l.walk(dirPath, dirKey)
+	if errors.Is(err, paths.ErrNotFound) || errors.Is(err, paths.ErrNotAFolder) || errors.Is(err, errListFull) {
+		err = nil
+	}
+	return result, err
+}
+
+type lister struct {
+	s      *Service
+	ctx    context.Context
+	userID int32
+	params ListParams
+	result *ListResult
+}
+
+// add appends an object or common prefix, reporting errListFull once the
+// page is complete and another item is waiting.
+func (l *lister) add(key string, obj *Object) error {
+	r := l.result
+	if len(r.Objects)+len(r.CommonPrefixes) == l.params.MaxKeys {
+		r.IsTruncated = true
+		return errListFull
+	}
+	if obj != nil {
+		r.Objects = append(r.Objects, *obj)
+	} else {
+		r.CommonPrefixes = append(r.CommonPrefixes, key)
+	}
+	r.Next = key
+	return nil
+}
+
+func (l *lister) walk(dirPath, dirKey string) error {
+	_, children, err := l.s.paths.List(l.ctx, l.userID, dirPath)
+	if err != nil {
+		return err
+	}
+	keyOf := func(e paths.Entry) string {
+		if e.Kind == paths.KindFolder {
+			return dirKey + e.Name + "/"
+		}
+		return dirKey + e.Name
+	}
+	sort.Slice(children, func(i, j int) bool { return keyOf(children[i]) < keyOf(children[j]) })
+
+	prefix, after := l.params.Prefix, l.params.After
+	for _, child := range children {
+		key := keyOf(child)
+
+		if child.Kind == paths.KindFolder {
+			inPrefix := strings.HasPrefix(key, prefix)
+			if !inPrefix && !strings.HasPrefix(prefix, key) {
+				continue
+			}
+			// Every key under the folder sorts before After
+			if key <= after && !strings.HasPrefix(after, key) {
+				continue
+			}
+			if l.params.Delimiter == "/" && inPrefix && len(key) > len(prefix) {
+				if key > after {
+					if err := l.add(key, nil); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if err := l.walk(child.Path, key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if d := l.params.Delimiter; d != "" {
+			if i := strings.Index(key[len(prefix):], d); i >= 0 {
+				common := key[:len(prefix)+i+len(d)]
+				if common > after && !l.seen(common) {
+					if err := l.add(common, nil); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+		}
+		if key <= after {
+			continue
+		}
+		obj := Object{Key: key, LastModified: entryTime(child), ETag: entryETag(child)}
+		if child.SizeBytes != nil {
+			obj.Size = *child.SizeBytes
+		}
+		if err := l.add(key, &obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seen reports whether a common prefix was the last one added; keys sharing
+// a prefix are walked one after another.
+func (l *lister) seen(common string) bool {
+	cps := l.result.CommonPrefixes
+	return len(cps) > 0 && cps[len(cps)-1] == common
+}
+
+// entryETag matches etag for a listed file, whose content hash comes along
+// with it.
+func entryETag(e paths.Entry) string {
+	if e.SHA256 != "" {
+		return `"` + e.SHA256 + `"`
+	}
+	return `"` + e.ID.String() + `"`
+}
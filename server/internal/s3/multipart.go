@@ -0,0 +1,249 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxPartNumber is the highest part number, as in S3
+	MaxPartNumber = 10000
+	// StaleUploadAge is how long an unfinished multipart upload is kept
+	StaleUploadAge = 7 * 24 * time.Hour
+)
+
+// CompletedPart is a part as the client lists it to complete an upload.
+type CompletedPart struct {
+	PartNumber int32
+	ETag       string
+}
+
+func partName(number int32) string {
+	return fmt.Sprintf("part-%05d", number)
+}
+
+// upload fetches one of the user's uploads, checking it is for key.
+func (s *Service) upload(ctx context.Context, userID int32, uploadID, key string) (database.S3MultipartUpload, error) {
+	id, err := uuid.Parse(uploadID)
+	if err != nil {
+		return database.S3MultipartUpload{}, ErrNoSuchUpload
+	}
+	u, err := s.queries.GetMultipartUpload(ctx, database.GetMultipartUploadParams{ID: id, UserID: userID})
+	if isNoRows(err) || (err == nil && u.ObjectKey != key) {
+		return database.S3MultipartUpload{}, ErrNoSuchUpload
+	}
+	if err != nil {
+		return database.S3MultipartUpload{}, fmt.Errorf("fetching upload: %w", err)
+	}
+	return u, nil
+}
+
+// CreateMultipartUpload starts an upload to key. Uploads the user abandoned
+// long ago are cleared out on the way.
+func (s *Service) CreateMultipartUpload(ctx context.Context, userID int32, key string) (database.S3MultipartUpload, error) {
+	if _, folder, err := objectPath(key); err != nil {
+		return database.S3MultipartUpload{}, err
+	} else if folder {
+		return database.S3MultipartUpload{}, ErrInvalidKey
+	}
+
+	stale, err := s.queries.ListStaleMultipartUploads(ctx, database.ListStaleMultipartUploadsParams{
+		UserID:    userID,
+		CreatedAt: s.now().Add(-StaleUploadAge),
+	})
+	if err != nil {
+		log.Printf("listing stale uploads for user %d: %v", userID, err)
+	}
+	for _, u := range stale {
+		if err := s.discard(ctx, u); err != nil {
+			log.Printf("discarding stale upload %s: %v", u.ID, err)
+		}
+	}
+
+	u, err := s.queries.CreateMultipartUpload(ctx, database.CreateMultipartUploadParams{UserID: userID, ObjectKey: key})
+	if err != nil {
+		return database.S3MultipartUpload{}, fmt.Errorf("creating upload: %w", err)
+	}
+	return u, nil
+}
+
+// UploadPart stores one part. Parts don't count towards usage until the
+// upload is completed, but must fit alongside the upload's other parts.
+func (s *Service) UploadPart(ctx context.Context, userID int32, uploadID, key string, number int32, body io.Reader) (database.S3MultipartPart, error) {
+	if number < 1 || number > MaxPartNumber {
+		return database.S3MultipartPart{}, fmt.Errorf("%w: part number must be between 1 and %d", ErrInvalidArgument, MaxPartNumber)
+	}
+	u, err := s.upload(ctx, userID, uploadID, key)
+	if err != nil {
+		return database.S3MultipartPart{}, err
+	}
+
+	parts, err := s.queries.ListMultipartParts(ctx, u.ID)
+	if err != nil {
+		return database.S3MultipartPart{}, fmt.Errorf("listing parts: %w", err)
+	}
+	var pending int64
+	for _, p := range parts {
+		if p.PartNumber != number {
+			pending += p.SizeBytes
+		}
+	}
+
+	tmp, size, err := s.spoolUpload(ctx, userID, key, pending, body)
+	if err != nil {
+		return database.S3MultipartPart{}, err
+	}
+	defer removeSpool(tmp)
+
+	if err := s.CheckUpload(ctx, userID, key, pending+size); err != nil {
+		return database.S3MultipartPart{}, err
+	}
+
+	sum := md5.New()
+	if err := s.parts.SaveDerived(userID, u.ID, partName(number), io.TeeReader(tmp, sum)); err != nil {
+		return database.S3MultipartPart{}, fmt.Errorf("saving part: %w", err)
+	}
+	part, err := s.queries.PutMultipartPart(ctx, database.PutMultipartPartParams{
+		UploadID:   u.ID,
+		PartNumber: number,
+		Etag:       `"` + hex.EncodeToString(sum.Sum(nil)) + `"`,
+		SizeBytes:  size,
+	})
+	if err != nil {
+		return database.S3MultipartPart{}, fmt.Errorf("recording part: %w", err)
+	}
+	return part, nil
+}
+
+// ListParts lists the parts uploaded so far.
+func (s *Service) ListParts(ctx context.Context, userID int32, uploadID, key string) ([]database.S3MultipartPart, error) {
+	u, err := s.upload(ctx, userID, uploadID, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.queries.ListMultipartParts(ctx, u.ID)
+}
+
+func (s *Service) ListMultipartUploads(ctx context.Context, userID int32) ([]database.S3MultipartUpload, error) {
+	return s.queries.ListMultipartUploads(ctx, userID)
+}
+
+// CompleteMultipartUpload joins the listed parts into the object at key and
+// ends the upload. Parts must be listed in ascending order with the ETags
+// they were given; parts left out are discarded.
+func (s *Service) CompleteMultipartUpload(ctx context.Context, userID int32, uploadID, key string, listed []CompletedPart) (Object, error) {
+	u, err := s.upload(ctx, userID, uploadID, key)
+	if err != nil {
+		return Object{}, err
+	}
+	if len(listed) == 0 {
+		return Object{}, fmt.Errorf("%w: at least one part is required", ErrMalformedXML)
+	}
+	stored, err := s.queries.ListMultipartParts(ctx, u.ID)
+	if err != nil {
+		return Object{}, fmt.Errorf("listing parts: %w", err)
+	}
+	byNumber := map[int32]database.S3MultipartPart{}
+	for _, p := range stored {
+		byNumber[p.PartNumber] = p
+	}
+
+	var size int64
+	var numbers []int32
+	for i, l := range listed {
+		if i > 0 && l.PartNumber <= listed[i-1].PartNumber {
+			return Object{}, ErrInvalidPartOrder
+		}
+		p, ok := byNumber[l.PartNumber]
+		if !ok || strings.Trim(p.Etag, `"`) != strings.Trim(l.ETag, `"`) {
+			return Object{}, fmt.Errorf("%w: part %d", ErrInvalidPart, l.PartNumber)
+		}
+		size += p.SizeBytes
+		numbers = append(numbers, l.PartNumber)
+	}
+
+	p, _, err := objectPath(key)
+	if err != nil {
+		return Object{}, err
+	}
+	if err := s.CheckUpload(ctx, userID, key, size); err != nil {
+		return Object{}, err
+	}
+	body := &partsReader{s: s, userID: userID, uploadID: u.ID, numbers: numbers}
+	defer body.Close()
+	if _, err := s.paths.Upload(ctx, userID, p, size, body); err != nil {
+		return Object{}, err
+	}
+
+	if err := s.discard(ctx, u); err != nil {
+		log.Printf("discarding completed upload %s: %v", u.ID, err)
+	}
+	return s.HeadObject(ctx, userID, key)
+}
+
+// AbortMultipartUpload ends an upload, discarding its parts.
+func (s *Service) AbortMultipartUpload(ctx context.Context, userID int32, uploadID, key string) error {
+	u, err := s.upload(ctx, userID, uploadID, key)
+	if err != nil {
+		return err
+	}
+	return s.discard(ctx, u)
+}
+
+func (s *Service) discard(ctx context.Context, u database.S3MultipartUpload) error {
+	if _, err := s.queries.DeleteMultipartUpload(ctx, database.DeleteMultipartUploadParams{ID: u.ID, UserID: u.UserID}); err != nil {
+		return fmt.Errorf("deleting upload: %w", err)
+	}
+	return s.parts.DeleteDerived(u.UserID, u.ID)
+}
+
+// partsReader reads parts one after another, opening each only when it is
+// reached so a large upload doesn't hold every part open at once.
+type partsReader struct {
+	s        *Service
+	userID   int32
+	uploadID uuid.UUID
+	numbers  []int32
+	current  io.ReadCloser
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.numbers) == 0 {
+				return 0, io.EOF
+			}
+			f, err := r.s.parts.OpenDerived(r.userID, r.uploadID, partName(r.numbers[0]))
+			if err != nil {
+				return 0, err
+			}
+			r.current, r.numbers = f, r.numbers[1:]
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *partsReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
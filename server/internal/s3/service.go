@@ -0,0 +1,426 @@
+// Package s3 is an S3-compatible front end to each user's tree, for tools
+// that only speak S3. Every user has one bucket whose keys are paths in
+// their tree, and every operation goes through the path, file and folder
+// services, so quotas work exactly as they do for the REST API.
+package s3
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Prefix is where the gateway is mounted; requests are path-style, as in
+// /s3/<bucket>/<key>.
+const Prefix = "/s3"
+
+// MaxObjectSize caps a single PUT or upload part, as in S3.
+const MaxObjectSize = 5 << 30
+
+// Bucket is the name of every user's only bucket. Access keys tell users
+// apart, so the name doesn't need to.
+const Bucket = "storage"
+
+type Queries interface {
+	quota.Queries
+	GetUserByID(ctx context.Context, id int32) (database.User, error)
+
+	CreateS3AccessKey(ctx context.Context, arg database.CreateS3AccessKeyParams) (database.S3AccessKey, error)
+	ListS3AccessKeys(ctx context.Context, userID int32) ([]database.S3AccessKey, error)
+	GetS3AccessKey(ctx context.Context, accessKeyID string) (database.S3AccessKey, error)
+	TouchS3AccessKey(ctx context.Context, id uuid.UUID) (int64, error)
+	DeleteS3AccessKey(ctx context.Context, arg database.DeleteS3AccessKeyParams) (int64, error)
+
+	CreateMultipartUpload(ctx context.Context, arg database.CreateMultipartUploadParams) (database.S3MultipartUpload, error)
+	GetMultipartUpload(ctx context.Context, arg database.GetMultipartUploadParams) (database.S3MultipartUpload, error)
+	ListMultipartUploads(ctx context.Context, userID int32) ([]database.S3MultipartUpload, error)
+	ListStaleMultipartUploads(ctx context.Context, arg database.ListStaleMultipartUploadsParams) ([]database.S3MultipartUpload, error)
+	DeleteMultipartUpload(ctx context.Context, arg database.DeleteMultipartUploadParams) (int64, error)
+	PutMultipartPart(ctx context.Context, arg database.PutMultipartPartParams) (database.S3MultipartPart, error)
+	ListMultipartParts(ctx context.Context, uploadID uuid.UUID) ([]database.S3MultipartPart, error)
+}
+
+type PathService interface {
+	Resolve(ctx context.Context, userID int32, p string) (paths.Entry, error)
+	List(ctx context.Context, userID int32, p string) (paths.Entry, []paths.Entry, error)
+	Upload(ctx context.Context, userID int32, p string, sizeBytes int64, content io.Reader) (paths.Entry, error)
+}
+
+type FileService interface {
+	GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error)
+	GetFileForDownload(ctx context.Context, fileID uuid.UUID, userID int32) (database.File, io.ReadCloser, error)
+	DeleteFile(ctx context.Context, fileID uuid.UUID, userID int32) error
+}
+
+type FolderService interface {
+	CreateFolder(ctx context.Context, userID int32, name string, parentID uuid.NullUUID) (database.Folder, error)
+	DeleteFolder(ctx context.Context, folderID uuid.UUID, userID int32) error
+}
+
+type Service struct {
+	queries Queries
+	paths   PathService
+	files   FileService
+	folders FolderService
+	// Multipart parts are kept as derived files of their upload, outside
+	// the user's tree
+	parts storage.DerivedStore
+	now   func() time.Time
+}
+
+func NewService(q Queries, p PathService, files FileService, folders FolderService, parts storage.DerivedStore) *Service {
+	return &Service{queries: q, paths: p, files: files, folders: folders, parts: parts, now: time.Now}
+}
+
+// SetClock replaces the clock requests are checked against.
+func (s *Service) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Owner is the user whose bucket it is.
+func (s *Service) Owner(ctx context.Context, userID int32) (database.User, error) {
+	return s.queries.GetUserByID(ctx, userID)
+}
+
+// Object describes a stored object.
+type Object struct {
+	Key          string
+	Size         int64
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+	IsFolder     bool
+}
+
+// objectPath maps a key onto a path in the user's tree. A trailing slash
+// names a folder, as S3 tools use "dir/" markers for them. Keys that a path
+// can't represent faithfully, with empty, "." or ".." segments, are refused
+// rather than silently aliased to another key.
+func objectPath(key string) (string, bool, error) {
+	folder := strings.HasSuffix(key, "/")
+	trimmed := strings.TrimSuffix(key, "/")
+	if trimmed == "" {
+		return "", false, ErrInvalidKey
+	}
+	for _, segment := range strings.Split(trimmed, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", false, ErrInvalidKey
+		}
+	}
+	return "/" + trimmed, folder, nil
+}
+
+// etag is the entity tag of a stored file: its content hash when known.
+func etag(f database.File) string {
+	if f.Sha256.Valid {
+		return `"` + f.Sha256.String + `"`
+	}
+	return `"` + f.ID.String() + `"`
+}
+
+func entryTime(e paths.Entry) time.Time {
+	switch {
+	case e.UpdatedAt != nil:
+		return *e.UpdatedAt
+	case e.CreatedAt != nil:
+		return *e.CreatedAt
+	}
+	return time.Unix(0, 0).UTC()
+}
+
+func fileTime(f database.File) time.Time {
+	switch {
+	case f.UpdatedAt.Valid:
+		return f.UpdatedAt.Time
+	case f.CreatedAt.Valid:
+		return f.CreatedAt.Time
+	}
+	return time.Unix(0, 0).UTC()
+}
+
+func fileObject(key string, f database.File) Object {
+	return Object{
+		Key:          key,
+		Size:         f.SizeBytes,
+		ETag:         etag(f),
+		ContentType:  f.MimeType.String,
+		LastModified: fileTime(f),
+	}
+}
+
+// resolve finds the entry a key names, reporting a missing one as
+// ErrNoSuchKey.
+func (s *Service) resolve(ctx context.Context, userID int32, key string) (paths.Entry, bool, error) {
+	p, folder, err := objectPath(key)
+	if err != nil {
+		return paths.Entry{}, false, err
+	}
+	e, err := s.paths.Resolve(ctx, userID, p)
+	if errors.Is(err, paths.ErrNotFound) || errors.Is(err, paths.ErrInvalidPath) {
+		return paths.Entry{}, false, ErrNoSuchKey
+	}
+	if err != nil {
+		return paths.Entry{}, false, err
+	}
+	if folder != (e.Kind == paths.KindFolder) {
+		return paths.Entry{}, false, ErrNoSuchKey
+	}
+	return e, folder, nil
+}
+
+func folderObject(key string, e paths.Entry) Object {
+	return Object{Key: key, ETag: `"` + e.ID.String() + `"`, ContentType: "application/x-directory", LastModified: entryTime(e), IsFolder: true}
+}
+
+// GetObject opens an object. Folders read as empty "dir/" markers.
+func (s *Service) GetObject(ctx context.Context, userID int32, key string) (Object, io.ReadCloser, error) {
+	e, folder, err := s.resolve(ctx, userID, key)
+	if err != nil {
+		return Object{}, nil, err
+	}
+	if folder {
+		return folderObject(key, e), io.NopCloser(strings.NewReader("")), nil
+	}
+	f, rc, err := s.files.GetFileForDownload(ctx, *e.ID, userID)
+	if err != nil {
+		return Object{}, nil, err
+	}
+	return fileObject(key, f), rc, nil
+}
+
+// HeadObject describes an object without opening it.
+func (s *Service) HeadObject(ctx context.Context, userID int32, key string) (Object, error) {
+	e, folder, err := s.resolve(ctx, userID, key)
+	if err != nil {
+		return Object{}, err
+	}
+	if folder {
+		return folderObject(key, e), nil
+	}
+	f, err := s.files.GetFileByID(ctx, *e.ID)
+	if err != nil {
+		return Object{}, err
+	}
+	return fileObject(key, f), nil
+}
+
+// CheckUpload fails with ErrQuotaExceeded when storing sizeBytes at key would
+// take the user past their quota, allowing for the file it replaces.
+func (s *Service) CheckUpload(ctx context.Context, userID int32, key string, sizeBytes int64) error {
+	var freed int64
+	if p, folder, err := objectPath(key); err == nil && !folder {
+		existing, err := s.paths.Resolve(ctx, userID, p)
+		switch {
+		case err == nil && existing.SizeBytes != nil:
+			freed = *existing.SizeBytes
+		case err != nil && !errors.Is(err, paths.ErrNotFound) && !errors.Is(err, paths.ErrInvalidPath):
+			return err
+		}
+	}
+	if err := quota.Check(ctx, s.queries, userID, sizeBytes-freed); err != nil {
+		if errors.Is(err, quota.ErrExceeded) {
+			return fmt.Errorf("%w: %v", ErrQuotaExceeded, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// PutObject stores body at key. The body is spooled first, so a payload
+// that fails its signature check, or won't fit, never replaces what is
+// already stored. A "dir/" key with an empty body creates the folder.
+func (s *Service) PutObject(ctx context.Context, userID int32, key string, body io.Reader) (Object, error) {
+	p, folder, err := objectPath(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	// A folder marker has no content; anything else may take what is left
+	// of the quota
+	var tmp *os.File
+	var size int64
+	if folder {
+		tmp, size, err = spoolAtMost(body, 0, fmt.Errorf("%w: a folder marker can't have content", ErrInvalidRequest))
+	} else {
+		tmp, size, err = s.spoolUpload(ctx, userID, key, 0, body)
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	defer removeSpool(tmp)
+
+	if folder {
+		if size != 0 {
+			return Object{}, fmt.Errorf("%w: a folder marker can't have content", ErrInvalidRequest)
+		}
+		if err := s.mkdirAll(ctx, userID, p); err != nil {
+			return Object{}, err
+		}
+		return s.HeadObject(ctx, userID, key)
+	}
+
+	if err := s.CheckUpload(ctx, userID, key, size); err != nil {
+		return Object{}, err
+	}
+	if _, err := s.paths.Upload(ctx, userID, p, size, tmp); err != nil {
+		if errors.Is(err, paths.ErrNotAFile) {
+			return Object{}, fmt.Errorf("%w: a folder already has that name", ErrInvalidRequest)
+		}
+		return Object{}, err
+	}
+	return s.HeadObject(ctx, userID, key)
+}
+
+// spoolUpload spools an upload to key, giving up as soon as the body
+// outgrows MaxObjectSize or the room left in the quota, allowing for the file
+// it replaces and pending bytes already promised elsewhere. Nothing past
+// that point is written to disk.
+func (s *Service) spoolUpload(ctx context.Context, userID int32, key string, pending int64, body io.Reader) (*os.File, int64, error) {
+	usage, err := s.queries.GetStorageUsage(ctx, userID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("fetching storage usage: %w", err)
+	}
+	var freed int64
+	if p, folder, err := objectPath(key); err == nil && !folder {
+		if existing, err := s.paths.Resolve(ctx, userID, p); err == nil && existing.SizeBytes != nil {
+			freed = *existing.SizeBytes
+		}
+	}
+	room := max(usage.StorageQuota-usage.UsedBytes, 0) + freed - pending
+
+	if room < MaxObjectSize {
+		return spoolAtMost(body, max(room, 0), fmt.Errorf("%w: %d of %d bytes used", ErrQuotaExceeded, usage.UsedBytes, usage.StorageQuota))
+	}
+	return spoolAtMost(body, MaxObjectSize, ErrEntityTooLarge)
+}
+
+// spoolAtMost spools body, failing with tooLarge once it passes limit bytes.
+func spoolAtMost(body io.Reader, limit int64, tooLarge error) (*os.File, int64, error) {
+	tmp, size, err := spool(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if size > limit {
+		removeSpool(tmp)
+		return nil, 0, tooLarge
+	}
+	return tmp, size, nil
+}
+
+// spool copies body to a temporary file, rewound and ready to read.
+func spool(body io.Reader) (*os.File, int64, error) {
+	tmp, err := os.CreateTemp("", "s3-*")
+	if err != nil {
+		return nil, 0, fmt.Errorf("buffering upload: %w", err)
+	}
+	size, err := io.Copy(tmp, body)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeSpool(tmp)
+		return nil, 0, err
+	}
+	return tmp, size, nil
+}
+
+func removeSpool(tmp *os.File) {
+	tmp.Close()
+	os.Remove(tmp.Name())
+}
+
+// mkdirAll creates the folder at p and any missing parents.
+func (s *Service) mkdirAll(ctx context.Context, userID int32, p string) error {
+	segments, err := paths.Split(p)
+	if err != nil {
+		return ErrInvalidKey
+	}
+	var parent uuid.NullUUID
+	current := ""
+	for _, segment := range segments {
+		current += "/" + segment
+		e, err := s.paths.Resolve(ctx, userID, current)
+		switch {
+		case err == nil && e.Kind != paths.KindFolder:
+			return fmt.Errorf("%w: %s is a file", ErrInvalidRequest, current)
+		case err == nil:
+			parent = uuid.NullUUID{UUID: *e.ID, Valid: true}
+		case errors.Is(err, paths.ErrNotFound):
+			created, err := s.folders.CreateFolder(ctx, userID, segment, parent)
+			if err != nil {
+				return fmt.Errorf("creating folder %s: %w", current, err)
+			}
+			parent = uuid.NullUUID{UUID: created.ID, Valid: true}
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyObject copies one key to another by uploading the source's content
+// again, so the copy is hashed, sniffed and counted like any upload.
+func (s *Service) CopyObject(ctx context.Context, userID int32, srcKey, dstKey string) (Object, error) {
+	if srcKey == dstKey {
+		return Object{}, fmt.Errorf("%w: an object can't be copied onto itself", ErrInvalidRequest)
+	}
+	src, rc, err := s.GetObject(ctx, userID, srcKey)
+	if err != nil {
+		return Object{}, err
+	}
+	defer rc.Close()
+	if src.IsFolder {
+		return Object{}, fmt.Errorf("%w: folders can't be copied", ErrInvalidRequest)
+	}
+	if _, folder, err := objectPath(dstKey); err != nil {
+		return Object{}, err
+	} else if folder {
+		return Object{}, ErrInvalidKey
+	}
+	return s.PutObject(ctx, userID, dstKey, rc)
+}
+
+// DeleteObject removes the object at key. As in S3, deleting a key that
+// doesn't exist succeeds. A "dir/" marker only goes if the folder is empty,
+// since in S3 removing a marker never removes the keys under it.
+func (s *Service) DeleteObject(ctx context.Context, userID int32, key string) error {
+	e, folder, err := s.resolve(ctx, userID, key)
+	if errors.Is(err, ErrNoSuchKey) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !folder {
+		return s.files.DeleteFile(ctx, *e.ID, userID)
+	}
+	_, children, err := s.paths.List(ctx, userID, e.Path)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		return nil
+	}
+	return s.folders.DeleteFolder(ctx, *e.ID, userID)
+}
+
+// touch records that an access key was used; failing to is not fatal.
+func (s *Service) touch(ctx context.Context, id uuid.UUID) {
+	_, _ = s.queries.TouchS3AccessKey(ctx, id)
+}
+
+func isNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
@@ -0,0 +1,433 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm      = "AWS4-HMAC-SHA256"
+	chunkAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+	amzTimeFormat  = "20060102T150405Z"
+
+	unsignedPayload          = "UNSIGNED-PAYLOAD"
+	streamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	// maxSkew is how far a request's time may be from ours, as in S3
+	maxSkew = 15 * time.Minute
+	// maxPresignExpiry is the longest a presigned URL may be valid for
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+var emptyHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+// signature is what a request says about how it was signed.
+type signature struct {
+	accessKeyID string
+	date        string
+	region      string
+	service     string
+
+	signedHeaders []string
+	signature     string
+	amzDate       string
+	time          time.Time
+	expires       time.Duration
+	payloadHash   string
+	presigned     bool
+}
+
+func (sig signature) scope() string {
+	return sig.date + "/" + sig.region + "/" + sig.service + "/aws4_request"
+}
+
+// Authenticate checks a request's SigV4 signature, given in its
+// Authorization header or as a presigned URL, and returns the user it was
+// signed for. The body it returns checks the payload's signature or hash as
+// it is read and fails at the end if they don't match, so callers must read
+// it to the end before keeping anything.
+func (s *Service) Authenticate(r *http.Request) (int32, io.Reader, error) {
+	sig, err := parseSignature(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	now := s.now()
+	if sig.presigned {
+		if sig.time.Sub(now) > maxSkew {
+			return 0, nil, ErrRequestTimeTooSkewed
+		}
+		if now.After(sig.time.Add(sig.expires)) {
+			return 0, nil, ErrExpiredRequest
+		}
+	} else if d := now.Sub(sig.time); d > maxSkew || d < -maxSkew {
+		return 0, nil, ErrRequestTimeTooSkewed
+	}
+
+	key, err := s.queries.GetS3AccessKey(r.Context(), sig.accessKeyID)
+	if isNoRows(err) {
+		return 0, nil, ErrInvalidAccessKeyID
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("fetching access key: %w", err)
+	}
+	user, err := s.queries.GetUserByID(r.Context(), key.UserID)
+	if err != nil || user.IsDisabled {
+		return 0, nil, ErrAccessDenied
+	}
+
+	signingKey := deriveKey(key.SecretKey, sig)
+	stringToSign := strings.Join([]string{algorithm, sig.amzDate, sig.scope(), sha256Hex([]byte(canonicalRequest(r, sig)))}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(sig.signature)) {
+		return 0, nil, ErrSignatureMismatch
+	}
+	s.touch(r.Context(), key.ID)
+
+	switch sig.payloadHash {
+	case unsignedPayload:
+		return key.UserID, r.Body, nil
+	case streamingPayload, streamingUnsignedTrailer:
+		declared := int64(-1)
+		if v := r.Header.Get("X-Amz-Decoded-Content-Length"); v != "" {
+			if declared, err = strconv.ParseInt(v, 10, 64); err != nil || declared < 0 {
+				return 0, nil, fmt.Errorf("%w: invalid x-amz-decoded-content-length", ErrInvalidArgument)
+			}
+		}
+		cr := &chunkedReader{
+			r:        bufio.NewReader(r.Body),
+			declared: declared,
+			trailers: sig.payloadHash == streamingUnsignedTrailer,
+		}
+		if sig.payloadHash == streamingPayload {
+			cr.verify = &chunkVerifier{key: signingKey, amzDate: sig.amzDate, scope: sig.scope(), previous: sig.signature}
+		}
+		return key.UserID, cr, nil
+	}
+	if b, err := hex.DecodeString(sig.payloadHash); err != nil || len(b) != sha256.Size {
+		return 0, nil, fmt.Errorf("%w: unsupported x-amz-content-sha256 %q", ErrNotImplemented, sig.payloadHash)
+	}
+	return key.UserID, &hashReader{r: r.Body, h: sha256.New(), want: strings.ToLower(sig.payloadHash)}, nil
+}
+
+// parseSignature reads the signature from the Authorization header or,
+// failing that, the query of a presigned URL.
+func parseSignature(r *http.Request) (signature, error) {
+	var sig signature
+	var credential, signedHeaders string
+
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		rest, ok := strings.CutPrefix(auth, algorithm+" ")
+		if !ok {
+			return sig, fmt.Errorf("%w: only %s signatures are supported", ErrInvalidRequest, algorithm)
+		}
+		for _, field := range strings.Split(rest, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+			switch k {
+			case "Credential":
+				credential = v
+			case "SignedHeaders":
+				signedHeaders = v
+			case "Signature":
+				sig.signature = v
+			}
+		}
+		sig.amzDate = r.Header.Get("X-Amz-Date")
+		sig.payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+		if sig.payloadHash == "" {
+			return sig, fmt.Errorf("%w: missing x-amz-content-sha256", ErrInvalidRequest)
+		}
+	} else if q := r.URL.Query(); q.Get("X-Amz-Algorithm") != "" {
+		if q.Get("X-Amz-Algorithm") != algorithm {
+			return sig, fmt.Errorf("%w: only %s signatures are supported", ErrInvalidRequest, algorithm)
+		}
+		credential = q.Get("X-Amz-Credential")
+		signedHeaders = q.Get("X-Amz-SignedHeaders")
+		sig.signature = q.Get("X-Amz-Signature")
+		sig.amzDate = q.Get("X-Amz-Date")
+		sig.payloadHash = unsignedPayload
+		sig.presigned = true
+
+		seconds, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+		sig.expires = time.Duration(seconds) * time.Second
+		if err != nil || seconds <= 0 || sig.expires > maxPresignExpiry {
+			return sig, fmt.Errorf("%w: X-Amz-Expires must be between 1 and %d seconds", ErrInvalidArgument, int(maxPresignExpiry.Seconds()))
+		}
+	} else {
+		return sig, ErrAccessDenied
+	}
+
+	if credential == "" || signedHeaders == "" || sig.signature == "" {
+		return sig, ErrMalformedAuth
+	}
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[3] != "s3" || parts[4] != "aws4_request" {
+		return sig, fmt.Errorf("%w: bad credential scope", ErrMalformedAuth)
+	}
+	sig.accessKeyID, sig.date, sig.region, sig.service = parts[0], parts[1], parts[2], parts[3]
+
+	t, err := time.Parse(amzTimeFormat, sig.amzDate)
+	if err != nil {
+		return sig, fmt.Errorf("%w: missing or invalid x-amz-date", ErrMalformedAuth)
+	}
+	if sig.amzDate[:8] != sig.date {
+		return sig, fmt.Errorf("%w: credential date doesn't match x-amz-date", ErrMalformedAuth)
+	}
+	sig.time = t
+
+	sig.signedHeaders = strings.Split(signedHeaders, ";")
+	if !sort.StringsAreSorted(sig.signedHeaders) || !contains(sig.signedHeaders, "host") {
+		return sig, fmt.Errorf("%w: signed headers must be sorted and include host", ErrMalformedAuth)
+	}
+	return sig, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalRequest is the request as SigV4 hashes it.
+func canonicalRequest(r *http.Request, sig signature) string {
+	var headers strings.Builder
+	for _, name := range sig.signedHeaders {
+		value := r.Host
+		if name != "host" {
+			values := r.Header.Values(name)
+			for i, v := range values {
+				values[i] = strings.Join(strings.Fields(v), " ")
+			}
+			value = strings.Join(values, ",")
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		canonicalURI(r.URL.Path),
+		canonicalQuery(r.URL.Query(), sig.presigned),
+		headers.String(),
+		strings.Join(sig.signedHeaders, ";"),
+		sig.payloadHash,
+	}, "\n")
+}
+
+func canonicalURI(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return uriEncode(p, false)
+}
+
+func canonicalQuery(q url.Values, presigned bool) string {
+	var pairs []string
+	for k, values := range q {
+		if presigned && k == "X-Amz-Signature" {
+			continue
+		}
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode escapes everything but the unreserved characters, and slashes
+// unless asked to, as SigV4 requires.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func deriveKey(secret string, sig signature) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), sig.date)
+	k = hmacSHA256(k, sig.region)
+	k = hmacSHA256(k, sig.service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashReader fails at the end of a body that doesn't match its declared
+// SHA-256.
+type hashReader struct {
+	r    io.Reader
+	h    hash.Hash
+	want string
+}
+
+func (hr *hashReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	if errors.Is(err, io.EOF) && hex.EncodeToString(hr.h.Sum(nil)) != hr.want {
+		return n, ErrContentSHA256
+	}
+	return n, err
+}
+
+// chunkVerifier checks the signature chain of a streaming upload, where
+// each chunk is signed over the one before it, starting from the request's
+// own signature.
+type chunkVerifier struct {
+	key      []byte
+	amzDate  string
+	scope    string
+	previous string
+}
+
+func (v *chunkVerifier) check(chunkHash []byte, got string) error {
+	stringToSign := strings.Join([]string{chunkAlgorithm, v.amzDate, v.scope, v.previous, emptyHash, hex.EncodeToString(chunkHash)}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(v.key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(got)) {
+		return ErrSignatureMismatch
+	}
+	v.previous = expected
+	return nil
+}
+
+// chunkedReader decodes an aws-chunked body: chunks of
+// "<hex size>[;chunk-signature=<sig>]\r\n<data>\r\n" ending with an empty
+// chunk, optionally followed by trailing headers.
+type chunkedReader struct {
+	r        *bufio.Reader
+	verify   *chunkVerifier
+	trailers bool
+	declared int64
+
+	remaining int64
+	signature string
+	h         hash.Hash
+	total     int64
+	err       error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.remaining == 0 {
+		if c.err = c.nextChunk(); c.err != nil {
+			return 0, c.err
+		}
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.h.Write(p[:n])
+	c.remaining -= int64(n)
+	c.total += int64(n)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && c.remaining == 0 {
+		err = c.endChunk()
+	}
+	c.err = err
+	return n, err
+}
+
+// nextChunk reads a chunk header, or the final chunk and what follows it,
+// in which case it reports io.EOF.
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	sizeHex, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("%w: bad chunk header", ErrInvalidRequest)
+	}
+	c.signature = strings.TrimPrefix(ext, "chunk-signature=")
+	c.h = sha256.New()
+	if size > 0 {
+		c.remaining = size
+		return nil
+	}
+
+	if c.verify != nil {
+		if err := c.verify.check(c.h.Sum(nil), c.signature); err != nil {
+			return err
+		}
+	}
+	if c.trailers {
+		// Trailing checksums end with an empty line; TLS already protects them
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "" {
+				break
+			}
+		}
+	}
+	if c.declared >= 0 && c.total != c.declared {
+		return fmt.Errorf("%w: body doesn't match x-amz-decoded-content-length", ErrInvalidRequest)
+	}
+	return io.EOF
+}
+
+func (c *chunkedReader) endChunk() error {
+	crlf := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, crlf); err != nil || !bytes.Equal(crlf, []byte("\r\n")) {
+		return fmt.Errorf("%w: bad chunk terminator", ErrInvalidRequest)
+	}
+	if c.verify != nil {
+		return c.verify.check(c.h.Sum(nil), c.signature)
+	}
+	return nil
+}
+
+// readLine reads one CRLF-terminated line; a line longer than the buffer
+// fails rather than growing without bound.
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := c.r.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", fmt.Errorf("%w: bad chunk header", ErrInvalidRequest)
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
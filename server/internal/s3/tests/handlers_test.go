@@ -0,0 +1,348 @@
+package tests
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/s3"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) Authenticate(r *http.Request) (int32, io.Reader, error) {
+	args := m.Called(r)
+	return int32(args.Int(0)), r.Body, args.Error(1)
+}
+
+func (m *MockService) Owner(ctx context.Context, userID int32) (database.User, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(database.User), args.Error(1)
+}
+
+func (m *MockService) ListObjects(ctx context.Context, userID int32, params s3.ListParams) (s3.ListResult, error) {
+	args := m.Called(ctx, userID, params)
+	return args.Get(0).(s3.ListResult), args.Error(1)
+}
+
+func (m *MockService) GetObject(ctx context.Context, userID int32, key string) (s3.Object, io.ReadCloser, error) {
+	args := m.Called(ctx, userID, key)
+	rc, _ := args.Get(1).(io.ReadCloser)
+	return args.Get(0).(s3.Object), rc, args.Error(2)
+}
+
+func (m *MockService) HeadObject(ctx context.Context, userID int32, key string) (s3.Object, error) {
+	args := m.Called(ctx, userID, key)
+	return args.Get(0).(s3.Object), args.Error(1)
+}
+
+func (m *MockService) CheckUpload(ctx context.Context, userID int32, key string, sizeBytes int64) error {
+	return m.Called(ctx, userID, key, sizeBytes).Error(0)
+}
+
+func (m *MockService) PutObject(ctx context.Context, userID int32, key string, body io.Reader) (s3.Object, error) {
+	data, _ := io.ReadAll(body)
+	args := m.Called(ctx, userID, key, string(data))
+	return args.Get(0).(s3.Object), args.Error(1)
+}
+
+func (m *MockService) CopyObject(ctx context.Context, userID int32, srcKey, dstKey string) (s3.Object, error) {
+	args := m.Called(ctx, userID, srcKey, dstKey)
+	return args.Get(0).(s3.Object), args.Error(1)
+}
+
+func (m *MockService) DeleteObject(ctx context.Context, userID int32, key string) error {
+	return m.Called(ctx, userID, key).Error(0)
+}
+
+func (m *MockService) CreateMultipartUpload(ctx context.Context, userID int32, key string) (database.S3MultipartUpload, error) {
+	args := m.Called(ctx, userID, key)
+	return args.Get(0).(database.S3MultipartUpload), args.Error(1)
+}
+
+func (m *MockService) UploadPart(ctx context.Context, userID int32, uploadID, key string, number int32, body io.Reader) (database.S3MultipartPart, error) {
+	args := m.Called(ctx, userID, uploadID, key, number)
+	return args.Get(0).(database.S3MultipartPart), args.Error(1)
+}
+
+func (m *MockService) ListParts(ctx context.Context, userID int32, uploadID, key string) ([]database.S3MultipartPart, error) {
+	args := m.Called(ctx, userID, uploadID, key)
+	return args.Get(0).([]database.S3MultipartPart), args.Error(1)
+}
+
+func (m *MockService) ListMultipartUploads(ctx context.Context, userID int32) ([]database.S3MultipartUpload, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.S3MultipartUpload), args.Error(1)
+}
+
+func (m *MockService) CompleteMultipartUpload(ctx context.Context, userID int32, uploadID, key string, parts []s3.CompletedPart) (s3.Object, error) {
+	args := m.Called(ctx, userID, uploadID, key, parts)
+	return args.Get(0).(s3.Object), args.Error(1)
+}
+
+func (m *MockService) AbortMultipartUpload(ctx context.Context, userID int32, uploadID, key string) error {
+	return m.Called(ctx, userID, uploadID, key).Error(0)
+}
+
+func serve(service *MockService, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	s3.Handler(service).ServeHTTP(rec, req)
+	return rec
+}
+
+func signedIn() *MockService {
+	m := new(MockService)
+	m.On("Authenticate", mock.Anything).Return(1, nil)
+	return m
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	var e struct {
+		Code string `xml:"Code"`
+	}
+	require.NoError(t, xml.Unmarshal(rec.Body.Bytes(), &e), rec.Body.String())
+	return e.Code
+}
+
+func TestHandler_AuthFailure(t *testing.T) {
+	m := new(MockService)
+	m.On("Authenticate", mock.Anything).Return(0, s3.ErrSignatureMismatch)
+
+	rec := serve(m, http.MethodGet, "/s3/storage/a.txt", "", nil)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "SignatureDoesNotMatch", errorCode(t, rec))
+	assert.NotEmpty(t, rec.Header().Get("x-amz-request-id"))
+}
+
+func TestHandler_OtherBucket(t *testing.T) {
+	rec := serve(signedIn(), http.MethodGet, "/s3/someone-else/a.txt", "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "NoSuchBucket", errorCode(t, rec))
+}
+
+func TestHandler_ListBuckets(t *testing.T) {
+	m := signedIn()
+	m.On("Owner", mock.Anything, int32(1)).Return(database.User{ID: 1, Email: "a@example.com", CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, nil)
+
+	rec := serve(m, http.MethodGet, "/s3/", "", nil)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<ListAllMyBucketsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`)
+	assert.Contains(t, rec.Body.String(), "<Name>storage</Name><CreationDate>2024-01-02T03:04:05.000Z</CreationDate>")
+}
+
+func TestHandler_ListObjectsV2(t *testing.T) {
+	m := signedIn()
+	m.On("ListObjects", mock.Anything, int32(1), s3.ListParams{Prefix: "docs/", Delimiter: "/", After: "docs/a b.txt", MaxKeys: 2}).
+		Return(s3.ListResult{
+			Objects:        []s3.Object{{Key: "docs/c d.txt", Size: 3, ETag: `"x"`, LastModified: time.Unix(0, 0)}},
+			CommonPrefixes: []string{"docs/sub/"},
+			IsTruncated:    true,
+			Next:           "docs/sub/",
+		}, nil)
+
+	rec := serve(m, http.MethodGet, "/s3/storage?list-type=2&prefix=docs/&delimiter=/&max-keys=2&encoding-type=url&start-after=docs/a%20b.txt", "", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var res struct {
+		KeyCount              int
+		IsTruncated           bool
+		NextContinuationToken string
+		Contents              []struct{ Key string }
+		CommonPrefixes        []struct{ Prefix string }
+	}
+	require.NoError(t, xml.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, 2, res.KeyCount)
+	assert.True(t, res.IsTruncated)
+	assert.Equal(t, "docs%2Fc+d.txt", res.Contents[0].Key)
+	assert.Equal(t, "docs%2Fsub%2F", res.CommonPrefixes[0].Prefix)
+
+	// The token picks up where the page ended
+	m.On("ListObjects", mock.Anything, int32(1), s3.ListParams{After: "docs/sub/", MaxKeys: 1000}).Return(s3.ListResult{}, nil)
+	rec = serve(m, http.MethodGet, "/s3/storage?list-type=2&continuation-token="+res.NextContinuationToken, "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	m.AssertExpectations(t)
+}
+
+func TestHandler_GetObjectRange(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "obj")
+	require.NoError(t, err)
+	f.WriteString("hello world")
+	f.Seek(0, io.SeekStart)
+	m := signedIn()
+	m.On("GetObject", mock.Anything, int32(1), "docs/a.txt").
+		Return(s3.Object{Key: "docs/a.txt", Size: 11, ETag: `"abc"`, ContentType: "text/plain", LastModified: time.Unix(1700000000, 0)}, f, nil)
+
+	rec := serve(m, http.MethodGet, "/s3/storage/docs/a.txt", "", map[string]string{"Range": "bytes=6-"})
+
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "world", rec.Body.String())
+	assert.Equal(t, `"abc"`, rec.Header().Get("ETag"))
+	assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+}
+
+func TestHandler_HeadMissing(t *testing.T) {
+	m := signedIn()
+	m.On("HeadObject", mock.Anything, int32(1), "nope.txt").Return(s3.Object{}, s3.ErrNoSuchKey)
+
+	rec := serve(m, http.MethodHead, "/s3/storage/nope.txt", "", nil)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestHandler_PutObject(t *testing.T) {
+	m := signedIn()
+	m.On("CheckUpload", mock.Anything, int32(1), "a.txt", int64(5)).Return(nil)
+	m.On("PutObject", mock.Anything, int32(1), "a.txt", "hello").Return(s3.Object{ETag: `"abc"`}, nil)
+
+	rec := serve(m, http.MethodPut, "/s3/storage/a.txt", "hello", nil)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"abc"`, rec.Header().Get("ETag"))
+}
+
+func TestHandler_PutObjectOverQuota(t *testing.T) {
+	m := signedIn()
+	m.On("CheckUpload", mock.Anything, int32(1), "a.txt", int64(5)).Return(s3.ErrQuotaExceeded)
+
+	rec := serve(m, http.MethodPut, "/s3/storage/a.txt", "hello", nil)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "QuotaExceeded", errorCode(t, rec))
+	m.AssertNotCalled(t, "PutObject", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandler_CopyObject(t *testing.T) {
+	m := signedIn()
+	m.On("CopyObject", mock.Anything, int32(1), "docs/a b.txt", "copy.txt").Return(s3.Object{ETag: `"abc"`, LastModified: time.Unix(0, 0)}, nil)
+
+	rec := serve(m, http.MethodPut, "/s3/storage/copy.txt", "", map[string]string{"X-Amz-Copy-Source": "/storage/docs/a%20b.txt"})
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<ETag>&#34;abc&#34;</ETag>")
+}
+
+func TestHandler_DeleteObjects(t *testing.T) {
+	m := signedIn()
+	m.On("DeleteObject", mock.Anything, int32(1), "a.txt").Return(nil)
+	m.On("DeleteObject", mock.Anything, int32(1), "a//b").Return(s3.ErrInvalidKey)
+	body := `<Delete><Quiet>true</Quiet><Object><Key>a.txt</Key></Object><Object><Key>a//b</Key></Object></Delete>`
+
+	rec := serve(m, http.MethodPost, "/s3/storage?delete", body, nil)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "<Deleted>")
+	assert.Contains(t, rec.Body.String(), "<Error><Key>a//b</Key><Code>InvalidArgument</Code>")
+}
+
+func TestHandler_MultipartFlow(t *testing.T) {
+	uploadID := uuid.New()
+	m := signedIn()
+	m.On("CreateMultipartUpload", mock.Anything, int32(1), "big.bin").Return(database.S3MultipartUpload{ID: uploadID, ObjectKey: "big.bin"}, nil)
+	m.On("UploadPart", mock.Anything, int32(1), uploadID.String(), "big.bin", int32(1)).Return(database.S3MultipartPart{PartNumber: 1, Etag: `"p1"`}, nil)
+	m.On("CompleteMultipartUpload", mock.Anything, int32(1), uploadID.String(), "big.bin", []s3.CompletedPart{{PartNumber: 1, ETag: `"p1"`}}).
+		Return(s3.Object{ETag: `"whole"`}, nil)
+	m.On("AbortMultipartUpload", mock.Anything, int32(1), uploadID.String(), "big.bin").Return(nil)
+
+	rec := serve(m, http.MethodPost, "/s3/storage/big.bin?uploads", "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<UploadId>"+uploadID.String()+"</UploadId>")
+
+	rec = serve(m, http.MethodPut, "/s3/storage/big.bin?partNumber=1&uploadId="+uploadID.String(), "data", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"p1"`, rec.Header().Get("ETag"))
+
+	complete := `<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>"p1"</ETag></Part></CompleteMultipartUpload>`
+	rec = serve(m, http.MethodPost, "/s3/storage/big.bin?uploadId="+uploadID.String(), complete, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<Key>big.bin</Key>")
+
+	rec = serve(m, http.MethodDelete, "/s3/storage/big.bin?uploadId="+uploadID.String(), "", nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	m.AssertExpectations(t)
+}
+
+func TestHandler_UnsupportedSubresource(t *testing.T) {
+	rec := serve(signedIn(), http.MethodGet, "/s3/storage/a.txt?acl", "", nil)
+
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	assert.Equal(t, "NotImplemented", errorCode(t, rec))
+}
+
+type MockKeyService struct {
+	mock.Mock
+}
+
+func (m *MockKeyService) CreateAccessKey(ctx context.Context, userID int32) (database.S3AccessKey, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(database.S3AccessKey), args.Error(1)
+}
+
+func (m *MockKeyService) ListAccessKeys(ctx context.Context, userID int32) ([]database.S3AccessKey, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.S3AccessKey), args.Error(1)
+}
+
+func (m *MockKeyService) DeleteAccessKey(ctx context.Context, userID int32, id uuid.UUID) error {
+	return m.Called(ctx, userID, id).Error(0)
+}
+
+func asUser(req *http.Request, userID int32) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), userID))
+}
+
+func TestCreateAccessKeyHandler_ShowsSecretOnce(t *testing.T) {
+	m := new(MockKeyService)
+	key := database.S3AccessKey{ID: uuid.New(), AccessKeyID: "CSAKEXAMPLE", SecretKey: "shh"}
+	m.On("CreateAccessKey", mock.Anything, int32(1)).Return(key, nil)
+	m.On("ListAccessKeys", mock.Anything, int32(1)).Return([]database.S3AccessKey{key}, nil)
+
+	rec := httptest.NewRecorder()
+	s3.CreateAccessKeyHandler(m).ServeHTTP(rec, asUser(httptest.NewRequest(http.MethodPost, "/users/me/s3-keys", nil), 1))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"secret_access_key":"shh"`)
+
+	rec = httptest.NewRecorder()
+	s3.ListAccessKeysHandler(m).ServeHTTP(rec, asUser(httptest.NewRequest(http.MethodGet, "/users/me/s3-keys", nil), 1))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "shh")
+}
+
+func TestDeleteAccessKeyHandler_NotFound(t *testing.T) {
+	m := new(MockKeyService)
+	id := uuid.New()
+	m.On("DeleteAccessKey", mock.Anything, int32(1), id).Return(s3.ErrKeyNotFound)
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/me/s3-keys/"+id.String(), nil)
+	req.SetPathValue("id", id.String())
+	rec := httptest.NewRecorder()
+	s3.DeleteAccessKeyHandler(m).ServeHTTP(rec, asUser(req, 1))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,413 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+	"github.com/bellezhang119/cloud-storage/internal/s3"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var errNoRows = sql.ErrNoRows
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) GetStorageUsage(ctx context.Context, id int32) (database.GetStorageUsageRow, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.GetStorageUsageRow), args.Error(1)
+}
+
+func (m *MockQueries) GetUserByID(ctx context.Context, id int32) (database.User, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.User), args.Error(1)
+}
+
+func (m *MockQueries) CreateS3AccessKey(ctx context.Context, arg database.CreateS3AccessKeyParams) (database.S3AccessKey, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.S3AccessKey), args.Error(1)
+}
+
+func (m *MockQueries) ListS3AccessKeys(ctx context.Context, userID int32) ([]database.S3AccessKey, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.S3AccessKey), args.Error(1)
+}
+
+func (m *MockQueries) GetS3AccessKey(ctx context.Context, accessKeyID string) (database.S3AccessKey, error) {
+	args := m.Called(ctx, accessKeyID)
+	return args.Get(0).(database.S3AccessKey), args.Error(1)
+}
+
+func (m *MockQueries) TouchS3AccessKey(ctx context.Context, id uuid.UUID) (int64, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) DeleteS3AccessKey(ctx context.Context, arg database.DeleteS3AccessKeyParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) CreateMultipartUpload(ctx context.Context, arg database.CreateMultipartUploadParams) (database.S3MultipartUpload, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.S3MultipartUpload), args.Error(1)
+}
+
+func (m *MockQueries) GetMultipartUpload(ctx context.Context, arg database.GetMultipartUploadParams) (database.S3MultipartUpload, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.S3MultipartUpload), args.Error(1)
+}
+
+func (m *MockQueries) ListMultipartUploads(ctx context.Context, userID int32) ([]database.S3MultipartUpload, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.S3MultipartUpload), args.Error(1)
+}
+
+func (m *MockQueries) ListStaleMultipartUploads(ctx context.Context, arg database.ListStaleMultipartUploadsParams) ([]database.S3MultipartUpload, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.S3MultipartUpload), args.Error(1)
+}
+
+func (m *MockQueries) DeleteMultipartUpload(ctx context.Context, arg database.DeleteMultipartUploadParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) PutMultipartPart(ctx context.Context, arg database.PutMultipartPartParams) (database.S3MultipartPart, error) {
+	args := m.Called(ctx, arg)
+	if fn, ok := args.Get(0).(func(database.PutMultipartPartParams) database.S3MultipartPart); ok {
+		return fn(arg), args.Error(1)
+	}
+	return args.Get(0).(database.S3MultipartPart), args.Error(1)
+}
+
+func (m *MockQueries) ListMultipartParts(ctx context.Context, uploadID uuid.UUID) ([]database.S3MultipartPart, error) {
+	args := m.Called(ctx, uploadID)
+	return args.Get(0).([]database.S3MultipartPart), args.Error(1)
+}
+
+// fakePaths is a fixed tree of paths; uploads are recorded, not applied.
+type fakePaths struct {
+	entries  map[string]paths.Entry
+	uploaded map[string]string
+}
+
+func newFakePaths(files map[string]int64, folders ...string) *fakePaths {
+	f := &fakePaths{entries: map[string]paths.Entry{"/": {Kind: paths.KindFolder, Path: "/"}}, uploaded: map[string]string{}}
+	for _, p := range folders {
+		id := uuid.New()
+		f.entries[p] = paths.Entry{Kind: paths.KindFolder, ID: &id, Name: path.Base(p), Path: p}
+	}
+	for p, size := range files {
+		id, size := uuid.New(), size
+		f.entries[p] = paths.Entry{Kind: paths.KindFile, ID: &id, Name: path.Base(p), Path: p, SizeBytes: &size, SHA256: "sum-" + path.Base(p)}
+	}
+	return f
+}
+
+func (f *fakePaths) Resolve(ctx context.Context, userID int32, p string) (paths.Entry, error) {
+	e, ok := f.entries[p]
+	if !ok {
+		return paths.Entry{}, paths.ErrNotFound
+	}
+	return e, nil
+}
+
+func (f *fakePaths) List(ctx context.Context, userID int32, p string) (paths.Entry, []paths.Entry, error) {
+	dir, ok := f.entries[p]
+	if !ok {
+		return paths.Entry{}, nil, paths.ErrNotFound
+	}
+	if dir.Kind != paths.KindFolder {
+		return paths.Entry{}, nil, paths.ErrNotAFolder
+	}
+	var children []paths.Entry
+	for _, e := range f.entries {
+		if e.Path != "/" && path.Dir(e.Path) == p {
+			children = append(children, e)
+		}
+	}
+	return dir, children, nil
+}
+
+func (f *fakePaths) Upload(ctx context.Context, userID int32, p string, sizeBytes int64, content io.Reader) (paths.Entry, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return paths.Entry{}, err
+	}
+	f.uploaded[p] = string(data)
+	id, size := uuid.New(), int64(len(data))
+	e := paths.Entry{Kind: paths.KindFile, ID: &id, Name: path.Base(p), Path: p, SizeBytes: &size}
+	f.entries[p] = e
+	return e, nil
+}
+
+type MockFiles struct {
+	mock.Mock
+}
+
+func (m *MockFiles) GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockFiles) GetFileForDownload(ctx context.Context, fileID uuid.UUID, userID int32) (database.File, io.ReadCloser, error) {
+	args := m.Called(ctx, fileID, userID)
+	rc, _ := args.Get(1).(io.ReadCloser)
+	return args.Get(0).(database.File), rc, args.Error(2)
+}
+
+func (m *MockFiles) DeleteFile(ctx context.Context, fileID uuid.UUID, userID int32) error {
+	return m.Called(ctx, fileID, userID).Error(0)
+}
+
+// memParts keeps multipart parts in memory.
+type memParts struct {
+	dir   string
+	files map[string][]byte
+}
+
+func (p *memParts) SaveDerived(userID int32, fileID uuid.UUID, name string, content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	p.files[fileID.String()+"/"+name] = data
+	return nil
+}
+
+func (p *memParts) OpenDerived(userID int32, fileID uuid.UUID, name string) (*os.File, error) {
+	f, err := os.CreateTemp(p.dir, "part-*")
+	if err != nil {
+		return nil, err
+	}
+	f.Write(p.files[fileID.String()+"/"+name])
+	f.Seek(0, io.SeekStart)
+	return f, nil
+}
+
+func (p *memParts) DeleteDerived(userID int32, fileID uuid.UUID) error {
+	for k := range p.files {
+		if strings.HasPrefix(k, fileID.String()+"/") {
+			delete(p.files, k)
+		}
+	}
+	return nil
+}
+
+func listKeys(result s3.ListResult) []string {
+	var keys []string
+	for _, o := range result.Objects {
+		keys = append(keys, o.Key)
+	}
+	return keys
+}
+
+func sampleTree() *fakePaths {
+	return newFakePaths(map[string]int64{
+		"/a.txt":            1,
+		"/docs/b.txt":       2,
+		"/docs/2024/c.txt":  3,
+		"/docs-old/d.txt":   4,
+		"/photos/e.jpg":     5,
+		"/photos/raw/f.cr2": 6,
+	}, "/docs", "/docs/2024", "/docs-old", "/photos", "/photos/raw", "/empty")
+}
+
+func TestListObjects_Recursive(t *testing.T) {
+	service := s3.NewService(new(MockQueries), sampleTree(), nil, nil, nil)
+
+	result, err := service.ListObjects(context.Background(), 1, s3.ListParams{MaxKeys: 1000})
+
+	require.NoError(t, err)
+	// Keys come in byte order, so "docs-old/" sorts before "docs/"
+	assert.Equal(t, []string{"a.txt", "docs-old/d.txt", "docs/2024/c.txt", "docs/b.txt", "photos/e.jpg", "photos/raw/f.cr2"}, listKeys(result))
+	assert.Empty(t, result.CommonPrefixes)
+	assert.False(t, result.IsTruncated)
+	assert.Equal(t, `"sum-a.txt"`, result.Objects[0].ETag)
+}
+
+func TestListObjects_Delimiter(t *testing.T) {
+	service := s3.NewService(new(MockQueries), sampleTree(), nil, nil, nil)
+
+	result, err := service.ListObjects(context.Background(), 1, s3.ListParams{Delimiter: "/", MaxKeys: 1000})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, listKeys(result))
+	assert.Equal(t, []string{"docs-old/", "docs/", "empty/", "photos/"}, result.CommonPrefixes)
+
+	result, err = service.ListObjects(context.Background(), 1, s3.ListParams{Prefix: "docs/", Delimiter: "/", MaxKeys: 1000})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs/b.txt"}, listKeys(result))
+	assert.Equal(t, []string{"docs/2024/"}, result.CommonPrefixes)
+
+	// A prefix needn't end at a folder boundary
+	result, err = service.ListObjects(context.Background(), 1, s3.ListParams{Prefix: "do", Delimiter: "/", MaxKeys: 1000})
+	require.NoError(t, err)
+	assert.Empty(t, listKeys(result))
+	assert.Equal(t, []string{"docs-old/", "docs/"}, result.CommonPrefixes)
+}
+
+func TestListObjects_Pages(t *testing.T) {
+	service := s3.NewService(new(MockQueries), sampleTree(), nil, nil, nil)
+
+	var all []string
+	params := s3.ListParams{MaxKeys: 4}
+	for {
+		result, err := service.ListObjects(context.Background(), 1, params)
+		require.NoError(t, err)
+		all = append(all, listKeys(result)...)
+		if !result.IsTruncated {
+			break
+		}
+		params.After = result.Next
+	}
+
+	assert.Equal(t, []string{"a.txt", "docs-old/d.txt", "docs/2024/c.txt", "docs/b.txt", "photos/e.jpg", "photos/raw/f.cr2"}, all)
+}
+
+func TestListObjects_MissingPrefix(t *testing.T) {
+	service := s3.NewService(new(MockQueries), sampleTree(), nil, nil, nil)
+
+	result, err := service.ListObjects(context.Background(), 1, s3.ListParams{Prefix: "nope/x", MaxKeys: 1000})
+
+	require.NoError(t, err)
+	assert.Empty(t, result.Objects)
+}
+
+func quotaQueries(used, quota int64) *MockQueries {
+	q := new(MockQueries)
+	q.On("GetStorageUsage", mock.Anything, int32(1)).Return(database.GetStorageUsageRow{UsedBytes: used, StorageQuota: quota}, nil)
+	return q
+}
+
+func TestPutObject_StoresAndDescribes(t *testing.T) {
+	tree := newFakePaths(nil)
+	files := new(MockFiles)
+	files.On("GetFileByID", mock.Anything, mock.Anything).Return(database.File{SizeBytes: 5, Sha256: sql.NullString{String: "abc", Valid: true}}, nil)
+	service := s3.NewService(quotaQueries(0, 100), tree, files, nil, nil)
+
+	obj, err := service.PutObject(context.Background(), 1, "notes/today.txt", strings.NewReader("hello"))
+
+	require.NoError(t, err)
+	assert.Equal(t, "hello", tree.uploaded["/notes/today.txt"])
+	assert.Equal(t, `"abc"`, obj.ETag)
+}
+
+func TestPutObject_OverQuota(t *testing.T) {
+	tree := newFakePaths(nil)
+	service := s3.NewService(quotaQueries(98, 100), tree, nil, nil, nil)
+
+	_, err := service.PutObject(context.Background(), 1, "big.bin", strings.NewReader("hello"))
+
+	assert.ErrorIs(t, err, s3.ErrQuotaExceeded)
+	assert.Empty(t, tree.uploaded)
+}
+
+// countingReader reports how much of a body was actually consumed.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestPutObject_StopsReadingPastQuota(t *testing.T) {
+	tree := newFakePaths(nil)
+	service := s3.NewService(quotaQueries(90, 100), tree, nil, nil, nil)
+	body := &countingReader{r: bytes.NewReader(make([]byte, 1<<20))}
+
+	_, err := service.PutObject(context.Background(), 1, "big.bin", body)
+
+	assert.ErrorIs(t, err, s3.ErrQuotaExceeded)
+	assert.LessOrEqual(t, body.n, int64(64<<10), "the body should not be read far past the quota")
+	assert.Empty(t, tree.uploaded)
+}
+
+func TestPutObject_InvalidKeys(t *testing.T) {
+	service := s3.NewService(new(MockQueries), newFakePaths(nil), nil, nil, nil)
+
+	for _, key := range []string{"a//b", "a/../b", "./a", "/"} {
+		_, err := service.PutObject(context.Background(), 1, key, strings.NewReader("x"))
+		assert.ErrorIs(t, err, s3.ErrInvalidKey, key)
+	}
+}
+
+func TestCopyObject_OntoItself(t *testing.T) {
+	service := s3.NewService(new(MockQueries), sampleTree(), nil, nil, nil)
+
+	_, err := service.CopyObject(context.Background(), 1, "a.txt", "a.txt")
+
+	assert.ErrorIs(t, err, s3.ErrInvalidRequest)
+}
+
+func TestDeleteObject_MissingKeySucceeds(t *testing.T) {
+	service := s3.NewService(new(MockQueries), sampleTree(), new(MockFiles), nil, nil)
+
+	assert.NoError(t, service.DeleteObject(context.Background(), 1, "nope.txt"))
+}
+
+func TestMultipart_Complete(t *testing.T) {
+	tree := newFakePaths(nil)
+	parts := &memParts{dir: t.TempDir(), files: map[string][]byte{}}
+	upload := database.S3MultipartUpload{ID: uuid.New(), UserID: 1, ObjectKey: "video.mp4", CreatedAt: time.Now()}
+
+	q := quotaQueries(0, 1000)
+	q.On("GetMultipartUpload", mock.Anything, database.GetMultipartUploadParams{ID: upload.ID, UserID: 1}).Return(upload, nil)
+	q.On("ListMultipartParts", mock.Anything, upload.ID).Return([]database.S3MultipartPart{}, nil).Twice()
+	q.On("PutMultipartPart", mock.Anything, mock.Anything).Return(func(arg database.PutMultipartPartParams) database.S3MultipartPart {
+		return database.S3MultipartPart{UploadID: arg.UploadID, PartNumber: arg.PartNumber, Etag: arg.Etag, SizeBytes: arg.SizeBytes}
+	}, nil)
+	q.On("DeleteMultipartUpload", mock.Anything, database.DeleteMultipartUploadParams{ID: upload.ID, UserID: 1}).Return(int64(1), nil)
+	files := new(MockFiles)
+	files.On("GetFileByID", mock.Anything, mock.Anything).Return(database.File{SizeBytes: 11}, nil)
+	service := s3.NewService(q, tree, files, nil, parts)
+	ctx := context.Background()
+
+	p1, err := service.UploadPart(ctx, 1, upload.ID.String(), "video.mp4", 1, strings.NewReader("hello "))
+	require.NoError(t, err)
+	p2, err := service.UploadPart(ctx, 1, upload.ID.String(), "video.mp4", 2, strings.NewReader("world"))
+	require.NoError(t, err)
+	assert.Equal(t, `"f814893777bcc2295fff05f00e508da6"`, p1.Etag, "parts are tagged with their MD5")
+
+	q.On("ListMultipartParts", mock.Anything, upload.ID).Return([]database.S3MultipartPart{p1, p2}, nil)
+
+	// Parts must be listed in order, with their ETags
+	_, err = service.CompleteMultipartUpload(ctx, 1, upload.ID.String(), "video.mp4", []s3.CompletedPart{{PartNumber: 2, ETag: p2.Etag}, {PartNumber: 1, ETag: p1.Etag}})
+	assert.ErrorIs(t, err, s3.ErrInvalidPartOrder)
+	_, err = service.CompleteMultipartUpload(ctx, 1, upload.ID.String(), "video.mp4", []s3.CompletedPart{{PartNumber: 1, ETag: `"bogus"`}})
+	assert.ErrorIs(t, err, s3.ErrInvalidPart)
+
+	_, err = service.CompleteMultipartUpload(ctx, 1, upload.ID.String(), "video.mp4", []s3.CompletedPart{{PartNumber: 1, ETag: p1.Etag}, {PartNumber: 2, ETag: p2.Etag}})
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", tree.uploaded["/video.mp4"])
+	assert.Empty(t, parts.files)
+	q.AssertExpectations(t)
+}
+
+func TestMultipart_WrongKey(t *testing.T) {
+	upload := database.S3MultipartUpload{ID: uuid.New(), UserID: 1, ObjectKey: "video.mp4"}
+	q := new(MockQueries)
+	q.On("GetMultipartUpload", mock.Anything, mock.Anything).Return(upload, nil)
+	service := s3.NewService(q, newFakePaths(nil), nil, nil, &memParts{files: map[string][]byte{}})
+
+	_, err := service.UploadPart(context.Background(), 1, upload.ID.String(), "other.mp4", 1, bytes.NewReader(nil))
+
+	assert.ErrorIs(t, err, s3.ErrNoSuchUpload)
+}
@@ -0,0 +1,111 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type ServiceInterface interface {
+	Search(ctx context.Context, userID int32, f Filters, after string, limit int32) (Page, error)
+}
+
+func parseSize(q url.Values, key string) (*int64, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return nil, errors.New("invalid " + key)
+	}
+	return &n, nil
+}
+
+// parseTime accepts RFC 3339 timestamps or plain YYYY-MM-DD dates.
+func parseTime(q url.Values, key string) (*time.Time, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, v); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, errors.New("invalid " + key)
+}
+
+// SearchHandler must be mounted behind AuthMiddleware.
+//
+// GET /search?q=&kind=file|folder&mime=&tag=&min_size=&max_size=
+// &modified_after=&modified_before=&limit=&cursor=
+func SearchHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		q := r.URL.Query()
+		f := Filters{
+			Query:      q.Get("q"),
+			Kind:       q.Get("kind"),
+			MimePrefix: q.Get("mime"),
+			Tag:        q.Get("tag"),
+		}
+
+		var err error
+		if f.MinSize, err = parseSize(q, "min_size"); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if f.MaxSize, err = parseSize(q, "max_size"); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if f.ModifiedAfter, err = parseTime(q, "modified_after"); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if f.ModifiedBefore, err = parseTime(q, "modified_before"); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		limit := int32(defaultPageSize)
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil || n <= 0 {
+				util.RespondWithError(w, http.StatusBadRequest, "Invalid limit")
+				return
+			}
+			limit = int32(min(n, maxPageSize))
+		}
+
+		page, err := service.Search(r.Context(), userID, f, q.Get("cursor"), limit)
+		if err != nil {
+			if errors.Is(err, ErrInvalidCursor) || errors.Is(err, ErrInvalidFilter) {
+				util.RespondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, page)
+	}
+}
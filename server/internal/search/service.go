@@ -0,0 +1,268 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	KindFile   = "file"
+	KindFolder = "folder"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidFilter = errors.New("invalid filter")
+)
+
+type Queries interface {
+	SearchItems(ctx context.Context, arg database.SearchItemsParams) ([]database.SearchItemsRow, error)
+	ListFolderAncestors(ctx context.Context, folderIds []uuid.UUID) ([]database.ListFolderAncestorsRow, error)
+	ListTagsForItems(ctx context.Context, arg database.ListTagsForItemsParams) ([]database.ListTagsForItemsRow, error)
+}
+
+// Filters narrows a search. Zero values mean "no filter".
+type Filters struct {
+	Query          string
+	Kind           string
+	MimePrefix     string
+	MinSize        *int64
+	MaxSize        *int64
+	ModifiedAfter  *time.Time
+	ModifiedBefore *time.Time
+	Tag            string
+}
+
+// Crumb is one folder on the way from the user's root to an item.
+type Crumb struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+type Result struct {
+	Kind       string     `json:"kind"`
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	ParentID   *uuid.UUID `json:"parent_id"`
+	MimeType   string     `json:"mime_type,omitempty"`
+	SizeBytes  *int64     `json:"size_bytes,omitempty"`
+	OwnerID    int32      `json:"owner_id"`
+	Permission string     `json:"permission"`
+	Shared     bool       `json:"shared"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	// Breadcrumbs from the root down to the containing folder. Empty for
+	// items at the root and for items shared by someone else, whose folder
+	// names are not the requester's to see.
+	Path []Crumb `json:"path"`
+	// The searcher's own tags; always empty for shared items.
+	Tags []string `json:"tags"`
+}
+
+type Page struct {
+	Items      []Result `json:"items"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// cursor is the sort key of the last row on a page.
+type cursor struct {
+	Rank float64   `json:"r"`
+	ID   uuid.UUID `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == uuid.Nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+type Service struct {
+	queries Queries
+}
+
+func NewService(q Queries) *Service {
+	return &Service{queries: q}
+}
+
+func (s *Service) Search(ctx context.Context, userID int32, f Filters, after string, limit int32) (Page, error) {
+	if f.Kind != "" && f.Kind != KindFile && f.Kind != KindFolder {
+		return Page{}, fmt.Errorf("%w: kind must be %q or %q", ErrInvalidFilter, KindFile, KindFolder)
+	}
+
+	params := database.SearchItemsParams{
+		UserID:   userID,
+		Query:    f.Query,
+		Kind:     f.Kind,
+		PageSize: limit + 1, // one extra row tells us whether there is a next page
+	}
+	if f.MimePrefix != "" {
+		params.MimePrefix = sql.NullString{String: f.MimePrefix, Valid: true}
+	}
+	if f.MinSize != nil {
+		params.MinSize = sql.NullInt64{Int64: *f.MinSize, Valid: true}
+	}
+	if f.MaxSize != nil {
+		params.MaxSize = sql.NullInt64{Int64: *f.MaxSize, Valid: true}
+	}
+	if f.ModifiedAfter != nil {
+		params.ModifiedAfter = sql.NullTime{Time: *f.ModifiedAfter, Valid: true}
+	}
+	if f.ModifiedBefore != nil {
+		params.ModifiedBefore = sql.NullTime{Time: *f.ModifiedBefore, Valid: true}
+	}
+	if f.Tag != "" {
+		params.Tag = sql.NullString{String: strings.ToLower(strings.TrimSpace(f.Tag)), Valid: true}
+	}
+	if after != "" {
+		c, err := decodeCursor(after)
+		if err != nil {
+			return Page{}, err
+		}
+		params.CursorRank = sql.NullFloat64{Float64: c.Rank, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: c.ID, Valid: true}
+	}
+
+	rows, err := s.queries.SearchItems(ctx, params)
+	if err != nil {
+		return Page{}, fmt.Errorf("searching: %w", err)
+	}
+
+	page := Page{Items: make([]Result, 0, min(len(rows), int(limit)))}
+	if len(rows) > int(limit) {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		page.NextCursor = encodeCursor(cursor{Rank: last.Rank, ID: last.ID})
+	}
+
+	crumbs, err := s.breadcrumbs(ctx, userID, rows)
+	if err != nil {
+		return Page{}, err
+	}
+	tags, err := s.tags(ctx, userID, rows)
+	if err != nil {
+		return Page{}, err
+	}
+
+	for _, row := range rows {
+		res := Result{
+			Kind:       row.Kind,
+			ID:         row.ID,
+			Name:       row.Name,
+			MimeType:   row.MimeType.String,
+			OwnerID:    row.OwnerID.Int32,
+			Permission: row.Permission,
+			Shared:     row.OwnerID.Int32 != userID,
+			CreatedAt:  row.CreatedAt.Time,
+			UpdatedAt:  row.UpdatedAt.Time,
+			Path:       []Crumb{},
+			Tags:       []string{},
+		}
+		if row.SizeBytes.Valid {
+			res.SizeBytes = &row.SizeBytes.Int64
+		}
+		if row.ParentID.Valid && !res.Shared {
+			res.ParentID = &row.ParentID.UUID
+			res.Path = crumbs(row.ParentID.UUID)
+		}
+		if t, ok := tags[row.ID]; ok {
+			res.Tags = t
+		}
+		page.Items = append(page.Items, res)
+	}
+
+	return page, nil
+}
+
+// tags loads the tags of the page's own items in one query.
+func (s *Service) tags(ctx context.Context, userID int32, rows []database.SearchItemsRow) (map[uuid.UUID][]string, error) {
+	var files, folders []uuid.UUID
+	for _, row := range rows {
+		if row.OwnerID.Int32 != userID {
+			continue
+		}
+		if row.Kind == KindFolder {
+			folders = append(folders, row.ID)
+		} else {
+			files = append(files, row.ID)
+		}
+	}
+
+	tags := map[uuid.UUID][]string{}
+	if len(files) == 0 && len(folders) == 0 {
+		return tags, nil
+	}
+
+	found, err := s.queries.ListTagsForItems(ctx, database.ListTagsForItemsParams{
+		FileIds:   files,
+		FolderIds: folders,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loading tags: %w", err)
+	}
+	for _, t := range found {
+		tags[t.ItemID] = append(tags[t.ItemID], t.Name)
+	}
+	return tags, nil
+}
+
+// breadcrumbs loads every ancestor of the page's own items in one query and
+// returns a lookup from a parent folder to its root-first path.
+func (s *Service) breadcrumbs(ctx context.Context, userID int32, rows []database.SearchItemsRow) (func(uuid.UUID) []Crumb, error) {
+	seen := map[uuid.UUID]bool{}
+	var parents []uuid.UUID
+	for _, row := range rows {
+		if row.ParentID.Valid && row.OwnerID.Int32 == userID && !seen[row.ParentID.UUID] {
+			seen[row.ParentID.UUID] = true
+			parents = append(parents, row.ParentID.UUID)
+		}
+	}
+
+	folders := map[uuid.UUID]database.ListFolderAncestorsRow{}
+	if len(parents) > 0 {
+		ancestors, err := s.queries.ListFolderAncestors(ctx, parents)
+		if err != nil {
+			return nil, fmt.Errorf("loading breadcrumbs: %w", err)
+		}
+		for _, a := range ancestors {
+			folders[a.ID] = a
+		}
+	}
+
+	return func(parentID uuid.UUID) []Crumb {
+		path := []Crumb{}
+		id := parentID
+		// Bounded by the number of folders so a cycle can't spin forever
+		for len(path) <= len(folders) {
+			folder, ok := folders[id]
+			if !ok {
+				break
+			}
+			path = append([]Crumb{{ID: folder.ID, Name: folder.Name}}, path...)
+			if !folder.ParentID.Valid {
+				break
+			}
+			id = folder.ParentID.UUID
+		}
+		return path
+	}, nil
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) Search(ctx context.Context, userID int32, f search.Filters, after string, limit int32) (search.Page, error) {
+	args := m.Called(ctx, userID, f, after, limit)
+	return args.Get(0).(search.Page), args.Error(1)
+}
+
+func asUser(req *http.Request, userID int32) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), userID))
+}
+
+func TestSearchHandler_ParsesFilters(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := search.SearchHandler(mockSvc)
+
+	minSize := int64(1024)
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockSvc.On("Search", mock.Anything, int32(3), search.Filters{
+		Query:         "tax return",
+		Kind:          "file",
+		MimePrefix:    "application/pdf",
+		MinSize:       &minSize,
+		ModifiedAfter: &after,
+	}, "abc", int32(200)).Return(search.Page{Items: []search.Result{}}, nil)
+
+	req := asUser(httptest.NewRequest(http.MethodGet,
+		"/search?q=tax+return&kind=file&mime=application/pdf&min_size=1024&modified_after=2024-01-01&cursor=abc&limit=500", nil), 3)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"items":[]`)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestSearchHandler_BadSize(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := search.SearchHandler(mockSvc)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/search?min_size=-5", nil), 3)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockSvc.AssertNotCalled(t, "Search", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSearchHandler_InvalidCursor(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := search.SearchHandler(mockSvc)
+
+	mockSvc.On("Search", mock.Anything, int32(3), mock.Anything, "junk", int32(50)).Return(search.Page{}, search.ErrInvalidCursor)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/search?cursor=junk", nil), 3)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/search"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) SearchItems(ctx context.Context, arg database.SearchItemsParams) ([]database.SearchItemsRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.SearchItemsRow), args.Error(1)
+}
+
+func (m *MockQueries) ListFolderAncestors(ctx context.Context, folderIds []uuid.UUID) ([]database.ListFolderAncestorsRow, error) {
+	args := m.Called(ctx, folderIds)
+	return args.Get(0).([]database.ListFolderAncestorsRow), args.Error(1)
+}
+
+func (m *MockQueries) ListTagsForItems(ctx context.Context, arg database.ListTagsForItemsParams) ([]database.ListTagsForItemsRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ListTagsForItemsRow), args.Error(1)
+}
+
+func owned(id int32) sql.NullInt32 {
+	return sql.NullInt32{Int32: id, Valid: true}
+}
+
+func TestSearch_BuildsBreadcrumbs(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := search.NewService(mockQ)
+	ctx := context.Background()
+
+	root, child := uuid.New(), uuid.New()
+	file := database.SearchItemsRow{
+		Kind:     search.KindFile,
+		ID:       uuid.New(),
+		OwnerID:  owned(1),
+		ParentID: uuid.NullUUID{UUID: child, Valid: true},
+		Name:     "report.pdf",
+		Rank:     0.5,
+	}
+
+	mockQ.On("SearchItems", ctx, mock.MatchedBy(func(p database.SearchItemsParams) bool {
+		return p.UserID == 1 && p.Query == "report" && p.PageSize == 11
+	})).Return([]database.SearchItemsRow{file}, nil)
+	mockQ.On("ListFolderAncestors", ctx, []uuid.UUID{child}).Return([]database.ListFolderAncestorsRow{
+		{ID: child, Name: "2024", ParentID: uuid.NullUUID{UUID: root, Valid: true}},
+		{ID: root, Name: "Reports"},
+	}, nil)
+	mockQ.On("ListTagsForItems", ctx, mock.Anything).Return([]database.ListTagsForItemsRow{}, nil)
+
+	page, err := svc.Search(ctx, 1, search.Filters{Query: "report"}, "", 10)
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+	assert.Empty(t, page.NextCursor)
+	assert.Equal(t, []search.Crumb{{ID: root, Name: "Reports"}, {ID: child, Name: "2024"}}, page.Items[0].Path)
+	mockQ.AssertExpectations(t)
+}
+
+func TestSearch_SharedItemsHaveNoPath(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := search.NewService(mockQ)
+	ctx := context.Background()
+
+	shared := database.SearchItemsRow{
+		Kind:       search.KindFile,
+		ID:         uuid.New(),
+		OwnerID:    owned(2),
+		ParentID:   uuid.NullUUID{UUID: uuid.New(), Valid: true},
+		Permission: "read",
+	}
+	mockQ.On("SearchItems", ctx, mock.Anything).Return([]database.SearchItemsRow{shared}, nil)
+
+	page, err := svc.Search(ctx, 1, search.Filters{}, "", 10)
+	assert.NoError(t, err)
+	assert.True(t, page.Items[0].Shared)
+	assert.Equal(t, "read", page.Items[0].Permission)
+	assert.Empty(t, page.Items[0].Path)
+	assert.Nil(t, page.Items[0].ParentID)
+	assert.Empty(t, page.Items[0].Tags)
+	mockQ.AssertNotCalled(t, "ListFolderAncestors", mock.Anything, mock.Anything)
+	mockQ.AssertNotCalled(t, "ListTagsForItems", mock.Anything, mock.Anything)
+}
+
+func TestSearch_CursorRoundTrip(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := search.NewService(mockQ)
+	ctx := context.Background()
+
+	rows := []database.SearchItemsRow{
+		{Kind: search.KindFolder, ID: uuid.New(), OwnerID: owned(1), Rank: 0.9},
+		{Kind: search.KindFolder, ID: uuid.New(), OwnerID: owned(1), Rank: 0.7},
+		{Kind: search.KindFolder, ID: uuid.New(), OwnerID: owned(1), Rank: 0.3},
+	}
+	mockQ.On("SearchItems", ctx, mock.MatchedBy(func(p database.SearchItemsParams) bool {
+		return !p.CursorID.Valid
+	})).Return(rows, nil)
+	mockQ.On("ListTagsForItems", ctx, mock.Anything).Return([]database.ListTagsForItemsRow{}, nil)
+
+	page, err := svc.Search(ctx, 1, search.Filters{}, "", 2)
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 2)
+	assert.NotEmpty(t, page.NextCursor)
+
+	mockQ.On("SearchItems", ctx, mock.MatchedBy(func(p database.SearchItemsParams) bool {
+		return p.CursorID.Valid && p.CursorID.UUID == rows[1].ID && p.CursorRank.Float64 == 0.7
+	})).Return(rows[2:], nil)
+
+	page, err = svc.Search(ctx, 1, search.Filters{}, page.NextCursor, 2)
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestSearch_InvalidCursor(t *testing.T) {
+	svc := search.NewService(new(MockQueries))
+
+	_, err := svc.Search(context.Background(), 1, search.Filters{}, "not-a-cursor!", 10)
+	assert.ErrorIs(t, err, search.ErrInvalidCursor)
+}
+
+func TestSearch_InvalidKind(t *testing.T) {
+	svc := search.NewService(new(MockQueries))
+
+	_, err := svc.Search(context.Background(), 1, search.Filters{Kind: "photo"}, "", 10)
+	assert.ErrorIs(t, err, search.ErrInvalidFilter)
+}
+
+func TestSearch_TagFilterAndTags(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := search.NewService(mockQ)
+	ctx := context.Background()
+
+	folder := database.SearchItemsRow{Kind: search.KindFolder, ID: uuid.New(), OwnerID: owned(1)}
+	file := database.SearchItemsRow{Kind: search.KindFile, ID: uuid.New(), OwnerID: owned(1)}
+
+	mockQ.On("SearchItems", ctx, mock.MatchedBy(func(p database.SearchItemsParams) bool {
+		return p.Tag.Valid && p.Tag.String == "work"
+	})).Return([]database.SearchItemsRow{folder, file}, nil)
+	mockQ.On("ListTagsForItems", ctx, database.ListTagsForItemsParams{
+		FileIds:   []uuid.UUID{file.ID},
+		FolderIds: []uuid.UUID{folder.ID},
+	}).Return([]database.ListTagsForItemsRow{
+		{Kind: search.KindFile, ItemID: file.ID, Name: "urgent"},
+		{Kind: search.KindFile, ItemID: file.ID, Name: "work"},
+		{Kind: search.KindFolder, ItemID: folder.ID, Name: "work"},
+	}, nil)
+
+	page, err := svc.Search(ctx, 1, search.Filters{Tag: " Work "}, "", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"work"}, page.Items[0].Tags)
+	assert.Equal(t, []string{"urgent", "work"}, page.Items[1].Tags)
+	mockQ.AssertExpectations(t)
+}
@@ -1,23 +1,221 @@
 package server
 
 import (
+	"context"
 	"net/http"
+	"time"
 
+	"github.com/bellezhang119/cloud-storage/internal/account"
+	"github.com/bellezhang119/cloud-storage/internal/archive"
 	"github.com/bellezhang119/cloud-storage/internal/auth"
+	"github.com/bellezhang119/cloud-storage/internal/batch"
+	"github.com/bellezhang119/cloud-storage/internal/changes"
+	"github.com/bellezhang119/cloud-storage/internal/dav"
+	"github.com/bellezhang119/cloud-storage/internal/dedupe"
+	"github.com/bellezhang119/cloud-storage/internal/email"
+	"github.com/bellezhang119/cloud-storage/internal/events"
+	"github.com/bellezhang119/cloud-storage/internal/file"
+	"github.com/bellezhang119/cloud-storage/internal/folder"
+	"github.com/bellezhang119/cloud-storage/internal/jobs"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+	"github.com/bellezhang119/cloud-storage/internal/ratelimit"
+	"github.com/bellezhang119/cloud-storage/internal/s3"
+	"github.com/bellezhang119/cloud-storage/internal/search"
+	"github.com/bellezhang119/cloud-storage/internal/sftp"
+	"github.com/bellezhang119/cloud-storage/internal/stats"
+	"github.com/bellezhang119/cloud-storage/internal/tag"
+	"github.com/bellezhang119/cloud-storage/internal/thumbnail"
+	"github.com/bellezhang119/cloud-storage/internal/trash"
+	"github.com/bellezhang119/cloud-storage/internal/user"
 	"github.com/bellezhang119/cloud-storage/internal/util"
 )
 
-func NewRouter(authService *auth.Service) *http.ServeMux {
+func NewRouter(authService *auth.Service, userService *user.Service, accountService *account.Service, searchService *search.Service, fileService *file.Service, folderService *folder.Service, jobQueue *jobs.Queue, tagService *tag.Service, trashService *trash.Service, batchService *batch.Service, pathService *paths.Service, statsService *stats.Service, dedupeService *dedupe.Service, thumbnails *thumbnail.Pipeline, archiveService *archive.Service, davService *dav.Service, s3Service *s3.Service, sftpService *sftp.Service, changesService *changes.Service, eventsService *events.Service, eventTickets *events.Tickets, limiter ratelimit.Limiter, mailer *email.Mailer) *http.ServeMux {
 	mux := http.NewServeMux()
 
-	//protectedHandler := auth.AuthMiddleware(util.VerifyAccessToken)
+	protected := middleware.AuthMiddleware(util.VerifyAccessToken, authService.CheckSession)
+	// WebDAV clients can only send Basic credentials: a password or a personal token
+	davAuth := middleware.BasicAuthMiddleware("cloud-storage", func(ctx context.Context, username, password string) (int32, string, error) {
+		u, err := authService.AuthenticateBasic(ctx, username, password)
+		if err != nil {
+			return 0, "", err
+		}
+		return u.ID, u.Email, nil
+	})
+	adminOnly := func(h http.Handler) http.Handler {
+		return protected(middleware.RequireRole(userService.GetUserRole, user.RoleAdmin)(h))
+	}
+
+	// Rate limits, overridable with "<limit>/<period>" env values
+	byIP := ratelimit.ByIP(ratelimit.ProxyHopsFromEnv())
+	byEmail := ratelimit.ByJSONField("email")
+	byUser := ratelimit.ByUserID()
+
+	loginLimit := ratelimit.Middleware(limiter,
+		ratelimit.Rule{Policy: ratelimit.PolicyFromEnv("RATE_LIMIT_LOGIN_IP", ratelimit.Policy{Name: "login_ip", Limit: 20, Period: time.Minute}), Key: byIP},
+		ratelimit.Rule{Policy: ratelimit.PolicyFromEnv("RATE_LIMIT_LOGIN_EMAIL", ratelimit.Policy{Name: "login_email", Limit: 5, Period: time.Minute}), Key: byEmail},
+	)
+	registerLimit := ratelimit.Middleware(limiter,
+		ratelimit.Rule{Policy: ratelimit.PolicyFromEnv("RATE_LIMIT_REGISTER_IP", ratelimit.Policy{Name: "register_ip", Limit: 5, Period: time.Hour}), Key: byIP},
+	)
+	emailLimit := ratelimit.Middleware(limiter,
+		ratelimit.Rule{Policy: ratelimit.PolicyFromEnv("RATE_LIMIT_EMAIL_IP", ratelimit.Policy{Name: "email_ip", Limit: 10, Period: time.Hour}), Key: byIP},
+		ratelimit.Rule{Policy: ratelimit.PolicyFromEnv("RATE_LIMIT_EMAIL_ADDRESS", ratelimit.Policy{Name: "email_address", Limit: 3, Period: time.Hour}), Key: byEmail},
+	)
+	refreshLimit := ratelimit.Middleware(limiter,
+		ratelimit.Rule{Policy: ratelimit.PolicyFromEnv("RATE_LIMIT_REFRESH_IP", ratelimit.Policy{Name: "refresh_ip", Limit: 60, Period: time.Minute}), Key: byIP},
+	)
+	passwordLimit := ratelimit.Middleware(limiter,
+		ratelimit.Rule{Policy: ratelimit.PolicyFromEnv("RATE_LIMIT_PASSWORD_USER", ratelimit.Policy{Name: "password_user", Limit: 5, Period: time.Hour}), Key: byUser},
+	)
+	emailChangeLimit := ratelimit.Middleware(limiter,
+		ratelimit.Rule{Policy: ratelimit.PolicyFromEnv("RATE_LIMIT_EMAIL_CHANGE_USER", ratelimit.Policy{Name: "email_change_user", Limit: 3, Period: time.Hour}), Key: byUser},
+	)
+	deletionLimit := ratelimit.Middleware(limiter,
+		ratelimit.Rule{Policy: ratelimit.PolicyFromEnv("RATE_LIMIT_DELETION_USER", ratelimit.Policy{Name: "deletion_user", Limit: 5, Period: time.Hour}), Key: byUser},
+	)
+	exportLimit := ratelimit.Middleware(limiter,
+		ratelimit.Rule{Policy: ratelimit.PolicyFromEnv("RATE_LIMIT_EXPORT_USER", ratelimit.Policy{Name: "export_user", Limit: 3, Period: time.Hour}), Key: byUser},
+	)
+	// Every WebDAV request carries credentials and is checked with bcrypt, so
+	// the limit is per request and sized for a client syncing a tree
+	davLimit := ratelimit.Middleware(limiter,
+		ratelimit.Rule{Policy: ratelimit.PolicyFromEnv("RATE_LIMIT_DAV_IP", ratelimit.Policy{Name: "dav_ip", Limit: 300, Period: time.Minute}), Key: byIP},
+	)
 
 	// Auth routes
-	mux.HandleFunc("POST /auth/register", auth.RegisterHandler(authService, util.SendEmail))
+	mux.Handle("POST /auth/register", registerLimit(auth.RegisterHandler(authService, mailer.SendVerification)))
 	mux.HandleFunc("GET /auth/verify", auth.VerifyEmailHandler(authService))
-	mux.HandleFunc("POST /auth/resend-verification", auth.SendVerificationEmailHandler(authService, util.SendEmail))
-	mux.HandleFunc("POST /auth/login", auth.LoginHandler(authService))
-	mux.HandleFunc("POST /auth/refresh", auth.RefreshTokenHandler(authService))
+	mux.Handle("POST /auth/resend-verification", emailLimit(auth.SendVerificationEmailHandler(authService, mailer.SendVerification)))
+	mux.Handle("POST /auth/login", loginLimit(auth.LoginHandler(authService)))
+	mux.Handle("POST /auth/refresh", refreshLimit(auth.RefreshTokenHandler(authService)))
+	mux.Handle("POST /auth/password-reset", emailLimit(auth.RequestPasswordResetHandler(authService, mailer.SendPasswordReset)))
+	mux.HandleFunc("GET /auth/reset-password", auth.PasswordResetPageHandler())
+	mux.HandleFunc("POST /auth/reset-password", auth.ResetPasswordHandler(authService))
+	mux.Handle("POST /auth/email-change", protected(emailChangeLimit(auth.RequestEmailChangeHandler(authService, mailer.SendEmailChange))))
+	mux.HandleFunc("GET /auth/email-change/confirm", auth.EmailChangePageHandler("Change your account's email address to this one?", "Confirm"))
+	mux.HandleFunc("POST /auth/email-change/confirm", auth.ConfirmEmailChangeHandler(authService))
+	mux.HandleFunc("GET /auth/email-change/cancel", auth.EmailChangePageHandler("Cancel the change of your account's email address?", "Cancel the change"))
+	mux.HandleFunc("POST /auth/email-change/cancel", auth.CancelEmailChangeHandler(authService))
+
+	// User routes (own record, or any record for admins)
+	mux.Handle("GET /users/me", protected(user.GetCurrentUserHandler(userService)))
+	mux.Handle("GET /users/email", protected(user.GetUserByEmailHandler(userService)))
+	mux.Handle("GET /users/{id}", protected(user.GetUserByIDHandler(userService)))
+	mux.Handle("PATCH /users/{id}/password", protected(passwordLimit(user.UpdatePasswordHandler(userService))))
+
+	// Account routes (always the caller's own account)
+	mux.Handle("POST /users/me/deletion", protected(deletionLimit(account.RequestDeletionHandler(accountService, mailer.SendAccountDeletionScheduled))))
+	mux.Handle("DELETE /users/me/deletion", protected(account.CancelDeletionHandler(accountService)))
+	mux.Handle("GET /users/me/export", protected(exportLimit(account.ExportHandler(accountService))))
+	mux.Handle("GET /users/me/analytics", protected(stats.AnalyticsHandler(statsService)))
+	mux.Handle("POST /users/me/tokens", protected(auth.CreatePersonalTokenHandler(authService)))
+	mux.Handle("GET /users/me/tokens", protected(auth.ListPersonalTokensHandler(authService)))
+	mux.Handle("DELETE /users/me/tokens/{id}", protected(auth.RevokePersonalTokenHandler(authService)))
+	mux.Handle("POST /users/me/s3-keys", protected(s3.CreateAccessKeyHandler(s3Service)))
+	mux.Handle("GET /users/me/s3-keys", protected(s3.ListAccessKeysHandler(s3Service)))
+	mux.Handle("DELETE /users/me/s3-keys/{id}", protected(s3.DeleteAccessKeyHandler(s3Service)))
+	mux.Handle("POST /users/me/ssh-keys", protected(sftp.AddKeyHandler(sftpService)))
+	mux.Handle("GET /users/me/ssh-keys", protected(sftp.ListKeysHandler(sftpService)))
+	mux.Handle("DELETE /users/me/ssh-keys/{id}", protected(sftp.DeleteKeyHandler(sftpService)))
+
+	// Files
+	mux.Handle("POST /files", protected(file.UploadFileHandler(fileService)))
+	mux.Handle("GET /files", protected(file.ListFilesInFolderHandler(fileService)))
+	mux.Handle("GET /files/{id}/download", protected(file.DownloadFileHandler(fileService)))
+	mux.Handle("PATCH /files/{id}", protected(file.RenameFileHandler(fileService)))
+	mux.Handle("DELETE /files/{id}", protected(file.DeleteFileHandler(fileService)))
+	// Legacy routes taking ?file_id=, kept for older clients
+	mux.Handle("GET /files/download", protected(file.DownloadFileHandler(fileService)))
+	mux.Handle("PATCH /files", protected(file.RenameFileHandler(fileService)))
+	mux.Handle("DELETE /files", protected(file.DeleteFileHandler(fileService)))
+	mux.Handle("POST /files/{id}/copy", protected(file.CopyFileHandler(fileService)))
+	mux.Handle("GET /files/{id}/thumbnails/{size}", protected(thumbnail.ThumbnailHandler(thumbnails)))
+
+	// Looking inside archives
+	mux.Handle("GET /files/{id}/archive", protected(archive.ListEntriesHandler(archiveService)))
+	mux.Handle("GET /files/{id}/archive/entry", protected(archive.EntryHandler(archiveService)))
+	mux.Handle("POST /files/{id}/archive/extract", protected(archive.ExtractHandler(archiveService)))
+	mux.Handle("POST /imports", protected(archive.ImportHandler(archiveService)))
+
+	// Folders
+	mux.Handle("GET /folders", protected(folder.ListFoldersHandler(folderService)))
+	mux.Handle("POST /folders/{id}/copy", protected(folder.CopyFolderHandler(folderService)))
+	mux.Handle("GET /folders/{id}/download", protected(folder.DownloadFolderHandler(folderService)))
+	mux.Handle("GET /folders/{id}/stats", protected(stats.FolderStatsHandler(statsService)))
+
+	// Path-based access, e.g. ?path=/projects/2024/report.pdf
+	mux.Handle("GET /paths/resolve", protected(paths.ResolveHandler(pathService)))
+	mux.Handle("GET /paths/stat", protected(paths.StatHandler(pathService)))
+	mux.Handle("GET /paths/list", protected(paths.ListHandler(pathService)))
+	mux.Handle("GET /paths/download", protected(paths.DownloadHandler(pathService)))
+	mux.Handle("PUT /paths/upload", protected(paths.UploadHandler(pathService)))
+
+	// Multi-select actions and the trash
+	mux.Handle("POST /batch", protected(batch.BatchHandler(batchService)))
+	mux.Handle("POST /batch/download", protected(batch.DownloadHandler(batchService)))
+	mux.Handle("GET /trash", protected(trash.ListTrashHandler(trashService)))
+
+	// Duplicate content
+	mux.Handle("GET /duplicates", protected(dedupe.ListDuplicatesHandler(dedupeService)))
+	mux.Handle("POST /duplicates/resolve", protected(dedupe.ResolveDuplicatesHandler(dedupeService)))
+
+	// Background jobs
+	mux.Handle("GET /jobs/{id}", protected(jobs.GetJobHandler(jobQueue)))
+
+	// Tags and properties
+	mux.Handle("GET /tags", protected(tag.ListTagsHandler(tagService)))
+	mux.Handle("POST /tags", protected(tag.CreateTagHandler(tagService)))
+	mux.Handle("PATCH /tags/{id}", protected(tag.RenameTagHandler(tagService)))
+	mux.Handle("DELETE /tags/{id}", protected(tag.DeleteTagHandler(tagService)))
+	mux.Handle("GET /tags/{id}/items", protected(tag.ListTaggedItemsHandler(tagService)))
+	mux.Handle("POST /tags/apply", protected(tag.BulkTagHandler(tagService, false)))
+	mux.Handle("POST /tags/remove", protected(tag.BulkTagHandler(tagService, true)))
+	mux.Handle("GET /files/{id}/tags", protected(tag.ItemTagsHandler(tagService, tag.KindFile)))
+	mux.Handle("PUT /files/{id}/tags", protected(tag.SetItemTagsHandler(tagService, tag.KindFile)))
+	mux.Handle("GET /files/{id}/properties", protected(tag.PropertiesHandler(tagService, tag.KindFile)))
+	mux.Handle("PUT /files/{id}/properties/{key}", protected(tag.SetPropertyHandler(tagService, tag.KindFile)))
+	mux.Handle("DELETE /files/{id}/properties/{key}", protected(tag.DeletePropertyHandler(tagService, tag.KindFile)))
+	mux.Handle("GET /folders/{id}/tags", protected(tag.ItemTagsHandler(tagService, tag.KindFolder)))
+	mux.Handle("PUT /folders/{id}/tags", protected(tag.SetItemTagsHandler(tagService, tag.KindFolder)))
+	mux.Handle("GET /folders/{id}/properties", protected(tag.PropertiesHandler(tagService, tag.KindFolder)))
+	mux.Handle("PUT /folders/{id}/properties/{key}", protected(tag.SetPropertyHandler(tagService, tag.KindFolder)))
+	mux.Handle("DELETE /folders/{id}/properties/{key}", protected(tag.DeletePropertyHandler(tagService, tag.KindFolder)))
+
+	// WebDAV, every method under the mount
+	mux.Handle(dav.Prefix+"/", davLimit(davAuth(dav.Handler(davService))))
+	mux.Handle(dav.Prefix, davLimit(davAuth(dav.Handler(davService))))
+
+	// S3 gateway, signed with per-user access keys
+	mux.Handle(s3.Prefix+"/", s3.Handler(s3Service))
+	mux.Handle(s3.Prefix, s3.Handler(s3Service))
+
+	// Search
+	mux.Handle("GET /search", protected(search.SearchHandler(searchService)))
+
+	// Change journal for sync clients
+	mux.Handle("GET /changes", protected(changes.ChangesHandler(changesService)))
+	mux.Handle("GET /changes/latest", protected(changes.LatestCursorHandler(changesService)))
+
+	// Live change notifications; browsers can't send headers on these, so
+	// they also take a one-time ticket as ?ticket=
+	streamAuth := middleware.StreamAuthMiddleware(util.VerifyAccessToken, authService.CheckSession, eventTickets.Redeem)
+	mux.Handle("POST /events/tickets", protected(events.TicketHandler(eventTickets)))
+	mux.Handle("GET /events", streamAuth(events.EventsHandler(eventsService)))
+	mux.Handle("GET /events/ws", streamAuth(events.WebSocketHandler(eventsService)))
+
+	// Admin routes
+	mux.Handle("GET /admin/users", adminOnly(user.ListUsersHandler(userService)))
+	mux.Handle("GET /admin/users/{id}", adminOnly(user.GetUserByIDHandler(userService)))
+	mux.Handle("PATCH /admin/users/{id}/role", adminOnly(user.SetRoleHandler(userService)))
+	mux.Handle("PATCH /admin/users/{id}/quota", adminOnly(user.SetQuotaHandler(userService)))
+	mux.Handle("PATCH /admin/users/{id}/storage", adminOnly(user.UpdateStorageHandler(userService)))
+	mux.Handle("POST /admin/users/{id}/disable", adminOnly(user.SetDisabledHandler(userService, true)))
+	mux.Handle("POST /admin/users/{id}/enable", adminOnly(user.SetDisabledHandler(userService, false)))
+	mux.Handle("POST /admin/users/{id}/logout", adminOnly(user.ForceLogoutHandler(userService)))
+	mux.Handle("POST /admin/users/{id}/verify", adminOnly(user.VerifyUserHandler(userService)))
+	mux.Handle("DELETE /admin/users/{id}", adminOnly(user.DeleteUserHandler(userService)))
 
 	// Health checks
 	mux.HandleFunc("GET /ready", func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,128 @@
+package sftp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+)
+
+type KeyServiceInterface interface {
+	AddKey(ctx context.Context, userID int32, name, publicKey string) (database.SshKey, error)
+	ListKeys(ctx context.Context, userID int32) ([]database.SshKey, error)
+	DeleteKey(ctx context.Context, userID int32, id uuid.UUID) error
+}
+
+type AddKeyRequest struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+}
+
+type SSHKeyResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	PublicKey   string     `json:"public_key"`
+	Fingerprint string     `json:"fingerprint"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+}
+
+func NewSSHKeyResponse(k database.SshKey) SSHKeyResponse {
+	res := SSHKeyResponse{
+		ID:          k.ID,
+		Name:        k.Name,
+		PublicKey:   k.PublicKey,
+		Fingerprint: k.Fingerprint,
+		CreatedAt:   k.CreatedAt,
+	}
+	if k.LastUsedAt.Valid {
+		res.LastUsedAt = &k.LastUsedAt.Time
+	}
+	return res
+}
+
+func AddKeyHandler(service KeyServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req AddKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		key, err := service.AddKey(r.Context(), userID, req.Name, req.PublicKey)
+		switch {
+		case errors.Is(err, ErrKeyInvalid), errors.Is(err, ErrKeyNameEmpty):
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, ErrKeyExists), errors.Is(err, ErrKeyLimit):
+			util.RespondWithError(w, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to add SSH key")
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusCreated, NewSSHKeyResponse(key))
+	}
+}
+
+func ListKeysHandler(service KeyServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		keys, err := service.ListKeys(r.Context(), userID)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to list SSH keys")
+			return
+		}
+
+		res := make([]SSHKeyResponse, 0, len(keys))
+		for _, k := range keys {
+			res = append(res, NewSSHKeyResponse(k))
+		}
+		util.RespondWithJSON(w, http.StatusOK, res)
+	}
+}
+
+func DeleteKeyHandler(service KeyServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid SSH key ID")
+			return
+		}
+
+		if err := service.DeleteKey(r.Context(), userID, id); err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				util.RespondWithError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			util.RespondWithError(w, http.StatusInternalServerError, "Failed to delete SSH key")
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "SSH key deleted"})
+	}
+}
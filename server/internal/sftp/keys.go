@@ -0,0 +1,80 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// MaxSSHKeys bounds how many public keys one user may register.
+const MaxSSHKeys = 20
+
+var (
+	ErrKeyNotFound  = errors.New("SSH key not found")
+	ErrKeyLimit     = errors.New("too many SSH keys")
+	ErrKeyInvalid   = errors.New("public key must be one line in authorized_keys format")
+	ErrKeyExists    = errors.New("SSH key is already registered")
+	ErrKeyNameEmpty = errors.New("SSH key name is required")
+)
+
+// AddKey registers a public key given as an authorized_keys line. Without a
+// name, the line's comment is used.
+func (s *Service) AddKey(ctx context.Context, userID int32, name, publicKey string) (database.SshKey, error) {
+	key, comment, options, rest, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(publicKey)))
+	if err != nil || len(options) > 0 || len(rest) > 0 {
+		return database.SshKey{}, ErrKeyInvalid
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = comment
+	}
+	if name == "" {
+		return database.SshKey{}, ErrKeyNameEmpty
+	}
+
+	existing, err := s.queries.ListSSHKeys(ctx, userID)
+	if err != nil {
+		return database.SshKey{}, fmt.Errorf("listing SSH keys: %w", err)
+	}
+	if len(existing) >= MaxSSHKeys {
+		return database.SshKey{}, ErrKeyLimit
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+	for _, k := range existing {
+		if k.Fingerprint == fingerprint {
+			return database.SshKey{}, ErrKeyExists
+		}
+	}
+
+	row, err := s.queries.CreateSSHKey(ctx, database.CreateSSHKeyParams{
+		UserID: userID,
+		Name:   name,
+		// Stored without the comment, which the name replaces
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+		Fingerprint: fingerprint,
+	})
+	if err != nil {
+		return database.SshKey{}, fmt.Errorf("creating SSH key: %w", err)
+	}
+	return row, nil
+}
+
+func (s *Service) ListKeys(ctx context.Context, userID int32) ([]database.SshKey, error) {
+	return s.queries.ListSSHKeys(ctx, userID)
+}
+
+func (s *Service) DeleteKey(ctx context.Context, userID int32, id uuid.UUID) error {
+	rows, err := s.queries.DeleteSSHKey(ctx, database.DeleteSSHKeyParams{ID: id, UserID: userID})
+	if err != nil {
+		return fmt.Errorf("deleting SSH key: %w", err)
+	}
+	if rows == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+)
+
+// The subset of SFTP version 3 (draft-ietf-secsh-filexfer-02) the server
+// speaks, which is what OpenSSH and most other clients use.
+const protocolVersion = 3
+
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpLstat    = 7
+	fxpFstat    = 8
+	fxpSetstat  = 9
+	fxpFsetstat = 10
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpRmdir    = 15
+	fxpRealpath = 16
+	fxpStat     = 17
+	fxpRename   = 18
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+)
+
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+	fxFailure          = 4
+	fxBadMessage       = 5
+	fxOpUnsupported    = 8
+)
+
+// Flags of SSH_FXP_OPEN.
+const (
+	flagRead   = 0x01
+	flagWrite  = 0x02
+	flagAppend = 0x04
+	flagCreate = 0x08
+	flagTrunc  = 0x10
+	flagExcl   = 0x20
+)
+
+// Flags saying which attributes are present.
+const (
+	attrSize        = 0x01
+	attrUIDGID      = 0x02
+	attrPermissions = 0x04
+	attrACModTime   = 0x08
+	attrExtended    = 0x80000000
+)
+
+const (
+	modeDir  = 0o040000
+	modeFile = 0o100000
+)
+
+// maxPacket bounds a packet's length. Clients write in chunks of 32KiB to
+// 256KiB, so this leaves room for the largest of them.
+const maxPacket = 1 << 20
+
+var errBadPacket = errors.New("malformed packet")
+
+// reader decodes the fields of one packet.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errBadPacket
+		return nil
+	}
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *reader) uint32() uint32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *reader) uint64() uint64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *reader) bytes() []byte {
+	n := r.uint32()
+	return r.take(int(n))
+}
+
+func (r *reader) string() string {
+	return string(r.bytes())
+}
+
+// attrs are the attributes a client sends with OPEN, MKDIR and SETSTAT.
+// Only the size means anything here; the rest is read to skip it.
+type attrs struct {
+	flags uint32
+	size  uint64
+}
+
+func (r *reader) attrs() attrs {
+	a := attrs{flags: r.uint32()}
+	if a.flags&attrSize != 0 {
+		a.size = r.uint64()
+	}
+	if a.flags&attrUIDGID != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if a.flags&attrPermissions != 0 {
+		r.uint32()
+	}
+	if a.flags&attrACModTime != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if a.flags&attrExtended != 0 {
+		for n := r.uint32(); n > 0 && r.err == nil; n-- {
+			r.string()
+			r.string()
+		}
+	}
+	return a
+}
+
+// writer builds one packet, leaving room for the length in front.
+type writer struct {
+	b []byte
+}
+
+func newPacket(kind byte, id uint32) *writer {
+	w := &writer{b: make([]byte, 4, 64)}
+	w.b = append(w.b, kind)
+	w.uint32(id)
+	return w
+}
+
+func (w *writer) uint32(v uint32) {
+	w.b = binary.BigEndian.AppendUint32(w.b, v)
+}
+
+func (w *writer) uint64(v uint64) {
+	w.b = binary.BigEndian.AppendUint64(w.b, v)
+}
+
+func (w *writer) string(s string) {
+	w.uint32(uint32(len(s)))
+	w.b = append(w.b, s...)
+}
+
+func (w *writer) bytes(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.b = append(w.b, b...)
+}
+
+// info is what the server reports about a file or folder.
+type info struct {
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+func entryInfo(e paths.Entry) info {
+	i := info{name: e.Name, dir: e.Kind == paths.KindFolder}
+	if i.name == "" {
+		i.name = "/"
+	}
+	if e.SizeBytes != nil {
+		i.size = *e.SizeBytes
+	}
+	switch {
+	case e.UpdatedAt != nil:
+		i.modTime = *e.UpdatedAt
+	case e.CreatedAt != nil:
+		i.modTime = *e.CreatedAt
+	}
+	return i
+}
+
+func (i info) mode() uint32 {
+	if i.dir {
+		return modeDir | 0o755
+	}
+	return modeFile | 0o644
+}
+
+func (w *writer) attrs(i info) {
+	w.uint32(attrSize | attrPermissions | attrACModTime)
+	w.uint64(uint64(i.size))
+	w.uint32(i.mode())
+	mtime := uint32(i.modTime.Unix())
+	w.uint32(mtime)
+	w.uint32(mtime)
+}
+
+// longName is the ls -l style line clients show for a listing.
+func longName(i info, owner string, now time.Time) string {
+	perms := os.FileMode(i.mode() & 0o777).String()
+	if i.dir {
+		perms = "d" + perms[1:]
+	}
+	stamp := i.modTime.Format("Jan _2 15:04")
+	if i.modTime.Before(now.AddDate(0, -6, 0)) || i.modTime.After(now) {
+		stamp = i.modTime.Format("Jan _2  2006")
+	}
+	return fmt.Sprintf("%s    1 %-8s %-8s %8d %s %s", perms, owner, owner, i.size, stamp, i.name)
+}
+
+// readPacket reads one packet, returning its type and body.
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(head[:])
+	if n == 0 || n > maxPacket {
+		return 0, nil, fmt.Errorf("packet of %d bytes", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return body[0], body[1:], nil
+}
+
+func (w *writer) send(out io.Writer) error {
+	binary.BigEndian.PutUint32(w.b, uint32(len(w.b)-4))
+	_, err := out.Write(w.b)
+	return err
+}
@@ -0,0 +1,242 @@
+package sftp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/ratelimit"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// Keys of the ssh.Permissions extensions that carry who signed in, from
+// the authentication callbacks to the connection handler.
+const (
+	extUserID = "user-id"
+	extKeyID  = "ssh-key-id"
+)
+
+// handshakeTimeout bounds how long a client may take to authenticate.
+const handshakeTimeout = 30 * time.Second
+
+var (
+	errDisabled        = errors.New("account is disabled")
+	errTooManyAttempts = errors.New("too many password attempts")
+)
+
+// LoadHostKey reads the server's private host key from keyPath, generating
+// and saving an Ed25519 key there on first start, so clients see the same
+// host key across restarts.
+func LoadHostKey(keyPath string) (ssh.Signer, error) {
+	data, err := os.ReadFile(keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("generating host key: %w", err)
+		}
+		block, err := ssh.MarshalPrivateKey(priv, "")
+		if err != nil {
+			return nil, fmt.Errorf("encoding host key: %w", err)
+		}
+		data = pem.EncodeToMemory(block)
+		if err := os.WriteFile(keyPath, data, 0o600); err != nil {
+			return nil, fmt.Errorf("saving host key: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("reading host key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing host key: %w", err)
+	}
+	return signer, nil
+}
+
+// Server accepts SSH connections and serves SFTP on them. Shells, commands
+// and forwarding are all refused.
+type Server struct {
+	service *Service
+	config  *ssh.ServerConfig
+	limiter ratelimit.Limiter
+	policy  ratelimit.Policy
+}
+
+func NewServer(service *Service, hostKey ssh.Signer) *Server {
+	srv := &Server{service: service}
+	srv.config = &ssh.ServerConfig{
+		PasswordCallback:  srv.checkPassword,
+		PublicKeyCallback: srv.checkPublicKey,
+		ServerVersion:     "SSH-2.0-cloud-storage",
+	}
+	srv.config.AddHostKey(hostKey)
+	return srv
+}
+
+// LimitPasswords caps password attempts per client address, as the login
+// route does, since each one costs a bcrypt comparison. Key logins are not
+// counted.
+func (srv *Server) LimitPasswords(limiter ratelimit.Limiter, policy ratelimit.Policy) {
+	srv.limiter = limiter
+	srv.policy = policy
+}
+
+func permissions(userID int32) *ssh.Permissions {
+	return &ssh.Permissions{Extensions: map[string]string{extUserID: strconv.Itoa(int(userID))}}
+}
+
+// checkPassword accepts the account password or a personal token, which
+// lets accounts that sign in through a provider use SFTP too.
+func (srv *Server) checkPassword(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	ctx := context.Background()
+	if srv.limiter != nil {
+		host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err != nil {
+			host = conn.RemoteAddr().String()
+		}
+		// Limiter errors fail open, like ratelimit.Middleware
+		res, err := srv.limiter.Allow(ctx, "ip:"+host, srv.policy)
+		if err != nil {
+			log.Printf("rate limiter error for %s: %v", srv.policy.Name, err)
+		} else if !res.Allowed {
+			return nil, errTooManyAttempts
+		}
+	}
+
+	user, err := srv.service.auth.AuthenticateBasic(ctx, conn.User(), string(password))
+	if err != nil {
+		return nil, err
+	}
+	return permissions(user.ID), nil
+}
+
+// checkPublicKey looks the key up among the user's registered keys. The
+// ssh package calls it before checking the client's signature, so the key
+// is only recorded as used once the connection is established.
+func (srv *Server) checkPublicKey(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	ctx := context.Background()
+	user, err := srv.service.queries.GetUserByEmail(ctx, conn.User())
+	if err != nil {
+		return nil, fmt.Errorf("unknown user %q", conn.User())
+	}
+	k, err := srv.service.queries.GetSSHKeyByFingerprint(ctx, database.GetSSHKeyByFingerprintParams{
+		UserID:      user.ID,
+		Fingerprint: ssh.FingerprintSHA256(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("key not registered for %q", conn.User())
+	}
+	if user.IsDisabled {
+		return nil, errDisabled
+	}
+
+	perms := permissions(user.ID)
+	perms.Extensions[extKeyID] = k.ID.String()
+	return perms, nil
+}
+
+// ListenAndServe listens on addr and serves connections until the listener
+// fails.
+func (srv *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(l)
+}
+
+func (srv *Server) Serve(l net.Listener) error {
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go srv.ServeConn(conn)
+	}
+}
+
+// ServeConn runs the SSH handshake on conn and serves its sessions until
+// the client disconnects.
+func (srv *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, srv.config)
+	if err != nil {
+		return
+	}
+	defer sshConn.Close()
+	conn.SetDeadline(time.Time{})
+
+	userID, err := strconv.Atoi(sshConn.Permissions.Extensions[extUserID])
+	if err != nil {
+		return
+	}
+	if keyID, err := uuid.Parse(sshConn.Permissions.Extensions[extKeyID]); err == nil {
+		if _, err := srv.service.queries.TouchSSHKey(context.Background(), keyID); err != nil {
+			log.Printf("recording use of SSH key %s: %v", keyID, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go srv.serveSession(ctx, int32(userID), sshConn.User(), ch, chReqs)
+	}
+}
+
+// serveSession waits for the client to ask for the sftp subsystem. Any
+// other request, such as a shell or a command, is refused.
+func (srv *Server) serveSession(ctx context.Context, userID int32, login string, ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+	started := false
+	for req := range reqs {
+		ok := false
+		if req.Type == "subsystem" && !started {
+			var payload struct{ Name string }
+			ok = ssh.Unmarshal(req.Payload, &payload) == nil && payload.Name == "sftp"
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+		if !ok {
+			continue
+		}
+
+		started = true
+		go func() {
+			err := srv.service.Serve(ctx, userID, login, ch)
+			if err != nil && !errors.Is(err, io.EOF) {
+				log.Printf("sftp session for user %d: %v", userID, err)
+			}
+			ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+			ch.Close()
+		}()
+	}
+}
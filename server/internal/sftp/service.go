@@ -0,0 +1,72 @@
+// Package sftp runs an embedded SSH server whose only subsystem is SFTP, so
+// partners that can only deliver over SFTP reach the same tree as the REST
+// API. Each user is confined to their own tree, which appears as the root of
+// the file system, and every operation goes through the path, file and
+// folder services so metadata, quotas and activity stay correct.
+package sftp
+
+import (
+	"context"
+	"io"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+	"github.com/google/uuid"
+)
+
+type Queries interface {
+	quota.Queries
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+
+	CreateSSHKey(ctx context.Context, arg database.CreateSSHKeyParams) (database.SshKey, error)
+	ListSSHKeys(ctx context.Context, userID int32) ([]database.SshKey, error)
+	GetSSHKeyByFingerprint(ctx context.Context, arg database.GetSSHKeyByFingerprintParams) (database.SshKey, error)
+	TouchSSHKey(ctx context.Context, id uuid.UUID) (int64, error)
+	DeleteSSHKey(ctx context.Context, arg database.DeleteSSHKeyParams) (int64, error)
+}
+
+// Authenticator checks a user name and password, the way Basic auth is
+// checked: failed attempts count towards the account lockout.
+type Authenticator interface {
+	AuthenticateBasic(ctx context.Context, email, password string) (database.User, error)
+}
+
+type PathService interface {
+	Resolve(ctx context.Context, userID int32, p string) (paths.Entry, error)
+	List(ctx context.Context, userID int32, p string) (paths.Entry, []paths.Entry, error)
+	Upload(ctx context.Context, userID int32, p string, sizeBytes int64, content io.Reader) (paths.Entry, error)
+}
+
+type FileService interface {
+	GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error)
+	GetFileForDownload(ctx context.Context, fileID uuid.UUID, userID int32) (database.File, io.ReadCloser, error)
+	DeleteFile(ctx context.Context, fileID uuid.UUID, userID int32) error
+	MoveFile(ctx context.Context, file database.File, destFolderID *uuid.UUID, userID int32) error
+	RenameFile(ctx context.Context, file database.File, newName string, userID int32) error
+}
+
+type FolderService interface {
+	CreateFolder(ctx context.Context, userID int32, name string, parentID uuid.NullUUID) (database.Folder, error)
+	DeleteFolder(ctx context.Context, folderID uuid.UUID, userID int32) error
+	MoveFolder(ctx context.Context, folderID uuid.UUID, newParentID uuid.NullUUID, userID int32) error
+	RenameFolder(ctx context.Context, folderID uuid.UUID, newName string, userID int32) error
+}
+
+type Service struct {
+	queries Queries
+	auth    Authenticator
+	paths   PathService
+	files   FileService
+	folders FolderService
+}
+
+func NewService(q Queries, auth Authenticator, p PathService, files FileService, folders FolderService) *Service {
+	return &Service{queries: q, auth: auth, paths: p, files: files, folders: folders}
+}
+
+// CheckUpload fails with quota.ErrExceeded when storing sizeBytes at p would
+// take the user past their quota, allowing for the file it replaces.
+func (s *Service) CheckUpload(ctx context.Context, userID int32, p string, sizeBytes int64) error {
+	return paths.CheckUpload(ctx, s.paths, s.queries, userID, p, sizeBytes)
+}
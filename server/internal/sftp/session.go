@@ -0,0 +1,705 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+	"github.com/bellezhang119/cloud-storage/internal/quota"
+)
+
+// maxHandles bounds how many files and folders one session may hold open,
+// since every file open for writing is buffered on disk.
+const maxHandles = 64
+
+// maxRead bounds the data returned by one READ; clients ask again for the
+// rest.
+const maxRead = 1 << 18
+
+// readdirBatch is how many names one READDIR returns.
+const readdirBatch = 100
+
+// statusError is a failure reported to the client with a particular code.
+type statusError struct {
+	code uint32
+	msg  string
+}
+
+func (e *statusError) Error() string { return e.msg }
+
+var (
+	errNoSuchFile   = &statusError{fxNoSuchFile, "no such file or folder"}
+	errDenied       = &statusError{fxPermissionDenied, "permission denied"}
+	errExists       = &statusError{fxFailure, "file or folder already exists"}
+	errIsFolder     = &statusError{fxFailure, "is a folder"}
+	errNotFolder    = &statusError{fxFailure, "not a folder"}
+	errNotEmpty     = &statusError{fxFailure, "folder is not empty"}
+	errBadHandle    = &statusError{fxFailure, "invalid handle"}
+	errTooMany      = &statusError{fxFailure, "too many open handles"}
+	errUnsupported  = &statusError{fxOpUnsupported, "operation not supported"}
+	errReadOnly     = &statusError{fxPermissionDenied, "file is not open for writing"}
+	errWriteOnly    = &statusError{fxPermissionDenied, "file is not open for reading"}
+	errQuotaReached = &statusError{fxFailure, quota.ErrExceeded.Error()}
+)
+
+// session serves one client's SFTP requests, one at a time and in order.
+type session struct {
+	s      *Service
+	ctx    context.Context
+	userID int32
+	login  string
+	out    io.Writer
+
+	handles map[string]handle
+	next    uint64
+}
+
+type handle interface {
+	// close releases the handle. Unless abort is set, content written
+	// through it is stored first.
+	close(abort bool) error
+}
+
+// Serve speaks SFTP on rw for the user until the client goes away. The
+// user's tree is the root of everything the client sees.
+func (s *Service) Serve(ctx context.Context, userID int32, login string, rw io.ReadWriter) error {
+	sess := &session{s: s, ctx: ctx, userID: userID, login: login, out: rw, handles: map[string]handle{}}
+	defer func() {
+		// Uploads the client didn't close are abandoned, not stored
+		for _, h := range sess.handles {
+			h.close(true)
+		}
+	}()
+
+	kind, body, err := readPacket(rw)
+	if err != nil {
+		return err
+	}
+	if kind != fxpInit {
+		return fmt.Errorf("expected init, got packet type %d", kind)
+	}
+	r := &reader{b: body}
+	if r.uint32(); r.err != nil {
+		return r.err
+	}
+	w := &writer{b: make([]byte, 4, 16)}
+	w.b = append(w.b, fxpVersion)
+	w.uint32(protocolVersion)
+	if err := w.send(rw); err != nil {
+		return err
+	}
+
+	for {
+		kind, body, err := readPacket(rw)
+		if err != nil {
+			return err
+		}
+		if err := sess.handle(kind, body); err != nil {
+			return err
+		}
+	}
+}
+
+// clean turns a client path into one in the user's tree. Relative paths
+// start at the root, and ".." can't climb above it.
+func clean(p string) string {
+	return path.Clean("/" + p)
+}
+
+// handle dispatches one request and sends its response.
+func (sess *session) handle(kind byte, body []byte) error {
+	r := &reader{b: body}
+	id := r.uint32()
+	if r.err != nil {
+		return r.err
+	}
+
+	var reply *writer
+	var err error
+	switch kind {
+	case fxpRealpath:
+		reply, err = sess.realpath(id, clean(r.string()), r)
+	case fxpStat, fxpLstat:
+		reply, err = sess.stat(id, clean(r.string()), r)
+	case fxpFstat:
+		reply, err = sess.fstat(id, r.string(), r)
+	case fxpOpendir:
+		reply, err = sess.opendir(id, clean(r.string()), r)
+	case fxpReaddir:
+		reply, err = sess.readdir(id, r.string(), r)
+	case fxpOpen:
+		name := clean(r.string())
+		flags := r.uint32()
+		r.attrs()
+		reply, err = sess.open(id, name, flags, r)
+	case fxpRead:
+		h := r.string()
+		offset := r.uint64()
+		length := r.uint32()
+		reply, err = sess.read(id, h, offset, length, r)
+	case fxpWrite:
+		h := r.string()
+		offset := r.uint64()
+		data := r.bytes()
+		err = sess.write(h, offset, data, r)
+	case fxpClose:
+		err = sess.closeHandle(r.string(), r)
+	case fxpSetstat:
+		name := clean(r.string())
+		err = sess.setstat(name, r.attrs(), r)
+	case fxpFsetstat:
+		h := r.string()
+		err = sess.fsetstat(h, r.attrs(), r)
+	case fxpMkdir:
+		name := clean(r.string())
+		r.attrs()
+		err = sess.mkdir(name, r)
+	case fxpRmdir:
+		err = sess.rmdir(clean(r.string()), r)
+	case fxpRemove:
+		err = sess.remove(clean(r.string()), r)
+	case fxpRename:
+		oldName := clean(r.string())
+		newName := clean(r.string())
+		err = sess.rename(oldName, newName, r)
+	default:
+		// READLINK, SYMLINK and extensions
+		err = errUnsupported
+	}
+
+	if err != nil {
+		reply = sess.status(id, err)
+	} else if reply == nil {
+		reply = statusPacket(id, fxOK, "")
+	}
+	return reply.send(sess.out)
+}
+
+func statusPacket(id, code uint32, msg string) *writer {
+	w := newPacket(fxpStatus, id)
+	w.uint32(code)
+	w.string(msg)
+	w.string("en")
+	return w
+}
+
+// status reports err, keeping the details of unexpected failures out of
+// the client's sight.
+func (sess *session) status(id uint32, err error) *writer {
+	var se *statusError
+	switch {
+	case errors.As(err, &se):
+		return statusPacket(id, se.code, se.msg)
+	case errors.Is(err, errBadPacket):
+		return statusPacket(id, fxBadMessage, err.Error())
+	case errors.Is(err, io.EOF):
+		return statusPacket(id, fxEOF, "end of file")
+	case errors.Is(err, quota.ErrExceeded):
+		return statusPacket(id, errQuotaReached.code, errQuotaReached.msg)
+	}
+	log.Printf("sftp request for user %d: %v", sess.userID, err)
+	return statusPacket(id, fxFailure, "failure")
+}
+
+// resolve looks p up, reporting a missing or malformed path as no such
+// file.
+func (sess *session) resolve(p string) (paths.Entry, error) {
+	e, err := sess.s.paths.Resolve(sess.ctx, sess.userID, p)
+	if errors.Is(err, paths.ErrNotFound) || errors.Is(err, paths.ErrInvalidPath) {
+		return paths.Entry{}, errNoSuchFile
+	}
+	return e, err
+}
+
+// parent resolves the folder p would be created in.
+func (sess *session) parent(p string) (paths.Entry, string, error) {
+	if p == "/" {
+		return paths.Entry{}, "", errDenied
+	}
+	dir, base := path.Split(p)
+	parent, err := sess.resolve(dir)
+	if err != nil {
+		return paths.Entry{}, "", err
+	}
+	if parent.Kind != paths.KindFolder {
+		return paths.Entry{}, "", errNoSuchFile
+	}
+	return parent, base, nil
+}
+
+func (sess *session) realpath(id uint32, p string, r *reader) (*writer, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	w := newPacket(fxpName, id)
+	w.uint32(1)
+	w.string(p)
+	w.string(p)
+	w.uint32(0)
+	return w, nil
+}
+
+func attrsPacket(id uint32, i info) *writer {
+	w := newPacket(fxpAttrs, id)
+	w.attrs(i)
+	return w
+}
+
+func (sess *session) stat(id uint32, p string, r *reader) (*writer, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	e, err := sess.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	return attrsPacket(id, entryInfo(e)), nil
+}
+
+// add registers an open handle and names it.
+func (sess *session) add(h handle) (string, error) {
+	if len(sess.handles) >= maxHandles {
+		h.close(true)
+		return "", errTooMany
+	}
+	sess.next++
+	name := strconv.FormatUint(sess.next, 10)
+	sess.handles[name] = h
+	return name, nil
+}
+
+func handlePacket(id uint32, name string) *writer {
+	w := newPacket(fxpHandle, id)
+	w.string(name)
+	return w
+}
+
+func (sess *session) fstat(id uint32, name string, r *reader) (*writer, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	switch h := sess.handles[name].(type) {
+	case *dirHandle:
+		return attrsPacket(id, entryInfo(h.entry)), nil
+	case *fileHandle:
+		i, err := h.info()
+		if err != nil {
+			return nil, err
+		}
+		return attrsPacket(id, i), nil
+	}
+	return nil, errBadHandle
+}
+
+// dirHandle is an open folder. Its children are read when it is opened and
+// handed out a batch at a time.
+type dirHandle struct {
+	entry    paths.Entry
+	children []paths.Entry
+}
+
+func (d *dirHandle) close(abort bool) error { return nil }
+
+func (sess *session) opendir(id uint32, p string, r *reader) (*writer, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	e, err := sess.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	if e.Kind != paths.KindFolder {
+		return nil, errNotFolder
+	}
+	_, children, err := sess.s.paths.List(sess.ctx, sess.userID, e.Path)
+	if err != nil {
+		return nil, err
+	}
+	name, err := sess.add(&dirHandle{entry: e, children: children})
+	if err != nil {
+		return nil, err
+	}
+	return handlePacket(id, name), nil
+}
+
+func (sess *session) readdir(id uint32, name string, r *reader) (*writer, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	d, ok := sess.handles[name].(*dirHandle)
+	if !ok {
+		return nil, errBadHandle
+	}
+	if len(d.children) == 0 {
+		return nil, io.EOF
+	}
+
+	batch := d.children[:min(readdirBatch, len(d.children))]
+	d.children = d.children[len(batch):]
+	now := time.Now()
+	w := newPacket(fxpName, id)
+	w.uint32(uint32(len(batch)))
+	for _, e := range batch {
+		i := entryInfo(e)
+		w.string(i.name)
+		w.string(longName(i, sess.login, now))
+		w.attrs(i)
+	}
+	return w, nil
+}
+
+// fileHandle is an open file. Files opened for reading read the stored
+// content; files opened for writing are buffered in a temporary file and
+// stored as a whole when closed, since stored files can only be replaced.
+type fileHandle struct {
+	sess  *session
+	name  string
+	entry paths.Entry
+
+	readable bool
+	content  io.ReaderAt
+	closers  []func() error
+
+	// Set when open for writing
+	tmp        *os.File
+	appendMode bool
+	// Whether closing has to store the buffer: the file is new, was
+	// truncated or has been written to
+	dirty bool
+}
+
+func (f *fileHandle) info() (info, error) {
+	if f.tmp == nil {
+		return entryInfo(f.entry), nil
+	}
+	st, err := f.tmp.Stat()
+	if err != nil {
+		return info{}, err
+	}
+	return info{name: path.Base(f.name), size: st.Size(), modTime: st.ModTime()}, nil
+}
+
+func (f *fileHandle) release() error {
+	var first error
+	for i := len(f.closers) - 1; i >= 0; i-- {
+		if err := f.closers[i](); err != nil && first == nil {
+			first = err
+		}
+	}
+	f.closers = nil
+	return first
+}
+
+func (f *fileHandle) close(abort bool) error {
+	defer f.release()
+	if abort || f.tmp == nil || !f.dirty {
+		return nil
+	}
+
+	st, err := f.tmp.Stat()
+	if err != nil {
+		return fmt.Errorf("buffering upload: %w", err)
+	}
+	if _, err := f.tmp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("buffering upload: %w", err)
+	}
+	ctx, userID := f.sess.ctx, f.sess.userID
+	if err := f.sess.s.CheckUpload(ctx, userID, f.name, st.Size()); err != nil {
+		return err
+	}
+	if _, err := f.sess.s.paths.Upload(ctx, userID, f.name, st.Size(), f.tmp); err != nil {
+		return err
+	}
+	return nil
+}
+
+// spool copies a stored file's content into a temporary file, for reading
+// at offsets or for editing in place.
+func (f *fileHandle) spool(rc io.Reader) (*os.File, error) {
+	tmp, err := os.CreateTemp("", "sftp-*")
+	if err != nil {
+		return nil, fmt.Errorf("buffering file: %w", err)
+	}
+	f.closers = append(f.closers, func() error { tmp.Close(); return os.Remove(tmp.Name()) })
+	if rc != nil {
+		if _, err := io.Copy(tmp, rc); err != nil {
+			return nil, fmt.Errorf("buffering file: %w", err)
+		}
+	}
+	return tmp, nil
+}
+
+func (sess *session) open(id uint32, p string, flags uint32, r *reader) (*writer, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	e, err := sess.resolve(p)
+	exists := err == nil
+	switch {
+	case err != nil && err != errNoSuchFile:
+		return nil, err
+	case exists && e.Kind == paths.KindFolder:
+		return nil, errIsFolder
+	}
+
+	writing := flags&(flagWrite|flagAppend) != 0
+	f := &fileHandle{sess: sess, name: p, entry: e, readable: flags&flagRead != 0 || !writing}
+	if !writing {
+		if !exists {
+			return nil, errNoSuchFile
+		}
+		if err := f.openForRead(); err != nil {
+			f.release()
+			return nil, err
+		}
+	} else {
+		switch {
+		case exists && flags&flagCreate != 0 && flags&flagExcl != 0:
+			return nil, errExists
+		case !exists && flags&flagCreate == 0:
+			return nil, errNoSuchFile
+		}
+		if _, _, err := sess.parent(p); err != nil {
+			return nil, err
+		}
+		// Writes that don't truncate edit the current content
+		if err := f.openForWrite(exists && flags&flagTrunc == 0); err != nil {
+			f.release()
+			return nil, err
+		}
+		f.appendMode = flags&flagAppend != 0
+		f.dirty = !exists || flags&flagTrunc != 0
+	}
+
+	name, err := sess.add(f)
+	if err != nil {
+		return nil, err
+	}
+	return handlePacket(id, name), nil
+}
+
+// openForRead opens the stored content for reading at offsets.
+func (f *fileHandle) openForRead() error {
+	_, body, err := f.sess.s.files.GetFileForDownload(f.sess.ctx, *f.entry.ID, f.sess.userID)
+	if err != nil {
+		return err
+	}
+	f.closers = append(f.closers, body.Close)
+	if ra, ok := body.(io.ReaderAt); ok {
+		f.content = ra
+		return nil
+	}
+
+	// Spool storage that can't read at offsets
+	tmp, err := f.spool(body)
+	if err != nil {
+		return err
+	}
+	f.content = tmp
+	return nil
+}
+
+// openForWrite starts the buffer the file is written to, seeded with the
+// stored content when keep is set.
+func (f *fileHandle) openForWrite(keep bool) error {
+	var body io.Reader
+	if keep {
+		_, rc, err := f.sess.s.files.GetFileForDownload(f.sess.ctx, *f.entry.ID, f.sess.userID)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		body = rc
+	}
+	tmp, err := f.spool(body)
+	if err != nil {
+		return err
+	}
+	f.tmp, f.content = tmp, tmp
+	return nil
+}
+
+func (sess *session) read(id uint32, name string, offset uint64, length uint32, r *reader) (*writer, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	f, ok := sess.handles[name].(*fileHandle)
+	if !ok {
+		return nil, errBadHandle
+	}
+	if !f.readable {
+		return nil, errWriteOnly
+	}
+
+	buf := make([]byte, min(length, maxRead))
+	n, err := f.content.ReadAt(buf, int64(offset))
+	if n == 0 && err != nil {
+		return nil, err
+	}
+	w := newPacket(fxpData, id)
+	w.bytes(buf[:n])
+	return w, nil
+}
+
+func (sess *session) write(name string, offset uint64, data []byte, r *reader) error {
+	if r.err != nil {
+		return r.err
+	}
+	f, ok := sess.handles[name].(*fileHandle)
+	if !ok {
+		return errBadHandle
+	}
+	if f.tmp == nil {
+		return errReadOnly
+	}
+
+	at := int64(offset)
+	if f.appendMode {
+		st, err := f.tmp.Stat()
+		if err != nil {
+			return err
+		}
+		at = st.Size()
+	}
+	if _, err := f.tmp.WriteAt(data, at); err != nil {
+		return fmt.Errorf("buffering upload: %w", err)
+	}
+	f.dirty = true
+	return nil
+}
+
+func (sess *session) closeHandle(name string, r *reader) error {
+	if r.err != nil {
+		return r.err
+	}
+	h, ok := sess.handles[name]
+	if !ok {
+		return errBadHandle
+	}
+	delete(sess.handles, name)
+	return h.close(false)
+}
+
+// setstat accepts and ignores permissions, owners and times, which the tree
+// doesn't keep, so clients that preserve them still succeed. Sizes can only
+// be changed through an open handle.
+func (sess *session) setstat(p string, a attrs, r *reader) error {
+	if r.err != nil {
+		return r.err
+	}
+	if _, err := sess.resolve(p); err != nil {
+		return err
+	}
+	if a.flags&attrSize != 0 {
+		return errUnsupported
+	}
+	return nil
+}
+
+func (sess *session) fsetstat(name string, a attrs, r *reader) error {
+	if r.err != nil {
+		return r.err
+	}
+	h, ok := sess.handles[name]
+	if !ok {
+		return errBadHandle
+	}
+	if a.flags&attrSize == 0 {
+		return nil
+	}
+	f, ok := h.(*fileHandle)
+	if !ok || f.tmp == nil {
+		return errReadOnly
+	}
+	if err := f.tmp.Truncate(int64(a.size)); err != nil {
+		return fmt.Errorf("buffering upload: %w", err)
+	}
+	f.dirty = true
+	return nil
+}
+
+func (sess *session) mkdir(p string, r *reader) error {
+	if r.err != nil {
+		return r.err
+	}
+	if _, err := sess.resolve(p); err == nil {
+		return errExists
+	} else if err != errNoSuchFile {
+		return err
+	}
+	parent, base, err := sess.parent(p)
+	if err != nil {
+		return err
+	}
+	_, err = sess.s.folders.CreateFolder(sess.ctx, sess.userID, base, paths.NullID(parent.ID))
+	return err
+}
+
+func (sess *session) rmdir(p string, r *reader) error {
+	if r.err != nil {
+		return r.err
+	}
+	e, err := sess.resolve(p)
+	if err != nil {
+		return err
+	}
+	switch {
+	case e.Kind != paths.KindFolder:
+		return errNotFolder
+	case e.ID == nil:
+		return errDenied
+	}
+	_, children, err := sess.s.paths.List(sess.ctx, sess.userID, e.Path)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		return errNotEmpty
+	}
+	return sess.s.folders.DeleteFolder(sess.ctx, *e.ID, sess.userID)
+}
+
+func (sess *session) remove(p string, r *reader) error {
+	if r.err != nil {
+		return r.err
+	}
+	e, err := sess.resolve(p)
+	if err != nil {
+		return err
+	}
+	if e.Kind == paths.KindFolder {
+		return errIsFolder
+	}
+	return sess.s.files.DeleteFile(sess.ctx, *e.ID, sess.userID)
+}
+
+// rename follows SFTP version 3, which never replaces an existing file.
+func (sess *session) rename(oldName, newName string, r *reader) error {
+	if r.err != nil {
+		return r.err
+	}
+	src, err := sess.resolve(oldName)
+	if err != nil {
+		return err
+	}
+	if src.ID == nil {
+		return errDenied
+	}
+	if _, err := sess.resolve(newName); err == nil {
+		return errExists
+	} else if err != errNoSuchFile {
+		return err
+	}
+	dest, base, err := sess.parent(newName)
+	if err != nil {
+		return err
+	}
+	return paths.Rename(sess.ctx, sess.s.paths, sess.s.files, sess.s.folders, sess.userID, src, dest, base)
+}
@@ -0,0 +1,246 @@
+package tests
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/paths/pathstest"
+	"github.com/bellezhang119/cloud-storage/internal/ratelimit"
+	"github.com/bellezhang119/cloud-storage/internal/sftp"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// MockQueries answers the user and key queries, leaving storage usage to
+// the tree.
+type MockQueries struct {
+	*pathstest.MemTree
+	mock.Mock
+}
+
+func (m *MockQueries) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(database.User), args.Error(1)
+}
+
+func (m *MockQueries) CreateSSHKey(ctx context.Context, arg database.CreateSSHKeyParams) (database.SshKey, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.SshKey), args.Error(1)
+}
+
+func (m *MockQueries) ListSSHKeys(ctx context.Context, userID int32) ([]database.SshKey, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.SshKey), args.Error(1)
+}
+
+func (m *MockQueries) GetSSHKeyByFingerprint(ctx context.Context, arg database.GetSSHKeyByFingerprintParams) (database.SshKey, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.SshKey), args.Error(1)
+}
+
+func (m *MockQueries) TouchSSHKey(ctx context.Context, id uuid.UUID) (int64, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) DeleteSSHKey(ctx context.Context, arg database.DeleteSSHKeyParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockAuth struct {
+	mock.Mock
+}
+
+func (m *MockAuth) AuthenticateBasic(ctx context.Context, email, password string) (database.User, error) {
+	args := m.Called(ctx, email, password)
+	return args.Get(0).(database.User), args.Error(1)
+}
+
+func newSigner(t *testing.T) ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return signer
+}
+
+// startServer runs a server on a loopback port and returns its address and
+// host key.
+func startServer(t *testing.T, q *MockQueries, auth *MockAuth) (string, ssh.PublicKey) {
+	hostKey := newSigner(t)
+	service := sftp.NewService(q, auth, q.MemTree, q.MemTree, q.MemTree)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go sftp.NewServer(service, hostKey).Serve(l)
+	return l.Addr().String(), hostKey.PublicKey()
+}
+
+func dial(addr string, hostKey ssh.PublicKey, auth ssh.AuthMethod) (*ssh.Client, error) {
+	return ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "alice@example.com",
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+	})
+}
+
+// startSFTP opens the sftp subsystem and exchanges versions.
+func startSFTP(t *testing.T, client *ssh.Client) {
+	session, err := client.NewSession()
+	require.NoError(t, err)
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	require.NoError(t, err)
+	stdout, err := session.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, session.RequestSubsystem("sftp"))
+
+	_, err = stdin.Write([]byte{0, 0, 0, 5, fxpInit, 0, 0, 0, 3})
+	require.NoError(t, err)
+	reply := make([]byte, 9)
+	_, err = io.ReadFull(stdout, reply)
+	require.NoError(t, err)
+	assert.Equal(t, byte(fxpVersion), reply[4])
+	assert.Equal(t, uint32(3), binary.BigEndian.Uint32(reply[5:]))
+}
+
+func TestServer_PublicKey(t *testing.T) {
+	userKey := newSigner(t)
+	keyID := uuid.New()
+	q := &MockQueries{MemTree: pathstest.NewMemTree(1 << 20)}
+	q.On("GetUserByEmail", mock.Anything, "alice@example.com").Return(database.User{ID: 1}, nil)
+	q.On("GetSSHKeyByFingerprint", mock.Anything, database.GetSSHKeyByFingerprintParams{UserID: 1, Fingerprint: ssh.FingerprintSHA256(userKey.PublicKey())}).
+		Return(database.SshKey{ID: keyID, UserID: 1}, nil)
+	q.On("GetSSHKeyByFingerprint", mock.Anything, mock.Anything).Return(database.SshKey{}, sql.ErrNoRows)
+	q.On("TouchSSHKey", mock.Anything, keyID).Return(int64(1), nil)
+	addr, hostKey := startServer(t, q, new(MockAuth))
+
+	client, err := dial(addr, hostKey, ssh.PublicKeys(userKey))
+	require.NoError(t, err)
+	defer client.Close()
+	startSFTP(t, client)
+	q.AssertCalled(t, "TouchSSHKey", mock.Anything, keyID)
+
+	_, err = dial(addr, hostKey, ssh.PublicKeys(newSigner(t)))
+	assert.Error(t, err, "unregistered keys are refused")
+}
+
+func TestServer_DisabledUserKey(t *testing.T) {
+	userKey := newSigner(t)
+	q := &MockQueries{MemTree: pathstest.NewMemTree(1 << 20)}
+	q.On("GetUserByEmail", mock.Anything, "alice@example.com").Return(database.User{ID: 1, IsDisabled: true}, nil)
+	q.On("GetSSHKeyByFingerprint", mock.Anything, mock.Anything).Return(database.SshKey{ID: uuid.New(), UserID: 1}, nil)
+	addr, hostKey := startServer(t, q, new(MockAuth))
+
+	_, err := dial(addr, hostKey, ssh.PublicKeys(userKey))
+
+	assert.Error(t, err)
+	q.AssertNotCalled(t, "TouchSSHKey", mock.Anything, mock.Anything)
+}
+
+func TestServer_Password(t *testing.T) {
+	q := &MockQueries{MemTree: pathstest.NewMemTree(1 << 20)}
+	auth := new(MockAuth)
+	auth.On("AuthenticateBasic", mock.Anything, "alice@example.com", "secret").Return(database.User{ID: 1}, nil)
+	auth.On("AuthenticateBasic", mock.Anything, "alice@example.com", mock.Anything).Return(database.User{}, errors.New("invalid credentials"))
+	addr, hostKey := startServer(t, q, auth)
+
+	_, err := dial(addr, hostKey, ssh.Password("wrong"))
+	assert.Error(t, err)
+
+	client, err := dial(addr, hostKey, ssh.Password("secret"))
+	require.NoError(t, err)
+	defer client.Close()
+	startSFTP(t, client)
+}
+
+func TestServer_PasswordAttemptsLimited(t *testing.T) {
+	q := &MockQueries{MemTree: pathstest.NewMemTree(1 << 20)}
+	auth := new(MockAuth)
+	auth.On("AuthenticateBasic", mock.Anything, "alice@example.com", "secret").Return(database.User{ID: 1}, nil)
+	auth.On("AuthenticateBasic", mock.Anything, "alice@example.com", mock.Anything).Return(database.User{}, errors.New("invalid credentials"))
+	hostKey := newSigner(t)
+	srv := sftp.NewServer(sftp.NewService(q, auth, q.MemTree, q.MemTree, q.MemTree), hostKey)
+	srv.LimitPasswords(ratelimit.NewMemoryLimiter(), ratelimit.Policy{Name: "sftp_password_ip", Limit: 2, Period: time.Hour})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go srv.Serve(l)
+
+	for range 2 {
+		_, err := dial(l.Addr().String(), hostKey.PublicKey(), ssh.Password("wrong"))
+		require.Error(t, err)
+	}
+	_, err = dial(l.Addr().String(), hostKey.PublicKey(), ssh.Password("secret"))
+
+	assert.Error(t, err, "the right password is refused too once the address is over its limit")
+	auth.AssertNumberOfCalls(t, "AuthenticateBasic", 2)
+}
+
+func TestServer_RefusesShells(t *testing.T) {
+	q := &MockQueries{MemTree: pathstest.NewMemTree(1 << 20)}
+	auth := new(MockAuth)
+	auth.On("AuthenticateBasic", mock.Anything, "alice@example.com", "secret").Return(database.User{ID: 1}, nil)
+	addr, hostKey := startServer(t, q, auth)
+	client, err := dial(addr, hostKey, ssh.Password("secret"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	require.NoError(t, err)
+	defer session.Close()
+	assert.Error(t, session.Run("cat /etc/passwd"))
+
+	_, err = client.Dial("tcp", "127.0.0.1:22")
+	assert.Error(t, err, "forwarding is refused")
+}
+
+func TestLoadHostKey_KeepsKey(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "host_key")
+
+	first, err := sftp.LoadHostKey(keyPath)
+	require.NoError(t, err)
+	second, err := sftp.LoadHostKey(keyPath)
+	require.NoError(t, err)
+
+	assert.Equal(t, first.PublicKey().Marshal(), second.PublicKey().Marshal())
+}
+
+func TestAddKey(t *testing.T) {
+	signer := newSigner(t)
+	line := string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	fingerprint := ssh.FingerprintSHA256(signer.PublicKey())
+	q := &MockQueries{}
+	q.On("ListSSHKeys", mock.Anything, int32(1)).Return([]database.SshKey{}, nil).Once()
+	q.On("CreateSSHKey", mock.Anything, mock.MatchedBy(func(arg database.CreateSSHKeyParams) bool {
+		return arg.Name == "laptop" && arg.Fingerprint == fingerprint
+	})).Return(database.SshKey{Name: "laptop", Fingerprint: fingerprint}, nil)
+	service := sftp.NewService(q, nil, nil, nil, nil)
+
+	key, err := service.AddKey(context.Background(), 1, "", line[:len(line)-1]+" laptop\n")
+	require.NoError(t, err)
+	assert.Equal(t, "laptop", key.Name, "the comment names a key given no name")
+
+	q.On("ListSSHKeys", mock.Anything, int32(1)).Return([]database.SshKey{key}, nil)
+	_, err = service.AddKey(context.Background(), 1, "again", line)
+	assert.ErrorIs(t, err, sftp.ErrKeyExists)
+
+	_, err = service.AddKey(context.Background(), 1, "bad", "ssh-ed25519 not-base64")
+	assert.ErrorIs(t, err, sftp.ErrKeyInvalid)
+	_, err = service.AddKey(context.Background(), 1, "", line)
+	assert.ErrorIs(t, err, sftp.ErrKeyNameEmpty)
+}
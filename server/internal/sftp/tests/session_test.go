@@ -0,0 +1,315 @@
+package tests
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/paths/pathstest"
+	"github.com/bellezhang119/cloud-storage/internal/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The tests speak raw SFTP version 3 to Service.Serve, the way OpenSSH's
+// client does, over a tree that keeps what each request left behind.
+
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpFstat    = 8
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpRmdir    = 15
+	fxpRealpath = 16
+	fxpStat     = 17
+	fxpRename   = 18
+	fxpSymlink  = 20
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+	fxFailure          = 4
+	fxOpUnsupported    = 8
+
+	flagRead   = 0x01
+	flagWrite  = 0x02
+	flagAppend = 0x04
+	flagCreate = 0x08
+	flagTrunc  = 0x10
+	flagExcl   = 0x20
+)
+
+type sftpClient struct {
+	t    *testing.T
+	conn net.Conn
+	id   uint32
+	done chan error
+}
+
+func newSession(t *testing.T, tree *pathstest.MemTree) *sftpClient {
+	service := sftp.NewService(&MockQueries{MemTree: tree}, nil, tree, tree, tree)
+	client, server := net.Pipe()
+	c := &sftpClient{t: t, conn: client, done: make(chan error, 1)}
+	go func() {
+		c.done <- service.Serve(context.Background(), 1, "alice@example.com", server)
+		server.Close()
+	}()
+	t.Cleanup(func() { client.Close() })
+
+	kind, body := c.roundTrip(fxpInit, nil, uint32(3))
+	require.Equal(t, byte(fxpVersion), kind)
+	require.Equal(t, uint32(3), binary.BigEndian.Uint32(body))
+	return c
+}
+
+// roundTrip sends a packet built from fields and returns the response's
+// type and body. A nil id leaves the id out, as INIT does.
+func (c *sftpClient) roundTrip(kind byte, id *uint32, fields ...any) (byte, []byte) {
+	b := []byte{0, 0, 0, 0, kind}
+	if id != nil {
+		b = binary.BigEndian.AppendUint32(b, *id)
+	}
+	for _, f := range fields {
+		switch v := f.(type) {
+		case uint32:
+			b = binary.BigEndian.AppendUint32(b, v)
+		case uint64:
+			b = binary.BigEndian.AppendUint64(b, v)
+		case string:
+			b = binary.BigEndian.AppendUint32(b, uint32(len(v)))
+			b = append(b, v...)
+		}
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	_, err := c.conn.Write(b)
+	require.NoError(c.t, err)
+
+	var head [4]byte
+	_, err = io.ReadFull(c.conn, head[:])
+	require.NoError(c.t, err)
+	body := make([]byte, binary.BigEndian.Uint32(head[:]))
+	_, err = io.ReadFull(c.conn, body)
+	require.NoError(c.t, err)
+	if id != nil {
+		require.Equal(c.t, *id, binary.BigEndian.Uint32(body[1:5]))
+		return body[0], body[5:]
+	}
+	return body[0], body[1:]
+}
+
+func (c *sftpClient) call(kind byte, fields ...any) (byte, []byte) {
+	c.id++
+	id := c.id
+	return c.roundTrip(kind, &id, fields...)
+}
+
+// status runs a request that answers with a status and returns its code.
+func (c *sftpClient) status(kind byte, fields ...any) uint32 {
+	resp, body := c.call(kind, fields...)
+	require.Equal(c.t, byte(fxpStatus), resp)
+	return binary.BigEndian.Uint32(body)
+}
+
+func (c *sftpClient) statusMessage(kind byte, fields ...any) (uint32, string) {
+	resp, body := c.call(kind, fields...)
+	require.Equal(c.t, byte(fxpStatus), resp)
+	return binary.BigEndian.Uint32(body), readString(body[4:])
+}
+
+func readString(b []byte) string {
+	n := binary.BigEndian.Uint32(b)
+	return string(b[4 : 4+n])
+}
+
+func (c *sftpClient) open(name string, flags uint32) string {
+	resp, body := c.call(fxpOpen, name, flags, uint32(0))
+	require.Equal(c.t, byte(fxpHandle), resp, "opening %s", name)
+	return readString(body)
+}
+
+func (c *sftpClient) put(name, content string) {
+	h := c.open(name, flagWrite|flagCreate|flagTrunc)
+	require.Equal(c.t, uint32(fxOK), c.status(fxpWrite, h, uint64(0), content))
+	require.Equal(c.t, uint32(fxOK), c.status(fxpClose, h))
+}
+
+func (c *sftpClient) get(name string) string {
+	h := c.open(name, flagRead)
+	defer c.status(fxpClose, h)
+	var out []byte
+	for {
+		resp, body := c.call(fxpRead, h, uint64(len(out)), uint32(4))
+		if resp == fxpStatus {
+			require.Equal(c.t, uint32(fxEOF), binary.BigEndian.Uint32(body))
+			return string(out)
+		}
+		require.Equal(c.t, byte(fxpData), resp)
+		out = append(out, readString(body)...)
+	}
+}
+
+func TestSession_UploadAndDownload(t *testing.T) {
+	tree := pathstest.NewMemTree(1 << 20)
+	c := newSession(t, tree)
+
+	resp, _ := c.call(fxpOpen, "/docs/a.txt", uint32(flagWrite|flagCreate|flagTrunc), uint32(0))
+	assert.Equal(t, byte(fxpStatus), resp, "the parent folder doesn't exist yet")
+
+	require.Equal(t, uint32(fxOK), c.status(fxpMkdir, "/docs", uint32(0)))
+	h := c.open("/docs/a.txt", flagWrite|flagCreate|flagTrunc)
+	require.Equal(t, uint32(fxOK), c.status(fxpWrite, h, uint64(6), "world"))
+	require.Equal(t, uint32(fxOK), c.status(fxpWrite, h, uint64(0), "hello "))
+	_, ok := tree.Lookup("/docs/a.txt")
+	assert.False(t, ok, "nothing is stored before the file is closed")
+	require.Equal(t, uint32(fxOK), c.status(fxpClose, h))
+
+	body, ok := tree.Lookup("/docs/a.txt")
+	require.True(t, ok)
+	assert.Equal(t, "hello world", body)
+	assert.Equal(t, "hello world", c.get("docs/a.txt"))
+}
+
+func TestSession_EditInPlace(t *testing.T) {
+	tree := pathstest.NewMemTree(1 << 20)
+	c := newSession(t, tree)
+	c.put("/a.txt", "hello world")
+
+	h := c.open("/a.txt", flagWrite)
+	require.Equal(t, uint32(fxOK), c.status(fxpWrite, h, uint64(0), "J"))
+	require.Equal(t, uint32(fxOK), c.status(fxpClose, h))
+	h = c.open("/a.txt", flagWrite|flagAppend)
+	require.Equal(t, uint32(fxOK), c.status(fxpWrite, h, uint64(0), "!"))
+	require.Equal(t, uint32(fxOK), c.status(fxpClose, h))
+
+	body, _ := tree.Lookup("/a.txt")
+	assert.Equal(t, "Jello world!", body)
+
+	resp, _ := c.call(fxpOpen, "/a.txt", uint32(flagWrite|flagCreate|flagExcl), uint32(0))
+	assert.Equal(t, byte(fxpStatus), resp)
+}
+
+func TestSession_ReadDir(t *testing.T) {
+	c := newSession(t, pathstest.NewMemTree(1<<20))
+	require.Equal(t, uint32(fxOK), c.status(fxpMkdir, "/sub", uint32(0)))
+	c.put("/b.txt", "bb")
+
+	resp, body := c.call(fxpOpendir, "/")
+	require.Equal(t, byte(fxpHandle), resp)
+	h := readString(body)
+
+	resp, body = c.call(fxpReaddir, h)
+	require.Equal(t, byte(fxpName), resp)
+	assert.Equal(t, uint32(2), binary.BigEndian.Uint32(body))
+	assert.Equal(t, "b.txt", readString(body[4:]))
+	assert.Contains(t, string(body), "drwxr-xr-x")
+	assert.Contains(t, string(body), "-rw-r--r--")
+
+	assert.Equal(t, uint32(fxEOF), c.status(fxpReaddir, h))
+	assert.Equal(t, uint32(fxOK), c.status(fxpClose, h))
+	assert.Equal(t, uint32(fxFailure), c.status(fxpReaddir, h), "closed handles are gone")
+}
+
+func TestSession_ConfinedToTree(t *testing.T) {
+	c := newSession(t, pathstest.NewMemTree(1<<20))
+
+	resp, body := c.call(fxpRealpath, "../../etc")
+	require.Equal(t, byte(fxpName), resp)
+	assert.Equal(t, "/etc", readString(body[4:]))
+
+	resp, _ = c.call(fxpStat, "../..")
+	assert.Equal(t, byte(fxpAttrs), resp)
+	assert.Equal(t, uint32(fxNoSuchFile), c.status(fxpOpen, "/../../etc/passwd", uint32(flagRead), uint32(0)))
+	assert.Equal(t, uint32(fxPermissionDenied), c.status(fxpRmdir, "/.."))
+}
+
+func TestSession_Rename(t *testing.T) {
+	tree := pathstest.NewMemTree(1 << 20)
+	c := newSession(t, tree)
+	require.Equal(t, uint32(fxOK), c.status(fxpMkdir, "/dest", uint32(0)))
+	c.put("/a.txt", "a")
+	c.put("/b.txt", "b")
+
+	assert.Equal(t, uint32(fxFailure), c.status(fxpRename, "/a.txt", "/b.txt"), "renames never replace")
+	assert.Equal(t, uint32(fxOK), c.status(fxpRename, "/a.txt", "/dest/c.txt"))
+
+	body, ok := tree.Lookup("/dest/c.txt")
+	assert.True(t, ok)
+	assert.Equal(t, "a", body)
+	_, ok = tree.Lookup("/a.txt")
+	assert.False(t, ok)
+}
+
+func TestSession_RemoveAndRmdir(t *testing.T) {
+	tree := pathstest.NewMemTree(1 << 20)
+	c := newSession(t, tree)
+	require.Equal(t, uint32(fxOK), c.status(fxpMkdir, "/dir", uint32(0)))
+	c.put("/dir/a.txt", "a")
+
+	code, msg := c.statusMessage(fxpRmdir, "/dir")
+	assert.Equal(t, uint32(fxFailure), code)
+	assert.Equal(t, "folder is not empty", msg)
+	assert.Equal(t, uint32(fxFailure), c.status(fxpRemove, "/dir"))
+
+	assert.Equal(t, uint32(fxOK), c.status(fxpRemove, "/dir/a.txt"))
+	assert.Equal(t, uint32(fxOK), c.status(fxpRmdir, "/dir"))
+	assert.Equal(t, uint32(fxNoSuchFile), c.status(fxpStat, "/dir"))
+}
+
+func TestSession_OverQuota(t *testing.T) {
+	tree := pathstest.NewMemTree(5)
+	c := newSession(t, tree)
+
+	h := c.open("/big.bin", flagWrite|flagCreate|flagTrunc)
+	require.Equal(t, uint32(fxOK), c.status(fxpWrite, h, uint64(0), "0123456789"))
+	code, msg := c.statusMessage(fxpClose, h)
+
+	assert.Equal(t, uint32(fxFailure), code)
+	assert.Equal(t, "storage quota exceeded", msg)
+	_, ok := tree.Lookup("/big.bin")
+	assert.False(t, ok)
+}
+
+func TestSession_AbandonedUpload(t *testing.T) {
+	tree := pathstest.NewMemTree(1 << 20)
+	c := newSession(t, tree)
+
+	h := c.open("/partial.bin", flagWrite|flagCreate|flagTrunc)
+	require.Equal(t, uint32(fxOK), c.status(fxpWrite, h, uint64(0), "half"))
+	c.conn.Close()
+	<-c.done
+
+	_, ok := tree.Lookup("/partial.bin")
+	assert.False(t, ok, "an upload cut off before CLOSE is not stored")
+}
+
+func TestSession_Fstat(t *testing.T) {
+	c := newSession(t, pathstest.NewMemTree(1<<20))
+
+	h := c.open("/a.txt", flagWrite|flagCreate|flagTrunc)
+	require.Equal(t, uint32(fxOK), c.status(fxpWrite, h, uint64(0), "abc"))
+	resp, body := c.call(fxpFstat, h)
+
+	require.Equal(t, byte(fxpAttrs), resp)
+	assert.Equal(t, uint64(3), binary.BigEndian.Uint64(body[4:12]))
+}
+
+func TestSession_Unsupported(t *testing.T) {
+	c := newSession(t, pathstest.NewMemTree(1<<20))
+
+	assert.Equal(t, uint32(fxOpUnsupported), c.status(fxpSymlink, "/a", "/b"))
+}
@@ -0,0 +1,87 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+)
+
+// All handlers here must be mounted behind AuthMiddleware.
+
+type ServiceInterface interface {
+	FolderStats(ctx context.Context, folderID uuid.UUID, userID int32) (FolderStats, error)
+	Analytics(ctx context.Context, userID int32, opts Options) (Analytics, error)
+}
+
+// FolderStatsHandler serves GET /folders/{id}/stats.
+func FolderStatsHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		folderID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid folder ID")
+			return
+		}
+
+		stats, err := service.FolderStats(r.Context(), folderID, userID)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				util.RespondWithError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, stats)
+	}
+}
+
+// AnalyticsHandler serves GET /users/me/analytics?limit=&days=, where limit
+// sizes the file lists and days how far back the growth series goes.
+func AnalyticsHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var opts Options
+		q := r.URL.Query()
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil || n <= 0 {
+				util.RespondWithError(w, http.StatusBadRequest, "Invalid limit")
+				return
+			}
+			opts.Limit = int32(min(n, MaxLimit))
+		}
+		if v := q.Get("days"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				util.RespondWithError(w, http.StatusBadRequest, "Invalid days")
+				return
+			}
+			opts.Days = n
+		}
+
+		analytics, err := service.Analytics(r.Context(), userID, opts)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, analytics)
+	}
+}
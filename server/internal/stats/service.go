@@ -0,0 +1,214 @@
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultCacheTTL = 10 * time.Minute
+
+	DefaultLimit = 10
+	MaxLimit     = 100
+	DefaultDays  = 90
+	MaxDays      = 730
+)
+
+var ErrNotFound = errors.New("folder not found")
+
+type Queries interface {
+	GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error)
+	GetCachedFolderStats(ctx context.Context, arg database.GetCachedFolderStatsParams) (database.FolderStat, error)
+	ComputeFolderStats(ctx context.Context, id uuid.UUID) (database.FolderStat, error)
+	GetUsageTotals(ctx context.Context, id int32) (database.GetUsageTotalsRow, error)
+	GetMimeBreakdown(ctx context.Context, userID sql.NullInt32) ([]database.GetMimeBreakdownRow, error)
+	ListLargestFiles(ctx context.Context, arg database.ListLargestFilesParams) ([]database.ListLargestFilesRow, error)
+	ListOldestUntouchedFiles(ctx context.Context, arg database.ListOldestUntouchedFilesParams) ([]database.ListOldestUntouchedFilesRow, error)
+	ListUsageSnapshots(ctx context.Context, arg database.ListUsageSnapshotsParams) ([]database.ListUsageSnapshotsRow, error)
+}
+
+// FolderStats are totals over a folder's whole subtree, trash excluded.
+type FolderStats struct {
+	FolderID  uuid.UUID `json:"folder_id"`
+	SizeBytes int64     `json:"size_bytes"`
+	FileCount int64     `json:"file_count"`
+	// Folders below this one, at any depth
+	FolderCount  int64      `json:"folder_count"`
+	LastModified *time.Time `json:"last_modified"`
+}
+
+type MimeUsage struct {
+	MimeType  string `json:"mime_type"`
+	FileCount int64  `json:"file_count"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+type FileSummary struct {
+	ID        uuid.UUID  `json:"id"`
+	FolderID  *uuid.UUID `json:"folder_id"`
+	Name      string     `json:"name"`
+	SizeBytes int64      `json:"size_bytes"`
+	MimeType  string     `json:"mime_type,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// UsagePoint is one daily snapshot; Day is YYYY-MM-DD.
+type UsagePoint struct {
+	Day       string `json:"day"`
+	UsedBytes int64  `json:"used_bytes"`
+	FileCount int64  `json:"file_count"`
+}
+
+type Analytics struct {
+	UsedBytes       int64         `json:"used_bytes"`
+	QuotaBytes      int64         `json:"quota_bytes"`
+	TrashedBytes    int64         `json:"trashed_bytes"`
+	FileCount       int64         `json:"file_count"`
+	FolderCount     int64         `json:"folder_count"`
+	ByMimeType      []MimeUsage   `json:"by_mime_type"`
+	LargestFiles    []FileSummary `json:"largest_files"`
+	OldestUntouched []FileSummary `json:"oldest_untouched"`
+	Growth          []UsagePoint  `json:"growth"`
+}
+
+// Options size the lists in Analytics. Zero values take the defaults.
+type Options struct {
+	Limit int32
+	Days  int
+}
+
+type Service struct {
+	queries  Queries
+	CacheTTL time.Duration
+}
+
+func NewService(q Queries) *Service {
+	return &Service{queries: q, CacheTTL: defaultCacheTTL}
+}
+
+// FolderStats serves from the cache when it can and recomputes otherwise.
+func (s *Service) FolderStats(ctx context.Context, folderID uuid.UUID, userID int32) (FolderStats, error) {
+	f, err := s.queries.GetFolderByID(ctx, folderID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return FolderStats{}, ErrNotFound
+		}
+		return FolderStats{}, fmt.Errorf("fetching folder: %w", err)
+	}
+	if f.UserID.Int32 != userID || f.TrashedAt.Valid {
+		return FolderStats{}, ErrNotFound
+	}
+
+	row, err := s.queries.GetCachedFolderStats(ctx, database.GetCachedFolderStatsParams{
+		FolderID:      folderID,
+		MaxAgeSeconds: s.CacheTTL.Seconds(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		row, err = s.queries.ComputeFolderStats(ctx, folderID)
+		if err != nil {
+			return FolderStats{}, fmt.Errorf("computing folder stats: %w", err)
+		}
+	} else if err != nil {
+		return FolderStats{}, fmt.Errorf("reading folder stats: %w", err)
+	}
+
+	stats := FolderStats{
+		FolderID:    folderID,
+		SizeBytes:   row.SizeBytes,
+		FileCount:   row.FileCount,
+		FolderCount: row.FolderCount,
+	}
+	if row.LastModified.Valid {
+		stats.LastModified = &row.LastModified.Time
+	}
+	return stats, nil
+}
+
+func (s *Service) Analytics(ctx context.Context, userID int32, opts Options) (Analytics, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+	days := opts.Days
+	if days <= 0 {
+		days = DefaultDays
+	}
+	days = min(days, MaxDays)
+
+	uID := sql.NullInt32{Int32: userID, Valid: true}
+
+	totals, err := s.queries.GetUsageTotals(ctx, userID)
+	if err != nil {
+		return Analytics{}, fmt.Errorf("fetching usage totals: %w", err)
+	}
+	mimes, err := s.queries.GetMimeBreakdown(ctx, uID)
+	if err != nil {
+		return Analytics{}, fmt.Errorf("fetching MIME breakdown: %w", err)
+	}
+	largest, err := s.queries.ListLargestFiles(ctx, database.ListLargestFilesParams{UserID: uID, Limit: limit})
+	if err != nil {
+		return Analytics{}, fmt.Errorf("listing largest files: %w", err)
+	}
+	oldest, err := s.queries.ListOldestUntouchedFiles(ctx, database.ListOldestUntouchedFilesParams{UserID: uID, Limit: limit})
+	if err != nil {
+		return Analytics{}, fmt.Errorf("listing oldest files: %w", err)
+	}
+	snapshots, err := s.queries.ListUsageSnapshots(ctx, database.ListUsageSnapshotsParams{
+		UserID: userID,
+		Since:  time.Now().UTC().AddDate(0, 0, -days),
+	})
+	if err != nil {
+		return Analytics{}, fmt.Errorf("listing usage snapshots: %w", err)
+	}
+
+	a := Analytics{
+		UsedBytes:       totals.UsedBytes,
+		QuotaBytes:      totals.StorageQuota,
+		TrashedBytes:    totals.TrashedBytes,
+		FileCount:       totals.FileCount,
+		FolderCount:     totals.FolderCount,
+		ByMimeType:      make([]MimeUsage, 0, len(mimes)),
+		LargestFiles:    make([]FileSummary, 0, len(largest)),
+		OldestUntouched: make([]FileSummary, 0, len(oldest)),
+		Growth:          make([]UsagePoint, 0, len(snapshots)),
+	}
+	for _, m := range mimes {
+		a.ByMimeType = append(a.ByMimeType, MimeUsage{MimeType: m.MimeType, FileCount: m.FileCount, SizeBytes: m.SizeBytes})
+	}
+	for _, f := range largest {
+		a.LargestFiles = append(a.LargestFiles, summary(f.ID, f.FolderID, f.Name, f.SizeBytes, f.MimeType, f.UpdatedAt))
+	}
+	for _, f := range oldest {
+		a.OldestUntouched = append(a.OldestUntouched, summary(f.ID, f.FolderID, f.Name, f.SizeBytes, f.MimeType, f.UpdatedAt))
+	}
+	for _, p := range snapshots {
+		a.Growth = append(a.Growth, UsagePoint{
+			Day:       p.Day.Format(time.DateOnly),
+			UsedBytes: p.UsedBytes,
+			FileCount: p.FileCount,
+		})
+	}
+
+	return a, nil
+}
+
+func summary(id uuid.UUID, folderID uuid.NullUUID, name string, size int64, mime sql.NullString, updatedAt sql.NullTime) FileSummary {
+	s := FileSummary{
+		ID:        id,
+		Name:      name,
+		SizeBytes: size,
+		MimeType:  mime.String,
+		UpdatedAt: updatedAt.Time,
+	}
+	if folderID.Valid {
+		s.FolderID = &folderID.UUID
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package stats
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const defaultSnapshotInterval = time.Hour
+
+type SnapshotQueries interface {
+	TakeUsageSnapshots(ctx context.Context) (int64, error)
+}
+
+// Snapshotter records every user's daily usage for the growth chart. Runs are
+// idempotent per day, so polling hourly costs a rewrite of today's rows and
+// survives restarts and missed ticks.
+type Snapshotter struct {
+	queries  SnapshotQueries
+	Interval time.Duration
+}
+
+func NewSnapshotter(q SnapshotQueries) *Snapshotter {
+	return &Snapshotter{queries: q, Interval: defaultSnapshotInterval}
+}
+
+// Run polls until ctx is cancelled.
+func (s *Snapshotter) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.queries.TakeUsageSnapshots(ctx); err != nil {
+			log.Printf("usage snapshots: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
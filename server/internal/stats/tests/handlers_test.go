@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/stats"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) FolderStats(ctx context.Context, folderID uuid.UUID, userID int32) (stats.FolderStats, error) {
+	args := m.Called(ctx, folderID, userID)
+	return args.Get(0).(stats.FolderStats), args.Error(1)
+}
+
+func (m *MockService) Analytics(ctx context.Context, userID int32, opts stats.Options) (stats.Analytics, error) {
+	args := m.Called(ctx, userID, opts)
+	return args.Get(0).(stats.Analytics), args.Error(1)
+}
+
+func asUser(req *http.Request, userID int32) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), userID))
+}
+
+func TestFolderStatsHandler_NotFound(t *testing.T) {
+	mockSvc := new(MockService)
+	id := uuid.New()
+	mockSvc.On("FolderStats", mock.Anything, id, int32(1)).Return(stats.FolderStats{}, stats.ErrNotFound)
+
+	req := httptest.NewRequest(http.MethodGet, "/folders/"+id.String()+"/stats", nil)
+	req.SetPathValue("id", id.String())
+	rr := httptest.NewRecorder()
+	stats.FolderStatsHandler(mockSvc).ServeHTTP(rr, asUser(req, 1))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestAnalyticsHandler_ParsesOptions(t *testing.T) {
+	mockSvc := new(MockService)
+	mockSvc.On("Analytics", mock.Anything, int32(1), stats.Options{Limit: 5, Days: 30}).Return(stats.Analytics{}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/analytics?limit=5&days=30", nil)
+	rr := httptest.NewRecorder()
+	stats.AnalyticsHandler(mockSvc).ServeHTTP(rr, asUser(req, 1))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestAnalyticsHandler_InvalidDays(t *testing.T) {
+	mockSvc := new(MockService)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/analytics?days=-1", nil)
+	rr := httptest.NewRecorder()
+	stats.AnalyticsHandler(mockSvc).ServeHTTP(rr, asUser(req, 1))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	mockSvc.AssertNotCalled(t, "Analytics", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/stats"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func (m *MockQueries) GetCachedFolderStats(ctx context.Context, arg database.GetCachedFolderStatsParams) (database.FolderStat, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.FolderStat), args.Error(1)
+}
+
+func (m *MockQueries) ComputeFolderStats(ctx context.Context, id uuid.UUID) (database.FolderStat, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.FolderStat), args.Error(1)
+}
+
+func (m *MockQueries) GetUsageTotals(ctx context.Context, id int32) (database.GetUsageTotalsRow, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.GetUsageTotalsRow), args.Error(1)
+}
+
+func (m *MockQueries) GetMimeBreakdown(ctx context.Context, userID sql.NullInt32) ([]database.GetMimeBreakdownRow, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.GetMimeBreakdownRow), args.Error(1)
+}
+
+func (m *MockQueries) ListLargestFiles(ctx context.Context, arg database.ListLargestFilesParams) ([]database.ListLargestFilesRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ListLargestFilesRow), args.Error(1)
+}
+
+func (m *MockQueries) ListOldestUntouchedFiles(ctx context.Context, arg database.ListOldestUntouchedFilesParams) ([]database.ListOldestUntouchedFilesRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ListOldestUntouchedFilesRow), args.Error(1)
+}
+
+func (m *MockQueries) ListUsageSnapshots(ctx context.Context, arg database.ListUsageSnapshotsParams) ([]database.ListUsageSnapshotsRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ListUsageSnapshotsRow), args.Error(1)
+}
+
+var uID = sql.NullInt32{Int32: 1, Valid: true}
+
+func TestFolderStats_CacheHit(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := stats.NewService(mockQueries)
+	id := uuid.New()
+
+	mockQueries.On("GetFolderByID", mock.Anything, id).Return(database.Folder{ID: id, UserID: uID}, nil)
+	mockQueries.On("GetCachedFolderStats", mock.Anything, mock.Anything).
+		Return(database.FolderStat{FolderID: id, SizeBytes: 2048, FileCount: 3, FolderCount: 1}, nil)
+
+	got, err := svc.FolderStats(context.Background(), id, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2048), got.SizeBytes)
+	assert.Equal(t, int64(3), got.FileCount)
+	assert.Nil(t, got.LastModified)
+	mockQueries.AssertNotCalled(t, "ComputeFolderStats", mock.Anything, mock.Anything)
+}
+
+func TestFolderStats_CacheMissRecomputes(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := stats.NewService(mockQueries)
+	id := uuid.New()
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mockQueries.On("GetFolderByID", mock.Anything, id).Return(database.Folder{ID: id, UserID: uID}, nil)
+	mockQueries.On("GetCachedFolderStats", mock.Anything, database.GetCachedFolderStatsParams{FolderID: id, MaxAgeSeconds: svc.CacheTTL.Seconds()}).
+		Return(database.FolderStat{}, sql.ErrNoRows)
+	mockQueries.On("ComputeFolderStats", mock.Anything, id).
+		Return(database.FolderStat{FolderID: id, SizeBytes: 10, FileCount: 1, LastModified: sql.NullTime{Time: modified, Valid: true}}, nil)
+
+	got, err := svc.FolderStats(context.Background(), id, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), got.SizeBytes)
+	assert.Equal(t, &modified, got.LastModified)
+	mockQueries.AssertExpectations(t)
+}
+
+func TestFolderStats_OtherUsersFolder(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := stats.NewService(mockQueries)
+	id := uuid.New()
+
+	mockQueries.On("GetFolderByID", mock.Anything, id).
+		Return(database.Folder{ID: id, UserID: sql.NullInt32{Int32: 2, Valid: true}}, nil)
+
+	_, err := svc.FolderStats(context.Background(), id, 1)
+
+	assert.ErrorIs(t, err, stats.ErrNotFound)
+	mockQueries.AssertNotCalled(t, "GetCachedFolderStats", mock.Anything, mock.Anything)
+}
+
+func TestFolderStats_TrashedFolder(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := stats.NewService(mockQueries)
+	id := uuid.New()
+
+	mockQueries.On("GetFolderByID", mock.Anything, id).
+		Return(database.Folder{ID: id, UserID: uID, TrashedAt: sql.NullTime{Time: time.Now(), Valid: true}}, nil)
+
+	_, err := svc.FolderStats(context.Background(), id, 1)
+
+	assert.ErrorIs(t, err, stats.ErrNotFound)
+}
+
+func TestAnalytics(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := stats.NewService(mockQueries)
+	folderID, fileID := uuid.New(), uuid.New()
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	mockQueries.On("GetUsageTotals", mock.Anything, int32(1)).
+		Return(database.GetUsageTotalsRow{StorageQuota: 1000, UsedBytes: 600, FileCount: 4, TrashedBytes: 100, FolderCount: 2}, nil)
+	mockQueries.On("GetMimeBreakdown", mock.Anything, uID).
+		Return([]database.GetMimeBreakdownRow{{MimeType: "image/png", FileCount: 2, SizeBytes: 500}}, nil)
+	mockQueries.On("ListLargestFiles", mock.Anything, database.ListLargestFilesParams{UserID: uID, Limit: stats.MaxLimit}).
+		Return([]database.ListLargestFilesRow{{ID: fileID, FolderID: uuid.NullUUID{UUID: folderID, Valid: true}, Name: "a.png", SizeBytes: 400}}, nil)
+	mockQueries.On("ListOldestUntouchedFiles", mock.Anything, database.ListOldestUntouchedFilesParams{UserID: uID, Limit: stats.MaxLimit}).
+		Return([]database.ListOldestUntouchedFilesRow{}, nil)
+	mockQueries.On("ListUsageSnapshots", mock.Anything, mock.MatchedBy(func(arg database.ListUsageSnapshotsParams) bool {
+		return arg.UserID == 1 && time.Since(arg.Since) > 29*24*time.Hour && time.Since(arg.Since) < 31*24*time.Hour
+	})).Return([]database.ListUsageSnapshotsRow{{Day: day, UsedBytes: 500, FileCount: 3}}, nil)
+
+	got, err := svc.Analytics(context.Background(), 1, stats.Options{Limit: 5000, Days: 30})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(600), got.UsedBytes)
+	assert.Equal(t, int64(1000), got.QuotaBytes)
+	assert.Equal(t, []stats.MimeUsage{{MimeType: "image/png", FileCount: 2, SizeBytes: 500}}, got.ByMimeType)
+	assert.Equal(t, &folderID, got.LargestFiles[0].FolderID)
+	assert.Empty(t, got.OldestUntouched)
+	assert.Equal(t, []stats.UsagePoint{{Day: "2024-05-01", UsedBytes: 500, FileCount: 3}}, got.Growth)
+	mockQueries.AssertExpectations(t)
+}
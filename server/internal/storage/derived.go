@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// DerivedStore holds artifacts computed from a file's content, such as
+// thumbnails. They are keyed by file ID rather than path, so renames and
+// moves never touch them, and live outside the user's tree so folder zips
+// and directory moves never see them.
+type DerivedStore interface {
+	SaveDerived(userID int32, fileID uuid.UUID, name string, content io.Reader) error
+	OpenDerived(userID int32, fileID uuid.UUID, name string) (*os.File, error)
+	DeleteDerived(userID int32, fileID uuid.UUID) error
+}
+
+// derivedRoot is <base>/derived/<userID>; user roots are numeric, so the
+// name can't clash with one.
+func (s *LocalStorage) derivedRoot(userID int32) string {
+	return filepath.Join(s.BasePath, "derived", strconv.Itoa(int(userID)))
+}
+
+func (s *LocalStorage) derivedPath(userID int32, fileID uuid.UUID, name string) string {
+	return filepath.Join(s.derivedRoot(userID), fileID.String(), filepath.Base(name))
+}
+
+// SaveDerived writes an artifact atomically, replacing any previous one
+func (s *LocalStorage) SaveDerived(userID int32, fileID uuid.UUID, name string, content io.Reader) error {
+	full := s.derivedPath(userID, fileID, name)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return fmt.Errorf("creating directories for %s: %w", full, err)
+	}
+
+	return writeAtomic(full, content)
+}
+
+// OpenDerived opens an artifact; the *os.File lets callers stat and seek it
+func (s *LocalStorage) OpenDerived(userID int32, fileID uuid.UUID, name string) (*os.File, error) {
+	full := s.derivedPath(userID, fileID, name)
+	f, err := os.Open(full)
+	if err != nil {
+		return nil, fmt.Errorf("opening derived file %s: %w", full, err)
+	}
+	return f, nil
+}
+
+// DeleteDerived removes every artifact of a file
+func (s *LocalStorage) DeleteDerived(userID int32, fileID uuid.UUID) error {
+	dir := filepath.Join(s.derivedRoot(userID), fileID.String())
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("deleting derived files %s: %w", dir, err)
+	}
+	return nil
+}
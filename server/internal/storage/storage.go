@@ -2,11 +2,15 @@ package storage
 
 import (
 	"archive/zip"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+
+	"github.com/bellezhang119/cloud-storage/internal/conflict"
 )
 
 type Storage interface {
@@ -16,8 +20,11 @@ type Storage interface {
 	CreateDirectory(userID int32, path string) error
 	DeleteDirectory(userID int32, path string) error
 	MoveFile(userID int32, oldPath, newPath string) error
+	CopyFile(userID int32, srcPath, dstPath string) error
 	MoveDirectory(userID int32, oldPath, newPath string) error
 	ZipFolder(userID int32, folderPath string, w io.Writer) error
+	ZipPaths(userID int32, paths []string, w io.Writer) error
+	DeleteUserData(userID int32) error
 }
 
 type LocalStorage struct {
@@ -30,42 +37,86 @@ func NewLocalStorage(basePath string) *LocalStorage {
 	}
 }
 
-// get the absolute safe path for a user file/folder
-func (s *LocalStorage) fullPath(userID int32, path string) string {
-	safePath := filepath.Clean(path)
-	return filepath.Join(s.BasePath, strconv.Itoa(int(userID)), safePath)
+// ErrOutsideRoot is returned for paths that would resolve outside the user's
+// own storage directory.
+var ErrOutsideRoot = errors.New("path escapes user storage root")
+
+// ValidName reports whether name can be used as a single path element:
+// anything that could climb out of the folder, resolve to the folder itself,
+// or that the disk can't store, is refused.
+func ValidName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsAny(name, "/\\\x00")
+}
+
+// get the absolute safe path for a user file/folder; the result always lies
+// within BasePath/<userID>
+func (s *LocalStorage) fullPath(userID int32, path string) (string, error) {
+	root := filepath.Join(s.BasePath, strconv.Itoa(int(userID)))
+	full := filepath.Join(root, filepath.Clean(path))
+	if full != root && !strings.HasPrefix(full, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideRoot, path)
+	}
+	return full, nil
 }
 
 // SaveFile writes content to a file, creating directories if needed
 func (s *LocalStorage) SaveFile(userID int32, path string, content io.Reader) error {
-	full := s.fullPath(userID, path)
+	full, err := s.fullPath(userID, path)
+	if err != nil {
+		return err
+	}
 
 	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
 		return fmt.Errorf("creating directories for %s: %w", full, err)
 	}
 
-	// write to a temp file first for atomic write
-	temp := full + ".tmp"
-	f, err := os.Create(temp)
+	return writeAtomic(full, content)
+}
+
+// writeAtomic writes content to a temp file beside full and renames it into
+// place, so readers see the old content or the new, never a partial file.
+// The temp name is unique: concurrent writes to one path, or a real file
+// called "x.tmp", are never clobbered.
+func writeAtomic(full string, content io.Reader) error {
+	f, err := os.CreateTemp(filepath.Dir(full), ".upload-*")
 	if err != nil {
-		return fmt.Errorf("creating temp file %s: %w", temp, err)
+		return fmt.Errorf("creating temp file for %s: %w", full, err)
 	}
-	defer f.Close()
+	temp := f.Name()
 
 	if _, err := io.Copy(f, content); err != nil {
+		// leave whatever was at full untouched
+		f.Close()
+		os.Remove(temp)
 		return fmt.Errorf("writing to temp file %s: %w", temp, err)
 	}
+	// CreateTemp makes the file 0600; keep the mode os.Create used to give
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(temp)
+		return fmt.Errorf("setting mode of temp file %s: %w", temp, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("closing temp file %s: %w", temp, err)
+	}
 
 	if err := os.Rename(temp, full); err != nil {
+		os.Remove(temp)
 		return fmt.Errorf("renaming temp file %s to %s: %w", temp, full, err)
 	}
-
 	return nil
 }
 
 // ReadFile opens a file for reading
 func (s *LocalStorage) ReadFile(userID int32, path string) (io.ReadCloser, error) {
-	full := s.fullPath(userID, path)
+	full, err := s.fullPath(userID, path)
+	if err != nil {
+		return nil, err
+	}
 	f, err := os.Open(full)
 	if err != nil {
 		return nil, fmt.Errorf("opening file %s: %w", full, err)
@@ -75,7 +126,10 @@ func (s *LocalStorage) ReadFile(userID int32, path string) (io.ReadCloser, error
 
 // DeleteFile removes a file
 func (s *LocalStorage) DeleteFile(userID int32, path string) error {
-	full := s.fullPath(userID, path)
+	full, err := s.fullPath(userID, path)
+	if err != nil {
+		return err
+	}
 	if err := os.Remove(full); err != nil {
 		return fmt.Errorf("deleting file %s: %w", full, err)
 	}
@@ -84,7 +138,10 @@ func (s *LocalStorage) DeleteFile(userID int32, path string) error {
 
 // CreateDirectory creates a folder including parents
 func (s *LocalStorage) CreateDirectory(userID int32, path string) error {
-	full := s.fullPath(userID, path)
+	full, err := s.fullPath(userID, path)
+	if err != nil {
+		return err
+	}
 	if err := os.MkdirAll(full, 0755); err != nil {
 		return fmt.Errorf("creating directory %s: %w", full, err)
 	}
@@ -93,15 +150,33 @@ func (s *LocalStorage) CreateDirectory(userID int32, path string) error {
 
 // DeleteDirectory deletes a folder and all contents
 func (s *LocalStorage) DeleteDirectory(userID int32, path string) error {
-	full := s.fullPath(userID, path)
+	full, err := s.fullPath(userID, path)
+	if err != nil {
+		return err
+	}
 	if err := os.RemoveAll(full); err != nil {
 		return fmt.Errorf("deleting directory %s: %w", full, err)
 	}
 	return nil
 }
 
+// DeleteUserData removes a user's whole storage root and derived files
+func (s *LocalStorage) DeleteUserData(userID int32) error {
+	for _, root := range []string{filepath.Join(s.BasePath, strconv.Itoa(int(userID))), s.derivedRoot(userID)} {
+		if err := os.RemoveAll(root); err != nil {
+			return fmt.Errorf("deleting user data %s: %w", root, err)
+		}
+	}
+	return nil
+}
+
+// ZipFolder streams a folder as a zip whose entries start with the folder's
+// own name
 func (s *LocalStorage) ZipFolder(userID int32, folderPath string, w io.Writer) error {
-	rootPath := filepath.Join(s.BasePath, strconv.Itoa(int(userID)), folderPath)
+	rootPath, err := s.fullPath(userID, folderPath)
+	if err != nil {
+		return err
+	}
 
 	info, err := os.Stat(rootPath)
 	if os.IsNotExist(err) {
@@ -111,56 +186,92 @@ func (s *LocalStorage) ZipFolder(userID int32, folderPath string, w io.Writer) e
 		return fmt.Errorf("path is not a folder")
 	}
 
+	if err := s.ZipPaths(userID, []string{folderPath}, w); err != nil {
+		return fmt.Errorf("zipping folder: %w", err)
+	}
+
+	return nil
+}
+
+// ZipPaths streams several files and folders into one zip. Each sits at the
+// top of the archive under its base name, as in ZipFolder; when two share a
+// name the later one becomes "name (2)".
+func (s *LocalStorage) ZipPaths(userID int32, paths []string, w io.Writer) error {
 	zipWriter := zip.NewWriter(w)
-	defer zipWriter.Close()
+	used := map[string]bool{}
 
-	err = filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+	for _, p := range paths {
+		rootPath, err := s.fullPath(userID, p)
 		if err != nil {
 			return err
 		}
-
-		// Skip directories themselves (zip only files)
-		if info.IsDir() {
-			return nil
+		info, err := os.Stat(rootPath)
+		if err != nil {
+			return fmt.Errorf("zipping %s: %w", p, err)
 		}
 
-		// Create relative path inside the zip
-		relPath, err := filepath.Rel(filepath.Dir(rootPath), path)
-		if err != nil {
-			return err
+		name := filepath.Base(rootPath)
+		for n := 2; used[name]; n++ {
+			name = conflict.Candidate(filepath.Base(rootPath), n, !info.IsDir())
 		}
+		used[name] = true
 
-		zipPath := filepath.ToSlash(relPath)
+		err = filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
 
-		file, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
+			// Skip directories themselves (zip only files)
+			if info.IsDir() {
+				return nil
+			}
 
-		entry, err := zipWriter.Create(zipPath)
-		if err != nil {
-			return err
-		}
+			// Create relative path inside the zip
+			relPath, err := filepath.Rel(rootPath, path)
+			if err != nil {
+				return err
+			}
 
-		if _, err := io.Copy(entry, file); err != nil {
-			return err
-		}
+			zipPath := filepath.ToSlash(filepath.Join(name, relPath))
 
-		return nil
-	})
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
 
-	if err != nil {
-		return fmt.Errorf("zipping folder: %w", err)
+			entry, err := zipWriter.Create(zipPath)
+			if err != nil {
+				return err
+			}
+
+			if _, err := io.Copy(entry, file); err != nil {
+				return err
+			}
+
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("zipping %s: %w", p, err)
+		}
 	}
 
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("finishing archive: %w", err)
+	}
 	return nil
 }
 
 // MoveFile moves a file; supports cross-filesystem moves
 func (s *LocalStorage) MoveFile(userID int32, oldPath, newPath string) error {
-	oldFull := s.fullPath(userID, oldPath)
-	newFull := s.fullPath(userID, newPath)
+	oldFull, err := s.fullPath(userID, oldPath)
+	if err != nil {
+		return err
+	}
+	newFull, err := s.fullPath(userID, newPath)
+	if err != nil {
+		return err
+	}
 
 	if err := os.MkdirAll(filepath.Dir(newFull), 0755); err != nil {
 		return fmt.Errorf("creating directories for %s: %w", newFull, err)
@@ -195,15 +306,44 @@ func (s *LocalStorage) MoveFile(userID int32, oldPath, newPath string) error {
 	return nil
 }
 
+// CopyFile duplicates a file; the copy is written atomically like SaveFile
+func (s *LocalStorage) CopyFile(userID int32, srcPath, dstPath string) error {
+	srcFull, err := s.fullPath(userID, srcPath)
+	if err != nil {
+		return err
+	}
+	dstFull, err := s.fullPath(userID, dstPath)
+	if err != nil {
+		return err
+	}
+	if srcFull == dstFull {
+		return fmt.Errorf("copying %s onto itself", srcFull)
+	}
+
+	src, err := os.Open(srcFull)
+	if err != nil {
+		return fmt.Errorf("opening source file %s: %w", srcFull, err)
+	}
+	defer src.Close()
+
+	return s.SaveFile(userID, dstPath, src)
+}
+
 func (s *LocalStorage) MoveDirectory(userID int32, oldPath, newPath string) error {
-	oldFull := s.fullPath(userID, oldPath)
-	newFull := s.fullPath(userID, newPath)
+	oldFull, err := s.fullPath(userID, oldPath)
+	if err != nil {
+		return err
+	}
+	newFull, err := s.fullPath(userID, newPath)
+	if err != nil {
+		return err
+	}
 
 	if err := os.MkdirAll(newFull, 0755); err != nil {
 		return fmt.Errorf("creating new directory %s: %w", newFull, err)
 	}
 
-	err := filepath.Walk(oldFull, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(oldFull, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
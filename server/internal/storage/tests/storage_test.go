@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStorage_RefusesPathsOutsideUserRoot(t *testing.T) {
+	base := t.TempDir()
+	s := storage.NewLocalStorage(base)
+	require.NoError(t, s.SaveFile(2, "report.pdf", strings.NewReader("victim")))
+
+	err := s.SaveFile(1, "../2/report.pdf", strings.NewReader("attacker"))
+	assert.ErrorIs(t, err, storage.ErrOutsideRoot)
+
+	_, err = s.ReadFile(1, "../2/report.pdf")
+	assert.ErrorIs(t, err, storage.ErrOutsideRoot)
+	assert.ErrorIs(t, s.MoveFile(1, "../2/report.pdf", "stolen.pdf"), storage.ErrOutsideRoot)
+	assert.ErrorIs(t, s.DeleteFile(1, "../2/report.pdf"), storage.ErrOutsideRoot)
+	assert.ErrorIs(t, s.DeleteDirectory(1, ".."), storage.ErrOutsideRoot)
+
+	got, err := os.ReadFile(filepath.Join(base, "2", "report.pdf"))
+	require.NoError(t, err)
+	assert.Equal(t, "victim", string(got))
+}
+
+func TestLocalStorage_CleansPathsThatStayInside(t *testing.T) {
+	s := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, s.SaveFile(1, "docs/../notes.txt", strings.NewReader("hi")))
+
+	r, err := s.ReadFile(1, "notes.txt")
+	require.NoError(t, err)
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(got))
+}
+
+func TestLocalStorage_SaveLeavesNeighbouringTmpFileAlone(t *testing.T) {
+	base := t.TempDir()
+	s := storage.NewLocalStorage(base)
+	require.NoError(t, s.SaveFile(1, "x.tmp", strings.NewReader("mine")))
+
+	require.NoError(t, s.SaveFile(1, "x", strings.NewReader("upload")))
+
+	got, err := os.ReadFile(filepath.Join(base, "1", "x.tmp"))
+	require.NoError(t, err)
+	assert.Equal(t, "mine", string(got))
+	entries, err := os.ReadDir(filepath.Join(base, "1"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "no temp file is left behind")
+}
+
+func TestLocalStorage_ConcurrentSavesToOnePathStayWhole(t *testing.T) {
+	base := t.TempDir()
+	s := storage.NewLocalStorage(base)
+	bodies := []string{strings.Repeat("a", 1<<16), strings.Repeat("b", 1<<16), strings.Repeat("c", 1<<16)}
+
+	var wg sync.WaitGroup
+	for _, body := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.SaveFile(1, "same.bin", strings.NewReader(body)))
+		}()
+	}
+	wg.Wait()
+
+	got, err := os.ReadFile(filepath.Join(base, "1", "same.bin"))
+	require.NoError(t, err)
+	assert.Contains(t, bodies, string(got), "one upload wins whole")
+}
@@ -0,0 +1,293 @@
+package tag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+)
+
+// All handlers here must be mounted behind AuthMiddleware. Item routes take
+// the kind from the route they are mounted on, e.g. /files/{id}/tags.
+
+type ServiceInterface interface {
+	ListTags(ctx context.Context, userID int32) ([]Tag, error)
+	CreateTag(ctx context.Context, userID int32, name string) (Tag, error)
+	RenameTag(ctx context.Context, userID int32, id uuid.UUID, name string) (Tag, error)
+	DeleteTag(ctx context.Context, userID int32, id uuid.UUID) error
+	ListItemsByTag(ctx context.Context, userID int32, id uuid.UUID) ([]Item, error)
+	Apply(ctx context.Context, userID int32, names []string, sel Selection) (int64, error)
+	Remove(ctx context.Context, userID int32, names []string, sel Selection) (int64, error)
+	ItemTags(ctx context.Context, userID int32, kind string, id uuid.UUID) ([]string, error)
+	SetItemTags(ctx context.Context, userID int32, kind string, id uuid.UUID, names []string) ([]string, error)
+	Properties(ctx context.Context, userID int32, kind string, id uuid.UUID) (map[string]string, error)
+	SetProperty(ctx context.Context, userID int32, kind string, id uuid.UUID, key, value string) error
+	DeleteProperty(ctx context.Context, userID int32, kind string, id uuid.UUID, key string) error
+}
+
+type TagRequest struct {
+	Name string `json:"name"`
+}
+
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type BulkTagRequest struct {
+	Tags    []string    `json:"tags"`
+	Files   []uuid.UUID `json:"files"`
+	Folders []uuid.UUID `json:"folders"`
+}
+
+type PropertyRequest struct {
+	Value string `json:"value"`
+}
+
+func respondWithServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		util.RespondWithError(w, http.StatusNotFound, "Not found")
+	case errors.Is(err, ErrTagExists):
+		util.RespondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrInvalidTag), errors.Is(err, ErrInvalidProperty),
+		errors.Is(err, ErrInvalidKind), errors.Is(err, ErrEmptySelection), errors.Is(err, ErrTooManyItems):
+		util.RespondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// requestIDs pulls the caller and the {id} path value out of the request,
+// writing the error response itself when either is missing.
+func requestIDs(w http.ResponseWriter, r *http.Request) (int32, uuid.UUID, bool) {
+	userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+	if !ok {
+		util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, uuid.Nil, false
+	}
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		util.RespondWithError(w, http.StatusBadRequest, "Invalid ID")
+		return 0, uuid.Nil, false
+	}
+	return userID, id, true
+}
+
+func ListTagsHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		tags, err := service.ListTags(r.Context(), userID)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		util.RespondWithJSON(w, http.StatusOK, tags)
+	}
+}
+
+func CreateTagHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req TagRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		tag, err := service.CreateTag(r.Context(), userID, req.Name)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		util.RespondWithJSON(w, http.StatusCreated, tag)
+	}
+}
+
+func RenameTagHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, id, ok := requestIDs(w, r)
+		if !ok {
+			return
+		}
+
+		var req TagRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		tag, err := service.RenameTag(r.Context(), userID, id, req.Name)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		util.RespondWithJSON(w, http.StatusOK, tag)
+	}
+}
+
+func DeleteTagHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, id, ok := requestIDs(w, r)
+		if !ok {
+			return
+		}
+
+		if err := service.DeleteTag(r.Context(), userID, id); err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Tag deleted"})
+	}
+}
+
+func ListTaggedItemsHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, id, ok := requestIDs(w, r)
+		if !ok {
+			return
+		}
+
+		items, err := service.ListItemsByTag(r.Context(), userID, id)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		util.RespondWithJSON(w, http.StatusOK, items)
+	}
+}
+
+// BulkTagHandler adds (or with remove set, takes off) tags across a selection.
+func BulkTagHandler(service ServiceInterface, remove bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		var req BulkTagRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		sel := Selection{Files: req.Files, Folders: req.Folders}
+		var n int64
+		var err error
+		if remove {
+			n, err = service.Remove(r.Context(), userID, req.Tags, sel)
+		} else {
+			n, err = service.Apply(r.Context(), userID, req.Tags, sel)
+		}
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		util.RespondWithJSON(w, http.StatusOK, map[string]int64{"changed": n})
+	}
+}
+
+func ItemTagsHandler(service ServiceInterface, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, id, ok := requestIDs(w, r)
+		if !ok {
+			return
+		}
+
+		tags, err := service.ItemTags(r.Context(), userID, kind, id)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		util.RespondWithJSON(w, http.StatusOK, TagsRequest{Tags: tags})
+	}
+}
+
+func SetItemTagsHandler(service ServiceInterface, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, id, ok := requestIDs(w, r)
+		if !ok {
+			return
+		}
+
+		var req TagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		tags, err := service.SetItemTags(r.Context(), userID, kind, id, req.Tags)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		util.RespondWithJSON(w, http.StatusOK, TagsRequest{Tags: tags})
+	}
+}
+
+func PropertiesHandler(service ServiceInterface, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, id, ok := requestIDs(w, r)
+		if !ok {
+			return
+		}
+
+		props, err := service.Properties(r.Context(), userID, kind, id)
+		if err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		util.RespondWithJSON(w, http.StatusOK, props)
+	}
+}
+
+func SetPropertyHandler(service ServiceInterface, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, id, ok := requestIDs(w, r)
+		if !ok {
+			return
+		}
+
+		var req PropertyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		key := r.PathValue("key")
+		if err := service.SetProperty(r.Context(), userID, kind, id, key, req.Value); err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{"key": key, "value": req.Value})
+	}
+}
+
+func DeletePropertyHandler(service ServiceInterface, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, id, ok := requestIDs(w, r)
+		if !ok {
+			return
+		}
+
+		if err := service.DeleteProperty(r.Context(), userID, kind, id, r.PathValue("key")); err != nil {
+			respondWithServiceError(w, err)
+			return
+		}
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Property deleted"})
+	}
+}
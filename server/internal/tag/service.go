@@ -0,0 +1,550 @@
+package tag
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	KindFile   = "file"
+	KindFolder = "folder"
+
+	MaxNameLength     = 64
+	MaxKeyLength      = 128
+	MaxValueLength    = 4096
+	MaxSelectionItems = 1000
+)
+
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrTagExists       = errors.New("a tag with that name already exists")
+	ErrInvalidTag      = errors.New("invalid tag name")
+	ErrInvalidProperty = errors.New("invalid property")
+	ErrInvalidKind     = errors.New("invalid item kind")
+	ErrEmptySelection  = errors.New("nothing selected")
+	ErrTooManyItems    = fmt.Errorf("at most %d items can be selected", MaxSelectionItems)
+)
+
+type Queries interface {
+	UpsertTags(ctx context.Context, arg database.UpsertTagsParams) ([]database.Tag, error)
+	GetTag(ctx context.Context, arg database.GetTagParams) (database.Tag, error)
+	GetTagsByNames(ctx context.Context, arg database.GetTagsByNamesParams) ([]database.Tag, error)
+	ListTags(ctx context.Context, userID int32) ([]database.ListTagsRow, error)
+	RenameTag(ctx context.Context, arg database.RenameTagParams) (int64, error)
+	DeleteTag(ctx context.Context, arg database.DeleteTagParams) (int64, error)
+	TagFiles(ctx context.Context, arg database.TagFilesParams) (int64, error)
+	TagFolders(ctx context.Context, arg database.TagFoldersParams) (int64, error)
+	UntagFiles(ctx context.Context, arg database.UntagFilesParams) (int64, error)
+	UntagFolders(ctx context.Context, arg database.UntagFoldersParams) (int64, error)
+	PruneFileTags(ctx context.Context, arg database.PruneFileTagsParams) (int64, error)
+	PruneFolderTags(ctx context.Context, arg database.PruneFolderTagsParams) (int64, error)
+	ListTagsForItems(ctx context.Context, arg database.ListTagsForItemsParams) ([]database.ListTagsForItemsRow, error)
+	ListItemsByTag(ctx context.Context, arg database.ListItemsByTagParams) ([]database.ListItemsByTagRow, error)
+	CopyFileTags(ctx context.Context, arg database.CopyFileTagsParams) error
+	CopyFolderTags(ctx context.Context, arg database.CopyFolderTagsParams) error
+	ListFileProperties(ctx context.Context, fileID uuid.UUID) ([]database.FileProperty, error)
+	ListFolderProperties(ctx context.Context, folderID uuid.UUID) ([]database.FolderProperty, error)
+	SetFileProperty(ctx context.Context, arg database.SetFilePropertyParams) error
+	SetFolderProperty(ctx context.Context, arg database.SetFolderPropertyParams) error
+	DeleteFileProperty(ctx context.Context, arg database.DeleteFilePropertyParams) (int64, error)
+	DeleteFolderProperty(ctx context.Context, arg database.DeleteFolderPropertyParams) (int64, error)
+	CopyFileProperties(ctx context.Context, arg database.CopyFilePropertiesParams) error
+	CopyFolderProperties(ctx context.Context, arg database.CopyFolderPropertiesParams) error
+	GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error)
+	GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error)
+}
+
+type Tag struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	ItemCount int64     `json:"item_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Item is a file or folder carrying a tag.
+type Item struct {
+	Kind      string     `json:"kind"`
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	ParentID  *uuid.UUID `json:"parent_id"`
+	MimeType  string     `json:"mime_type,omitempty"`
+	SizeBytes *int64     `json:"size_bytes,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Selection is a set of files and folders to act on in bulk.
+type Selection struct {
+	Files   []uuid.UUID `json:"files"`
+	Folders []uuid.UUID `json:"folders"`
+}
+
+func (s Selection) size() int {
+	return len(s.Files) + len(s.Folders)
+}
+
+type Service struct {
+	queries Queries
+}
+
+func NewService(q Queries) *Service {
+	return &Service{queries: q}
+}
+
+// NormalizeName trims and lowercases a tag name and checks its length.
+func NormalizeName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || utf8.RuneCountInString(name) > MaxNameLength || strings.ContainsAny(name, ",\n\r\t") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTag, name)
+	}
+	return name, nil
+}
+
+func normalizeNames(names []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(names))
+	for _, n := range names {
+		name, err := NormalizeName(n)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+func tagIDs(tags []database.Tag) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(tags))
+	for _, t := range tags {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+func checkKind(kind string) error {
+	if kind != KindFile && kind != KindFolder {
+		return fmt.Errorf("%w: %q", ErrInvalidKind, kind)
+	}
+	return nil
+}
+
+func (s *Service) ListTags(ctx context.Context, userID int32) ([]Tag, error) {
+	rows, err := s.queries.ListTags(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing tags: %w", err)
+	}
+
+	tags := make([]Tag, 0, len(rows))
+	for _, r := range rows {
+		tags = append(tags, Tag{ID: r.ID, Name: r.Name, ItemCount: r.ItemCount, CreatedAt: r.CreatedAt})
+	}
+	return tags, nil
+}
+
+// CreateTag returns the existing tag if the user already has one by that name.
+func (s *Service) CreateTag(ctx context.Context, userID int32, name string) (Tag, error) {
+	name, err := NormalizeName(name)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	tags, err := s.queries.UpsertTags(ctx, database.UpsertTagsParams{UserID: userID, Names: []string{name}})
+	if err != nil {
+		return Tag{}, fmt.Errorf("creating tag: %w", err)
+	}
+	if len(tags) == 0 {
+		return Tag{}, fmt.Errorf("creating tag: no row returned")
+	}
+	return Tag{ID: tags[0].ID, Name: tags[0].Name, CreatedAt: tags[0].CreatedAt}, nil
+}
+
+func (s *Service) RenameTag(ctx context.Context, userID int32, id uuid.UUID, name string) (Tag, error) {
+	name, err := NormalizeName(name)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	current, err := s.queries.GetTag(ctx, database.GetTagParams{ID: id, UserID: userID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Tag{}, ErrNotFound
+		}
+		return Tag{}, fmt.Errorf("fetching tag: %w", err)
+	}
+	if current.Name == name {
+		return Tag{ID: current.ID, Name: current.Name, CreatedAt: current.CreatedAt}, nil
+	}
+
+	existing, err := s.queries.GetTagsByNames(ctx, database.GetTagsByNamesParams{UserID: userID, Names: []string{name}})
+	if err != nil {
+		return Tag{}, fmt.Errorf("checking tag name: %w", err)
+	}
+	if len(existing) > 0 {
+		return Tag{}, ErrTagExists
+	}
+
+	rows, err := s.queries.RenameTag(ctx, database.RenameTagParams{ID: id, Name: name, UserID: userID})
+	if err != nil {
+		return Tag{}, fmt.Errorf("renaming tag: %w", err)
+	}
+	if rows == 0 {
+		return Tag{}, ErrNotFound
+	}
+	return Tag{ID: current.ID, Name: name, CreatedAt: current.CreatedAt}, nil
+}
+
+func (s *Service) DeleteTag(ctx context.Context, userID int32, id uuid.UUID) error {
+	rows, err := s.queries.DeleteTag(ctx, database.DeleteTagParams{ID: id, UserID: userID})
+	if err != nil {
+		return fmt.Errorf("deleting tag: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Service) ListItemsByTag(ctx context.Context, userID int32, id uuid.UUID) ([]Item, error) {
+	if _, err := s.queries.GetTag(ctx, database.GetTagParams{ID: id, UserID: userID}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("fetching tag: %w", err)
+	}
+
+	rows, err := s.queries.ListItemsByTag(ctx, database.ListItemsByTagParams{TagID: id, UserID: userID})
+	if err != nil {
+		return nil, fmt.Errorf("listing tagged items: %w", err)
+	}
+
+	items := make([]Item, 0, len(rows))
+	for _, r := range rows {
+		item := Item{
+			Kind:      r.Kind,
+			ID:        r.ID,
+			Name:      r.Name,
+			MimeType:  r.MimeType.String,
+			CreatedAt: r.CreatedAt.Time,
+			UpdatedAt: r.UpdatedAt.Time,
+		}
+		if r.ParentID.Valid {
+			item.ParentID = &r.ParentID.UUID
+		}
+		if r.SizeBytes.Valid {
+			item.SizeBytes = &r.SizeBytes.Int64
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Apply adds the named tags to every selected item, creating tags as needed.
+// Items the user doesn't own are skipped. Returns the number of new
+// item/tag pairs.
+func (s *Service) Apply(ctx context.Context, userID int32, names []string, sel Selection) (int64, error) {
+	if err := checkSelection(sel); err != nil {
+		return 0, err
+	}
+	names, err := normalizeNames(names)
+	if err != nil {
+		return 0, err
+	}
+	if len(names) == 0 {
+		return 0, fmt.Errorf("%w: no tags given", ErrInvalidTag)
+	}
+
+	tags, err := s.queries.UpsertTags(ctx, database.UpsertTagsParams{UserID: userID, Names: names})
+	if err != nil {
+		return 0, fmt.Errorf("creating tags: %w", err)
+	}
+	return s.tag(ctx, userID, tagIDs(tags), sel)
+}
+
+// Remove takes the named tags off every selected item. Unknown tag names are
+// ignored. Returns the number of item/tag pairs removed.
+func (s *Service) Remove(ctx context.Context, userID int32, names []string, sel Selection) (int64, error) {
+	if err := checkSelection(sel); err != nil {
+		return 0, err
+	}
+	names, err := normalizeNames(names)
+	if err != nil {
+		return 0, err
+	}
+
+	tags, err := s.queries.GetTagsByNames(ctx, database.GetTagsByNamesParams{UserID: userID, Names: names})
+	if err != nil {
+		return 0, fmt.Errorf("fetching tags: %w", err)
+	}
+	if len(tags) == 0 {
+		return 0, nil
+	}
+	ids := tagIDs(tags)
+
+	var removed int64
+	if len(sel.Files) > 0 {
+		n, err := s.queries.UntagFiles(ctx, database.UntagFilesParams{UserID: userID, FileIds: sel.Files, TagIds: ids})
+		if err != nil {
+			return 0, fmt.Errorf("untagging files: %w", err)
+		}
+		removed += n
+	}
+	if len(sel.Folders) > 0 {
+		n, err := s.queries.UntagFolders(ctx, database.UntagFoldersParams{UserID: userID, FolderIds: sel.Folders, TagIds: ids})
+		if err != nil {
+			return removed, fmt.Errorf("untagging folders: %w", err)
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+func checkSelection(sel Selection) error {
+	if sel.size() == 0 {
+		return ErrEmptySelection
+	}
+	if sel.size() > MaxSelectionItems {
+		return ErrTooManyItems
+	}
+	return nil
+}
+
+func (s *Service) tag(ctx context.Context, userID int32, ids []uuid.UUID, sel Selection) (int64, error) {
+	var added int64
+	if len(sel.Files) > 0 {
+		n, err := s.queries.TagFiles(ctx, database.TagFilesParams{UserID: userID, FileIds: sel.Files, TagIds: ids})
+		if err != nil {
+			return 0, fmt.Errorf("tagging files: %w", err)
+		}
+		added += n
+	}
+	if len(sel.Folders) > 0 {
+		n, err := s.queries.TagFolders(ctx, database.TagFoldersParams{UserID: userID, FolderIds: sel.Folders, TagIds: ids})
+		if err != nil {
+			return added, fmt.Errorf("tagging folders: %w", err)
+		}
+		added += n
+	}
+	return added, nil
+}
+
+// checkOwner makes sure the item exists and belongs to the user.
+func (s *Service) checkOwner(ctx context.Context, userID int32, kind string, id uuid.UUID) error {
+	if err := checkKind(kind); err != nil {
+		return err
+	}
+
+	var owner sql.NullInt32
+	var err error
+	if kind == KindFile {
+		var f database.File
+		f, err = s.queries.GetFileByID(ctx, id)
+		owner = f.UserID
+	} else {
+		var d database.Folder
+		d, err = s.queries.GetFolderByID(ctx, id)
+		owner = d.UserID
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("fetching %s: %w", kind, err)
+	}
+	if owner.Int32 != userID {
+		// Someone else's item looks the same as a missing one
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ItemTags returns the tag names on one item.
+func (s *Service) ItemTags(ctx context.Context, userID int32, kind string, id uuid.UUID) ([]string, error) {
+	if err := s.checkOwner(ctx, userID, kind, id); err != nil {
+		return nil, err
+	}
+
+	var tags map[uuid.UUID][]string
+	var err error
+	if kind == KindFile {
+		tags, err = s.TagsFor(ctx, []uuid.UUID{id}, nil)
+	} else {
+		tags, err = s.TagsFor(ctx, nil, []uuid.UUID{id})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tags[id] == nil {
+		return []string{}, nil
+	}
+	return tags[id], nil
+}
+
+// SetItemTags replaces an item's tags with the given names.
+func (s *Service) SetItemTags(ctx context.Context, userID int32, kind string, id uuid.UUID, names []string) ([]string, error) {
+	if err := s.checkOwner(ctx, userID, kind, id); err != nil {
+		return nil, err
+	}
+	names, err := normalizeNames(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []database.Tag
+	if len(names) > 0 {
+		tags, err = s.queries.UpsertTags(ctx, database.UpsertTagsParams{UserID: userID, Names: names})
+		if err != nil {
+			return nil, fmt.Errorf("creating tags: %w", err)
+		}
+	}
+	ids := tagIDs(tags)
+
+	if kind == KindFile {
+		_, err = s.queries.PruneFileTags(ctx, database.PruneFileTagsParams{UserID: userID, FileID: id, KeepTagIds: ids})
+	} else {
+		_, err = s.queries.PruneFolderTags(ctx, database.PruneFolderTagsParams{UserID: userID, FolderID: id, KeepTagIds: ids})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("removing old tags: %w", err)
+	}
+
+	if len(ids) > 0 {
+		sel := Selection{Files: []uuid.UUID{id}}
+		if kind == KindFolder {
+			sel = Selection{Folders: []uuid.UUID{id}}
+		}
+		if _, err := s.tag(ctx, userID, ids, sel); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.ItemTags(ctx, userID, kind, id)
+}
+
+// TagsFor looks up the tag names of many items at once, keyed by item id.
+func (s *Service) TagsFor(ctx context.Context, fileIDs, folderIDs []uuid.UUID) (map[uuid.UUID][]string, error) {
+	tags := map[uuid.UUID][]string{}
+	if len(fileIDs) == 0 && len(folderIDs) == 0 {
+		return tags, nil
+	}
+
+	rows, err := s.queries.ListTagsForItems(ctx, database.ListTagsForItemsParams{
+		FileIds:   fileIDs,
+		FolderIds: folderIDs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing tags: %w", err)
+	}
+	for _, r := range rows {
+		tags[r.ItemID] = append(tags[r.ItemID], r.Name)
+	}
+	return tags, nil
+}
+
+// Properties returns an item's key/value metadata.
+func (s *Service) Properties(ctx context.Context, userID int32, kind string, id uuid.UUID) (map[string]string, error) {
+	if err := s.checkOwner(ctx, userID, kind, id); err != nil {
+		return nil, err
+	}
+
+	props := map[string]string{}
+	if kind == KindFile {
+		rows, err := s.queries.ListFileProperties(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("listing properties: %w", err)
+		}
+		for _, p := range rows {
+			props[p.Key] = p.Value
+		}
+	} else {
+		rows, err := s.queries.ListFolderProperties(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("listing properties: %w", err)
+		}
+		for _, p := range rows {
+			props[p.Key] = p.Value
+		}
+	}
+	return props, nil
+}
+
+func (s *Service) SetProperty(ctx context.Context, userID int32, kind string, id uuid.UUID, key, value string) error {
+	key = strings.TrimSpace(key)
+	if key == "" || utf8.RuneCountInString(key) > MaxKeyLength {
+		return fmt.Errorf("%w: key must be 1-%d characters", ErrInvalidProperty, MaxKeyLength)
+	}
+	if len(value) > MaxValueLength || !utf8.ValidString(value) {
+		return fmt.Errorf("%w: value must be valid UTF-8 of at most %d bytes", ErrInvalidProperty, MaxValueLength)
+	}
+	if err := s.checkOwner(ctx, userID, kind, id); err != nil {
+		return err
+	}
+
+	var err error
+	if kind == KindFile {
+		err = s.queries.SetFileProperty(ctx, database.SetFilePropertyParams{FileID: id, Key: key, Value: value})
+	} else {
+		err = s.queries.SetFolderProperty(ctx, database.SetFolderPropertyParams{FolderID: id, Key: key, Value: value})
+	}
+	if err != nil {
+		return fmt.Errorf("setting property: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) DeleteProperty(ctx context.Context, userID int32, kind string, id uuid.UUID, key string) error {
+	if err := s.checkOwner(ctx, userID, kind, id); err != nil {
+		return err
+	}
+
+	var rows int64
+	var err error
+	if kind == KindFile {
+		rows, err = s.queries.DeleteFileProperty(ctx, database.DeleteFilePropertyParams{FileID: id, Key: key})
+	} else {
+		rows, err = s.queries.DeleteFolderProperty(ctx, database.DeleteFolderPropertyParams{FolderID: id, Key: key})
+	}
+	if err != nil {
+		return fmt.Errorf("deleting property: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CopyMetadata gives dst the same tags and properties as src. Copy operations
+// call this once the new item exists.
+func (s *Service) CopyMetadata(ctx context.Context, kind string, srcID, dstID uuid.UUID) error {
+	if err := checkKind(kind); err != nil {
+		return err
+	}
+
+	if kind == KindFile {
+		if err := s.queries.CopyFileTags(ctx, database.CopyFileTagsParams{SrcID: srcID, DstID: dstID}); err != nil {
+			return fmt.Errorf("copying tags: %w", err)
+		}
+		if err := s.queries.CopyFileProperties(ctx, database.CopyFilePropertiesParams{SrcID: srcID, DstID: dstID}); err != nil {
+			return fmt.Errorf("copying properties: %w", err)
+		}
+		return nil
+	}
+
+	if err := s.queries.CopyFolderTags(ctx, database.CopyFolderTagsParams{SrcID: srcID, DstID: dstID}); err != nil {
+		return fmt.Errorf("copying tags: %w", err)
+	}
+	if err := s.queries.CopyFolderProperties(ctx, database.CopyFolderPropertiesParams{SrcID: srcID, DstID: dstID}); err != nil {
+		return fmt.Errorf("copying properties: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/tag"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) ListTags(ctx context.Context, userID int32) ([]tag.Tag, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]tag.Tag), args.Error(1)
+}
+
+func (m *MockService) CreateTag(ctx context.Context, userID int32, name string) (tag.Tag, error) {
+	args := m.Called(ctx, userID, name)
+	return args.Get(0).(tag.Tag), args.Error(1)
+}
+
+func (m *MockService) RenameTag(ctx context.Context, userID int32, id uuid.UUID, name string) (tag.Tag, error) {
+	args := m.Called(ctx, userID, id, name)
+	return args.Get(0).(tag.Tag), args.Error(1)
+}
+
+func (m *MockService) DeleteTag(ctx context.Context, userID int32, id uuid.UUID) error {
+	return m.Called(ctx, userID, id).Error(0)
+}
+
+func (m *MockService) ListItemsByTag(ctx context.Context, userID int32, id uuid.UUID) ([]tag.Item, error) {
+	args := m.Called(ctx, userID, id)
+	return args.Get(0).([]tag.Item), args.Error(1)
+}
+
+func (m *MockService) Apply(ctx context.Context, userID int32, names []string, sel tag.Selection) (int64, error) {
+	args := m.Called(ctx, userID, names, sel)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockService) Remove(ctx context.Context, userID int32, names []string, sel tag.Selection) (int64, error) {
+	args := m.Called(ctx, userID, names, sel)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockService) ItemTags(ctx context.Context, userID int32, kind string, id uuid.UUID) ([]string, error) {
+	args := m.Called(ctx, userID, kind, id)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockService) SetItemTags(ctx context.Context, userID int32, kind string, id uuid.UUID, names []string) ([]string, error) {
+	args := m.Called(ctx, userID, kind, id, names)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockService) Properties(ctx context.Context, userID int32, kind string, id uuid.UUID) (map[string]string, error) {
+	args := m.Called(ctx, userID, kind, id)
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+func (m *MockService) SetProperty(ctx context.Context, userID int32, kind string, id uuid.UUID, key, value string) error {
+	return m.Called(ctx, userID, kind, id, key, value).Error(0)
+}
+
+func (m *MockService) DeleteProperty(ctx context.Context, userID int32, kind string, id uuid.UUID, key string) error {
+	return m.Called(ctx, userID, kind, id, key).Error(0)
+}
+
+func asUser(req *http.Request, userID int32) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), userID))
+}
+
+func TestBulkTagHandler_Apply(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := tag.BulkTagHandler(mockSvc, false)
+	fileID := uuid.New()
+
+	mockSvc.On("Apply", mock.Anything, int32(1), []string{"work"}, tag.Selection{Files: []uuid.UUID{fileID}}).
+		Return(int64(1), nil)
+
+	body := `{"tags":["work"],"files":["` + fileID.String() + `"]}`
+	req := asUser(httptest.NewRequest(http.MethodPost, "/tags/apply", strings.NewReader(body)), 1)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"changed":1}`, rec.Body.String())
+	mockSvc.AssertExpectations(t)
+}
+
+func TestBulkTagHandler_EmptySelection(t *testing.T) {
+	mockSvc := new(MockService)
+	handler := tag.BulkTagHandler(mockSvc, true)
+
+	mockSvc.On("Remove", mock.Anything, int32(1), []string{"work"}, tag.Selection{}).
+		Return(int64(0), tag.ErrEmptySelection)
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/tags/remove", strings.NewReader(`{"tags":["work"]}`)), 1)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestRenameTagHandler_Conflict(t *testing.T) {
+	mockSvc := new(MockService)
+	mux := http.NewServeMux()
+	mux.Handle("PATCH /tags/{id}", tag.RenameTagHandler(mockSvc))
+	id := uuid.New()
+
+	mockSvc.On("RenameTag", mock.Anything, int32(1), id, "taken").Return(tag.Tag{}, tag.ErrTagExists)
+
+	req := asUser(httptest.NewRequest(http.MethodPatch, "/tags/"+id.String(), strings.NewReader(`{"name":"taken"}`)), 1)
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestSetPropertyHandler(t *testing.T) {
+	mockSvc := new(MockService)
+	mux := http.NewServeMux()
+	mux.Handle("PUT /folders/{id}/properties/{key}", tag.SetPropertyHandler(mockSvc, tag.KindFolder))
+	id := uuid.New()
+
+	mockSvc.On("SetProperty", mock.Anything, int32(1), tag.KindFolder, id, "client", "acme").Return(nil)
+
+	req := asUser(httptest.NewRequest(http.MethodPut, "/folders/"+id.String()+"/properties/client", strings.NewReader(`{"value":"acme"}`)), 1)
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"key":"client","value":"acme"}`, rec.Body.String())
+	mockSvc.AssertExpectations(t)
+}
+
+func TestPropertiesHandler_NotFound(t *testing.T) {
+	mockSvc := new(MockService)
+	mux := http.NewServeMux()
+	mux.Handle("GET /files/{id}/properties", tag.PropertiesHandler(mockSvc, tag.KindFile))
+	id := uuid.New()
+
+	mockSvc.On("Properties", mock.Anything, int32(1), tag.KindFile, id).Return(map[string]string(nil), tag.ErrNotFound)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/files/"+id.String()+"/properties", nil), 1)
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestListTagsHandler_Unauthorized(t *testing.T) {
+	handler := tag.ListTagsHandler(new(MockService))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tags", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,286 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/tag"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) UpsertTags(ctx context.Context, arg database.UpsertTagsParams) ([]database.Tag, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.Tag), args.Error(1)
+}
+
+func (m *MockQueries) GetTag(ctx context.Context, arg database.GetTagParams) (database.Tag, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(database.Tag), args.Error(1)
+}
+
+func (m *MockQueries) GetTagsByNames(ctx context.Context, arg database.GetTagsByNamesParams) ([]database.Tag, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.Tag), args.Error(1)
+}
+
+func (m *MockQueries) ListTags(ctx context.Context, userID int32) ([]database.ListTagsRow, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.ListTagsRow), args.Error(1)
+}
+
+func (m *MockQueries) RenameTag(ctx context.Context, arg database.RenameTagParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) DeleteTag(ctx context.Context, arg database.DeleteTagParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) TagFiles(ctx context.Context, arg database.TagFilesParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) TagFolders(ctx context.Context, arg database.TagFoldersParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) UntagFiles(ctx context.Context, arg database.UntagFilesParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) UntagFolders(ctx context.Context, arg database.UntagFoldersParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) PruneFileTags(ctx context.Context, arg database.PruneFileTagsParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) PruneFolderTags(ctx context.Context, arg database.PruneFolderTagsParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) ListTagsForItems(ctx context.Context, arg database.ListTagsForItemsParams) ([]database.ListTagsForItemsRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ListTagsForItemsRow), args.Error(1)
+}
+
+func (m *MockQueries) ListItemsByTag(ctx context.Context, arg database.ListItemsByTagParams) ([]database.ListItemsByTagRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]database.ListItemsByTagRow), args.Error(1)
+}
+
+func (m *MockQueries) CopyFileTags(ctx context.Context, arg database.CopyFileTagsParams) error {
+	return m.Called(ctx, arg).Error(0)
+}
+
+func (m *MockQueries) CopyFolderTags(ctx context.Context, arg database.CopyFolderTagsParams) error {
+	return m.Called(ctx, arg).Error(0)
+}
+
+func (m *MockQueries) ListFileProperties(ctx context.Context, fileID uuid.UUID) ([]database.FileProperty, error) {
+	args := m.Called(ctx, fileID)
+	return args.Get(0).([]database.FileProperty), args.Error(1)
+}
+
+func (m *MockQueries) ListFolderProperties(ctx context.Context, folderID uuid.UUID) ([]database.FolderProperty, error) {
+	args := m.Called(ctx, folderID)
+	return args.Get(0).([]database.FolderProperty), args.Error(1)
+}
+
+func (m *MockQueries) SetFileProperty(ctx context.Context, arg database.SetFilePropertyParams) error {
+	return m.Called(ctx, arg).Error(0)
+}
+
+func (m *MockQueries) SetFolderProperty(ctx context.Context, arg database.SetFolderPropertyParams) error {
+	return m.Called(ctx, arg).Error(0)
+}
+
+func (m *MockQueries) DeleteFileProperty(ctx context.Context, arg database.DeleteFilePropertyParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) DeleteFolderProperty(ctx context.Context, arg database.DeleteFolderPropertyParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) CopyFileProperties(ctx context.Context, arg database.CopyFilePropertiesParams) error {
+	return m.Called(ctx, arg).Error(0)
+}
+
+func (m *MockQueries) CopyFolderProperties(ctx context.Context, arg database.CopyFolderPropertiesParams) error {
+	return m.Called(ctx, arg).Error(0)
+}
+
+func (m *MockQueries) GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockQueries) GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func owned(id int32) sql.NullInt32 {
+	return sql.NullInt32{Int32: id, Valid: true}
+}
+
+func TestNormalizeName(t *testing.T) {
+	name, err := tag.NormalizeName("  Work ")
+	assert.NoError(t, err)
+	assert.Equal(t, "work", name)
+
+	for _, bad := range []string{"", "   ", "a,b", string(make([]byte, tag.MaxNameLength+1))} {
+		_, err := tag.NormalizeName(bad)
+		assert.ErrorIs(t, err, tag.ErrInvalidTag, bad)
+	}
+}
+
+func TestApply_CreatesTagsAndTagsSelection(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := tag.NewService(mockQ)
+	ctx := context.Background()
+
+	work, urgent := uuid.New(), uuid.New()
+	files := []uuid.UUID{uuid.New(), uuid.New()}
+	folders := []uuid.UUID{uuid.New()}
+
+	mockQ.On("UpsertTags", ctx, database.UpsertTagsParams{UserID: 1, Names: []string{"work", "urgent"}}).
+		Return([]database.Tag{{ID: work, Name: "work"}, {ID: urgent, Name: "urgent"}}, nil)
+	mockQ.On("TagFiles", ctx, database.TagFilesParams{UserID: 1, FileIds: files, TagIds: []uuid.UUID{work, urgent}}).
+		Return(int64(4), nil)
+	mockQ.On("TagFolders", ctx, database.TagFoldersParams{UserID: 1, FolderIds: folders, TagIds: []uuid.UUID{work, urgent}}).
+		Return(int64(1), nil)
+
+	n, err := svc.Apply(ctx, 1, []string{"Work", "urgent", "work"}, tag.Selection{Files: files, Folders: folders})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	mockQ.AssertExpectations(t)
+}
+
+func TestApply_RejectsEmptyAndOversizedSelections(t *testing.T) {
+	svc := tag.NewService(new(MockQueries))
+	ctx := context.Background()
+
+	_, err := svc.Apply(ctx, 1, []string{"work"}, tag.Selection{})
+	assert.ErrorIs(t, err, tag.ErrEmptySelection)
+
+	_, err = svc.Apply(ctx, 1, []string{"work"}, tag.Selection{Files: make([]uuid.UUID, tag.MaxSelectionItems+1)})
+	assert.ErrorIs(t, err, tag.ErrTooManyItems)
+}
+
+func TestRemove_IgnoresUnknownTags(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := tag.NewService(mockQ)
+	ctx := context.Background()
+
+	mockQ.On("GetTagsByNames", ctx, mock.Anything).Return([]database.Tag{}, nil)
+
+	n, err := svc.Remove(ctx, 1, []string{"nope"}, tag.Selection{Files: []uuid.UUID{uuid.New()}})
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	mockQ.AssertNotCalled(t, "UntagFiles", mock.Anything, mock.Anything)
+}
+
+func TestRenameTag_Conflict(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := tag.NewService(mockQ)
+	ctx := context.Background()
+	id := uuid.New()
+
+	mockQ.On("GetTag", ctx, database.GetTagParams{ID: id, UserID: 1}).Return(database.Tag{ID: id, Name: "old"}, nil)
+	mockQ.On("GetTagsByNames", ctx, database.GetTagsByNamesParams{UserID: 1, Names: []string{"taken"}}).
+		Return([]database.Tag{{ID: uuid.New(), Name: "taken"}}, nil)
+
+	_, err := svc.RenameTag(ctx, 1, id, "Taken")
+	assert.ErrorIs(t, err, tag.ErrTagExists)
+	mockQ.AssertNotCalled(t, "RenameTag", mock.Anything, mock.Anything)
+}
+
+func TestSetItemTags_ReplacesTags(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := tag.NewService(mockQ)
+	ctx := context.Background()
+	fileID, keep := uuid.New(), uuid.New()
+
+	mockQ.On("GetFileByID", ctx, fileID).Return(database.File{ID: fileID, UserID: owned(1)}, nil)
+	mockQ.On("UpsertTags", ctx, database.UpsertTagsParams{UserID: 1, Names: []string{"keep"}}).
+		Return([]database.Tag{{ID: keep, Name: "keep"}}, nil)
+	mockQ.On("PruneFileTags", ctx, database.PruneFileTagsParams{UserID: 1, FileID: fileID, KeepTagIds: []uuid.UUID{keep}}).
+		Return(int64(2), nil)
+	mockQ.On("TagFiles", ctx, database.TagFilesParams{UserID: 1, FileIds: []uuid.UUID{fileID}, TagIds: []uuid.UUID{keep}}).
+		Return(int64(0), nil)
+	mockQ.On("ListTagsForItems", ctx, database.ListTagsForItemsParams{FileIds: []uuid.UUID{fileID}}).
+		Return([]database.ListTagsForItemsRow{{Kind: tag.KindFile, ItemID: fileID, Name: "keep"}}, nil)
+
+	tags, err := svc.SetItemTags(ctx, 1, tag.KindFile, fileID, []string{"keep"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"keep"}, tags)
+	mockQ.AssertExpectations(t)
+}
+
+func TestProperties_OtherUsersItemIsNotFound(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := tag.NewService(mockQ)
+	ctx := context.Background()
+	folderID := uuid.New()
+
+	mockQ.On("GetFolderByID", ctx, folderID).Return(database.Folder{ID: folderID, UserID: owned(2)}, nil)
+
+	_, err := svc.Properties(ctx, 1, tag.KindFolder, folderID)
+	assert.ErrorIs(t, err, tag.ErrNotFound)
+	mockQ.AssertNotCalled(t, "ListFolderProperties", mock.Anything, mock.Anything)
+}
+
+func TestSetProperty_ValidatesKey(t *testing.T) {
+	svc := tag.NewService(new(MockQueries))
+
+	err := svc.SetProperty(context.Background(), 1, tag.KindFile, uuid.New(), "  ", "value")
+	assert.ErrorIs(t, err, tag.ErrInvalidProperty)
+}
+
+func TestSetProperty_Upserts(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := tag.NewService(mockQ)
+	ctx := context.Background()
+	fileID := uuid.New()
+
+	mockQ.On("GetFileByID", ctx, fileID).Return(database.File{ID: fileID, UserID: owned(1)}, nil)
+	mockQ.On("SetFileProperty", ctx, database.SetFilePropertyParams{FileID: fileID, Key: "project", Value: "apollo"}).Return(nil)
+
+	err := svc.SetProperty(ctx, 1, tag.KindFile, fileID, "project", "apollo")
+	assert.NoError(t, err)
+	mockQ.AssertExpectations(t)
+}
+
+func TestCopyMetadata_CopiesTagsAndProperties(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := tag.NewService(mockQ)
+	ctx := context.Background()
+	src, dst := uuid.New(), uuid.New()
+
+	mockQ.On("CopyFolderTags", ctx, database.CopyFolderTagsParams{SrcID: src, DstID: dst}).Return(nil)
+	mockQ.On("CopyFolderProperties", ctx, database.CopyFolderPropertiesParams{SrcID: src, DstID: dst}).Return(nil)
+
+	assert.NoError(t, svc.CopyMetadata(ctx, tag.KindFolder, src, dst))
+	mockQ.AssertExpectations(t)
+}
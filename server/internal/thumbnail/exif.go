@@ -0,0 +1,91 @@
+package thumbnail
+
+import "encoding/binary"
+
+// EXIF orientation values, as in the TIFF spec: 1 is upright, 2-4 are
+// mirrors and half turns, 5-8 swap width and height.
+const (
+	orientationNormal = 1
+	orientationMax    = 8
+	tagOrientation    = 0x0112
+)
+
+// jpegOrientation returns the EXIF orientation of a JPEG, or 1 when it has
+// none or the metadata can't be read. Only the first APP1 Exif segment
+// before the image data is considered.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return orientationNormal
+	}
+
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return orientationNormal
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// Markers without a length
+			i += 2
+			continue
+		case marker == 0xDA || marker == 0xD9:
+			// Image data starts; metadata only comes before it
+			return orientationNormal
+		}
+
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return orientationNormal
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(segment) >= 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return orientationNormal
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of a TIFF
+// header.
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return orientationNormal
+	}
+
+	var order binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return orientationNormal
+	}
+
+	ifd := int(order.Uint32(t[4:]))
+	if ifd < 8 || ifd+2 > len(t) {
+		return orientationNormal
+	}
+	entries := int(order.Uint16(t[ifd:]))
+	for k := 0; k < entries; k++ {
+		e := ifd + 2 + k*12
+		if e+12 > len(t) {
+			break
+		}
+		if order.Uint16(t[e:]) != tagOrientation {
+			continue
+		}
+		// A SHORT, stored in the first two bytes of the value field
+		if v := int(order.Uint16(t[e+8:])); v >= orientationNormal && v <= orientationMax {
+			return v
+		}
+		break
+	}
+	return orientationNormal
+}
@@ -0,0 +1,75 @@
+package thumbnail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/bellezhang119/cloud-storage/internal/content"
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+	"github.com/google/uuid"
+)
+
+// Thumbnails of a file never change: overwriting a file gives it a new ID.
+// The version only moves if the way thumbnails are made does.
+const (
+	cacheControl = "private, max-age=86400"
+	etagVersion  = "v1"
+)
+
+type ServiceInterface interface {
+	Open(ctx context.Context, fileID uuid.UUID, userID int32, size string) (database.File, *os.File, error)
+}
+
+// ThumbnailHandler serves GET /files/{id}/thumbnails/{size} and must be
+// mounted behind AuthMiddleware. A thumbnail still being generated gets a
+// 202 with Retry-After; conditional requests are answered with 304.
+func ThumbnailHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		fileID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid file ID")
+			return
+		}
+		size := r.PathValue("size")
+
+		f, thumb, err := service.Open(r.Context(), fileID, userID, size)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrInvalidSize):
+				util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			case errors.Is(err, ErrNotFound), errors.Is(err, ErrNoThumbnail):
+				util.RespondWithError(w, http.StatusNotFound, err.Error())
+			case errors.Is(err, ErrNotReady):
+				w.Header().Set("Retry-After", "2")
+				util.RespondWithError(w, http.StatusAccepted, err.Error())
+			default:
+				util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		defer thumb.Close()
+
+		info, err := thumb.Stat()
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/jpeg")
+		content.SetSafetyHeaders(w.Header())
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("ETag", fmt.Sprintf(`"%s-%s-%s"`, f.ID, size, etagVersion))
+		http.ServeContent(w, r, "", info.ModTime(), thumb)
+	}
+}
@@ -0,0 +1,201 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// Decoded images are held in memory at 4 bytes a pixel
+	maxPixels   = 40_000_000
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported image")
+	ErrTooLarge    = errors.New("image is too large to thumbnail")
+)
+
+// Size is a named bounding box; thumbnails keep their aspect ratio and are
+// never scaled up.
+type Size struct {
+	Name string
+	Max  int
+}
+
+var Sizes = []Size{
+	{Name: "small", Max: 128},
+	{Name: "medium", Max: 512},
+	{Name: "large", Max: 1024},
+}
+
+// LookupSize finds a size by name.
+func LookupSize(name string) (Size, bool) {
+	for _, s := range Sizes {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Size{}, false
+}
+
+// Generate decodes a JPEG, PNG or GIF (first frame) and returns one JPEG per
+// size, upright according to any EXIF orientation and flattened onto white.
+func Generate(data []byte, sizes []Size) (map[string][]byte, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	orientation := orientationNormal
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	src := toRGBA(img)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	out := make(map[string][]byte, len(sizes))
+	for _, size := range sizes {
+		// Fit the upright image, then scale the stored one to match, so
+		// the (slow) reorientation only ever touches the small result
+		uw, uh := sw, sh
+		if orientation >= 5 {
+			uw, uh = sh, sw
+		}
+		tw, th := fit(uw, uh, size.Max)
+		if orientation >= 5 {
+			tw, th = th, tw
+		}
+
+		thumb := src
+		if tw != sw || th != sh {
+			thumb = resize(src, tw, th)
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, flatten(orient(thumb, orientation)), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, fmt.Errorf("encoding %s thumbnail: %w", size.Name, err)
+		}
+		out[size.Name] = buf.Bytes()
+	}
+	return out, nil
+}
+
+// fit scales w×h down to fit a box×box square.
+func fit(w, h, box int) (int, int) {
+	if w <= box && h <= box {
+		return w, h
+	}
+	if w >= h {
+		return box, max(1, (h*box+w/2)/w)
+	}
+	return max(1, (w*box+h/2)/h), box
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// resize shrinks src with a box filter: each output pixel is the average of
+// the source pixels it covers. Averaging premultiplied RGBA keeps
+// transparent edges clean.
+func resize(src *image.RGBA, dw, dh int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for dy := 0; dy < dh; dy++ {
+		y0 := dy * sh / dh
+		y1 := max((dy+1)*sh/dh, y0+1)
+		for dx := 0; dx < dw; dx++ {
+			x0 := dx * sw / dw
+			x1 := max((dx+1)*sw/dw, x0+1)
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				off := src.PixOffset(x0, y)
+				for x := x0; x < x1; x++ {
+					r += uint64(src.Pix[off])
+					g += uint64(src.Pix[off+1])
+					b += uint64(src.Pix[off+2])
+					a += uint64(src.Pix[off+3])
+					n++
+					off += 4
+				}
+			}
+
+			d := dst.PixOffset(dx, dy)
+			dst.Pix[d] = uint8(r / n)
+			dst.Pix[d+1] = uint8(g / n)
+			dst.Pix[d+2] = uint8(b / n)
+			dst.Pix[d+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// orient turns a stored image upright for the given EXIF orientation.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= orientationNormal || orientation > orientationMax {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // needs a quarter turn clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // needs a quarter turn anticlockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
+
+// flatten composites src onto white; JPEG has no alpha channel.
+func flatten(src *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,220 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/jobs"
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+	"github.com/google/uuid"
+)
+
+// JobKind is the job queue kind for thumbnail generation.
+const JobKind = "thumbnails"
+
+const (
+	StatePending = "pending"
+	StateReady   = "ready"
+	StateFailed  = "failed"
+
+	// Larger sources aren't worth holding in memory to decode
+	maxSourceBytes = 50 << 20
+)
+
+var (
+	ErrNotFound    = errors.New("file not found")
+	ErrInvalidSize = errors.New("unknown thumbnail size")
+	ErrNoThumbnail = errors.New("no thumbnail for this file")
+	ErrNotReady    = errors.New("thumbnail is being generated")
+)
+
+type Payload struct {
+	FileID uuid.UUID `json:"file_id"`
+}
+
+type Queries interface {
+	GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error)
+	SetThumbnailState(ctx context.Context, arg database.SetThumbnailStateParams) (int64, error)
+}
+
+type Enqueuer interface {
+	Enqueue(ctx context.Context, kind string, userID int32, payload any) (database.Job, error)
+}
+
+// Pipeline schedules thumbnails after upload, builds them from the job queue
+// and serves them.
+type Pipeline struct {
+	queries Queries
+	storage storage.Storage
+	derived storage.DerivedStore
+	queue   Enqueuer
+}
+
+func NewPipeline(q Queries, s storage.Storage, d storage.DerivedStore, queue Enqueuer) *Pipeline {
+	return &Pipeline{queries: q, storage: s, derived: d, queue: queue}
+}
+
+var extensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// Supported reports whether a file is an image we can thumbnail, going by
+// its MIME type and falling back to the extension.
+func Supported(f database.File) bool {
+	if f.SizeBytes > maxSourceBytes {
+		return false
+	}
+	switch strings.ToLower(f.MimeType.String) {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	case "", "application/octet-stream":
+		return extensions[strings.ToLower(filepath.Ext(f.Name))]
+	}
+	return false
+}
+
+// Schedule marks a freshly saved image pending and queues its thumbnails.
+// Other files are left alone.
+func (p *Pipeline) Schedule(ctx context.Context, f database.File) error {
+	if !Supported(f) {
+		return nil
+	}
+
+	if _, err := p.queries.SetThumbnailState(ctx, database.SetThumbnailStateParams{
+		ID:             f.ID,
+		ThumbnailState: sql.NullString{String: StatePending, Valid: true},
+	}); err != nil {
+		return fmt.Errorf("marking thumbnails pending for %s: %w", f.ID, err)
+	}
+	if _, err := p.queue.Enqueue(ctx, JobKind, f.UserID.Int32, Payload{FileID: f.ID}); err != nil {
+		return fmt.Errorf("scheduling thumbnails for %s: %w", f.ID, err)
+	}
+	return nil
+}
+
+// Handle is the jobs.HandlerFunc for JobKind.
+func (p *Pipeline) Handle(ctx context.Context, job database.Job) error {
+	var payload Payload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil || payload.FileID == uuid.Nil {
+		return jobs.Permanent(fmt.Errorf("invalid payload: %s", job.Payload))
+	}
+
+	f, err := p.queries.GetFileByID(ctx, payload.FileID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted or overwritten before we got to it
+			return nil
+		}
+		return fmt.Errorf("fetching file: %w", err)
+	}
+	if !Supported(f) {
+		return nil
+	}
+
+	content, err := p.storage.ReadFile(f.UserID.Int32, f.FilePath)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+	defer content.Close()
+
+	data, err := io.ReadAll(io.LimitReader(content, maxSourceBytes+1))
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+	if len(data) > maxSourceBytes {
+		return p.fail(ctx, f, errors.New("file is too large"))
+	}
+
+	thumbs, err := Generate(data, Sizes)
+	if err != nil {
+		// A corrupt or oversized image won't get better on retry
+		return p.fail(ctx, f, err)
+	}
+
+	for name, thumb := range thumbs {
+		if err := p.derived.SaveDerived(f.UserID.Int32, f.ID, name+".jpg", bytes.NewReader(thumb)); err != nil {
+			return fmt.Errorf("storing %s thumbnail: %w", name, err)
+		}
+	}
+
+	rows, err := p.queries.SetThumbnailState(ctx, database.SetThumbnailStateParams{
+		ID:             f.ID,
+		ThumbnailState: sql.NullString{String: StateReady, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("marking thumbnails ready: %w", err)
+	}
+	if rows == 0 {
+		// The file went away while we worked; don't leave orphans behind
+		p.Forget(ctx, f.UserID.Int32, f.ID)
+	}
+	return nil
+}
+
+func (p *Pipeline) fail(ctx context.Context, f database.File, cause error) error {
+	if _, err := p.queries.SetThumbnailState(ctx, database.SetThumbnailStateParams{
+		ID:             f.ID,
+		ThumbnailState: sql.NullString{String: StateFailed, Valid: true},
+	}); err != nil {
+		return fmt.Errorf("marking thumbnails failed: %w", err)
+	}
+	return jobs.Permanent(cause)
+}
+
+// Forget deletes a file's thumbnails. It is registered as a delete hook, so
+// errors are only logged.
+func (p *Pipeline) Forget(ctx context.Context, userID int32, fileID uuid.UUID) {
+	if err := p.derived.DeleteDerived(userID, fileID); err != nil {
+		log.Printf("deleting thumbnails of %s: %v", fileID, err)
+	}
+}
+
+// Open returns a ready thumbnail of one of the user's files. Images saved
+// before thumbnails existed are queued on first request and reported as
+// ErrNotReady like any other pending image.
+func (p *Pipeline) Open(ctx context.Context, fileID uuid.UUID, userID int32, size string) (database.File, *os.File, error) {
+	if _, ok := LookupSize(size); !ok {
+		return database.File{}, nil, ErrInvalidSize
+	}
+
+	f, err := p.queries.GetFileByID(ctx, fileID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.File{}, nil, ErrNotFound
+		}
+		return database.File{}, nil, fmt.Errorf("fetching file: %w", err)
+	}
+	if f.UserID.Int32 != userID {
+		return database.File{}, nil, ErrNotFound
+	}
+
+	switch f.ThumbnailState.String {
+	case StateReady:
+	case StatePending:
+		return database.File{}, nil, ErrNotReady
+	case StateFailed:
+		return database.File{}, nil, ErrNoThumbnail
+	default:
+		if !Supported(f) {
+			return database.File{}, nil, ErrNoThumbnail
+		}
+		if err := p.Schedule(ctx, f); err != nil {
+			return database.File{}, nil, err
+		}
+		return database.File{}, nil, ErrNotReady
+	}
+
+	thumb, err := p.derived.OpenDerived(userID, f.ID, size+".jpg")
+	if err != nil {
+		return database.File{}, nil, fmt.Errorf("opening thumbnail: %w", err)
+	}
+	return f, thumb, nil
+}
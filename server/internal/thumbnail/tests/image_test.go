@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/thumbnail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// encodeJPEG writes a JPEG with an EXIF APP1 segment carrying orientation.
+func encodeJPEG(t *testing.T, w, h int, orientation uint16) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil))
+	data := buf.Bytes()
+
+	// Little-endian TIFF header, one IFD entry: orientation, SHORT, count 1
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	entry := make([]byte, 2+12+4)
+	binary.LittleEndian.PutUint16(entry[0:], 1)
+	binary.LittleEndian.PutUint16(entry[2:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[4:], 3)
+	binary.LittleEndian.PutUint32(entry[6:], 1)
+	binary.LittleEndian.PutUint16(entry[10:], orientation)
+	payload := append([]byte("Exif\x00\x00"), append(tiff, entry...)...)
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func decodedSize(t *testing.T, data []byte) (int, int) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	return cfg.Width, cfg.Height
+}
+
+func TestGenerate_FitsEachSize(t *testing.T) {
+	thumbs, err := thumbnail.Generate(encodePNG(t, 800, 400), thumbnail.Sizes)
+
+	require.NoError(t, err)
+	w, h := decodedSize(t, thumbs["small"])
+	assert.Equal(t, 128, w)
+	assert.Equal(t, 64, h)
+	w, h = decodedSize(t, thumbs["medium"])
+	assert.Equal(t, 512, w)
+	assert.Equal(t, 256, h)
+	// Never scaled up
+	w, h = decodedSize(t, thumbs["large"])
+	assert.Equal(t, 800, w)
+	assert.Equal(t, 400, h)
+}
+
+func TestGenerate_AppliesExifRotation(t *testing.T) {
+	// Stored landscape, displayed portrait after a quarter turn
+	thumbs, err := thumbnail.Generate(encodeJPEG(t, 300, 200, 6), []thumbnail.Size{{Name: "small", Max: 150}})
+
+	require.NoError(t, err)
+	w, h := decodedSize(t, thumbs["small"])
+	assert.Equal(t, 100, w)
+	assert.Equal(t, 150, h)
+}
+
+func TestGenerate_IgnoresUprightExif(t *testing.T) {
+	thumbs, err := thumbnail.Generate(encodeJPEG(t, 300, 200, 1), []thumbnail.Size{{Name: "small", Max: 150}})
+
+	require.NoError(t, err)
+	w, h := decodedSize(t, thumbs["small"])
+	assert.Equal(t, 150, w)
+	assert.Equal(t, 100, h)
+}
+
+func TestGenerate_RejectsNonImages(t *testing.T) {
+	_, err := thumbnail.Generate([]byte("%PDF-1.4"), thumbnail.Sizes)
+
+	assert.ErrorIs(t, err, thumbnail.ErrUnsupported)
+}
@@ -0,0 +1,276 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/thumbnail"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockQueries) SetThumbnailState(ctx context.Context, arg database.SetThumbnailStateParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockQueue struct {
+	mock.Mock
+}
+
+func (m *MockQueue) Enqueue(ctx context.Context, kind string, userID int32, payload any) (database.Job, error) {
+	args := m.Called(ctx, kind, userID, payload)
+	return args.Get(0).(database.Job), args.Error(1)
+}
+
+type MockDerived struct {
+	mock.Mock
+}
+
+func (m *MockDerived) SaveDerived(userID int32, fileID uuid.UUID, name string, content io.Reader) error {
+	return m.Called(userID, fileID, name, content).Error(0)
+}
+
+func (m *MockDerived) OpenDerived(userID int32, fileID uuid.UUID, name string) (*os.File, error) {
+	args := m.Called(userID, fileID, name)
+	f, _ := args.Get(0).(*os.File)
+	return f, args.Error(1)
+}
+
+func (m *MockDerived) DeleteDerived(userID int32, fileID uuid.UUID) error {
+	return m.Called(userID, fileID).Error(0)
+}
+
+type MockStorage struct {
+	mock.Mock
+}
+
+func (m *MockStorage) SaveFile(userID int32, path string, content io.Reader) error {
+	return m.Called(userID, path, content).Error(0)
+}
+
+func (m *MockStorage) ReadFile(userID int32, path string) (io.ReadCloser, error) {
+	args := m.Called(userID, path)
+	reader, _ := args.Get(0).(io.ReadCloser)
+	return reader, args.Error(1)
+}
+
+func (m *MockStorage) DeleteFile(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) CreateDirectory(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) DeleteDirectory(userID int32, path string) error {
+	return m.Called(userID, path).Error(0)
+}
+
+func (m *MockStorage) MoveFile(userID int32, oldPath, newPath string) error {
+	return m.Called(userID, oldPath, newPath).Error(0)
+}
+
+func (m *MockStorage) CopyFile(userID int32, srcPath, dstPath string) error {
+	return m.Called(userID, srcPath, dstPath).Error(0)
+}
+
+func (m *MockStorage) MoveDirectory(userID int32, oldPath, newPath string) error {
+	return m.Called(userID, oldPath, newPath).Error(0)
+}
+
+func (m *MockStorage) ZipFolder(userID int32, folderPath string, w io.Writer) error {
+	return m.Called(userID, folderPath, w).Error(0)
+}
+
+func (m *MockStorage) ZipPaths(userID int32, paths []string, w io.Writer) error {
+	return m.Called(userID, paths, w).Error(0)
+}
+
+func (m *MockStorage) DeleteUserData(userID int32) error {
+	return m.Called(userID).Error(0)
+}
+
+var uID = sql.NullInt32{Int32: 1, Valid: true}
+
+func state(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: true}
+}
+
+func TestSchedule_SkipsNonImages(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockQueue := new(MockQueue)
+	p := thumbnail.NewPipeline(mockQueries, new(MockStorage), new(MockDerived), mockQueue)
+
+	err := p.Schedule(context.Background(), database.File{ID: uuid.New(), UserID: uID, Name: "notes.txt", MimeType: state("text/plain")})
+
+	assert.NoError(t, err)
+	mockQueue.AssertNotCalled(t, "Enqueue", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandle_StoresEverySize(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockStorage := new(MockStorage)
+	mockDerived := new(MockDerived)
+	p := thumbnail.NewPipeline(mockQueries, mockStorage, mockDerived, new(MockQueue))
+	id := uuid.New()
+	data := encodePNG(t, 64, 64)
+
+	mockQueries.On("GetFileByID", mock.Anything, id).
+		Return(database.File{ID: id, UserID: uID, Name: "a.png", FilePath: "a.png", SizeBytes: int64(len(data)), MimeType: state("image/png")}, nil)
+	mockStorage.On("ReadFile", int32(1), "a.png").Return(io.NopCloser(strings.NewReader(string(data))), nil)
+	for _, size := range thumbnail.Sizes {
+		mockDerived.On("SaveDerived", int32(1), id, size.Name+".jpg", mock.Anything).Return(nil)
+	}
+	mockQueries.On("SetThumbnailState", mock.Anything, database.SetThumbnailStateParams{ID: id, ThumbnailState: state(thumbnail.StateReady)}).
+		Return(int64(1), nil)
+
+	payload, _ := json.Marshal(thumbnail.Payload{FileID: id})
+	err := p.Handle(context.Background(), database.Job{Payload: payload})
+
+	assert.NoError(t, err)
+	mockDerived.AssertExpectations(t)
+	mockQueries.AssertExpectations(t)
+	mockDerived.AssertNotCalled(t, "DeleteDerived", mock.Anything, mock.Anything)
+}
+
+func TestHandle_CorruptImageFailsForGood(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockStorage := new(MockStorage)
+	p := thumbnail.NewPipeline(mockQueries, mockStorage, new(MockDerived), new(MockQueue))
+	id := uuid.New()
+
+	mockQueries.On("GetFileByID", mock.Anything, id).
+		Return(database.File{ID: id, UserID: uID, Name: "a.jpg", FilePath: "a.jpg", SizeBytes: 9, MimeType: state("image/jpeg")}, nil)
+	mockStorage.On("ReadFile", int32(1), "a.jpg").Return(io.NopCloser(strings.NewReader("not a jpg")), nil)
+	mockQueries.On("SetThumbnailState", mock.Anything, database.SetThumbnailStateParams{ID: id, ThumbnailState: state(thumbnail.StateFailed)}).
+		Return(int64(1), nil)
+
+	payload, _ := json.Marshal(thumbnail.Payload{FileID: id})
+	err := p.Handle(context.Background(), database.Job{Payload: payload})
+
+	assert.ErrorIs(t, err, thumbnail.ErrUnsupported)
+	mockQueries.AssertExpectations(t)
+}
+
+func TestOpen_QueuesImagesFromBeforeThumbnails(t *testing.T) {
+	mockQueries := new(MockQueries)
+	mockQueue := new(MockQueue)
+	p := thumbnail.NewPipeline(mockQueries, new(MockStorage), new(MockDerived), mockQueue)
+	id := uuid.New()
+
+	mockQueries.On("GetFileByID", mock.Anything, id).
+		Return(database.File{ID: id, UserID: uID, Name: "old.JPG"}, nil)
+	mockQueries.On("SetThumbnailState", mock.Anything, database.SetThumbnailStateParams{ID: id, ThumbnailState: state(thumbnail.StatePending)}).
+		Return(int64(1), nil)
+	mockQueue.On("Enqueue", mock.Anything, thumbnail.JobKind, int32(1), thumbnail.Payload{FileID: id}).Return(database.Job{}, nil)
+
+	_, _, err := p.Open(context.Background(), id, 1, "small")
+
+	assert.ErrorIs(t, err, thumbnail.ErrNotReady)
+	mockQueue.AssertExpectations(t)
+}
+
+func TestOpen_OtherUsersFile(t *testing.T) {
+	mockQueries := new(MockQueries)
+	p := thumbnail.NewPipeline(mockQueries, new(MockStorage), new(MockDerived), new(MockQueue))
+	id := uuid.New()
+
+	mockQueries.On("GetFileByID", mock.Anything, id).
+		Return(database.File{ID: id, UserID: sql.NullInt32{Int32: 2, Valid: true}, ThumbnailState: state(thumbnail.StateReady)}, nil)
+
+	_, _, err := p.Open(context.Background(), id, 1, "small")
+
+	assert.ErrorIs(t, err, thumbnail.ErrNotFound)
+}
+
+type MockService struct {
+	mock.Mock
+}
+
+func (m *MockService) Open(ctx context.Context, fileID uuid.UUID, userID int32, size string) (database.File, *os.File, error) {
+	args := m.Called(ctx, fileID, userID, size)
+	f, _ := args.Get(1).(*os.File)
+	return args.Get(0).(database.File), f, args.Error(2)
+}
+
+func serve(svc thumbnail.ServiceInterface, id uuid.UUID, size string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/files/"+id.String()+"/thumbnails/"+size, nil)
+	req.SetPathValue("id", id.String())
+	req.SetPathValue("size", size)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req = req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), int32(1)))
+	rr := httptest.NewRecorder()
+	thumbnail.ThumbnailHandler(svc).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestThumbnailHandler_CachingHeaders(t *testing.T) {
+	id := uuid.New()
+	path := filepath.Join(t.TempDir(), "small.jpg")
+	require.NoError(t, os.WriteFile(path, []byte("jpeg bytes"), 0o644))
+
+	open := func() *os.File {
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		return f
+	}
+	mockSvc := new(MockService)
+	mockSvc.On("Open", mock.Anything, id, int32(1), "small").Return(database.File{ID: id}, open(), nil).Once()
+	mockSvc.On("Open", mock.Anything, id, int32(1), "small").Return(database.File{ID: id}, open(), nil).Once()
+
+	rr := serve(mockSvc, id, "small", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/jpeg", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Cache-Control"), "max-age=")
+	etag := rr.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	rr = serve(mockSvc, id, "small", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+}
+
+func TestThumbnailHandler_NotReady(t *testing.T) {
+	id := uuid.New()
+	mockSvc := new(MockService)
+	mockSvc.On("Open", mock.Anything, id, int32(1), "large").Return(database.File{}, nil, thumbnail.ErrNotReady)
+
+	rr := serve(mockSvc, id, "large", nil)
+
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+}
+
+func TestThumbnailHandler_StorageErrorIs500(t *testing.T) {
+	id := uuid.New()
+	mockSvc := new(MockService)
+	mockSvc.On("Open", mock.Anything, id, int32(1), "small").Return(database.File{}, nil, errors.New("disk gone"))
+
+	rr := serve(mockSvc, id, "small", nil)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
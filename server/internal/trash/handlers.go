@@ -0,0 +1,33 @@
+package trash
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
+	"github.com/bellezhang119/cloud-storage/internal/util"
+)
+
+type ServiceInterface interface {
+	List(ctx context.Context, userID int32) ([]Item, error)
+}
+
+// ListTrashHandler must be mounted behind AuthMiddleware. Items are moved in
+// and out of the trash through the batch endpoint.
+func ListTrashHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		items, err := service.List(r.Context(), userID)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, items)
+	}
+}
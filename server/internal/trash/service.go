@@ -0,0 +1,216 @@
+package trash
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	KindFile   = "file"
+	KindFolder = "folder"
+)
+
+var (
+	ErrNotFound       = errors.New("item not found")
+	ErrAlreadyTrashed = errors.New("item is already in the trash")
+	ErrNotTrashed     = errors.New("item is not in the trash")
+	ErrParentTrashed  = errors.New("the containing folder is in the trash; restore it first")
+)
+
+type Queries interface {
+	GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error)
+	GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error)
+	TrashFile(ctx context.Context, arg database.TrashFileParams) (int64, error)
+	RestoreFile(ctx context.Context, arg database.RestoreFileParams) (int64, error)
+	TrashFolder(ctx context.Context, arg database.TrashFolderParams) (int64, error)
+	RestoreFolder(ctx context.Context, arg database.RestoreFolderParams) (int64, error)
+	ListTrash(ctx context.Context, userID sql.NullInt32) ([]database.ListTrashRow, error)
+}
+
+// Item is something the user put in the trash; anything trashed along with
+// a folder is listed under that folder only.
+type Item struct {
+	Kind      string     `json:"kind"`
+	ID        uuid.UUID  `json:"id"`
+	ParentID  *uuid.UUID `json:"parent_id"`
+	Name      string     `json:"name"`
+	MimeType  string     `json:"mime_type,omitempty"`
+	SizeBytes *int64     `json:"size_bytes,omitempty"`
+	TrashedAt time.Time  `json:"trashed_at"`
+}
+
+// Service moves items in and out of the trash. Trashed items are hidden from
+// listings and search but keep their place on disk, so restoring is a flag
+// flip.
+type Service struct {
+	queries Queries
+}
+
+func NewService(q Queries) *Service {
+	return &Service{queries: q}
+}
+
+func (s *Service) List(ctx context.Context, userID int32) ([]Item, error) {
+	rows, err := s.queries.ListTrash(ctx, sql.NullInt32{Int32: userID, Valid: true})
+	if err != nil {
+		return nil, fmt.Errorf("listing trash: %w", err)
+	}
+
+	items := make([]Item, 0, len(rows))
+	for _, row := range rows {
+		item := Item{
+			Kind:      row.Kind,
+			ID:        row.ID,
+			Name:      row.Name,
+			MimeType:  row.MimeType.String,
+			TrashedAt: row.TrashedAt,
+		}
+		if row.ParentID.Valid {
+			item.ParentID = &row.ParentID.UUID
+		}
+		if row.SizeBytes.Valid {
+			item.SizeBytes = &row.SizeBytes.Int64
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (s *Service) ownedFile(ctx context.Context, userID int32, id uuid.UUID) (database.File, error) {
+	f, err := s.queries.GetFileByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.File{}, ErrNotFound
+		}
+		return database.File{}, fmt.Errorf("fetching file: %w", err)
+	}
+	if f.UserID.Int32 != userID {
+		return database.File{}, ErrNotFound
+	}
+	return f, nil
+}
+
+func (s *Service) ownedFolder(ctx context.Context, userID int32, id uuid.UUID) (database.Folder, error) {
+	f, err := s.queries.GetFolderByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Folder{}, ErrNotFound
+		}
+		return database.Folder{}, fmt.Errorf("fetching folder: %w", err)
+	}
+	if f.UserID.Int32 != userID {
+		return database.Folder{}, ErrNotFound
+	}
+	return f, nil
+}
+
+// parentTrashed reports whether restoring into parentID would leave the
+// item inside a folder that is still in the trash.
+func (s *Service) parentTrashed(ctx context.Context, parentID uuid.NullUUID) (bool, error) {
+	if !parentID.Valid {
+		return false, nil
+	}
+	parent, err := s.queries.GetFolderByID(ctx, parentID.UUID)
+	if err != nil {
+		return false, fmt.Errorf("fetching parent folder: %w", err)
+	}
+	return parent.TrashedAt.Valid, nil
+}
+
+func (s *Service) TrashFile(ctx context.Context, userID int32, id uuid.UUID) error {
+	f, err := s.ownedFile(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if f.TrashedAt.Valid {
+		return ErrAlreadyTrashed
+	}
+
+	rows, err := s.queries.TrashFile(ctx, database.TrashFileParams{ID: id, UserID: f.UserID})
+	if err != nil {
+		return fmt.Errorf("trashing file: %w", err)
+	}
+	if rows == 0 {
+		return ErrAlreadyTrashed
+	}
+	return nil
+}
+
+func (s *Service) RestoreFile(ctx context.Context, userID int32, id uuid.UUID) error {
+	f, err := s.ownedFile(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !f.TrashedAt.Valid {
+		return ErrNotTrashed
+	}
+	trashed, err := s.parentTrashed(ctx, f.FolderID)
+	if err != nil {
+		return err
+	}
+	if trashed {
+		return ErrParentTrashed
+	}
+
+	rows, err := s.queries.RestoreFile(ctx, database.RestoreFileParams{ID: id, UserID: f.UserID})
+	if err != nil {
+		return fmt.Errorf("restoring file: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotTrashed
+	}
+	return nil
+}
+
+// TrashFolder trashes a folder together with everything below it.
+func (s *Service) TrashFolder(ctx context.Context, userID int32, id uuid.UUID) error {
+	f, err := s.ownedFolder(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if f.TrashedAt.Valid {
+		return ErrAlreadyTrashed
+	}
+
+	rows, err := s.queries.TrashFolder(ctx, database.TrashFolderParams{ID: id, UserID: f.UserID})
+	if err != nil {
+		return fmt.Errorf("trashing folder: %w", err)
+	}
+	if rows == 0 {
+		return ErrAlreadyTrashed
+	}
+	return nil
+}
+
+// RestoreFolder brings back a folder and whatever was trashed with it.
+func (s *Service) RestoreFolder(ctx context.Context, userID int32, id uuid.UUID) error {
+	f, err := s.ownedFolder(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !f.TrashedAt.Valid {
+		return ErrNotTrashed
+	}
+	trashed, err := s.parentTrashed(ctx, f.ParentID)
+	if err != nil {
+		return err
+	}
+	if trashed {
+		return ErrParentTrashed
+	}
+
+	rows, err := s.queries.RestoreFolder(ctx, database.RestoreFolderParams{ID: id, UserID: f.UserID})
+	if err != nil {
+		return fmt.Errorf("restoring folder: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotTrashed
+	}
+	return nil
+}
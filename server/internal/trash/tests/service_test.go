@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/trash"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockQueries struct {
+	mock.Mock
+}
+
+func (m *MockQueries) GetFileByID(ctx context.Context, id uuid.UUID) (database.File, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.File), args.Error(1)
+}
+
+func (m *MockQueries) GetFolderByID(ctx context.Context, id uuid.UUID) (database.Folder, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(database.Folder), args.Error(1)
+}
+
+func (m *MockQueries) TrashFile(ctx context.Context, arg database.TrashFileParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) RestoreFile(ctx context.Context, arg database.RestoreFileParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) TrashFolder(ctx context.Context, arg database.TrashFolderParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) RestoreFolder(ctx context.Context, arg database.RestoreFolderParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) ListTrash(ctx context.Context, userID sql.NullInt32) ([]database.ListTrashRow, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]database.ListTrashRow), args.Error(1)
+}
+
+var uID = sql.NullInt32{Int32: 1, Valid: true}
+
+func trashedAt(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: true}
+}
+
+func TestTrashFile_Success(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := trash.NewService(mockQueries)
+	id := uuid.New()
+
+	mockQueries.On("GetFileByID", mock.Anything, id).Return(database.File{ID: id, UserID: uID}, nil)
+	mockQueries.On("TrashFile", mock.Anything, database.TrashFileParams{ID: id, UserID: uID}).Return(int64(1), nil)
+
+	assert.NoError(t, svc.TrashFile(context.Background(), 1, id))
+	mockQueries.AssertExpectations(t)
+}
+
+func TestTrashFile_AlreadyTrashed(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := trash.NewService(mockQueries)
+	id := uuid.New()
+
+	mockQueries.On("GetFileByID", mock.Anything, id).
+		Return(database.File{ID: id, UserID: uID, TrashedAt: trashedAt(time.Now())}, nil)
+
+	err := svc.TrashFile(context.Background(), 1, id)
+
+	assert.ErrorIs(t, err, trash.ErrAlreadyTrashed)
+	mockQueries.AssertNotCalled(t, "TrashFile", mock.Anything, mock.Anything)
+}
+
+func TestTrashFolder_NotOwner(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := trash.NewService(mockQueries)
+	id := uuid.New()
+
+	mockQueries.On("GetFolderByID", mock.Anything, id).
+		Return(database.Folder{ID: id, UserID: sql.NullInt32{Int32: 2, Valid: true}}, nil)
+
+	err := svc.TrashFolder(context.Background(), 1, id)
+
+	assert.ErrorIs(t, err, trash.ErrNotFound)
+}
+
+func TestRestoreFile_ParentStillTrashed(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := trash.NewService(mockQueries)
+	id, folderID := uuid.New(), uuid.New()
+	now := time.Now()
+
+	mockQueries.On("GetFileByID", mock.Anything, id).Return(database.File{
+		ID:        id,
+		UserID:    uID,
+		FolderID:  uuid.NullUUID{UUID: folderID, Valid: true},
+		TrashedAt: trashedAt(now),
+	}, nil)
+	mockQueries.On("GetFolderByID", mock.Anything, folderID).
+		Return(database.Folder{ID: folderID, UserID: uID, TrashedAt: trashedAt(now)}, nil)
+
+	err := svc.RestoreFile(context.Background(), 1, id)
+
+	assert.ErrorIs(t, err, trash.ErrParentTrashed)
+	mockQueries.AssertNotCalled(t, "RestoreFile", mock.Anything, mock.Anything)
+}
+
+func TestRestoreFolder_Success(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := trash.NewService(mockQueries)
+	id := uuid.New()
+
+	mockQueries.On("GetFolderByID", mock.Anything, id).
+		Return(database.Folder{ID: id, UserID: uID, TrashedAt: trashedAt(time.Now())}, nil)
+	mockQueries.On("RestoreFolder", mock.Anything, database.RestoreFolderParams{ID: id, UserID: uID}).Return(int64(3), nil)
+
+	assert.NoError(t, svc.RestoreFolder(context.Background(), 1, id))
+	mockQueries.AssertExpectations(t)
+}
+
+func TestList(t *testing.T) {
+	mockQueries := new(MockQueries)
+	svc := trash.NewService(mockQueries)
+	now := time.Now()
+
+	mockQueries.On("ListTrash", mock.Anything, uID).Return([]database.ListTrashRow{
+		{Kind: trash.KindFolder, ID: uuid.New(), Name: "old", TrashedAt: now},
+		{Kind: trash.KindFile, ID: uuid.New(), Name: "a.txt", SizeBytes: sql.NullInt64{Int64: 5, Valid: true}, TrashedAt: now},
+	}, nil)
+
+	items, err := svc.List(context.Background(), 1)
+
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Nil(t, items[0].SizeBytes)
+	assert.Equal(t, int64(5), *items[1].SizeBytes)
+}
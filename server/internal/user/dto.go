@@ -0,0 +1,50 @@
+package user
+
+import (
+	"time"
+
+	"github.com/bellezhang119/cloud-storage/internal/database"
+)
+
+// UserResponse is the public view of a user. Credentials and verification
+// tokens never leave the service.
+type UserResponse struct {
+	ID           int32     `json:"id"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	IsVerified   bool      `json:"is_verified"`
+	IsDisabled   bool      `json:"is_disabled"`
+	UsedStorage  int64     `json:"used_storage"`
+	StorageQuota int64     `json:"storage_quota"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// Set while a self-service deletion is waiting out its grace period
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+func NewUserResponse(u database.User) UserResponse {
+	res := UserResponse{
+		ID:           u.ID,
+		Email:        u.Email,
+		Role:         u.Role,
+		IsVerified:   u.IsVerified,
+		IsDisabled:   u.IsDisabled,
+		UsedStorage:  u.UsedStorage,
+		StorageQuota: u.StorageQuota,
+		CreatedAt:    u.CreatedAt,
+		UpdatedAt:    u.UpdatedAt,
+	}
+	if u.DeletionScheduledAt.Valid {
+		res.DeletionScheduledAt = &u.DeletionScheduledAt.Time
+	}
+	return res
+}
+
+func NewUserResponses(users []database.User) []UserResponse {
+	res := make([]UserResponse, 0, len(users))
+	for _, u := range users {
+		res = append(res, NewUserResponse(u))
+	}
+	return res
+}
@@ -2,19 +2,35 @@ package user
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
 	"github.com/bellezhang119/cloud-storage/internal/util"
 )
 
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
 type ServiceInterface interface {
 	GetUserByID(ctx context.Context, id int32) (database.User, error)
 	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserRole(ctx context.Context, id int32) (string, error)
+	ListUsers(ctx context.Context, query string, limit, offset int32) ([]database.User, error)
 	UpdateUserPassword(ctx context.Context, userID int32, newPassword string) error
 	UpdateUsedStorage(ctx context.Context, userID int32, newUsedStorage int64) error
+	SetUserRole(ctx context.Context, userID int32, role string) error
+	SetStorageQuota(ctx context.Context, userID int32, quota int64) error
+	SetUserDisabled(ctx context.Context, userID int32, disabled bool) error
+	ForceLogout(ctx context.Context, userID int32) (int64, error)
+	VerifyUserEmail(ctx context.Context, userID int32) error
 	DeleteUser(ctx context.Context, userID int32) error
 }
 
@@ -26,23 +42,82 @@ type UpdateStorageRequest struct {
 	NewUsedBytes int64 `json:"new_used_storage"`
 }
 
+type SetQuotaRequest struct {
+	StorageQuota int64 `json:"storage_quota"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// requesterID returns the user ID placed in the context by AuthMiddleware.
+func requesterID(r *http.Request) (int32, bool) {
+	id, ok := r.Context().Value(middleware.GetUserIDKey()).(int32)
+	return id, ok
+}
+
+// canAccess reports whether the requester may act on targetID: users can only
+// reach their own record, admins can reach any record.
+func canAccess(r *http.Request, service ServiceInterface, targetID int32) bool {
+	requester, ok := requesterID(r)
+	if !ok {
+		return false
+	}
+	if requester == targetID {
+		return true
+	}
+
+	role, err := service.GetUserRole(r.Context(), requester)
+	return err == nil && role == RoleAdmin
+}
+
+func parseUserID(r *http.Request) (int32, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return int32(id), nil
+}
+
+func GetCurrentUserHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := requesterID(r)
+		if !ok {
+			util.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		user, err := service.GetUserByID(r.Context(), id)
+		if err != nil {
+			util.RespondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, NewUserResponse(user))
+	}
+}
+
 func GetUserByIDHandler(service ServiceInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idStr := r.PathValue("id")
-		id, err := strconv.Atoi(idStr)
+		id, err := parseUserID(r)
 		if err != nil {
 			http.Error(w, "invalid user id", http.StatusBadRequest)
 			return
 		}
 
-		user, err := service.GetUserByID(r.Context(), int32(id))
+		if !canAccess(r, service, id) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		user, err := service.GetUserByID(r.Context(), id)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(user)
+		json.NewEncoder(w).Encode(NewUserResponse(user))
 	}
 }
 
@@ -54,26 +129,42 @@ func GetUserByEmailHandler(service ServiceInterface) http.HandlerFunc {
 			return
 		}
 
+		// An unknown address and someone else's both answer with the same
+		// "not found", so the endpoint can't be used to probe which addresses
+		// are registered.
 		user, err := service.GetUserByEmail(r.Context(), email)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			log.Printf("looking up user by email: %v", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !canAccess(r, service, user.ID) {
+			http.Error(w, "user not found", http.StatusNotFound)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(user)
+		json.NewEncoder(w).Encode(NewUserResponse(user))
 	}
 }
 
 func UpdatePasswordHandler(service ServiceInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idStr := r.PathValue("id")
-		id, err := strconv.Atoi(idStr)
+		id, err := parseUserID(r)
 		if err != nil {
 			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
 			return
 		}
 
+		if !canAccess(r, service, id) {
+			util.RespondWithError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
 		var req UpdatePasswordRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
@@ -85,7 +176,7 @@ func UpdatePasswordHandler(service ServiceInterface) http.HandlerFunc {
 			return
 		}
 
-		if err := service.UpdateUserPassword(r.Context(), int32(id), req.NewPassword); err != nil {
+		if err := service.UpdateUserPassword(r.Context(), id, req.NewPassword); err != nil {
 			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -96,10 +187,11 @@ func UpdatePasswordHandler(service ServiceInterface) http.HandlerFunc {
 	}
 }
 
+// UpdateStorageHandler overrides a user's used storage counter. It is a
+// support tool and must only be mounted behind RequireRole(admin).
 func UpdateStorageHandler(service ServiceInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idStr := r.PathValue("id")
-		id, err := strconv.Atoi(idStr)
+		id, err := parseUserID(r)
 		if err != nil {
 			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
 			return
@@ -110,7 +202,7 @@ func UpdateStorageHandler(service ServiceInterface) http.HandlerFunc {
 			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
 			return
 		}
-		if err := service.UpdateUsedStorage(r.Context(), int32(id), req.NewUsedBytes); err != nil {
+		if err := service.UpdateUsedStorage(r.Context(), id, req.NewUsedBytes); err != nil {
 			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -121,16 +213,23 @@ func UpdateStorageHandler(service ServiceInterface) http.HandlerFunc {
 	}
 }
 
+// DeleteUserHandler purges an account without a grace period. Users delete
+// their own account through the account package, so mount this behind
+// RequireRole(admin).
 func DeleteUserHandler(service ServiceInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idStr := r.PathValue("id")
-		id, err := strconv.Atoi(idStr)
+		id, err := parseUserID(r)
 		if err != nil {
 			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
 			return
 		}
 
-		if err := service.DeleteUser(r.Context(), int32(id)); err != nil {
+		if !canAccess(r, service, id) {
+			util.RespondWithError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		if err := service.DeleteUser(r.Context(), id); err != nil {
 			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -140,3 +239,160 @@ func DeleteUserHandler(service ServiceInterface) http.HandlerFunc {
 		})
 	}
 }
+
+// The handlers below are admin tools and must be mounted behind
+// RequireRole(admin).
+
+func ListUsersHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := int32(defaultListLimit)
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil || n <= 0 {
+				util.RespondWithError(w, http.StatusBadRequest, "Invalid limit")
+				return
+			}
+			limit = int32(min(n, maxListLimit))
+		}
+
+		var offset int32
+		if v := r.URL.Query().Get("offset"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil || n < 0 {
+				util.RespondWithError(w, http.StatusBadRequest, "Invalid offset")
+				return
+			}
+			offset = int32(n)
+		}
+
+		users, err := service.ListUsers(r.Context(), r.URL.Query().Get("q"), limit, offset)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, NewUserResponses(users))
+	}
+}
+
+func SetRoleHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseUserID(r)
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		var req SetRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if requester, _ := requesterID(r); requester == id && req.Role != RoleAdmin {
+			util.RespondWithError(w, http.StatusBadRequest, "Admins cannot demote themselves")
+			return
+		}
+
+		if err := service.SetUserRole(r.Context(), id, req.Role); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{
+			"message": "Role updated successfully",
+		})
+	}
+}
+
+func SetQuotaHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseUserID(r)
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		var req SetQuotaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+
+		if err := service.SetStorageQuota(r.Context(), id, req.StorageQuota); err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{
+			"message": "Storage quota updated successfully",
+		})
+	}
+}
+
+func SetDisabledHandler(service ServiceInterface, disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseUserID(r)
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		if requester, _ := requesterID(r); requester == id && disabled {
+			util.RespondWithError(w, http.StatusBadRequest, "Admins cannot disable themselves")
+			return
+		}
+
+		if err := service.SetUserDisabled(r.Context(), id, disabled); err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		msg := "User enabled successfully"
+		if disabled {
+			msg = "User disabled successfully"
+		}
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{
+			"message": msg,
+		})
+	}
+}
+
+func ForceLogoutHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseUserID(r)
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		revoked, err := service.ForceLogout(r.Context(), id)
+		if err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]int64{
+			"revoked_sessions": revoked,
+		})
+	}
+}
+
+func VerifyUserHandler(service ServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseUserID(r)
+		if err != nil {
+			util.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+
+		if err := service.VerifyUserEmail(r.Context(), id); err != nil {
+			util.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		util.RespondWithJSON(w, http.StatusOK, map[string]string{
+			"message": "Email verified",
+		})
+	}
+}
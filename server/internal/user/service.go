@@ -2,18 +2,33 @@ package user
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/bellezhang119/cloud-storage/internal/database"
 	"github.com/bellezhang119/cloud-storage/internal/util"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type Queries interface {
 	UpdateUserPassword(ctx context.Context, arg database.UpdateUserPasswordParams) (int64, error)
 	UpdateUsedStorage(ctx context.Context, arg database.UpdateUsedStorageParams) (int64, error)
-	DeleteUser(ctx context.Context, id int32) (int64, error)
+	ScheduleAccountDeletion(ctx context.Context, arg database.ScheduleAccountDeletionParams) (sql.NullTime, error)
 	GetUserByID(ctx context.Context, id int32) (database.User, error)
 	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	ListUsers(ctx context.Context, arg database.ListUsersParams) ([]database.User, error)
+	SearchUsers(ctx context.Context, arg database.SearchUsersParams) ([]database.User, error)
+	SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (int64, error)
+	SetUserStorageQuota(ctx context.Context, arg database.SetUserStorageQuotaParams) (int64, error)
+	SetUserDisabled(ctx context.Context, arg database.SetUserDisabledParams) (int64, error)
+	MarkUserAsVerified(ctx context.Context, id int32) (int64, error)
+	RevokeUserRefreshTokens(ctx context.Context, userID int32) (int64, error)
+	ResetFailedLogins(ctx context.Context, id int32) (int64, error)
 }
 
 type Service struct {
@@ -32,6 +47,33 @@ func (s *Service) GetUserByID(ctx context.Context, id int32) (database.User, err
 	return s.queries.GetUserByID(ctx, id)
 }
 
+// GetUserRole returns the role of an active user. Disabled accounts get an
+// error so role-gated routes reject them even with a still-valid access token.
+func (s *Service) GetUserRole(ctx context.Context, id int32) (string, error) {
+	user, err := s.queries.GetUserByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if user.IsDisabled {
+		return "", errors.New("account is disabled")
+	}
+	return user.Role, nil
+}
+
+func (s *Service) ListUsers(ctx context.Context, query string, limit, offset int32) ([]database.User, error) {
+	if query == "" {
+		return s.queries.ListUsers(ctx, database.ListUsersParams{
+			Limit:  limit,
+			Offset: offset,
+		})
+	}
+	return s.queries.SearchUsers(ctx, database.SearchUsersParams{
+		Query:  query,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
 func (s *Service) UpdateUserPassword(ctx context.Context, userID int32, newPassword string) error {
 	hashed, err := util.HashPassword(newPassword)
 	if err != nil {
@@ -65,8 +107,33 @@ func (s *Service) UpdateUsedStorage(ctx context.Context, userID int32, newUsedSt
 	return nil
 }
 
-func (s *Service) DeleteUser(ctx context.Context, userID int32) error {
-	rowsAffected, err := s.queries.DeleteUser(ctx, userID)
+func (s *Service) SetUserRole(ctx context.Context, userID int32, role string) error {
+	if role != RoleUser && role != RoleAdmin {
+		return fmt.Errorf("invalid role %q", role)
+	}
+
+	rowsAffected, err := s.queries.SetUserRole(ctx, database.SetUserRoleParams{
+		ID:   userID,
+		Role: role,
+	})
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no user found with id %d", userID)
+	}
+	return nil
+}
+
+func (s *Service) SetStorageQuota(ctx context.Context, userID int32, quota int64) error {
+	if quota < 0 {
+		return errors.New("storage quota cannot be negative")
+	}
+
+	rowsAffected, err := s.queries.SetUserStorageQuota(ctx, database.SetUserStorageQuotaParams{
+		ID:           userID,
+		StorageQuota: quota,
+	})
 	if err != nil {
 		return err
 	}
@@ -75,3 +142,67 @@ func (s *Service) DeleteUser(ctx context.Context, userID int32) error {
 	}
 	return nil
 }
+
+// SetUserDisabled enables or disables an account. Disabling also revokes all
+// refresh tokens so the user is signed out once their access token expires;
+// enabling clears any failed-login lockout.
+func (s *Service) SetUserDisabled(ctx context.Context, userID int32, disabled bool) error {
+	rowsAffected, err := s.queries.SetUserDisabled(ctx, database.SetUserDisabledParams{
+		ID:         userID,
+		IsDisabled: disabled,
+	})
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no user found with id %d", userID)
+	}
+
+	if disabled {
+		if _, err := s.queries.RevokeUserRefreshTokens(ctx, userID); err != nil {
+			return fmt.Errorf("revoking sessions: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := s.queries.ResetFailedLogins(ctx, userID); err != nil {
+		return fmt.Errorf("clearing lockout: %w", err)
+	}
+	return nil
+}
+
+// ForceLogout revokes every active refresh token for the user and returns how
+// many sessions were ended.
+func (s *Service) ForceLogout(ctx context.Context, userID int32) (int64, error) {
+	if _, err := s.queries.GetUserByID(ctx, userID); err != nil {
+		return 0, fmt.Errorf("no user found with id %d", userID)
+	}
+	return s.queries.RevokeUserRefreshTokens(ctx, userID)
+}
+
+func (s *Service) VerifyUserEmail(ctx context.Context, userID int32) error {
+	rowsAffected, err := s.queries.MarkUserAsVerified(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no user found with id %d", userID)
+	}
+	return nil
+}
+
+// DeleteUser schedules the account for an immediate purge. The account
+// purger removes the row along with stored files, shares, activity and tokens.
+func (s *Service) DeleteUser(ctx context.Context, userID int32) error {
+	_, err := s.queries.ScheduleAccountDeletion(ctx, database.ScheduleAccountDeletionParams{
+		ID:           userID,
+		GraceSeconds: 0,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no user found with id %d", userID)
+		}
+		return err
+	}
+	return nil
+}
@@ -3,12 +3,15 @@ package tests
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/middleware.go"
 	"github.com/bellezhang119/cloud-storage/internal/user"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -43,6 +46,46 @@ func (m *MockService) DeleteUser(ctx context.Context, userID int32) error {
 	return args.Error(0)
 }
 
+func (m *MockService) GetUserRole(ctx context.Context, id int32) (string, error) {
+	args := m.Called(ctx, id)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockService) ListUsers(ctx context.Context, query string, limit, offset int32) ([]database.User, error) {
+	args := m.Called(ctx, query, limit, offset)
+	return args.Get(0).([]database.User), args.Error(1)
+}
+
+func (m *MockService) SetUserRole(ctx context.Context, userID int32, role string) error {
+	args := m.Called(ctx, userID, role)
+	return args.Error(0)
+}
+
+func (m *MockService) SetStorageQuota(ctx context.Context, userID int32, quota int64) error {
+	args := m.Called(ctx, userID, quota)
+	return args.Error(0)
+}
+
+func (m *MockService) SetUserDisabled(ctx context.Context, userID int32, disabled bool) error {
+	args := m.Called(ctx, userID, disabled)
+	return args.Error(0)
+}
+
+func (m *MockService) ForceLogout(ctx context.Context, userID int32) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockService) VerifyUserEmail(ctx context.Context, userID int32) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+// asUser attaches an authenticated user ID the way AuthMiddleware would.
+func asUser(req *http.Request, userID int32) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), middleware.GetUserIDKey(), userID))
+}
+
 func TestGetUserByIDHandler(t *testing.T) {
 	mockSvc := &MockService{}
 	mockUser := database.User{ID: 1, Email: "foo@bar.com"}
@@ -52,14 +95,14 @@ func TestGetUserByIDHandler(t *testing.T) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /users/{id}", user.GetUserByIDHandler(mockSvc))
 
-	req := httptest.NewRequest("GET", "/users/1", nil)
+	req := asUser(httptest.NewRequest("GET", "/users/1", nil), 1)
 	rr := httptest.NewRecorder()
 
 	mux.ServeHTTP(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
-	var u database.User
+	var u user.UserResponse
 	json.NewDecoder(rr.Body).Decode(&u)
 	assert.Equal(t, "foo@bar.com", u.Email)
 
@@ -75,14 +118,14 @@ func TestGetUserByEmailHandler(t *testing.T) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /users/email", user.GetUserByEmailHandler(mockSvc))
 
-	req := httptest.NewRequest("GET", "/users/email?email=bar@foo.com", nil)
+	req := asUser(httptest.NewRequest("GET", "/users/email?email=bar@foo.com", nil), 2)
 	rr := httptest.NewRecorder()
 
 	mux.ServeHTTP(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
-	var u database.User
+	var u user.UserResponse
 	json.NewDecoder(rr.Body).Decode(&u)
 	assert.Equal(t, "bar@foo.com", u.Email)
 
@@ -91,13 +134,13 @@ func TestGetUserByEmailHandler(t *testing.T) {
 
 func TestUpdatePasswordHandler(t *testing.T) {
 	mockSvc := &MockService{}
-	mockSvc.On("UpdatePassword", mock.Anything, int32(1), "password123").Return(nil)
+	mockSvc.On("UpdateUserPassword", mock.Anything, int32(1), "password123").Return(nil)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("PATCH /users/{id}/password", user.UpdatePasswordHandler(mockSvc))
 
 	body := `{"new_password":"password123"}`
-	req := httptest.NewRequest("PATCH", "/users/1/password", bytes.NewBufferString(body))
+	req := asUser(httptest.NewRequest("PATCH", "/users/1/password", bytes.NewBufferString(body)), 1)
 	rr := httptest.NewRecorder()
 
 	mux.ServeHTTP(rr, req)
@@ -108,7 +151,7 @@ func TestUpdatePasswordHandler(t *testing.T) {
 
 func TestUpdateStorageHandler(t *testing.T) {
 	mockSvc := &MockService{}
-	mockSvc.On("UpdateStorage", mock.Anything, int32(1), int64(1024)).Return(nil)
+	mockSvc.On("UpdateUsedStorage", mock.Anything, int32(1), int64(1024)).Return(nil)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("PATCH /users/{id}/storage", user.UpdateStorageHandler(mockSvc))
@@ -125,16 +168,172 @@ func TestUpdateStorageHandler(t *testing.T) {
 
 func TestDeleteUserHandler(t *testing.T) {
 	mockSvc := &MockService{}
-	mockSvc.On("Delete", mock.Anything, int32(1)).Return(nil)
+	mockSvc.On("DeleteUser", mock.Anything, int32(1)).Return(nil)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("DELETE /users/{id}", user.DeleteUserHandler(mockSvc))
 
-	req := httptest.NewRequest("DELETE", "/users/1", nil)
+	req := asUser(httptest.NewRequest("DELETE", "/users/1", nil), 1)
+	rr := httptest.NewRecorder()
+
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestGetUserByIDHandler_OmitsSecrets(t *testing.T) {
+	mockSvc := &MockService{}
+	mockUser := database.User{ID: 1, Email: "foo@bar.com", PasswordHash: "hash"}
+
+	mockSvc.On("GetUserByID", mock.Anything, int32(1)).Return(mockUser, nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", user.GetUserByIDHandler(mockSvc))
+
+	req := asUser(httptest.NewRequest("GET", "/users/1", nil), 1)
+	rr := httptest.NewRecorder()
+
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "hash")
+	assert.NotContains(t, rr.Body.String(), "verification_token")
+}
+
+func TestGetUserByIDHandler_OtherUserForbidden(t *testing.T) {
+	mockSvc := &MockService{}
+	mockSvc.On("GetUserRole", mock.Anything, int32(2)).Return(user.RoleUser, nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", user.GetUserByIDHandler(mockSvc))
+
+	req := asUser(httptest.NewRequest("GET", "/users/1", nil), 2)
+	rr := httptest.NewRecorder()
+
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	mockSvc.AssertNotCalled(t, "GetUserByID", mock.Anything, int32(1))
+}
+
+func TestGetUserByIDHandler_AdminAllowed(t *testing.T) {
+	mockSvc := &MockService{}
+	mockSvc.On("GetUserRole", mock.Anything, int32(2)).Return(user.RoleAdmin, nil)
+	mockSvc.On("GetUserByID", mock.Anything, int32(1)).Return(database.User{ID: 1, Email: "foo@bar.com"}, nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", user.GetUserByIDHandler(mockSvc))
+
+	req := asUser(httptest.NewRequest("GET", "/users/1", nil), 2)
+	rr := httptest.NewRecorder()
+
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestGetUserByEmailHandler_OtherUserNotFound(t *testing.T) {
+	mockSvc := &MockService{}
+	mockSvc.On("GetUserByEmail", mock.Anything, "bar@foo.com").Return(database.User{ID: 2, Email: "bar@foo.com"}, nil)
+	mockSvc.On("GetUserRole", mock.Anything, int32(3)).Return("", errors.New("account is disabled"))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/email", user.GetUserByEmailHandler(mockSvc))
+
+	req := asUser(httptest.NewRequest("GET", "/users/email?email=bar@foo.com", nil), 3)
+	rr := httptest.NewRecorder()
+
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "user not found\n", rr.Body.String())
+}
+
+func TestGetUserByEmailHandler_UnknownAddressLooksTheSame(t *testing.T) {
+	mockSvc := &MockService{}
+	mockSvc.On("GetUserByEmail", mock.Anything, "nobody@foo.com").Return(database.User{}, sql.ErrNoRows)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/email", user.GetUserByEmailHandler(mockSvc))
+
+	req := asUser(httptest.NewRequest("GET", "/users/email?email=nobody@foo.com", nil), 3)
+	rr := httptest.NewRecorder()
+
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "user not found\n", rr.Body.String())
+}
+
+func TestListUsersHandler(t *testing.T) {
+	mockSvc := &MockService{}
+	mockSvc.On("ListUsers", mock.Anything, "foo", int32(200), int32(10)).
+		Return([]database.User{{ID: 1, Email: "foo@bar.com", Role: user.RoleAdmin}}, nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/users", user.ListUsersHandler(mockSvc))
+
+	req := asUser(httptest.NewRequest("GET", "/admin/users?q=foo&limit=1000&offset=10", nil), 1)
+	rr := httptest.NewRecorder()
+
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var users []user.UserResponse
+	json.NewDecoder(rr.Body).Decode(&users)
+	assert.Len(t, users, 1)
+	assert.Equal(t, user.RoleAdmin, users[0].Role)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestSetRoleHandler_CannotDemoteSelf(t *testing.T) {
+	mockSvc := &MockService{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PATCH /admin/users/{id}/role", user.SetRoleHandler(mockSvc))
+
+	body := `{"role":"user"}`
+	req := asUser(httptest.NewRequest("PATCH", "/admin/users/1/role", bytes.NewBufferString(body)), 1)
+	rr := httptest.NewRecorder()
+
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	mockSvc.AssertNotCalled(t, "SetUserRole", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSetDisabledHandler(t *testing.T) {
+	mockSvc := &MockService{}
+	mockSvc.On("SetUserDisabled", mock.Anything, int32(5), true).Return(nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/users/{id}/disable", user.SetDisabledHandler(mockSvc, true))
+
+	req := asUser(httptest.NewRequest("POST", "/admin/users/5/disable", nil), 1)
+	rr := httptest.NewRecorder()
+
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestForceLogoutHandler(t *testing.T) {
+	mockSvc := &MockService{}
+	mockSvc.On("ForceLogout", mock.Anything, int32(5)).Return(int64(3), nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/users/{id}/logout", user.ForceLogoutHandler(mockSvc))
+
+	req := asUser(httptest.NewRequest("POST", "/admin/users/5/logout", nil), 1)
 	rr := httptest.NewRecorder()
 
 	mux.ServeHTTP(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"revoked_sessions":3`)
 	mockSvc.AssertExpectations(t)
 }
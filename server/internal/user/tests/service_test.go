@@ -2,7 +2,9 @@ package tests
 
 import (
 	"context"
+	"database/sql"
 	"testing"
+	"time"
 
 	"github.com/bellezhang119/cloud-storage/internal/database"
 	"github.com/bellezhang119/cloud-storage/internal/user"
@@ -34,7 +36,47 @@ func (m *MockQueries) UpdateUsedStorage(ctx context.Context, params database.Upd
 	return args.Get(0).(int64), args.Error(1)
 }
 
-func (m *MockQueries) DeleteUser(ctx context.Context, userID int32) (int64, error) {
+func (m *MockQueries) ScheduleAccountDeletion(ctx context.Context, params database.ScheduleAccountDeletionParams) (sql.NullTime, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(sql.NullTime), args.Error(1)
+}
+
+func (m *MockQueries) ListUsers(ctx context.Context, params database.ListUsersParams) ([]database.User, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).([]database.User), args.Error(1)
+}
+
+func (m *MockQueries) SearchUsers(ctx context.Context, params database.SearchUsersParams) ([]database.User, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).([]database.User), args.Error(1)
+}
+
+func (m *MockQueries) SetUserRole(ctx context.Context, params database.SetUserRoleParams) (int64, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) SetUserStorageQuota(ctx context.Context, params database.SetUserStorageQuotaParams) (int64, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) SetUserDisabled(ctx context.Context, params database.SetUserDisabledParams) (int64, error) {
+	args := m.Called(ctx, params)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) MarkUserAsVerified(ctx context.Context, userID int32) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) RevokeUserRefreshTokens(ctx context.Context, userID int32) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQueries) ResetFailedLogins(ctx context.Context, userID int32) (int64, error) {
 	args := m.Called(ctx, userID)
 	return args.Get(0).(int64), args.Error(1)
 }
@@ -78,9 +120,92 @@ func TestDeleteUser(t *testing.T) {
 	ctx := context.Background()
 	userID := int32(1)
 
-	mockQ.On("DeleteUser", ctx, userID).Return(int64(1), nil)
+	mockQ.On("ScheduleAccountDeletion", ctx, database.ScheduleAccountDeletionParams{
+		ID:           userID,
+		GraceSeconds: 0,
+	}).Return(sql.NullTime{Time: time.Now(), Valid: true}, nil)
 
 	err := svc.DeleteUser(ctx, userID)
 	assert.NoError(t, err)
 	mockQ.AssertExpectations(t)
 }
+
+func TestDeleteUser_NotFound(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := user.NewService(mockQ)
+	ctx := context.Background()
+
+	mockQ.On("ScheduleAccountDeletion", ctx, mock.Anything).Return(sql.NullTime{}, sql.ErrNoRows)
+
+	err := svc.DeleteUser(ctx, 9)
+	assert.EqualError(t, err, "no user found with id 9")
+}
+
+func TestGetUserRole_Disabled(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := user.NewService(mockQ)
+	ctx := context.Background()
+
+	mockQ.On("GetUserByID", ctx, int32(1)).Return(database.User{ID: 1, Role: user.RoleAdmin, IsDisabled: true}, nil)
+
+	_, err := svc.GetUserRole(ctx, 1)
+	assert.Error(t, err)
+}
+
+func TestListUsers_UsesSearchWhenQueryGiven(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := user.NewService(mockQ)
+	ctx := context.Background()
+
+	mockQ.On("SearchUsers", ctx, database.SearchUsersParams{Query: "foo", Limit: 10, Offset: 0}).
+		Return([]database.User{{ID: 1}}, nil)
+
+	users, err := svc.ListUsers(ctx, "foo", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	mockQ.AssertNotCalled(t, "ListUsers", mock.Anything, mock.Anything)
+}
+
+func TestSetUserRole_Invalid(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := user.NewService(mockQ)
+
+	err := svc.SetUserRole(context.Background(), 1, "superuser")
+	assert.Error(t, err)
+	mockQ.AssertNotCalled(t, "SetUserRole", mock.Anything, mock.Anything)
+}
+
+func TestSetUserDisabled_RevokesSessions(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := user.NewService(mockQ)
+	ctx := context.Background()
+
+	mockQ.On("SetUserDisabled", ctx, database.SetUserDisabledParams{ID: 1, IsDisabled: true}).Return(int64(1), nil)
+	mockQ.On("RevokeUserRefreshTokens", ctx, int32(1)).Return(int64(2), nil)
+
+	err := svc.SetUserDisabled(ctx, 1, true)
+	assert.NoError(t, err)
+	mockQ.AssertExpectations(t)
+}
+
+func TestSetStorageQuota_Negative(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := user.NewService(mockQ)
+
+	err := svc.SetStorageQuota(context.Background(), 1, -1)
+	assert.Error(t, err)
+}
+
+func TestSetUserDisabled_EnableClearsLockout(t *testing.T) {
+	mockQ := new(MockQueries)
+	svc := user.NewService(mockQ)
+	ctx := context.Background()
+
+	mockQ.On("SetUserDisabled", ctx, database.SetUserDisabledParams{ID: 1, IsDisabled: false}).Return(int64(1), nil)
+	mockQ.On("ResetFailedLogins", ctx, int32(1)).Return(int64(1), nil)
+
+	err := svc.SetUserDisabled(ctx, 1, false)
+	assert.NoError(t, err)
+	mockQ.AssertExpectations(t)
+	mockQ.AssertNotCalled(t, "RevokeUserRefreshTokens", mock.Anything, mock.Anything)
+}
@@ -12,16 +12,28 @@ import (
 
 var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
 
-func GenerateJWTTokens(userID int32, email string, refreshTokenExpiry time.Time) (accessToken string, refreshToken string, err error) {
+// Token types, carried in the "typ" claim so that neither kind of token can
+// stand in for the other.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// GenerateJWTTokens issues an access and a refresh token. version is the
+// user's token version, which access tokens carry so they can be revoked.
+func GenerateJWTTokens(userID int32, email string, version int32, refreshTokenExpiry time.Time) (accessToken string, refreshToken string, err error) {
 	accessClaims := jwt.MapClaims{
 		"user_id": userID,
 		"email":   email,
+		"ver":     version,
+		"typ":     TokenTypeAccess,
 		"exp":     time.Now().Add(15 * time.Minute).Unix(),
 	}
 
 	refreshClaims := jwt.MapClaims{
 		"user_id": userID,
 		"email":   email,
+		"typ":     TokenTypeRefresh,
 		"exp":     refreshTokenExpiry.Unix(),
 	}
 
@@ -53,7 +65,7 @@ func VerifyAccessToken(tokenStr string) (claims jwt.MapClaims, err error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && claims["typ"] == TokenTypeAccess {
 		return claims, nil
 	}
 
@@ -72,7 +84,7 @@ func VerifyRefreshToken(tokenStr string) (jwt.MapClaims, error) {
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || claims["typ"] != TokenTypeRefresh {
 		return nil, errors.New("invalid token")
 	}
 
@@ -16,7 +16,7 @@ func TestGenerateJWTTokensAndVerify(t *testing.T) {
 	email := "user@example.com"
 	refreshExpiry := time.Now().Add(24 * time.Hour)
 
-	accessToken, refreshToken, err := util.GenerateJWTTokens(userID, email, refreshExpiry)
+	accessToken, refreshToken, err := util.GenerateJWTTokens(userID, email, 0, refreshExpiry)
 	if err != nil {
 		t.Fatalf("GenerateJWTTokens failed: %v", err)
 	}
@@ -50,6 +50,20 @@ func TestGenerateJWTTokensAndVerify(t *testing.T) {
 	}
 }
 
+func TestVerifyTokens_RejectTheOtherType(t *testing.T) {
+	accessToken, refreshToken, err := util.GenerateJWTTokens(123, "user@example.com", 0, time.Now().Add(30*24*time.Hour))
+	if err != nil {
+		t.Fatalf("GenerateJWTTokens failed: %v", err)
+	}
+
+	if _, err := util.VerifyAccessToken(refreshToken); err == nil {
+		t.Error("Expected a refresh token to be refused as an access token")
+	}
+	if _, err := util.VerifyRefreshToken(accessToken); err == nil {
+		t.Error("Expected an access token to be refused as a refresh token")
+	}
+}
+
 func TestVerifyAccessToken_InvalidToken(t *testing.T) {
 	_, err := util.VerifyAccessToken("invalid.token")
 	if err == nil {
@@ -62,7 +76,7 @@ func TestVerifyRefreshToken_ExpiredToken(t *testing.T) {
 	email := "user@example.com"
 	expiry := time.Now().Add(-1 * time.Hour) // expired
 
-	_, refreshToken, err := util.GenerateJWTTokens(userID, email, expiry)
+	_, refreshToken, err := util.GenerateJWTTokens(userID, email, 0, expiry)
 	if err != nil {
 		t.Fatalf("GenerateJWTTokens failed: %v", err)
 	}
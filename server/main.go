@@ -1,15 +1,39 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/bellezhang119/cloud-storage/internal/account"
+	"github.com/bellezhang119/cloud-storage/internal/archive"
 	"github.com/bellezhang119/cloud-storage/internal/auth"
+	"github.com/bellezhang119/cloud-storage/internal/batch"
+	"github.com/bellezhang119/cloud-storage/internal/changes"
 	"github.com/bellezhang119/cloud-storage/internal/config"
 	"github.com/bellezhang119/cloud-storage/internal/database"
+	"github.com/bellezhang119/cloud-storage/internal/dav"
+	"github.com/bellezhang119/cloud-storage/internal/dedupe"
+	"github.com/bellezhang119/cloud-storage/internal/email"
+	"github.com/bellezhang119/cloud-storage/internal/events"
+	"github.com/bellezhang119/cloud-storage/internal/extract"
+	"github.com/bellezhang119/cloud-storage/internal/file"
+	"github.com/bellezhang119/cloud-storage/internal/folder"
+	"github.com/bellezhang119/cloud-storage/internal/jobs"
+	"github.com/bellezhang119/cloud-storage/internal/paths"
+	"github.com/bellezhang119/cloud-storage/internal/ratelimit"
+	"github.com/bellezhang119/cloud-storage/internal/s3"
+	"github.com/bellezhang119/cloud-storage/internal/search"
 	"github.com/bellezhang119/cloud-storage/internal/server"
+	"github.com/bellezhang119/cloud-storage/internal/sftp"
+	"github.com/bellezhang119/cloud-storage/internal/stats"
+	"github.com/bellezhang119/cloud-storage/internal/storage"
+	"github.com/bellezhang119/cloud-storage/internal/tag"
+	"github.com/bellezhang119/cloud-storage/internal/thumbnail"
+	"github.com/bellezhang119/cloud-storage/internal/trash"
 	"github.com/bellezhang119/cloud-storage/internal/user"
 	"github.com/joho/godotenv"
 )
@@ -34,7 +58,129 @@ func main() {
 
 	fmt.Println("Port:", portString)
 
-	router := server.NewRouter(authService)
+	var limiter ratelimit.Limiter
+	if os.Getenv("RATE_LIMIT_BACKEND") == "postgres" {
+		pgLimiter := ratelimit.NewPostgresLimiter(queries)
+		go func() {
+			for range time.Tick(time.Hour) {
+				if _, err := pgLimiter.PruneStale(context.Background(), 24*time.Hour); err != nil {
+					log.Printf("pruning rate limit buckets: %v", err)
+				}
+			}
+		}()
+		limiter = pgLimiter
+	} else {
+		limiter = ratelimit.NewMemoryLimiter()
+	}
+
+	var sender email.Sender
+	if os.Getenv("EMAIL_SENDER") == "file" {
+		dumpDir := os.Getenv("EMAIL_DUMP_DIR")
+		if dumpDir == "" {
+			dumpDir = "tmp/emails"
+		}
+		sender = email.NewFileSender(dumpDir, os.Getenv("SMTP_FROM"))
+	} else {
+		smtpSender, err := email.NewSMTPSenderFromEnv()
+		if err != nil {
+			log.Printf("%v; emails will be logged instead of sent", err)
+			sender = email.LogSender{}
+		} else {
+			sender = smtpSender
+		}
+	}
+
+	mailer, err := email.NewMailer(email.NewOutbox(queries), email.BaseURLFromEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+	go email.NewWorker(queries, sender).Run(context.Background())
+
+	storagePath := os.Getenv("STORAGE_PATH")
+	if storagePath == "" {
+		storagePath = "data"
+	}
+	localStorage := storage.NewLocalStorage(storagePath)
+
+	accountService := account.NewService(queries, userService, localStorage, account.GracePeriodFromEnv())
+	go account.NewPurger(queries, localStorage).Run(context.Background())
+
+	fileService := file.NewService(queries, nil, localStorage)
+	folderService := folder.NewService(queries, fileService, localStorage)
+	fileService.SetFolderService(folderService)
+
+	jobQueue := jobs.NewQueue(queries)
+	jobWorker := jobs.NewWorker(queries)
+
+	extractor := extract.NewPipeline(queries, localStorage, extract.DefaultRegistry(), jobQueue)
+	jobWorker.Handle(extract.JobKind, extractor.Handle)
+	fileService.OnSave(func(ctx context.Context, f database.File) {
+		if err := extractor.Schedule(ctx, f); err != nil {
+			log.Printf("scheduling text extraction: %v", err)
+		}
+	})
+
+	thumbnails := thumbnail.NewPipeline(queries, localStorage, localStorage, jobQueue)
+	jobWorker.Handle(thumbnail.JobKind, thumbnails.Handle)
+	fileService.OnSave(func(ctx context.Context, f database.File) {
+		if err := thumbnails.Schedule(ctx, f); err != nil {
+			log.Printf("scheduling thumbnails: %v", err)
+		}
+	})
+	fileService.OnDelete(func(ctx context.Context, f database.File) {
+		thumbnails.Forget(ctx, f.UserID.Int32, f.ID)
+	})
+	folderService.OnDeleteFile(thumbnails.Forget)
+
+	tagService := tag.NewService(queries)
+	fileService.SetMetadataCopier(tagService)
+	folderService.SetMetadataCopier(tagService)
+	folderService.SetJobQueue(jobQueue)
+	jobWorker.Handle(folder.CopyJobKind, folderService.HandleCopyJob)
+	jobWorker.Handle(dedupe.BackfillJobKind, dedupe.NewBackfiller(queries, localStorage, jobQueue).Handle)
+	jobWorker.Handle(folder.RelocateJobKind, folder.NewRelocator(queries, localStorage, jobQueue).Handle)
+
+	archiveService := archive.NewService(queries, folderService, fileService, localStorage, jobQueue)
+	jobWorker.Handle(archive.ExtractJobKind, archiveService.HandleExtractJob)
+
+	go jobWorker.Run(context.Background())
+
+	searchService := search.NewService(queries)
+	trashService := trash.NewService(queries)
+	batchService := batch.NewService(fileService, folderService, trashService, tagService, localStorage)
+	pathService := paths.NewService(queries, folderService, fileService)
+	statsService := stats.NewService(queries)
+	dedupeService := dedupe.NewService(queries, fileService)
+	davService := dav.NewService(queries, pathService, fileService, folderService)
+	s3Service := s3.NewService(queries, pathService, fileService, folderService, localStorage)
+	sftpService := sftp.NewService(queries, authService, pathService, fileService, folderService)
+	changesService := changes.NewService(queries)
+	go stats.NewSnapshotter(queries).Run(context.Background())
+	go changes.NewPruner(queries, changes.RetentionFromEnv()).Run(context.Background())
+
+	eventHub := events.NewHub()
+	eventsService := events.NewService(changesService, eventHub)
+	eventTickets := events.NewTickets(queries)
+	go events.NewListener(os.Getenv("DB_URL"), eventHub).Run(context.Background())
+
+	if sftpAddr := os.Getenv("SFTP_ADDR"); sftpAddr != "" {
+		hostKeyPath := os.Getenv("SFTP_HOST_KEY")
+		if hostKeyPath == "" {
+			hostKeyPath = "ssh_host_ed25519_key"
+		}
+		hostKey, err := sftp.LoadHostKey(hostKeyPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sftpServer := sftp.NewServer(sftpService, hostKey)
+		sftpServer.LimitPasswords(limiter, ratelimit.PolicyFromEnv("RATE_LIMIT_SFTP_PASSWORD_IP", ratelimit.Policy{Name: "sftp_password_ip", Limit: 20, Period: time.Minute}))
+		go func() {
+			log.Fatalf("SFTP server failed: %v", sftpServer.ListenAndServe(sftpAddr))
+		}()
+		fmt.Println("SFTP:", sftpAddr)
+	}
+
+	router := server.NewRouter(authService, userService, accountService, searchService, fileService, folderService, jobQueue, tagService, trashService, batchService, pathService, statsService, dedupeService, thumbnails, archiveService, davService, s3Service, sftpService, changesService, eventsService, eventTickets, limiter, mailer)
 
 	err = http.ListenAndServe(portString, router)
 
@@ -0,0 +1,28 @@
+-- name: ListChangesSince :many
+SELECT *
+FROM change_journal
+WHERE user_id = $1 AND seq > $2
+ORDER BY seq
+LIMIT $3;
+
+-- name: GetChangeJournalHead :one
+SELECT *
+FROM change_journal_heads
+WHERE user_id = $1;
+
+-- name: PruneChangeJournal :execrows
+-- Drops entries older than the cutoff, remembering for each user how far
+-- the journal now reaches back.
+WITH pruned AS (
+    DELETE FROM change_journal
+    WHERE created_at < $1
+    RETURNING user_id, seq
+)
+UPDATE change_journal_heads h
+SET pruned_through = GREATEST(h.pruned_through, p.last_seq)
+FROM (
+    SELECT user_id, MAX(seq)::BIGINT AS last_seq
+    FROM pruned
+    GROUP BY user_id
+) p
+WHERE h.user_id = p.user_id;
@@ -0,0 +1,38 @@
+-- name: SetFileContentHash :execrows
+-- size_bytes is what was actually written, which a client's declared size
+-- need not match. updated_at is left alone: the content hasn't changed.
+UPDATE files
+SET sha256 = $2,
+    size_bytes = $3
+WHERE id = $1;
+
+-- name: ListFilesMissingHash :many
+SELECT id, user_id, file_path
+FROM files
+WHERE sha256 IS NULL AND id > sqlc.arg(after)
+ORDER BY id
+LIMIT sqlc.arg(batch_size);
+
+-- name: ListDuplicateGroups :many
+-- Empty files are left out: there is nothing to reclaim.
+SELECT
+    sha256::text AS sha256,
+    size_bytes,
+    COUNT(*) AS copies,
+    ((COUNT(*) - 1) * size_bytes)::bigint AS reclaimable_bytes,
+    COUNT(*) OVER () AS total_groups,
+    (SUM((COUNT(*) - 1) * size_bytes) OVER ())::bigint AS total_reclaimable_bytes
+FROM files
+WHERE user_id = $1 AND sha256 IS NOT NULL AND size_bytes > 0 AND trashed_at IS NULL
+GROUP BY sha256, size_bytes
+HAVING COUNT(*) > 1
+ORDER BY reclaimable_bytes DESC, sha256
+LIMIT $2 OFFSET $3;
+
+-- name: ListFilesByHashes :many
+SELECT id, folder_id, name, file_path, size_bytes, mime_type, sha256::text AS sha256, created_at, updated_at
+FROM files
+WHERE user_id = sqlc.arg(user_id)
+  AND sha256 = ANY(sqlc.arg(hashes)::text[])
+  AND trashed_at IS NULL
+ORDER BY sha256, created_at, id;
@@ -0,0 +1,38 @@
+-- name: EnqueueEmail :one
+INSERT INTO email_outbox (template, to_address, subject, text_body, html_body)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: ClaimDueEmails :many
+-- Leases due messages by pushing next_attempt_at forward, so a crashed
+-- worker's batch is picked up again once the lease runs out.
+UPDATE email_outbox
+SET attempts = attempts + 1,
+    next_attempt_at = now() + make_interval(secs => sqlc.arg(lease_seconds)::float8)
+WHERE id IN (
+    SELECT id FROM email_outbox
+    WHERE status = 'pending' AND next_attempt_at <= now()
+    ORDER BY next_attempt_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkEmailSent :execrows
+UPDATE email_outbox
+SET status = 'sent',
+    sent_at = now(),
+    last_error = NULL
+WHERE id = $1;
+
+-- name: RescheduleEmail :execrows
+UPDATE email_outbox
+SET next_attempt_at = now() + make_interval(secs => sqlc.arg(delay_seconds)::float8),
+    last_error = sqlc.arg(last_error)
+WHERE id = sqlc.arg(id);
+
+-- name: MarkEmailFailed :execrows
+UPDATE email_outbox
+SET status = 'failed',
+    last_error = $2
+WHERE id = $1;
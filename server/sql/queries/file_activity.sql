@@ -12,3 +12,9 @@ ORDER BY created_at DESC;
 SELECT * FROM file_activity
 WHERE user_id = $1
 ORDER BY created_at DESC;
+
+-- name: DeleteUserActivity :execrows
+-- Activity by the user anywhere, plus activity on the user's own files.
+DELETE FROM file_activity
+WHERE file_activity.user_id = $1
+   OR file_id IN (SELECT f.id FROM files f WHERE f.user_id = $1);
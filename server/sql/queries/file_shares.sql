@@ -11,3 +11,15 @@ SELECT * FROM file_shares WHERE file_id = $1;
 -- name: RemoveFileShare :execrows
 DELETE FROM file_shares
 WHERE file_id = $1 AND shared_with = $2;
+
+-- name: ListSharesByOwner :many
+SELECT fs.* FROM file_shares fs
+INNER JOIN files f ON f.id = fs.file_id
+WHERE f.user_id = $1
+ORDER BY fs.created_at;
+
+-- name: DeleteUserShares :execrows
+-- Shares granted to the user and shares on the user's own files.
+DELETE FROM file_shares
+WHERE shared_with = $1
+   OR file_id IN (SELECT f.id FROM files f WHERE f.user_id = $1);
@@ -1,34 +1,25 @@
 -- name: CreateFile :one
-INSERT INTO files (folder_id, user_id, name, file_path, size_bytes, mime_type)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO files (folder_id, user_id, name, file_path, size_bytes, mime_type, sha256)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
 RETURNING *;
 
 -- name: GetFileByID :one
 SELECT * FROM files WHERE id = $1;
 
 -- name: GetFileByNameInFolder :one
+-- folder_id is NULL for files at the user's root, hence IS NOT DISTINCT FROM;
+-- user_id keeps one user's root apart from another's.
 SELECT * FROM files
-WHERE folder_id = $1 AND name = $2;
+WHERE user_id = $1 AND folder_id IS NOT DISTINCT FROM $2 AND name = $3;
 
 -- name: ListFilesInFolder :many
 SELECT *
 FROM files
-WHERE (folder_id = $1 OR ($1 IS NULL AND folder_id IS NULL)) AND user_id = $2
+WHERE folder_id IS NOT DISTINCT FROM $1 AND user_id = $2
+  AND trashed_at IS NULL
 ORDER BY name;
 
 -- name: ListFilesRecursive :many
-WITH RECURSIVE subfolders AS (
-    SELECT folders.id AS sf_folder_id
-    FROM folders
-    WHERE folders.id = $1 AND folders.user_id = $2
-
-    UNION ALL
-
-    SELECT f.id AS sf_folder_id
-    FROM folders f
-    INNER JOIN subfolders s ON f.parent_id = s.sf_folder_id
-    WHERE f.user_id = $2
-)
 SELECT 
     f.id AS file_id,
     f.folder_id AS folder_id,
@@ -38,10 +29,12 @@ SELECT
     f.size_bytes AS size_bytes,
     f.mime_type AS mime_type,
     f.created_at AS created_at,
-    f.updated_at AS updated_at
-FROM files f
-INNER JOIN subfolders sf ON f.folder_id = sf.sf_folder_id
-WHERE f.user_id = $2
+    f.updated_at AS updated_at,
+    f.trashed_at AS trashed_at,
+    f.sha256 AS sha256
+FROM folder_closure c
+INNER JOIN files f ON f.folder_id = c.descendant_id
+WHERE c.ancestor_id = sqlc.arg(id) AND f.user_id = sqlc.arg(user_id)
 ORDER BY f.name;
 
 -- name: DeleteFile :execrows
@@ -57,3 +50,38 @@ WHERE id = $1 AND user_id = $3;
 UPDATE files
 SET file_path = $2, updated_at = now()
 WHERE id = $1 AND user_id = $3;
+
+-- name: ListUserFiles :many
+SELECT * FROM files
+WHERE user_id = $1
+ORDER BY file_path;
+
+-- name: UpdateFileLocation :execrows
+UPDATE files
+SET folder_id = $2,
+    name = $3,
+    file_path = $4,
+    updated_at = now()
+WHERE id = $1 AND user_id = $5;
+
+-- name: ReplaceFileContent :one
+-- The file keeps its ID, and with it tags, properties and shares.
+-- Everything derived from the old content is reset for the hooks to redo,
+-- and an upload over a trashed file brings it back.
+UPDATE files
+SET size_bytes = $3,
+    mime_type = $4,
+    sha256 = $5,
+    content_text = NULL,
+    text_extracted_at = NULL,
+    thumbnail_state = NULL,
+    trashed_at = NULL,
+    updated_at = now()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: SetFileContentText :execrows
+UPDATE files
+SET content_text = $2,
+    text_extracted_at = now()
+WHERE id = $1;
@@ -7,10 +7,12 @@ RETURNING *;
 SELECT * FROM folders WHERE id = $1;
 
 -- name: ListFoldersByParent :many
+-- parent_id is NULL for folders at the user's root, hence IS NOT DISTINCT FROM.
 SELECT *
 FROM folders
-WHERE parent_id = $1
+WHERE parent_id IS NOT DISTINCT FROM $1
   AND user_id = $2
+  AND trashed_at IS NULL
 ORDER BY name;
 
 -- name: DeleteFolder :execrows
@@ -25,20 +27,12 @@ WHERE id = $1
   AND user_id = $3;
 
 -- name: ListFoldersRecursive :many
-WITH RECURSIVE subfolders AS (
-    SELECT f0.id, f0.user_id, f0.name, f0.parent_id, f0.created_at, f0.updated_at
-    FROM folders f0
-    WHERE f0.id = $1 AND f0.user_id = $2
-
-    UNION ALL
-
-    SELECT f.id, f.user_id, f.name, f.parent_id, f.created_at, f.updated_at
-    FROM folders f
-    INNER JOIN subfolders s ON f.parent_id = s.id
-    WHERE f.user_id = $2
-)
-SELECT *
-FROM subfolders;
+-- The folder itself and everything below it, shallowest first.
+SELECT f.id, f.user_id, f.name, f.parent_id, f.created_at, f.updated_at, f.trashed_at
+FROM folder_closure c
+INNER JOIN folders f ON f.id = c.descendant_id
+WHERE c.ancestor_id = sqlc.arg(id) AND f.user_id = sqlc.arg(user_id)
+ORDER BY c.depth, f.name;
 
 -- name: UpdateFolderMetadata :execrows
 UPDATE folders
@@ -50,4 +44,32 @@ WHERE id = $1 AND user_id = $3;
 UPDATE folders
 SET parent_id = $2,
     updated_at = now()
-WHERE id = $1 AND user_id = $3;
\ No newline at end of file
+WHERE id = $1 AND user_id = $3;
+
+-- name: ListUserFolders :many
+SELECT * FROM folders
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetFolderByNameInParent :one
+-- parent_id is NULL for folders at the user's root, hence IS NOT DISTINCT FROM.
+SELECT * FROM folders
+WHERE user_id = $1
+  AND parent_id IS NOT DISTINCT FROM $2
+  AND name = $3;
+
+-- name: GetFolderPath :one
+-- The folder's path from the user's root, e.g. "projects/2024". No row when
+-- the folder doesn't exist.
+SELECT string_agg(f.name, '/' ORDER BY c.depth DESC)::text AS path
+FROM folder_closure c
+INNER JOIN folders f ON f.id = c.ancestor_id
+WHERE c.descendant_id = sqlc.arg(id)
+HAVING count(*) > 0;
+
+-- name: IsFolderInSubtree :one
+-- Whether candidate is root itself or anywhere below it.
+SELECT EXISTS (
+    SELECT 1 FROM folder_closure
+    WHERE ancestor_id = sqlc.arg(root_id) AND descendant_id = sqlc.arg(candidate_id)
+) AS in_subtree;
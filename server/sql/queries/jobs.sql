@@ -0,0 +1,69 @@
+-- name: EnqueueJob :one
+INSERT INTO jobs (kind, user_id, payload, max_attempts)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetJob :one
+SELECT * FROM jobs WHERE id = $1;
+
+-- name: ClaimDueJobs :many
+-- Leases due jobs of the given kinds. Running jobs whose lease has expired
+-- belong to a crashed worker and are claimed again.
+UPDATE jobs
+SET status = 'running',
+    attempts = attempts + 1,
+    locked_until = now() + make_interval(secs => sqlc.arg(lease_seconds)::float8),
+    updated_at = now()
+WHERE id IN (
+    SELECT j.id FROM jobs j
+    WHERE j.kind = ANY(sqlc.arg(kinds)::text[])
+      AND ((j.status = 'pending' AND j.run_at <= now())
+           OR (j.status = 'running' AND j.locked_until <= now()))
+    ORDER BY j.run_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CompleteJob :execrows
+UPDATE jobs
+SET status = 'done',
+    locked_until = NULL,
+    last_error = NULL,
+    updated_at = now(),
+    finished_at = now()
+WHERE id = $1;
+
+-- name: RetryJob :execrows
+UPDATE jobs
+SET status = 'pending',
+    run_at = now() + make_interval(secs => sqlc.arg(delay_seconds)::float8),
+    locked_until = NULL,
+    last_error = sqlc.arg(last_error),
+    updated_at = now()
+WHERE id = sqlc.arg(id);
+
+-- name: FailJob :execrows
+UPDATE jobs
+SET status = 'failed',
+    locked_until = NULL,
+    last_error = $2,
+    updated_at = now(),
+    finished_at = now()
+WHERE id = $1;
+
+-- name: GetUserJob :one
+SELECT * FROM jobs WHERE id = $1 AND user_id = $2;
+
+-- name: UpdateJobProgress :exec
+UPDATE jobs
+SET progress_done = $2,
+    progress_total = $3,
+    updated_at = now()
+WHERE id = $1;
+
+-- name: SetJobResult :exec
+UPDATE jobs
+SET result = $2,
+    updated_at = now()
+WHERE id = $1;
@@ -0,0 +1,12 @@
+-- name: CreatePasswordReset :exec
+INSERT INTO password_resets (token_hash, user_id, expires_at)
+VALUES ($1, $2, $3);
+
+-- name: RedeemPasswordReset :one
+DELETE FROM password_resets
+WHERE token_hash = $1
+RETURNING user_id, expires_at;
+
+-- name: DeleteUserPasswordResets :execrows
+DELETE FROM password_resets
+WHERE user_id = $1;
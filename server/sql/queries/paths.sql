@@ -0,0 +1,56 @@
+-- name: ResolvePath :many
+-- Walks the user's tree one path segment per level in a single query. Returns
+-- every folder matched along the way (depth 1 is the top level) plus the file
+-- named by the last segment, if there is one. A path resolves fully when a
+-- row's depth equals the number of segments. Trashed items don't resolve.
+-- The folder branch comes first so the nullable columns are typed as such.
+WITH RECURSIVE walk AS (
+    SELECT f0.id, f0.parent_id, f0.name, f0.created_at, f0.updated_at, 1 AS depth
+    FROM folders f0
+    WHERE f0.user_id = sqlc.arg(user_id)
+      AND f0.parent_id IS NULL
+      AND f0.trashed_at IS NULL
+      AND f0.name = (sqlc.arg(segments)::text[])[1]
+
+    UNION ALL
+
+    SELECT f.id, f.parent_id, f.name, f.created_at, f.updated_at, w.depth + 1
+    FROM folders f
+    INNER JOIN walk w ON f.parent_id = w.id
+    WHERE f.trashed_at IS NULL
+      AND w.depth < cardinality(sqlc.arg(segments)::text[])
+      AND f.name = (sqlc.arg(segments)::text[])[w.depth + 1]
+)
+SELECT
+    'folder'::text AS kind,
+    walk.id,
+    walk.parent_id,
+    walk.name,
+    NULL::bigint AS size_bytes,
+    NULL::text AS mime_type,
+    walk.created_at,
+    walk.updated_at,
+    walk.depth::int AS depth
+FROM walk
+
+UNION ALL
+
+SELECT
+    'file'::text AS kind,
+    fl.id,
+    fl.folder_id AS parent_id,
+    fl.name,
+    fl.size_bytes,
+    fl.mime_type,
+    fl.created_at,
+    fl.updated_at,
+    cardinality(sqlc.arg(segments)::text[])::int AS depth
+FROM files fl
+WHERE fl.user_id = sqlc.arg(user_id)
+  AND fl.trashed_at IS NULL
+  AND fl.name = (sqlc.arg(segments)::text[])[cardinality(sqlc.arg(segments)::text[])]
+  AND (
+      (cardinality(sqlc.arg(segments)::text[]) = 1 AND fl.folder_id IS NULL)
+      OR fl.folder_id = (SELECT w.id FROM walk w WHERE w.depth = cardinality(sqlc.arg(segments)::text[]) - 1)
+  )
+ORDER BY depth, kind DESC;
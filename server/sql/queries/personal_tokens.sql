@@ -0,0 +1,24 @@
+-- name: CreatePersonalToken :one
+INSERT INTO personal_tokens (user_id, name, token_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: ListPersonalTokens :many
+SELECT *
+FROM personal_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetPersonalTokenByHash :one
+SELECT *
+FROM personal_tokens
+WHERE token_hash = $1;
+
+-- name: TouchPersonalToken :execrows
+UPDATE personal_tokens
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: DeletePersonalToken :execrows
+DELETE FROM personal_tokens
+WHERE id = $1 AND user_id = $2;
@@ -0,0 +1,16 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets (bucket_key, tokens, allowed, updated_at)
+VALUES (sqlc.arg(bucket_key), sqlc.arg(capacity)::float8 - 1, TRUE, now())
+ON CONFLICT (bucket_key) DO UPDATE
+SET tokens = CASE
+        WHEN LEAST(sqlc.arg(capacity)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * sqlc.arg(refill_rate)::float8) >= 1
+        THEN LEAST(sqlc.arg(capacity)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * sqlc.arg(refill_rate)::float8) - 1
+        ELSE LEAST(sqlc.arg(capacity)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * sqlc.arg(refill_rate)::float8)
+    END,
+    allowed = LEAST(sqlc.arg(capacity)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * sqlc.arg(refill_rate)::float8) >= 1,
+    updated_at = now()
+RETURNING tokens, allowed;
+
+-- name: DeleteStaleRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < now() - make_interval(secs => sqlc.arg(max_idle_seconds)::float8);
@@ -13,4 +13,19 @@ WHERE token_hash = $1;
 
 -- name: DeleteExpiredRefreshTokens :execrows
 DELETE FROM refresh_tokens
-WHERE expires_at < NOW();
\ No newline at end of file
+WHERE expires_at < NOW();
+
+-- name: RevokeUserRefreshTokens :execrows
+-- Bumping the token version retires the user's access tokens as well.
+WITH bumped AS (
+    UPDATE users
+    SET token_version = token_version + 1
+    WHERE id = $1
+)
+UPDATE refresh_tokens
+SET revoked = TRUE
+WHERE user_id = $1 AND revoked = FALSE;
+
+-- name: DeleteUserRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE user_id = $1;
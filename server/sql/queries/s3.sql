@@ -0,0 +1,62 @@
+-- name: CreateS3AccessKey :one
+INSERT INTO s3_access_keys (user_id, access_key_id, secret_key)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: ListS3AccessKeys :many
+SELECT *
+FROM s3_access_keys
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetS3AccessKey :one
+SELECT *
+FROM s3_access_keys
+WHERE access_key_id = $1;
+
+-- name: TouchS3AccessKey :execrows
+UPDATE s3_access_keys
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteS3AccessKey :execrows
+DELETE FROM s3_access_keys
+WHERE id = $1 AND user_id = $2;
+
+-- name: CreateMultipartUpload :one
+INSERT INTO s3_multipart_uploads (user_id, object_key)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: GetMultipartUpload :one
+SELECT *
+FROM s3_multipart_uploads
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListMultipartUploads :many
+SELECT *
+FROM s3_multipart_uploads
+WHERE user_id = $1
+ORDER BY object_key, created_at;
+
+-- name: ListStaleMultipartUploads :many
+SELECT *
+FROM s3_multipart_uploads
+WHERE user_id = $1 AND created_at < $2;
+
+-- name: DeleteMultipartUpload :execrows
+DELETE FROM s3_multipart_uploads
+WHERE id = $1 AND user_id = $2;
+
+-- name: PutMultipartPart :one
+INSERT INTO s3_multipart_parts (upload_id, part_number, etag, size_bytes)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (upload_id, part_number)
+DO UPDATE SET etag = EXCLUDED.etag, size_bytes = EXCLUDED.size_bytes, created_at = NOW()
+RETURNING *;
+
+-- name: ListMultipartParts :many
+SELECT *
+FROM s3_multipart_parts
+WHERE upload_id = $1
+ORDER BY part_number;
@@ -0,0 +1,93 @@
+-- name: SearchItems :many
+-- Searches the user's own folders and files plus files shared with them.
+-- The folder branch comes first so the nullable columns are typed as such.
+-- Results are ordered by (rank, id) descending; the cursor is the last row's
+-- rank and id.
+WITH params AS (
+    SELECT
+        sqlc.arg(query)::text AS query,
+        CASE WHEN sqlc.arg(query)::text = '' THEN NULL
+             ELSE websearch_to_tsquery('english', sqlc.arg(query)::text)
+        END AS tsq,
+        -- LIKE patterns in which the user's own % and _ match literally
+        '%' || replace(replace(replace(sqlc.arg(query)::text, '\', '\\'), '%', '\%'), '_', '\_') || '%' AS name_pattern,
+        replace(replace(replace(sqlc.narg(mime_prefix)::text, '\', '\\'), '%', '\%'), '_', '\_') || '%' AS mime_pattern
+),
+items AS (
+    SELECT
+        'folder'::text AS kind,
+        d.id,
+        d.user_id AS owner_id,
+        d.parent_id,
+        d.name,
+        NULL::text AS mime_type,
+        NULL::bigint AS size_bytes,
+        d.created_at,
+        d.updated_at,
+        'owner'::text AS permission,
+        (CASE WHEN p.query = '' THEN 0
+              ELSE ts_rank(d.search_vector, p.tsq) + similarity(d.name, p.query)
+         END)::float8 AS rank
+    FROM folders d
+    CROSS JOIN params p
+    WHERE d.user_id = sqlc.arg(user_id)::int
+      AND d.trashed_at IS NULL
+      AND (p.query = '' OR d.search_vector @@ p.tsq OR d.name ILIKE p.name_pattern ESCAPE '\')
+      -- folders have no MIME type or size, so those filters rule them out
+      AND sqlc.narg(mime_prefix)::text IS NULL
+      AND sqlc.narg(min_size)::bigint IS NULL
+      AND sqlc.narg(max_size)::bigint IS NULL
+      AND (sqlc.narg(tag)::text IS NULL OR EXISTS (
+          SELECT 1 FROM folder_tags dt
+          INNER JOIN tags t ON t.id = dt.tag_id
+          WHERE dt.folder_id = d.id AND t.user_id = sqlc.arg(user_id)::int AND t.name = sqlc.narg(tag)::text))
+
+    UNION ALL
+
+    SELECT
+        'file'::text AS kind,
+        f.id,
+        f.user_id AS owner_id,
+        f.folder_id AS parent_id,
+        f.name,
+        f.mime_type,
+        f.size_bytes,
+        f.created_at,
+        f.updated_at,
+        COALESCE(fs.permission, 'owner')::text AS permission,
+        (CASE WHEN p.query = '' THEN 0
+              ELSE ts_rank(f.search_vector, p.tsq) + similarity(f.name, p.query)
+         END)::float8 AS rank
+    FROM files f
+    CROSS JOIN params p
+    LEFT JOIN file_shares fs
+        ON fs.file_id = f.id AND fs.shared_with = sqlc.arg(user_id)::int
+    WHERE (f.user_id = sqlc.arg(user_id)::int OR fs.id IS NOT NULL)
+      AND f.trashed_at IS NULL
+      AND (p.query = '' OR f.search_vector @@ p.tsq OR f.name ILIKE p.name_pattern ESCAPE '\')
+      AND (sqlc.narg(mime_prefix)::text IS NULL OR f.mime_type LIKE p.mime_pattern ESCAPE '\')
+      AND (sqlc.narg(min_size)::bigint IS NULL OR f.size_bytes >= sqlc.narg(min_size)::bigint)
+      AND (sqlc.narg(max_size)::bigint IS NULL OR f.size_bytes <= sqlc.narg(max_size)::bigint)
+      -- tags are the searcher's own, so shared files never match a tag
+      AND (sqlc.narg(tag)::text IS NULL OR EXISTS (
+          SELECT 1 FROM file_tags ft
+          INNER JOIN tags t ON t.id = ft.tag_id
+          WHERE ft.file_id = f.id AND t.user_id = sqlc.arg(user_id)::int AND t.name = sqlc.narg(tag)::text))
+)
+SELECT kind, id, owner_id, parent_id, name, mime_type, size_bytes, created_at, updated_at, permission, rank
+FROM items
+WHERE (sqlc.arg(kind)::text = '' OR items.kind = sqlc.arg(kind)::text)
+  AND (sqlc.narg(modified_after)::timestamp IS NULL OR items.updated_at >= sqlc.narg(modified_after)::timestamp)
+  AND (sqlc.narg(modified_before)::timestamp IS NULL OR items.updated_at < sqlc.narg(modified_before)::timestamp)
+  AND (sqlc.narg(cursor_id)::uuid IS NULL
+       OR (items.rank, items.id) < (sqlc.narg(cursor_rank)::float8, sqlc.narg(cursor_id)::uuid))
+ORDER BY items.rank DESC, items.id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListFolderAncestors :many
+-- Returns the given folders and all of their ancestors, for building
+-- breadcrumbs.
+SELECT DISTINCT f.id, f.name, f.parent_id
+FROM folder_closure c
+INNER JOIN folders f ON f.id = c.ancestor_id
+WHERE c.descendant_id = ANY(sqlc.arg(folder_ids)::uuid[]);
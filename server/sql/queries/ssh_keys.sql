@@ -0,0 +1,24 @@
+-- name: CreateSSHKey :one
+INSERT INTO ssh_keys (user_id, name, public_key, fingerprint)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: ListSSHKeys :many
+SELECT *
+FROM ssh_keys
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetSSHKeyByFingerprint :one
+SELECT *
+FROM ssh_keys
+WHERE user_id = $1 AND fingerprint = $2;
+
+-- name: TouchSSHKey :execrows
+UPDATE ssh_keys
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteSSHKey :execrows
+DELETE FROM ssh_keys
+WHERE id = $1 AND user_id = $2;
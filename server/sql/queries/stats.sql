@@ -0,0 +1,95 @@
+-- name: GetCachedFolderStats :one
+-- Triggers drop stale rows; the age limit only bounds the damage of a write
+-- that lands while a recompute is in flight.
+SELECT * FROM folder_stats
+WHERE folder_id = sqlc.arg(folder_id)
+  AND computed_at > now() - make_interval(secs => sqlc.arg(max_age_seconds)::float8);
+
+-- name: ComputeFolderStats :one
+-- Totals over the folder's live subtree, folder itself excluded from
+-- folder_count, written back to the cache in the same statement.
+WITH subtree AS (
+    SELECT d.id, d.updated_at
+    FROM folder_closure c
+    INNER JOIN folders d ON d.id = c.descendant_id
+    WHERE c.ancestor_id = sqlc.arg(id)::uuid
+      AND d.trashed_at IS NULL
+), subtree_files AS (
+    SELECT f.size_bytes, f.updated_at
+    FROM files f
+    INNER JOIN subtree s ON s.id = f.folder_id
+    WHERE f.trashed_at IS NULL
+)
+INSERT INTO folder_stats (folder_id, size_bytes, file_count, folder_count, last_modified, computed_at)
+SELECT
+    sqlc.arg(id)::uuid,
+    (SELECT COALESCE(SUM(size_bytes), 0) FROM subtree_files)::bigint,
+    (SELECT COUNT(*) FROM subtree_files),
+    (SELECT GREATEST(COUNT(*) - 1, 0) FROM subtree)::bigint,
+    GREATEST(
+        (SELECT MAX(updated_at) FROM subtree_files),
+        (SELECT MAX(updated_at) FROM subtree)
+    )::timestamp,
+    now()
+ON CONFLICT (folder_id) DO UPDATE SET
+    size_bytes = EXCLUDED.size_bytes,
+    file_count = EXCLUDED.file_count,
+    folder_count = EXCLUDED.folder_count,
+    last_modified = EXCLUDED.last_modified,
+    computed_at = EXCLUDED.computed_at
+RETURNING *;
+
+-- name: GetUsageTotals :one
+-- Trashed files still take up space, so they count towards used_bytes and
+-- are also reported on their own.
+SELECT
+    u.storage_quota,
+    COALESCE(SUM(f.size_bytes), 0)::bigint AS used_bytes,
+    COUNT(f.id) AS file_count,
+    COALESCE(SUM(f.size_bytes) FILTER (WHERE f.trashed_at IS NOT NULL), 0)::bigint AS trashed_bytes,
+    (SELECT COUNT(*) FROM folders d WHERE d.user_id = u.id AND d.trashed_at IS NULL) AS folder_count
+FROM users u
+LEFT JOIN files f ON f.user_id = u.id
+WHERE u.id = $1
+GROUP BY u.id;
+
+-- name: GetMimeBreakdown :many
+SELECT
+    COALESCE(NULLIF(mime_type, ''), 'application/octet-stream')::text AS mime_type,
+    COUNT(*) AS file_count,
+    COALESCE(SUM(size_bytes), 0)::bigint AS size_bytes
+FROM files
+WHERE user_id = $1 AND trashed_at IS NULL
+GROUP BY 1
+ORDER BY size_bytes DESC, mime_type;
+
+-- name: ListLargestFiles :many
+SELECT id, folder_id, name, size_bytes, mime_type, updated_at
+FROM files
+WHERE user_id = $1 AND trashed_at IS NULL
+ORDER BY size_bytes DESC, id
+LIMIT $2;
+
+-- name: ListOldestUntouchedFiles :many
+-- Nothing records reads, so "untouched" means not written since.
+SELECT id, folder_id, name, size_bytes, mime_type, updated_at
+FROM files
+WHERE user_id = $1 AND trashed_at IS NULL
+ORDER BY updated_at ASC NULLS FIRST, id
+LIMIT $2;
+
+-- name: TakeUsageSnapshots :execrows
+INSERT INTO usage_snapshots (user_id, day, used_bytes, file_count)
+SELECT u.id, CURRENT_DATE, COALESCE(SUM(f.size_bytes), 0), COUNT(f.id)
+FROM users u
+LEFT JOIN files f ON f.user_id = u.id
+GROUP BY u.id
+ON CONFLICT (user_id, day) DO UPDATE SET
+    used_bytes = EXCLUDED.used_bytes,
+    file_count = EXCLUDED.file_count;
+
+-- name: ListUsageSnapshots :many
+SELECT day, used_bytes, file_count
+FROM usage_snapshots
+WHERE user_id = sqlc.arg(user_id) AND day >= sqlc.arg(since)
+ORDER BY day;
@@ -0,0 +1,15 @@
+-- name: ListStorageRelocations :many
+-- Directories come before the files that go in them.
+SELECT * FROM storage_relocations
+ORDER BY is_dir DESC, id
+LIMIT $1;
+
+-- name: DeleteStorageRelocation :exec
+DELETE FROM storage_relocations
+WHERE id = $1;
+
+-- name: IsFilePathInUse :one
+SELECT EXISTS (
+    SELECT 1 FROM files
+    WHERE user_id = $1 AND file_path = $2
+) AS in_use;
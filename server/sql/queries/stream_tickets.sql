@@ -0,0 +1,14 @@
+-- name: CreateStreamTicket :exec
+INSERT INTO stream_tickets (ticket_hash, user_id, expires_at)
+VALUES ($1, $2, $3);
+
+-- name: RedeemStreamTicket :one
+-- The ticket is deleted as it is used, so it works only once.
+DELETE FROM stream_tickets t
+USING users u
+WHERE t.ticket_hash = $1 AND u.id = t.user_id
+RETURNING t.user_id, t.expires_at, u.email;
+
+-- name: DeleteExpiredStreamTickets :execrows
+DELETE FROM stream_tickets
+WHERE expires_at < NOW();
@@ -0,0 +1,197 @@
+-- name: UpsertTags :many
+-- Creates any of the named tags that don't exist yet and returns all of them.
+INSERT INTO tags (user_id, name)
+SELECT sqlc.arg(user_id)::int, unnest(sqlc.arg(names)::text[])
+ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+RETURNING *;
+
+-- name: GetTag :one
+SELECT * FROM tags
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetTagsByNames :many
+SELECT * FROM tags
+WHERE user_id = sqlc.arg(user_id)::int
+  AND name = ANY(sqlc.arg(names)::text[]);
+
+-- name: ListTags :many
+SELECT
+    t.id,
+    t.user_id,
+    t.name,
+    t.created_at,
+    ((SELECT count(*) FROM file_tags ft WHERE ft.tag_id = t.id)
+     + (SELECT count(*) FROM folder_tags dt WHERE dt.tag_id = t.id))::bigint AS item_count
+FROM tags t
+WHERE t.user_id = $1
+ORDER BY t.name;
+
+-- name: RenameTag :execrows
+UPDATE tags
+SET name = $2
+WHERE id = $1 AND user_id = $3;
+
+-- name: DeleteTag :execrows
+DELETE FROM tags
+WHERE id = $1 AND user_id = $2;
+
+-- name: TagFiles :execrows
+-- Only the user's own files and tags are paired; anything else is ignored.
+INSERT INTO file_tags (file_id, tag_id)
+SELECT f.id, t.id
+FROM files f
+CROSS JOIN tags t
+WHERE f.id = ANY(sqlc.arg(file_ids)::uuid[])
+  AND f.user_id = sqlc.arg(user_id)::int
+  AND t.id = ANY(sqlc.arg(tag_ids)::uuid[])
+  AND t.user_id = sqlc.arg(user_id)::int
+ON CONFLICT DO NOTHING;
+
+-- name: TagFolders :execrows
+INSERT INTO folder_tags (folder_id, tag_id)
+SELECT d.id, t.id
+FROM folders d
+CROSS JOIN tags t
+WHERE d.id = ANY(sqlc.arg(folder_ids)::uuid[])
+  AND d.user_id = sqlc.arg(user_id)::int
+  AND t.id = ANY(sqlc.arg(tag_ids)::uuid[])
+  AND t.user_id = sqlc.arg(user_id)::int
+ON CONFLICT DO NOTHING;
+
+-- name: UntagFiles :execrows
+DELETE FROM file_tags ft
+USING tags t
+WHERE ft.tag_id = t.id
+  AND t.user_id = sqlc.arg(user_id)::int
+  AND ft.file_id = ANY(sqlc.arg(file_ids)::uuid[])
+  AND ft.tag_id = ANY(sqlc.arg(tag_ids)::uuid[]);
+
+-- name: UntagFolders :execrows
+DELETE FROM folder_tags dt
+USING tags t
+WHERE dt.tag_id = t.id
+  AND t.user_id = sqlc.arg(user_id)::int
+  AND dt.folder_id = ANY(sqlc.arg(folder_ids)::uuid[])
+  AND dt.tag_id = ANY(sqlc.arg(tag_ids)::uuid[]);
+
+-- name: PruneFileTags :execrows
+-- Removes every tag from the file except the ones listed.
+DELETE FROM file_tags ft
+USING tags t
+WHERE ft.tag_id = t.id
+  AND t.user_id = sqlc.arg(user_id)::int
+  AND ft.file_id = sqlc.arg(file_id)::uuid
+  AND NOT (ft.tag_id = ANY(sqlc.arg(keep_tag_ids)::uuid[]));
+
+-- name: PruneFolderTags :execrows
+DELETE FROM folder_tags dt
+USING tags t
+WHERE dt.tag_id = t.id
+  AND t.user_id = sqlc.arg(user_id)::int
+  AND dt.folder_id = sqlc.arg(folder_id)::uuid
+  AND NOT (dt.tag_id = ANY(sqlc.arg(keep_tag_ids)::uuid[]));
+
+-- name: ListTagsForItems :many
+-- Tag names for a set of files and folders, for decorating listings.
+SELECT 'file'::text AS kind, ft.file_id AS item_id, t.name
+FROM file_tags ft
+INNER JOIN tags t ON t.id = ft.tag_id
+WHERE ft.file_id = ANY(sqlc.arg(file_ids)::uuid[])
+
+UNION ALL
+
+SELECT 'folder'::text AS kind, dt.folder_id AS item_id, t.name
+FROM folder_tags dt
+INNER JOIN tags t ON t.id = dt.tag_id
+WHERE dt.folder_id = ANY(sqlc.arg(folder_ids)::uuid[])
+
+ORDER BY name;
+
+-- name: ListItemsByTag :many
+SELECT
+    'folder'::text AS kind,
+    d.id,
+    d.parent_id,
+    d.name,
+    NULL::text AS mime_type,
+    NULL::bigint AS size_bytes,
+    d.created_at,
+    d.updated_at
+FROM folder_tags dt
+INNER JOIN folders d ON d.id = dt.folder_id
+WHERE dt.tag_id = sqlc.arg(tag_id)::uuid AND d.user_id = sqlc.arg(user_id)::int
+
+UNION ALL
+
+SELECT
+    'file'::text AS kind,
+    f.id,
+    f.folder_id AS parent_id,
+    f.name,
+    f.mime_type,
+    f.size_bytes,
+    f.created_at,
+    f.updated_at
+FROM file_tags ft
+INNER JOIN files f ON f.id = ft.file_id
+WHERE ft.tag_id = sqlc.arg(tag_id)::uuid AND f.user_id = sqlc.arg(user_id)::int
+
+ORDER BY kind DESC, name;
+
+-- name: CopyFileTags :exec
+INSERT INTO file_tags (file_id, tag_id)
+SELECT sqlc.arg(dst_id)::uuid, ft.tag_id
+FROM file_tags ft
+WHERE ft.file_id = sqlc.arg(src_id)::uuid
+ON CONFLICT DO NOTHING;
+
+-- name: CopyFolderTags :exec
+INSERT INTO folder_tags (folder_id, tag_id)
+SELECT sqlc.arg(dst_id)::uuid, dt.tag_id
+FROM folder_tags dt
+WHERE dt.folder_id = sqlc.arg(src_id)::uuid
+ON CONFLICT DO NOTHING;
+
+-- name: ListFileProperties :many
+SELECT * FROM file_properties
+WHERE file_id = $1
+ORDER BY key;
+
+-- name: ListFolderProperties :many
+SELECT * FROM folder_properties
+WHERE folder_id = $1
+ORDER BY key;
+
+-- name: SetFileProperty :exec
+INSERT INTO file_properties (file_id, key, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (file_id, key) DO UPDATE
+SET value = EXCLUDED.value, updated_at = now();
+
+-- name: SetFolderProperty :exec
+INSERT INTO folder_properties (folder_id, key, value)
+VALUES ($1, $2, $3)
+ON CONFLICT (folder_id, key) DO UPDATE
+SET value = EXCLUDED.value, updated_at = now();
+
+-- name: DeleteFileProperty :execrows
+DELETE FROM file_properties
+WHERE file_id = $1 AND key = $2;
+
+-- name: DeleteFolderProperty :execrows
+DELETE FROM folder_properties
+WHERE folder_id = $1 AND key = $2;
+
+-- name: CopyFileProperties :exec
+INSERT INTO file_properties (file_id, key, value)
+SELECT sqlc.arg(dst_id)::uuid, fp.key, fp.value
+FROM file_properties fp
+WHERE fp.file_id = sqlc.arg(src_id)::uuid
+ON CONFLICT (file_id, key) DO NOTHING;
+
+-- name: CopyFolderProperties :exec
+INSERT INTO folder_properties (folder_id, key, value)
+SELECT sqlc.arg(dst_id)::uuid, dp.key, dp.value
+FROM folder_properties dp
+WHERE dp.folder_id = sqlc.arg(src_id)::uuid
+ON CONFLICT (folder_id, key) DO NOTHING;
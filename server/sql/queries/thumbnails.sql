@@ -0,0 +1,4 @@
+-- name: SetThumbnailState :execrows
+UPDATE files
+SET thumbnail_state = $2
+WHERE id = $1;
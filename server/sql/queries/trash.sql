@@ -0,0 +1,86 @@
+-- name: TrashFile :execrows
+UPDATE files
+SET trashed_at = now()
+WHERE id = $1 AND user_id = $2 AND trashed_at IS NULL;
+
+-- name: RestoreFile :execrows
+UPDATE files
+SET trashed_at = NULL
+WHERE id = $1 AND user_id = $2 AND trashed_at IS NOT NULL;
+
+-- name: TrashFolder :execrows
+-- Stamps the folder and everything below it that isn't already in the trash.
+-- now() is fixed for the statement, so the whole subtree shares one stamp.
+WITH tree AS (
+    SELECT c.descendant_id AS id
+    FROM folder_closure c
+    INNER JOIN folders f0 ON f0.id = c.ancestor_id
+    WHERE f0.id = sqlc.arg(id) AND f0.user_id = sqlc.arg(user_id) AND f0.trashed_at IS NULL
+),
+trashed_files AS (
+    UPDATE files
+    SET trashed_at = now()
+    WHERE files.folder_id IN (SELECT tree.id FROM tree) AND files.trashed_at IS NULL
+)
+UPDATE folders
+SET trashed_at = now()
+WHERE folders.id IN (SELECT tree.id FROM tree) AND folders.trashed_at IS NULL;
+
+-- name: RestoreFolder :execrows
+-- Restores the folder and whatever was trashed together with it; items that
+-- were trashed on their own beforehand stay in the trash.
+WITH root AS (
+    SELECT f0.id, f0.trashed_at
+    FROM folders f0
+    WHERE f0.id = sqlc.arg(id) AND f0.user_id = sqlc.arg(user_id) AND f0.trashed_at IS NOT NULL
+),
+tree AS (
+    SELECT c.descendant_id AS id
+    FROM folder_closure c
+    INNER JOIN root ON root.id = c.ancestor_id
+),
+restored_files AS (
+    UPDATE files
+    SET trashed_at = NULL
+    WHERE files.folder_id IN (SELECT tree.id FROM tree)
+      AND files.trashed_at = (SELECT root.trashed_at FROM root)
+)
+UPDATE folders
+SET trashed_at = NULL
+WHERE folders.id IN (SELECT tree.id FROM tree)
+  AND folders.trashed_at = (SELECT root.trashed_at FROM root);
+
+-- name: ListTrash :many
+-- Lists what the user put in the trash: items whose parent was not trashed
+-- along with them. The folder branch comes first so the nullable columns are
+-- typed as such.
+SELECT
+    'folder'::text AS kind,
+    d.id,
+    d.parent_id,
+    d.name,
+    NULL::text AS mime_type,
+    NULL::bigint AS size_bytes,
+    d.trashed_at::timestamp AS trashed_at
+FROM folders d
+LEFT JOIN folders dp ON dp.id = d.parent_id
+WHERE d.user_id = sqlc.arg(user_id)
+  AND d.trashed_at IS NOT NULL
+  AND dp.trashed_at IS DISTINCT FROM d.trashed_at
+
+UNION ALL
+
+SELECT
+    'file'::text AS kind,
+    f.id,
+    f.folder_id AS parent_id,
+    f.name,
+    f.mime_type,
+    f.size_bytes,
+    f.trashed_at::timestamp AS trashed_at
+FROM files f
+LEFT JOIN folders fp ON fp.id = f.folder_id
+WHERE f.user_id = sqlc.arg(user_id)
+  AND f.trashed_at IS NOT NULL
+  AND fp.trashed_at IS DISTINCT FROM f.trashed_at
+ORDER BY trashed_at DESC, id;
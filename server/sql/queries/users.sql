@@ -51,3 +51,131 @@ WHERE id = $1;
 -- name: DeleteUser :execrows
 DELETE FROM users
 WHERE id = $1;
+
+
+-- name: ListUsers :many
+SELECT * FROM users
+ORDER BY id
+LIMIT $1 OFFSET $2;
+
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE email ILIKE '%' || replace(replace(replace(sqlc.arg(query)::text, '\', '\\'), '%', '\%'), '_', '\_') || '%' ESCAPE '\'
+ORDER BY id
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: SetUserRole :execrows
+UPDATE users
+SET role = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: SetUserStorageQuota :execrows
+UPDATE users
+SET storage_quota = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: SetUserDisabled :execrows
+UPDATE users
+SET is_disabled = $2,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: IncrementFailedLogins :one
+UPDATE users
+SET failed_login_attempts = failed_login_attempts + 1
+WHERE id = $1
+RETURNING failed_login_attempts;
+
+-- name: LockUserUntil :execrows
+UPDATE users
+SET locked_until = $2
+WHERE id = $1;
+
+-- name: ResetFailedLogins :execrows
+UPDATE users
+SET failed_login_attempts = 0,
+    locked_until = NULL
+WHERE id = $1;
+
+-- name: SetPendingEmailChange :execrows
+UPDATE users
+SET pending_email = $2,
+    email_change_token_hash = $3,
+    email_change_cancel_hash = $4,
+    email_change_expiry = $5,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: GetUserByEmailChangeToken :one
+SELECT * FROM users WHERE email_change_token_hash = $1;
+
+-- name: GetUserByEmailChangeCancelToken :one
+SELECT * FROM users WHERE email_change_cancel_hash = $1;
+
+-- name: ApplyEmailChange :execrows
+UPDATE users
+SET email = pending_email,
+    is_verified = TRUE,
+    pending_email = NULL,
+    email_change_token_hash = NULL,
+    email_change_cancel_hash = NULL,
+    email_change_expiry = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND pending_email IS NOT NULL;
+
+-- name: ClearEmailChange :execrows
+UPDATE users
+SET pending_email = NULL,
+    email_change_token_hash = NULL,
+    email_change_cancel_hash = NULL,
+    email_change_expiry = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: ScheduleAccountDeletion :one
+UPDATE users
+SET deletion_requested_at = now(),
+    deletion_scheduled_at = now() + make_interval(secs => sqlc.arg(grace_seconds)::float8),
+    deletion_locked_until = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id)
+RETURNING deletion_scheduled_at;
+
+-- name: CancelAccountDeletion :execrows
+-- Only possible while the grace period is still running.
+UPDATE users
+SET deletion_requested_at = NULL,
+    deletion_scheduled_at = NULL,
+    deletion_locked_until = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND deletion_scheduled_at > now();
+
+-- name: ClaimDueAccountDeletions :many
+-- Leases accounts whose grace period is over, so a crashed purge is retried
+-- once the lease runs out.
+UPDATE users
+SET deletion_locked_until = now() + make_interval(secs => sqlc.arg(lease_seconds)::float8)
+WHERE id IN (
+    SELECT id FROM users
+    WHERE deletion_scheduled_at <= now()
+      AND (deletion_locked_until IS NULL OR deletion_locked_until <= now())
+    ORDER BY deletion_scheduled_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id;
+
+-- name: PurgeUser :execrows
+DELETE FROM users
+WHERE id = $1 AND deletion_scheduled_at IS NOT NULL;
+
+-- name: GetStorageUsage :one
+-- Usage is summed from files rather than read from used_storage, which
+-- nothing keeps up to date.
+SELECT
+    u.storage_quota,
+    COALESCE((SELECT SUM(f.size_bytes) FROM files f WHERE f.user_id = u.id), 0)::bigint AS used_bytes
+FROM users u
+WHERE u.id = $1;
@@ -0,0 +1,16 @@
+-- +goose Up
+
+ALTER TABLE users
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin')),
+    ADD COLUMN storage_quota BIGINT NOT NULL DEFAULT 10737418240 CHECK (storage_quota >= 0), -- 10 GiB
+    ADD COLUMN is_disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_users_role ON users(role);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_users_role;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS is_disabled,
+    DROP COLUMN IF EXISTS storage_quota,
+    DROP COLUMN IF EXISTS role;
@@ -0,0 +1,24 @@
+-- +goose Up
+
+-- Shared token buckets so limits hold across server instances
+CREATE TABLE rate_limit_buckets (
+    bucket_key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    allowed BOOLEAN NOT NULL,              -- whether the last take succeeded
+    updated_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_rate_limit_buckets_updated_at ON rate_limit_buckets(updated_at);
+
+-- Progressive lockout after repeated failed logins
+ALTER TABLE users
+    ADD COLUMN failed_login_attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until TIMESTAMP;
+
+-- +goose Down
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS locked_until,
+    DROP COLUMN IF EXISTS failed_login_attempts;
+DROP INDEX IF EXISTS idx_rate_limit_buckets_updated_at;
+DROP TABLE IF EXISTS rate_limit_buckets;
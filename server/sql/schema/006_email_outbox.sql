@@ -0,0 +1,23 @@
+-- +goose Up
+
+CREATE TABLE email_outbox (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    template TEXT NOT NULL,                  -- e.g. verification, password_reset
+    to_address VARCHAR(255) NOT NULL,
+    subject TEXT NOT NULL,
+    text_body TEXT NOT NULL,
+    html_body TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT now(),
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX idx_email_outbox_pending ON email_outbox(next_attempt_at) WHERE status = 'pending';
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_email_outbox_pending;
+DROP TABLE IF EXISTS email_outbox;
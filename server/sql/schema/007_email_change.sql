@@ -0,0 +1,21 @@
+-- +goose Up
+
+-- Pending email change; tokens are stored as SHA-256 hashes
+ALTER TABLE users
+    ADD COLUMN pending_email VARCHAR(255),
+    ADD COLUMN email_change_token_hash TEXT,
+    ADD COLUMN email_change_cancel_hash TEXT,
+    ADD COLUMN email_change_expiry TIMESTAMP;
+
+CREATE UNIQUE INDEX idx_users_email_change_token ON users(email_change_token_hash);
+CREATE UNIQUE INDEX idx_users_email_change_cancel ON users(email_change_cancel_hash);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_users_email_change_cancel;
+DROP INDEX IF EXISTS idx_users_email_change_token;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS email_change_expiry,
+    DROP COLUMN IF EXISTS email_change_cancel_hash,
+    DROP COLUMN IF EXISTS email_change_token_hash,
+    DROP COLUMN IF EXISTS pending_email;
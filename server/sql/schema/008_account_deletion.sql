@@ -0,0 +1,28 @@
+-- +goose Up
+
+-- Self-service account deletion. deletion_scheduled_at is the end of the grace
+-- period; deletion_locked_until leases the purge to a single worker.
+ALTER TABLE users
+    ADD COLUMN deletion_requested_at TIMESTAMP,
+    ADD COLUMN deletion_scheduled_at TIMESTAMP,
+    ADD COLUMN deletion_locked_until TIMESTAMP;
+
+CREATE INDEX idx_users_deletion_scheduled ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+-- refresh_tokens was created without a cascade, which made deleting a user
+-- with any session fail
+ALTER TABLE refresh_tokens
+    DROP CONSTRAINT refresh_tokens_user_id_fkey,
+    ADD CONSTRAINT refresh_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- +goose Down
+
+ALTER TABLE refresh_tokens
+    DROP CONSTRAINT refresh_tokens_user_id_fkey,
+    ADD CONSTRAINT refresh_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+DROP INDEX IF EXISTS idx_users_deletion_scheduled;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS deletion_locked_until,
+    DROP COLUMN IF EXISTS deletion_scheduled_at,
+    DROP COLUMN IF EXISTS deletion_requested_at;
@@ -0,0 +1,38 @@
+-- +goose Up
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- content_text holds normalized text extracted from the file body. The search
+-- vectors are generated columns, so they follow every name, path or content
+-- change without application code having to maintain them.
+ALTER TABLE files
+    ADD COLUMN content_text TEXT,
+    ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', name || ' ' || regexp_replace(name, '[^[:alnum:]]+', ' ', 'g')), 'A') ||
+        setweight(to_tsvector('english', regexp_replace(file_path, '[^[:alnum:]]+', ' ', 'g')), 'B') ||
+        setweight(to_tsvector('english', coalesce(mime_type, '')), 'C') ||
+        setweight(to_tsvector('english', coalesce(content_text, '')), 'D')
+    ) STORED;
+
+ALTER TABLE folders
+    ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', name || ' ' || regexp_replace(name, '[^[:alnum:]]+', ' ', 'g')), 'A')
+    ) STORED;
+
+CREATE INDEX idx_files_search ON files USING GIN (search_vector);
+CREATE INDEX idx_files_name_trgm ON files USING GIN (name gin_trgm_ops);
+CREATE INDEX idx_folders_search ON folders USING GIN (search_vector);
+CREATE INDEX idx_folders_name_trgm ON folders USING GIN (name gin_trgm_ops);
+CREATE INDEX idx_file_shares_shared_with ON file_shares(shared_with);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_file_shares_shared_with;
+DROP INDEX IF EXISTS idx_folders_name_trgm;
+DROP INDEX IF EXISTS idx_folders_search;
+DROP INDEX IF EXISTS idx_files_name_trgm;
+DROP INDEX IF EXISTS idx_files_search;
+ALTER TABLE folders DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE files
+    DROP COLUMN IF EXISTS search_vector,
+    DROP COLUMN IF EXISTS content_text;
@@ -0,0 +1,33 @@
+-- +goose Up
+
+-- Generic background job queue. Workers lease due jobs by pushing
+-- locked_until forward; a job whose lease runs out is picked up again.
+CREATE TABLE jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind TEXT NOT NULL,                      -- e.g. extract_text
+    user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'done', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    run_at TIMESTAMP NOT NULL DEFAULT now(),
+    locked_until TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP NOT NULL DEFAULT now(),
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX idx_jobs_due ON jobs(run_at) WHERE status IN ('pending', 'running');
+CREATE INDEX idx_jobs_user_id ON jobs(user_id);
+
+-- When content_text was last extracted; NULL means never
+ALTER TABLE files
+    ADD COLUMN text_extracted_at TIMESTAMP;
+
+-- +goose Down
+
+ALTER TABLE files DROP COLUMN IF EXISTS text_extracted_at;
+DROP INDEX IF EXISTS idx_jobs_user_id;
+DROP INDEX IF EXISTS idx_jobs_due;
+DROP TABLE IF EXISTS jobs;
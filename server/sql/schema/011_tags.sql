@@ -0,0 +1,56 @@
+-- +goose Up
+
+-- Per-user tags. Names are stored lowercased so "Work" and "work" are one tag.
+CREATE TABLE tags (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL CHECK (name <> ''),
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE(user_id, name)
+);
+
+-- Tags and properties hang off the item id, so they follow the item through
+-- moves and renames without any extra bookkeeping.
+CREATE TABLE file_tags (
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    tag_id UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (file_id, tag_id)
+);
+
+CREATE TABLE folder_tags (
+    folder_id UUID NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    tag_id UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (folder_id, tag_id)
+);
+
+CREATE INDEX idx_file_tags_tag_id ON file_tags(tag_id);
+CREATE INDEX idx_folder_tags_tag_id ON folder_tags(tag_id);
+
+-- Free-form key/value metadata
+CREATE TABLE file_properties (
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    key TEXT NOT NULL CHECK (key <> ''),
+    value TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (file_id, key)
+);
+
+CREATE TABLE folder_properties (
+    folder_id UUID NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    key TEXT NOT NULL CHECK (key <> ''),
+    value TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (folder_id, key)
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS folder_properties;
+DROP TABLE IF EXISTS file_properties;
+DROP INDEX IF EXISTS idx_folder_tags_tag_id;
+DROP INDEX IF EXISTS idx_file_tags_tag_id;
+DROP TABLE IF EXISTS folder_tags;
+DROP TABLE IF EXISTS file_tags;
+DROP TABLE IF EXISTS tags;
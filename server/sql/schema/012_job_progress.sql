@@ -0,0 +1,14 @@
+-- +goose Up
+
+-- Long-running jobs report how far along they are, and what they produced
+ALTER TABLE jobs
+    ADD COLUMN progress_done BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN progress_total BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN result JSONB;
+
+-- +goose Down
+
+ALTER TABLE jobs
+    DROP COLUMN IF EXISTS result,
+    DROP COLUMN IF EXISTS progress_total,
+    DROP COLUMN IF EXISTS progress_done;
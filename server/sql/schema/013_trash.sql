@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- Trashed items stay on disk and count towards the quota until they are
+-- deleted for good. Trashing a folder stamps its whole subtree with the same
+-- time, so restoring it brings back exactly what went in with it.
+ALTER TABLE folders ADD COLUMN trashed_at TIMESTAMP;
+ALTER TABLE files ADD COLUMN trashed_at TIMESTAMP;
+
+CREATE INDEX idx_folders_trashed ON folders (user_id) WHERE trashed_at IS NOT NULL;
+CREATE INDEX idx_files_trashed ON files (user_id) WHERE trashed_at IS NOT NULL;
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_files_trashed;
+DROP INDEX IF EXISTS idx_folders_trashed;
+
+ALTER TABLE files DROP COLUMN IF EXISTS trashed_at;
+ALTER TABLE folders DROP COLUMN IF EXISTS trashed_at;
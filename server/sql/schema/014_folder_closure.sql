@@ -0,0 +1,99 @@
+-- +goose Up
+
+-- One row per (ancestor, descendant) pair, including each folder with itself
+-- at depth 0. Paths, subtrees and cycle checks become a single indexed
+-- lookup instead of one query per level. Triggers keep it in step with
+-- folders.parent_id, so no write path can forget to.
+CREATE TABLE folder_closure (
+    ancestor_id UUID NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    descendant_id UUID NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    depth INT NOT NULL CHECK (depth >= 0),
+    PRIMARY KEY (ancestor_id, descendant_id)
+);
+
+CREATE INDEX idx_folder_closure_descendant ON folder_closure (descendant_id, depth);
+
+-- Existing folders. Nothing stopped a move into a folder's own subtree
+-- before this migration, so the walk remembers where it has been rather than
+-- going round a cycle forever.
+INSERT INTO folder_closure (ancestor_id, descendant_id, depth)
+WITH RECURSIVE chain AS (
+    SELECT id AS ancestor_id, id AS descendant_id, 0 AS depth, ARRAY[id] AS seen
+    FROM folders
+
+    UNION ALL
+
+    SELECT f.parent_id, c.descendant_id, c.depth + 1, c.seen || f.parent_id
+    FROM chain c
+    INNER JOIN folders f ON f.id = c.ancestor_id
+    WHERE f.parent_id IS NOT NULL
+      AND f.parent_id <> ALL (c.seen)
+)
+SELECT ancestor_id, descendant_id, depth FROM chain;
+
+-- +goose StatementBegin
+CREATE FUNCTION folder_closure_insert() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO folder_closure (ancestor_id, descendant_id, depth)
+    VALUES (NEW.id, NEW.id, 0);
+
+    IF NEW.parent_id IS NOT NULL THEN
+        INSERT INTO folder_closure (ancestor_id, descendant_id, depth)
+        SELECT ancestor_id, NEW.id, depth + 1
+        FROM folder_closure
+        WHERE descendant_id = NEW.parent_id;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION folder_closure_move() RETURNS trigger AS $$
+BEGIN
+    IF NEW.parent_id IS NOT NULL AND EXISTS (
+        SELECT 1 FROM folder_closure
+        WHERE ancestor_id = NEW.id AND descendant_id = NEW.parent_id
+    ) THEN
+        RAISE EXCEPTION 'folder % cannot be moved into its own subtree', NEW.id
+            USING ERRCODE = 'check_violation';
+    END IF;
+
+    -- Detach the subtree from its old ancestors...
+    DELETE FROM folder_closure
+    WHERE descendant_id IN (SELECT descendant_id FROM folder_closure WHERE ancestor_id = NEW.id)
+      AND ancestor_id NOT IN (SELECT descendant_id FROM folder_closure WHERE ancestor_id = NEW.id);
+
+    -- ...and hang it under the new ones
+    IF NEW.parent_id IS NOT NULL THEN
+        INSERT INTO folder_closure (ancestor_id, descendant_id, depth)
+        SELECT above.ancestor_id, below.descendant_id, above.depth + below.depth + 1
+        FROM folder_closure above
+        CROSS JOIN folder_closure below
+        WHERE above.descendant_id = NEW.parent_id
+          AND below.ancestor_id = NEW.id;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER folders_closure_insert
+    AFTER INSERT ON folders
+    FOR EACH ROW EXECUTE FUNCTION folder_closure_insert();
+
+CREATE TRIGGER folders_closure_move
+    AFTER UPDATE OF parent_id ON folders
+    FOR EACH ROW
+    WHEN (OLD.parent_id IS DISTINCT FROM NEW.parent_id)
+    EXECUTE FUNCTION folder_closure_move();
+
+-- +goose Down
+
+DROP TRIGGER IF EXISTS folders_closure_move ON folders;
+DROP TRIGGER IF EXISTS folders_closure_insert ON folders;
+DROP FUNCTION IF EXISTS folder_closure_move();
+DROP FUNCTION IF EXISTS folder_closure_insert();
+DROP TABLE IF EXISTS folder_closure;
@@ -0,0 +1,149 @@
+-- +goose Up
+
+-- UNIQUE(user_id, parent_id, name) and UNIQUE(folder_id, name) never fired at
+-- the root, where the parent is NULL and NULLs are distinct. Duplicates that
+-- slipped in there are renamed the way a conflicting upload would be, to
+-- "name (2)" or "report (2).pdf", so nothing is lost. The oldest folder of
+-- each name keeps it; of files the newest does, since its content is the one
+-- on disk.
+ALTER TABLE folders DROP CONSTRAINT IF EXISTS folders_user_id_parent_id_name_key;
+ALTER TABLE files DROP CONSTRAINT IF EXISTS files_folder_id_name_key;
+
+-- Duplicates shared one path on disk with the entry that kept its name. A
+-- renamed entry gets a file_path of its own here, and the storage_relocate
+-- job copies the data across, so deleting the duplicate later can't take
+-- the kept entry's data with it.
+CREATE TABLE storage_relocations (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_path TEXT NOT NULL,
+    new_path TEXT NOT NULL,
+    is_dir BOOLEAN NOT NULL
+);
+
+-- +goose StatementBegin
+DO $$
+DECLARE
+    dup RECORD;
+    ext TEXT;
+    candidate TEXT;
+    n INT;
+BEGIN
+    FOR dup IN
+        SELECT d.id, d.user_id, d.name
+        FROM folders d
+        WHERE d.parent_id IS NULL
+          AND EXISTS (
+              SELECT 1 FROM folders k
+              WHERE k.user_id = d.user_id
+                AND k.parent_id IS NULL
+                AND k.name = d.name
+                AND (k.created_at, k.id) < (d.created_at, d.id)
+          )
+        ORDER BY d.created_at, d.id
+    LOOP
+        -- Files and folders share the directory on disk, so neither may
+        -- already have the new name
+        n := 2;
+        LOOP
+            candidate := dup.name || ' (' || n || ')';
+            EXIT WHEN NOT EXISTS (
+                SELECT 1 FROM folders
+                WHERE user_id = dup.user_id AND parent_id IS NULL AND name = candidate
+            ) AND NOT EXISTS (
+                SELECT 1 FROM files
+                WHERE user_id = dup.user_id AND folder_id IS NULL AND name = candidate
+            );
+            n := n + 1;
+        END LOOP;
+        UPDATE folders SET name = candidate WHERE id = dup.id;
+
+        -- Every folder in the subtree needs its directory...
+        INSERT INTO storage_relocations (user_id, old_path, new_path, is_dir)
+        SELECT dup.user_id, dup.name || substr(p.path, length(candidate) + 1), p.path, true
+        FROM (
+            SELECT (
+                SELECT string_agg(a.name, '/' ORDER BY c.depth DESC)
+                FROM folder_closure c
+                INNER JOIN folders a ON a.id = c.ancestor_id
+                WHERE c.descendant_id = s.descendant_id
+            ) AS path
+            FROM folder_closure s
+            WHERE s.ancestor_id = dup.id
+        ) p
+        ORDER BY p.path;
+
+        -- ...and every file in it a copy of its data
+        WITH moved AS (
+            UPDATE files
+            SET file_path = candidate || substr(file_path, length(dup.name) + 1)
+            WHERE folder_id IN (SELECT descendant_id FROM folder_closure WHERE ancestor_id = dup.id)
+              AND left(file_path, length(dup.name) + 1) = dup.name || '/'
+            RETURNING file_path
+        )
+        INSERT INTO storage_relocations (user_id, old_path, new_path, is_dir)
+        SELECT dup.user_id, dup.name || substr(file_path, length(candidate) + 1), file_path, false
+        FROM moved;
+    END LOOP;
+
+    FOR dup IN
+        SELECT f.id, f.user_id, f.name, f.file_path
+        FROM files f
+        WHERE f.folder_id IS NULL
+          AND EXISTS (
+              SELECT 1 FROM files k
+              WHERE k.user_id = f.user_id
+                AND k.folder_id IS NULL
+                AND k.name = f.name
+                AND (k.created_at, k.id) > (f.created_at, f.id)
+          )
+        ORDER BY f.created_at DESC, f.id DESC
+    LOOP
+        -- Keep the extension last; dotfiles like ".env" have none
+        ext := COALESCE(substring(dup.name FROM '\.[^.]*$'), '');
+        IF ext = dup.name THEN
+            ext := '';
+        END IF;
+        n := 2;
+        LOOP
+            candidate := left(dup.name, length(dup.name) - length(ext)) || ' (' || n || ')' || ext;
+            EXIT WHEN NOT EXISTS (
+                SELECT 1 FROM files
+                WHERE user_id = dup.user_id AND folder_id IS NULL AND name = candidate
+            ) AND NOT EXISTS (
+                SELECT 1 FROM folders
+                WHERE user_id = dup.user_id AND parent_id IS NULL AND name = candidate
+            );
+            n := n + 1;
+        END LOOP;
+        UPDATE files SET name = candidate, file_path = candidate WHERE id = dup.id;
+
+        INSERT INTO storage_relocations (user_id, old_path, new_path, is_dir)
+        VALUES (dup.user_id, dup.file_path, candidate, false);
+    END LOOP;
+END;
+$$;
+-- +goose StatementEnd
+
+INSERT INTO jobs (kind)
+SELECT 'storage_relocate'
+WHERE EXISTS (SELECT 1 FROM storage_relocations);
+
+-- The nil UUID stands in for the root so that it takes part in uniqueness.
+-- files gains user_id because folder_id alone no longer tells users apart
+-- at the root.
+CREATE UNIQUE INDEX folders_unique_name ON folders
+    (user_id, COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'::uuid), name);
+CREATE UNIQUE INDEX files_unique_name ON files
+    (user_id, COALESCE(folder_id, '00000000-0000-0000-0000-000000000000'::uuid), name);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS files_unique_name;
+DROP INDEX IF EXISTS folders_unique_name;
+
+DELETE FROM jobs WHERE kind = 'storage_relocate';
+DROP TABLE IF EXISTS storage_relocations;
+
+ALTER TABLE files ADD CONSTRAINT files_folder_id_name_key UNIQUE (folder_id, name);
+ALTER TABLE folders ADD CONSTRAINT folders_user_id_parent_id_name_key UNIQUE (user_id, parent_id, name);
@@ -0,0 +1,87 @@
+-- +goose Up
+
+-- Recursive folder totals, computed on demand from folder_closure and kept
+-- until something underneath changes. Triggers drop the cached row of every
+-- ancestor of a write, so no write path can leave a stale total behind.
+CREATE TABLE folder_stats (
+    folder_id UUID PRIMARY KEY REFERENCES folders(id) ON DELETE CASCADE,
+    size_bytes BIGINT NOT NULL,
+    file_count BIGINT NOT NULL,
+    folder_count BIGINT NOT NULL,
+    last_modified TIMESTAMP,
+    computed_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- +goose StatementBegin
+CREATE FUNCTION folder_stats_invalidate(folder UUID) RETURNS void AS $$
+BEGIN
+    IF folder IS NULL THEN
+        RETURN;
+    END IF;
+
+    DELETE FROM folder_stats
+    WHERE folder_id IN (
+        SELECT ancestor_id FROM folder_closure WHERE descendant_id = folder
+    );
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION folder_stats_file_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM folder_stats_invalidate(OLD.folder_id);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM folder_stats_invalidate(NEW.folder_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION folder_stats_folder_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM folder_stats_invalidate(OLD.parent_id);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        -- The folder's own row goes too: a rename or trash changes it
+        PERFORM folder_stats_invalidate(NEW.id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER files_stats_invalidate
+    AFTER INSERT OR UPDATE OR DELETE ON files
+    FOR EACH ROW EXECUTE FUNCTION folder_stats_file_changed();
+
+-- Named to sort after folders_closure_*, so a move sees the new ancestors
+CREATE TRIGGER folders_stats_invalidate
+    AFTER INSERT OR UPDATE OR DELETE ON folders
+    FOR EACH ROW EXECUTE FUNCTION folder_stats_folder_changed();
+
+-- One row per user per day. Today's row is rewritten on every run, so the
+-- last run of a day is the one that stays.
+CREATE TABLE usage_snapshots (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    used_bytes BIGINT NOT NULL,
+    file_count BIGINT NOT NULL,
+    PRIMARY KEY (user_id, day)
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS usage_snapshots;
+
+DROP TRIGGER IF EXISTS folders_stats_invalidate ON folders;
+DROP TRIGGER IF EXISTS files_stats_invalidate ON files;
+DROP FUNCTION IF EXISTS folder_stats_folder_changed();
+DROP FUNCTION IF EXISTS folder_stats_file_changed();
+DROP FUNCTION IF EXISTS folder_stats_invalidate(UUID);
+DROP TABLE IF EXISTS folder_stats;
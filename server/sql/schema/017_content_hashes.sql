@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- Hex SHA-256 of the stored content, computed while the upload streams to
+-- storage. NULL until then, and for files uploaded before this migration
+-- until the backfill job below reaches them.
+ALTER TABLE files ADD COLUMN sha256 TEXT CHECK (sha256 ~ '^[0-9a-f]{64}$');
+
+CREATE INDEX idx_files_user_sha256 ON files (user_id, sha256, size_bytes) WHERE sha256 IS NOT NULL;
+
+-- First link of the backfill chain; each run hashes a batch and queues the next
+INSERT INTO jobs (kind) VALUES ('hash_backfill');
+
+-- +goose Down
+
+DELETE FROM jobs WHERE kind = 'hash_backfill';
+DROP INDEX IF EXISTS idx_files_user_sha256;
+ALTER TABLE files DROP COLUMN IF EXISTS sha256;
@@ -0,0 +1,10 @@
+-- +goose Up
+
+-- NULL for files that never get thumbnails; otherwise where generation is.
+-- The images themselves live in derived storage, keyed by file ID.
+ALTER TABLE files
+    ADD COLUMN thumbnail_state TEXT CHECK (thumbnail_state IN ('pending', 'ready', 'failed'));
+
+-- +goose Down
+
+ALTER TABLE files DROP COLUMN IF EXISTS thumbnail_state;
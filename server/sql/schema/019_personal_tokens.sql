@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- Long-lived secrets for clients that can only do Basic auth, such as WebDAV
+-- mounts. Only a hash of each token is kept; the token itself is shown once.
+CREATE TABLE personal_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP,
+    expires_at TIMESTAMP
+);
+
+CREATE INDEX idx_personal_tokens_user_id ON personal_tokens(user_id);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_personal_tokens_user_id;
+DROP TABLE IF EXISTS personal_tokens;
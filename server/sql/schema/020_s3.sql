@@ -0,0 +1,42 @@
+-- +goose Up
+
+-- Access keys for the S3 gateway. SigV4 signs requests with the secret
+-- itself, so unlike personal tokens it has to be kept as issued.
+CREATE TABLE s3_access_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    access_key_id TEXT NOT NULL UNIQUE,
+    secret_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX idx_s3_access_keys_user_id ON s3_access_keys(user_id);
+
+-- Multipart uploads in progress. Part content is kept as derived files of
+-- the upload until it is completed or aborted.
+CREATE TABLE s3_multipart_uploads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    object_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_s3_multipart_uploads_user_id ON s3_multipart_uploads(user_id, object_key);
+
+CREATE TABLE s3_multipart_parts (
+    upload_id UUID NOT NULL REFERENCES s3_multipart_uploads(id) ON DELETE CASCADE,
+    part_number INT NOT NULL,
+    etag TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (upload_id, part_number)
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS s3_multipart_parts;
+DROP INDEX IF EXISTS idx_s3_multipart_uploads_user_id;
+DROP TABLE IF EXISTS s3_multipart_uploads;
+DROP INDEX IF EXISTS idx_s3_access_keys_user_id;
+DROP TABLE IF EXISTS s3_access_keys;
@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- Public keys users sign in to the SFTP server with. The fingerprint is the
+-- SHA256 form OpenSSH prints, so users can match keys against ssh-keygen -l.
+CREATE TABLE ssh_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP,
+    UNIQUE (user_id, fingerprint)
+);
+
+-- +goose Down
+DROP TABLE ssh_keys;
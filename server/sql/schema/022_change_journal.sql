@@ -0,0 +1,214 @@
+-- +goose Up
+
+-- Every user's changes to their files, folders and shares, in the order they
+-- were committed, for sync clients to catch up from where they left off.
+-- Triggers write the entries, so each one commits or rolls back with the
+-- change it records, whichever code path made it.
+CREATE TABLE change_journal (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    seq BIGINT NOT NULL,
+    item_type TEXT NOT NULL CHECK (item_type IN ('file', 'folder')),
+    -- Not a reference: deleted items keep their entries
+    item_id UUID NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('create', 'update', 'move', 'rename', 'delete', 'share')),
+    parent_id UUID,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, seq)
+);
+
+CREATE INDEX idx_change_journal_created_at ON change_journal (created_at);
+
+-- The last sequence number handed out to each user, and how far pruning has
+-- gone. Taking the next number locks the row until the change commits, so
+-- a user's entries become visible in sequence order and a reader that has
+-- seen one entry has seen every entry before it.
+CREATE TABLE change_journal_heads (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    seq BIGINT NOT NULL,
+    pruned_through BIGINT NOT NULL DEFAULT 0
+);
+
+-- +goose StatementBegin
+CREATE FUNCTION change_journal_record(uid INT, kind TEXT, item UUID, act TEXT, parent UUID, item_name TEXT) RETURNS void AS $$
+DECLARE
+    next_seq BIGINT;
+BEGIN
+    -- Deleting a user cascades to their files, which has nothing to record
+    IF uid IS NULL OR NOT EXISTS (SELECT 1 FROM users WHERE id = uid) THEN
+        RETURN;
+    END IF;
+
+    INSERT INTO change_journal_heads (user_id, seq)
+    VALUES (uid, 1)
+    ON CONFLICT (user_id) DO UPDATE SET seq = change_journal_heads.seq + 1
+    RETURNING seq INTO next_seq;
+
+    INSERT INTO change_journal (user_id, seq, item_type, item_id, action, parent_id, name)
+    VALUES (uid, next_seq, kind, item, act, parent, item_name);
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- Records a change for the item's owner and, for a shared file, for the
+-- users it is shared with, without the owner's folder.
+-- +goose StatementBegin
+CREATE FUNCTION change_journal_append(uid INT, kind TEXT, item UUID, act TEXT, parent UUID, item_name TEXT) RETURNS void AS $$
+DECLARE
+    recipient INT;
+BEGIN
+    PERFORM change_journal_record(uid, kind, item, act, parent, item_name);
+
+    -- Share events record their recipient themselves
+    IF kind <> 'file' OR act = 'share' THEN
+        RETURN;
+    END IF;
+    FOR recipient IN
+        SELECT shared_with FROM file_shares
+        WHERE file_id = item AND shared_with IS DISTINCT FROM uid
+    LOOP
+        PERFORM change_journal_record(recipient, kind, item, act, NULL, item_name);
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- Trashing counts as a delete and restoring as a create, since that is when
+-- items leave and rejoin the tree. Updates that only touch derived columns
+-- (search text, thumbnails, stored paths) record nothing.
+-- +goose StatementBegin
+CREATE FUNCTION change_journal_file_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM change_journal_append(NEW.user_id, 'file', NEW.id, 'create', NEW.folder_id, NEW.name);
+    ELSIF TG_OP = 'DELETE' THEN
+        IF OLD.trashed_at IS NULL THEN
+            PERFORM change_journal_append(OLD.user_id, 'file', OLD.id, 'delete', OLD.folder_id, OLD.name);
+        END IF;
+    ELSIF OLD.trashed_at IS NULL AND NEW.trashed_at IS NOT NULL THEN
+        PERFORM change_journal_append(NEW.user_id, 'file', NEW.id, 'delete', NEW.folder_id, NEW.name);
+    ELSIF OLD.trashed_at IS NOT NULL AND NEW.trashed_at IS NULL THEN
+        PERFORM change_journal_append(NEW.user_id, 'file', NEW.id, 'create', NEW.folder_id, NEW.name);
+    ELSIF NEW.trashed_at IS NULL THEN
+        IF OLD.folder_id IS DISTINCT FROM NEW.folder_id THEN
+            PERFORM change_journal_append(NEW.user_id, 'file', NEW.id, 'move', NEW.folder_id, NEW.name);
+        ELSIF OLD.name <> NEW.name THEN
+            PERFORM change_journal_append(NEW.user_id, 'file', NEW.id, 'rename', NEW.folder_id, NEW.name);
+        END IF;
+        -- A hash filled in for the first time describes the same content
+        IF OLD.size_bytes <> NEW.size_bytes
+            OR OLD.mime_type IS DISTINCT FROM NEW.mime_type
+            OR (OLD.sha256 IS NOT NULL AND OLD.sha256 IS DISTINCT FROM NEW.sha256) THEN
+            PERFORM change_journal_append(NEW.user_id, 'file', NEW.id, 'update', NEW.folder_id, NEW.name);
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION change_journal_folder_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM change_journal_append(NEW.user_id, 'folder', NEW.id, 'create', NEW.parent_id, NEW.name);
+    ELSIF TG_OP = 'DELETE' THEN
+        IF OLD.trashed_at IS NULL THEN
+            PERFORM change_journal_append(OLD.user_id, 'folder', OLD.id, 'delete', OLD.parent_id, OLD.name);
+        END IF;
+    ELSIF OLD.trashed_at IS NULL AND NEW.trashed_at IS NOT NULL THEN
+        PERFORM change_journal_append(NEW.user_id, 'folder', NEW.id, 'delete', NEW.parent_id, NEW.name);
+    ELSIF OLD.trashed_at IS NOT NULL AND NEW.trashed_at IS NULL THEN
+        PERFORM change_journal_append(NEW.user_id, 'folder', NEW.id, 'create', NEW.parent_id, NEW.name);
+    ELSIF NEW.trashed_at IS NULL THEN
+        IF OLD.parent_id IS DISTINCT FROM NEW.parent_id THEN
+            PERFORM change_journal_append(NEW.user_id, 'folder', NEW.id, 'move', NEW.parent_id, NEW.name);
+        ELSIF OLD.name <> NEW.name THEN
+            PERFORM change_journal_append(NEW.user_id, 'folder', NEW.id, 'rename', NEW.parent_id, NEW.name);
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- A share is recorded for the owner and for the user it is shared with,
+-- whose shared items change. Shares removed along with their file record
+-- nothing more than the file's delete.
+-- +goose StatementBegin
+CREATE FUNCTION change_journal_share_changed() RETURNS trigger AS $$
+DECLARE
+    share file_shares%ROWTYPE;
+    f files%ROWTYPE;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        share := OLD;
+    ELSE
+        share := NEW;
+    END IF;
+
+    SELECT * INTO f FROM files WHERE id = share.file_id;
+    IF NOT FOUND OR f.trashed_at IS NOT NULL THEN
+        RETURN NULL;
+    END IF;
+
+    PERFORM change_journal_record(f.user_id, 'file', f.id, 'share', f.folder_id, f.name);
+    IF share.shared_with IS DISTINCT FROM f.user_id THEN
+        PERFORM change_journal_record(share.shared_with, 'file', f.id, 'share', NULL, f.name);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- A file's shares are gone by the time its AFTER DELETE trigger runs, so
+-- recipients hear about the delete before the row goes. Trashed files were
+-- already announced as deleted when they were trashed.
+-- +goose StatementBegin
+CREATE FUNCTION change_journal_shared_file_deleting() RETURNS trigger AS $$
+DECLARE
+    recipient INT;
+BEGIN
+    IF OLD.trashed_at IS NULL THEN
+        FOR recipient IN
+            SELECT shared_with FROM file_shares
+            WHERE file_id = OLD.id AND shared_with IS DISTINCT FROM OLD.user_id
+        LOOP
+            PERFORM change_journal_record(recipient, 'file', OLD.id, 'delete', NULL, OLD.name);
+        END LOOP;
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER files_change_journal
+    AFTER INSERT OR UPDATE OR DELETE ON files
+    FOR EACH ROW EXECUTE FUNCTION change_journal_file_changed();
+
+CREATE TRIGGER files_change_journal_shares
+    BEFORE DELETE ON files
+    FOR EACH ROW EXECUTE FUNCTION change_journal_shared_file_deleting();
+
+CREATE TRIGGER folders_change_journal
+    AFTER INSERT OR UPDATE OR DELETE ON folders
+    FOR EACH ROW EXECUTE FUNCTION change_journal_folder_changed();
+
+CREATE TRIGGER file_shares_change_journal
+    AFTER INSERT OR UPDATE OR DELETE ON file_shares
+    FOR EACH ROW EXECUTE FUNCTION change_journal_share_changed();
+
+-- +goose Down
+
+DROP TRIGGER IF EXISTS file_shares_change_journal ON file_shares;
+DROP TRIGGER IF EXISTS folders_change_journal ON folders;
+DROP TRIGGER IF EXISTS files_change_journal_shares ON files;
+DROP TRIGGER IF EXISTS files_change_journal ON files;
+DROP FUNCTION IF EXISTS change_journal_share_changed();
+DROP FUNCTION IF EXISTS change_journal_folder_changed();
+DROP FUNCTION IF EXISTS change_journal_shared_file_deleting();
+DROP FUNCTION IF EXISTS change_journal_file_changed();
+DROP FUNCTION IF EXISTS change_journal_append(INT, TEXT, UUID, TEXT, UUID, TEXT);
+DROP FUNCTION IF EXISTS change_journal_record(INT, TEXT, UUID, TEXT, UUID, TEXT);
+DROP TABLE IF EXISTS change_journal_heads;
+DROP TABLE IF EXISTS change_journal;
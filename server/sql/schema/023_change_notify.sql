@@ -0,0 +1,49 @@
+-- +goose Up
+
+-- Entries are announced on the change_journal channel with the user's ID,
+-- which Postgres delivers only once the change commits, so every server
+-- instance can wake the streams of that user.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION change_journal_record(uid INT, kind TEXT, item UUID, act TEXT, parent UUID, item_name TEXT) RETURNS void AS $$
+DECLARE
+    next_seq BIGINT;
+BEGIN
+    -- Deleting a user cascades to their files, which has nothing to record
+    IF uid IS NULL OR NOT EXISTS (SELECT 1 FROM users WHERE id = uid) THEN
+        RETURN;
+    END IF;
+
+    INSERT INTO change_journal_heads (user_id, seq)
+    VALUES (uid, 1)
+    ON CONFLICT (user_id) DO UPDATE SET seq = change_journal_heads.seq + 1
+    RETURNING seq INTO next_seq;
+
+    INSERT INTO change_journal (user_id, seq, item_type, item_id, action, parent_id, name)
+    VALUES (uid, next_seq, kind, item, act, parent, item_name);
+
+    PERFORM pg_notify('change_journal', uid::TEXT);
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION change_journal_record(uid INT, kind TEXT, item UUID, act TEXT, parent UUID, item_name TEXT) RETURNS void AS $$
+DECLARE
+    next_seq BIGINT;
+BEGIN
+    IF uid IS NULL OR NOT EXISTS (SELECT 1 FROM users WHERE id = uid) THEN
+        RETURN;
+    END IF;
+
+    INSERT INTO change_journal_heads (user_id, seq)
+    VALUES (uid, 1)
+    ON CONFLICT (user_id) DO UPDATE SET seq = change_journal_heads.seq + 1
+    RETURNING seq INTO next_seq;
+
+    INSERT INTO change_journal (user_id, seq, item_type, item_id, action, parent_id, name)
+    VALUES (uid, next_seq, kind, item, act, parent, item_name);
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- One-time tickets for opening event streams. Browsers can't send headers
+-- on EventSource or WebSocket connections, so clients trade their access
+-- token for a ticket and pass that in the URL instead. Only a hash is kept.
+CREATE TABLE stream_tickets (
+    ticket_hash TEXT PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_stream_tickets_expires_at ON stream_tickets(expires_at);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_stream_tickets_expires_at;
+DROP TABLE IF EXISTS stream_tickets;
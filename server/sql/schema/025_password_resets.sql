@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- Outstanding password reset links. Only a hash of each token is kept, and
+-- a token is deleted as it is used.
+CREATE TABLE password_resets (
+    token_hash TEXT PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_password_resets_user_id ON password_resets(user_id);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_password_resets_user_id;
+DROP TABLE IF EXISTS password_resets;
@@ -0,0 +1,10 @@
+-- +goose Up
+
+-- Access tokens carry the version they were issued under. Revoking a user's
+-- sessions bumps it, which retires every access token already handed out
+-- along with the refresh tokens.
+ALTER TABLE users ADD COLUMN token_version INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+
+ALTER TABLE users DROP COLUMN IF EXISTS token_version;